@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/proof"
+	"github.com/garrettladley/smerkle/internal/remote"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// The HTTP API serve exposes beside the sync protocol:
+//
+//	GET  /api/v1/objects/{hash}  the encoded object
+//	PUT  /api/v1/objects/{hash}  store the encoded object -> 201, or 204 if present
+//	GET  /api/v1/trees/{tree}    the tree's entries, as cat-tree --output json
+//	POST /api/v1/diff            {"old": ..., "new": ...} -> diff --output json
+//	GET  /api/v1/prove?root=&path=  the proof prove prints
+//
+// {tree}, old, new and root are hashes or ref names, and a snapshot stands
+// for its root, as on the command line; old and new may also be
+// <tree>:<path>. A diff request may also set "shallow", "find_copies" and
+// "max_changes", which mean what the diff flags do.
+const apiPrefix = "/api/v1/"
+
+// maxAPIJSONSize bounds a diff request body.
+const maxAPIJSONSize = 1 << 20
+
+type diffRequestJSON struct {
+	Old        string `json:"old"`
+	New        string `json:"new"`
+	Shallow    bool   `json:"shallow"`
+	FindCopies bool   `json:"find_copies"`
+	MaxChanges int    `json:"max_changes"`
+}
+
+// apiHandler serves the HTTP API for s. It is safe for concurrent requests.
+type apiHandler struct {
+	s *smerkle.Store
+}
+
+func (a *apiHandler) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+apiPrefix+"objects/{hash}", a.getObject)
+	mux.HandleFunc("PUT "+apiPrefix+"objects/{hash}", a.putObject)
+	mux.HandleFunc("GET "+apiPrefix+"trees/{tree}", a.getTree)
+	mux.HandleFunc("POST "+apiPrefix+"diff", a.diff)
+	mux.HandleFunc("GET "+apiPrefix+"prove", a.prove)
+}
+
+func (a *apiHandler) getObject(w http.ResponseWriter, r *http.Request) {
+	h, err := parseHashArg(r.PathValue("hash"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := a.s.GetObject(h)
+	if err != nil {
+		apiError(w, fmt.Errorf("get object %s: %w", h, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
+
+func (a *apiHandler) putObject(w http.ResponseWriter, r *http.Request) {
+	h, err := parseHashArg(r.PathValue("hash"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// a PUT carries what one sync frame does, so a bad client can't
+	// exhaust memory
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, remote.MaxObjectSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("read body: %v", err), status)
+		return
+	}
+	if a.s.HasObject(h) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// the sync protocol's store checks data against h and that its children
+	// are present before writing it
+	if err := remote.NewLocal(a.s).Store(r.Context(), []remote.Object{{Hash: h, Data: data}}); err != nil {
+		apiError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *apiHandler) getTree(w http.ResponseWriter, r *http.Request) {
+	h, err := resolveHashArg(a.s, r.PathValue("tree"))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	data, err := a.s.GetObject(h)
+	if err != nil {
+		apiError(w, fmt.Errorf("get tree %s: %w", h, err))
+		return
+	}
+	if !bytes.HasPrefix(data, []byte(object.MagicTree)) {
+		http.Error(w, fmt.Sprintf("%s is not a tree", h), http.StatusBadRequest)
+		return
+	}
+	tree, err := object.DecodeTree(data)
+	if err != nil {
+		apiError(w, fmt.Errorf("decode tree %s: %w", h, err))
+		return
+	}
+	entries := make([]*report.EntryJSON, 0, len(tree.Entries))
+	for i := range tree.Entries {
+		entries = append(entries, report.NewEntryJSON(&tree.Entries[i]))
+	}
+	writeAPIJSON(w, entries)
+}
+
+func (a *apiHandler) diff(w http.ResponseWriter, r *http.Request) {
+	var in diffRequestJSON
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAPIJSONSize)).Decode(&in); err != nil {
+		http.Error(w, fmt.Sprintf("decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if in.Old == "" || in.New == "" {
+		http.Error(w, "diff needs old and new", http.StatusBadRequest)
+		return
+	}
+	oldHash, err := resolveHashArg(a.s, in.Old)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	newHash, err := resolveHashArg(a.s, in.New)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	res, err := smerkle.Diff(a.s, oldHash, newHash, smerkle.DiffOptions{
+		Recursive:  !in.Shallow,
+		FindCopies: in.FindCopies,
+		MaxChanges: in.MaxChanges,
+	})
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	writeAPIJSON(w, report.NewDiffJSON(res))
+}
+
+// prove serves auditors checking a deployed file against a published root
+// without access to the store: the proof verifies with verify-proof alone.
+func (a *apiHandler) prove(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("root") == "" || q.Get("path") == "" {
+		http.Error(w, "prove needs root and path", http.StatusBadRequest)
+		return
+	}
+	root, err := resolveHashArg(a.s, q.Get("root"))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	pr, err := proof.Prove(a.s, root, q.Get("path"))
+	if err != nil {
+		apiError(w, fmt.Errorf("prove %s: %w", q.Get("path"), err))
+		return
+	}
+	writeAPIJSON(w, newProofJSON(pr))
+}
+
+// apiError reports err with the status its cause calls for: 404 for a
+// missing object, ref, or path, 400 for a bad ref name or path or an object
+// that doesn't match its hash or references one not stored, else 500.
+func apiError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, smerkle.ErrRefNotFound), errors.Is(err, smerkle.ErrPathNotFound),
+		errors.Is(err, proof.ErrPathNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, remote.ErrCorrupt), errors.Is(err, remote.ErrMissingChild), errors.Is(err, remote.ErrUnknownObject),
+		errors.Is(err, smerkle.ErrInvalidRefName), errors.Is(err, smerkle.ErrInvalidPath), errors.Is(err, proof.ErrInvalidPath):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeAPIJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
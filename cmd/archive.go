@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/archive"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+const archiveLong = "Archives are read in place, without extracting them. The hash of a zip\n" +
+	"archive equals that of its extracted contents, provided the extraction\n" +
+	"kept symlinks and executable bits. 7z archives are not supported."
+
+func newArchiveCmd(g *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Hash and compare archive contents",
+		Long:  "Hash and compare archive contents.\n\n" + archiveLong,
+	}
+
+	cmd.AddCommand(
+		newArchiveHashCmd(g),
+		newArchiveDiffCmd(g),
+	)
+
+	return cmd
+}
+
+type archiveHashOptions struct {
+	output string
+}
+
+func newArchiveHashCmd(g *globalOptions) *cobra.Command {
+	o := &archiveHashOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "hash <archive>",
+		Short: "Compute the tree hash of an archive's contents",
+		Long:  "Compute the tree hash of an archive's contents.\n\n" + archiveLong,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runArchiveHash(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+type archiveHashJSON struct {
+	Hash    string   `json:"hash"`
+	Skipped []string `json:"skipped"`
+}
+
+func runArchiveHash(cmd *cobra.Command, g *globalOptions, o *archiveHashOptions, p string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	res, err := loadArchive(cmd, s, p)
+	if err != nil {
+		return err
+	}
+
+	if o.output == outputJSON {
+		skipped := res.Skipped
+		if skipped == nil {
+			skipped = []string{}
+		}
+		return writeJSON(cmd.OutOrStdout(), archiveHashJSON{Hash: res.Root.String(), Skipped: skipped})
+	}
+
+	if _, err := fmt.Fprintln(cmd.OutOrStdout(), res.Root); err != nil {
+		return fmt.Errorf("write hash: %w", err)
+	}
+	return nil
+}
+
+func newArchiveDiffCmd(g *globalOptions) *cobra.Command {
+	o := &diffOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff <old-archive> <new-archive>",
+		Short: "Show changes between the contents of two archives",
+		Long:  "Show changes between the contents of two archives.\n\n" + archiveLong,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runArchiveDiff(cmd, g, o, args[0], args[1])
+		},
+	}
+
+	o.addFlags(cmd)
+	o.addPatchFlag(cmd)
+
+	return cmd
+}
+
+func runArchiveDiff(cmd *cobra.Command, g *globalOptions, o *diffOptions, oldPath, newPath string) (err error) {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	oldRes, err := loadArchive(cmd, s, oldPath)
+	if err != nil {
+		return err
+	}
+	newRes, err := loadArchive(cmd, s, newPath)
+	if err != nil {
+		return err
+	}
+
+	opts, err := o.diffOptions(g)
+	if err != nil {
+		return err
+	}
+	res, err := smerkle.Diff(s, oldRes.Root, newRes.Root, opts)
+	if err != nil {
+		return err //nolint:wrapcheck // diff errors already carry context
+	}
+
+	return o.writeResult(cmd, s, res)
+}
+
+// loadArchive loads the archive at p and warns about entries it had to skip.
+func loadArchive(cmd *cobra.Command, s *smerkle.Store, p string) (*archive.Result, error) {
+	res, err := archive.Load(s, p)
+	if err != nil {
+		return nil, fmt.Errorf("load archive %s: %w", p, err)
+	}
+	for _, skipped := range res.Skipped {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s: %s: entry skipped\n", p, skipped)
+	}
+	return res, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/materialize"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/remote"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type bundleOptions struct {
+	out string
+}
+
+func newBundleCmd(g *globalOptions) *cobra.Command {
+	o := &bundleOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "bundle <old> <new>",
+		Short: "Write the objects needed to go from one tree to another to a file",
+		Long: "Write the objects needed to go from one tree to another to a file.\n\n" +
+			"The bundle holds everything under <new> that isn't under <old>, so a\n" +
+			"store holding <old> can take it with apply-bundle and then hold <new>,\n" +
+			"without the two machines ever connecting. Each is a hash or the name\n" +
+			"of a ref; a snapshot brings its history along. The bundle goes to\n" +
+			"stdout unless -o is given, and a summary to stderr.",
+		Example: `  smerkle bundle release-1 HEAD -o update.bundle`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBundle(cmd, g, o, args[0], args[1])
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.out, "output-file", "o", "", "write to this file instead of stdout")
+
+	return cmd
+}
+
+func runBundle(cmd *cobra.Command, g *globalOptions, o *bundleOptions, oldArg, newArg string) (err error) {
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	oldRoot, err := lookupHashArg(s, oldArg)
+	if err != nil {
+		return err
+	}
+	newRoot, err := lookupHashArg(s, newArg)
+	if err != nil {
+		return err
+	}
+
+	w := cmd.OutOrStdout()
+	if o.out != "" {
+		f, err := os.Create(o.out) //nolint:gosec // user-chosen output path
+		if err != nil {
+			return fmt.Errorf("create %s: %w", o.out, err)
+		}
+		defer func() {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = fmt.Errorf("close %s: %w", o.out, cerr)
+			}
+		}()
+		w = f
+	}
+
+	res, err := remote.WriteBundle(cmd.Context(), w, s, oldRoot, newRoot)
+	if err != nil {
+		return fmt.Errorf("bundle %s..%s: %w", oldRoot, newRoot, err)
+	}
+	_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "bundled %s..%s: %d objects, %d bytes\n", oldRoot, newRoot, res.Objects, res.Bytes)
+	return nil
+}
+
+type applyBundleOptions struct {
+	output   string
+	tag      string
+	worktree string
+}
+
+func newApplyBundleCmd(g *globalOptions) *cobra.Command {
+	o := &applyBundleOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "apply-bundle <file>",
+		Short: "Add the objects in a bundle to the store",
+		Long: "Add the objects in a bundle to the store.\n\n" +
+			"The store must already hold the bundle's old tree. Every object is\n" +
+			"checked against its hash. With --worktree, a directory holding the old\n" +
+			"tree is then brought to the new one in place: removed paths are\n" +
+			"deleted and changed ones rewritten, leaving the rest untouched.\n" +
+			"<file> is - for stdin.",
+		Example: `  smerkle apply-bundle update.bundle --tag release-2 --worktree ./site`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runApplyBundle(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().StringVar(&o.tag, "tag", "", "point this ref at the bundle's new tree")
+	cmd.Flags().StringVar(&o.worktree, "worktree", "", "update this directory from the bundle's old tree to its new one")
+
+	return cmd
+}
+
+type applyBundleJSON struct {
+	Old     string `json:"old"`
+	New     string `json:"new"`
+	Objects int    `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+	Removed int    `json:"removed,omitempty"`
+	Written int    `json:"written,omitempty"`
+}
+
+func runApplyBundle(cmd *cobra.Command, g *globalOptions, o *applyBundleOptions, p string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	if o.tag != "" {
+		if err := smerkle.ValidateRefName(o.tag); err != nil {
+			return fmt.Errorf("--tag: %w", err)
+		}
+	}
+
+	var r io.Reader = cmd.InOrStdin()
+	if p != "-" {
+		f, err := os.Open(p) //nolint:gosec // the user names the bundle
+		if err != nil {
+			return fmt.Errorf("open bundle: %w", err)
+		}
+		defer f.Close() //nolint:errcheck // read-only
+		r = f
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex())
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	hdr, res, err := remote.ApplyBundle(cmd.Context(), r, s)
+	if err != nil {
+		return fmt.Errorf("apply bundle: %w", err)
+	}
+	if o.tag != "" {
+		if err := updateRef(s, o.tag, hdr.New, ""); err != nil {
+			return fmt.Errorf("tag %s: %w", o.tag, err)
+		}
+	}
+
+	out := applyBundleJSON{Old: hdr.Old.String(), New: hdr.New.String(), Objects: res.Objects, Bytes: res.Bytes}
+	if o.worktree != "" {
+		up, err := updateWorktree(cmd, s, hdr, o.worktree)
+		if err != nil {
+			return err
+		}
+		out.Removed, out.Written = up.Removed, up.Files+up.Symlinks
+	}
+
+	if o.output == outputJSON {
+		return writeJSON(cmd.OutOrStdout(), out)
+	}
+	w := cmd.OutOrStdout()
+	if _, err := fmt.Fprintf(w, "applied %s..%s: %d objects, %d bytes\n", hdr.Old, hdr.New, res.Objects, res.Bytes); err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	if o.worktree != "" {
+		if _, err := fmt.Fprintf(w, "updated %s: %d paths removed, %d written\n", o.worktree, out.Removed, out.Written); err != nil {
+			return fmt.Errorf("write summary: %w", err)
+		}
+	}
+	return nil
+}
+
+// updateWorktree brings dir from the bundle's old tree to its new one; a
+// snapshot stands for its root.
+func updateWorktree(cmd *cobra.Command, s *smerkle.Store, hdr *remote.BundleHeader, dir string) (*materialize.Result, error) {
+	var roots [2]object.Hash
+	for i, h := range []object.Hash{hdr.Old, hdr.New} {
+		root, err := resolveHashArg(s, h.String())
+		if err != nil {
+			return nil, err
+		}
+		roots[i] = root
+	}
+	res, err := materialize.Update(cmd.Context(), s, roots[0], roots[1], dir)
+	if err != nil {
+		return nil, fmt.Errorf("update %s: %w", dir, err)
+	}
+	for _, p := range res.Skipped {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s: inaccessible, not restored\n", p)
+	}
+	return res, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type catTreeOptions struct {
+	output string
+}
+
+func newCatTreeCmd(g *globalOptions) *cobra.Command {
+	o := &catTreeOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cat-tree <hash>[:<path>]",
+		Short: "Print the entries of a stored tree",
+		Long: `Print the entries of a stored tree. <hash> may be a ref or snapshot, and
+<hash>:<path> names the subdirectory or file at path inside it; a file is
+printed as its own single entry.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCatTree(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+func runCatTree(cmd *cobra.Command, g *globalOptions, o *catTreeOptions, arg string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	e, err := resolveEntryArg(s, arg)
+	if err != nil {
+		return err
+	}
+
+	tree := &smerkle.Tree{Entries: []smerkle.Entry{e}}
+	if e.Mode == smerkle.ModeDirectory {
+		if tree, err = s.GetTree(e.Hash); err != nil {
+			return fmt.Errorf("get tree %s: %w", e.Hash, err)
+		}
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		entries := make([]*report.EntryJSON, 0, len(tree.Entries))
+		for i := range tree.Entries {
+			entries = append(entries, report.NewEntryJSON(&tree.Entries[i]))
+		}
+		return writeJSON(w, entries)
+	}
+
+	for _, e := range tree.Entries {
+		// full-metadata trees add permissions and owner:group before the name
+		var meta string
+		if e.Meta != nil {
+			meta = fmt.Sprintf(" %04o %d:%d", e.Meta.Perm, e.Meta.UID, e.Meta.GID)
+		}
+		if _, err := fmt.Fprintf(w, "%-10s %10d %s%s\t%s\n", e.Mode, e.Size, e.Hash, meta, e.Name); err != nil {
+			return fmt.Errorf("write entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func newCatBlobCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cat-blob <hash>",
+		Short: "Print the content of a stored blob or chunked file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCatBlob(cmd, g, args[0])
+		},
+	}
+}
+
+func runCatBlob(cmd *cobra.Command, g *globalOptions, arg string) (err error) {
+	h, err := parseHashArg(arg)
+	if err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	content, err := s.ReadFile(h)
+	if err != nil {
+		return fmt.Errorf("read file %s: %w", h, err)
+	}
+
+	if _, err := cmd.OutOrStdout().Write(content); err != nil {
+		return fmt.Errorf("write blob: %w", err)
+	}
+	return nil
+}
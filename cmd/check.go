@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+)
+
+// check exit codes; 1 is left for errors.
+const (
+	checkExitChanged  = 2
+	checkExitFirstRun = 3
+)
+
+const (
+	transitionUnchanged = "unchanged"
+	transitionChanged   = "changed"
+	transitionFirstRun  = "first_run"
+)
+
+type checkOptions struct {
+	walkOptions
+	output string
+	state  string
+}
+
+func newCheckCmd(g *globalOptions) *cobra.Command {
+	o := &checkOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "check [path]",
+		Short: "Compare a directory against the root recorded in a state file",
+		Long: "Compare a directory against the root recorded in a state file.\n\n" +
+			"The state file is rewritten when the root changes. The exit status\n" +
+			"reports the transition, for monitoring scripts:\n\n" +
+			"  0  unchanged since the last check\n" +
+			"  1  error, or a path that could not be hashed or was left unvisited;\n" +
+			"     the state file is left as it was\n" +
+			"  2  changed; the state file now holds the new root\n" +
+			"  3  first run; the state file was created",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := g.walkRoot(args)
+			return runCheck(cmd, g, o, root)
+		},
+	}
+
+	o.addFlags(cmd)
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().StringVar(&o.state, "state", "", "file recording the last seen root")
+	_ = cmd.MarkFlagRequired("state")
+
+	return cmd
+}
+
+// checkState is the state file's content.
+type checkState struct {
+	Hash string    `json:"hash"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"` // when Hash was first seen
+}
+
+type checkJSON struct {
+	Transition string `json:"transition"`
+	Hash       string `json:"hash"`
+	Previous   string `json:"previous,omitempty"`
+}
+
+func runCheck(cmd *cobra.Command, g *globalOptions, o *checkOptions, root string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	prev, err := readCheckState(o.state)
+	if err != nil {
+		return err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", root, err)
+	}
+	if prev != nil && prev.Path != absRoot {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: state file %s was recorded for %s\n", o.state, prev.Path)
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	res, err := o.walk(cmd, g, s, root)
+	if err != nil {
+		return err
+	}
+	report.WriteWarnings(cmd.ErrOrStderr(), res)
+	// a root missing paths would read as a change that never happened, so
+	// it is neither compared nor recorded
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("%d paths could not be hashed; state file left as it was", len(res.Errors))
+	}
+	if res.Partial() {
+		return fmt.Errorf("the walk stopped early with %d paths not visited; state file left as it was", len(res.Unvisited))
+	}
+	if err := s.PutProvenance(newProvenance(res, root, g, &o.walkOptions)); err != nil {
+		return fmt.Errorf("record provenance: %w", err)
+	}
+
+	out := checkJSON{Transition: transitionUnchanged, Hash: res.Hash.String()}
+	switch {
+	case prev == nil:
+		out.Transition = transitionFirstRun
+	case prev.Hash != out.Hash:
+		out.Transition = transitionChanged
+		out.Previous = prev.Hash
+	}
+
+	if out.Transition != transitionUnchanged {
+		next := checkState{Hash: out.Hash, Path: absRoot, Time: time.Now().UTC()}
+		if err := writeCheckState(o.state, &next); err != nil {
+			return err
+		}
+	}
+
+	if err := writeCheck(cmd, o.output, &out); err != nil {
+		return err
+	}
+	switch out.Transition {
+	case transitionChanged:
+		return &exitError{code: checkExitChanged}
+	case transitionFirstRun:
+		return &exitError{code: checkExitFirstRun}
+	}
+	return nil
+}
+
+func writeCheck(cmd *cobra.Command, format string, out *checkJSON) error {
+	if format == outputJSON {
+		return writeJSON(cmd.OutOrStdout(), out)
+	}
+
+	var err error
+	switch out.Transition {
+	case transitionChanged:
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s %s -> %s\n", out.Transition, out.Previous, out.Hash)
+	default:
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", out.Transition, out.Hash)
+	}
+	if err != nil {
+		return fmt.Errorf("write check: %w", err)
+	}
+	return nil
+}
+
+// readCheckState returns the recorded state, or nil if p doesn't exist yet.
+func readCheckState(p string) (*checkState, error) {
+	data, err := os.ReadFile(p) //nolint:gosec // the user names the state file
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state file: %w", err)
+	}
+
+	var st checkState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", p, err)
+	}
+	if _, err := object.ParseHash(st.Hash); err != nil {
+		return nil, fmt.Errorf("state file %s: %w", p, err)
+	}
+	return &st, nil
+}
+
+// writeCheckState replaces the state file atomically, so a monitor killed
+// mid-write never leaves a state that reads as a first run.
+func writeCheckState(p string, st *checkState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-state-*")
+	if err != nil {
+		return fmt.Errorf("create state file: %w", err)
+	}
+	tmp := f.Name()
+	_, werr := f.Write(append(data, '\n'))
+	cerr := f.Close()
+	if err := errors.Join(werr, cerr); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	return nil
+}
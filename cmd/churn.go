@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/churn"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type churnOptions struct {
+	output string
+	top    int
+}
+
+func newChurnCmd(g *globalOptions) *cobra.Command {
+	o := &churnOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "churn <old>..<new> | <hash> <hash>...",
+		Short: "Report the most frequently changed paths across a series of roots",
+		Long: "Report the most frequently changed paths across a series of roots.\n\n" +
+			"With <old>..<new>, the series is every root recorded by `smerkle hash`\n" +
+			"for the same path between the two, in the order they were hashed. A\n" +
+			"root hashed more than once, as after a revert, is taken where <new>\n" +
+			"was last hashed and <old> last before it.\n" +
+			"Otherwise the given hashes are compared in order.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChurn(cmd, g, o, args)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().IntVar(&o.top, "top", 10, "number of paths and directories to list (0 = all)")
+
+	return cmd
+}
+
+func runChurn(cmd *cobra.Command, g *globalOptions, o *churnOptions, args []string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	roots, err := resolveSeries(s, args)
+	if err != nil {
+		return err
+	}
+	if len(roots) < 2 {
+		return errors.New("churn needs at least two roots")
+	}
+
+	r, err := churn.Compute(s, roots)
+	if err != nil {
+		return fmt.Errorf("compute churn: %w", err)
+	}
+	return writeChurn(cmd.OutOrStdout(), o.output, r, o.top)
+}
+
+// resolveSeries expands a single <old>..<new> argument into the recorded
+// roots between them, or parses each argument as a hash.
+func resolveSeries(s *smerkle.Store, args []string) ([]object.Hash, error) {
+	oldArg, newArg, isRange := strings.Cut(args[0], "..")
+	if !isRange {
+		roots := make([]object.Hash, 0, len(args))
+		for _, arg := range args {
+			h, err := resolveHashArg(s, arg)
+			if err != nil {
+				return nil, err
+			}
+			roots = append(roots, h)
+		}
+		return roots, nil
+	}
+	if len(args) > 1 {
+		return nil, errors.New("a range takes no further arguments")
+	}
+
+	oldHash, err := resolveHashArg(s, oldArg)
+	if err != nil {
+		return nil, err
+	}
+	newHash, err := resolveHashArg(s, newArg)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.RootHistory()
+	if err != nil {
+		return nil, fmt.Errorf("read root history: %w", err)
+	}
+	// records are oldest first, and a root hashed again, as after a revert,
+	// appears again; the series runs to new's latest record from old's latest
+	// before it, taking the records between them for the same path
+	newIdx := -1
+	for i, r := range records {
+		if r.Root == newHash {
+			newIdx = i
+		}
+	}
+	if newIdx < 0 {
+		return nil, fmt.Errorf("no provenance recorded for %s", newHash)
+	}
+	oldIdx := -1
+	for i, r := range records[:newIdx] {
+		if r.Root == oldHash {
+			oldIdx = i
+		}
+	}
+	if oldIdx < 0 {
+		if !slices.ContainsFunc(records, func(r smerkle.RootRecord) bool { return r.Root == oldHash }) {
+			return nil, fmt.Errorf("no provenance recorded for %s", oldHash)
+		}
+		return nil, fmt.Errorf("%s was hashed before %s", newHash, oldHash)
+	}
+
+	roots := []object.Hash{oldHash}
+	for _, r := range records[oldIdx+1 : newIdx] {
+		if r.Path == records[newIdx].Path {
+			roots = append(roots, r.Root)
+		}
+	}
+	return append(roots, newHash), nil
+}
+
+type churnCountJSON struct {
+	Path    string `json:"path"`
+	Changes int    `json:"changes"`
+}
+
+type churnJSON struct {
+	Roots        []string         `json:"roots"`
+	Changes      int              `json:"changes"`
+	BytesChurned int64            `json:"bytes_churned"`
+	Paths        []churnCountJSON `json:"paths"`
+	Dirs         []churnCountJSON `json:"dirs"`
+}
+
+func writeChurn(w io.Writer, format string, r *churn.Report, top int) error {
+	limit := func(counts []churn.Count) []churn.Count {
+		if top > 0 && len(counts) > top {
+			return counts[:top]
+		}
+		return counts
+	}
+	paths, dirs := limit(r.Paths), limit(r.Dirs)
+
+	if format == outputJSON {
+		toJSON := func(counts []churn.Count) []churnCountJSON {
+			out := make([]churnCountJSON, 0, len(counts))
+			for _, c := range counts {
+				out = append(out, churnCountJSON(c))
+			}
+			return out
+		}
+		roots := make([]string, 0, len(r.Roots))
+		for _, h := range r.Roots {
+			roots = append(roots, h.String())
+		}
+		return writeJSON(w, churnJSON{
+			Roots:        roots,
+			Changes:      r.Changes,
+			BytesChurned: r.BytesChurned,
+			Paths:        toJSON(paths),
+			Dirs:         toJSON(dirs),
+		})
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "roots: %d\nchanges: %d\nbytes churned: %d\n", len(r.Roots), r.Changes, r.BytesChurned)
+	b.WriteString("\nmost changed paths:\n")
+	for _, c := range paths {
+		fmt.Fprintf(&b, "%6d\t%s\n", c.Changes, c.Path)
+	}
+	b.WriteString("\nmost changed directories:\n")
+	for _, c := range dirs {
+		fmt.Fprintf(&b, "%6d\t%s\n", c.Changes, c.Path)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write churn: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,1702 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/cmdtest"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/remote"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// newEnv returns an Env holding a small tree with nested directories.
+func newEnv(t *testing.T) *cmdtest.Env {
+	t.Helper()
+	e := cmdtest.New(t, newRootCmd)
+	e.WriteFile("README.md", "# demo\n")
+	e.WriteFile("src/main.go", "package main\n")
+	e.WriteFile("src/util/util.go", "package util\n")
+	return e
+}
+
+func hashRoot(t *testing.T, e *cmdtest.Env) string {
+	t.Helper()
+	return strings.TrimSpace(e.MustRun("hash", e.Dir).Stdout)
+}
+
+// modify edits, adds, and deletes one file each.
+func modify(e *cmdtest.Env) {
+	e.WriteFile("src/main.go", "package main\n\nfunc main() {}\n")
+	e.WriteFile("docs/guide.md", "guide\n")
+	e.Remove("src/util/util.go")
+}
+
+// writeProof saves the proof of p in root outside the work directory and
+// returns its path.
+func writeProof(t *testing.T, e *cmdtest.Env, root, p string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "proof.json")
+	if err := os.WriteFile(path, []byte(e.MustRun("prove", root, p).Stdout), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGoldenOutput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, e *cmdtest.Env) cmdtest.Result
+	}{
+		{
+			name: "hash",
+			run: func(_ *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("hash", e.Dir)
+			},
+		},
+		{
+			name: "hash_json",
+			run: func(_ *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("hash", "--output", "json", e.Dir)
+			},
+		},
+		{
+			name: "hash_ndjson",
+			run: func(_ *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("hash", "--output", "ndjson", e.Dir)
+			},
+		},
+		{
+			name: "hash_porcelain",
+			run: func(_ *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("hash", "--output", "porcelain", e.Dir)
+			},
+		},
+		{
+			name: "status",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				base := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("status", "--base", base, e.Dir)
+			},
+		},
+		{
+			name: "status_json",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				base := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("status", "--base", base, "--output", "json", e.Dir)
+			},
+		},
+		{
+			name: "diff",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_json",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--output", "json", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_ndjson",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--output", "ndjson", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_jsonl",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--output", "jsonl", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_porcelain",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--output", "porcelain", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_path",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--path", "src", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_stat",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--stat", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_stat_json",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--stat", "--output", "json", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_patch",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--patch", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_jsonl_hunks",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--jsonl-hunks", old, hashRoot(t, e))
+			},
+		},
+		{
+			name: "diff_worktree",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				old := hashRoot(t, e)
+				modify(e)
+				return e.MustRun("diff", "--worktree", old, e.Dir)
+			},
+		},
+		{
+			name: "restore",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				root := hashRoot(t, e)
+				res := e.MustRun("restore", root, e.Path("restored"))
+				if got := strings.TrimSpace(e.MustRun("hash", e.Path("restored")).Stdout); got != root {
+					t.Errorf("restored tree hash = %s, want %s", got, root)
+				}
+				return res
+			},
+		},
+		{
+			name: "spot_check",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				hashRoot(t, e)
+				return e.MustRun("spot-check", "--sample", "100%", "--seed", "1", e.Dir)
+			},
+		},
+		{
+			name: "prove",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("prove", hashRoot(t, e), "src/main.go")
+			},
+		},
+		{
+			name: "verify_proof",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				root := hashRoot(t, e)
+				p := writeProof(t, e, root, "src/util/util.go")
+				return e.MustRun("verify-proof", "--root", root, "--file", e.Path("src/util/util.go"), p)
+			},
+		},
+		{
+			name: "push_pull",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				root := hashRoot(t, e)
+				remote := filepath.Join(t.TempDir(), "remote")
+				out := e.MustRun("push", remote, root).Stdout
+				out += e.MustRun("push", remote, root).Stdout
+				out += e.MustRun("--store", filepath.Join(t.TempDir(), "other"), "pull", remote, root).Stdout
+				return cmdtest.Result{Stdout: out}
+			},
+		},
+		{
+			name: "cat_tree",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("cat-tree", hashRoot(t, e))
+			},
+		},
+		{
+			name: "cat_tree_json",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("cat-tree", "--output", "json", hashRoot(t, e))
+			},
+		},
+		{
+			name: "cat_tree_path",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("cat-tree", hashRoot(t, e)+":src")
+			},
+		},
+		{
+			name: "ls_files",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("ls-files", "-l", hashRoot(t, e))
+			},
+		},
+		{
+			name: "ls_files_glob_json",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("ls-files", "--glob", "*.go", "--output", "json", hashRoot(t, e))
+			},
+		},
+		{
+			name: "cat_blob",
+			run: func(t *testing.T, e *cmdtest.Env) cmdtest.Result {
+				hashRoot(t, e)
+				blob := &object.Blob{Content: []byte("package main\n")}
+				return e.MustRun("cat-blob", blob.Hash().String())
+			},
+		},
+		{
+			name: "compare",
+			run: func(_ *testing.T, e *cmdtest.Env) cmdtest.Result {
+				e.WriteFile("v1/main.go", "package main\n")
+				e.WriteFile("v1/util.go", "package main\n")
+				e.WriteFile("v2/main.go", "package main\n\nfunc main() {}\n")
+				e.WriteFile("v2/docs/guide.md", "guide\n")
+				return e.MustRun("compare", e.Path("v1"), e.Path("v2"))
+			},
+		},
+		{
+			name: "hash_blob",
+			run: func(_ *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("hash-blob", e.Path("src/main.go"))
+			},
+		},
+		{
+			name: "hash_blob_json",
+			run: func(_ *testing.T, e *cmdtest.Env) cmdtest.Result {
+				return e.MustRun("hash-blob", "--output", "json", e.Path("src/main.go"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			res := tt.run(t, newEnv(t))
+			cmdtest.Golden(t, tt.name, res.Stdout)
+		})
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	root := hashRoot(t, e)
+
+	res := e.Run("cat-tree", strings.Repeat("0", 64))
+	if res.Err == nil {
+		t.Error("cat-tree of a missing tree: error = nil")
+	}
+
+	res = e.Run("validate", root)
+	if res.Err != nil {
+		t.Errorf("validate error = %v", res.Err)
+	}
+
+	zero := strings.Repeat("0", 64)
+	e.MustRun("refs", "set", "--expect", zero, "baseline", root)
+	res = e.Run("refs", "set", "--expect", zero, "baseline", root)
+	if !errors.Is(res.Err, smerkle.ErrRefConflict) {
+		t.Errorf("refs set --expect of a moved ref error = %v, want ErrRefConflict", res.Err)
+	}
+
+	var exitErr *exitError
+	p := writeProof(t, e, root, "README.md")
+	res = e.Run("verify-proof", "--root", strings.Repeat("1", 64), p)
+	if !errors.As(res.Err, &exitErr) || exitErr.code != verifyProofExitInvalid {
+		t.Errorf("verify-proof against another root error = %v, want exit %d", res.Err, verifyProofExitInvalid)
+	}
+
+	e.WriteFile("README.md", "# edit\n")
+	res = e.Run("spot-check", "--base", root, "--sample", "100%", e.Dir)
+	if !errors.As(res.Err, &exitErr) || exitErr.code != spotCheckExitProblems {
+		t.Errorf("spot-check of a modified file error = %v, want exit %d", res.Err, spotCheckExitProblems)
+	}
+
+	res = e.Run("diff", "--relative", root, root)
+	if res.Err == nil {
+		t.Error("diff --relative of two stored trees: error = nil")
+	}
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		want int // 0 for no error
+	}{
+		{name: "diff unchanged", args: []string{"diff", "--exit-code", root, root}},
+		{name: "diff changed", args: []string{"diff", "--exit-code", strings.Repeat("0", 64), root}, want: diffExitChanges},
+		{name: "diff error", args: []string{"diff", "--exit-code", root, "missing-ref"}, want: diffExitError},
+		{name: "diff bad flag", args: []string{"diff", "--exit-code", "--bogus", root, root}, want: diffExitError},
+		{name: "diff bad flag value", args: []string{"diff", "--exit-code", "--max-changes", "many", root, root}, want: diffExitError},
+		{name: "diff missing argument", args: []string{"diff", "--exit-code", root}, want: diffExitError},
+		{name: "status changed", args: []string{"status", "--exit-code", "--base", root, e.Dir}, want: diffExitChanges},
+		{name: "status changed as jsonl", args: []string{"status", "--exit-code", "--output", "jsonl", "--base", root, e.Dir}, want: diffExitChanges},
+		{name: "status error", args: []string{"status", "--exit-code", "--base", "missing-ref", e.Dir}, want: diffExitError},
+		{name: "status extra argument", args: []string{"status", "--exit-code", e.Dir, e.Dir}, want: diffExitError},
+	} {
+		res = e.Run(tt.args...)
+		switch {
+		case tt.want == 0 && res.Err != nil:
+			t.Errorf("%s: error = %v, want none", tt.name, res.Err)
+		case tt.want != 0 && (!errors.As(res.Err, &exitErr) || exitErr.code != tt.want):
+			t.Errorf("%s: error = %v, want exit %d", tt.name, res.Err, tt.want)
+		}
+	}
+	if res := e.Run("diff", root, "missing-ref"); errors.As(res.Err, &exitErr) {
+		t.Errorf("diff of a missing ref without --exit-code error = %v, want a plain error", res.Err)
+	}
+	if res := e.Run("diff", "--bogus", root, root); res.Err == nil || errors.As(res.Err, &exitErr) {
+		t.Errorf("diff with a bad flag without --exit-code error = %v, want a plain error", res.Err)
+	}
+
+	res = e.Run("compare", "--relative", e.Path("src"), e.Path("src/util"))
+	if res.Err == nil {
+		t.Error("compare --relative: error = nil")
+	}
+
+	res = e.Run("diff", "--output", "yaml", root, root)
+	if res.Err == nil || errors.As(res.Err, &exitErr) {
+		t.Errorf("diff --output yaml error = %v, want a plain error", res.Err)
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	t.Parallel()
+
+	root := filepath.FromSlash("/work/repo")
+	tests := []struct {
+		name string
+		cwd  string
+		path string
+		want string
+	}{
+		{name: "at the root", cwd: "/work/repo", path: "src/main.go", want: "src/main.go"},
+		{name: "in a subdirectory", cwd: "/work/repo/src", path: "src/main.go", want: "main.go"},
+		{name: "in a sibling", cwd: "/work/repo/docs", path: "src/main.go", want: "../src/main.go"},
+		{name: "above the root", cwd: "/work", path: "src/main.go", want: "repo/src/main.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := &relativePaths{root: root, cwd: filepath.FromSlash(tt.cwd)}
+			if got := r.path(tt.path); got != tt.want {
+				t.Errorf("path(%q) from %s = %q, want %q", tt.path, tt.cwd, got, tt.want)
+			}
+		})
+	}
+
+	res := &smerkle.DiffResult{Changes: []smerkle.Change{{Type: smerkle.ChangeCopied, Path: "src/b.go", Source: "src/a.go"}}}
+	(&relativePaths{root: root, cwd: filepath.FromSlash("/work/repo/src")}).changes(res)
+	if c := res.Changes[0]; c.Path != "b.go" || c.Source != "a.go" {
+		t.Errorf("changes() = %s -> %s, want a.go -> b.go", c.Source, c.Path)
+	}
+}
+
+func TestCatTreePath(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	root := hashRoot(t, e)
+	util := e.MustRun("cat-tree", root+":src/util").Stdout
+
+	if got := e.MustRun("cat-tree", root+":src/util/util.go").Stdout; got != util {
+		t.Errorf("cat-tree of a file = %q, want its entry %q", got, util)
+	}
+	if res := e.Run("cat-tree", root+":src/missing.go"); !errors.Is(res.Err, smerkle.ErrPathNotFound) {
+		t.Errorf("cat-tree of a missing path error = %v, want ErrPathNotFound", res.Err)
+	}
+
+	// any command taking a tree accepts a path, here a ref's
+	e.MustRun("refs", "set", "baseline", root)
+	if got := e.MustRun("ls-files", "baseline:src").Stdout; got != "main.go\nutil/util.go\n" {
+		t.Errorf("ls-files baseline:src = %q", got)
+	}
+}
+
+func TestHashJSONL(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	lines := strings.Split(strings.TrimSuffix(e.MustRun("hash", "--output", "jsonl", e.Dir).Stdout, "\n"), "\n")
+
+	var paths []string
+	for i, line := range lines {
+		var rec struct {
+			Record string `json:"record"`
+			Path   string `json:"path"`
+			Hash   string `json:"hash"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		// entries stream during the walk, and the result comes last
+		want := "entry"
+		if i == len(lines)-1 {
+			want = "result"
+		}
+		if rec.Record != want {
+			t.Errorf("line %d record = %q, want %q", i, rec.Record, want)
+		}
+		if rec.Record == "entry" {
+			paths = append(paths, rec.Path)
+		}
+	}
+	slices.Sort(paths)
+	if want := []string{"README.md", "src", "src/main.go", "src/util", "src/util/util.go"}; !slices.Equal(paths, want) {
+		t.Errorf("entry paths = %v, want %v", paths, want)
+	}
+}
+
+func TestHashBlob(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	empty := (&object.Blob{}).Hash().String() + "\n"
+	if got := e.MustRun("hash-blob", "--stdin").Stdout; got != empty {
+		t.Errorf("hash-blob --stdin of empty input = %q, want %q", got, empty)
+	}
+	if res := e.Run("hash-blob", e.Path("src")); !errors.Is(res.Err, smerkle.ErrNotFile) {
+		t.Errorf("hash-blob of a directory error = %v, want ErrNotFile", res.Err)
+	}
+	if res := e.Run("hash-blob", "--stdin", e.Path("README.md")); res.Err == nil {
+		t.Error("hash-blob with --stdin and a file succeeded")
+	}
+}
+
+func TestNullTerminated(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	old := hashRoot(t, e)
+	e.WriteFile("src/main.go", "package main\n\nfunc main() {}\n")
+	e.WriteFile("odd\nname.txt", "odd\n")
+	e.Remove("src/util/util.go")
+	root := hashRoot(t, e)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "diff",
+			args: []string{"diff", "-z", old, root},
+			want: "A\x00odd\nname.txt\x00M\x00src/main.go\x00D\x00src/util/util.go\x00",
+		},
+		{
+			name: "status",
+			args: []string{"status", "-z", "--base", old, e.Dir},
+			want: "A\x00odd\nname.txt\x00M\x00src/main.go\x00D\x00src/util/util.go\x00",
+		},
+		{
+			name: "files from",
+			args: []string{"diff", "-z", "--files-from-format", "tar", old, root},
+			want: "./odd\nname.txt\x00./src/main.go\x00",
+		},
+	}
+	for _, tt := range tests {
+		if got := e.MustRun(tt.args...).Stdout; got != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if res := e.Run("diff", "--files-from-format", "rsync", old, root); res.Err == nil {
+		t.Error("diff --files-from-format of a path holding a newline without -z: error = nil")
+	}
+	if res := e.Run("diff", "-z", "--output", "json", old, root); res.Err == nil {
+		t.Error("diff -z --output json: error = nil")
+	}
+}
+
+func TestWriteFileList(t *testing.T) {
+	t.Parallel()
+
+	file := &object.Entry{Mode: object.ModeRegular}
+	dir := &object.Entry{Mode: object.ModeDirectory}
+	changes := []smerkle.Change{
+		{Type: smerkle.ChangeAdded, Path: "-rf", NewEntry: file},
+		{Type: smerkle.ChangeAdded, Path: "docs", NewEntry: dir},
+		{Type: smerkle.ChangeAdded, Path: "docs/guide.md", NewEntry: file},
+		{Type: smerkle.ChangeDeleted, Path: "old.txt", OldEntry: file},
+		{Type: smerkle.ChangeModified, Path: "src/main.go", OldEntry: file, NewEntry: file},
+	}
+	odd := append(slices.Clone(changes), smerkle.Change{Type: smerkle.ChangeAdded, Path: "odd\nname", NewEntry: file})
+
+	tests := []struct {
+		name       string
+		format     string
+		nullTerm   bool
+		res        *smerkle.DiffResult
+		want       string
+		wantStderr string
+		wantErr    bool
+	}{
+		{
+			name:       "rsync",
+			format:     filesFromRsync,
+			res:        &smerkle.DiffResult{Changes: changes},
+			want:       "-rf\ndocs/guide.md\nsrc/main.go\n",
+			wantStderr: "warning: 1 deleted paths not listed\n",
+		},
+		{
+			// so GNU tar never reads "-rf" as options
+			name:       "tar",
+			format:     filesFromTar,
+			res:        &smerkle.DiffResult{Changes: changes},
+			want:       "./-rf\n./docs/guide.md\n./src/main.go\n",
+			wantStderr: "warning: 1 deleted paths not listed\n",
+		},
+		{
+			name:    "newline",
+			format:  filesFromRsync,
+			res:     &smerkle.DiffResult{Changes: odd},
+			wantErr: true,
+		},
+		{
+			name:       "newline with -z",
+			format:     filesFromRsync,
+			nullTerm:   true,
+			res:        &smerkle.DiffResult{Changes: odd},
+			want:       "-rf\x00docs/guide.md\x00src/main.go\x00odd\nname\x00",
+			wantStderr: "warning: 1 deleted paths not listed\n",
+		},
+		{
+			name:       "truncated",
+			format:     filesFromRsync,
+			res:        &smerkle.DiffResult{Changes: changes[2:3], Truncated: true},
+			want:       "docs/guide.md\n",
+			wantStderr: "warning: list truncated after 1 changes\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+			err := writeFileList(&stdout, &stderr, tt.format, tt.nullTerm, tt.res)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "newline") {
+					t.Errorf("writeFileList() error = %v, want a newline error", err)
+				}
+				if stdout.Len() > 0 {
+					t.Errorf("stdout = %q, want nothing written on error", stdout.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeFileList() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+			if got := stderr.String(); got != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", got, tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestMatchGlobs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		globs []string
+		path  string
+		want  bool
+	}{
+		{globs: nil, path: "src/main.go", want: true},
+		{globs: []string{"*.go"}, path: "src/main.go", want: true},
+		{globs: []string{"*.go"}, path: "README.md", want: false},
+		{globs: []string{"src/*.go"}, path: "src/main.go", want: true},
+		{globs: []string{"src/*.go"}, path: "src/util/util.go", want: false},
+		{globs: []string{"*.md", "src/*/*"}, path: "src/util/util.go", want: true},
+	}
+	for _, tt := range tests {
+		if got := matchGlobs(tt.globs, tt.path); got != tt.want {
+			t.Errorf("matchGlobs(%q, %q) = %v, want %v", tt.globs, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHashPruneCache(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	hashRoot(t, e)
+	e.Remove("src/util/util.go")
+
+	if res := e.MustRun("hash", e.Dir); strings.Contains(res.Stderr, "pruned") {
+		t.Errorf("hash without --prune-cache pruned: %q", res.Stderr)
+	}
+	if res := e.MustRun("hash", "--prune-cache", e.Dir); res.Stderr != "pruned 1 stale cache entries\n" {
+		t.Errorf("hash --prune-cache stderr = %q, want one pruned entry", res.Stderr)
+	}
+	if res := e.MustRun("hash", "--prune-cache", e.Dir); res.Stderr != "" {
+		t.Errorf("second hash --prune-cache stderr = %q, want nothing pruned", res.Stderr)
+	}
+}
+
+func TestStatusExclude(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	e.WriteFile("build/out.bin", "old\n")
+	base := hashRoot(t, e)
+	e.WriteFile("build/out.bin", "new\n")
+	e.WriteFile("debug.log", "log\n")
+	e.WriteFile("src/main.go", "package main\n\nfunc main() {}\n")
+
+	got := e.MustRun("status", "--base", base, "--exclude", "build/", "--exclude", "*.log", e.Dir).Stdout
+	if want := "M\tsrc/main.go\n"; got != want {
+		t.Errorf("status --exclude = %q, want %q", got, want)
+	}
+
+	// a base hashed before build/ was ignored doesn't report it deleted
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	if err := os.WriteFile(ignoreFile, []byte("build/\n*.log\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got = e.MustRun("--ignore-file", ignoreFile, "status", "--base", base, e.Dir).Stdout
+	if want := "M\tsrc/main.go\n"; got != want {
+		t.Errorf("status --ignore-file = %q, want %q", got, want)
+	}
+}
+
+func TestIgnoreMismatchWarning(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	if err := os.WriteFile(ignoreFile, []byte("*.log\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	plain := hashRoot(t, e)
+	e.WriteFile("src/main.go", "package main\n\nfunc main() {}\n")
+	ignored := strings.TrimSpace(e.MustRun("--ignore-file", ignoreFile, "hash", e.Dir).Stdout)
+	e.WriteFile("README.md", "# demo, again\n")
+	ignoredAgain := strings.TrimSpace(e.MustRun("--ignore-file", ignoreFile, "hash", e.Dir).Stdout)
+
+	// status locks the store exclusively, so the cases run one at a time
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		wantWarn bool
+	}{
+		{name: "diff with different rules", args: []string{"diff", plain, ignored}, wantWarn: true},
+		{name: "diff with the same rules", args: []string{"diff", ignored, ignoredAgain}},
+		{name: "status with different rules", args: []string{"--ignore-file", ignoreFile, "status", "--base", plain, e.Dir}, wantWarn: true},
+		{name: "status with the same rules", args: []string{"--ignore-file", ignoreFile, "status", "--base", ignored, e.Dir}},
+	} {
+		res := e.Run(tt.args...)
+		if res.Err != nil {
+			t.Errorf("%s: error = %v", tt.name, res.Err)
+			continue
+		}
+		if got := strings.Contains(res.Stderr, "hashed with different ignore rules"); got != tt.wantWarn {
+			t.Errorf("%s: stderr = %q, want warning %v", tt.name, res.Stderr, tt.wantWarn)
+		}
+	}
+}
+
+func TestStatusBaseline(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	if res := e.Run("status", e.Dir); res.Err == nil || !strings.Contains(res.Err.Error(), "no baseline") {
+		t.Errorf("status without a baseline: error = %v, want no baseline", res.Err)
+	}
+	root := strings.TrimSpace(e.MustRun("hash", "--update-baseline", e.Dir).Stdout)
+
+	e.WriteFile("src/main.go", "package main\n\nfunc main() {}\n")
+	if got, want := e.MustRun("status", e.Dir).Stdout, "M\tsrc/main.go\n"; got != want {
+		t.Errorf("status against the baseline = %q, want %q", got, want)
+	}
+
+	// a plain hash leaves the baseline alone; --update-baseline moves it
+	e.MustRun("hash", e.Dir)
+	if got := e.MustRun("status", e.Dir).Stdout; got == "" {
+		t.Error("status after a plain hash = nothing, want the change")
+	}
+	e.MustRun("hash", "--update-baseline", e.Dir)
+	if got := e.MustRun("status", e.Dir).Stdout; got != "" {
+		t.Errorf("status after --update-baseline = %q, want nothing", got)
+	}
+
+	// baselines extend the snapshot history on HEAD
+	log := e.MustRun("log", "--output", "json").Stdout
+	if n := strings.Count(log, `"snapshot"`); n != 2 || !strings.Contains(log, root) {
+		t.Errorf("log = %s, want two snapshots, the first of %s", log, root)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		edit    func(e *cmdtest.Env)
+		allow   []string
+		want    string // the changes printed
+		wantErr bool
+	}{
+		{
+			name: "nothing changed",
+			edit: func(*cmdtest.Env) {},
+		},
+		{
+			name:  "every change allowed",
+			edit:  modify,
+			allow: []string{"src/**", "docs/"},
+		},
+		{
+			name:    "changes outside the allowed paths",
+			edit:    modify,
+			allow:   []string{"docs/"},
+			want:    "M\tsrc/main.go\nD\tsrc/util/util.go\n",
+			wantErr: true,
+		},
+		{
+			// src and src/util are modified too, but only their contents count
+			name:  "modified directories judged by their contents",
+			edit:  func(e *cmdtest.Env) { e.WriteFile("src/util/util.go", "package util // edit\n") },
+			allow: []string{"src/util/util.go"},
+		},
+		{
+			name:    "delete outside the allowed paths",
+			edit:    func(e *cmdtest.Env) { e.Remove("README.md") },
+			allow:   []string{"docs/"},
+			want:    "D\tREADME.md\n",
+			wantErr: true,
+		},
+		{
+			name:  "allowed delete",
+			edit:  func(e *cmdtest.Env) { e.Remove("README.md") },
+			allow: []string{"*.md"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			e := newEnv(t)
+			base := hashRoot(t, e)
+			tt.edit(e)
+
+			args := []string{"guard", "--base", base}
+			for _, a := range tt.allow {
+				args = append(args, "--allow", a)
+			}
+			res := e.Run(append(args, e.Dir)...)
+			if got := res.Stdout; got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+			// a plain error, which main turns into exit status 1
+			var exitErr *exitError
+			switch {
+			case tt.wantErr && (res.Err == nil || errors.As(res.Err, &exitErr) ||
+				!strings.Contains(res.Err.Error(), "outside the allowed paths")):
+				t.Errorf("error = %v, want changes outside the allowed paths", res.Err)
+			case !tt.wantErr && res.Err != nil:
+				t.Errorf("error = %v, want none", res.Err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	state := filepath.Join(t.TempDir(), "state.json")
+	check := func(args ...string) (checkJSON, error) {
+		t.Helper()
+		res := e.Run(append([]string{"check", "--state", state, "--output", "json"}, args...)...)
+		var out checkJSON
+		if res.Stdout != "" {
+			if err := json.Unmarshal([]byte(res.Stdout), &out); err != nil {
+				t.Fatalf("check json: err = %v", err)
+			}
+		}
+		return out, res.Err
+	}
+	readState := func() ([]byte, os.FileInfo) {
+		t.Helper()
+		data, err := os.ReadFile(state)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		info, err := os.Stat(state)
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		return data, info
+	}
+
+	var exitErr *exitError
+	out, err := check(e.Dir)
+	if !errors.As(err, &exitErr) || exitErr.code != checkExitFirstRun || out.Transition != transitionFirstRun {
+		t.Fatalf("first check = %+v, error = %v, want exit %d", out, err, checkExitFirstRun)
+	}
+	first := out.Hash
+	data, firstInfo := readState()
+	var st checkState
+	if err := json.Unmarshal(data, &st); err != nil || st.Hash != first || st.Path != e.Dir {
+		t.Errorf("state = %s, error = %v, want %s at %s", data, err, first, e.Dir)
+	}
+
+	if out, err := check(e.Dir); err != nil || out.Transition != transitionUnchanged {
+		t.Errorf("second check = %+v, error = %v, want unchanged", out, err)
+	}
+	if again, _ := readState(); !bytes.Equal(again, data) {
+		t.Errorf("state after an unchanged check = %s, want %s", again, data)
+	}
+
+	// a walk missing paths fails without touching the state
+	modify(e)
+	if err := os.Symlink("nowhere", e.Path("dangling")); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+	for _, args := range [][]string{
+		{"--symlinks", "follow", e.Dir},
+		{"--max-files", "1", e.Dir},
+	} {
+		if _, err := check(args...); err == nil || errors.As(err, &exitErr) {
+			t.Errorf("check %v error = %v, want a plain error", args, err)
+		}
+		if again, _ := readState(); !bytes.Equal(again, data) {
+			t.Errorf("state after check %v = %s, want %s", args, again, data)
+		}
+	}
+
+	out, err = check(e.Dir)
+	if !errors.As(err, &exitErr) || exitErr.code != checkExitChanged || out.Previous != first || out.Hash == first {
+		t.Fatalf("check after a change = %+v, error = %v, want exit %d from %s", out, err, checkExitChanged, first)
+	}
+	// the state is replaced by a rename, leaving no temporary file behind
+	data, info := readState()
+	if os.SameFile(firstInfo, info) {
+		t.Error("state file rewritten in place, want it replaced")
+	}
+	if err := json.Unmarshal(data, &st); err != nil || st.Hash != out.Hash {
+		t.Errorf("state = %s, error = %v, want %s", data, err, out.Hash)
+	}
+	if entries, err := os.ReadDir(filepath.Dir(state)); err != nil || len(entries) != 1 {
+		t.Errorf("state directory holds %v, error = %v, want only the state file", entries, err)
+	}
+}
+
+func TestWhatif(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	base := hashRoot(t, e)
+	patch := filepath.Join(t.TempDir(), "patch.json")
+	// the same changes as modify, which the worktree doesn't have yet
+	err := os.WriteFile(patch, []byte(`{"changes": [
+		{"path": "src/main.go", "content": "package main\n\nfunc main() {}\n"},
+		{"path": "docs/guide.md", "content_base64": "Z3VpZGUK"},
+		{"path": "src/util/util.go", "delete": true}
+	]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := e.MustRun("whatif", "--base", base, "--patch", patch).Stdout
+	var js whatifJSON
+	if err := json.Unmarshal([]byte(e.MustRun("whatif", "--base", base, "--patch", patch, "--output", "json").Stdout), &js); err != nil {
+		t.Fatalf("whatif json: err = %v", err)
+	}
+	list := e.MustRun("whatif", "--base", base, "--patch", patch, "--files-from-format", "rsync")
+	// a preview leaves nothing in the store
+	if res := e.Run("cat-tree", js.Root); res.Err == nil {
+		t.Errorf("cat-tree of the whatif root before hashing it: error = nil, output %q", res.Stdout)
+	}
+
+	modify(e)
+	root := hashRoot(t, e)
+	if want := "root " + root + "\n" + e.MustRun("diff", base, root).Stdout; text != want {
+		t.Errorf("whatif = %q, want %q", text, want)
+	}
+	if js.Root != root || len(js.Changes) != 4 {
+		t.Errorf("whatif json = %+v, want root %s and 4 changes", js, root)
+	}
+	if want := "docs/guide.md\nsrc/main.go\n"; list.Stdout != want || !strings.HasPrefix(list.Stderr, "root "+root+"\n") {
+		t.Errorf("whatif --files-from-format = %q, stderr %q, want %q and the root on stderr", list.Stdout, list.Stderr, want)
+	}
+
+	if res := e.Run("whatif", "--base", base, "--patch", patch, e.Dir); res.Err == nil {
+		t.Error("whatif with a directory: error = nil")
+	}
+	if res := e.Run("whatif", "--base", base, "--patch", patch, "--relative"); res.Err == nil {
+		t.Error("whatif --relative: error = nil")
+	}
+}
+
+func TestReadPatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		patch   string
+		wantErr string // "" for none
+	}{
+		{name: "empty", patch: `{"changes": []}`},
+		{name: "write and delete", patch: `{"changes": [{"path": "a", "content": "x", "mode": "executable"}, {"path": "b/", "delete": true}]}`},
+		{name: "not json", patch: `changes`, wantErr: "parse patch"},
+		{name: "unknown field", patch: `{"changes": [{"path": "a", "content": "x", "owner": "root"}]}`, wantErr: "unknown field"},
+		{name: "no path", patch: `{"changes": [{"content": "x"}]}`, wantErr: "outside the root"},
+		{name: "the root", patch: `{"changes": [{"path": ".", "delete": true}]}`, wantErr: "outside the root"},
+		{name: "escaping path", patch: `{"changes": [{"path": "a/../../b", "content": "x"}]}`, wantErr: "outside the root"},
+		{name: "absolute path", patch: `{"changes": [{"path": "/etc/passwd", "content": "x"}]}`, wantErr: "outside the root"},
+		{name: "no content", patch: `{"changes": [{"path": "a"}]}`, wantErr: "content, content_base64, or delete required"},
+		{name: "both contents", patch: `{"changes": [{"path": "a", "content": "x", "content_base64": "eA=="}]}`, wantErr: "both content"},
+		{name: "bad base64", patch: `{"changes": [{"path": "a", "content_base64": "!"}]}`, wantErr: "decode content_base64"},
+		{name: "delete with content", patch: `{"changes": [{"path": "a", "content": "x", "delete": true}]}`, wantErr: "delete takes no content"},
+		{name: "unknown mode", patch: `{"changes": [{"path": "a", "content": "x", "mode": "fifo"}]}`, wantErr: "unknown mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := readPatch(strings.NewReader(tt.patch), "-")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("readPatch() error = %v, want none", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("readPatch() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChurnRange(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	first := hashRoot(t, e)
+	e.WriteFile("src/main.go", "package main // two\n")
+	second := hashRoot(t, e)
+	e.MustRun("hash", e.Path("src")) // another path, left out of the series
+	e.WriteFile("src/main.go", "package main // three\n")
+	third := hashRoot(t, e)
+
+	var got churnJSON
+	if err := json.Unmarshal([]byte(e.MustRun("churn", "--output", "json", first+".."+third).Stdout), &got); err != nil {
+		t.Fatalf("churn json: err = %v", err)
+	}
+	if want := []string{first, second, third}; !slices.Equal(got.Roots, want) {
+		t.Errorf("roots = %v, want %v", got.Roots, want)
+	}
+	if got.Changes != 2 {
+		t.Errorf("changes = %d, want 2", got.Changes)
+	}
+
+	if res := e.Run("churn", third+".."+first); res.Err == nil || !strings.Contains(res.Err.Error(), "hashed before") {
+		t.Errorf("churn of a reversed range: error = %v, want hashed before", res.Err)
+	}
+
+	// a revert hashes second again; the range runs from its latest hashing
+	e.WriteFile("src/main.go", "package main // two\n")
+	if again := hashRoot(t, e); again != second {
+		t.Fatalf("reverted root = %s, want %s", again, second)
+	}
+	if err := json.Unmarshal([]byte(e.MustRun("churn", "--output", "json", third+".."+second).Stdout), &got); err != nil {
+		t.Fatalf("churn json: err = %v", err)
+	}
+	if want := []string{third, second}; !slices.Equal(got.Roots, want) {
+		t.Errorf("roots after a revert = %v, want %v", got.Roots, want)
+	}
+	if err := json.Unmarshal([]byte(e.MustRun("churn", "--output", "json", first+".."+second).Stdout), &got); err != nil {
+		t.Fatalf("churn json: err = %v", err)
+	}
+	if want := []string{first, second, third, second}; !slices.Equal(got.Roots, want) {
+		t.Errorf("roots across a revert = %v, want %v", got.Roots, want)
+	}
+}
+
+func TestGlobalIgnoreFiles(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	e.MustRun("hash", e.Dir) // creates the store
+	userIgnore := filepath.Join(t.TempDir(), "ignore")
+	if err := os.WriteFile(userIgnore, []byte(".DS_Store\n*.log\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(smerkle.StoreIgnoreFile(e.Store), []byte("vendor/\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e.WriteFile(".smerkleignore", "!keep.log\n")
+	e.WriteFile(".DS_Store", "finder\n")
+	e.WriteFile("debug.log", "log\n")
+	e.WriteFile("keep.log", "log\n")
+	e.WriteFile("vendor/lib.go", "package lib\n")
+
+	root := strings.TrimSpace(e.MustRun("--user-ignore-file", userIgnore, "hash", e.Dir).Stdout)
+	got := e.MustRun("ls-files", root).Stdout
+	if want := "README.md\nkeep.log\nsrc/main.go\nsrc/util/util.go\n"; got != want {
+		t.Errorf("ls-files = %q, want %q", got, want)
+	}
+
+	// without the user-level file only the store's rules apply
+	root = strings.TrimSpace(e.MustRun("hash", e.Dir).Stdout)
+	got = e.MustRun("ls-files", "--glob", "*.log", "--glob", ".DS_Store", root).Stdout
+	if want := ".DS_Store\ndebug.log\nkeep.log\n"; got != want {
+		t.Errorf("ls-files without the user file = %q, want %q", got, want)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	tests := []struct {
+		name             string
+		args             []string
+		wantSymlinks     string
+		wantLines        []string
+		wantChunk        int64
+		wantInaccessible bool
+		wantFullMetadata bool
+		wantHashMtimes   bool
+	}{
+		{
+			name:         "defaults",
+			wantSymlinks: "record",
+			wantLines: []string{
+				"symlinks hashed by target path, never followed",
+				"paths denied by permissions left out",
+				"other permission bits, owner, group, and extended attributes excluded from tree hashes",
+				"modification times excluded from tree hashes",
+			},
+		},
+		{
+			name:         "symlinks follow",
+			args:         []string{"--symlinks", "follow", "--chunk-threshold", "1024"},
+			wantSymlinks: "follow",
+			wantLines:    []string{"symlinks followed, hashed as what they point to"},
+			wantChunk:    1024,
+		},
+		{
+			name:         "follow-symlinks",
+			args:         []string{"--follow-symlinks"},
+			wantSymlinks: "follow",
+			wantLines:    []string{"symlinks followed, hashed as what they point to"},
+		},
+		{
+			name:         "symlinks skip",
+			args:         []string{"--symlinks", "skip"},
+			wantSymlinks: "skip",
+			wantLines:    []string{"symlinks left out"},
+		},
+		{
+			name:             "record-inaccessible",
+			args:             []string{"--record-inaccessible"},
+			wantSymlinks:     "record",
+			wantLines:        []string{"paths denied by permissions recorded as inaccessible entries with a zero hash"},
+			wantInaccessible: true,
+		},
+		{
+			name:             "full-metadata",
+			args:             []string{"--full-metadata"},
+			wantSymlinks:     "record",
+			wantLines:        []string{"permission bits including setuid, setgid, and sticky, owner and group ids, and extended attributes recorded in every entry"},
+			wantFullMetadata: true,
+		},
+		{
+			name:           "hash-mtimes",
+			args:           []string{"--hash-mtimes"},
+			wantSymlinks:   "record",
+			wantLines:      []string{"modification times recorded in every entry"},
+			wantHashMtimes: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got envJSON
+			res := e.MustRun(append([]string{"env"}, append(tt.args, e.Dir)...)...)
+			if err := json.Unmarshal([]byte(res.Stdout), &got); err != nil {
+				t.Fatalf("env json: err = %v", err)
+			}
+			if got.Symlinks != tt.wantSymlinks {
+				t.Errorf("symlinks = %q, want %q", got.Symlinks, tt.wantSymlinks)
+			}
+			if got.ChunkThreshold != tt.wantChunk {
+				t.Errorf("chunk_threshold = %d, want %d", got.ChunkThreshold, tt.wantChunk)
+			}
+			if got.RecordInaccessible != tt.wantInaccessible {
+				t.Errorf("record_inaccessible = %v, want %v", got.RecordInaccessible, tt.wantInaccessible)
+			}
+			if got.FullMetadata != tt.wantFullMetadata {
+				t.Errorf("full_metadata = %v, want %v", got.FullMetadata, tt.wantFullMetadata)
+			}
+			if got.HashMtimes != tt.wantHashMtimes {
+				t.Errorf("hash_mtimes = %v, want %v", got.HashMtimes, tt.wantHashMtimes)
+			}
+			for _, line := range tt.wantLines {
+				if !slices.Contains(got.Normalization, line) {
+					t.Errorf("normalization = %q, want it to hold %q", got.Normalization, line)
+				}
+			}
+			if slices.Contains(got.Normalization, "symlinks hashed by target path, never followed") != (tt.wantSymlinks == "record") {
+				t.Errorf("normalization = %q, describes the record policy under %s", got.Normalization, tt.wantSymlinks)
+			}
+		})
+	}
+}
+
+func TestStoreSettings(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	e.MustRun("init", "--hash-algorithm", "blake3", "--set", "ignore-filename=.ignore")
+	if res := e.Run("init"); res.Err == nil {
+		t.Error("second init: error = nil")
+	}
+	e.WriteFile(".ignore", "*.log\n")
+	e.WriteFile("debug.log", "log\n")
+
+	// the store's ignore-filename stands in for the flag's default
+	root := hashRoot(t, e)
+	if got, want := e.MustRun("ls-files", root).Stdout, "README.md\nsrc/main.go\nsrc/util/util.go\n"; got != want {
+		t.Errorf("ls-files = %q, want %q", got, want)
+	}
+	if got := e.MustRun("config", "get", "hash-algorithm").Stdout; got != "blake3\n" {
+		t.Errorf("config get hash-algorithm = %q, want blake3", got)
+	}
+
+	e.MustRun("config", "set", "ignore-filename", "")
+	if got := e.MustRun("config").Stdout; got != "hash-algorithm\tblake3\n" {
+		t.Errorf("config after removing ignore-filename = %q", got)
+	}
+	for _, args := range [][]string{
+		{"config", "set", "hash-algorithm", "sha256"},
+		{"config", "set", "concurrency", "-1"},
+		{"config", "get", "colour"},
+	} {
+		if res := e.Run(args...); res.Err == nil {
+			t.Errorf("%s: error = nil", strings.Join(args, " "))
+		}
+	}
+}
+
+// runHere runs smerkle from dir without --store, as a user would.
+func runHere(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	t.Chdir(dir)
+	var stdout bytes.Buffer
+	cmd := newRootCmd()
+	cmd.SetArgs(append([]string{"--user-ignore-file", ""}, args...))
+	cmd.SetOut(&stdout)
+	cmd.SetErr(io.Discard)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("smerkle %s in %s: %v", strings.Join(args, " "), dir, err)
+	}
+	return stdout.String()
+}
+
+func TestStoreDiscovery(t *testing.T) { //nolint:paralleltest // changes directory and environment
+	e := newEnv(t)
+	e.Store = e.Path(defaultStoreDir)
+	e.WriteFile(".smerkleignore", defaultStoreDir+"/\n")
+	root := hashRoot(t, e)
+
+	// from a subdirectory, the store above is found and the whole tree walked
+	if got := runHere(t, e.Path("src/util"), "hash"); strings.TrimSpace(got) != root {
+		t.Errorf("hash from a subdirectory = %q, want %s", got, root)
+	}
+	if got := runHere(t, e.Path("src"), "ls-files", root); !strings.Contains(got, "README.md\n") {
+		t.Errorf("ls-files from a subdirectory = %q, want the stored tree", got)
+	}
+
+	// SMERKLE_DIR wins over discovery, and paths stay relative to here
+	envStore := filepath.Join(t.TempDir(), "store")
+	t.Setenv(storeDirEnv, envStore)
+	sub := strings.TrimSpace(runHere(t, e.Path("src"), "hash"))
+	if sub == root {
+		t.Errorf("hash with %s walked the discovered root", storeDirEnv)
+	}
+	if _, ok, err := smerkle.ReadStoreConfig(envStore); !ok || err != nil {
+		t.Errorf("store at %s: ok = %v, error = %v; want it created", storeDirEnv, ok, err)
+	}
+
+	// init makes its store here rather than reusing one above
+	t.Setenv(storeDirEnv, "")
+	runHere(t, e.Path("src"), "init")
+	if _, err := os.Stat(e.Path("src/" + defaultStoreDir)); err != nil {
+		t.Errorf("init in a subdirectory: %v", err)
+	}
+}
+
+func TestFindStore(t *testing.T) {
+	t.Parallel()
+
+	top := t.TempDir()
+	deep := filepath.Join(top, "a", "b")
+	if err := os.MkdirAll(filepath.Join(top, defaultStoreDir), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(deep, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := findStore(deep); err != nil || !ok || got != filepath.Join(top, defaultStoreDir) {
+		t.Errorf("findStore() = %q, %v, %v; want the store in %s", got, ok, err, top)
+	}
+
+	// a file of that name isn't a store
+	other := t.TempDir()
+	if err := os.WriteFile(filepath.Join(other, defaultStoreDir), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := findStore(other); err != nil || (ok && strings.HasPrefix(got, other)) {
+		t.Errorf("findStore() = %q, %v, %v; want no store in %s", got, ok, err, other)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	oldRoot := hashRoot(t, e)
+	modify(e)
+	newRoot := hashRoot(t, e)
+	bundle := filepath.Join(t.TempDir(), "update.bundle")
+	if res := e.MustRun("bundle", oldRoot, newRoot, "-o", bundle); !strings.HasPrefix(res.Stderr, "bundled ") {
+		t.Errorf("bundle stderr = %q, want a summary", res.Stderr)
+	}
+
+	// another machine holding only the old tree, checked out
+	other := cmdtest.New(t, newRootCmd)
+	other.MustRun("pull", e.Store, oldRoot)
+	work := other.Path("work")
+	other.MustRun("restore", oldRoot, work)
+
+	other.MustRun("apply-bundle", bundle, "--tag", "latest", "--worktree", work)
+	if got := strings.TrimSpace(other.MustRun("hash", work).Stdout); got != newRoot {
+		t.Errorf("worktree after apply-bundle hashes to %s, want %s", got, newRoot)
+	}
+	if got := other.MustRun("refs").Stdout; !strings.Contains(got, newRoot) {
+		t.Errorf("refs = %q, want latest at %s", got, newRoot)
+	}
+
+	// a store without the old tree can't take it
+	if res := cmdtest.New(t, newRootCmd).Run("apply-bundle", bundle); !errors.Is(res.Err, remote.ErrBundleBase) {
+		t.Errorf("apply-bundle without the base: error = %v, want ErrBundleBase", res.Err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	hashRoot(t, e)
+	hashRoot(t, e) // served from the cache
+
+	var got statsJSON
+	if err := json.Unmarshal([]byte(e.MustRun("stats", "--output", "json").Stdout), &got); err != nil {
+		t.Fatalf("stats json: err = %v", err)
+	}
+	if got.Types[smerkle.TypeBlob].Count == 0 || got.Types[smerkle.TypeTree].Count == 0 {
+		t.Errorf("types = %v, want blobs and trees", got.Types)
+	}
+	var bytes uint64
+	for _, typ := range got.Types {
+		bytes += typ.Bytes
+	}
+	if bytes != got.ObjectBytes {
+		t.Errorf("types add up to %d bytes, want object_bytes %d", bytes, got.ObjectBytes)
+	}
+	if len(got.Largest) == 0 || got.Shards.Sampled != 256 || got.Shards.Max == 0 {
+		t.Errorf("largest = %v, shards = %+v, want both filled in", got.Largest, got.Shards)
+	}
+	if got.Cache == nil || got.Cache.Hits == 0 || got.Cache.Misses != 0 {
+		t.Errorf("cache = %+v, want hits and no misses from the last walk", got.Cache)
+	}
+}
+
+func TestDamagedActivity(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	hashRoot(t, e)
+	if err := os.WriteFile(filepath.Join(e.Store, "activity"), []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	res := e.MustRun("hash", e.Dir)
+	if !strings.Contains(res.Stderr, "warning: directory activity reset") {
+		t.Errorf("stderr = %q, want a warning about the reset", res.Stderr)
+	}
+	if res := e.MustRun("hash", e.Dir); res.Stderr != "" {
+		t.Errorf("stderr after the rewrite = %q, want none", res.Stderr)
+	}
+}
+
+func TestGC(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	oldRoot := hashRoot(t, e)
+	modify(e)
+	newRoot := hashRoot(t, e)
+	e.MustRun("refs", "set", "latest", newRoot)
+
+	// the untagged old root goes unless pinned
+	var dry gcJSON
+	if err := json.Unmarshal([]byte(e.MustRun("gc", "--grace", "0", "--dry-run", "--output", "json").Stdout), &dry); err != nil {
+		t.Fatalf("gc json: err = %v", err)
+	}
+	if dry.Removed == 0 || !dry.DryRun {
+		t.Errorf("gc --dry-run = %+v, want objects to remove", dry)
+	}
+
+	e.MustRun("pin", oldRoot)
+	if got := strings.TrimSpace(e.MustRun("pin").Stdout); got != oldRoot {
+		t.Errorf("pin = %q, want %s", got, oldRoot)
+	}
+	e.MustRun("gc", "--grace", "0")
+	e.MustRun("cat-tree", oldRoot)
+
+	e.MustRun("unpin", oldRoot)
+	if got := e.MustRun("gc", "--grace", "0").Stdout; !strings.HasPrefix(got, "removed ") {
+		t.Errorf("gc = %q, want a summary", got)
+	}
+	if res := e.Run("cat-tree", oldRoot); res.Err == nil {
+		t.Error("cat-tree of the unpinned old root after gc: expected error, got nil")
+	}
+	e.MustRun("restore", "latest", e.Path("restored"))
+
+	// retention thins the history, set once in the store's config
+	for range 3 {
+		e.MustRun("snapshot", e.Dir)
+	}
+	e.MustRun("config", "set", "keep-last", "2")
+	if got := e.MustRun("gc", "--grace", "0").Stdout; !strings.HasPrefix(got, "cut 1 snapshots from history\n") {
+		t.Errorf("gc with keep-last set = %q, want 1 snapshot cut", got)
+	}
+	if n := strings.Count(e.MustRun("log", "--output", "json").Stdout, `"snapshot"`); n != 2 {
+		t.Errorf("log after gc lists %d snapshots, want 2", n)
+	}
+	if res := e.Run("config", "set", "keep-daily", "-1"); res.Err == nil {
+		t.Error("config set keep-daily -1: expected error, got nil")
+	}
+}
+
+func TestStoreLock(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	root := hashRoot(t, e)
+
+	// another process in the middle of a hash
+	s, err := smerkle.Open(e.Store, smerkle.WithLock(smerkle.LockExclusive))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	if res := e.Run("hash", e.Dir); !errors.Is(res.Err, smerkle.ErrStoreLocked) {
+		t.Errorf("hash error = %v, want ErrStoreLocked", res.Err)
+	}
+	if res := e.Run("cat-tree", root); !errors.Is(res.Err, smerkle.ErrStoreLocked) {
+		t.Errorf("cat-tree error = %v, want ErrStoreLocked", res.Err)
+	}
+	if res := e.MustRun("--no-lock", "hash", e.Dir); strings.TrimSpace(res.Stdout) != root {
+		t.Errorf("hash --no-lock = %q, want %s", res.Stdout, root)
+	}
+}
+
+func TestServeAPI(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	oldRoot := hashRoot(t, e)
+	modify(e)
+	newRoot := hashRoot(t, e)
+
+	s, err := smerkle.Open(e.Store, smerkle.WithLazyIndex())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	mux := http.NewServeMux()
+	(&apiHandler{s: s}).register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	do := func(method, path string, body []byte) (int, []byte) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(t.Context(), method, srv.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, path, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, data
+	}
+
+	status, data := do(http.MethodGet, "/api/v1/trees/"+oldRoot, nil)
+	var entries []report.EntryJSON
+	if err := json.Unmarshal(data, &entries); status != http.StatusOK || err != nil {
+		t.Fatalf("GET tree = %d %s, %v", status, data, err)
+	}
+	if len(entries) != 2 || entries[0].Name != "README.md" || entries[1].Name != "src" {
+		t.Errorf("GET tree entries = %+v, want README.md and src", entries)
+	}
+
+	h, err := smerkle.ParseHash(oldRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := s.GetObject(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, data := do(http.MethodGet, "/api/v1/objects/"+oldRoot, nil); status != http.StatusOK || !bytes.Equal(data, want) {
+		t.Errorf("GET object = %d, %d bytes; want 200, %d bytes", status, len(data), len(want))
+	}
+
+	status, data = do(http.MethodPost, "/api/v1/diff", []byte(`{"old":"`+oldRoot+`","new":"`+newRoot+`"}`))
+	var diff report.DiffJSON
+	if err := json.Unmarshal(data, &diff); status != http.StatusOK || err != nil {
+		t.Fatalf("POST diff = %d %s, %v", status, data, err)
+	}
+	paths := make([]string, 0, len(diff.Changes))
+	for _, c := range diff.Changes {
+		paths = append(paths, c.Type+" "+c.Path)
+	}
+	if got := strings.Join(paths, ", "); !strings.Contains(got, "added docs/guide.md") || !strings.Contains(got, "modified src/main.go") {
+		t.Errorf("POST diff changes = %s", got)
+	}
+
+	// a proof served for a published root checks out with no store
+	status, data = do(http.MethodGet, "/api/v1/prove?root="+newRoot+"&path=src/main.go", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET prove = %d %s", status, data)
+	}
+	pr, err := readProof(bytes.NewReader(data), "-")
+	if err != nil {
+		t.Fatalf("readProof() error = %v", err)
+	}
+	if entry, err := pr.Verify(); err != nil || pr.Root.String() != newRoot || entry.Name != "main.go" {
+		t.Errorf("served proof Verify() = %+v, %v for root %s, want main.go in %s", entry, err, pr.Root, newRoot)
+	}
+
+	content := []byte("uploaded\n")
+	blob, err := object.EncodeBlob(&object.Blob{Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobHash := s.Algorithm().Sum(content).String()
+	other := s.Algorithm().Sum([]byte("other")).String()
+	orphan, err := object.EncodeTree(&object.Tree{Entries: []object.Entry{
+		{Name: "gone", Mode: object.ModeRegular, Size: 5, Hash: s.Algorithm().Sum([]byte("gone\n"))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphanHash := s.Algorithm().Sum(orphan).String()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		want   int
+	}{
+		{name: "put", method: http.MethodPut, path: "/api/v1/objects/" + blobHash, body: blob, want: http.StatusCreated},
+		{name: "put again", method: http.MethodPut, path: "/api/v1/objects/" + blobHash, body: blob, want: http.StatusNoContent},
+		{name: "put under the wrong hash", method: http.MethodPut, path: "/api/v1/objects/" + other, body: blob, want: http.StatusBadRequest},
+		{name: "put a tree without its blob", method: http.MethodPut, path: "/api/v1/objects/" + orphanHash, body: orphan, want: http.StatusBadRequest},
+		{name: "put too large", method: http.MethodPut, path: "/api/v1/objects/" + other, body: make([]byte, remote.MaxObjectSize+1), want: http.StatusRequestEntityTooLarge},
+		{name: "get missing object", method: http.MethodGet, path: "/api/v1/objects/" + other, want: http.StatusNotFound},
+		{name: "get bad hash", method: http.MethodGet, path: "/api/v1/objects/nope", want: http.StatusBadRequest},
+		{name: "get blob as tree", method: http.MethodGet, path: "/api/v1/trees/" + blobHash, want: http.StatusBadRequest},
+		{name: "get missing ref", method: http.MethodGet, path: "/api/v1/trees/nope", want: http.StatusNotFound},
+		{name: "prove missing path", method: http.MethodGet, path: "/api/v1/prove?root=" + oldRoot + "&path=docs/guide.md", want: http.StatusNotFound},
+		{name: "prove bad path", method: http.MethodGet, path: "/api/v1/prove?root=" + oldRoot + "&path=../x", want: http.StatusBadRequest},
+		{name: "prove without path", method: http.MethodGet, path: "/api/v1/prove?root=" + oldRoot, want: http.StatusBadRequest},
+		{name: "diff without new", method: http.MethodPost, path: "/api/v1/diff", body: []byte(`{"old":"` + oldRoot + `"}`), want: http.StatusBadRequest},
+	}
+	// sequential: later requests depend on the put
+	for _, tt := range tests {
+		if status, data := do(tt.method, tt.path, tt.body); status != tt.want {
+			t.Errorf("%s: status = %d %s, want %d", tt.name, status, data, tt.want)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		spec    string
+		want    schedule
+		wantErr bool
+	}{
+		{spec: "etc:1h=/etc", want: schedule{ref: "etc", every: time.Hour, path: "/etc"}},
+		{spec: "nightly/home:24h:7=/srv/a=b:c", want: schedule{ref: "nightly/home", every: 24 * time.Hour, keep: 7, path: "/srv/a=b:c"}},
+		{spec: "etc:1h", wantErr: true},
+		{spec: "etc=/etc", wantErr: true},
+		{spec: "etc:1h:2:3=/etc", wantErr: true},
+		{spec: "etc:0s=/etc", wantErr: true},
+		{spec: "etc:1h:-1=/etc", wantErr: true},
+		{spec: ".etc:1h=/etc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseSchedule(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSchedule() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduledSnapshot(t *testing.T) {
+	t.Parallel()
+
+	e := newEnv(t)
+	hashRoot(t, e)
+
+	// as serve opens it
+	s, err := smerkle.Open(e.Store, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	cmd := &cobra.Command{}
+	cmd.SetContext(t.Context())
+	var stderr bytes.Buffer
+	r := &scheduler{
+		cmd: cmd,
+		g:   &globalOptions{storeDir: e.Store, ignoreFileName: smerkle.DefaultIgnoreFileName},
+		o:   &serveOptions{walkOptions: walkOptions{cache: cacheIndex, symlinks: smerkle.SymlinkRecord.String()}},
+		s:   s,
+		w:   &stderr,
+	}
+	sc := schedule{ref: "scheduled", every: time.Hour, keep: 2, path: e.Dir}
+
+	var last object.Hash
+	for i := range 3 {
+		e.WriteFile("README.md", fmt.Sprintf("# demo %d\n", i))
+		if last, err = r.snapshot(sc); err != nil {
+			t.Fatalf("snapshot() error = %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("snapshot() warned %q", stderr.String())
+	}
+
+	var entries []logJSON
+	if err := json.Unmarshal([]byte(e.MustRun("log", "--output", "json", "scheduled").Stdout), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Snapshot != last.String() || entries[0].Message != scheduledMessage {
+		t.Fatalf("log after 3 snapshots keeping 2 = %+v, want 2 ending at %s", entries, last)
+	}
+	// the newest snapshot holds the tree as it was last
+	if root := hashRoot(t, e); entries[0].Root != root {
+		t.Errorf("newest snapshot root = %s, want %s", entries[0].Root, root)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		pr    smerkle.Progress
+		width int
+		want  string
+	}{
+		{name: "bytes", pr: smerkle.Progress{Files: 1, Bytes: 12, Path: "a.txt"}, width: 36, want: "1 files, 12 B: a.txt"},
+		{name: "binary units", pr: smerkle.Progress{Files: 3, Bytes: 3 << 29, Path: "a.txt"}, width: 36, want: "3 files, 1.5 GiB: a.txt"},
+		{
+			name:  "long path keeps its end",
+			pr:    smerkle.Progress{Files: 2, Bytes: 2048, Path: "very/long/path/to/some/file.go"},
+			width: 36,
+			want:  "2 files, 2.0 KiB: ...to/some/file.go",
+		},
+		{name: "no room for a path", pr: smerkle.Progress{Files: 2, Bytes: 2048, Path: "file.go"}, width: 18, want: "2 files, 2.0 KiB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := formatProgress(tt.pr, tt.width); got != tt.want || len(got) > tt.width {
+				t.Errorf("formatProgress() = %q, want %q within %d bytes", got, tt.want, tt.width)
+			}
+		})
+	}
+
+	// a buffer is never a terminal, so auto shows nothing
+	if show, err := wantProgress(progressAuto, &bytes.Buffer{}); show || err != nil {
+		t.Errorf("wantProgress(auto) = %v, %v; want false, nil", show, err)
+	}
+	if _, err := wantProgress("sometimes", &bytes.Buffer{}); err == nil {
+		t.Error("wantProgress(sometimes) error = nil, want an error")
+	}
+
+	var out bytes.Buffer
+	p := startProgress(&out)
+	p.update(smerkle.Progress{Files: 1, Bytes: 5, Path: "a.txt"})
+	p.draw()
+	p.finish()
+	if got, want := out.String(), "\r1 files, 5 B: a.txt\x1b[K\r\x1b[K"; got != want {
+		t.Errorf("progress output = %q, want %q", got, want)
+	}
+
+	e := newEnv(t)
+	if res := e.MustRun("hash", "--progress=always", e.Dir); strings.Contains(res.Stdout, "files") {
+		t.Errorf("hash --progress wrote progress to stdout: %q", res.Stdout)
+	}
+	if res := e.Run("hash", "--progress=sometimes", e.Dir); res.Err == nil {
+		t.Error("hash --progress=sometimes error = nil, want an error")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type cmpOptions struct {
+	walkOptions
+	output string
+	list   bool
+}
+
+func newCmpCmd(g *globalOptions) *cobra.Command {
+	o := &cmpOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cmp <dir-a> <dir-b>",
+		Short: "Report whether two directories have identical content",
+		Long: "Hash both directories into one store and report whether their root hashes match.\n" +
+			"Exits 0 when identical and 1 when they differ.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCmp(cmd, g, o, args[0], args[1])
+		},
+	}
+
+	o.addFlags(cmd)
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().BoolVarP(&o.list, "list", "l", false, "list differing paths")
+
+	return cmd
+}
+
+type cmpJSON struct {
+	Identical bool                `json:"identical"`
+	HashA     string              `json:"hash_a"`
+	HashB     string              `json:"hash_b"`
+	Changes   []report.ChangeJSON `json:"changes,omitempty"`
+}
+
+func runCmp(cmd *cobra.Command, g *globalOptions, o *cmpOptions, dirA, dirB string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	hashA, err := o.walkNamespaced(cmd, g, s, dirA)
+	if err != nil {
+		return err
+	}
+	hashB, err := o.walkNamespaced(cmd, g, s, dirB)
+	if err != nil {
+		return err
+	}
+
+	identical := hashA == hashB
+	var changes *smerkle.DiffResult
+	if o.list && !identical {
+		changes, err = smerkle.Diff(s, hashA, hashB, smerkle.DiffOptions{Recursive: true})
+		if err != nil {
+			return err //nolint:wrapcheck // diff errors already carry context
+		}
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		out := cmpJSON{
+			Identical: identical,
+			HashA:     hashA.String(),
+			HashB:     hashB.String(),
+		}
+		if changes != nil {
+			out.Changes = report.NewDiffJSON(changes).Changes
+		}
+		if err := writeJSON(w, out); err != nil {
+			return err
+		}
+	} else {
+		verdict := "identical"
+		if !identical {
+			verdict = "different"
+		}
+		if _, err := fmt.Fprintln(w, verdict); err != nil {
+			return fmt.Errorf("write result: %w", err)
+		}
+		if changes != nil {
+			if err := writeDiff(w, outputText, changes); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !identical {
+		return &exitError{code: 1}
+	}
+	return nil
+}
+
+// walkNamespaced hashes root with cache keys scoped to its absolute path, so
+// the two sides of a comparison never share cache entries.
+func (o *walkOptions) walkNamespaced(cmd *cobra.Command, g *globalOptions, s *smerkle.Store, root string) (object.Hash, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("resolve %s: %w", root, err)
+	}
+
+	res, err := o.walk(cmd, g, s, root, smerkle.WithCacheNamespace(abs))
+	if err != nil {
+		return object.ZeroHash, err
+	}
+	report.WriteWarnings(cmd.ErrOrStderr(), res)
+	return res.Hash, nil
+}
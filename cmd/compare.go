@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type compareOptions struct {
+	walkOptions
+	diffOptions
+}
+
+func newCompareCmd(g *globalOptions) *cobra.Command {
+	o := &compareOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "compare <old-dir> <new-dir>",
+		Short: "Show changes between two directories",
+		Long: "Show changes between two directories.\n\n" +
+			"Both are hashed into the store, with cache entries kept apart as cmp\n" +
+			"keeps them, and diffed as diff would diff their trees. Use cmp to only\n" +
+			"learn whether they match.",
+		Example: `  smerkle compare ../app-v1 ../app-v2
+  smerkle compare --stat build/ other-machine/build/`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCompare(cmd, g, o, args[0], args[1])
+		},
+	}
+
+	o.walkOptions.addFlags(cmd)
+	o.diffOptions.addFlags(cmd)
+	o.diffOptions.addPatchFlag(cmd)
+
+	return cmd
+}
+
+func runCompare(cmd *cobra.Command, g *globalOptions, o *compareOptions, oldDir, newDir string) (err error) {
+	if err := o.diffOptions.validate(); err != nil {
+		return err
+	}
+	if o.relative {
+		// a change may live under either directory
+		return errors.New("--relative can't be used with compare")
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	oldHash, err := o.walkNamespaced(cmd, g, s, oldDir)
+	if err != nil {
+		return err
+	}
+	newHash, err := o.walkNamespaced(cmd, g, s, newDir)
+	if err != nil {
+		return err
+	}
+
+	opts, err := o.diffOptions.diffOptions(g)
+	if err != nil {
+		return err
+	}
+	if o.streams() {
+		opts.OnChange = streamChanges(cmd.OutOrStdout(), nil)
+	}
+	res, err := smerkle.Diff(s, oldHash, newHash, opts)
+	if err != nil {
+		return err //nolint:wrapcheck // diff errors already carry context
+	}
+
+	return o.diffOptions.writeResult(cmd, s, res)
+}
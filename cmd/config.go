@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// configAlgorithm names the store's hash algorithm among its settings; it is
+// fixed when the store is created, so only get and list show it.
+const configAlgorithm = "hash-algorithm"
+
+// storeSettings are the keys `config set` accepts, each with its check.
+// A setting is the default for the flag of the same name on every command
+// that has one, applied by applyStoreSettings when the flag isn't given.
+var storeSettings = map[string]func(string) error{
+	"concurrency": nonNegative,
+	"ignore-filename": func(v string) error {
+		if strings.ContainsAny(v, `/\`) || v == "." || v == ".." {
+			return fmt.Errorf("%q is not a file name", v)
+		}
+		return nil
+	},
+	"keep-last":   nonNegative,
+	"keep-daily":  nonNegative,
+	"keep-weekly": nonNegative,
+}
+
+func nonNegative(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q is not a non-negative number", v)
+	}
+	return nil
+}
+
+// applyStoreSettings fills the flags of cmd that weren't given from the
+// settings of the store at g.storeDir, if there is one. A config that
+// can't be read is left for openStore to report.
+func applyStoreSettings(cmd *cobra.Command, g *globalOptions) error {
+	cfg, ok, err := smerkle.ReadStoreConfig(g.storeDir)
+	if err != nil || !ok {
+		return nil //nolint:nilerr // reported when the store is opened
+	}
+	for _, key := range slices.Sorted(maps.Keys(cfg.Settings)) {
+		f := cmd.Flags().Lookup(key)
+		if f == nil || f.Changed || storeSettings[key] == nil {
+			continue
+		}
+		if err := f.Value.Set(cfg.Settings[key]); err != nil {
+			return fmt.Errorf("store setting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+type configOptions struct {
+	output string
+}
+
+func newConfigCmd(g *globalOptions) *cobra.Command {
+	o := &configOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "List the settings kept in the store",
+		Long: "List the settings kept in the store.\n\n" +
+			"Each setting is the default for the flag of the same name on every\n" +
+			"command that has one, so invocations against a store agree without\n" +
+			"repeating flags. A flag given on the command line still wins.\n\n" +
+			"Settings:\n" +
+			"  concurrency      maximum concurrent file reads\n" +
+			"  ignore-filename  name of the per-tree ignore file\n" +
+			"  keep-last        most recent snapshots gc keeps of each history\n" +
+			"  keep-daily       days back gc keeps a snapshot a day for\n" +
+			"  keep-weekly      weeks back gc keeps a snapshot a week for\n" +
+			"  hash-algorithm   fixed when the store is created; read-only",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runConfig(cmd, g, o)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	cmd.AddCommand(
+		newConfigGetCmd(g),
+		newConfigSetCmd(g),
+	)
+
+	return cmd
+}
+
+// storeConfig returns the settings of s with its algorithm.
+func storeConfig(s *smerkle.Store) map[string]string {
+	settings := s.Settings()
+	if settings == nil {
+		settings = make(map[string]string)
+	}
+	settings[configAlgorithm] = s.Algorithm().String()
+	return settings
+}
+
+func runConfig(cmd *cobra.Command, g *globalOptions, o *configOptions) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	settings := storeConfig(s)
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		return writeJSON(w, settings)
+	}
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", key, settings[key]); err != nil {
+			return fmt.Errorf("write setting: %w", err)
+		}
+	}
+	return nil
+}
+
+func newConfigGetCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print one setting kept in the store",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			key := args[0]
+			if err := validateSettingKey(key); err != nil && key != configAlgorithm {
+				return err
+			}
+
+			s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+			if err != nil {
+				return err
+			}
+			defer closeStore(s, &err)
+
+			v, ok := storeConfig(s)[key]
+			if !ok {
+				return fmt.Errorf("%s is not set", key)
+			}
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), v); err != nil {
+				return fmt.Errorf("write setting: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigSetCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Keep a setting in the store",
+		Long: "Keep a setting in the store.\n\n" +
+			"An empty value removes the setting, restoring the flag's own default.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) (err error) {
+			key, value := args[0], args[1]
+			if key == configAlgorithm {
+				return fmt.Errorf("%s is fixed when the store is created", configAlgorithm)
+			}
+			if err := validateSetting(key, value); err != nil {
+				return err
+			}
+
+			s, err := openStore(g, smerkle.WithLazyIndex())
+			if err != nil {
+				return err
+			}
+			defer closeStore(s, &err)
+
+			if err := s.SetSetting(key, value); err != nil {
+				return fmt.Errorf("set %s: %w", key, err)
+			}
+			return nil
+		},
+	}
+}
+
+func validateSettingKey(key string) error {
+	if storeSettings[key] == nil {
+		keys := append(slices.Sorted(maps.Keys(storeSettings)), configAlgorithm)
+		return fmt.Errorf("unknown setting %q (want one of %s)", key, strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// validateSetting checks value for key; an empty value, which removes the
+// setting, always passes.
+func validateSetting(key, value string) error {
+	if err := validateSettingKey(key); err != nil {
+		return err
+	}
+	if value == "" {
+		return nil
+	}
+	if err := storeSettings[key](value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
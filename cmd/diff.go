@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+const (
+	filesFromRsync = "rsync"
+	filesFromTar   = "tar"
+)
+
+// --exit-code exit statuses; 0 is no changes.
+const (
+	diffExitChanges = 1
+	diffExitError   = 2
+)
+
+type diffOptions struct {
+	output     string
+	shallow    bool
+	findCopies bool
+	maxChanges int
+	filesFrom  string
+	patch      bool
+	jsonlHunks bool
+	relative   bool
+	pathFilter string
+	stat       bool
+	excludes   []string
+	exitCode   bool
+	nullTerm   bool
+}
+
+func (o *diffOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json, ndjson, jsonl, porcelain)")
+	cmd.Flags().BoolVar(&o.shallow, "shallow", false, "do not descend into added, deleted, or changed directories")
+	cmd.Flags().BoolVar(&o.findCopies, "find-copies", false, "report added files whose content matches an unchanged file as copies; skipped when --max-changes cuts the diff short")
+	cmd.Flags().IntVar(&o.maxChanges, "max-changes", 0, "stop after this many changes (0 = no limit)")
+	cmd.Flags().StringVar(&o.pathFilter, "path", "",
+		"only compare this path, relative to the tree root, and what lies below it, reading no other subtrees")
+	cmd.Flags().StringArrayVar(&o.excludes, "exclude", nil,
+		"leave out changes to paths matching this ignore-file pattern; repeat for several, combined with any --ignore-file")
+	cmd.Flags().BoolVar(&o.stat, "stat", false,
+		"print file counts and byte deltas per change type and top-level directory instead of the changes")
+	cmd.Flags().StringVar(&o.filesFrom, "files-from-format", "",
+		"print only the changed files, as a list for rsync --files-from or tar -T (rsync, tar)")
+	cmd.Flags().BoolVarP(&o.nullTerm, "null", "z", false,
+		"end each field of a change, or each listed file, with NUL instead of a tab or newline, for paths holding them")
+	addRelativeFlag(cmd, &o.relative)
+}
+
+// addExitCodeFlag adds --exit-code, for commands whose RunE passes its
+// error through exitStatus. Bad flags and arguments get the failure status
+// too; flags are read in order, so a bad one before --exit-code is reported
+// before the flag is seen.
+func (o *diffOptions) addExitCodeFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.exitCode, "exit-code", false,
+		fmt.Sprintf("exit %d if there are changes and %d on error, rather than 0 and 1", diffExitChanges, diffExitError))
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return o.exitStatus(err)
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			return o.exitStatus(args(cmd, a))
+		}
+	}
+}
+
+// exitStatus gives err the --exit-code status of a failure, so it can't be
+// mistaken for changes.
+func (o *diffOptions) exitStatus(err error) error {
+	var exitErr *exitError
+	if !o.exitCode || err == nil || errors.As(err, &exitErr) {
+		return err
+	}
+	return &exitError{code: diffExitError, err: err}
+}
+
+// addPatchFlag adds --patch and --jsonl-hunks, which whatif leaves out
+// since its --patch names the changes file.
+func (o *diffOptions) addPatchFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&o.patch, "patch", "p", false, "print a unified diff of changed file contents")
+	cmd.Flags().BoolVar(&o.jsonlHunks, "jsonl-hunks", false,
+		"print each changed region of file contents as a JSON object per line")
+}
+
+func (o *diffOptions) validate() error {
+	if c := path.Clean(o.pathFilter); o.pathFilter != "" && (c == ".." || strings.HasPrefix(c, "../") || path.IsAbs(c)) {
+		return fmt.Errorf("--path %q is outside the tree", o.pathFilter)
+	}
+	if o.patch && (o.filesFrom != "" || o.output != outputText) {
+		return errors.New("--patch can't be combined with --files-from-format or --output other than text")
+	}
+	if o.jsonlHunks && (o.patch || o.filesFrom != "" || o.output != outputText) {
+		return errors.New("--jsonl-hunks can't be combined with --patch, --files-from-format, or --output other than text")
+	}
+	if o.nullTerm && (o.stat || o.patch || o.jsonlHunks || (o.filesFrom == "" && o.output != outputText)) {
+		return errors.New("-z only applies to the text change list and --files-from-format")
+	}
+	if o.stat {
+		if o.patch || o.jsonlHunks || o.filesFrom != "" {
+			return errors.New("--stat can't be combined with --patch, --jsonl-hunks, or --files-from-format")
+		}
+		if o.shallow {
+			// a shallow diff reports changed directories without their files
+			return errors.New("--stat can't be combined with --shallow")
+		}
+		return validateOutput(o.output)
+	}
+	switch o.filesFrom {
+	case "":
+		return validateReportOutput(o.output)
+	case filesFromRsync, filesFromTar:
+		if o.shallow {
+			// a shallow diff reports added directories without their files
+			return errors.New("--files-from-format can't be combined with --shallow")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown files-from format %q (want %s or %s)", o.filesFrom, filesFromRsync, filesFromTar)
+	}
+}
+
+// diffOptions returns the library options for o. Changes are filtered
+// through the --ignore-file files and --exclude patterns, so paths a base
+// tree recorded under other ignore rules don't show up as changes.
+func (o *diffOptions) diffOptions(g *globalOptions) (smerkle.DiffOptions, error) {
+	opts := smerkle.DiffOptions{
+		Recursive:  !o.shallow,
+		FindCopies: o.findCopies,
+		MaxChanges: o.maxChanges,
+		PathFilter: o.pathFilter,
+	}
+	var ignorers []*smerkle.Ignorer
+	if len(g.ignoreFiles) > 0 {
+		ign, err := smerkle.LoadIgnoreFiles(g.ignoreFiles...)
+		if err != nil {
+			return opts, fmt.Errorf("load ignore file: %w", err)
+		}
+		ignorers = append(ignorers, ign)
+	}
+	if len(o.excludes) > 0 {
+		ign, err := smerkle.CompileIgnore(o.excludes...)
+		if err != nil {
+			return opts, fmt.Errorf("--exclude: %w", err)
+		}
+		ignorers = append(ignorers, ign)
+	}
+	if len(ignorers) > 0 {
+		opts.Ignorer = smerkle.MergeIgnorers(ignorers...)
+	}
+	return opts, nil
+}
+
+// streams reports whether changes are printed as the diff finds them,
+// through streamChanges, rather than by writeResult.
+func (o *diffOptions) streams() bool {
+	return o.output == outputJSONL && o.filesFrom == ""
+}
+
+// writeResult prints res in the chosen format; s supplies file contents for
+// --patch and --jsonl-hunks.
+func (o *diffOptions) writeResult(cmd *cobra.Command, s *smerkle.Store, res *smerkle.DiffResult) error {
+	if o.filesFrom != "" {
+		if err := writeFileList(cmd.OutOrStdout(), cmd.ErrOrStderr(), o.filesFrom, o.nullTerm, res); err != nil {
+			return err
+		}
+		return o.changesStatus(res)
+	}
+	var err error
+	switch {
+	case o.stat:
+		err = writeStat(cmd.OutOrStdout(), o.output, res)
+	case o.patch:
+		err = writePatch(cmd.OutOrStdout(), s, res)
+	case o.jsonlHunks:
+		err = writeHunks(cmd.OutOrStdout(), s, res)
+	case o.nullTerm:
+		err = (&report.TextWriter{Out: cmd.OutOrStdout(), NullTerm: true}).WriteDiff(res)
+	default:
+		err = writeDiff(cmd.OutOrStdout(), o.output, res)
+	}
+	if err != nil {
+		return err
+	}
+	if res.Truncated && o.output == outputText {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: output truncated after %d changes\n", len(res.Changes))
+	}
+	return o.changesStatus(res)
+}
+
+// changesStatus is the --exit-code status for res, nil without the flag.
+func (o *diffOptions) changesStatus(res *smerkle.DiffResult) error {
+	if o.exitCode && res.HasChanges() {
+		return &exitError{code: diffExitChanges}
+	}
+	return nil
+}
+
+func newDiffCmd(g *globalOptions) *cobra.Command {
+	o := &statusOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff <old> <new> | --worktree <old> [path]",
+		Short: "Show changes between two stored trees",
+		Long: "Show changes between two stored trees.\n\n" +
+			"Each tree is given as a hash or the name of a ref. With --worktree the\n" +
+			"new side is a directory (default .), hashed first as status does; the\n" +
+			"walk flags only apply then.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if o.base != "" {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.base != "" {
+				root := g.walkRoot(args)
+				return o.exitStatus(runStatus(cmd, g, o, root))
+			}
+			return o.exitStatus(runDiff(cmd, g, &o.diffOptions, args[0], args[1]))
+		},
+	}
+
+	o.diffOptions.addFlags(cmd)
+	o.diffOptions.addPatchFlag(cmd)
+	o.diffOptions.addExitCodeFlag(cmd)
+	o.walkOptions.addFlags(cmd)
+	cmd.Flags().StringVar(&o.base, "worktree", "", "compare this tree hash or ref against a directory on disk")
+
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, g *globalOptions, o *diffOptions, oldArg, newArg string) (err error) {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if o.relative {
+		return errors.New("--relative needs a directory to be relative to; use --worktree")
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	oldHash, err := resolveHashArg(s, oldArg)
+	if err != nil {
+		return err
+	}
+	newHash, err := resolveHashArg(s, newArg)
+	if err != nil {
+		return err
+	}
+
+	if p, err := s.GetProvenance(newHash); err == nil {
+		warnIgnoreMismatch(cmd.ErrOrStderr(), s, oldHash, p.IgnoreHash, newHash.String())
+	}
+
+	opts, err := o.diffOptions(g)
+	if err != nil {
+		return err
+	}
+	if o.streams() {
+		opts.OnChange = streamChanges(cmd.OutOrStdout(), nil)
+	}
+	res, err := smerkle.Diff(s, oldHash, newHash, opts)
+	if err != nil {
+		return err //nolint:wrapcheck // diff errors already carry context
+	}
+
+	return o.writeResult(cmd, s, res)
+}
+
+// writeFileList prints the files present in the new tree that differ from the
+// old one, one per line or NUL-terminated, so a transfer tool can ship just
+// the delta. Deleted paths can't be expressed in these formats and are only
+// counted on stderr.
+func writeFileList(stdout, stderr io.Writer, format string, nullTerm bool, res *smerkle.DiffResult) error {
+	var b strings.Builder
+	deleted := 0
+	for i := range res.Changes {
+		c := &res.Changes[i]
+		if c.NewEntry == nil {
+			deleted++
+			continue
+		}
+		// directories are listed through their files
+		if c.NewEntry.Mode == object.ModeDirectory {
+			continue
+		}
+		if strings.ContainsRune(c.Path, '\n') && !nullTerm {
+			return fmt.Errorf("path %q contains a newline and can't be listed without -z", c.Path)
+		}
+		if format == filesFromTar {
+			// GNU tar reads -T lines starting with '-' as options
+			b.WriteString("./")
+		}
+		b.WriteString(c.Path)
+		if nullTerm {
+			b.WriteByte(0)
+		} else {
+			b.WriteByte('\n')
+		}
+	}
+
+	if _, err := io.WriteString(stdout, b.String()); err != nil {
+		return fmt.Errorf("write file list: %w", err)
+	}
+	if deleted > 0 {
+		_, _ = fmt.Fprintf(stderr, "warning: %d deleted paths not listed\n", deleted)
+	}
+	if res.Truncated {
+		_, _ = fmt.Fprintf(stderr, "warning: list truncated after %d changes\n", len(res.Changes))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type envOptions struct {
+	includeIgnoreFile bool
+	chunkThreshold    int64
+	symlinks          string
+	followSymlinks    bool
+	inaccessible      bool
+	fullMetadata      bool
+	hashMtimes        bool
+}
+
+func newEnvCmd(g *globalOptions) *cobra.Command {
+	o := &envOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "env [path]",
+		Short: "Print the settings that influence hash output, as JSON",
+		Long: "Print the settings that influence hash output, as JSON.\n\n" +
+			"Two parties whose env output matches (ignoring tool_version) will hash\n" +
+			"identical trees to identical roots.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := g.walkRoot(args)
+			return runEnv(cmd, g, o, root)
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.includeIgnoreFile, "include-ignore-file", false, "report as if hashing with --include-ignore-file")
+	cmd.Flags().Int64Var(&o.chunkThreshold, "chunk-threshold", 0, "report as if hashing with --chunk-threshold")
+	cmd.Flags().StringVar(&o.symlinks, "symlinks", smerkle.SymlinkRecord.String(), "report as if hashing with --symlinks")
+	cmd.Flags().BoolVar(&o.followSymlinks, "follow-symlinks", false, "report as if hashing with --follow-symlinks")
+	cmd.Flags().BoolVar(&o.inaccessible, "record-inaccessible", false, "report as if hashing with --record-inaccessible")
+	cmd.Flags().BoolVar(&o.fullMetadata, "full-metadata", false, "report as if hashing with --full-metadata")
+	cmd.Flags().BoolVar(&o.hashMtimes, "hash-mtimes", false, "report as if hashing with --hash-mtimes")
+
+	return cmd
+}
+
+type envIgnoreJSON struct {
+	FileName          string   `json:"filename"`
+	Files             []string `json:"files"`
+	IncludeIgnoreFile bool     `json:"include_ignore_file"`
+	Strict            bool     `json:"strict"`
+	Fingerprint       string   `json:"fingerprint,omitempty"`
+}
+
+type envJSON struct {
+	ToolVersion        string        `json:"tool_version"`
+	FormatVersion      uint16        `json:"format_version"`
+	HashAlgorithm      string        `json:"hash_algorithm"`
+	Platform           string        `json:"platform"`
+	Normalization      []string      `json:"normalization"`
+	ChunkThreshold     int64         `json:"chunk_threshold"`
+	Symlinks           string        `json:"symlinks"`
+	RecordInaccessible bool          `json:"record_inaccessible"`
+	FullMetadata       bool          `json:"full_metadata"`
+	HashMtimes         bool          `json:"hash_mtimes"`
+	Ignore             envIgnoreJSON `json:"ignore"`
+}
+
+// normalization lists how a walk under the reported settings reduces file
+// metadata before hashing.
+func normalization(o *envOptions, symlinks smerkle.SymlinkPolicy) []string {
+	lines := []string{
+		"modes reduced to regular, executable, directory, symlink",
+		"executable if any execute bit is set",
+	}
+	if o.fullMetadata {
+		lines = append(lines, "permission bits including setuid, setgid, and sticky, owner and group ids, and extended attributes recorded in every entry")
+	} else {
+		lines = append(lines, "other permission bits, owner, group, and extended attributes excluded from tree hashes")
+	}
+	switch symlinks {
+	case smerkle.SymlinkSkip:
+		lines = append(lines, "symlinks left out")
+	case smerkle.SymlinkFollow:
+		lines = append(lines, "symlinks followed, hashed as what they point to")
+	default:
+		lines = append(lines, "symlinks hashed by target path, never followed")
+	}
+	if o.inaccessible {
+		lines = append(lines, "paths denied by permissions recorded as inaccessible entries with a zero hash")
+	} else {
+		lines = append(lines, "paths denied by permissions left out")
+	}
+	if o.hashMtimes {
+		lines = append(lines, "modification times recorded in every entry")
+	} else {
+		lines = append(lines, "modification times excluded from tree hashes")
+	}
+	return append(lines, "tree entries sorted byte-wise by name")
+}
+
+func runEnv(cmd *cobra.Command, g *globalOptions, o *envOptions, root string) error {
+	files, err := globalIgnoreFiles(g)
+	if err != nil {
+		return err
+	}
+	if len(g.ignoreFiles) > 0 {
+		files = append(files, g.ignoreFiles...)
+	} else {
+		path := filepath.Join(root, g.ignoreFileName)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("stat ignore file: %w", err)
+		}
+	}
+
+	fingerprint := ""
+	if len(files) > 0 {
+		ign, err := smerkle.LoadIgnoreFiles(files...)
+		if err != nil {
+			return fmt.Errorf("load ignore file: %w", err)
+		}
+		fingerprint = ign.Fingerprint().String()
+	} else {
+		files = []string{}
+	}
+
+	symlinks := smerkle.SymlinkFollow
+	if !o.followSymlinks {
+		if symlinks, err = smerkle.ParseSymlinkPolicy(o.symlinks); err != nil {
+			return fmt.Errorf("--symlinks: %w", err)
+		}
+	}
+
+	alg, ok, err := smerkle.ReadAlgorithm(g.storeDir)
+	if err != nil {
+		return err //nolint:wrapcheck // store errors already carry context
+	}
+	if !ok && g.hashAlgorithm != "" {
+		// a new store would be created with the requested algorithm
+		if alg, err = object.ParseAlgorithm(g.hashAlgorithm); err != nil {
+			return fmt.Errorf("--hash-algorithm: %w", err)
+		}
+	}
+
+	return writeJSON(cmd.OutOrStdout(), envJSON{
+		ToolVersion:        version,
+		FormatVersion:      object.CurrentVersion,
+		HashAlgorithm:      alg.String(),
+		Platform:           runtime.GOOS + "/" + runtime.GOARCH,
+		Normalization:      normalization(o, symlinks),
+		ChunkThreshold:     o.chunkThreshold,
+		Symlinks:           symlinks.String(),
+		RecordInaccessible: o.inaccessible,
+		FullMetadata:       o.fullMetadata,
+		HashMtimes:         o.hashMtimes,
+		Ignore: envIgnoreJSON{
+			FileName:          g.ignoreFileName,
+			Files:             files,
+			IncludeIgnoreFile: o.includeIgnoreFile,
+			Strict:            g.strictIgnore,
+			Fingerprint:       fingerprint,
+		},
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type eventsOptions struct {
+	output   string
+	follow   bool
+	interval time.Duration
+}
+
+func newEventsCmd(g *globalOptions) *cobra.Command {
+	o := &eventsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show the store's event log",
+		Long: "Show the store's event log.\n\n" +
+			"Every new root, snapshot, and ref update is appended to a small log in\n" +
+			"the store, so other processes can follow changes without polling\n" +
+			"stats. With --follow, new events are printed as they arrive until\n" +
+			"interrupted. JSON output is one object per line.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runEvents(cmd, g, o)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().BoolVarP(&o.follow, "follow", "f", false, "keep printing events as they are logged")
+	cmd.Flags().DurationVar(&o.interval, "interval", time.Second, "how often --follow checks for new events")
+
+	return cmd
+}
+
+type eventJSON struct {
+	Time string `json:"time"`
+	Kind string `json:"kind"`
+	Hash string `json:"hash,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func runEvents(cmd *cobra.Command, g *globalOptions, o *eventsOptions) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	if o.interval <= 0 {
+		return fmt.Errorf("--interval must be positive, got %s", o.interval)
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	var off int64
+	for {
+		var events []smerkle.Event
+		events, off, err = s.ReadEvents(off)
+		if err != nil {
+			return err //nolint:wrapcheck // store errors already carry context
+		}
+		for _, e := range events {
+			if err := writeEvent(cmd.OutOrStdout(), o.output, e); err != nil {
+				return err
+			}
+		}
+		if !o.follow {
+			return nil
+		}
+
+		select {
+		case <-cmd.Context().Done():
+			return nil
+		case <-time.After(o.interval):
+		}
+	}
+}
+
+func writeEvent(w io.Writer, format string, e smerkle.Event) error {
+	if format == outputJSON {
+		out := eventJSON{Time: e.Time.Format(time.RFC3339Nano), Kind: string(e.Kind), Name: e.Name}
+		if !e.Hash.IsZero() {
+			out.Hash = e.Hash.String()
+		}
+		if err := json.NewEncoder(w).Encode(out); err != nil {
+			return fmt.Errorf("encode json: %w", err)
+		}
+		return nil
+	}
+
+	line := fmt.Sprintf("%s %s", e.Time.Format(time.RFC3339), e.Kind)
+	if !e.Hash.IsZero() {
+		line += " " + e.Hash.String()
+	}
+	if e.Name != "" {
+		line += " " + e.Name
+	}
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+	return nil
+}
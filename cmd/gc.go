@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type gcOptions struct {
+	output    string
+	grace     time.Duration
+	dryRun    bool
+	retention smerkle.Retention
+}
+
+func newGCCmd(g *globalOptions) *cobra.Command {
+	o := &gcOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove objects no ref or pin reaches",
+		Long: "Remove objects no ref or pin reaches.\n\n" +
+			"Everything under a ref or a pinned hash is kept, snapshots with their\n" +
+			"whole history; anything else goes, such as the roots of untagged\n" +
+			"hashes. Packs holding unreachable objects are rewritten without them.\n" +
+			"What gc finds reachable is recorded, so the next run reads only the\n" +
+			"trees added since, unless a ref was deleted or moved off its history.\n\n" +
+			"The --keep flags first thin the history under every ref that names a\n" +
+			"snapshot: a snapshot any of them keeps stays, as do the newest and a\n" +
+			"pinned one with everything before it, and the rest are cut from the\n" +
+			"chain along with what only they reach. Set them with `config set` to\n" +
+			"apply them on every run.",
+		Example: `  smerkle gc --dry-run
+  smerkle gc --grace 0
+  smerkle gc --keep-last 10 --keep-daily 30 --keep-weekly 52`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runGC(cmd, g, o)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().DurationVar(&o.grace, "grace", time.Hour,
+		"keep unreachable objects written more recently than this")
+	cmd.Flags().BoolVarP(&o.dryRun, "dry-run", "n", false, "report what would be removed without removing it")
+	cmd.Flags().IntVar(&o.retention.Last, "keep-last", 0, "keep this many of the most recent snapshots of each history (0 = all)")
+	cmd.Flags().IntVar(&o.retention.Daily, "keep-daily", 0, "keep the newest snapshot of each day for this many days back")
+	cmd.Flags().IntVar(&o.retention.Weekly, "keep-weekly", 0, "keep the newest snapshot of each week for this many weeks back")
+
+	return cmd
+}
+
+type gcJSON struct {
+	Roots       int    `json:"roots"`
+	Reachable   int    `json:"reachable"`
+	Removed     int    `json:"removed"`
+	Bytes       uint64 `json:"bytes"`
+	Recent      int    `json:"recent"`
+	Packs       int    `json:"packs"`
+	Incremental bool   `json:"incremental"`
+	Snapshots   int    `json:"snapshots_cut"`
+	DryRun      bool   `json:"dry_run"`
+}
+
+func runGC(cmd *cobra.Command, g *globalOptions, o *gcOptions) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	res, err := s.GC(smerkle.GCOptions{Grace: o.grace, DryRun: o.dryRun, Retention: o.retention})
+	if err != nil {
+		return fmt.Errorf("gc: %w", err)
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		return writeJSON(w, gcJSON{
+			Roots: res.Roots, Reachable: res.Reachable, Removed: res.Removed, Bytes: res.Bytes,
+			Recent: res.Recent, Packs: res.Packs, Incremental: res.Incremental, Snapshots: res.Snapshots, DryRun: o.dryRun,
+		})
+	}
+	verb, cut := "removed", "cut"
+	if o.dryRun {
+		verb, cut = "would remove", "would cut"
+	}
+	if !o.retention.IsZero() {
+		if _, err := fmt.Fprintf(w, "%s %d snapshots from history\n", cut, res.Snapshots); err != nil {
+			return fmt.Errorf("write gc result: %w", err)
+		}
+	}
+	_, err = fmt.Fprintf(w, "%s %d objects (%d bytes); %d reachable from %d refs and pins\n",
+		verb, res.Removed, res.Bytes, res.Reachable, res.Roots)
+	if err == nil && res.Recent > 0 {
+		_, err = fmt.Fprintf(w, "kept %d unreachable objects newer than %s\n", res.Recent, o.grace)
+	}
+	if err != nil {
+		return fmt.Errorf("write gc result: %w", err)
+	}
+	return nil
+}
+
+type pinOptions struct {
+	output string
+}
+
+func newPinCmd(g *globalOptions) *cobra.Command {
+	o := &pinOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "pin [hash|ref]...",
+		Short: "Keep objects from gc, or list those kept",
+		Long: "Keep objects from gc, or list those kept.\n\n" +
+			"A pinned hash and everything it references survive gc whether or not\n" +
+			"a ref names it; a pinned snapshot keeps its history too. A ref is\n" +
+			"pinned at the hash it holds now. With no arguments, pin lists the\n" +
+			"pinned hashes.",
+		Example: `  smerkle pin release-1
+  smerkle unpin 3f2a...`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPin(cmd, g, o, args)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+func runPin(cmd *cobra.Command, g *globalOptions, o *pinOptions, args []string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	for _, arg := range args {
+		h, err := lookupHashArg(s, arg)
+		if err != nil {
+			return err
+		}
+		if err := s.Pin(h); err != nil {
+			return fmt.Errorf("pin %s: %w", arg, err)
+		}
+	}
+	if len(args) > 0 {
+		return nil
+	}
+
+	pins, err := s.Pins()
+	if err != nil {
+		return err //nolint:wrapcheck // store errors already carry context
+	}
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		out := make([]string, 0, len(pins))
+		for _, h := range pins {
+			out = append(out, h.String())
+		}
+		return writeJSON(w, out)
+	}
+	for _, h := range pins {
+		if _, err := fmt.Fprintln(w, h); err != nil {
+			return fmt.Errorf("write pin: %w", err)
+		}
+	}
+	return nil
+}
+
+func newUnpinCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpin <hash|ref>...",
+		Short: "Let gc remove pinned objects again",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runUnpin(g, args)
+		},
+	}
+}
+
+func runUnpin(g *globalOptions, args []string) (err error) {
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	for _, arg := range args {
+		h, err := lookupHashArg(s, arg)
+		if err != nil {
+			return err
+		}
+		if err := s.Unpin(h); err != nil {
+			return fmt.Errorf("unpin %s: %w", arg, err)
+		}
+	}
+	return nil
+}
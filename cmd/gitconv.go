@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/gitconv"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type importGitOptions struct {
+	output string
+}
+
+func newImportGitCmd(g *globalOptions) *cobra.Command {
+	o := &importGitOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "import-git <repo> <rev>",
+		Short: "Convert a git tree at a revision into smerkle objects",
+		Long: "Convert a git tree at a revision into smerkle objects.\n\n" +
+			"The resulting root hash equals that of a checkout of <rev> hashed\n" +
+			"with .git ignored, so history can be compared against live\n" +
+			"directories without checking it out. Submodules are skipped.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImportGit(cmd, g, o, args[0], args[1])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+type importGitJSON struct {
+	Hash    string   `json:"hash"`
+	Skipped []string `json:"skipped"`
+}
+
+func runImportGit(cmd *cobra.Command, g *globalOptions, o *importGitOptions, repo, rev string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	res, err := gitconv.Import(cmd.Context(), s, repo, rev)
+	if err != nil {
+		return fmt.Errorf("import %s %s: %w", repo, rev, err)
+	}
+
+	if o.output == outputJSON {
+		skipped := res.Skipped
+		if skipped == nil {
+			skipped = []string{}
+		}
+		return writeJSON(cmd.OutOrStdout(), importGitJSON{Hash: res.Root.String(), Skipped: skipped})
+	}
+
+	for _, p := range res.Skipped {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s: submodule skipped\n", p)
+	}
+	if _, err := fmt.Fprintln(cmd.OutOrStdout(), res.Root); err != nil {
+		return fmt.Errorf("write hash: %w", err)
+	}
+	return nil
+}
+
+type exportGitOptions struct {
+	output  string
+	repo    string
+	commit  bool
+	message string
+	branch  string
+	mtime   string
+}
+
+func newExportGitCmd(g *globalOptions) *cobra.Command {
+	o := &exportGitOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "export-git <root> --repo <path>",
+		Short: "Write a stored tree into a git repository as a tree or commit",
+		Long: "Write a stored tree into a git repository as a tree or commit.\n\n" +
+			"Commits are dated now unless --mtime or SOURCE_DATE_EPOCH fixes the\n" +
+			"author and committer date; with a fixed date and git identity, exporting\n" +
+			"the same root onto the same parent always gives the same commit id.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExportGit(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().StringVar(&o.repo, "repo", "", "existing git repository to write into")
+	cmd.Flags().BoolVar(&o.commit, "commit", false, "also create a commit of the tree")
+	cmd.Flags().StringVarP(&o.message, "message", "m", "", "commit message (default: smerkle snapshot <root>)")
+	cmd.Flags().StringVar(&o.branch, "branch", "", "commit onto this branch, creating it if needed (implies --commit)")
+	cmd.Flags().StringVar(&o.mtime, "mtime", "", "commit date as @<unix seconds> or RFC 3339 (default: $SOURCE_DATE_EPOCH, else now)")
+	_ = cmd.MarkFlagRequired("repo")
+
+	return cmd
+}
+
+type exportGitJSON struct {
+	Tree   string `json:"tree"`
+	Commit string `json:"commit,omitempty"`
+}
+
+func runExportGit(cmd *cobra.Command, g *globalOptions, o *exportGitOptions, arg string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	mtime, err := resolveMtime(o.mtime)
+	if err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	h, err := resolveHashArg(s, arg)
+	if err != nil {
+		return err
+	}
+
+	message := o.message
+	if message == "" {
+		message = "smerkle snapshot " + h.String()
+	}
+	res, err := gitconv.Export(cmd.Context(), s, o.repo, h, gitconv.ExportOptions{
+		Commit:  o.commit,
+		Message: message,
+		Branch:  o.branch,
+		Time:    mtime,
+	})
+	if err != nil {
+		return fmt.Errorf("export %s: %w", h, err)
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		return writeJSON(w, exportGitJSON{Tree: res.Tree, Commit: res.Commit})
+	}
+	if _, err := fmt.Fprintf(w, "tree %s\n", res.Tree); err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	if res.Commit != "" {
+		if _, err := fmt.Fprintf(w, "commit %s\n", res.Commit); err != nil {
+			return fmt.Errorf("write result: %w", err)
+		}
+	}
+	return nil
+}
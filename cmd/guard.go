@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type guardOptions struct {
+	walkOptions
+	output   string
+	base     string
+	allow    []string
+	relative bool
+}
+
+func newGuardCmd(g *globalOptions) *cobra.Command {
+	o := &guardOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "guard [path]",
+		Short: "Fail if a directory changed outside the allowed paths",
+		Long: "Fail if a directory changed outside the allowed paths.\n\n" +
+			"The directory is compared against the --base tree and every change\n" +
+			"whose path matches no --allow pattern (ignore-file syntax) is\n" +
+			"printed. The command exits non-zero if there are any, so a CI job\n" +
+			"can enforce which paths it may touch.",
+		Example: `  smerkle guard --base "$BASE" --allow 'docs/**' --allow CHANGELOG.md`,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := g.walkRoot(args)
+			return runGuard(cmd, g, o, root)
+		},
+	}
+
+	o.addFlags(cmd)
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json, ndjson, jsonl, porcelain)")
+	cmd.Flags().StringVar(&o.base, "base", "", "tree hash or ref to compare against")
+	cmd.Flags().StringArrayVar(&o.allow, "allow", nil, "pattern of paths allowed to change (repeatable)")
+	addRelativeFlag(cmd, &o.relative)
+	_ = cmd.MarkFlagRequired("base")
+
+	return cmd
+}
+
+func runGuard(cmd *cobra.Command, g *globalOptions, o *guardOptions, root string) (err error) {
+	if err := validateReportOutput(o.output); err != nil {
+		return err
+	}
+
+	allow, err := parseAllow(o.allow)
+	if err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	baseHash, err := resolveHashArg(s, o.base)
+	if err != nil {
+		return err
+	}
+
+	res, err := o.walk(cmd, g, s, root)
+	if err != nil {
+		return err
+	}
+	report.WriteWarnings(cmd.ErrOrStderr(), res)
+	warnIgnoreMismatch(cmd.ErrOrStderr(), s, baseHash, res.IgnoreHash, "the working tree")
+
+	changes, err := smerkle.Diff(s, baseHash, res.Hash, smerkle.DiffOptions{Recursive: true})
+	if err != nil {
+		return err //nolint:wrapcheck // diff errors already carry context
+	}
+
+	violations := &smerkle.DiffResult{}
+	for _, c := range changes.Changes {
+		if !allowedChange(allow, &c) {
+			violations.Changes = append(violations.Changes, c)
+		}
+	}
+
+	if err := relativeChanges(o.relative, root, violations); err != nil {
+		return err
+	}
+	if err := writeDiff(cmd.OutOrStdout(), o.output, violations); err != nil {
+		return err
+	}
+	if len(violations.Changes) > 0 {
+		return fmt.Errorf("%d changes outside the allowed paths", len(violations.Changes))
+	}
+	if len(res.Errors) > 0 {
+		// an unreadable file could hide a change
+		return fmt.Errorf("%d paths could not be hashed", len(res.Errors))
+	}
+	return nil
+}
+
+// parseAllow compiles the --allow patterns, rejecting any that don't compile
+// since a skipped pattern would fail the guard in a confusing way.
+func parseAllow(patterns []string) (*smerkle.Ignorer, error) {
+	allow, err := smerkle.CompileIgnore(patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("--allow: %w", err)
+	}
+	return allow, nil
+}
+
+// allowedChange reports whether c only touches allowed paths. A directory
+// modified in place is judged by the changes inside it, which are listed
+// separately.
+func allowedChange(allow *smerkle.Ignorer, c *smerkle.Change) bool {
+	if c.Type == smerkle.ChangeModified && c.NewEntry.Mode == object.ModeDirectory {
+		return true
+	}
+	isDir := c.NewEntry != nil && c.NewEntry.Mode == object.ModeDirectory ||
+		c.NewEntry == nil && c.OldEntry.Mode == object.ModeDirectory
+	return allow.Match(c.Path, isDir)
+}
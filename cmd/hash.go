@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/internal/snapshot"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+const (
+	cacheIndex = "index"
+	cacheXattr = "xattr"
+)
+
+type walkOptions struct {
+	concurrency       int
+	maxOpenFiles      int
+	memoryLimit       int64
+	includeIgnoreFile bool
+	cache             string
+	rereads           int
+	fsSnapshot        string
+	chunkThreshold    int64
+	inaccessible      bool
+	symlinks          string
+	followSymlinks    bool
+	fullMetadata      bool
+	hashMtimes        bool
+	maxFileSize       int64
+	maxDepth          int
+	maxFiles          int
+}
+
+func (o *walkOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&o.concurrency, "concurrency", 0, "maximum concurrent file reads (0 = number of CPUs)")
+	cmd.Flags().IntVar(&o.maxOpenFiles, "max-open-files", 0,
+		"maximum file descriptors a walk holds at once (0 = half the RLIMIT_NOFILE soft limit, at most 1024)")
+	cmd.Flags().Int64Var(&o.memoryLimit, "memory-limit", 0,
+		"cap file content held in memory at once to about this many bytes, streaming larger files; never changes hashes (0 = unbounded)")
+	cmd.Flags().BoolVar(&o.includeIgnoreFile, "include-ignore-file", false, "hash ignore files so rule changes alter the root hash")
+	cmd.Flags().StringVar(&o.cache, "cache", cacheIndex,
+		"where to cache file hashes between walks (index: the store's index, xattr: extended attributes on each file)")
+	cmd.Flags().StringVar(&o.fsSnapshot, "fs-snapshot", "",
+		"hash a read-only filesystem snapshot of the root for a point-in-time result ("+strings.Join(snapshot.Names(), ", ")+")")
+	cmd.Flags().Lookup("fs-snapshot").NoOptDefVal = snapshot.Auto
+	cmd.Flags().IntVar(&o.rereads, "reread", 0, "times to reread a file that changed while being read before reporting it unstable")
+	cmd.Flags().Int64Var(&o.chunkThreshold, "chunk-threshold", 0,
+		"store files of at least this many bytes as content-defined chunks; changes their hashes (0 = never)")
+	cmd.Flags().BoolVar(&o.inaccessible, "record-inaccessible", false,
+		"record paths denied by permissions as inaccessible entries instead of omitting them; changes the root hash")
+	cmd.Flags().StringVar(&o.symlinks, "symlinks", smerkle.SymlinkRecord.String(),
+		"what to do with symlinks: record their target paths, skip them, or follow them to hash what they point to (record, skip, follow); skip and follow change the root hash")
+	cmd.Flags().BoolVar(&o.followSymlinks, "follow-symlinks", false, "same as --symlinks follow")
+	cmd.Flags().BoolVar(&o.fullMetadata, "full-metadata", false,
+		"record permission bits, owner, group, and extended attributes of every entry; changes the root hash")
+	cmd.Flags().BoolVar(&o.hashMtimes, "hash-mtimes", false,
+		"hash every entry's modification time too, so timestamp-only changes alter the root hash; changes the root hash")
+	cmd.Flags().Int64Var(&o.maxFileSize, "max-file-size", 0, "leave out files larger than this many bytes with a warning (0 = no limit)")
+	cmd.Flags().IntVar(&o.maxDepth, "max-depth", 0,
+		"leave out directories this many levels below the root, and everything under them, with a warning (0 = no limit)")
+	cmd.Flags().IntVar(&o.maxFiles, "max-files", 0,
+		"hash at most this many files, reporting the rest as unvisited like an exhausted --budget (0 = no limit)")
+}
+
+// symlinkPolicy returns the policy --symlinks and --follow-symlinks ask for.
+func (o *walkOptions) symlinkPolicy() (smerkle.SymlinkPolicy, error) {
+	if o.followSymlinks {
+		return smerkle.SymlinkFollow, nil
+	}
+	p, err := smerkle.ParseSymlinkPolicy(o.symlinks)
+	if err != nil {
+		return p, fmt.Errorf("--symlinks: %w", err)
+	}
+	return p, nil
+}
+
+func (o *walkOptions) walkerOptions(g *globalOptions) ([]smerkle.WalkOption, error) {
+	opts := []smerkle.WalkOption{
+		smerkle.WithConcurrency(o.concurrency),
+		smerkle.WithMaxOpenFiles(o.maxOpenFiles),
+		smerkle.WithMemoryLimit(o.memoryLimit),
+		smerkle.WithIgnoreFileName(g.ignoreFileName),
+		// ordering never changes the hash, so always prefer busy subtrees
+		smerkle.WithVolatileFirst(),
+		smerkle.WithRereadUnstable(o.rereads),
+	}
+	if o.includeIgnoreFile {
+		opts = append(opts, smerkle.WithIncludeIgnoreFile())
+	}
+	if o.chunkThreshold > 0 {
+		opts = append(opts, smerkle.WithChunking(o.chunkThreshold))
+	}
+	if o.inaccessible {
+		opts = append(opts, smerkle.WithInaccessibleEntries())
+	}
+	if o.fullMetadata {
+		opts = append(opts, smerkle.WithFullMetadata())
+	}
+	if o.hashMtimes {
+		opts = append(opts, smerkle.WithModTimes())
+	}
+	if o.maxFileSize > 0 {
+		opts = append(opts, smerkle.WithMaxFileSize(o.maxFileSize))
+	}
+	if o.maxDepth > 0 {
+		opts = append(opts, smerkle.WithMaxDepth(o.maxDepth))
+	}
+	if o.maxFiles > 0 {
+		opts = append(opts, smerkle.WithMaxFiles(o.maxFiles))
+	}
+	if g.strictIgnore {
+		opts = append(opts, smerkle.WithStrictIgnore())
+	}
+	symlinks, err := o.symlinkPolicy()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, smerkle.WithSymlinkPolicy(symlinks))
+	switch o.cache {
+	case cacheIndex:
+	case cacheXattr:
+		c, err := smerkle.NewXattrCache()
+		if err != nil {
+			return nil, fmt.Errorf("--cache %s: %w", o.cache, err)
+		}
+		opts = append(opts, smerkle.WithCache(c))
+	default:
+		return nil, fmt.Errorf("unknown cache %q (want %s or %s)", o.cache, cacheIndex, cacheXattr)
+	}
+	if len(g.ignoreFiles) > 0 {
+		ign, err := smerkle.LoadIgnoreFiles(g.ignoreFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("load ignore file: %w", err)
+		}
+		opts = append(opts, smerkle.WithIgnorer(ign))
+	}
+	global, err := globalIgnoreFiles(g)
+	if err != nil {
+		return nil, err
+	}
+	if len(global) > 0 {
+		ign, err := smerkle.LoadIgnoreFiles(global...)
+		if err != nil {
+			return nil, fmt.Errorf("load ignore file: %w", err)
+		}
+		opts = append(opts, smerkle.WithGlobalIgnorer(ign))
+	}
+	return opts, nil
+}
+
+func (o *walkOptions) walk(cmd *cobra.Command, g *globalOptions, s *smerkle.Store, root string, extra ...smerkle.WalkOption) (res *smerkle.WalkResult, err error) {
+	opts, err := o.walkerOptions(g)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, extra...)
+
+	walkRoot := root
+	if o.fsSnapshot != "" {
+		snap, err := snapshot.Create(cmd.Context(), o.fsSnapshot, root)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", root, err)
+		}
+		defer func() {
+			// the walk's context may be cancelled; cleanup must still run
+			if derr := snap.Destroy(context.WithoutCancel(cmd.Context())); derr != nil && err == nil {
+				err = fmt.Errorf("destroy snapshot: %w", derr)
+			}
+		}()
+		walkRoot = snap.Path
+		opts = append(opts, smerkle.WithSourceRoot(root))
+	}
+
+	res, err = smerkle.Walk(cmd.Context(), walkRoot, s, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", root, err)
+	}
+	return res, nil
+}
+
+type hashOptions struct {
+	walkOptions
+	output     string
+	verbose    bool
+	budget     time.Duration
+	tag        string
+	expect     string
+	progress   string
+	pruneCache bool
+	baseline   bool
+}
+
+func newHashCmd(g *globalOptions) *cobra.Command {
+	o := &hashOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "hash [path]",
+		Short: "Hash a directory and store its objects",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := g.walkRoot(args)
+			return runHash(cmd, g, o, root)
+		},
+	}
+
+	o.addFlags(cmd)
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json, ndjson, jsonl, porcelain)")
+	cmd.Flags().BoolVarP(&o.verbose, "verbose", "v", false, "report object writes, hard links, and walk metrics: files hashed and served from the cache, bytes read, and time taken")
+	cmd.Flags().DurationVar(&o.budget, "budget", 0,
+		"stop descending after this long and report a partial root (0 = unbounded)")
+	cmd.Flags().StringVar(&o.tag, "tag", "", "point this ref at the resulting root")
+	addExpectFlag(cmd, &o.expect)
+	cmd.Flags().StringVar(&o.progress, "progress", progressAuto,
+		"show files and bytes done on stderr while hashing (auto: when stderr is a terminal, always, never)")
+	cmd.Flags().Lookup("progress").NoOptDefVal = progressAlways
+	cmd.Flags().BoolVar(&o.pruneCache, "prune-cache", false,
+		"drop cached hashes of paths this walk no longer finds, such as deleted or renamed files")
+	cmd.Flags().BoolVar(&o.baseline, "update-baseline", false,
+		"record the result as a snapshot on "+defaultHistoryRef+", the baseline status compares against without --base")
+
+	return cmd
+}
+
+func runHash(cmd *cobra.Command, g *globalOptions, o *hashOptions, root string) (err error) {
+	if err := validateReportOutput(o.output); err != nil {
+		return err
+	}
+	if o.tag != "" {
+		if err := smerkle.ValidateRefName(o.tag); err != nil {
+			return fmt.Errorf("--tag: %w", err)
+		}
+	}
+	if o.expect != "" && o.tag == "" {
+		return errors.New("--expect requires --tag")
+	}
+	if err := validateExpect(o.expect); err != nil {
+		return err
+	}
+	showProgress, err := wantProgress(o.progress, cmd.ErrOrStderr())
+	if err != nil {
+		return fmt.Errorf("--progress: %w", err)
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	var parent object.Hash
+	if o.baseline {
+		if parent, err = historyHead(s, defaultHistoryRef); err != nil {
+			return err
+		}
+	}
+
+	extra := []smerkle.WalkOption{smerkle.WithBudget(o.budget)}
+	if o.pruneCache {
+		extra = append(extra, smerkle.WithPruneCache())
+	}
+	var bar *progressLine
+	if showProgress {
+		bar = startProgress(cmd.ErrOrStderr())
+		extra = append(extra, smerkle.WithProgress(bar.update))
+	}
+	// jsonl prints entries as they are hashed; a write error sticks and
+	// surfaces with the result record
+	var entries *report.JSONLWriter
+	if o.output == outputJSONL {
+		entries = &report.JSONLWriter{Out: cmd.OutOrStdout()}
+		extra = append(extra, smerkle.WithEntryFunc(func(p string, e smerkle.Entry) {
+			_ = entries.WriteEntry(p, &e)
+		}))
+	}
+	res, err := o.walk(cmd, g, s, root, extra...)
+	bar.finish()
+	if err != nil {
+		return err
+	}
+
+	if err := s.PutProvenance(newProvenance(res, root, g, &o.walkOptions)); err != nil {
+		return fmt.Errorf("record provenance: %w", err)
+	}
+	if o.baseline {
+		if res.Partial() {
+			return errors.New("--update-baseline: the walk stopped early; not recording a partial root")
+		}
+		if _, err := extendHistory(s, defaultHistoryRef, parent, res.Hash, ""); err != nil {
+			return fmt.Errorf("--update-baseline: %w", err)
+		}
+	}
+	if o.tag != "" {
+		if err := updateRef(s, o.tag, res.Hash, o.expect); err != nil {
+			return fmt.Errorf("tag %s: %w", o.tag, err)
+		}
+	}
+
+	var dedup *object.DedupStats
+	if o.verbose {
+		d := s.SessionDedupStats()
+		dedup = &d
+	}
+
+	if entries != nil {
+		return entries.WriteResult(res, dedup) //nolint:wrapcheck // report errors already carry context
+	}
+	return writeHashResult(cmd.OutOrStdout(), cmd.ErrOrStderr(), o.output, res, dedup)
+}
+
+// writeHashResult prints the walk result; dedup is only reported when non-nil.
+func writeHashResult(stdout, stderr io.Writer, format string, res *smerkle.WalkResult, dedup *object.DedupStats) error {
+	w, err := report.New(format, stdout, stderr)
+	if err != nil {
+		return err //nolint:wrapcheck // the format error names the format
+	}
+	return w.WriteResult(res, dedup) //nolint:wrapcheck // report errors already carry context
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type hashBlobOptions struct {
+	output         string
+	stdin          bool
+	chunkThreshold int64
+	followSymlinks bool
+	rereads        int
+}
+
+func newHashBlobCmd(g *globalOptions) *cobra.Command {
+	o := &hashBlobOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "hash-blob [file]",
+		Short: "Hash a single file and store it as a blob",
+		Long: "Hash a single file and store it as a blob.\n\n" +
+			"The file is stored as hash would store it inside a directory, so the\n" +
+			"printed hash matches its entry in any tree holding the same content.\n" +
+			"With --stdin the content is read from standard input instead.",
+		Example: `  smerkle hash-blob dist/app.tar.gz
+  curl -sL "$URL" | smerkle hash-blob --stdin`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case o.stdin && len(args) > 0:
+				return errors.New("--stdin and a file are mutually exclusive")
+			case !o.stdin && len(args) == 0:
+				return errors.New("a file or --stdin is required")
+			}
+			path := ""
+			if len(args) == 1 {
+				path = args[0]
+			}
+			return runHashBlob(cmd, g, o, path)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().BoolVar(&o.stdin, "stdin", false, "hash standard input instead of a file")
+	cmd.Flags().Int64Var(&o.chunkThreshold, "chunk-threshold", 0,
+		"store content of at least this many bytes as content-defined chunks; changes its hash (0 = never)")
+	cmd.Flags().BoolVar(&o.followSymlinks, "follow-symlinks", false, "hash what a symlink points to instead of its target path")
+	cmd.Flags().IntVar(&o.rereads, "reread", 0, "times to reread a file that changed while being read before failing")
+
+	return cmd
+}
+
+func runHashBlob(cmd *cobra.Command, g *globalOptions, o *hashBlobOptions, path string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	opts := []smerkle.WalkOption{smerkle.WithRereadUnstable(o.rereads)}
+	if o.chunkThreshold > 0 {
+		opts = append(opts, smerkle.WithChunking(o.chunkThreshold))
+	}
+	if o.followSymlinks {
+		opts = append(opts, smerkle.WithSymlinkPolicy(smerkle.SymlinkFollow))
+	}
+
+	var e smerkle.Entry
+	if o.stdin {
+		e, err = smerkle.HashReader(cmd.Context(), cmd.InOrStdin(), s, opts...)
+	} else {
+		e, err = smerkle.HashFile(cmd.Context(), path, s, opts...)
+	}
+	if err != nil {
+		if o.stdin {
+			return fmt.Errorf("hash stdin: %w", err)
+		}
+		return fmt.Errorf("hash %s: %w", path, err)
+	}
+
+	if o.output == outputJSON {
+		return writeJSON(cmd.OutOrStdout(), report.NewEntryJSON(&e))
+	}
+	if _, err := fmt.Fprintln(cmd.OutOrStdout(), e.Hash); err != nil {
+		return fmt.Errorf("write hash: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type hashManyOptions struct {
+	walkOptions
+	manifest string
+}
+
+func newHashManyCmd(g *globalOptions) *cobra.Command {
+	o := &hashManyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "hash-many --manifest <file>",
+		Short: "Hash many directories concurrently, as JSON",
+		Long: "Hash many directories concurrently, as JSON.\n\n" +
+			"The manifest lists one root per line; blank lines and lines starting\n" +
+			"with # are skipped, and relative paths are resolved against the\n" +
+			"current directory. Roots are walked at the same time but share one\n" +
+			"--concurrency budget for file reads and one --max-open-files budget\n" +
+			"for file descriptors. A root that can't be walked is\n" +
+			"reported with an error and fails the command once all roots finish.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runHashMany(cmd, g, o)
+		},
+	}
+
+	o.addFlags(cmd)
+	cmd.Flags().StringVar(&o.manifest, "manifest", "", "file listing the roots to hash (- for stdin)")
+	_ = cmd.MarkFlagRequired("manifest")
+
+	return cmd
+}
+
+type hashManyRootJSON struct {
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+	*report.ResultJSON
+}
+
+type hashManyJSON struct {
+	Roots []hashManyRootJSON `json:"roots"`
+}
+
+func runHashMany(cmd *cobra.Command, g *globalOptions, o *hashManyOptions) (err error) {
+	roots, err := readManifest(cmd.InOrStdin(), o.manifest)
+	if err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	pool := smerkle.NewPool(o.concurrency, o.maxOpenFiles)
+	out := hashManyJSON{Roots: make([]hashManyRootJSON, len(roots))}
+	var (
+		wg     sync.WaitGroup
+		failed int
+		mu     sync.Mutex // guards failed
+	)
+	for i, root := range roots {
+		wg.Go(func() {
+			entry := hashManyRootJSON{Path: root}
+			defer func() { out.Roots[i] = entry }()
+
+			fail := func(err error) {
+				entry.Error = err.Error()
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+
+			abs, err := filepath.Abs(root)
+			if err != nil {
+				fail(fmt.Errorf("resolve %s: %w", root, err))
+				return
+			}
+			// roots share the store's index, so keep their cache keys apart
+			res, err := o.walk(cmd, g, s, root, smerkle.WithPool(pool), smerkle.WithCacheNamespace(abs))
+			if err != nil {
+				fail(err)
+				return
+			}
+			if err := s.PutProvenance(newProvenance(res, root, g, &o.walkOptions)); err != nil {
+				fail(fmt.Errorf("record provenance: %w", err))
+				return
+			}
+			h := report.NewResultJSON(res, nil)
+			entry.ResultJSON = &h
+		})
+	}
+	wg.Wait()
+
+	if err := writeJSON(cmd.OutOrStdout(), out); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d roots failed", failed, len(roots))
+	}
+	return nil
+}
+
+// readManifest returns the roots listed in the manifest at p, or in stdin
+// for "-".
+func readManifest(stdin io.Reader, p string) ([]string, error) {
+	r := stdin
+	if p != "-" {
+		f, err := os.Open(p) //nolint:gosec // the user names the manifest
+		if err != nil {
+			return nil, fmt.Errorf("open manifest: %w", err)
+		}
+		defer f.Close() //nolint:errcheck // read-only
+		r = f
+	}
+
+	var roots []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		roots = append(roots, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("manifest lists no roots")
+	}
+	return roots, nil
+}
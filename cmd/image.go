@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/image"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+const imageLong = "Images are read from local archives only: a `docker save` tarball or an\n" +
+	"OCI image layout, as a directory or tarball. Layers are applied in\n" +
+	"order, including whiteouts, and the merged filesystem is stored as a\n" +
+	"tree. Device nodes and fifos have no tree representation and are\n" +
+	"skipped with a warning."
+
+func newImageCmd(g *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Hash and compare container images",
+		Long:  "Hash and compare container images.\n\n" + imageLong,
+	}
+
+	cmd.AddCommand(
+		newImageHashCmd(g),
+		newImageDiffCmd(g),
+	)
+
+	return cmd
+}
+
+type imageHashOptions struct {
+	output         string
+	chunkThreshold int64
+}
+
+func addImageChunkFlag(cmd *cobra.Command, threshold *int64) {
+	cmd.Flags().Int64Var(threshold, "chunk-threshold", 0,
+		"store files of at least this many bytes as content-defined chunks, as hash does; changes their hashes (0 = never)")
+}
+
+func newImageHashCmd(g *globalOptions) *cobra.Command {
+	o := &imageHashOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "hash <image>",
+		Short: "Compute the merged filesystem hash of an image",
+		Long:  "Compute the merged filesystem hash of an image.\n\n" + imageLong,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImageHash(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	addImageChunkFlag(cmd, &o.chunkThreshold)
+
+	return cmd
+}
+
+type imageHashJSON struct {
+	Hash    string   `json:"hash"`
+	Layers  int      `json:"layers"`
+	Skipped []string `json:"skipped"`
+}
+
+func runImageHash(cmd *cobra.Command, g *globalOptions, o *imageHashOptions, p string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	res, err := loadImage(cmd, s, p, image.Options{ChunkThreshold: o.chunkThreshold})
+	if err != nil {
+		return err
+	}
+
+	if o.output == outputJSON {
+		skipped := res.Skipped
+		if skipped == nil {
+			skipped = []string{}
+		}
+		return writeJSON(cmd.OutOrStdout(), imageHashJSON{Hash: res.Root.String(), Layers: res.Layers, Skipped: skipped})
+	}
+
+	if _, err := fmt.Fprintln(cmd.OutOrStdout(), res.Root); err != nil {
+		return fmt.Errorf("write hash: %w", err)
+	}
+	return nil
+}
+
+type imageDiffOptions struct {
+	diffOptions
+	chunkThreshold int64
+}
+
+func newImageDiffCmd(g *globalOptions) *cobra.Command {
+	o := &imageDiffOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff <old-image> <new-image>",
+		Short: "Show file-level changes between two images",
+		Long:  "Show file-level changes between two images.\n\n" + imageLong,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImageDiff(cmd, g, o, args[0], args[1])
+		},
+	}
+
+	o.addFlags(cmd)
+	o.addPatchFlag(cmd)
+	addImageChunkFlag(cmd, &o.chunkThreshold)
+
+	return cmd
+}
+
+func runImageDiff(cmd *cobra.Command, g *globalOptions, o *imageDiffOptions, oldPath, newPath string) (err error) {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	opts := image.Options{ChunkThreshold: o.chunkThreshold}
+	oldRes, err := loadImage(cmd, s, oldPath, opts)
+	if err != nil {
+		return err
+	}
+	newRes, err := loadImage(cmd, s, newPath, opts)
+	if err != nil {
+		return err
+	}
+
+	diffOpts, err := o.diffOptions.diffOptions(g)
+	if err != nil {
+		return err
+	}
+	res, err := smerkle.Diff(s, oldRes.Root, newRes.Root, diffOpts)
+	if err != nil {
+		return err //nolint:wrapcheck // diff errors already carry context
+	}
+
+	return o.writeResult(cmd, s, res)
+}
+
+// loadImage loads the image at p and warns about entries it had to skip.
+func loadImage(cmd *cobra.Command, s *smerkle.Store, p string, opts image.Options) (*image.Result, error) {
+	res, err := image.Load(s, p, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("load image %s: %w", p, err)
+	}
+	for _, skipped := range res.Skipped {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s: %s: entry skipped\n", p, skipped)
+	}
+	return res, nil
+}
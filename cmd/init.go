@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type initOptions struct {
+	settings []string
+}
+
+func newInitCmd(g *globalOptions) *cobra.Command {
+	o := &initOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create a store and record its settings",
+		Long: "Create a store and record its settings.\n\n" +
+			"Other commands create a store on first use; init fixes its hash\n" +
+			"algorithm (--hash-algorithm) and keeps --set settings in its config\n" +
+			"up front. See `smerkle config` for the settings.\n\n" +
+			"Unlike other commands, init doesn't look for a store in parent\n" +
+			"directories: without --store or $" + storeDirEnv + " it creates " + defaultStoreDir + " here.",
+		Example: `  smerkle init --hash-algorithm blake3 --set concurrency=4 --set ignore-filename=.gitignore`,
+		Args:    cobra.NoArgs,
+		// a new store goes here, not in a store found above
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			g.stderr = cmd.ErrOrStderr()
+			return resolveStoreDir(cmd, g, false)
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runInit(cmd, g, o)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&o.settings, "set", nil, "keep this key=value setting in the store; repeat for several")
+
+	return cmd
+}
+
+func runInit(cmd *cobra.Command, g *globalOptions, o *initOptions) (err error) {
+	settings := make([][2]string, 0, len(o.settings))
+	for _, kv := range o.settings {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("--set %q: want key=value", kv)
+		}
+		if err := validateSetting(key, value); err != nil {
+			return fmt.Errorf("--set: %w", err)
+		}
+		settings = append(settings, [2]string{key, value})
+	}
+
+	if _, ok, err := smerkle.ReadStoreConfig(g.storeDir); err != nil {
+		return fmt.Errorf("read store config: %w", err)
+	} else if ok {
+		return fmt.Errorf("store already initialized at %s; change settings with config set", g.storeDir)
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex())
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	for _, kv := range settings {
+		if err := s.SetSetting(kv[0], kv[1]); err != nil {
+			return fmt.Errorf("set %s: %w", kv[0], err)
+		}
+	}
+	if _, err := fmt.Fprintf(cmd.OutOrStdout(), "initialized %s store at %s\n", s.Algorithm(), g.storeDir); err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type lsFilesOptions struct {
+	output   string
+	long     bool
+	mode     bool
+	size     bool
+	hash     bool
+	globs    []string
+	nullTerm bool
+}
+
+type lsFileJSON struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+func newLsFilesCmd(g *globalOptions) *cobra.Command {
+	o := &lsFilesOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "ls-files <hash>",
+		Short: "List every file path in a stored tree",
+		Long: `List every file, symlink, and other non-directory entry under a stored
+tree, one slash-separated path per line, descending into subtrees. Unlike
+cat-tree, which prints one level, the listing is flat and meant for piping
+into scripts. Empty directories are not listed.
+
+A --glob pattern without a slash matches base names; one with a slash
+matches whole paths. Patterns use path.Match syntax, and a path is listed
+if it matches any of them.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLsFiles(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().BoolVarP(&o.long, "long", "l", false, "print the mode, size, and hash columns")
+	cmd.Flags().BoolVar(&o.mode, "mode", false, "print each entry's mode before its path")
+	cmd.Flags().BoolVar(&o.size, "size", false, "print each entry's size before its path")
+	cmd.Flags().BoolVar(&o.hash, "hash", false, "print each entry's hash before its path")
+	cmd.Flags().StringArrayVar(&o.globs, "glob", nil, "only list paths matching this pattern; repeat to match any of several")
+	cmd.Flags().BoolVarP(&o.nullTerm, "null", "z", false, "end each line with NUL instead of newline, for paths holding newlines")
+
+	return cmd
+}
+
+func runLsFiles(cmd *cobra.Command, g *globalOptions, o *lsFilesOptions, arg string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	for _, pattern := range o.globs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("--glob %q: %w", pattern, err)
+		}
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	h, err := resolveHashArg(s, arg)
+	if err != nil {
+		return err
+	}
+
+	if o.output == outputJSON {
+		files := []lsFileJSON{}
+		err := lsFiles(cmd.Context(), s, h, "", o.globs, func(p string, e *object.Entry) error {
+			files = append(files, lsFileJSON{Path: p, Mode: e.Mode.String(), Size: e.Size, Hash: e.Hash.String()})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeJSON(cmd.OutOrStdout(), files)
+	}
+
+	w := bufio.NewWriter(cmd.OutOrStdout())
+	err = lsFiles(cmd.Context(), s, h, "", o.globs, func(p string, e *object.Entry) error {
+		return o.writeLine(w, p, e)
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write listing: %w", err)
+	}
+	return nil
+}
+
+// writeLine prints p with the columns o asks for, tab-separated.
+func (o *lsFilesOptions) writeLine(w io.Writer, p string, e *object.Entry) error {
+	var b strings.Builder
+	if o.long || o.mode {
+		fmt.Fprintf(&b, "%s\t", e.Mode)
+	}
+	if o.long || o.size {
+		fmt.Fprintf(&b, "%d\t", e.Size)
+	}
+	if o.long || o.hash {
+		fmt.Fprintf(&b, "%s\t", e.Hash)
+	}
+	b.WriteString(p)
+	if o.nullTerm {
+		b.WriteByte(0)
+	} else {
+		b.WriteByte('\n')
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write entry: %w", err)
+	}
+	return nil
+}
+
+// lsFiles calls fn for every non-directory entry under tree h whose path
+// matches one of globs, or every entry if there are none, in tree order.
+func lsFiles(ctx context.Context, s *smerkle.Store, h object.Hash, prefix string, globs []string, fn func(p string, e *object.Entry) error) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context: %w", err)
+	}
+	tree, err := s.GetTree(h)
+	if err != nil {
+		return fmt.Errorf("get tree %s: %w", h, err)
+	}
+	for i := range tree.Entries {
+		e := &tree.Entries[i]
+		p := e.Name
+		if prefix != "" {
+			p = prefix + "/" + e.Name
+		}
+		if e.Mode == object.ModeDirectory {
+			if err := lsFiles(ctx, s, e.Hash, p, globs, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if matchGlobs(globs, p) {
+			if err := fn(p, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchGlobs reports whether p matches any of globs, which were validated
+// up front; patterns without a slash match p's base name.
+func matchGlobs(globs []string, p string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, pattern := range globs {
+		name := p
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(p)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
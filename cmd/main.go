@@ -1,7 +1,41 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+)
 
 func main() {
-	fmt.Println("Hello, World!")
+	if err := newRootCmd().Execute(); err != nil {
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			if exitErr.err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Error:", exitErr.err)
+			}
+			os.Exit(exitErr.code)
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// exitError ends a successful run with a non-zero status and no message,
+// for commands whose exit code carries the answer (e.g. cmp). With err set
+// it is a failure reported under a code other than 1, which such a command
+// may reserve for an answer.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sourceDateEpochEnv is the reproducible-builds variable exports fall back
+// to when --mtime is not given.
+const sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// resolveMtime returns the fixed timestamp for an export: flag if set, else
+// SOURCE_DATE_EPOCH, else the zero time, meaning now. flag is @<unix
+// seconds> or RFC 3339.
+func resolveMtime(flag string) (time.Time, error) {
+	if flag == "" {
+		epoch, ok := os.LookupEnv(sourceDateEpochEnv)
+		if !ok || epoch == "" {
+			return time.Time{}, nil
+		}
+		secs, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s %q: want unix seconds", sourceDateEpochEnv, epoch)
+		}
+		return time.Unix(secs, 0).UTC(), nil
+	}
+
+	if rest, ok := strings.CutPrefix(flag, "@"); ok {
+		secs, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid --mtime %q: want @<unix seconds>", flag)
+		}
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, flag)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --mtime %q: want @<unix seconds> or RFC 3339", flag)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+const (
+	outputText  = report.Text
+	outputJSON  = report.JSON
+	outputJSONL = report.JSONL
+)
+
+func validateOutput(format string) error {
+	switch format {
+	case outputText, outputJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q (want %s or %s)", format, outputText, outputJSON)
+	}
+}
+
+// validateReportOutput accepts the formats of commands that print a walk
+// result or a diff, which report.New also covers.
+func validateReportOutput(format string) error {
+	if !slices.Contains(report.Formats(), format) {
+		return fmt.Errorf("unknown output format %q (want %s)", format, strings.Join(report.Formats(), ", "))
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	return report.WriteJSON(w, v) //nolint:wrapcheck // report errors already carry context
+}
+
+// writeDiff prints r to w in format, one of report.Formats.
+func writeDiff(w io.Writer, format string, r *smerkle.DiffResult) error {
+	rw, err := report.New(format, w, nil)
+	if err != nil {
+		return err //nolint:wrapcheck // the format error names the format
+	}
+	return rw.WriteDiff(r) //nolint:wrapcheck // report errors already carry context
+}
+
+// streamChanges returns a diff OnChange printing each change as a jsonl
+// record as soon as it is found, with paths made relative by rel if it is
+// non-nil. writeDiff then only adds the truncated record.
+func streamChanges(w io.Writer, rel *relativePaths) func(smerkle.Change) error {
+	jw := &report.JSONLWriter{Out: w}
+	return func(c smerkle.Change) error {
+		if rel != nil {
+			rel.change(&c)
+		}
+		return jw.WriteChange(&c) //nolint:wrapcheck // report errors already carry context
+	}
+}
+
+// writeStat prints the summary of res in format, text or json.
+func writeStat(w io.Writer, format string, res *smerkle.DiffResult) error {
+	if format == outputJSON {
+		return writeJSON(w, report.NewStatJSON(res))
+	}
+	return report.WriteStatText(w, res.Stat()) //nolint:wrapcheck // report errors already carry context
+}
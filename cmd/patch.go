@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/textdiff"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// writePatch prints res as a unified diff of file contents. Directories
+// appear only through their files; a recursive diff lists those too.
+func writePatch(w io.Writer, s *smerkle.Store, res *smerkle.DiffResult) error {
+	for i := range res.Changes {
+		c := &res.Changes[i]
+		var b strings.Builder
+		if err := patchChange(&b, s, c); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return fmt.Errorf("write patch: %w", err)
+		}
+	}
+	return nil
+}
+
+func patchChange(b *strings.Builder, s *smerkle.Store, c *smerkle.Change) error {
+	oldEntry, newEntry := fileEntry(c.OldEntry), fileEntry(c.NewEntry)
+	if oldEntry == nil && newEntry == nil {
+		return nil
+	}
+
+	oldName, newName := "a/"+c.Path, "b/"+c.Path
+	if c.Type == smerkle.ChangeCopied {
+		oldName = "a/" + c.Source
+	}
+	fmt.Fprintf(b, "diff %s %s\n", oldName, newName)
+
+	switch {
+	case c.Type == smerkle.ChangeCopied:
+		// identical content by definition
+		fmt.Fprintf(b, "copy from %s\ncopy to %s\n", c.Source, c.Path)
+		return nil
+	case oldEntry == nil:
+		fmt.Fprintf(b, "new file mode %s\n", newEntry.Mode)
+		oldName = "/dev/null"
+	case newEntry == nil:
+		fmt.Fprintf(b, "deleted file mode %s\n", oldEntry.Mode)
+		newName = "/dev/null"
+	case oldEntry.Mode != newEntry.Mode:
+		fmt.Fprintf(b, "old mode %s\nnew mode %s\n", oldEntry.Mode, newEntry.Mode)
+	}
+
+	if isInaccessible(oldEntry) || isInaccessible(newEntry) {
+		// placeholders have no content to compare
+		fmt.Fprintf(b, "Files %s and %s differ (inaccessible)\n", oldName, newName)
+		return nil
+	}
+
+	oldContent, newContent, err := changeContents(s, oldEntry, newEntry)
+	if err != nil {
+		return err
+	}
+	if textdiff.IsBinary(oldContent) || textdiff.IsBinary(newContent) {
+		fmt.Fprintf(b, "Binary files %s and %s differ\n", oldName, newName)
+		return nil
+	}
+	hunks := textdiff.Hunks(oldContent, newContent, textdiff.DefaultContext)
+	if len(hunks) == 0 {
+		return nil
+	}
+	fmt.Fprintf(b, "--- %s\n+++ %s\n", oldName, newName)
+	for i := range hunks {
+		h := &hunks[i]
+		// a path:line after the header lets editors jump to the change;
+		// patch and git apply ignore it as they do function context
+		fmt.Fprintf(b, "%s %s:%d\n", h.Header(), c.Path, hunkLine(h, newEntry == nil))
+		for _, line := range h.Lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return nil
+}
+
+// changeContents reads both sides of a file change; a missing side is empty.
+func changeContents(s *smerkle.Store, oldEntry, newEntry *object.Entry) (oldContent, newContent []byte, err error) {
+	if oldContent, err = entryContent(s, oldEntry); err != nil {
+		return nil, nil, err
+	}
+	if newContent, err = entryContent(s, newEntry); err != nil {
+		return nil, nil, err
+	}
+	return oldContent, newContent, nil
+}
+
+// hunkLine is the line a hunk's location points at: its first change in the
+// new file, or in the old one for a deleted file.
+func hunkLine(h *textdiff.Hunk, deleted bool) int {
+	if deleted {
+		return h.OldChange
+	}
+	return h.NewChange
+}
+
+// hunkJSON is one line of --jsonl-hunks output. Line is where an editor
+// should jump: the first changed line in the new file, or in the old one for
+// a deleted file.
+type hunkJSON struct {
+	Type     string   `json:"type"`
+	Path     string   `json:"path"`
+	Line     int      `json:"line"`
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Lines    []string `json:"lines"`
+}
+
+// writeHunks prints the hunks of res's text file changes, one JSON object
+// per line. Binary, inaccessible, and copied files have none.
+func writeHunks(w io.Writer, s *smerkle.Store, res *smerkle.DiffResult) error {
+	enc := json.NewEncoder(w)
+	for i := range res.Changes {
+		c := &res.Changes[i]
+		oldEntry, newEntry := fileEntry(c.OldEntry), fileEntry(c.NewEntry)
+		if (oldEntry == nil && newEntry == nil) || c.Type == smerkle.ChangeCopied ||
+			isInaccessible(oldEntry) || isInaccessible(newEntry) {
+			continue
+		}
+		oldContent, newContent, err := changeContents(s, oldEntry, newEntry)
+		if err != nil {
+			return err
+		}
+		if textdiff.IsBinary(oldContent) || textdiff.IsBinary(newContent) {
+			continue
+		}
+		for _, h := range textdiff.Hunks(oldContent, newContent, textdiff.DefaultContext) {
+			if err := enc.Encode(hunkJSON{
+				Type:     c.Type.String(),
+				Path:     c.Path,
+				Line:     hunkLine(&h, newEntry == nil),
+				OldStart: h.OldStart,
+				OldLines: h.OldLines,
+				NewStart: h.NewStart,
+				NewLines: h.NewLines,
+				Lines:    h.Lines,
+			}); err != nil {
+				return fmt.Errorf("write hunks: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// fileEntry returns e unless it is missing or a directory.
+func fileEntry(e *object.Entry) *object.Entry {
+	if e == nil || e.Mode == object.ModeDirectory {
+		return nil
+	}
+	return e
+}
+
+func isInaccessible(e *object.Entry) bool {
+	return e != nil && e.Mode == object.ModeInaccessible
+}
+
+func entryContent(s *smerkle.Store, e *object.Entry) ([]byte, error) {
+	if e == nil {
+		return nil, nil
+	}
+	content, err := s.ReadFile(e.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", e.Hash, err)
+	}
+	return content, nil
+}
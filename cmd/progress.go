@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+const (
+	progressAuto   = "auto"
+	progressAlways = "always"
+	progressNever  = "never"
+)
+
+// progressInterval is how often the progress line is redrawn; walks finish
+// files far faster than a terminal can usefully show them.
+const progressInterval = 100 * time.Millisecond
+
+// progressWidth keeps the line from wrapping on a standard terminal, which
+// would defeat redrawing it with a carriage return.
+const progressWidth = 79
+
+// wantProgress reports whether to show progress on w for the --progress
+// mode: always, never, or auto, when w is a terminal.
+func wantProgress(mode string, w io.Writer) (bool, error) {
+	switch mode {
+	case progressAlways:
+		return true, nil
+	case progressNever:
+		return false, nil
+	case progressAuto:
+		f, ok := w.(*os.File)
+		if !ok || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("unknown progress mode %q (want %s, %s, or %s)", mode, progressAuto, progressAlways, progressNever)
+	}
+}
+
+// progressLine redraws a one-line summary of a walk in place. Walk workers
+// only record the latest totals; a ticker draws them.
+type progressLine struct {
+	w io.Writer
+
+	mu    sync.Mutex
+	cur   smerkle.Progress
+	drawn bool // has anything been written that finish must clear?
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startProgress(w io.Writer) *progressLine {
+	p := &progressLine{w: w, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-t.C:
+				p.draw()
+			}
+		}
+	}()
+	return p
+}
+
+// update is the smerkle.WithProgress callback.
+func (p *progressLine) update(pr smerkle.Progress) {
+	p.mu.Lock()
+	p.cur = pr
+	p.mu.Unlock()
+}
+
+func (p *progressLine) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cur.Files == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(p.w, "\r%s\x1b[K", formatProgress(p.cur, progressWidth))
+	p.drawn = true
+}
+
+// finish stops redrawing and clears the line, so what the command prints
+// next starts on a clean one. A nil progressLine does nothing.
+func (p *progressLine) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	if p.drawn {
+		_, _ = io.WriteString(p.w, "\r\x1b[K")
+	}
+}
+
+// formatProgress renders pr in at most width bytes, shortening the path from
+// the left since its end says the most.
+func formatProgress(pr smerkle.Progress, width int) string {
+	line := fmt.Sprintf("%d files, %s", pr.Files, formatBytes(pr.Bytes))
+	room := width - len(line) - len(": ")
+	if pr.Path == "" || room < len("...")+1 {
+		return line
+	}
+	path := pr.Path
+	if len(path) > room {
+		path = "..." + path[len(path)-room+len("..."):]
+	}
+	return line + ": " + path
+}
+
+// formatBytes renders n with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
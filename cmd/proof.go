@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/proof"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// proofVersion is bumped whenever proofJSON changes incompatibly.
+const proofVersion = 1
+
+// verifyProofExitInvalid is the exit status when a proof doesn't hold; 1 is
+// left for errors.
+const verifyProofExitInvalid = 2
+
+// proofJSON is the proof file format. Trees and Manifest hold encoded
+// objects, base64 in JSON.
+type proofJSON struct {
+	Version   int      `json:"version"`
+	Algorithm string   `json:"algorithm"`
+	Root      string   `json:"root"`
+	Path      string   `json:"path"`
+	Trees     [][]byte `json:"trees"`
+	Manifest  []byte   `json:"manifest,omitempty"`
+}
+
+func newProveCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "prove <root> <path>",
+		Short: "Print a proof that a path is part of a root",
+		Long: "Print a proof that a path is part of a root.\n\n" +
+			"The proof holds the trees from <root> down to <path>, so\n" +
+			"verify-proof can check it with no store at all. <root> is a hash or\n" +
+			"the name of a ref; <path> is slash-separated and relative to it.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProve(cmd, g, args[0], args[1])
+		},
+	}
+}
+
+func runProve(cmd *cobra.Command, g *globalOptions, arg, p string) (err error) {
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	root, err := resolveHashArg(s, arg)
+	if err != nil {
+		return err
+	}
+	pr, err := proof.Prove(s, root, p)
+	if err != nil {
+		return fmt.Errorf("prove %s: %w", p, err)
+	}
+
+	return writeJSON(cmd.OutOrStdout(), newProofJSON(pr))
+}
+
+func newProofJSON(pr *proof.Proof) proofJSON {
+	return proofJSON{
+		Version:   proofVersion,
+		Algorithm: pr.Algorithm.String(),
+		Root:      pr.Root.String(),
+		Path:      pr.Path,
+		Trees:     pr.Trees,
+		Manifest:  pr.Manifest,
+	}
+}
+
+type verifyProofOptions struct {
+	output string
+	root   string
+	file   string
+}
+
+func newVerifyProofCmd() *cobra.Command {
+	o := &verifyProofOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "verify-proof <proof>",
+		Short: "Check a proof printed by prove",
+		Long: "Check a proof printed by prove, read from a file or - for stdin.\n\n" +
+			"No store is needed. A proof only shows its path is part of the root it\n" +
+			"names, so pass --root with a root obtained some other way. With --file,\n" +
+			"the file's content (or symlink target) must also match the proven\n" +
+			"entry. Exits 2 when the proof doesn't hold.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerifyProof(cmd, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().StringVar(&o.root, "root", "", "root hash the proof must be for")
+	cmd.Flags().StringVar(&o.file, "file", "", "local copy of the proven file to check")
+
+	return cmd
+}
+
+type verifyProofJSON struct {
+	Valid          bool   `json:"valid"`
+	Root           string `json:"root"`
+	Path           string `json:"path"`
+	Mode           string `json:"mode,omitempty"`
+	Hash           string `json:"hash,omitempty"`
+	ContentChecked bool   `json:"content_checked"`
+	Error          string `json:"error,omitempty"`
+}
+
+func runVerifyProof(cmd *cobra.Command, o *verifyProofOptions, arg string) error {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	var want object.Hash
+	if o.root != "" {
+		h, err := parseHashArg(o.root)
+		if err != nil {
+			return fmt.Errorf("--root: %w", err)
+		}
+		want = h
+	}
+
+	pr, err := readProof(cmd.InOrStdin(), arg)
+	if err != nil {
+		return err
+	}
+	var content []byte
+	if o.file != "" {
+		if content, err = readProvenFile(o.file); err != nil {
+			return err
+		}
+	}
+
+	out := verifyProofJSON{Root: pr.Root.String(), Path: pr.Path}
+	entry, verr := pr.Verify()
+	if verr == nil && !want.IsZero() && pr.Root != want {
+		verr = fmt.Errorf("proof is for root %s, not %s", pr.Root, want)
+	}
+	if verr == nil && content != nil {
+		verr = pr.VerifyContent(content)
+		out.ContentChecked = verr == nil
+	}
+	if verr != nil {
+		out.Error = verr.Error()
+	} else {
+		out.Valid = true
+		out.Mode = entry.Mode.String()
+		out.Hash = entry.Hash.String()
+	}
+
+	if err := writeVerifyProof(cmd.OutOrStdout(), o.output, &out); err != nil {
+		return err
+	}
+	if !out.Valid {
+		return &exitError{code: verifyProofExitInvalid}
+	}
+	return nil
+}
+
+// readProof decodes the proof file at p, or stdin for "-".
+func readProof(stdin io.Reader, p string) (*proof.Proof, error) {
+	var data []byte
+	var err error
+	if p == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(p) //nolint:gosec // the user names the proof file
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read proof: %w", err)
+	}
+
+	var in proofJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("parse proof: %w", err)
+	}
+	if in.Version != proofVersion {
+		return nil, fmt.Errorf("unsupported proof version %d (want %d)", in.Version, proofVersion)
+	}
+	alg, err := object.ParseAlgorithm(in.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("parse proof: %w", err)
+	}
+	root, err := object.ParseHash(in.Root)
+	if err != nil {
+		return nil, fmt.Errorf("parse proof root: %w", err)
+	}
+	return &proof.Proof{Algorithm: alg, Root: root, Path: in.Path, Trees: in.Trees, Manifest: in.Manifest}, nil
+}
+
+// readProvenFile returns the content the walker would have hashed for p.
+func readProvenFile(p string) ([]byte, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, fmt.Errorf("--file: %w", err)
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, fmt.Errorf("--file: %w", err)
+		}
+		return []byte(target), nil
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New("--file must be a regular file or symlink")
+	}
+	content, err := os.ReadFile(p) //nolint:gosec // the user names the file
+	if err != nil {
+		return nil, fmt.Errorf("--file: %w", err)
+	}
+	return content, nil
+}
+
+func writeVerifyProof(w io.Writer, format string, out *verifyProofJSON) error {
+	if format == outputJSON {
+		return writeJSON(w, out)
+	}
+
+	var err error
+	switch {
+	case !out.Valid:
+		_, err = fmt.Fprintf(w, "invalid: %s\n", out.Error)
+	case out.ContentChecked:
+		_, err = fmt.Fprintf(w, "ok %s (%s %s) is in %s, content matches\n", out.Path, out.Mode, out.Hash, out.Root)
+	default:
+		_, err = fmt.Fprintf(w, "ok %s (%s %s) is in %s\n", out.Path, out.Mode, out.Hash, out.Root)
+	}
+	if err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// newProvenance describes the environment and options that produced res by
+// walking root.
+func newProvenance(res *smerkle.WalkResult, root string, g *globalOptions, o *walkOptions) *object.Provenance {
+	p := &object.Provenance{
+		Root:        res.Hash,
+		Time:        time.Now(),
+		ToolVersion: version,
+		IgnoreHash:  res.IgnoreHash,
+		Settings: map[string]string{
+			"platform": runtime.GOOS + "/" + runtime.GOARCH,
+		},
+	}
+	if host, err := os.Hostname(); err == nil {
+		p.Hostname = host
+	}
+	if u, err := user.Current(); err == nil {
+		p.User = u.Username
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		p.Settings["path"] = abs
+	}
+	if len(g.ignoreFiles) > 0 {
+		p.Settings["ignore_files"] = strings.Join(g.ignoreFiles, string(os.PathListSeparator))
+	}
+	if g.ignoreFileName != smerkle.DefaultIgnoreFileName {
+		p.Settings["ignore_filename"] = g.ignoreFileName
+	}
+	if o.includeIgnoreFile {
+		p.Settings["include_ignore_file"] = "true"
+	}
+	if o.chunkThreshold > 0 {
+		p.Settings["chunk_threshold"] = strconv.FormatInt(o.chunkThreshold, 10)
+	}
+	if o.inaccessible {
+		p.Settings["record_inaccessible"] = "true"
+	}
+	if o.fullMetadata {
+		p.Settings["full_metadata"] = "true"
+	}
+	if o.hashMtimes {
+		p.Settings["hash_mtimes"] = "true"
+	}
+	if o.maxFileSize > 0 {
+		p.Settings["max_file_size"] = strconv.FormatInt(o.maxFileSize, 10)
+	}
+	if o.maxDepth > 0 {
+		p.Settings["max_depth"] = strconv.Itoa(o.maxDepth)
+	}
+	if o.maxFiles > 0 {
+		p.Settings["max_files"] = strconv.Itoa(o.maxFiles)
+	}
+	if symlinks, err := o.symlinkPolicy(); err == nil && symlinks != smerkle.SymlinkRecord {
+		p.Settings["symlinks"] = symlinks.String()
+	}
+	if o.fsSnapshot != "" {
+		p.Settings["fs_snapshot"] = o.fsSnapshot
+	}
+	if res.Partial() {
+		p.Settings["partial"] = "true"
+	}
+	return p
+}
+
+// warnIgnoreMismatch warns when two roots were hashed under different ignore
+// rules, since their diff then reflects rule changes rather than file changes.
+// Roots without recorded provenance are not compared.
+func warnIgnoreMismatch(w io.Writer, s *smerkle.Store, oldHash object.Hash, newIgnore object.Hash, newLabel string) {
+	if oldHash.IsZero() {
+		return
+	}
+	old, err := s.GetProvenance(oldHash)
+	if err != nil {
+		return
+	}
+	if old.IgnoreHash != newIgnore {
+		_, _ = fmt.Fprintf(w, "warning: %s was hashed with different ignore rules than %s; changes may reflect ignore rules rather than content\n",
+			oldHash, newLabel)
+	}
+}
+
+type provenanceOptions struct {
+	output string
+}
+
+func newProvenanceCmd(g *globalOptions) *cobra.Command {
+	o := &provenanceOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "provenance <hash>",
+		Short: "Show how a root hash was produced",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProvenance(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+type provenanceJSON struct {
+	Root        string            `json:"root"`
+	Time        time.Time         `json:"time"`
+	Hostname    string            `json:"hostname"`
+	User        string            `json:"user"`
+	ToolVersion string            `json:"tool_version"`
+	IgnoreHash  string            `json:"ignore_hash,omitempty"`
+	Settings    map[string]string `json:"settings,omitempty"`
+}
+
+func runProvenance(cmd *cobra.Command, g *globalOptions, o *provenanceOptions, arg string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	h, err := resolveHashArg(s, arg)
+	if err != nil {
+		return err
+	}
+
+	p, err := s.GetProvenance(h)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no provenance recorded for %s", h)
+	}
+	if err != nil {
+		return fmt.Errorf("get provenance %s: %w", h, err)
+	}
+
+	ignoreHash := ""
+	if !p.IgnoreHash.IsZero() {
+		ignoreHash = p.IgnoreHash.String()
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		return writeJSON(w, provenanceJSON{
+			Root:        p.Root.String(),
+			Time:        p.Time.UTC(),
+			Hostname:    p.Hostname,
+			User:        p.User,
+			ToolVersion: p.ToolVersion,
+			IgnoreHash:  ignoreHash,
+			Settings:    p.Settings,
+		})
+	}
+
+	if ignoreHash == "" {
+		ignoreHash = "(none)"
+	}
+	if _, err := fmt.Fprintf(w, "root:         %s\ntime:         %s\nhostname:     %s\nuser:         %s\ntool version: %s\nignore rules: %s\n",
+		p.Root, p.Time.UTC().Format(time.RFC3339), p.Hostname, p.User, p.ToolVersion, ignoreHash); err != nil {
+		return fmt.Errorf("write provenance: %w", err)
+	}
+	for _, k := range sortedKeys(p.Settings) {
+		if _, err := fmt.Fprintf(w, "%-13s %s\n", k+":", p.Settings[k]); err != nil {
+			return fmt.Errorf("write provenance: %w", err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type refsOptions struct {
+	output string
+}
+
+func newRefsCmd(g *globalOptions) *cobra.Command {
+	o := &refsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "refs",
+		Short: "List named refs",
+		Long: "List named refs.\n\n" +
+			"Refs name root hashes so they can be used in place of a hash, as in\n" +
+			"`smerkle diff baseline release/v2`. `smerkle hash --tag <name>` sets\n" +
+			"one after hashing.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runRefs(cmd, g, o)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	cmd.AddCommand(
+		newRefsSetCmd(g),
+		newRefsDeleteCmd(g),
+	)
+
+	return cmd
+}
+
+type refJSON struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+func runRefs(cmd *cobra.Command, g *globalOptions, o *refsOptions) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	refs, err := s.ListRefs()
+	if err != nil {
+		return err //nolint:wrapcheck // store errors already carry context
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		out := make([]refJSON, 0, len(refs))
+		for _, r := range refs {
+			out = append(out, refJSON{Name: r.Name, Hash: r.Hash.String()})
+		}
+		return writeJSON(w, out)
+	}
+
+	for _, r := range refs {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", r.Hash, r.Name); err != nil {
+			return fmt.Errorf("write ref: %w", err)
+		}
+	}
+	return nil
+}
+
+type refsSetOptions struct {
+	expect string
+}
+
+func newRefsSetCmd(g *globalOptions) *cobra.Command {
+	o := &refsSetOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "set <name> <hash|ref>",
+		Short: "Point a ref at a root",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runRefsSet(g, o, args[0], args[1])
+		},
+	}
+
+	addExpectFlag(cmd, &o.expect)
+
+	return cmd
+}
+
+func runRefsSet(g *globalOptions, o *refsSetOptions, name, target string) (err error) {
+	if err := validateExpect(o.expect); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	h, err := lookupHashArg(s, target)
+	if err != nil {
+		return err
+	}
+	if err := updateRef(s, name, h, o.expect); err != nil {
+		return fmt.Errorf("set ref: %w", err)
+	}
+	return nil
+}
+
+// addExpectFlag adds --expect, which turns a ref update into a
+// compare-and-swap so concurrent jobs can't overwrite each other's refs.
+func addExpectFlag(cmd *cobra.Command, expect *string) {
+	cmd.Flags().StringVar(expect, "expect", "",
+		"only update the ref if it points at this hash (all zeros: only if it doesn't exist)")
+}
+
+func validateExpect(expect string) error {
+	if expect == "" {
+		return nil
+	}
+	if _, err := object.ParseHash(expect); err != nil {
+		return fmt.Errorf("--expect: %w", err)
+	}
+	return nil
+}
+
+// updateRef points name at h, or with expect set, only if name holds it.
+func updateRef(s *smerkle.Store, name string, h object.Hash, expect string) error {
+	if expect == "" {
+		return s.SetRef(name, h) //nolint:wrapcheck // callers add context
+	}
+	old, err := object.ParseHash(expect)
+	if err != nil {
+		return fmt.Errorf("--expect: %w", err)
+	}
+	return s.CompareAndSwapRef(name, old, h) //nolint:wrapcheck // callers add context
+}
+
+func newRefsDeleteCmd(g *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a ref",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runRefsDelete(g, args[0])
+		},
+	}
+}
+
+func runRefsDelete(g *globalOptions, name string) (err error) {
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	if err := s.DeleteRef(name); err != nil {
+		return fmt.Errorf("delete ref: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+func addRelativeFlag(cmd *cobra.Command, relative *bool) {
+	cmd.Flags().BoolVar(relative, "relative", false,
+		"print paths relative to the current directory instead of to the walked directory")
+}
+
+// relativePaths rewrites slash-separated paths relative to a walked
+// directory as paths relative to the working directory, for --relative.
+type relativePaths struct {
+	root string // absolute
+	cwd  string // absolute
+}
+
+func newRelativePaths(root string) (*relativePaths, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("--relative: %w", err)
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", root, err)
+	}
+	return &relativePaths{root: absRoot, cwd: cwd}, nil
+}
+
+// path returns p relative to the working directory, keeping slashes so
+// output looks the same on every platform.
+func (r *relativePaths) path(p string) string {
+	abs := filepath.Join(r.root, filepath.FromSlash(p))
+	rel, err := filepath.Rel(r.cwd, abs)
+	if err != nil {
+		// only on Windows, for a root on another volume
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// changes rewrites the paths of res in place.
+func (r *relativePaths) changes(res *smerkle.DiffResult) {
+	for i := range res.Changes {
+		r.change(&res.Changes[i])
+	}
+}
+
+// change rewrites the paths of c in place.
+func (r *relativePaths) change(c *smerkle.Change) {
+	c.Path = r.path(c.Path)
+	if c.Source != "" {
+		c.Source = r.path(c.Source)
+	}
+}
+
+// relativeChanges applies --relative to changes found under root.
+func relativeChanges(relative bool, root string, res *smerkle.DiffResult) error {
+	if !relative {
+		return nil
+	}
+	r, err := newRelativePaths(root)
+	if err != nil {
+		return err
+	}
+	r.changes(res)
+	return nil
+}
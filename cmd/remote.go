@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/remote"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type transferOptions struct {
+	output string
+}
+
+func newPushCmd(g *globalOptions) *cobra.Command {
+	o := &transferOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "push <remote> <hash>",
+		Short: "Copy a tree and everything under it to another store",
+		Long: "Copy a tree and everything under it to another store.\n\n" +
+			"<remote> is the URL of a smerkle serve or the directory of a store,\n" +
+			"created if missing. <hash> is a hash or the name of a ref; a snapshot\n" +
+			"brings its history along. Only objects the remote lacks are sent, and\n" +
+			"an interrupted push picks up where it stopped.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTransfer(cmd, g, o, true, args[0], args[1])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+func newPullCmd(g *globalOptions) *cobra.Command {
+	o := &transferOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "pull <remote> <hash>",
+		Short: "Copy a tree and everything under it from another store",
+		Long: "Copy a tree and everything under it from another store.\n\n" +
+			"<remote> is the URL of a smerkle serve or the directory of a store.\n" +
+			"<hash> must be a full hash, since refs are not shared; a snapshot\n" +
+			"brings its history along. Only objects this store lacks are fetched,\n" +
+			"each checked against its hash.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTransfer(cmd, g, o, false, args[0], args[1])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+type transferJSON struct {
+	Hash    string `json:"hash"`
+	Objects int    `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+func runTransfer(cmd *cobra.Command, g *globalOptions, o *transferOptions, push bool, remoteArg, arg string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	var h object.Hash
+	if push {
+		h, err = lookupHashArg(s, arg)
+	} else {
+		h, err = parseHashArg(arg)
+	}
+	if err != nil {
+		return err
+	}
+
+	r, closeRemote, err := openRemote(remoteArg, s.Algorithm(), push)
+	if err != nil {
+		return err
+	}
+	defer closeRemote(&err)
+
+	verb, past := "push", "pushed"
+	var res *remote.Result
+	if push {
+		res, err = remote.Push(cmd.Context(), s, r, h)
+	} else {
+		verb, past = "pull", "pulled"
+		res, err = remote.Pull(cmd.Context(), s, r, h)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", verb, h, err)
+	}
+
+	if o.output == outputJSON {
+		return writeJSON(cmd.OutOrStdout(), transferJSON{Hash: h.String(), Objects: res.Objects, Bytes: res.Bytes})
+	}
+	if res.Objects == 0 {
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s is up to date\n", h)
+	} else {
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s %s: %d objects, %d bytes\n", past, h, res.Objects, res.Bytes)
+	}
+	if err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	return nil
+}
+
+// openRemote returns the remote named by arg: an http(s) URL, or the
+// directory of a store, which create allows to be new. The store is opened
+// with alg so a new one matches; closeRemote folds any close error into err.
+func openRemote(arg string, alg object.Algorithm, create bool) (r remote.Remote, closeRemote func(err *error), err error) {
+	if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+		return remote.NewClient(arg, nil), func(*error) {}, nil
+	}
+
+	if !create {
+		if _, err := os.Stat(arg); err != nil {
+			return nil, nil, fmt.Errorf("open remote: %w", err)
+		}
+	}
+	s, err := smerkle.Open(arg, smerkle.WithAlgorithm(alg), smerkle.WithLazyIndex())
+	if err != nil {
+		return nil, nil, fmt.Errorf("open remote %s: %w", arg, err)
+	}
+	return remote.NewLocal(s), func(err *error) {
+		if cerr := s.Close(); cerr != nil && *err == nil {
+			*err = fmt.Errorf("close remote %s: %w", arg, cerr)
+		}
+	}, nil
+}
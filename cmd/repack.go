@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+type repackOptions struct {
+	output string
+}
+
+func newRepackCmd(g *globalOptions) *cobra.Command {
+	o := &repackOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "repack",
+		Short: "Consolidate loose objects into a pack file",
+		Long: "Consolidate loose objects into a pack file.\n\n" +
+			"Every loose object is appended to a new pack under packs/ and removed\n" +
+			"once the pack and its index are on disk. Packed objects read like\n" +
+			"loose ones; new objects stay loose until the next repack.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runRepack(cmd, g, o)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+type repackJSON struct {
+	Pack    string `json:"pack,omitempty"`
+	Objects int    `json:"objects"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+func runRepack(cmd *cobra.Command, g *globalOptions, o *repackOptions) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	res, err := s.Repack()
+	if err != nil {
+		return fmt.Errorf("repack: %w", err)
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		return writeJSON(w, repackJSON{Pack: res.Pack, Objects: res.Objects, Bytes: res.Bytes})
+	}
+	if res.Objects == 0 {
+		_, err = fmt.Fprintln(w, "nothing to pack")
+	} else {
+		_, err = fmt.Fprintf(w, "packed %d objects (%d bytes) into %s\n", res.Objects, res.Bytes, res.Pack)
+	}
+	if err != nil {
+		return fmt.Errorf("write repack result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+const defaultStoreDir = ".smerkle"
+
+// storeDirEnv names the store when --store isn't given, ahead of discovery.
+const storeDirEnv = "SMERKLE_DIR"
+
+// version is set at build time via -ldflags "-X main.version=...".
+var version = "dev"
+
+type globalOptions struct {
+	storeDir         string
+	workRoot         string // directory holding a discovered store; empty for the working directory
+	ignoreFiles      []string
+	userIgnoreFile   string
+	ignoreFileName   string
+	strictIgnore     bool
+	hashAlgorithm    string
+	mtimeGranularity time.Duration
+	noLock           bool
+	lockWait         time.Duration
+	stderr           io.Writer // where openStore reports store warnings
+}
+
+func newRootCmd() *cobra.Command {
+	g := &globalOptions{}
+
+	cmd := &cobra.Command{
+		Use:           "smerkle",
+		Short:         "Content-addressable Merkle trees for directories",
+		Version:       version,
+		SilenceUsage:  true,
+		SilenceErrors: true, // main reports errors so exit codes stay under our control
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			g.stderr = cmd.ErrOrStderr()
+			if err := resolveStoreDir(cmd, g, true); err != nil {
+				return err
+			}
+			return applyStoreSettings(cmd, g)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&g.storeDir, "store", defaultStoreDir,
+		"path to the object store; defaults to $"+storeDirEnv+", else the nearest "+defaultStoreDir+" here or in a parent directory")
+	cmd.PersistentFlags().StringArrayVar(&g.ignoreFiles, "ignore-file", nil,
+		"ignore file to use instead of the one in <path>; repeat to layer files, later ones taking precedence")
+	userIgnore, _ := smerkle.UserIgnoreFile() // no config dir just means no user-level file
+	cmd.PersistentFlags().StringVar(&g.userIgnoreFile, "user-ignore-file", userIgnore,
+		"user-level ignore file applied beneath every tree's rules, if it exists; empty to skip it")
+	cmd.PersistentFlags().StringVar(&g.ignoreFileName, "ignore-filename", smerkle.DefaultIgnoreFileName,
+		"name of the per-tree ignore file")
+	cmd.PersistentFlags().BoolVar(&g.strictIgnore, "strict-ignore", false,
+		"fail instead of warning when an ignore pattern is invalid")
+	cmd.PersistentFlags().StringVar(&g.hashAlgorithm, "hash-algorithm", "",
+		"hash algorithm for a new store (sha256, blake3); existing stores keep the one they were created with")
+	cmd.PersistentFlags().DurationVar(&g.mtimeGranularity, "mtime-granularity", 0,
+		"compare cached modification times only to this precision, for coarse filesystems such as FAT (2s) or some NFS (1s); the store keeps the coarsest used")
+	cmd.PersistentFlags().DurationVar(&g.lockWait, "wait", 0,
+		"wait up to this long for another smerkle process to release the store instead of failing at once")
+	cmd.PersistentFlags().BoolVar(&g.noLock, "no-lock", false,
+		"don't lock the store; for filesystems without working locks, or to bypass a hung process")
+
+	cmd.AddCommand(
+		newInitCmd(g),
+		newConfigCmd(g),
+		newHashCmd(g),
+		newHashManyCmd(g),
+		newHashBlobCmd(g),
+		newStatusCmd(g),
+		newWhatifCmd(g),
+		newDiffCmd(g),
+		newCmpCmd(g),
+		newCompareCmd(g),
+		newCatTreeCmd(g),
+		newCatBlobCmd(g),
+		newLsFilesCmd(g),
+		newStatsCmd(g),
+		newProvenanceCmd(g),
+		newEnvCmd(g),
+		newGraphCmd(g),
+		newChurnCmd(g),
+		newImportGitCmd(g),
+		newExportGitCmd(g),
+		newImageCmd(g),
+		newArchiveCmd(g),
+		newCacheKeyCmd(g),
+		newGuardCmd(g),
+		newRefsCmd(g),
+		newCheckCmd(g),
+		newSnapshotCmd(g),
+		newLogCmd(g),
+		newRepackCmd(g),
+		newGCCmd(g),
+		newPinCmd(g),
+		newUnpinCmd(g),
+		newValidateCmd(g),
+		newRestoreCmd(g),
+		newEventsCmd(g),
+		newSpotCheckCmd(g),
+		newProveCmd(g),
+		newVerifyProofCmd(),
+		newPushCmd(g),
+		newPullCmd(g),
+		newBundleCmd(g),
+		newApplyBundleCmd(g),
+		newServeCmd(g),
+	)
+
+	return cmd
+}
+
+// resolveStoreDir picks the store when --store isn't given: $SMERKLE_DIR if
+// set, else with discover the nearest .smerkle in the working directory or
+// one of its parents, as git finds .git. A discovered store's parent
+// becomes the default walk root, so a command run from a subdirectory
+// still covers the whole tree. Failing both, the store is made here.
+func resolveStoreDir(cmd *cobra.Command, g *globalOptions, discover bool) error {
+	if cmd.Flags().Changed("store") {
+		return nil
+	}
+	if dir := os.Getenv(storeDirEnv); dir != "" {
+		g.storeDir = dir
+		return nil
+	}
+	if !discover {
+		return nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("find store: %w", err)
+	}
+	dir, ok, err := findStore(cwd)
+	if err != nil || !ok {
+		return err
+	}
+	// relative to the working directory, so a store found right here keeps
+	// the paths commands print unchanged
+	rel, err := filepath.Rel(cwd, dir)
+	if err != nil {
+		rel = dir
+	}
+	g.storeDir = rel
+	g.workRoot = filepath.Dir(rel)
+	return nil
+}
+
+// findStore returns the nearest defaultStoreDir directory in dir or one of
+// its parents; ok is false if there is none up to the filesystem root.
+func findStore(dir string) (path string, ok bool, err error) {
+	for {
+		path = filepath.Join(dir, defaultStoreDir)
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			return path, true, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", false, fmt.Errorf("find store: %w", err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false, nil
+		}
+		dir = parent
+	}
+}
+
+// walkRoot returns the directory a command walks: its argument if given,
+// else the work tree of a discovered store, else the working directory.
+func (g *globalOptions) walkRoot(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	if g.workRoot != "" {
+		return g.workRoot
+	}
+	return "."
+}
+
+// globalIgnoreFiles returns the user-level ignore file and the store's own,
+// those that exist, lowest precedence first. Both sit beneath the tree's
+// ignore file or --ignore-file, so a project can override either.
+func globalIgnoreFiles(g *globalOptions) ([]string, error) {
+	var files []string
+	for _, path := range []string{g.userIgnoreFile, smerkle.StoreIgnoreFile(g.storeDir)} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("stat ignore file: %w", err)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// openStore opens the store named by g, locked exclusively. Commands that
+// never consult the hash cache pass smerkle.WithLazyIndex so large indexes
+// aren't read for nothing, and smerkle.WithLock(smerkle.LockShared) since
+// they never write it either.
+func openStore(g *globalOptions, opts ...smerkle.StoreOption) (*smerkle.Store, error) {
+	opts = append([]smerkle.StoreOption{smerkle.WithLock(smerkle.LockExclusive)}, opts...)
+	if g.noLock {
+		opts = append(opts, smerkle.WithLock(smerkle.LockNone))
+	}
+	opts = append(opts, smerkle.WithLockWait(g.lockWait))
+	if g.hashAlgorithm != "" {
+		alg, err := object.ParseAlgorithm(g.hashAlgorithm)
+		if err != nil {
+			return nil, fmt.Errorf("--hash-algorithm: %w", err)
+		}
+		opts = append(opts, smerkle.WithAlgorithm(alg))
+	}
+	if g.mtimeGranularity > 0 {
+		opts = append(opts, smerkle.WithModTimeGranularity(g.mtimeGranularity))
+	}
+
+	s, err := smerkle.Open(g.storeDir, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	if g.stderr != nil {
+		for _, w := range s.Warnings() {
+			_, _ = fmt.Fprintln(g.stderr, "warning:", w)
+		}
+	}
+	return s, nil
+}
+
+// closeStore flushes s, folding any flush error into err.
+func closeStore(s *smerkle.Store, err *error) {
+	if cerr := s.Close(); cerr != nil && *err == nil {
+		*err = fmt.Errorf("close store: %w", cerr)
+	}
+}
+
+func parseHashArg(arg string) (object.Hash, error) {
+	h, err := object.ParseHash(arg)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("parse hash: %w", err)
+	}
+	return h, nil
+}
+
+// lookupHashArg parses arg as a hash, or else looks it up as a ref.
+func lookupHashArg(s *smerkle.Store, arg string) (object.Hash, error) {
+	if h, err := object.ParseHash(arg); err == nil {
+		return h, nil
+	}
+	h, err := s.GetRef(arg)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("resolve %s: %w", arg, err)
+	}
+	return h, nil
+}
+
+// resolveHashArg is lookupHashArg for commands that want a tree: a snapshot
+// resolves to its root, and <tree>:<path> to the entry at path inside the
+// tree, as in git.
+func resolveHashArg(s *smerkle.Store, arg string) (object.Hash, error) {
+	e, err := resolveEntryArg(s, arg)
+	if err != nil {
+		return object.ZeroHash, err
+	}
+	return e.Hash, nil
+}
+
+// resolveEntryArg is resolveHashArg returning the whole entry. Without a
+// path, arg is taken to name a tree.
+func resolveEntryArg(s *smerkle.Store, arg string) (object.Entry, error) {
+	rev, p, hasPath := strings.Cut(arg, ":")
+	h, err := lookupHashArg(s, rev)
+	if err != nil {
+		return object.Entry{}, err
+	}
+	if snap, err := s.GetSnapshot(h); err == nil {
+		h = snap.Root
+	}
+	if !hasPath {
+		return object.Entry{Mode: object.ModeDirectory, Hash: h}, nil
+	}
+	e, err := s.ResolvePath(h, p)
+	if err != nil {
+		return object.Entry{}, fmt.Errorf("resolve %s: %w", arg, err)
+	}
+	return e, nil
+}
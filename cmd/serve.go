@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/remote"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// shutdownTimeout bounds how long serve waits for requests in flight.
+const shutdownTimeout = 10 * time.Second
+
+// scheduledMessage is the message of the snapshots serve takes itself.
+const scheduledMessage = "scheduled by serve"
+
+type serveOptions struct {
+	walkOptions
+	listen    string
+	schedules []string
+}
+
+func newServeCmd(g *globalOptions) *cobra.Command {
+	o := &serveOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the store over HTTP for push, pull, and other services",
+		Long: "Serve the store over HTTP for push, pull, and other services.\n\n" +
+			"Besides the sync protocol push and pull use, serve answers a JSON API:\n\n" +
+			"  GET  /api/v1/objects/<hash>  the encoded object\n" +
+			"  PUT  /api/v1/objects/<hash>  store an encoded object, checked against <hash>\n" +
+			"  GET  /api/v1/trees/<tree>    a tree's entries, as cat-tree --output json\n" +
+			"  POST /api/v1/diff            {\"old\": ..., \"new\": ...}, as diff --output json\n" +
+			"  GET  /api/v1/prove?root=<tree>&path=<path>  a proof, as prove prints\n\n" +
+			"<tree>, old, and new may be refs or snapshots. A diff request may also\n" +
+			"set shallow, find_copies, and max_changes. Proofs let auditors check\n" +
+			"deployed files against a published root with verify-proof alone.\n\n" +
+			"Anyone who can reach the address can read and add objects, so listen\n" +
+			"on a trusted network or behind an authenticating proxy. Runs until\n" +
+			"interrupted.\n\n" +
+			"Each --schedule <ref>:<interval>[:<keep>]=<path> also snapshots <path>\n" +
+			"onto the history under <ref> at every multiple of <interval>, as\n" +
+			"snapshot --ref <ref> would with the walk flags given here, then keeps\n" +
+			"only the <keep> most recent snapshots of it (0 or unset = all). Serve\n" +
+			"never writes the index, so with --cache index these walks hash every\n" +
+			"file. Results and failures are reported on stderr.",
+		Example: `  smerkle serve --schedule etc:1h:24=/etc --schedule home:24h=/home`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runServe(cmd, g, o)
+		},
+	}
+
+	o.addFlags(cmd)
+	cmd.Flags().StringVar(&o.listen, "listen", "localhost:8080", "address to listen on")
+	cmd.Flags().StringArrayVar(&o.schedules, "schedule", nil,
+		"snapshot a path on a schedule, as <ref>:<interval>[:<keep>]=<path>; repeat for several")
+
+	return cmd
+}
+
+func runServe(cmd *cobra.Command, g *globalOptions, o *serveOptions) (err error) {
+	schedules := make([]schedule, len(o.schedules))
+	for i, spec := range o.schedules {
+		if schedules[i], err = parseSchedule(spec); err != nil {
+			return fmt.Errorf("--schedule: %w", err)
+		}
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// scheduled walks take their context from cmd
+	cmd.SetContext(ctx)
+
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", o.listen)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	remote.NewHandler(s).Register(mux)
+	(&apiHandler{s: s}).register(mux)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "serving %s on http://%s\n", g.storeDir, ln.Addr())
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	sr := &scheduler{cmd: cmd, g: g, o: o, s: s, w: cmd.ErrOrStderr()}
+	for _, sc := range schedules {
+		wg.Go(func() { sr.run(ctx, sc) })
+	}
+
+	select {
+	case err := <-errc:
+		stop()
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve: %w", err)
+	}
+	return nil
+}
+
+// schedule is a path serve snapshots on its own.
+type schedule struct {
+	ref   string
+	every time.Duration
+	keep  int // most recent snapshots kept; 0 keeps all
+	path  string
+}
+
+// parseSchedule parses a --schedule value, <ref>:<interval>[:<keep>]=<path>.
+// Ref names can't hold ':' or '=', so the path may.
+func parseSchedule(spec string) (schedule, error) {
+	head, path, ok := strings.Cut(spec, "=")
+	parts := strings.Split(head, ":")
+	if !ok || path == "" || len(parts) < 2 || len(parts) > 3 {
+		return schedule{}, fmt.Errorf("%q: want <ref>:<interval>[:<keep>]=<path>", spec)
+	}
+	sc := schedule{ref: parts[0], path: path}
+	if err := smerkle.ValidateRefName(sc.ref); err != nil {
+		return schedule{}, fmt.Errorf("%q: %w", spec, err)
+	}
+	every, err := time.ParseDuration(parts[1])
+	if err != nil || every <= 0 {
+		return schedule{}, fmt.Errorf("%q: interval %q isn't a positive duration", spec, parts[1])
+	}
+	sc.every = every
+	if len(parts) == 3 {
+		if sc.keep, err = strconv.Atoi(parts[2]); err != nil || sc.keep < 0 {
+			return schedule{}, fmt.Errorf("%q: keep %q isn't a count", spec, parts[2])
+		}
+	}
+	return sc, nil
+}
+
+// scheduler takes serve's scheduled snapshots.
+type scheduler struct {
+	cmd *cobra.Command
+	g   *globalOptions
+	o   *serveOptions
+	s   *smerkle.Store
+
+	mu sync.Mutex // guards w
+	w  io.Writer
+}
+
+// run snapshots sc.path at every multiple of sc.every, like cron, until ctx
+// is done. A failed snapshot is reported and the next one tried as usual.
+func (r *scheduler) run(ctx context.Context, sc schedule) {
+	for {
+		next := time.Now().Truncate(sc.every).Add(sc.every)
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		h, err := r.snapshot(sc)
+		r.mu.Lock()
+		if err != nil {
+			_, _ = fmt.Fprintf(r.w, "scheduled snapshot of %s onto %s: %v\n", sc.path, sc.ref, err)
+		} else {
+			_, _ = fmt.Fprintf(r.w, "snapshot %s of %s onto %s\n", h, sc.path, sc.ref)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// snapshot records sc.path on sc.ref as snapshot would, thins the
+// history to sc.keep, and returns the ref's new head.
+func (r *scheduler) snapshot(sc schedule) (object.Hash, error) {
+	parent, err := historyHead(r.s, sc.ref)
+	if err != nil {
+		return object.ZeroHash, err
+	}
+
+	var extra []smerkle.WalkOption
+	if r.o.cache == cacheIndex {
+		// a shared lock promises not to write the index
+		extra = append(extra, smerkle.WithCache(noCache{}))
+	}
+	res, err := r.o.walk(r.cmd, r.g, r.s, sc.path, extra...)
+	if err != nil {
+		return object.ZeroHash, err
+	}
+	r.mu.Lock()
+	report.WriteWarnings(r.w, res)
+	r.mu.Unlock()
+	if err := r.s.PutProvenance(newProvenance(res, sc.path, r.g, &r.o.walkOptions)); err != nil {
+		return object.ZeroHash, fmt.Errorf("record provenance: %w", err)
+	}
+
+	h, err := extendHistory(r.s, sc.ref, parent, res.Hash, scheduledMessage)
+	if err != nil || sc.keep == 0 {
+		return h, err
+	}
+	// cutting older snapshots rewrites the chain, the head included
+	if _, err := r.s.ThinHistory(sc.ref, smerkle.Retention{Last: sc.keep}); err != nil {
+		return object.ZeroHash, fmt.Errorf("thin history: %w", err)
+	}
+	h, err = r.s.GetRef(sc.ref)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("read %s: %w", sc.ref, err)
+	}
+	return h, nil
+}
+
+// noCache remembers no hashes, for walks that mustn't write the index.
+type noCache struct{}
+
+func (noCache) Lookup(string, string, os.FileInfo) (object.Hash, bool) {
+	return object.ZeroHash, false
+}
+
+func (noCache) Update(string, string, os.FileInfo, object.Hash) {}
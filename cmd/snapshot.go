@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// defaultHistoryRef is the ref snapshot and log use when --ref isn't given.
+const defaultHistoryRef = "HEAD"
+
+type snapshotOptions struct {
+	walkOptions
+	output  string
+	message string
+	ref     string
+}
+
+func newSnapshotCmd(g *globalOptions) *cobra.Command {
+	o := &snapshotOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "snapshot [path]",
+		Short: "Hash a directory and record it in a history",
+		Long: "Hash a directory and record it in a history.\n\n" +
+			"Each snapshot records the root tree, the time, an optional message and\n" +
+			"the snapshot --ref pointed at before, then moves --ref to the new one.\n" +
+			"Snapshots can be given anywhere a tree is expected, so\n" +
+			"`smerkle diff <snapshot> HEAD` compares two points in time.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := g.walkRoot(args)
+			return runSnapshot(cmd, g, o, root)
+		},
+	}
+
+	o.addFlags(cmd)
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().StringVarP(&o.message, "message", "m", "", "snapshot message")
+	cmd.Flags().StringVar(&o.ref, "ref", defaultHistoryRef, "ref holding the history to extend")
+
+	return cmd
+}
+
+type snapshotJSON struct {
+	Snapshot string `json:"snapshot"`
+	Root     string `json:"root"`
+	Parent   string `json:"parent,omitempty"`
+}
+
+func runSnapshot(cmd *cobra.Command, g *globalOptions, o *snapshotOptions, root string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	if err := smerkle.ValidateRefName(o.ref); err != nil {
+		return fmt.Errorf("--ref: %w", err)
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	parent, err := historyHead(s, o.ref)
+	if err != nil {
+		return err
+	}
+
+	res, err := o.walk(cmd, g, s, root)
+	if err != nil {
+		return err
+	}
+	report.WriteWarnings(cmd.ErrOrStderr(), res)
+	if err := s.PutProvenance(newProvenance(res, root, g, &o.walkOptions)); err != nil {
+		return fmt.Errorf("record provenance: %w", err)
+	}
+
+	h, err := extendHistory(s, o.ref, parent, res.Hash, o.message)
+	if err != nil {
+		return err
+	}
+
+	if o.output == outputJSON {
+		out := snapshotJSON{Snapshot: h.String(), Root: res.Hash.String()}
+		if !parent.IsZero() {
+			out.Parent = parent.String()
+		}
+		return writeJSON(cmd.OutOrStdout(), out)
+	}
+	if _, err := fmt.Fprintln(cmd.OutOrStdout(), h); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+// historyHead returns the snapshot ref points at, or the zero hash if ref
+// doesn't exist yet.
+func historyHead(s *smerkle.Store, ref string) (object.Hash, error) {
+	h, err := s.GetRef(ref)
+	if errors.Is(err, smerkle.ErrRefNotFound) {
+		return object.ZeroHash, nil
+	}
+	if err != nil {
+		return object.ZeroHash, err //nolint:wrapcheck // store errors already carry context
+	}
+	if _, err := s.GetSnapshot(h); err != nil {
+		return object.ZeroHash, fmt.Errorf("ref %s doesn't point at a snapshot: %w", ref, err)
+	}
+	return h, nil
+}
+
+// extendHistory records root as a snapshot after parent, read from ref by
+// historyHead before the walk, and moves ref to it.
+func extendHistory(s *smerkle.Store, ref string, parent, root object.Hash, message string) (object.Hash, error) {
+	h, err := s.PutSnapshot(&object.Snapshot{
+		Root:    root,
+		Parent:  parent,
+		Time:    time.Now(),
+		Message: message,
+	})
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("put snapshot: %w", err)
+	}
+	// another snapshot may have moved the ref since parent was read
+	if err := s.CompareAndSwapRef(ref, parent, h); err != nil {
+		return object.ZeroHash, fmt.Errorf("update %s: %w", ref, err)
+	}
+	return h, nil
+}
+
+type logOptions struct {
+	output   string
+	maxCount int
+}
+
+func newLogCmd(g *globalOptions) *cobra.Command {
+	o := &logOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "log [snapshot]",
+		Short: "Show snapshot history, newest first",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			start := defaultHistoryRef
+			if len(args) == 1 {
+				start = args[0]
+			}
+			return runLog(cmd, g, o, start)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().IntVarP(&o.maxCount, "max-count", "n", 0, "show at most this many snapshots (0 = all)")
+
+	return cmd
+}
+
+type logJSON struct {
+	Snapshot string    `json:"snapshot"`
+	Root     string    `json:"root"`
+	Parent   string    `json:"parent,omitempty"`
+	Time     time.Time `json:"time"`
+	Message  string    `json:"message,omitempty"`
+}
+
+func runLog(cmd *cobra.Command, g *globalOptions, o *logOptions, start string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	h, err := lookupHashArg(s, start)
+	if err != nil {
+		return err
+	}
+
+	var entries []logJSON
+	for !h.IsZero() && (o.maxCount <= 0 || len(entries) < o.maxCount) {
+		snap, err := s.GetSnapshot(h)
+		if err != nil {
+			return fmt.Errorf("get snapshot %s: %w", h, err)
+		}
+		e := logJSON{Snapshot: h.String(), Root: snap.Root.String(), Time: snap.Time, Message: snap.Message}
+		if !snap.Parent.IsZero() {
+			e.Parent = snap.Parent.String()
+		}
+		entries = append(entries, e)
+		h = snap.Parent
+	}
+
+	if o.output == outputJSON {
+		if entries == nil {
+			entries = []logJSON{}
+		}
+		return writeJSON(cmd.OutOrStdout(), entries)
+	}
+	return writeLog(cmd.OutOrStdout(), entries)
+}
+
+func writeLog(w io.Writer, entries []logJSON) error {
+	var b strings.Builder
+	for i, e := range entries {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "snapshot %s\nroot     %s\ndate     %s\n", e.Snapshot, e.Root, e.Time.Format(time.RFC3339))
+		if e.Message != "" {
+			b.WriteByte('\n')
+			for line := range strings.SplitSeq(e.Message, "\n") {
+				b.WriteString("    " + line + "\n")
+			}
+		}
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/spotcheck"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// spotCheckExitProblems is the exit status when a sampled file fails
+// verification; 1 is left for errors.
+const spotCheckExitProblems = 2
+
+type spotCheckOptions struct {
+	output   string
+	base     string
+	sample   string
+	seed     uint64
+	relative bool
+}
+
+func newSpotCheckCmd(g *globalOptions) *cobra.Command {
+	o := &spotCheckOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "spot-check [path]",
+		Short: "Reread a random sample of files and verify them against a stored root",
+		Long: "Reread a random sample of files and verify them against a stored root.\n\n" +
+			"Files are picked from the stored tree, read from disk, and hashed\n" +
+			"without writing to the store, so a small regular sample works as an\n" +
+			"integrity monitor for archives too large to rehash in full. The root\n" +
+			"is --base, or else the most recent complete walk recorded for path.\n" +
+			"--sample is a percentage such as 1% or a file count. The seed is\n" +
+			"printed so a run can be repeated with --seed. Exits 2 when a sampled\n" +
+			"file is missing, changed, or unreadable.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := g.walkRoot(args)
+			if !cmd.Flags().Changed("seed") {
+				o.seed = uint64(time.Now().UnixNano()) //nolint:gosec // any value is a valid seed
+			}
+			return runSpotCheck(cmd, g, o, root)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().StringVar(&o.base, "base", "", "tree hash or ref to verify against (default: the last walk of path)")
+	cmd.Flags().StringVar(&o.sample, "sample", "1%", "how many files to check, as a percentage or a count")
+	cmd.Flags().Uint64Var(&o.seed, "seed", 0, "random seed choosing the sample (default: random)")
+	addRelativeFlag(cmd, &o.relative)
+
+	return cmd
+}
+
+type spotCheckProblemJSON struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type spotCheckJSON struct {
+	Hash     string                 `json:"hash"`
+	Seed     uint64                 `json:"seed"`
+	Files    int                    `json:"files"`
+	Sampled  []string               `json:"sampled"`
+	Problems []spotCheckProblemJSON `json:"problems"`
+}
+
+func runSpotCheck(cmd *cobra.Command, g *globalOptions, o *spotCheckOptions, root string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	opts, err := parseSample(o.sample)
+	if err != nil {
+		return err
+	}
+	opts.Seed = o.seed
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", root, err)
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	var h object.Hash
+	if o.base != "" {
+		h, err = resolveHashArg(s, o.base)
+	} else {
+		h, err = lastWalk(s, absRoot)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := spotcheck.Check(cmd.Context(), s, h, absRoot, opts)
+	if err != nil {
+		return fmt.Errorf("spot-check %s: %w", root, err)
+	}
+
+	out := spotCheckJSON{
+		Hash:     h.String(),
+		Seed:     o.seed,
+		Files:    res.Files,
+		Sampled:  res.Sampled,
+		Problems: make([]spotCheckProblemJSON, 0, len(res.Problems)),
+	}
+	if out.Sampled == nil {
+		out.Sampled = []string{}
+	}
+	for _, p := range res.Problems {
+		out.Problems = append(out.Problems, spotCheckProblemJSON{Path: p.Path, Kind: string(p.Kind), Detail: p.Detail})
+	}
+	if o.relative {
+		rel, err := newRelativePaths(absRoot)
+		if err != nil {
+			return err
+		}
+		for i := range out.Sampled {
+			out.Sampled[i] = rel.path(out.Sampled[i])
+		}
+		for i := range out.Problems {
+			out.Problems[i].Path = rel.path(out.Problems[i].Path)
+		}
+	}
+	if err := writeSpotCheck(cmd, o.output, &out); err != nil {
+		return err
+	}
+
+	if len(out.Problems) > 0 {
+		return &exitError{code: spotCheckExitProblems}
+	}
+	return nil
+}
+
+// parseSample reads --sample as "N%" or a file count.
+func parseSample(v string) (spotcheck.Options, error) {
+	if pct, ok := strings.CutSuffix(v, "%"); ok {
+		f, err := strconv.ParseFloat(pct, 64)
+		if err != nil || f <= 0 || f > 100 {
+			return spotcheck.Options{}, fmt.Errorf("--sample %q: want a percentage in (0, 100]", v)
+		}
+		return spotcheck.Options{Fraction: f / 100}, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return spotcheck.Options{}, fmt.Errorf("--sample %q: want a percentage such as 1%% or a positive count", v)
+	}
+	return spotcheck.Options{Count: n}, nil
+}
+
+// lastWalk returns the root of the newest complete walk recorded for path.
+func lastWalk(s *smerkle.Store, path string) (object.Hash, error) {
+	records, err := s.ListProvenance()
+	if err != nil {
+		return object.ZeroHash, err //nolint:wrapcheck // store errors already carry context
+	}
+	for _, p := range slices.Backward(records) {
+		if p.Settings["path"] == path && p.Settings["partial"] != "true" {
+			return p.Root, nil
+		}
+	}
+	return object.ZeroHash, fmt.Errorf("no walk of %s is recorded; pass --base", path)
+}
+
+func writeSpotCheck(cmd *cobra.Command, format string, out *spotCheckJSON) error {
+	w := cmd.OutOrStdout()
+	if format == outputJSON {
+		return writeJSON(w, out)
+	}
+
+	for _, p := range out.Problems {
+		line := p.Kind + " " + p.Path
+		if p.Detail != "" {
+			line += ": " + p.Detail
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return fmt.Errorf("write problem: %w", err)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d of %d files checked against %s (seed %d), %d problems\n",
+		len(out.Sampled), out.Files, out.Hash, out.Seed, len(out.Problems))
+	if err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	return nil
+}
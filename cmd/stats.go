@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type statsOptions struct {
+	output     string
+	topChunks  int
+	topObjects int
+	fast       bool
+}
+
+// fastStatsShards is how many of the 256 shards stats --fast lists.
+const fastStatsShards = 16
+
+func newStatsCmd(g *globalOptions) *cobra.Command {
+	o := &statsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Print object store statistics",
+		Long: "Print object store statistics.\n\n" +
+			"Reports object counts and bytes, how evenly objects spread over the\n" +
+			"shard directories, the hash cache hits of the last walk, and a\n" +
+			"breakdown by object type with the largest objects.\n\n" +
+			"With --fast the object count and bytes are estimated from a sample of\n" +
+			"shard directories, and the type breakdown and chunk statistics, which\n" +
+			"read every object, are skipped.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runStats(cmd, g, o)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+	cmd.Flags().IntVar(&o.topChunks, "top-chunks", 5, "number of most shared chunks to list")
+	cmd.Flags().IntVar(&o.topObjects, "top-objects", 5, "number of largest objects to list")
+	cmd.Flags().BoolVar(&o.fast, "fast", false, "estimate the object count by sampling shards and skip chunk statistics")
+
+	return cmd
+}
+
+type statsJSON struct {
+	ObjectCount int                 `json:"object_count"`
+	ObjectBytes uint64              `json:"object_bytes"`
+	Estimated   bool                `json:"estimated"`
+	IndexSize   int                 `json:"index_size"`
+	Shards      shardsJSON          `json:"shards"`
+	Cache       *cacheJSON          `json:"cache,omitempty"`
+	Dedup       report.DedupJSON    `json:"dedup"`
+	Types       map[string]typeJSON `json:"types,omitempty"`
+	Largest     []objectSizeJSON    `json:"largest,omitempty"`
+	Chunks      *chunksJSON         `json:"chunks,omitempty"`
+}
+
+type shardsJSON struct {
+	Sampled int     `json:"sampled"`
+	Min     int     `json:"min"`
+	Max     int     `json:"max"`
+	Mean    float64 `json:"mean"`
+	Counts  []int   `json:"counts"`
+}
+
+type cacheJSON struct {
+	Hits    uint64    `json:"hits"`
+	Stale   uint64    `json:"stale"`
+	Misses  uint64    `json:"misses"`
+	HitRate float64   `json:"hit_rate"`
+	Time    time.Time `json:"time"`
+}
+
+type typeJSON struct {
+	Count int    `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
+type objectSizeJSON struct {
+	Hash string `json:"hash"`
+	Type string `json:"type"`
+	Size uint64 `json:"size"`
+}
+
+func newStatsJSON(stats *smerkle.Stats, objects *smerkle.ObjectStats, chunks *smerkle.ChunkStats) statsJSON {
+	least, most, mean := stats.ShardSpread()
+	out := statsJSON{
+		ObjectCount: stats.ObjectCount,
+		ObjectBytes: stats.ObjectBytes,
+		Estimated:   stats.Estimated(),
+		IndexSize:   stats.IndexSize,
+		Shards:      shardsJSON{Sampled: stats.SampledShards, Min: least, Max: most, Mean: mean, Counts: stats.Shards},
+		Dedup:       report.NewDedupJSON(stats.Dedup),
+	}
+	if stats.HasCache {
+		c := stats.Cache
+		out.Cache = &cacheJSON{Hits: c.Hits, Stale: c.Stale, Misses: c.Misses, HitRate: c.HitRate(), Time: c.Time}
+	}
+	if objects != nil {
+		out.Types = make(map[string]typeJSON, len(objects.Types))
+		for typ, t := range objects.Types {
+			out.Types[typ] = typeJSON{Count: t.Count, Bytes: t.Bytes}
+		}
+		out.Largest = make([]objectSizeJSON, 0, len(objects.Largest))
+		for _, o := range objects.Largest {
+			out.Largest = append(out.Largest, objectSizeJSON{Hash: o.Hash.String(), Type: o.Type, Size: o.Size})
+		}
+	}
+	if chunks != nil {
+		c := newChunksJSON(*chunks)
+		out.Chunks = &c
+	}
+	return out
+}
+
+type chunksJSON struct {
+	Manifests    int               `json:"manifests"`
+	Count        int               `json:"count"`
+	References   int               `json:"references"`
+	StoredBytes  uint64            `json:"stored_bytes"`
+	LogicalBytes uint64            `json:"logical_bytes"`
+	AvgSize      uint64            `json:"avg_size"`
+	DedupFactor  float64           `json:"dedup_factor"`
+	Top          []sharedChunkJSON `json:"top"`
+}
+
+type sharedChunkJSON struct {
+	Hash string `json:"hash"`
+	Size uint32 `json:"size"`
+	Refs int    `json:"refs"`
+}
+
+func newChunksJSON(c smerkle.ChunkStats) chunksJSON {
+	top := make([]sharedChunkJSON, 0, len(c.Top))
+	for _, sc := range c.Top {
+		top = append(top, sharedChunkJSON{Hash: sc.Hash.String(), Size: sc.Size, Refs: sc.Refs})
+	}
+	return chunksJSON{
+		Manifests:    c.Manifests,
+		Count:        c.Chunks,
+		References:   c.References,
+		StoredBytes:  c.StoredBytes,
+		LogicalBytes: c.LogicalBytes,
+		AvgSize:      c.AvgChunkSize(),
+		DedupFactor:  c.DedupFactor(),
+		Top:          top,
+	}
+}
+
+func runStats(cmd *cobra.Command, g *globalOptions, o *statsOptions) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	var (
+		stats   smerkle.Stats
+		objects *smerkle.ObjectStats
+		chunks  *smerkle.ChunkStats
+	)
+	if o.fast {
+		stats = s.FastStats(fastStatsShards)
+	} else {
+		stats = s.Stats()
+		os, err := s.ObjectStats(max(o.topObjects, 0))
+		if err != nil {
+			return fmt.Errorf("object stats: %w", err)
+		}
+		objects = &os
+		c, err := s.ChunkStats(max(o.topChunks, 0))
+		if err != nil {
+			return fmt.Errorf("chunk stats: %w", err)
+		}
+		chunks = &c
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		return writeJSON(w, newStatsJSON(&stats, objects, chunks))
+	}
+
+	if err := writeStatsText(w, &stats); err != nil {
+		return err
+	}
+	if err := report.WriteDedupText(w, stats.Dedup); err != nil {
+		return err
+	}
+	if objects != nil {
+		if err := writeObjectsText(w, *objects); err != nil {
+			return err
+		}
+	}
+	if chunks == nil {
+		return nil
+	}
+	return writeChunksText(w, *chunks)
+}
+
+func writeStatsText(w io.Writer, stats *smerkle.Stats) error {
+	var b strings.Builder
+	if stats.Estimated() {
+		fmt.Fprintf(&b, "objects: ~%d (estimated from %d of 256 shards)\nobject bytes: ~%d\n",
+			stats.ObjectCount, stats.SampledShards, stats.ObjectBytes)
+	} else {
+		fmt.Fprintf(&b, "objects: %d\nobject bytes: %d\n", stats.ObjectCount, stats.ObjectBytes)
+	}
+	fmt.Fprintf(&b, "index entries: %d\n", stats.IndexSize)
+	least, most, mean := stats.ShardSpread()
+	fmt.Fprintf(&b, "loose objects per shard: min %d, max %d, mean %.1f\n", least, most, mean)
+	if stats.HasCache {
+		c := stats.Cache
+		fmt.Fprintf(&b, "last walk cache: %d hits, %d stale, %d misses (%.1f%% hit rate) at %s\n",
+			c.Hits, c.Stale, c.Misses, 100*c.HitRate(), c.Time.Format(time.RFC3339))
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write stats: %w", err)
+	}
+	return nil
+}
+
+func writeObjectsText(w io.Writer, objects smerkle.ObjectStats) error {
+	var b strings.Builder
+	for _, typ := range slices.Sorted(maps.Keys(objects.Types)) {
+		t := objects.Types[typ]
+		fmt.Fprintf(&b, "%ss: %d (%d bytes)\n", typ, t.Count, t.Bytes)
+	}
+	if len(objects.Largest) > 0 {
+		b.WriteString("largest objects:\n")
+	}
+	for _, o := range objects.Largest {
+		fmt.Fprintf(&b, "  %s %s %d bytes\n", o.Hash, o.Type, o.Size)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write object stats: %w", err)
+	}
+	return nil
+}
+
+func writeChunksText(w io.Writer, c smerkle.ChunkStats) error {
+	if c.Manifests == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "chunked files: %d\nchunks: %d (%d references, avg %d bytes)\nchunk dedup factor: %.2fx\n",
+		c.Manifests, c.Chunks, c.References, c.AvgChunkSize(), c.DedupFactor())
+	if err != nil {
+		return fmt.Errorf("write chunk stats: %w", err)
+	}
+	for _, sc := range c.Top {
+		if _, err := fmt.Fprintf(w, "  %s %d bytes, %d refs\n", sc.Hash, sc.Size, sc.Refs); err != nil {
+			return fmt.Errorf("write chunk stats: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type statusOptions struct {
+	walkOptions
+	diffOptions
+	base string
+}
+
+func newStatusCmd(g *globalOptions) *cobra.Command {
+	o := &statusOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "status [path]",
+		Short: "Show changes in a directory relative to a stored tree",
+		Long: "Show changes in a directory relative to a stored tree.\n\n" +
+			"Without --base, the tree compared against is the baseline: the latest\n" +
+			"snapshot on " + defaultHistoryRef + ", recorded by `hash --update-baseline` or `snapshot`.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := g.walkRoot(args)
+			return o.exitStatus(runStatus(cmd, g, o, root))
+		},
+	}
+
+	o.walkOptions.addFlags(cmd)
+	o.diffOptions.addFlags(cmd)
+	o.diffOptions.addPatchFlag(cmd)
+	o.diffOptions.addExitCodeFlag(cmd)
+	cmd.Flags().StringVar(&o.base, "base", "", "tree hash or ref to compare against (default: the baseline on "+defaultHistoryRef+")")
+
+	return cmd
+}
+
+func runStatus(cmd *cobra.Command, g *globalOptions, o *statusOptions, root string) (err error) {
+	if err := o.diffOptions.validate(); err != nil {
+		return err
+	}
+
+	s, err := openStore(g)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	baseHash, err := statusBase(s, o.base)
+	if err != nil {
+		return err
+	}
+
+	res, err := o.walk(cmd, g, s, root)
+	if err != nil {
+		return err
+	}
+	report.WriteWarnings(cmd.ErrOrStderr(), res)
+	warnIgnoreMismatch(cmd.ErrOrStderr(), s, baseHash, res.IgnoreHash, "the working tree")
+
+	var rel *relativePaths
+	if o.relative {
+		if rel, err = newRelativePaths(root); err != nil {
+			return err
+		}
+	}
+	opts, err := o.diffOptions.diffOptions(g)
+	if err != nil {
+		return err
+	}
+	if o.streams() {
+		opts.OnChange = streamChanges(cmd.OutOrStdout(), rel)
+	}
+	changes, err := smerkle.Diff(s, baseHash, res.Hash, opts)
+	if err != nil {
+		return err //nolint:wrapcheck // diff errors already carry context
+	}
+	if rel != nil {
+		rel.changes(changes)
+	}
+
+	return o.diffOptions.writeResult(cmd, s, changes)
+}
+
+// statusBase resolves --base, or without it the baseline on
+// defaultHistoryRef.
+func statusBase(s *smerkle.Store, base string) (object.Hash, error) {
+	if base != "" {
+		return resolveHashArg(s, base)
+	}
+	if _, err := s.GetRef(defaultHistoryRef); errors.Is(err, smerkle.ErrRefNotFound) {
+		return object.ZeroHash, errors.New("no baseline: pass --base, or record one with hash --update-baseline")
+	}
+	return resolveHashArg(s, defaultHistoryRef)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+// validateExitInvalid is the exit status when some tree is out of order; 1
+// is left for errors.
+const validateExitInvalid = 2
+
+type validateOptions struct {
+	output string
+}
+
+func newValidateCmd(g *globalOptions) *cobra.Command {
+	o := &validateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "validate <root>",
+		Short: "Check that every tree under a root sorts its entries byte-wise",
+		Long: "Check that every tree under a root sorts its entries byte-wise.\n\n" +
+			"Tree entries must be ordered by comparing names as raw bytes, not by\n" +
+			"locale collation, or the same directory hashes differently across\n" +
+			"platforms. Trees written by other tools are not checked on import, so\n" +
+			"this flags any that break the rule, including duplicate names. Exits 2\n" +
+			"when a tree is out of order.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runValidate(cmd, g, o, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.output, "output", outputText, "output format (text, json)")
+
+	return cmd
+}
+
+type orderViolation struct {
+	Path  string `json:"path"`
+	Tree  string `json:"tree"`
+	Error string `json:"error"`
+}
+
+type validateJSON struct {
+	Trees      int              `json:"trees"`
+	Violations []orderViolation `json:"violations"`
+}
+
+func runValidate(cmd *cobra.Command, g *globalOptions, o *validateOptions, arg string) (err error) {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+
+	s, err := openStore(g, smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	h, err := resolveHashArg(s, arg)
+	if err != nil {
+		return err
+	}
+
+	res := validateJSON{Violations: []orderViolation{}}
+	seen := make(map[object.Hash]bool)
+	if err := validateTree(s, h, ".", seen, &res); err != nil {
+		return err
+	}
+
+	w := cmd.OutOrStdout()
+	if o.output == outputJSON {
+		if err := writeJSON(w, res); err != nil {
+			return err
+		}
+	} else {
+		for _, v := range res.Violations {
+			if _, err := fmt.Fprintf(w, "%s (%s): %s\n", v.Path, v.Tree, v.Error); err != nil {
+				return fmt.Errorf("write violation: %w", err)
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%d trees checked, %d out of order\n", res.Trees, len(res.Violations)); err != nil {
+			return fmt.Errorf("write summary: %w", err)
+		}
+	}
+
+	if len(res.Violations) > 0 {
+		return &exitError{code: validateExitInvalid}
+	}
+	return nil
+}
+
+// validateTree checks h and its subtrees, visiting each distinct tree once.
+func validateTree(s *smerkle.Store, h object.Hash, p string, seen map[object.Hash]bool, res *validateJSON) error {
+	if seen[h] {
+		return nil
+	}
+	seen[h] = true
+
+	tree, err := s.GetTree(h)
+	if err != nil {
+		return fmt.Errorf("get tree %s at %s: %w", h, p, err)
+	}
+	res.Trees++
+
+	if err := tree.CheckOrder(); err != nil {
+		res.Violations = append(res.Violations, orderViolation{Path: p, Tree: h.String(), Error: err.Error()})
+	}
+
+	for _, e := range tree.Entries {
+		if e.Mode != object.ModeDirectory {
+			continue
+		}
+		if err := validateTree(s, e.Hash, path.Join(p, e.Name), seen, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/report"
+	"github.com/garrettladley/smerkle/internal/treebuild"
+	"github.com/garrettladley/smerkle/pkg/smerkle"
+)
+
+type whatifOptions struct {
+	diffOptions
+	base  string
+	patch string
+}
+
+func newWhatifCmd(g *globalOptions) *cobra.Command {
+	o := &whatifOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "whatif --base <tree> --patch <file>",
+		Short: "Show the diff and root hash a set of file changes would produce",
+		Long: "Show the diff and root hash a set of file changes would produce.\n\n" +
+			"The changes are applied on top of the --base tree as it is stored; no\n" +
+			"directory on disk is read or modified, and nothing is stored: the\n" +
+			"changed files and trees are held in memory, so the printed root names\n" +
+			"no tree in the store. The patch file (- for stdin) is JSON of the form:\n\n" +
+			"  {\"changes\": [\n" +
+			"    {\"path\": \"src/main.go\", \"content\": \"package main\\n\"},\n" +
+			"    {\"path\": \"run.sh\", \"content\": \"#!/bin/sh\\n\", \"mode\": \"executable\"},\n" +
+			"    {\"path\": \"logo.png\", \"content_base64\": \"iVBORw0KGgo=\"},\n" +
+			"    {\"path\": \"current\", \"content\": \"v2\", \"mode\": \"symlink\"},\n" +
+			"    {\"path\": \"old\", \"delete\": true}\n" +
+			"  ]}\n\n" +
+			"mode is regular (the default), executable, or symlink, whose content\n" +
+			"is the link target. Changes apply in order, so a later one to the same\n" +
+			"path wins. Deleting a directory deletes everything below it.",
+		Example: `  smerkle whatif --base baseline --patch changes.json`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runWhatif(cmd, g, o)
+		},
+	}
+
+	o.diffOptions.addFlags(cmd)
+	// the root line has no place in the other formats
+	cmd.Flags().Lookup("output").Usage = "output format (text, json)"
+	cmd.Flags().StringVar(&o.base, "base", "", "tree hash or ref to apply the changes to")
+	cmd.Flags().StringVar(&o.patch, "patch", "", "JSON file describing the changes (- for stdin)")
+	_ = cmd.MarkFlagRequired("base")
+	_ = cmd.MarkFlagRequired("patch")
+
+	return cmd
+}
+
+type whatifJSON struct {
+	Root string `json:"root"`
+	report.DiffJSON
+}
+
+func runWhatif(cmd *cobra.Command, g *globalOptions, o *whatifOptions) (err error) {
+	if err := o.diffOptions.validate(); err != nil {
+		return err
+	}
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	if o.relative {
+		return errors.New("--relative needs a directory to be relative to; whatif compares stored trees")
+	}
+
+	patch, err := readPatch(cmd.InOrStdin(), o.patch)
+	if err != nil {
+		return err
+	}
+
+	// the preview's objects live in memory, so the store is only read
+	s, err := openStore(g, smerkle.WithScratch(), smerkle.WithLazyIndex(), smerkle.WithLock(smerkle.LockShared))
+	if err != nil {
+		return err
+	}
+	defer closeStore(s, &err)
+
+	baseHash, err := resolveHashArg(s, o.base)
+	if err != nil {
+		return err
+	}
+	b, err := treebuild.Load(s, baseHash)
+	if err != nil {
+		return fmt.Errorf("load base tree: %w", err)
+	}
+	for _, c := range patch {
+		if err := c.apply(s, b); err != nil {
+			return err
+		}
+	}
+	root, err := b.Write(s)
+	if err != nil {
+		return err //nolint:wrapcheck // treebuild errors already carry context
+	}
+
+	opts, err := o.diffOptions.diffOptions(g)
+	if err != nil {
+		return err
+	}
+	changes, err := smerkle.Diff(s, baseHash, root, opts)
+	if err != nil {
+		return err //nolint:wrapcheck // diff errors already carry context
+	}
+
+	w := cmd.OutOrStdout()
+	switch {
+	case o.filesFrom != "":
+		// the list must stay consumable by rsync and tar
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "root %s\n", root)
+	case o.output == outputJSON:
+		return writeJSON(w, whatifJSON{Root: root.String(), DiffJSON: report.NewDiffJSON(changes)})
+	default:
+		if _, err := fmt.Fprintf(w, "root %s\n", root); err != nil {
+			return fmt.Errorf("write root: %w", err)
+		}
+	}
+	return o.diffOptions.writeResult(cmd, s, changes)
+}
+
+type patchJSON struct {
+	Changes []patchChangeJSON `json:"changes"`
+}
+
+type patchChangeJSON struct {
+	Path          string  `json:"path"`
+	Content       *string `json:"content"`
+	ContentBase64 *string `json:"content_base64"`
+	Mode          string  `json:"mode"`
+	Delete        bool    `json:"delete"`
+}
+
+// whatifChange is a validated change from a patch file.
+type whatifChange struct {
+	path    string
+	content []byte
+	mode    object.Mode
+	delete  bool
+}
+
+// readPatch reads the patch file at p, or stdin for "-", and validates
+// every change in it.
+func readPatch(stdin io.Reader, p string) ([]whatifChange, error) {
+	r := stdin
+	if p != "-" {
+		f, err := os.Open(p) //nolint:gosec // the user names the patch
+		if err != nil {
+			return nil, fmt.Errorf("open patch: %w", err)
+		}
+		defer f.Close() //nolint:errcheck // read-only
+		r = f
+	}
+
+	var patch patchJSON
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		return nil, fmt.Errorf("parse patch: %w", err)
+	}
+
+	changes := make([]whatifChange, 0, len(patch.Changes))
+	for i, c := range patch.Changes {
+		pc, err := parseWhatifChange(c)
+		if err != nil {
+			return nil, fmt.Errorf("patch change %d: %w", i, err)
+		}
+		changes = append(changes, pc)
+	}
+	return changes, nil
+}
+
+func parseWhatifChange(c patchChangeJSON) (whatifChange, error) {
+	p := path.Clean(c.Path)
+	if c.Path == "" || p == "." || p == ".." || strings.HasPrefix(p, "../") || path.IsAbs(p) {
+		return whatifChange{}, fmt.Errorf("path %q is outside the root", c.Path)
+	}
+
+	hasContent := c.Content != nil || c.ContentBase64 != nil
+	if c.Delete {
+		if hasContent || c.Mode != "" {
+			return whatifChange{}, fmt.Errorf("%s: delete takes no content or mode", c.Path)
+		}
+		return whatifChange{path: p, delete: true}, nil
+	}
+
+	pc := whatifChange{path: p}
+	switch {
+	case c.Content != nil && c.ContentBase64 != nil:
+		return whatifChange{}, fmt.Errorf("%s: both content and content_base64 given", c.Path)
+	case c.Content != nil:
+		pc.content = []byte(*c.Content)
+	case c.ContentBase64 != nil:
+		b, err := base64.StdEncoding.DecodeString(*c.ContentBase64)
+		if err != nil {
+			return whatifChange{}, fmt.Errorf("%s: decode content_base64: %w", c.Path, err)
+		}
+		pc.content = b
+	default:
+		return whatifChange{}, fmt.Errorf("%s: content, content_base64, or delete required", c.Path)
+	}
+
+	switch c.Mode {
+	case "", "regular":
+		pc.mode = object.ModeRegular
+	case "executable":
+		pc.mode = object.ModeExecutable
+	case "symlink":
+		pc.mode = object.ModeSymlink
+	default:
+		return whatifChange{}, fmt.Errorf("%s: unknown mode %q (want regular, executable, or symlink)", c.Path, c.Mode)
+	}
+	return pc, nil
+}
+
+// apply makes the change in b, storing any new content in s.
+func (c *whatifChange) apply(s *smerkle.Store, b *treebuild.Builder) error {
+	if c.delete {
+		b.Remove(c.path)
+		return nil
+	}
+	h, err := s.PutBlob(&object.Blob{Content: c.content})
+	if err != nil {
+		return fmt.Errorf("put blob %s: %w", c.path, err)
+	}
+	b.Add(c.path, object.Entry{Mode: c.mode, Size: int64(len(c.content)), Hash: h})
+	return nil
+}
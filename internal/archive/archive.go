@@ -0,0 +1,124 @@
+// Package archive hashes the contents of archive files in place, so release
+// artifacts can be fingerprinted and diffed without extracting them.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/treebuild"
+)
+
+var (
+	ErrUnknownFormat = errors.New("archive: unrecognized archive format")
+	// 7z needs a decoder outside the standard library; extract those first.
+	ErrUnsupportedFormat = errors.New("archive: 7z archives are not supported")
+)
+
+var (
+	magicZip      = []byte("PK\x03\x04")
+	magicZipEmpty = []byte("PK\x05\x06")
+	magic7z       = []byte("7z\xbc\xaf\x27\x1c")
+)
+
+// Result describes a loaded archive.
+type Result struct {
+	Root    object.Hash
+	Skipped []string // entries with no tree representation, such as devices
+}
+
+// Load stores the contents of the archive at p and returns the root of the
+// resulting tree. The hash matches that of walking the extracted archive, as
+// long as the extraction kept symlinks and executable bits.
+func Load(s *store.Store, p string) (*Result, error) {
+	f, err := os.Open(p) //nolint:gosec // the user names the archive
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only
+
+	head := make([]byte, len(magic7z))
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, magicZip), bytes.HasPrefix(head, magicZipEmpty):
+		info, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("stat archive: %w", err)
+		}
+		return loadZip(s, f, info.Size())
+	case bytes.HasPrefix(head, magic7z):
+		return nil, ErrUnsupportedFormat
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func loadZip(s *store.Store, r io.ReaderAt, size int64) (*Result, error) {
+	zr, err := zip.NewReader(r, size)
+	// names with ".." or a leading "/" are confined to the root by treebuild
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return nil, fmt.Errorf("read zip: %w", err)
+	}
+
+	res := &Result{}
+	b := treebuild.New()
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			b.Mkdir(f.Name)
+		case mode.IsRegular(), mode&fs.ModeSymlink != 0:
+			e, err := zipEntry(s, f)
+			if err != nil {
+				return nil, err
+			}
+			b.Add(f.Name, e)
+		default:
+			res.Skipped = append(res.Skipped, f.Name)
+		}
+	}
+
+	res.Root, err = b.Write(s)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // treebuild errors already carry context
+	}
+	return res, nil
+}
+
+func zipEntry(s *store.Store, f *zip.File) (object.Entry, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return object.Entry{}, fmt.Errorf("open %s: %w", f.Name, err)
+	}
+	defer rc.Close() //nolint:errcheck // read-only
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return object.Entry{}, fmt.Errorf("read %s: %w", f.Name, err)
+	}
+	h, err := s.PutBlob(&object.Blob{Content: content})
+	if err != nil {
+		return object.Entry{}, fmt.Errorf("put blob %s: %w", f.Name, err)
+	}
+
+	mode := object.ModeRegular
+	switch {
+	case f.Mode()&fs.ModeSymlink != 0:
+		mode = object.ModeSymlink // the link target is stored as the content
+	case f.Mode()&0o111 != 0:
+		mode = object.ModeExecutable
+	}
+	return object.Entry{Mode: mode, Size: int64(len(content)), Hash: h}, nil
+}
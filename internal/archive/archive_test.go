@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+type zipMember struct {
+	name    string
+	mode    fs.FileMode
+	content string // file content or link target
+}
+
+var testMembers = []zipMember{
+	{name: "bin/", mode: fs.ModeDir | 0o755},
+	{name: "bin/run", mode: 0o755, content: "#!/bin/sh\n"},
+	{name: "docs/readme.txt", mode: 0o644, content: "hello\n"},
+	{name: "docs/latest", mode: fs.ModeSymlink | 0o777, content: "readme.txt"},
+	{name: "empty/", mode: fs.ModeDir | 0o755},
+}
+
+func writeZip(t *testing.T, members []zipMember) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "release.zip")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer f.Close() //nolint:errcheck // closed by zw
+
+	zw := zip.NewWriter(f)
+	for _, m := range members {
+		hdr := &zip.FileHeader{Name: m.name, Method: zip.Deflate}
+		hdr.SetMode(m.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("CreateHeader() error = %v", err)
+		}
+		if _, err := w.Write([]byte(m.content)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return p
+}
+
+// extract lays members out on disk the way unzip would.
+func extract(t *testing.T, members []zipMember) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, m := range members {
+		p := filepath.Join(root, filepath.FromSlash(m.name))
+		var err error
+		switch {
+		case m.mode.IsDir():
+			err = os.MkdirAll(p, 0o750)
+		case m.mode&fs.ModeSymlink != 0:
+			err = os.Symlink(m.content, p)
+		default:
+			if err = os.MkdirAll(filepath.Dir(p), 0o750); err == nil {
+				err = os.WriteFile(p, []byte(m.content), m.mode.Perm())
+			}
+		}
+		if err != nil {
+			t.Fatalf("extract %s: %v", m.name, err)
+		}
+	}
+	return root
+}
+
+func TestLoadMatchesWalk(t *testing.T) {
+	t.Parallel()
+
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	loaded, err := Load(s, writeZip(t, testMembers))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Skipped) != 0 {
+		t.Errorf("Skipped = %v, want none", loaded.Skipped)
+	}
+
+	walked, err := walker.Walk(context.Background(), extract(t, testMembers), s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	if loaded.Root != walked.Hash {
+		t.Errorf("Load() root = %s, want extracted walk %s", loaded.Root, walked.Hash)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{name: "7z", content: "7z\xbc\xaf\x27\x1c\x00\x04", wantErr: ErrUnsupportedFormat},
+		{name: "text", content: "not an archive", wantErr: ErrUnknownFormat},
+		{name: "empty", content: "", wantErr: ErrUnknownFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := store.Open(t.TempDir())
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer s.Close() //nolint:errcheck // Close() in a test
+
+			p := filepath.Join(t.TempDir(), "archive")
+			if err := os.WriteFile(p, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			if _, err := Load(s, p); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfinesPaths(t *testing.T) {
+	t.Parallel()
+
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	escaping, err := Load(s, writeZip(t, []zipMember{{name: "../../evil", mode: 0o644, content: "x"}}))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	plain, err := Load(s, writeZip(t, []zipMember{{name: "evil", mode: 0o644, content: "x"}}))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if escaping.Root != plain.Root {
+		t.Errorf("Load() root = %s, want %s with the path confined to the root", escaping.Root, plain.Root)
+	}
+}
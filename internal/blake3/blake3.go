@@ -0,0 +1,255 @@
+// Package blake3 implements the BLAKE3 hash with a 32-byte output, following
+// the reference implementation. Only unkeyed hashing is supported.
+package blake3
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	Size = 32
+
+	blockLen = 64
+	chunkLen = 1024
+
+	// subtrees at least this large are hashed on their own goroutine
+	parallelLen = 1 << 20
+)
+
+const (
+	flagChunkStart = 1 << 0
+	flagChunkEnd   = 1 << 1
+	flagParent     = 1 << 2
+	flagRoot       = 1 << 3
+)
+
+var iv = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+	0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+// schedule[r] lists the message words used by round r: the message
+// permutation applied r times.
+var schedule = [7][16]uint8{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8},
+	{3, 4, 10, 12, 13, 2, 7, 14, 6, 5, 9, 0, 11, 15, 8, 1},
+	{10, 7, 12, 9, 14, 3, 13, 15, 4, 0, 11, 2, 5, 8, 1, 6},
+	{12, 13, 9, 11, 15, 10, 14, 8, 7, 2, 5, 3, 0, 1, 6, 4},
+	{9, 14, 11, 5, 8, 12, 15, 1, 13, 3, 0, 10, 2, 6, 4, 7},
+	{11, 15, 5, 0, 1, 9, 8, 6, 14, 10, 2, 12, 3, 4, 7, 13},
+}
+
+func g(a, b, c, d, mx, my uint32) (uint32, uint32, uint32, uint32) {
+	a += b + mx
+	d = bits.RotateLeft32(d^a, -16)
+	c += d
+	b = bits.RotateLeft32(b^c, -12)
+	a += b + my
+	d = bits.RotateLeft32(d^a, -8)
+	c += d
+	b = bits.RotateLeft32(b^c, -7)
+	return a, b, c, d
+}
+
+// compress returns the first 8 words of the compression function output,
+// the only part a 32-byte hash needs.
+func compress(cv *[8]uint32, m *[16]uint32, counter uint64, n uint32, flags uint32) [8]uint32 {
+	v0, v1, v2, v3, v4, v5, v6, v7 := cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7]
+	v8, v9, v10, v11 := iv[0], iv[1], iv[2], iv[3]
+	v12, v13, v14, v15 := uint32(counter), uint32(counter>>32), n, flags
+
+	for r := range schedule {
+		sc := &schedule[r]
+		// columns
+		v0, v4, v8, v12 = g(v0, v4, v8, v12, m[sc[0]], m[sc[1]])
+		v1, v5, v9, v13 = g(v1, v5, v9, v13, m[sc[2]], m[sc[3]])
+		v2, v6, v10, v14 = g(v2, v6, v10, v14, m[sc[4]], m[sc[5]])
+		v3, v7, v11, v15 = g(v3, v7, v11, v15, m[sc[6]], m[sc[7]])
+		// diagonals
+		v0, v5, v10, v15 = g(v0, v5, v10, v15, m[sc[8]], m[sc[9]])
+		v1, v6, v11, v12 = g(v1, v6, v11, v12, m[sc[10]], m[sc[11]])
+		v2, v7, v8, v13 = g(v2, v7, v8, v13, m[sc[12]], m[sc[13]])
+		v3, v4, v9, v14 = g(v3, v4, v9, v14, m[sc[14]], m[sc[15]])
+	}
+
+	return [8]uint32{v0 ^ v8, v1 ^ v9, v2 ^ v10, v3 ^ v11, v4 ^ v12, v5 ^ v13, v6 ^ v14, v7 ^ v15}
+}
+
+// loadBlock reads up to blockLen bytes as message words, zero-padding a
+// short final block.
+func loadBlock(b []byte) [16]uint32 {
+	if len(b) < blockLen {
+		var padded [blockLen]byte
+		copy(padded[:], b)
+		b = padded[:]
+	}
+	var m [16]uint32
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return m
+}
+
+// output is a compression deferred until we know whether it is the root.
+type output struct {
+	cv      [8]uint32
+	block   [16]uint32
+	counter uint64
+	n       uint32
+	flags   uint32
+}
+
+func (o *output) chainingValue() [8]uint32 {
+	return compress(&o.cv, &o.block, o.counter, o.n, o.flags)
+}
+
+func (o *output) root() [Size]byte {
+	words := compress(&o.cv, &o.block, 0, o.n, o.flags|flagRoot)
+	var out [Size]byte
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(out[i*4:], w)
+	}
+	return out
+}
+
+// chunkOutput compresses all but the last block of a chunk of at most
+// chunkLen bytes.
+func chunkOutput(chunk []byte, counter uint64) output {
+	cv := iv
+	flags := uint32(flagChunkStart)
+	for len(chunk) > blockLen {
+		block := loadBlock(chunk[:blockLen])
+		cv = compress(&cv, &block, counter, blockLen, flags)
+		flags = 0
+		chunk = chunk[blockLen:]
+	}
+	return output{
+		cv:      cv,
+		block:   loadBlock(chunk),
+		counter: counter,
+		n:       uint32(len(chunk)), //nolint:gosec // at most blockLen
+		flags:   flags | flagChunkEnd,
+	}
+}
+
+func parentOutput(left, right [8]uint32) output {
+	var block [16]uint32
+	copy(block[:8], left[:])
+	copy(block[8:], right[:])
+	return output{cv: iv, block: block, n: blockLen, flags: flagParent}
+}
+
+// Sum256 returns the BLAKE3 hash of data. Subtrees of large inputs are
+// hashed concurrently.
+func Sum256(data []byte) [Size]byte {
+	out := subtreeOutput(data, 0)
+	return out.root()
+}
+
+// subtreeOutput hashes data as the subtree whose first chunk has the given
+// counter. The left subtree always holds the largest power of two whole
+// chunks that leaves some input for the right.
+func subtreeOutput(data []byte, counter uint64) output {
+	if len(data) <= chunkLen {
+		return chunkOutput(data, counter)
+	}
+
+	leftChunks := uint64(1) << (bits.Len64(uint64(len(data)-1)/chunkLen) - 1) //nolint:gosec // len(data) > chunkLen
+	left, right := data[:leftChunks*chunkLen], data[leftChunks*chunkLen:]
+
+	if len(left) < parallelLen {
+		return parentOutput(subtreeCV(left, counter), subtreeCV(right, counter+leftChunks))
+	}
+
+	leftCV := make(chan [8]uint32, 1)
+	go func() {
+		leftCV <- subtreeCV(left, counter)
+	}()
+	rightCV := subtreeCV(right, counter+leftChunks)
+	return parentOutput(<-leftCV, rightCV)
+}
+
+func subtreeCV(data []byte, counter uint64) [8]uint32 {
+	out := subtreeOutput(data, counter)
+	return out.chainingValue()
+}
+
+// maxDepth bounds the subtree stack: 2^54 chunks exceeds any input length.
+const maxDepth = 54
+
+// Hasher computes the same hash as Sum256 over input written in pieces,
+// holding one chunk and a stack of subtree chaining values instead of the
+// whole input. It implements hash.Hash.
+type Hasher struct {
+	buf    [chunkLen]byte // the chunk being filled
+	n      int
+	chunks uint64 // whole chunks pushed onto the stack
+	stack  [maxDepth][8]uint32
+	depth  int
+}
+
+var _ hash.Hash = (*Hasher)(nil)
+
+// New returns an empty Hasher.
+func New() *Hasher {
+	return &Hasher{}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		if h.n == chunkLen {
+			// more input follows, so the full chunk isn't the root
+			out := chunkOutput(h.buf[:], h.chunks)
+			h.push(out.chainingValue())
+			h.n = 0
+		}
+		k := copy(h.buf[h.n:], p)
+		h.n += k
+		p = p[k:]
+	}
+	return total, nil
+}
+
+// push adds a finished chunk's chaining value, first merging every subtree
+// it completes: one per trailing zero bit of the new chunk count.
+func (h *Hasher) push(cv [8]uint32) {
+	h.chunks++
+	for total := h.chunks; total&1 == 0; total >>= 1 {
+		h.depth--
+		out := parentOutput(h.stack[h.depth], cv)
+		cv = out.chainingValue()
+	}
+	h.stack[h.depth] = cv
+	h.depth++
+}
+
+// Sum256 returns the hash of everything written so far.
+func (h *Hasher) Sum256() [Size]byte {
+	out := chunkOutput(h.buf[:h.n], h.chunks)
+	for i := h.depth - 1; i >= 0; i-- {
+		out = parentOutput(h.stack[i], out.chainingValue())
+	}
+	return out.root()
+}
+
+// Sum appends the hash to b without changing the Hasher's state.
+func (h *Hasher) Sum(b []byte) []byte {
+	sum := h.Sum256()
+	return append(b, sum[:]...)
+}
+
+func (h *Hasher) Reset() {
+	*h = Hasher{}
+}
+
+func (h *Hasher) Size() int {
+	return Size
+}
+
+func (h *Hasher) BlockSize() int {
+	return blockLen
+}
@@ -0,0 +1,78 @@
+package blake3
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// vectors from the official BLAKE3 test_vectors.json, whose input is the
+// repeating byte sequence 0, 1, ..., 250
+func TestSum256Vectors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		inputLen int
+		want     string
+	}{
+		{0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{1, "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+		{1023, "10108970eeda3eb932baac1428c7a2163b0e924c9a9e25b35bba72b28f70bd11"},
+		{1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+		{1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{2048, "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+		{2049, "5f4d72f40d7a5f82b15ca2b2e44b1de3c2ef86c426c95c1af0b6879522563030"},
+		{3072, "b98cb0ff3623be03326b373de6b9095218513e64f1ee2edd2525c7ad1e5cffd2"},
+		{3073, "7124b49501012f81cc7f11ca069ec9226cecb8a2c850cfe644e327d22d3e1cd3"},
+		{4096, "015094013f57a5277b59d8475c0501042c0b642e531b0a1c8f58d2163229e969"},
+		{4097, "9b4052b38f1c5fc8b1f9ff7ac7b27cd242487b3d890d15c96a1c25b8aa0fb995"},
+		{5120, "9cadc15fed8b5d854562b26a9536d9707cadeda9b143978f319ab34230535833"},
+		{8192, "aae792484c8efe4f19e2ca7d371d8c467ffb10748d8a5a1ae579948f718a2a63"},
+		{31744, "62b6960e1a44bcc1eb1a611a8d6235b6b4b78f32e7abc4fb4c6cdcce94895c47"},
+		{102400, "bc3e3d41a1146b069abffad3c0d44860cf664390afce4d9661f7902e7943e085"},
+	}
+
+	for _, tt := range tests {
+		input := make([]byte, tt.inputLen)
+		for i := range input {
+			input[i] = byte(i % 251)
+		}
+		sum := Sum256(input)
+		if got := hex.EncodeToString(sum[:]); got != tt.want {
+			t.Errorf("Sum256(%d bytes) = %s, want %s", tt.inputLen, got, tt.want)
+		}
+	}
+}
+
+func TestSum256String(t *testing.T) {
+	t.Parallel()
+
+	sum := Sum256([]byte("abc"))
+	if got, want := hex.EncodeToString(sum[:]), "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"; got != want {
+		t.Errorf("Sum256(abc) = %s, want %s", got, want)
+	}
+}
+
+func TestHasherMatchesSum256(t *testing.T) {
+	t.Parallel()
+
+	// lengths around chunk and subtree boundaries, written in uneven pieces
+	for _, n := range []int{0, 1, 1023, 1024, 1025, 2048, 3073, 4096, 8193, 65536, 102400, 1<<20 + 7} {
+		input := make([]byte, n)
+		for i := range input {
+			input[i] = byte(i % 251)
+		}
+		want := Sum256(input)
+
+		for _, piece := range []int{1, 63, 1024, 4099, n + 1} {
+			h := New()
+			for rest := input; len(rest) > 0; {
+				k := min(piece, len(rest))
+				_, _ = h.Write(rest[:k])
+				rest = rest[k:]
+			}
+			if got := h.Sum256(); got != want {
+				t.Errorf("Hasher over %d bytes in pieces of %d = %x, want %x", n, piece, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package chunk splits content at content-defined boundaries (FastCDC), so
+// an edit to a large file only changes the chunks around it.
+//
+// The sizes, masks and gear table below are part of the hash format: changing
+// any of them changes the hash of every chunked file.
+package chunk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	MinSize = 256 << 10
+	AvgSize = 1 << 20
+	MaxSize = 4 << 20
+)
+
+// normalized chunking: cuts are harder to find before AvgSize and easier
+// after it, which narrows the chunk size distribution around AvgSize
+const (
+	maskS = uint64(1<<22-1) << (64 - 22) // 2 bits more than log2(AvgSize)
+	maskL = uint64(1<<18-1) << (64 - 18) // 2 bits fewer
+)
+
+// gear maps each byte to a fixed pseudo-random value.
+var gear = func() [256]uint64 {
+	var t [256]uint64
+	// splitmix64 with a fixed seed, so the table is stable across builds
+	x := uint64(0x736d65726b6c65) // "smerkle"
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		t[i] = z ^ z>>31
+	}
+	return t
+}()
+
+// Split returns the chunks of data, in order. The chunks alias data.
+func Split(data []byte) [][]byte {
+	chunks := make([][]byte, 0, len(data)/AvgSize+1)
+	for len(data) > 0 {
+		n := cut(data)
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+// Splitter returns the chunks Split would for content read from a stream,
+// buffering at most MaxSize bytes: enough to find any cut.
+type Splitter struct {
+	r          io.Reader
+	buf        []byte
+	start, end int   // the buffered, unreturned bytes
+	err        error // from r, once it has failed or ended
+}
+
+// NewSplitter returns a Splitter reading r.
+func NewSplitter(r io.Reader) *Splitter {
+	return &Splitter{r: r, buf: make([]byte, MaxSize)}
+}
+
+// Next returns the next chunk, valid until the following call, or io.EOF
+// after the last.
+func (s *Splitter) Next() ([]byte, error) {
+	if s.end-s.start < MaxSize && s.err == nil {
+		s.end = copy(s.buf, s.buf[s.start:s.end])
+		s.start = 0
+		n, err := io.ReadFull(s.r, s.buf[s.end:])
+		s.end += n
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			s.err = io.EOF
+		case err != nil:
+			s.err = fmt.Errorf("read: %w", err)
+		}
+	}
+	if s.err != nil && !errors.Is(s.err, io.EOF) {
+		return nil, s.err
+	}
+	if s.start == s.end {
+		return nil, io.EOF
+	}
+
+	n := cut(s.buf[s.start:s.end])
+	c := s.buf[s.start : s.start+n]
+	s.start += n
+	return c, nil
+}
+
+// cut returns the length of the first chunk of data.
+func cut(data []byte) int {
+	n := len(data)
+	if n <= MinSize {
+		return n
+	}
+	n = min(n, MaxSize)
+	normal := min(n, AvgSize)
+
+	var h uint64
+	i := MinSize
+	for ; i < normal; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
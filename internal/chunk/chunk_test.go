@@ -0,0 +1,119 @@
+package chunk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"testing"
+	"testing/iotest"
+)
+
+func randomBytes(seed uint64, n int) []byte {
+	r := rand.New(rand.NewPCG(seed, seed)) //nolint:gosec // deterministic test data
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.Uint32())
+	}
+	return b
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "below minimum", size: MinSize - 1},
+		{name: "several chunks", size: 12 * AvgSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := randomBytes(1, tt.size)
+			chunks := Split(data)
+
+			if !bytes.Equal(bytes.Join(chunks, nil), data) {
+				t.Fatal("chunks don't reassemble the input")
+			}
+			for i, c := range chunks {
+				if len(c) > MaxSize {
+					t.Errorf("chunk %d: len = %d, want <= %d", i, len(c), MaxSize)
+				}
+				if len(c) < MinSize && i != len(chunks)-1 {
+					t.Errorf("chunk %d: len = %d, want >= %d", i, len(c), MinSize)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	t.Parallel()
+
+	for _, size := range []int{0, MinSize - 1, MaxSize, MaxSize + 1, 12 * AvgSize} {
+		data := randomBytes(2, size)
+		want := Split(data)
+
+		sp := NewSplitter(iotest.HalfReader(bytes.NewReader(data)))
+		var got [][]byte
+		for {
+			c, err := sp.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			got = append(got, bytes.Clone(c))
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Splitter over %d bytes gave %d chunks, Split %d", size, len(got), len(want))
+		}
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Errorf("Splitter over %d bytes: chunk %d differs from Split", size, i)
+			}
+		}
+	}
+
+	sp := NewSplitter(iotest.ErrReader(iotest.ErrTimeout))
+	if _, err := sp.Next(); !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("Next() on a failing reader error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestSplitLocality(t *testing.T) {
+	t.Parallel()
+
+	data := randomBytes(2, 16*AvgSize)
+	before := Split(data)
+
+	// insert a few bytes in the middle; only nearby chunks should change
+	edited := make([]byte, 0, len(data)+3)
+	edited = append(edited, data[:len(data)/2]...)
+	edited = append(edited, "abc"...)
+	edited = append(edited, data[len(data)/2:]...)
+	after := Split(edited)
+
+	seen := make(map[string]bool, len(before))
+	for _, c := range before {
+		seen[string(c)] = true
+	}
+	changed := 0
+	for _, c := range after {
+		if !seen[string(c)] {
+			changed++
+		}
+	}
+	if len(before) < 8 {
+		t.Fatalf("len(chunks) = %d, want enough chunks to measure locality", len(before))
+	}
+	if changed > 2 {
+		t.Errorf("%d of %d chunks changed after a 3-byte insert, want at most 2", changed, len(after))
+	}
+}
@@ -0,0 +1,96 @@
+// Package churn aggregates diffs across a series of roots to show where a
+// tree changes most.
+package churn
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/garrettladley/smerkle/internal/diff"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// Count is a path and how many consecutive pairs of roots changed it.
+type Count struct {
+	Path    string
+	Changes int
+}
+
+type Report struct {
+	Roots        []object.Hash // the series, oldest first
+	Changes      int           // file-level changes across all pairs
+	BytesChurned int64         // content bytes added, rewritten, or removed
+	Paths        []Count       // most frequently changed first
+	Dirs         []Count       // changes per parent directory, most first
+}
+
+// Compute diffs each consecutive pair in roots. Directories added or removed
+// wholesale are counted through their files, not as entries of their own.
+func Compute(s *store.Store, roots []object.Hash) (*Report, error) {
+	r := &Report{Roots: roots}
+	paths := map[string]int{}
+	dirs := map[string]int{}
+
+	for i := 1; i < len(roots); i++ {
+		res, err := diff.Diff(s, roots[i-1], roots[i], diff.Options{Recursive: true})
+		if err != nil {
+			return nil, fmt.Errorf("diff %s..%s: %w", roots[i-1], roots[i], err)
+		}
+
+		for j := range res.Changes {
+			c := &res.Changes[j]
+			if isDirEntry(c) {
+				continue
+			}
+			r.Changes++
+			r.BytesChurned += churnedBytes(c)
+			paths[c.Path]++
+			dirs[path.Dir(c.Path)]++
+		}
+	}
+
+	r.Paths = sortedCounts(paths)
+	r.Dirs = sortedCounts(dirs)
+	return r, nil
+}
+
+// isDirEntry reports whether c is a directory appearing or disappearing; its
+// contents are reported as separate changes.
+func isDirEntry(c *diff.Change) bool {
+	switch c.Type {
+	case diff.ChangeAdded, diff.ChangeCopied:
+		return c.NewEntry.Mode == object.ModeDirectory
+	case diff.ChangeDeleted:
+		return c.OldEntry.Mode == object.ModeDirectory
+	case diff.ChangeModified, diff.ChangeTypeChange:
+		return false
+	default:
+		return false
+	}
+}
+
+// churnedBytes counts what a change cost: the new content for anything
+// written, the old content for deletions.
+func churnedBytes(c *diff.Change) int64 {
+	if c.Type == diff.ChangeDeleted {
+		return c.OldSize()
+	}
+	return c.NewSize()
+}
+
+func sortedCounts(m map[string]int) []Count {
+	counts := make([]Count, 0, len(m))
+	for p, n := range m {
+		counts = append(counts, Count{Path: p, Changes: n})
+	}
+	slices.SortFunc(counts, func(a, b Count) int {
+		if c := cmp.Compare(b.Changes, a.Changes); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return counts
+}
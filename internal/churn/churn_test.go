@@ -0,0 +1,105 @@
+package churn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+type file struct {
+	path    string // "name" or "dir/name"
+	content string
+}
+
+// putRoot stores a tree holding files, at most one directory deep.
+func putRoot(t *testing.T, s *store.Store, files ...file) object.Hash {
+	t.Helper()
+
+	var top []object.Entry
+	sub := map[string][]object.Entry{}
+	var subOrder []string
+	for _, f := range files {
+		h, err := s.PutBlob(&object.Blob{Content: []byte(f.content)})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		dir, name, nested := strings.Cut(f.path, "/")
+		if !nested {
+			dir, name = "", f.path
+		}
+		e := object.Entry{Name: name, Mode: object.ModeRegular, Size: int64(len(f.content)), Hash: h}
+		if dir == "" {
+			top = append(top, e)
+			continue
+		}
+		if _, ok := sub[dir]; !ok {
+			subOrder = append(subOrder, dir)
+		}
+		sub[dir] = append(sub[dir], e)
+	}
+	for _, dir := range subOrder {
+		h, err := s.PutTree(&object.Tree{Entries: sub[dir]})
+		if err != nil {
+			t.Fatalf("PutTree() error = %v", err)
+		}
+		top = append(top, object.Entry{Name: dir, Mode: object.ModeDirectory, Hash: h})
+	}
+	h, err := s.PutTree(&object.Tree{Entries: top})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	return h
+}
+
+func TestCompute(t *testing.T) {
+	t.Parallel()
+
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	roots := []object.Hash{
+		putRoot(t, s, file{"a", "1"}, file{"d/x", "x"}),
+		putRoot(t, s, file{"a", "22"}, file{"d/x", "x"}),
+		putRoot(t, s, file{"a", "333"}, file{"b", "new!"}, file{"d/x", "xx"}),
+		putRoot(t, s, file{"a", "333"}, file{"b", "new!"}),
+	}
+
+	r, err := Compute(s, roots)
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+
+	// a twice, b and d/x added/modified once, d/x deleted once
+	if r.Changes != 5 {
+		t.Errorf("Changes = %d, want 5", r.Changes)
+	}
+	// 2 + 3 (a) + 4 (b) + 2 (d/x rewritten) + 2 (d/x deleted)
+	if r.BytesChurned != 13 {
+		t.Errorf("BytesChurned = %d, want 13", r.BytesChurned)
+	}
+
+	wantPaths := []Count{{"a", 2}, {"d/x", 2}, {"b", 1}}
+	if len(r.Paths) != len(wantPaths) {
+		t.Fatalf("Paths = %v, want %v", r.Paths, wantPaths)
+	}
+	for i, want := range wantPaths {
+		if r.Paths[i] != want {
+			t.Errorf("Paths[%d] = %v, want %v", i, r.Paths[i], want)
+		}
+	}
+
+	wantDirs := []Count{{".", 3}, {"d", 2}}
+	if len(r.Dirs) != len(wantDirs) {
+		t.Fatalf("Dirs = %v, want %v", r.Dirs, wantDirs)
+	}
+	for i, want := range wantDirs {
+		if r.Dirs[i] != want {
+			t.Errorf("Dirs[%d] = %v, want %v", i, r.Dirs[i], want)
+		}
+	}
+}
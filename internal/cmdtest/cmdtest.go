@@ -0,0 +1,129 @@
+// Package cmdtest runs the smerkle cobra commands in-process against
+// temporary stores and compares their output with golden files, so flag and
+// format changes show up as test diffs instead of breaking scripts.
+package cmdtest
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// Env is a temporary work directory and store shared by a test's commands.
+type Env struct {
+	t       testing.TB
+	newRoot func() *cobra.Command
+
+	Dir   string // work directory for input trees
+	Store string // passed to every command as --store
+}
+
+// New returns an Env whose commands come from newRoot, called once per Run
+// so no flag state leaks between runs.
+func New(t testing.TB, newRoot func() *cobra.Command) *Env {
+	t.Helper()
+	return &Env{
+		t:       t,
+		newRoot: newRoot,
+		Dir:     t.TempDir(),
+		Store:   filepath.Join(t.TempDir(), "store"),
+	}
+}
+
+// WriteFile writes content to rel under Dir, creating parent directories.
+func (e *Env) WriteFile(rel, content string) {
+	e.t.Helper()
+	path := filepath.Join(e.Dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		e.t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		e.t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+// Remove deletes rel under Dir.
+func (e *Env) Remove(rel string) {
+	e.t.Helper()
+	if err := os.RemoveAll(filepath.Join(e.Dir, filepath.FromSlash(rel))); err != nil {
+		e.t.Fatalf("RemoveAll() error = %v", err)
+	}
+}
+
+// Path returns rel under Dir.
+func (e *Env) Path(rel string) string {
+	return filepath.Join(e.Dir, filepath.FromSlash(rel))
+}
+
+// Result is the output of one command.
+type Result struct {
+	Stdout string
+	Stderr string
+	Err    error // as returned by Execute; exit codes arrive as errors too
+}
+
+// Run executes the root command with args and --store, and without the
+// user-level ignore file unless args name one, with temp paths in
+// the output replaced by $DIR and $STORE.
+func (e *Env) Run(args ...string) Result {
+	e.t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	cmd := e.newRoot()
+	// the user-level ignore file would make results depend on the machine
+	cmd.SetArgs(append([]string{"--store", e.Store, "--user-ignore-file", ""}, args...))
+	cmd.SetIn(strings.NewReader(""))
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	err := cmd.ExecuteContext(context.Background())
+
+	return Result{Stdout: e.scrub(stdout.String()), Stderr: e.scrub(stderr.String()), Err: err}
+}
+
+// MustRun is Run that fails the test on a command error.
+func (e *Env) MustRun(args ...string) Result {
+	e.t.Helper()
+	res := e.Run(args...)
+	if res.Err != nil {
+		e.t.Fatalf("smerkle %s: %v\nstderr:\n%s", strings.Join(args, " "), res.Err, res.Stderr)
+	}
+	return res
+}
+
+func (e *Env) scrub(s string) string {
+	s = strings.ReplaceAll(s, e.Store, "$STORE")
+	return strings.ReplaceAll(s, e.Dir, "$DIR")
+}
+
+// Golden compares got with testdata/<name>.golden, rewriting the file
+// instead when the test runs with -update.
+func Golden(t testing.TB, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path) //nolint:gosec // golden files live in the test's testdata
+	if err != nil {
+		t.Fatalf("read golden file: %v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match %s (run with -update to accept it)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
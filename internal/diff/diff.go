@@ -1,9 +1,13 @@
 package diff
 
 import (
+	"errors"
 	"fmt"
 	"path"
+	"slices"
+	"strings"
 
+	"github.com/garrettladley/smerkle/internal/ignore"
 	"github.com/garrettladley/smerkle/internal/object"
 	"github.com/garrettladley/smerkle/internal/store"
 )
@@ -17,6 +21,7 @@ const (
 	ChangeDeleted                      // entry only in old tree
 	ChangeModified                     // same name, different hash
 	ChangeTypeChange                   // file <-> directory change
+	ChangeCopied                       // added entry whose content matches an unchanged entry
 )
 
 func (c ChangeType) String() string {
@@ -29,6 +34,8 @@ func (c ChangeType) String() string {
 		return "modified"
 	case ChangeTypeChange:
 		return "type_change"
+	case ChangeCopied:
+		return "copied"
 	default:
 		return "unknown"
 	}
@@ -39,14 +46,42 @@ type Change struct {
 	Path     string        // e.g., "internal/client/whoop/client.go"
 	OldEntry *object.Entry // nil for added
 	NewEntry *object.Entry // nil for deleted
+	Source   string        // path of the unchanged entry a copy was made from
 }
 
+// OldSize returns the size of the old entry, or 0 if there is none.
+func (c *Change) OldSize() int64 {
+	if c.OldEntry == nil {
+		return 0
+	}
+	return c.OldEntry.Size
+}
+
+// NewSize returns the size of the new entry, or 0 if there is none.
+func (c *Change) NewSize() int64 {
+	if c.NewEntry == nil {
+		return 0
+	}
+	return c.NewEntry.Size
+}
+
+// SizeDelta returns the change in bytes from the old entry to the new one.
+func (c *Change) SizeDelta() int64 {
+	return c.NewSize() - c.OldSize()
+}
+
+// Result holds the changes between two trees. Changes are always sorted by
+// path in byte-wise lexicographic order, regardless of Options.Concurrency,
+// so output is stable across runs and machines.
 type Result struct {
-	Changes []Change
+	Changes   []Change
+	Truncated bool // traversal stopped at Options.MaxChanges
+
+	n int // changes found, whether kept or passed to Options.OnChange
 }
 
 func (r *Result) HasChanges() bool {
-	return len(r.Changes) > 0
+	return len(r.Changes) > 0 || r.n > 0
 }
 
 func (r *Result) Added() []Change {
@@ -65,6 +100,10 @@ func (r *Result) TypeChanges() []Change {
 	return r.filterByType(ChangeTypeChange)
 }
 
+func (r *Result) Copied() []Change {
+	return r.filterByType(ChangeCopied)
+}
+
 func (r *Result) filterByType(t ChangeType) []Change {
 	var out []Change
 	for _, c := range r.Changes {
@@ -76,7 +115,89 @@ func (r *Result) filterByType(t ChangeType) []Change {
 }
 
 type Options struct {
-	Recursive bool // default: true
+	Recursive  bool // default: true
+	FindCopies bool // report added files matching an unchanged file as copies, unless truncated
+	MaxChanges int  // stop after this many changes; <= 0 means no limit
+
+	// Concurrency bounds how many changed subtrees are diffed in parallel.
+	// Values <= 1 diff sequentially.
+	Concurrency int
+
+	// PathFilter, if set, limits the diff to the slash-separated path and
+	// what lies below it. Only the trees on the way to it are read besides
+	// its own, so a small corner of two huge trees diffs quickly. Shallow
+	// diffs list the entries directly below it.
+	PathFilter string
+
+	// Ignorer, if set, drops changes to the paths it matches. An ignored
+	// directory is dropped with everything below it, unread.
+	Ignorer *ignore.Ignorer
+
+	// OnChange, if set, receives each change as it is found instead of it
+	// being kept in Result.Changes, so a huge diff never sits in memory
+	// whole. Calls never overlap. A sequential diff passes changes in tree
+	// order, as does a concurrent one, which differs from the sorted order
+	// of Result.Changes where a name continues past a directory's, as "a/b"
+	// comes before "a.txt". With FindCopies every change is collected first
+	// and passed on sorted once copies are known.
+	// An error from OnChange ends the diff with it.
+	OnChange func(Change) error
+
+	sem chan struct{} // worker slots beyond the calling goroutine
+}
+
+// errMaxChanges stops traversal once Options.MaxChanges is reached.
+var errMaxChanges = errors.New("diff: max changes reached")
+
+// add appends c, or reports errMaxChanges if the result is already full.
+// Changes outside opts.PathFilter, such as to the directories leading to
+// it, are dropped.
+func (r *Result) add(c Change, opts Options) error {
+	if !opts.inFilter(c.Path) {
+		return nil
+	}
+	if opts.MaxChanges > 0 && r.n >= opts.MaxChanges {
+		r.Truncated = true
+		return errMaxChanges
+	}
+	r.n++
+	if opts.OnChange != nil {
+		return opts.OnChange(c)
+	}
+	r.Changes = append(r.Changes, c)
+	return nil
+}
+
+// inFilter reports whether p is PathFilter or below it.
+func (o *Options) inFilter(p string) bool {
+	return o.PathFilter == "" || p == o.PathFilter || strings.HasPrefix(p, o.PathFilter+"/")
+}
+
+// leadsToFilter reports whether p is a directory above PathFilter, which
+// must be descended into whatever the other options say.
+func (o *Options) leadsToFilter(p string) bool {
+	return o.PathFilter != "" && strings.HasPrefix(o.PathFilter, p+"/")
+}
+
+// descend reports whether to diff below the directory at p. Shallow diffs
+// still descend into PathFilter itself to list the entries directly below.
+func (o *Options) descend(p string) bool {
+	return o.Recursive || o.leadsToFilter(p) || (o.PathFilter != "" && p == o.PathFilter)
+}
+
+// filterEntries drops the entries of the tree at prefix that neither lie in
+// PathFilter nor lead to it, and those Ignorer matches.
+func (o *Options) filterEntries(prefix string, entries []object.Entry) []object.Entry {
+	if o.PathFilter == "" && o.Ignorer == nil {
+		return entries
+	}
+	return slices.DeleteFunc(slices.Clone(entries), func(e object.Entry) bool {
+		p := joinPath(prefix, e.Name)
+		if !o.inFilter(p) && !o.leadsToFilter(p) {
+			return true
+		}
+		return o.Ignorer != nil && o.Ignorer.Match(p, e.Mode == object.ModeDirectory)
+	})
 }
 
 func DiffDefault(s *store.Store, oldHash, newHash object.Hash) (*Result, error) {
@@ -86,13 +207,134 @@ func DiffDefault(s *store.Store, oldHash, newHash object.Hash) (*Result, error)
 func Diff(s *store.Store, oldHash, newHash object.Hash, opts Options) (*Result, error) {
 	result := &Result{}
 
-	if err := diffTrees(s, oldHash, newHash, "", opts, result); err != nil {
+	if opts.PathFilter != "" {
+		if opts.PathFilter = path.Clean(opts.PathFilter); opts.PathFilter == "." {
+			opts.PathFilter = ""
+		}
+	}
+	if opts.Concurrency > 1 {
+		opts.sem = make(chan struct{}, opts.Concurrency-1)
+	}
+	// copies are only known once every change is
+	onChange := opts.OnChange
+	if opts.FindCopies {
+		opts.OnChange = nil
+	}
+
+	if err := diffTrees(s, oldHash, newHash, "", opts, result); err != nil && !errors.Is(err, errMaxChanges) {
 		return nil, err
 	}
 
+	// copies are only looked for once the diff is complete
+	if opts.FindCopies && !result.Truncated {
+		if err := detectCopies(s, oldHash, newHash, opts, result); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortStableFunc(result.Changes, func(a, b Change) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	if onChange != nil && opts.OnChange == nil {
+		for _, c := range result.Changes {
+			if err := onChange(c); err != nil {
+				return nil, err
+			}
+		}
+		result.Changes = nil
+	}
 	return result, nil
 }
 
+// detectCopies rewrites added files whose blob hash matches a file that exists
+// unchanged in the old tree. When several sources qualify, the first path in
+// tree order wins so output is deterministic.
+//
+// Sources come from comparing the trees again rather than from the changes
+// reported, which leave out what Shallow, PathFilter and Ignorer hide.
+func detectCopies(s *store.Store, oldHash, newHash object.Hash, opts Options, result *Result) error {
+	hasAdded := slices.ContainsFunc(result.Changes, func(c Change) bool {
+		return c.Type == ChangeAdded && c.NewEntry.Mode.IsFile()
+	})
+	if !hasAdded {
+		return nil
+	}
+
+	sources := make(map[object.Hash]string)
+	err := unchangedFiles(s, oldHash, newHash, "", opts, func(p string, e *object.Entry) {
+		if _, ok := sources[e.Hash]; !ok {
+			sources[e.Hash] = p
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range result.Changes {
+		c := &result.Changes[i]
+		if c.Type != ChangeAdded || !c.NewEntry.Mode.IsFile() {
+			continue
+		}
+		if src, ok := sources[c.NewEntry.Hash]; ok {
+			c.Type = ChangeCopied
+			c.Source = src
+		}
+	}
+
+	return nil
+}
+
+// unchangedFiles calls fn, in tree order, for every regular or executable
+// file the same in the trees at oldHash and newHash, found by descending
+// the two together through the directories they share. Like the diff, it
+// reads nothing outside PathFilter or dropped by Ignorer, and stays at the
+// top of a shallow diff.
+func unchangedFiles(s *store.Store, oldHash, newHash object.Hash, prefix string, opts Options, fn func(path string, e *object.Entry)) error {
+	oldTree, err := loadTree(s, oldHash)
+	if err != nil {
+		return err
+	}
+	newTree := oldTree
+	if newHash != oldHash {
+		if newTree, err = loadTree(s, newHash); err != nil {
+			return err
+		}
+	}
+	oldEntries := opts.filterEntries(prefix, oldTree.Entries)
+	newEntries := opts.filterEntries(prefix, newTree.Entries)
+	modTimes := oldTree.ModTimes && newTree.ModTimes
+
+	for oldIdx, newIdx := 0, 0; oldIdx < len(oldEntries) && newIdx < len(newEntries); {
+		oldEntry, newEntry := &oldEntries[oldIdx], &newEntries[newIdx]
+		switch {
+		case oldEntry.Name < newEntry.Name:
+			oldIdx++
+			continue
+		case oldEntry.Name > newEntry.Name:
+			newIdx++
+			continue
+		}
+		oldIdx++
+		newIdx++
+
+		fullPath := joinPath(prefix, oldEntry.Name)
+		switch {
+		case oldEntry.Mode == object.ModeDirectory && newEntry.Mode == object.ModeDirectory:
+			if opts.descend(fullPath) {
+				if err := unchangedFiles(s, oldEntry.Hash, newEntry.Hash, fullPath, opts, fn); err != nil {
+					return err
+				}
+			}
+		case oldEntry.Mode.IsFile() && newEntry.Mode.IsFile() && oldEntry.Hash == newEntry.Hash &&
+			!metadataChanged(oldEntry, newEntry, modTimes) && opts.inFilter(fullPath):
+			fn(fullPath, oldEntry)
+		}
+	}
+
+	return nil
+}
+
 func diffTrees(s *store.Store, oldHash, newHash object.Hash, prefix string, opts Options, result *Result) error {
 	if oldHash == newHash {
 		return nil
@@ -107,29 +349,46 @@ func diffTrees(s *store.Store, oldHash, newHash object.Hash, prefix string, opts
 	if err != nil {
 		return err
 	}
+	oldEntries := opts.filterEntries(prefix, oldTree.Entries)
+	newEntries := opts.filterEntries(prefix, newTree.Entries)
+	// timestamps only count when both trees stored them
+	modTimes := oldTree.ModTimes && newTree.ModTimes
+
+	// subtrees handed to other goroutines up front, by index in newEntries,
+	// and merged when the loop reaches them so changes keep tree order; always
+	// waited on before returning so no worker outlives the call that spawned
+	// it.
+	pending := spawnSubtrees(s, oldEntries, newEntries, prefix, modTimes, opts)
+	defer func() {
+		for _, job := range pending {
+			<-job.done
+		}
+	}()
 
 	oldIdx, newIdx := 0, 0
 
-	for oldIdx < len(oldTree.Entries) || newIdx < len(newTree.Entries) {
+	for oldIdx < len(oldEntries) || newIdx < len(newEntries) {
 		var oldEntry, newEntry *object.Entry
 
-		if oldIdx < len(oldTree.Entries) {
-			oldEntry = &oldTree.Entries[oldIdx]
+		if oldIdx < len(oldEntries) {
+			oldEntry = &oldEntries[oldIdx]
 		}
-		if newIdx < len(newTree.Entries) {
-			newEntry = &newTree.Entries[newIdx]
+		if newIdx < len(newEntries) {
+			newEntry = &newEntries[newIdx]
 		}
 
 		switch {
 		case oldEntry == nil:
 			fullPath := joinPath(prefix, newEntry.Name)
-			result.Changes = append(result.Changes, Change{
+			if err := result.add(Change{
 				Type:     ChangeAdded,
 				Path:     fullPath,
 				NewEntry: newEntry,
-			})
-			if opts.Recursive && newEntry.Mode == object.ModeDirectory {
-				if err := addAllEntries(s, newEntry.Hash, fullPath, ChangeAdded, result); err != nil {
+			}, opts); err != nil {
+				return err
+			}
+			if newEntry.Mode == object.ModeDirectory && opts.descend(fullPath) {
+				if err := addAllEntries(s, newEntry.Hash, fullPath, ChangeAdded, opts, result); err != nil {
 					return err
 				}
 			}
@@ -137,13 +396,15 @@ func diffTrees(s *store.Store, oldHash, newHash object.Hash, prefix string, opts
 
 		case newEntry == nil:
 			fullPath := joinPath(prefix, oldEntry.Name)
-			result.Changes = append(result.Changes, Change{
+			if err := result.add(Change{
 				Type:     ChangeDeleted,
 				Path:     fullPath,
 				OldEntry: oldEntry,
-			})
-			if opts.Recursive && oldEntry.Mode == object.ModeDirectory {
-				if err := addAllEntries(s, oldEntry.Hash, fullPath, ChangeDeleted, result); err != nil {
+			}, opts); err != nil {
+				return err
+			}
+			if oldEntry.Mode == object.ModeDirectory && opts.descend(fullPath) {
+				if err := addAllEntries(s, oldEntry.Hash, fullPath, ChangeDeleted, opts, result); err != nil {
 					return err
 				}
 			}
@@ -151,13 +412,15 @@ func diffTrees(s *store.Store, oldHash, newHash object.Hash, prefix string, opts
 
 		case oldEntry.Name < newEntry.Name:
 			fullPath := joinPath(prefix, oldEntry.Name)
-			result.Changes = append(result.Changes, Change{
+			if err := result.add(Change{
 				Type:     ChangeDeleted,
 				Path:     fullPath,
 				OldEntry: oldEntry,
-			})
-			if opts.Recursive && oldEntry.Mode == object.ModeDirectory {
-				if err := addAllEntries(s, oldEntry.Hash, fullPath, ChangeDeleted, result); err != nil {
+			}, opts); err != nil {
+				return err
+			}
+			if oldEntry.Mode == object.ModeDirectory && opts.descend(fullPath) {
+				if err := addAllEntries(s, oldEntry.Hash, fullPath, ChangeDeleted, opts, result); err != nil {
 					return err
 				}
 			}
@@ -165,20 +428,26 @@ func diffTrees(s *store.Store, oldHash, newHash object.Hash, prefix string, opts
 
 		case oldEntry.Name > newEntry.Name:
 			fullPath := joinPath(prefix, newEntry.Name)
-			result.Changes = append(result.Changes, Change{
+			if err := result.add(Change{
 				Type:     ChangeAdded,
 				Path:     fullPath,
 				NewEntry: newEntry,
-			})
-			if opts.Recursive && newEntry.Mode == object.ModeDirectory {
-				if err := addAllEntries(s, newEntry.Hash, fullPath, ChangeAdded, result); err != nil {
+			}, opts); err != nil {
+				return err
+			}
+			if newEntry.Mode == object.ModeDirectory && opts.descend(fullPath) {
+				if err := addAllEntries(s, newEntry.Hash, fullPath, ChangeAdded, opts, result); err != nil {
 					return err
 				}
 			}
 			newIdx++
 
 		default:
-			if err := diffEntry(s, oldEntry, newEntry, prefix, opts, result); err != nil {
+			if job := pending[newIdx]; job != nil {
+				if err := mergeSubtree(job, opts, result); err != nil {
+					return err
+				}
+			} else if err := diffEntry(s, oldEntry, newEntry, prefix, modTimes, opts, result); err != nil {
 				return err
 			}
 			oldIdx++
@@ -189,7 +458,90 @@ func diffTrees(s *store.Store, oldHash, newHash object.Hash, prefix string, opts
 	return nil
 }
 
-func diffEntry(s *store.Store, oldEntry, newEntry *object.Entry, prefix string, opts Options, result *Result) error {
+// subtreeDiff is a directory pair being diffed on its own goroutine into a
+// private Result, so workers never share mutable state.
+type subtreeDiff struct {
+	done   chan struct{}
+	result Result
+	err    error
+}
+
+// spawnSubtrees starts diffing the changed directory pairs of two trees'
+// entries, keyed by their index in newEntries, while worker slots are free.
+func spawnSubtrees(s *store.Store, oldEntries, newEntries []object.Entry, prefix string, modTimes bool, opts Options) map[int]*subtreeDiff {
+	if opts.sem == nil || !opts.Recursive {
+		return nil
+	}
+	var pending map[int]*subtreeDiff
+	for oldIdx, newIdx := 0, 0; oldIdx < len(oldEntries) && newIdx < len(newEntries); {
+		oldEntry, newEntry := &oldEntries[oldIdx], &newEntries[newIdx]
+		switch {
+		case oldEntry.Name < newEntry.Name:
+			oldIdx++
+		case oldEntry.Name > newEntry.Name:
+			newIdx++
+		default:
+			if job := spawnSubtree(s, oldEntry, newEntry, prefix, modTimes, opts); job != nil {
+				if pending == nil {
+					pending = make(map[int]*subtreeDiff)
+				}
+				pending[newIdx] = job
+			}
+			oldIdx++
+			newIdx++
+		}
+	}
+	return pending
+}
+
+// spawnSubtree diffs a changed directory pair on a new goroutine when a worker
+// slot is free. It returns nil when the caller should diff inline instead;
+// never blocking on a slot keeps nested subtrees from deadlocking.
+func spawnSubtree(s *store.Store, oldEntry, newEntry *object.Entry, prefix string, modTimes bool, opts Options) *subtreeDiff {
+	if oldEntry.Mode != object.ModeDirectory || newEntry.Mode != object.ModeDirectory ||
+		oldEntry.Hash == newEntry.Hash || metadataChanged(oldEntry, newEntry, modTimes) {
+		return nil
+	}
+
+	select {
+	case opts.sem <- struct{}{}:
+	default:
+		return nil
+	}
+
+	// the subtree's changes reach OnChange in order once merged
+	sub := opts
+	sub.OnChange = nil
+	job := &subtreeDiff{done: make(chan struct{})}
+	go func() {
+		defer close(job.done)
+		defer func() { <-opts.sem }()
+		job.err = diffTrees(s, oldEntry.Hash, newEntry.Hash, joinPath(prefix, oldEntry.Name), sub, &job.result)
+	}()
+	return job
+}
+
+// mergeSubtree waits for a spawned subtree and folds its changes into result
+// where the subtree's entry falls, honoring MaxChanges across the merged set
+// so it is cut where a sequential diff would cut it.
+func mergeSubtree(job *subtreeDiff, opts Options, result *Result) error {
+	<-job.done
+	if job.err != nil && !errors.Is(job.err, errMaxChanges) {
+		return job.err
+	}
+	for _, c := range job.result.Changes {
+		if err := result.add(c, opts); err != nil {
+			return err
+		}
+	}
+	if job.result.Truncated {
+		result.Truncated = true
+		return errMaxChanges
+	}
+	return nil
+}
+
+func diffEntry(s *store.Store, oldEntry, newEntry *object.Entry, prefix string, modTimes bool, opts Options, result *Result) error {
 	fullPath := joinPath(prefix, oldEntry.Name)
 	oldIsDir := oldEntry.Mode == object.ModeDirectory
 	newIsDir := newEntry.Mode == object.ModeDirectory
@@ -198,39 +550,59 @@ func diffEntry(s *store.Store, oldEntry, newEntry *object.Entry, prefix string,
 		return handleTypeChange(s, oldEntry, newEntry, fullPath, oldIsDir, newIsDir, opts, result)
 	}
 
-	if oldEntry.Hash == newEntry.Hash {
+	metaChanged := metadataChanged(oldEntry, newEntry, modTimes)
+	if oldEntry.Hash == newEntry.Hash && !metaChanged {
 		return nil
 	}
 
-	if oldIsDir && opts.Recursive {
+	if oldIsDir && opts.descend(fullPath) {
+		if metaChanged {
+			if err := result.add(Change{Type: ChangeModified, Path: fullPath, OldEntry: oldEntry, NewEntry: newEntry}, opts); err != nil {
+				return err
+			}
+		}
+		if oldEntry.Hash == newEntry.Hash {
+			return nil
+		}
 		return diffTrees(s, oldEntry.Hash, newEntry.Hash, fullPath, opts, result)
 	}
 
-	result.Changes = append(result.Changes, Change{
+	return result.add(Change{
 		Type:     ChangeModified,
 		Path:     fullPath,
 		OldEntry: oldEntry,
 		NewEntry: newEntry,
-	})
-	return nil
+	}, opts)
+}
+
+// metadataChanged reports whether full-metadata trees on both sides record
+// different metadata for an entry, or, with modTimes, different mtimes;
+// trees without them never differ by them.
+func metadataChanged(oldEntry, newEntry *object.Entry, modTimes bool) bool {
+	if modTimes && !oldEntry.ModTime.Equal(newEntry.ModTime) {
+		return true
+	}
+	return oldEntry.Meta != nil && newEntry.Meta != nil && !oldEntry.Meta.Equal(newEntry.Meta)
 }
 
 func handleTypeChange(s *store.Store, oldEntry, newEntry *object.Entry, fullPath string, oldIsDir, newIsDir bool, opts Options, result *Result) error {
-	result.Changes = append(result.Changes, Change{
+	if err := result.add(Change{
 		Type:     ChangeTypeChange,
 		Path:     fullPath,
 		OldEntry: oldEntry,
 		NewEntry: newEntry,
-	})
+	}, opts); err != nil {
+		return err
+	}
 
-	if opts.Recursive && oldIsDir {
-		if err := addAllEntries(s, oldEntry.Hash, fullPath, ChangeDeleted, result); err != nil {
+	if oldIsDir && opts.descend(fullPath) {
+		if err := addAllEntries(s, oldEntry.Hash, fullPath, ChangeDeleted, opts, result); err != nil {
 			return err
 		}
 	}
 
-	if opts.Recursive && newIsDir {
-		if err := addAllEntries(s, newEntry.Hash, fullPath, ChangeAdded, result); err != nil {
+	if newIsDir && opts.descend(fullPath) {
+		if err := addAllEntries(s, newEntry.Hash, fullPath, ChangeAdded, opts, result); err != nil {
 			return err
 		}
 	}
@@ -249,14 +621,15 @@ func loadTree(s *store.Store, hash object.Hash) (*object.Tree, error) {
 	return tree, nil
 }
 
-func addAllEntries(s *store.Store, hash object.Hash, prefix string, changeType ChangeType, result *Result) error {
+func addAllEntries(s *store.Store, hash object.Hash, prefix string, changeType ChangeType, opts Options, result *Result) error {
 	tree, err := loadTree(s, hash)
 	if err != nil {
 		return err
 	}
 
-	for i := range tree.Entries {
-		entry := &tree.Entries[i]
+	entries := opts.filterEntries(prefix, tree.Entries)
+	for i := range entries {
+		entry := &entries[i]
 		fullPath := joinPath(prefix, entry.Name)
 
 		change := Change{
@@ -268,10 +641,12 @@ func addAllEntries(s *store.Store, hash object.Hash, prefix string, changeType C
 		} else {
 			change.OldEntry = entry
 		}
-		result.Changes = append(result.Changes, change)
+		if err := result.add(change, opts); err != nil {
+			return err
+		}
 
-		if entry.Mode == object.ModeDirectory {
-			if err := addAllEntries(s, entry.Hash, fullPath, changeType, result); err != nil {
+		if entry.Mode == object.ModeDirectory && opts.descend(fullPath) {
+			if err := addAllEntries(s, entry.Hash, fullPath, changeType, opts, result); err != nil {
 				return err
 			}
 		}
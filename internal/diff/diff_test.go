@@ -1,8 +1,15 @@
 package diff
 
 import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/garrettladley/smerkle/internal/ignore"
 	"github.com/garrettladley/smerkle/internal/object"
 	"github.com/garrettladley/smerkle/internal/store"
 )
@@ -399,8 +406,8 @@ func TestDiffShallowVsRecursive(t *testing.T) {
 	})
 
 	oldTree := createTree(t, s, []object.Entry{
-		{Name: "top.txt", Mode: object.ModeRegular, Size: 5, Hash: file1Hash},
 		{Name: "subdir", Mode: object.ModeDirectory, Hash: subDirHash},
+		{Name: "top.txt", Mode: object.ModeRegular, Size: 5, Hash: file1Hash},
 	})
 
 	// Modify nested file
@@ -408,8 +415,8 @@ func TestDiffShallowVsRecursive(t *testing.T) {
 		{Name: "nested.txt", Mode: object.ModeRegular, Size: 5, Hash: file2Hash},
 	})
 	newTree := createTree(t, s, []object.Entry{
-		{Name: "top.txt", Mode: object.ModeRegular, Size: 5, Hash: file1Hash},
 		{Name: "subdir", Mode: object.ModeDirectory, Hash: newSubDirHash},
+		{Name: "top.txt", Mode: object.ModeRegular, Size: 5, Hash: file1Hash},
 	})
 
 	t.Run("recursive", func(t *testing.T) {
@@ -626,6 +633,7 @@ func TestChangeTypeString(t *testing.T) {
 		{ChangeDeleted, "deleted"},
 		{ChangeModified, "modified"},
 		{ChangeTypeChange, "type_change"},
+		{ChangeCopied, "copied"},
 		{ChangeType(99), "unknown"},
 	}
 
@@ -670,6 +678,95 @@ func TestDiffExecutableModeChange(t *testing.T) {
 	}
 }
 
+func TestDiffMetadataChange(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+	fileHash := createBlob(t, s, []byte("root:x:0:0"))
+	meta := func(perm uint32) *object.Metadata { return &object.Metadata{Perm: perm} }
+	tree := func(dirPerm, filePerm uint32, content object.Hash) object.Hash {
+		sub := createTree(t, s, []object.Entry{
+			{Name: "passwd", Mode: object.ModeRegular, Size: 10, Hash: content, Meta: meta(filePerm)},
+		})
+		return createTree(t, s, []object.Entry{
+			{Name: "etc", Mode: object.ModeDirectory, Hash: sub, Meta: meta(dirPerm)},
+		})
+	}
+	plain := createTree(t, s, []object.Entry{
+		{Name: "etc", Mode: object.ModeDirectory, Hash: createTree(t, s, []object.Entry{
+			{Name: "passwd", Mode: object.ModeRegular, Size: 10, Hash: fileHash},
+		})},
+	})
+
+	tests := []struct {
+		name     string
+		old, new object.Hash
+		want     []string
+	}{
+		{name: "file permissions", old: tree(0o755, 0o644, fileHash), new: tree(0o755, 0o666, fileHash), want: []string{"etc/passwd"}},
+		{name: "directory permissions", old: tree(0o755, 0o644, fileHash), new: tree(0o700, 0o644, fileHash), want: []string{"etc"}},
+		{
+			name: "directory permissions and content",
+			old:  tree(0o755, 0o644, fileHash), new: tree(0o700, 0o644, createBlob(t, s, []byte("root:x:0:1"))),
+			want: []string{"etc", "etc/passwd"},
+		},
+		{name: "against a content-only tree", old: plain, new: tree(0o755, 0o644, fileHash), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := DiffDefault(s, tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("DiffDefault() error = %v", err)
+			}
+			var got []string
+			for _, c := range result.Changes {
+				if c.Type != ChangeModified {
+					t.Errorf("%s: type = %v, want modified", c.Path, c.Type)
+				}
+				got = append(got, c.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changed paths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffModTimeChange(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+	fileHash := createBlob(t, s, []byte("binary"))
+	tree := func(modTimes bool, sec int64) object.Hash {
+		h, err := s.PutTree(&object.Tree{ModTimes: modTimes, Entries: []object.Entry{
+			{Name: "app.bin", Mode: object.ModeRegular, Size: 6, Hash: fileHash, ModTime: time.Unix(sec, 0)},
+		}})
+		if err != nil {
+			t.Fatalf("PutTree() error = %v", err)
+		}
+		return h
+	}
+
+	result, err := DiffDefault(s, tree(true, 1), tree(true, 2))
+	if err != nil {
+		t.Fatalf("DiffDefault() error = %v", err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Type != ChangeModified || result.Changes[0].Path != "app.bin" {
+		t.Errorf("Changes = %+v, want app.bin modified", result.Changes)
+	}
+
+	// a content-only side stored no times to compare
+	result, err = DiffDefault(s, tree(false, 1), tree(true, 2))
+	if err != nil {
+		t.Fatalf("DiffDefault() error = %v", err)
+	}
+	if result.HasChanges() {
+		t.Errorf("Changes = %+v, want none", result.Changes)
+	}
+}
+
 func TestDiffSymlinkHandling(t *testing.T) {
 	t.Parallel()
 
@@ -698,6 +795,504 @@ func TestDiffSymlinkHandling(t *testing.T) {
 	}
 }
 
+func TestDiffFindCopies(t *testing.T) {
+	t.Parallel()
+
+	t.Run("added file matching unchanged file is copied", func(t *testing.T) {
+		t.Parallel()
+
+		s := setupStore(t)
+
+		sharedHash := createBlob(t, s, []byte("shared"))
+		otherHash := createBlob(t, s, []byte("other"))
+
+		oldSub := createTree(t, s, []object.Entry{
+			{Name: "orig.txt", Mode: object.ModeRegular, Size: 6, Hash: sharedHash},
+		})
+		oldTree := createTree(t, s, []object.Entry{
+			{Name: "sub", Mode: object.ModeDirectory, Hash: oldSub},
+		})
+		newTree := createTree(t, s, []object.Entry{
+			{Name: "copy.txt", Mode: object.ModeRegular, Size: 6, Hash: sharedHash},
+			{Name: "new.txt", Mode: object.ModeRegular, Size: 5, Hash: otherHash},
+			{Name: "sub", Mode: object.ModeDirectory, Hash: oldSub},
+		})
+
+		result, err := Diff(s, oldTree, newTree, Options{Recursive: true, FindCopies: true})
+		if err != nil {
+			t.Fatalf("Diff() error = %v", err)
+		}
+
+		copied := result.Copied()
+		if len(copied) != 1 {
+			t.Fatalf("len(Copied()) = %d, want 1", len(copied))
+		}
+		if copied[0].Path != "copy.txt" {
+			t.Errorf("Copied path = %q, want copy.txt", copied[0].Path)
+		}
+		if copied[0].Source != "sub/orig.txt" {
+			t.Errorf("Copied source = %q, want sub/orig.txt", copied[0].Source)
+		}
+		if len(result.Added()) != 1 || result.Added()[0].Path != "new.txt" {
+			t.Errorf("Added() = %v, want [new.txt]", result.Added())
+		}
+	})
+
+	t.Run("modified source is not a copy source", func(t *testing.T) {
+		t.Parallel()
+
+		s := setupStore(t)
+
+		oldHash := createBlob(t, s, []byte("before"))
+		newHash := createBlob(t, s, []byte("after"))
+
+		oldTree := createTree(t, s, []object.Entry{
+			{Name: "a.txt", Mode: object.ModeRegular, Size: 6, Hash: oldHash},
+		})
+		newTree := createTree(t, s, []object.Entry{
+			{Name: "a.txt", Mode: object.ModeRegular, Size: 5, Hash: newHash},
+			{Name: "b.txt", Mode: object.ModeRegular, Size: 6, Hash: oldHash},
+		})
+
+		result, err := Diff(s, oldTree, newTree, Options{Recursive: true, FindCopies: true})
+		if err != nil {
+			t.Fatalf("Diff() error = %v", err)
+		}
+
+		if len(result.Copied()) != 0 {
+			t.Errorf("len(Copied()) = %d, want 0", len(result.Copied()))
+		}
+		if len(result.Added()) != 1 {
+			t.Errorf("len(Added()) = %d, want 1", len(result.Added()))
+		}
+	})
+
+	t.Run("changes the diff hides are not sources", func(t *testing.T) {
+		t.Parallel()
+
+		s := setupStore(t)
+
+		keepHash := createBlob(t, s, []byte("keep"))
+		beforeHash := createBlob(t, s, []byte("before"))
+		afterHash := createBlob(t, s, []byte("after"))
+		oldTree := createTree(t, s, []object.Entry{
+			{Name: "keep", Mode: object.ModeDirectory, Hash: createTree(t, s, []object.Entry{
+				{Name: "k.txt", Mode: object.ModeRegular, Size: 4, Hash: keepHash},
+			})},
+			{Name: "sub", Mode: object.ModeDirectory, Hash: createTree(t, s, []object.Entry{
+				{Name: "a.txt", Mode: object.ModeRegular, Size: 6, Hash: beforeHash},
+			})},
+		})
+		// sub/a.txt changes, so its old content is no source for the copies of it
+		newTree := createTree(t, s, []object.Entry{
+			{Name: "copy.txt", Mode: object.ModeRegular, Size: 6, Hash: beforeHash},
+			{Name: "keep", Mode: object.ModeDirectory, Hash: createTree(t, s, []object.Entry{
+				{Name: "copy.txt", Mode: object.ModeRegular, Size: 6, Hash: beforeHash},
+				{Name: "dup.txt", Mode: object.ModeRegular, Size: 4, Hash: keepHash},
+				{Name: "k.txt", Mode: object.ModeRegular, Size: 4, Hash: keepHash},
+			})},
+			{Name: "sub", Mode: object.ModeDirectory, Hash: createTree(t, s, []object.Entry{
+				{Name: "a.txt", Mode: object.ModeRegular, Size: 5, Hash: afterHash},
+			})},
+		})
+		ign, err := ignore.New(strings.NewReader("sub/\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name string
+			opts Options
+			want map[string]string // copy to source
+		}{
+			{name: "shallow", opts: Options{}, want: map[string]string{}},
+			{name: "ignored", opts: Options{Recursive: true, Ignorer: ign}, want: map[string]string{"keep/dup.txt": "keep/k.txt"}},
+			{name: "path filter", opts: Options{Recursive: true, PathFilter: "keep"}, want: map[string]string{"keep/dup.txt": "keep/k.txt"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				tt.opts.FindCopies = true
+				result, err := Diff(s, oldTree, newTree, tt.opts)
+				if err != nil {
+					t.Fatalf("Diff() error = %v", err)
+				}
+				got := make(map[string]string)
+				for _, c := range result.Copied() {
+					got[c.Path] = c.Source
+				}
+				if !maps.Equal(got, tt.want) {
+					t.Errorf("Copied() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("truncated diff reports no copies", func(t *testing.T) {
+		t.Parallel()
+
+		s := setupStore(t)
+
+		oldHash := createBlob(t, s, []byte("before"))
+		newHash := createBlob(t, s, []byte("after"))
+		oldTree := createTree(t, s, []object.Entry{
+			{Name: "z.txt", Mode: object.ModeRegular, Size: 6, Hash: oldHash},
+		})
+		// z.txt changes past the cut, so it can't be known as a source
+		newTree := createTree(t, s, []object.Entry{
+			{Name: "a.txt", Mode: object.ModeRegular, Size: 6, Hash: oldHash},
+			{Name: "z.txt", Mode: object.ModeRegular, Size: 5, Hash: newHash},
+		})
+
+		result, err := Diff(s, oldTree, newTree, Options{Recursive: true, FindCopies: true, MaxChanges: 1})
+		if err != nil {
+			t.Fatalf("Diff() error = %v", err)
+		}
+		if !result.Truncated {
+			t.Fatal("Truncated = false, want true")
+		}
+		if len(result.Copied()) != 0 || len(result.Added()) != 1 {
+			t.Errorf("Copied() = %v, Added() = %v, want a.txt added", result.Copied(), result.Added())
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+
+		s := setupStore(t)
+
+		fileHash := createBlob(t, s, []byte("same"))
+		oldTree := createTree(t, s, []object.Entry{
+			{Name: "a.txt", Mode: object.ModeRegular, Size: 4, Hash: fileHash},
+		})
+		newTree := createTree(t, s, []object.Entry{
+			{Name: "a.txt", Mode: object.ModeRegular, Size: 4, Hash: fileHash},
+			{Name: "b.txt", Mode: object.ModeRegular, Size: 4, Hash: fileHash},
+		})
+
+		result, err := DiffDefault(s, oldTree, newTree)
+		if err != nil {
+			t.Fatalf("DiffDefault() error = %v", err)
+		}
+
+		if len(result.Copied()) != 0 {
+			t.Errorf("len(Copied()) = %d, want 0", len(result.Copied()))
+		}
+	})
+}
+
+func TestDiffMaxChanges(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+
+	fileHash := createBlob(t, s, []byte("content"))
+	newTree := createTree(t, s, []object.Entry{
+		{Name: "a.txt", Mode: object.ModeRegular, Size: 7, Hash: fileHash},
+		{Name: "b.txt", Mode: object.ModeRegular, Size: 7, Hash: fileHash},
+		{Name: "c.txt", Mode: object.ModeRegular, Size: 7, Hash: fileHash},
+	})
+
+	tests := []struct {
+		name          string
+		maxChanges    int
+		wantChanges   int
+		wantTruncated bool
+	}{
+		{name: "no limit", maxChanges: 0, wantChanges: 3, wantTruncated: false},
+		{name: "limit below count", maxChanges: 2, wantChanges: 2, wantTruncated: true},
+		{name: "limit equal to count", maxChanges: 3, wantChanges: 3, wantTruncated: false},
+		{name: "limit above count", maxChanges: 10, wantChanges: 3, wantTruncated: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := Diff(s, object.ZeroHash, newTree, Options{Recursive: true, MaxChanges: tt.maxChanges})
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if len(result.Changes) != tt.wantChanges {
+				t.Errorf("len(Changes) = %d, want %d", len(result.Changes), tt.wantChanges)
+			}
+			if result.Truncated != tt.wantTruncated {
+				t.Errorf("Truncated = %v, want %v", result.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestDiffOrdering(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+
+	fileHash := createBlob(t, s, []byte("content"))
+	subTree := createTree(t, s, []object.Entry{
+		{Name: "x.txt", Mode: object.ModeRegular, Size: 7, Hash: fileHash},
+	})
+	newTree := createTree(t, s, []object.Entry{
+		{Name: "a", Mode: object.ModeDirectory, Hash: subTree},
+		{Name: "a.txt", Mode: object.ModeRegular, Size: 7, Hash: fileHash},
+	})
+
+	result, err := DiffDefault(s, object.ZeroHash, newTree)
+	if err != nil {
+		t.Fatalf("DiffDefault() error = %v", err)
+	}
+
+	// byte-wise order puts '.' (0x2e) before '/' (0x2f)
+	want := []string{"a", "a.txt", "a/x.txt"}
+	if len(result.Changes) != len(want) {
+		t.Fatalf("len(Changes) = %d, want %d", len(result.Changes), len(want))
+	}
+	for i, c := range result.Changes {
+		if c.Path != want[i] {
+			t.Errorf("Changes[%d].Path = %q, want %q", i, c.Path, want[i])
+		}
+	}
+}
+
+func TestDiffConcurrency(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+	oldTree, newTree := createWideTrees(t, s, 16, 8)
+
+	sequential, err := Diff(s, oldTree, newTree, Options{Recursive: true})
+	if err != nil {
+		t.Fatalf("Diff() sequential error = %v", err)
+	}
+
+	for _, concurrency := range []int{2, 4, 32} {
+		parallel, err := Diff(s, oldTree, newTree, Options{Recursive: true, Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("Diff() concurrency=%d error = %v", concurrency, err)
+		}
+		if len(parallel.Changes) != len(sequential.Changes) {
+			t.Fatalf("concurrency=%d: len(Changes) = %d, want %d", concurrency, len(parallel.Changes), len(sequential.Changes))
+		}
+		for i := range sequential.Changes {
+			if parallel.Changes[i].Path != sequential.Changes[i].Path || parallel.Changes[i].Type != sequential.Changes[i].Type {
+				t.Errorf("concurrency=%d: Changes[%d] = %s %q, want %s %q", concurrency, i,
+					parallel.Changes[i].Type, parallel.Changes[i].Path,
+					sequential.Changes[i].Type, sequential.Changes[i].Path)
+			}
+		}
+	}
+
+	// a limited diff keeps the same changes however the workers are scheduled
+	wantLimited, err := Diff(s, oldTree, newTree, Options{Recursive: true, MaxChanges: 10})
+	if err != nil {
+		t.Fatalf("Diff() limited error = %v", err)
+	}
+	for range 20 {
+		limited, err := Diff(s, oldTree, newTree, Options{Recursive: true, Concurrency: 4, MaxChanges: 10})
+		if err != nil {
+			t.Fatalf("Diff() limited error = %v", err)
+		}
+		if !limited.Truncated || !slices.Equal(changePaths(limited.Changes), changePaths(wantLimited.Changes)) {
+			t.Fatalf("limited: Changes = %v, Truncated = %v, want %v, true",
+				changePaths(limited.Changes), limited.Truncated, changePaths(wantLimited.Changes))
+		}
+	}
+}
+
+func changePaths(changes []Change) []string {
+	out := make([]string, len(changes))
+	for i, c := range changes {
+		out[i] = c.Path
+	}
+	return out
+}
+
+func TestDiffOnChange(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+	oldTree, newTree := createWideTrees(t, s, 8, 4)
+	want, err := Diff(s, oldTree, newTree, Options{Recursive: true})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	// the order a sequential diff streams changes in
+	var treeOrder []string
+	if _, err := Diff(s, oldTree, newTree, Options{Recursive: true, OnChange: func(c Change) error {
+		treeOrder = append(treeOrder, c.Path)
+		return nil
+	}}); err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		opts          Options
+		want          []string
+		wantTruncated bool
+	}{
+		{name: "sequential", opts: Options{Recursive: true}, want: treeOrder},
+		{name: "concurrent", opts: Options{Recursive: true, Concurrency: 4}, want: treeOrder},
+		{name: "find copies", opts: Options{Recursive: true, FindCopies: true}, want: changePaths(want.Changes)},
+		{name: "max changes", opts: Options{Recursive: true, Concurrency: 4, MaxChanges: 5}, want: treeOrder[:5], wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			opts := tt.opts
+			opts.OnChange = func(c Change) error {
+				got = append(got, c.Path)
+				return nil
+			}
+			res, err := Diff(s, oldTree, newTree, opts)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if len(res.Changes) != 0 {
+				t.Errorf("len(Changes) = %d, want 0 with OnChange", len(res.Changes))
+			}
+			if !slices.Equal(got, tt.want) || res.Truncated != tt.wantTruncated {
+				t.Errorf("OnChange got %v, Truncated = %v, want %v, %v", got, res.Truncated, tt.want, tt.wantTruncated)
+			}
+			if !res.HasChanges() {
+				t.Error("HasChanges() = false")
+			}
+		})
+	}
+
+	t.Run("error stops the diff", func(t *testing.T) {
+		t.Parallel()
+
+		errStop := errors.New("stop")
+		calls := 0
+		_, err := Diff(s, oldTree, newTree, Options{Recursive: true, OnChange: func(Change) error {
+			calls++
+			return errStop
+		}})
+		if !errors.Is(err, errStop) || calls != 1 {
+			t.Errorf("Diff() error = %v after %d calls, want errStop after 1", err, calls)
+		}
+	})
+}
+
+func BenchmarkDiff(b *testing.B) {
+	s, err := store.Open(b.TempDir())
+	if err != nil {
+		b.Fatalf("store.Open() error = %v", err)
+	}
+	b.Cleanup(func() { _ = s.Close() })
+
+	oldTree, newTree := createWideTrees(b, s, 128, 64)
+
+	for _, bc := range []struct {
+		name        string
+		concurrency int
+	}{
+		{"sequential", 1},
+		{"parallel", 8},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := Diff(s, oldTree, newTree, Options{Recursive: true, Concurrency: bc.concurrency}); err != nil {
+					b.Fatalf("Diff() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+// createWideTrees builds two trees of dirs directories holding files files
+// each, where every file differs between the old and new tree.
+func createWideTrees(tb testing.TB, s *store.Store, dirs, files int) (object.Hash, object.Hash) {
+	tb.Helper()
+
+	build := func(version string) object.Hash {
+		rootEntries := make([]object.Entry, 0, dirs)
+		for d := range dirs {
+			entries := make([]object.Entry, 0, files)
+			for f := range files {
+				content := []byte(fmt.Sprintf("%s-%d-%d", version, d, f))
+				h, err := s.PutBlob(&object.Blob{Content: content})
+				if err != nil {
+					tb.Fatalf("PutBlob() error = %v", err)
+				}
+				entries = append(entries, object.Entry{
+					Name: fmt.Sprintf("file%03d.txt", f),
+					Mode: object.ModeRegular,
+					Size: int64(len(content)),
+					Hash: h,
+				})
+			}
+			h, err := s.PutTree(&object.Tree{Entries: entries})
+			if err != nil {
+				tb.Fatalf("PutTree() error = %v", err)
+			}
+			rootEntries = append(rootEntries, object.Entry{
+				Name: fmt.Sprintf("dir%03d", d),
+				Mode: object.ModeDirectory,
+				Hash: h,
+			})
+		}
+		h, err := s.PutTree(&object.Tree{Entries: rootEntries})
+		if err != nil {
+			tb.Fatalf("PutTree() error = %v", err)
+		}
+		return h
+	}
+
+	return build("old"), build("new")
+}
+
+func TestChangeSizes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		change    Change
+		wantOld   int64
+		wantNew   int64
+		wantDelta int64
+	}{
+		{
+			name:      "added",
+			change:    Change{Type: ChangeAdded, NewEntry: &object.Entry{Size: 10}},
+			wantNew:   10,
+			wantDelta: 10,
+		},
+		{
+			name:      "deleted",
+			change:    Change{Type: ChangeDeleted, OldEntry: &object.Entry{Size: 7}},
+			wantOld:   7,
+			wantDelta: -7,
+		},
+		{
+			name:      "modified",
+			change:    Change{Type: ChangeModified, OldEntry: &object.Entry{Size: 5}, NewEntry: &object.Entry{Size: 8}},
+			wantOld:   5,
+			wantNew:   8,
+			wantDelta: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.change.OldSize(); got != tt.wantOld {
+				t.Errorf("OldSize() = %d, want %d", got, tt.wantOld)
+			}
+			if got := tt.change.NewSize(); got != tt.wantNew {
+				t.Errorf("NewSize() = %d, want %d", got, tt.wantNew)
+			}
+			if got := tt.change.SizeDelta(); got != tt.wantDelta {
+				t.Errorf("SizeDelta() = %d, want %d", got, tt.wantDelta)
+			}
+		})
+	}
+}
+
 func TestJoinPath(t *testing.T) {
 	t.Parallel()
 
@@ -755,3 +1350,168 @@ func createBlob(t *testing.T, s *store.Store, content []byte) object.Hash {
 	}
 	return hash
 }
+
+func TestDiffPathFilter(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+	file := func(name, content string) object.Entry {
+		return object.Entry{Name: name, Mode: object.ModeRegular, Size: int64(len(content)), Hash: createBlob(t, s, []byte(content))}
+	}
+	dir := func(name string, entries ...object.Entry) object.Entry {
+		return object.Entry{Name: name, Mode: object.ModeDirectory, Hash: createTree(t, s, entries)}
+	}
+	// trees outside the filter are never read, so these may as well be missing
+	missing := func(name, seed string) object.Entry {
+		return object.Entry{Name: name, Mode: object.ModeDirectory, Hash: object.HashBytes([]byte(seed))}
+	}
+
+	oldRoot := createTree(t, s, []object.Entry{
+		missing("docs", "old docs"),
+		dir("services",
+			dir("api", file("main.go", "v1")),
+			dir("api-v2", file("main.go", "v1")),
+			dir("web", file("index.html", "v1")),
+		),
+	})
+	newRoot := createTree(t, s, []object.Entry{
+		missing("docs", "new docs"),
+		dir("services",
+			dir("api", file("main.go", "v2"), file("new.go", "new")),
+			dir("api-v2", file("main.go", "v2")),
+			dir("web", file("index.html", "v2")),
+		),
+	})
+	addedRoot := createTree(t, s, []object.Entry{
+		dir("services", dir("api", file("main.go", "v1")), dir("web", file("index.html", "v1"))),
+	})
+
+	tests := []struct {
+		name     string
+		old, new object.Hash
+		opts     Options
+		want     []string
+	}{
+		{
+			name: "subtree",
+			old:  oldRoot, new: newRoot,
+			opts: Options{Recursive: true, PathFilter: "services/api"},
+			want: []string{"M services/api/main.go", "A services/api/new.go"},
+		},
+		{
+			name: "trailing slash",
+			old:  oldRoot, new: newRoot,
+			opts: Options{Recursive: true, PathFilter: "services/api/"},
+			want: []string{"M services/api/main.go", "A services/api/new.go"},
+		},
+		{
+			name: "file",
+			old:  oldRoot, new: newRoot,
+			opts: Options{Recursive: true, PathFilter: "services/api/main.go"},
+			want: []string{"M services/api/main.go"},
+		},
+		{
+			name: "no match",
+			old:  oldRoot, new: newRoot,
+			opts: Options{Recursive: true, PathFilter: "services/db"},
+		},
+		{
+			name: "shallow lists the entries below",
+			old:  oldRoot, new: newRoot,
+			opts: Options{PathFilter: "services"},
+			want: []string{"M services/api", "M services/api-v2", "M services/web"},
+		},
+		{
+			name: "added tree",
+			old:  object.ZeroHash, new: addedRoot,
+			opts: Options{Recursive: true, PathFilter: "services/api"},
+			want: []string{"A services/api", "A services/api/main.go"},
+		},
+		{
+			name: "concurrent",
+			old:  oldRoot, new: newRoot,
+			opts: Options{Recursive: true, Concurrency: 4, PathFilter: "services/api"},
+			want: []string{"M services/api/main.go", "A services/api/new.go"},
+		},
+	}
+	letters := map[ChangeType]string{ChangeAdded: "A", ChangeDeleted: "D", ChangeModified: "M"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := Diff(s, tt.old, tt.new, tt.opts)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			var got []string
+			for _, c := range res.Changes {
+				got = append(got, letters[c.Type]+" "+c.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffIgnorer(t *testing.T) {
+	t.Parallel()
+
+	s := setupStore(t)
+	file := func(name, content string) object.Entry {
+		return object.Entry{Name: name, Mode: object.ModeRegular, Size: int64(len(content)), Hash: createBlob(t, s, []byte(content))}
+	}
+	// ignored trees are never read, so these may as well be missing
+	missing := func(name, seed string) object.Entry {
+		return object.Entry{Name: name, Mode: object.ModeDirectory, Hash: object.HashBytes([]byte(seed))}
+	}
+
+	oldRoot := createTree(t, s, []object.Entry{
+		file(".DS_Store", "old"),
+		file("main.go", "v1"),
+		missing("node_modules", "old modules"),
+	})
+	newRoot := createTree(t, s, []object.Entry{
+		file("debug.log", "new"),
+		file("main.go", "v2"),
+		missing("node_modules", "new modules"),
+	})
+
+	tests := []struct {
+		name     string
+		patterns string
+		want     []string
+	}{
+		{
+			name:     "files and directories",
+			patterns: ".DS_Store\n*.log\nnode_modules/\n",
+			want:     []string{"main.go"},
+		},
+		{
+			name:     "negated",
+			patterns: ".DS_Store\n*.log\nnode_modules/\n!debug.log\n",
+			want:     []string{"debug.log", "main.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ign, err := ignore.New(strings.NewReader(tt.patterns))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := Diff(s, oldRoot, newRoot, Options{Recursive: true, Ignorer: ign})
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			var got []string
+			for _, c := range res.Changes {
+				got = append(got, c.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package diff
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// StatLine totals a group of file changes.
+type StatLine struct {
+	Changes  int
+	OldBytes int64 // size of the old entries
+	NewBytes int64 // size of the new entries
+}
+
+// Delta returns the change in bytes across the group.
+func (l StatLine) Delta() int64 {
+	return l.NewBytes - l.OldBytes
+}
+
+func (l *StatLine) add(c *Change) {
+	l.Changes++
+	l.OldBytes += c.OldSize()
+	l.NewBytes += c.NewSize()
+}
+
+// TypeStat totals the changes of one type.
+type TypeStat struct {
+	Type ChangeType
+	StatLine
+}
+
+// DirStat totals the changes under one top-level directory; files at the
+// root are grouped under ".".
+type DirStat struct {
+	Dir string
+	StatLine
+}
+
+// Stat summarizes a diff like git diff --stat.
+type Stat struct {
+	Total  StatLine
+	ByType []TypeStat // in ChangeType order, types without changes left out
+	ByDir  []DirStat  // sorted by directory
+}
+
+// Stat totals r's changes by type and by top-level directory, with sizes
+// taken from the entries. Directories added or removed wholesale are counted
+// through their files, so a shallow diff's directory changes count nothing.
+func (r *Result) Stat() *Stat {
+	st := &Stat{}
+	types := map[ChangeType]*StatLine{}
+	dirs := map[string]*StatLine{}
+
+	for i := range r.Changes {
+		c := &r.Changes[i]
+		if isDirChange(c) {
+			continue
+		}
+		st.Total.add(c)
+		if types[c.Type] == nil {
+			types[c.Type] = &StatLine{}
+		}
+		types[c.Type].add(c)
+		dir := topDir(c.Path)
+		if dirs[dir] == nil {
+			dirs[dir] = &StatLine{}
+		}
+		dirs[dir].add(c)
+	}
+
+	for t, l := range types {
+		st.ByType = append(st.ByType, TypeStat{Type: t, StatLine: *l})
+	}
+	slices.SortFunc(st.ByType, func(a, b TypeStat) int { return cmp.Compare(a.Type, b.Type) })
+	for d, l := range dirs {
+		st.ByDir = append(st.ByDir, DirStat{Dir: d, StatLine: *l})
+	}
+	slices.SortFunc(st.ByDir, func(a, b DirStat) int { return cmp.Compare(a.Dir, b.Dir) })
+	return st
+}
+
+// isDirChange reports whether c is a directory changing as a whole, with
+// no file on either side.
+func isDirChange(c *Change) bool {
+	isDir := func(e *object.Entry) bool { return e == nil || e.Mode == object.ModeDirectory }
+	return isDir(c.OldEntry) && isDir(c.NewEntry)
+}
+
+// topDir returns the first element of p, or "." for a path at the root.
+func topDir(p string) string {
+	dir, _, ok := strings.Cut(p, "/")
+	if !ok {
+		return "."
+	}
+	return dir
+}
@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+func TestResultStat(t *testing.T) {
+	t.Parallel()
+
+	file := func(size int64) *object.Entry { return &object.Entry{Mode: object.ModeRegular, Size: size} }
+	dir := &object.Entry{Mode: object.ModeDirectory}
+
+	tests := []struct {
+		name    string
+		changes []Change
+		want    *Stat
+	}{
+		{
+			name: "empty",
+			want: &Stat{},
+		},
+		{
+			name: "by type and directory",
+			changes: []Change{
+				{Type: ChangeModified, Path: "README.md", OldEntry: file(10), NewEntry: file(12)},
+				{Type: ChangeAdded, Path: "docs", NewEntry: dir},
+				{Type: ChangeAdded, Path: "docs/guide.md", NewEntry: file(6)},
+				{Type: ChangeModified, Path: "src/main.go", OldEntry: file(13), NewEntry: file(29)},
+				{Type: ChangeDeleted, Path: "src/util/util.go", OldEntry: file(14)},
+			},
+			want: &Stat{
+				Total: StatLine{Changes: 4, OldBytes: 37, NewBytes: 47},
+				ByType: []TypeStat{
+					{Type: ChangeAdded, StatLine: StatLine{Changes: 1, NewBytes: 6}},
+					{Type: ChangeDeleted, StatLine: StatLine{Changes: 1, OldBytes: 14}},
+					{Type: ChangeModified, StatLine: StatLine{Changes: 2, OldBytes: 23, NewBytes: 41}},
+				},
+				ByDir: []DirStat{
+					{Dir: ".", StatLine: StatLine{Changes: 1, OldBytes: 10, NewBytes: 12}},
+					{Dir: "docs", StatLine: StatLine{Changes: 1, NewBytes: 6}},
+					{Dir: "src", StatLine: StatLine{Changes: 2, OldBytes: 27, NewBytes: 29}},
+				},
+			},
+		},
+		{
+			name: "type change counts the file side",
+			changes: []Change{
+				{Type: ChangeTypeChange, Path: "lib", OldEntry: file(8), NewEntry: dir},
+				{Type: ChangeAdded, Path: "lib/a.go", NewEntry: file(3)},
+			},
+			want: &Stat{
+				Total: StatLine{Changes: 2, OldBytes: 8, NewBytes: 3},
+				ByType: []TypeStat{
+					{Type: ChangeAdded, StatLine: StatLine{Changes: 1, NewBytes: 3}},
+					{Type: ChangeTypeChange, StatLine: StatLine{Changes: 1, OldBytes: 8}},
+				},
+				ByDir: []DirStat{
+					{Dir: ".", StatLine: StatLine{Changes: 1, OldBytes: 8}},
+					{Dir: "lib", StatLine: StatLine{Changes: 1, NewBytes: 3}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := (&Result{Changes: tt.changes}).Stat()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
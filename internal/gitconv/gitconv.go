@@ -0,0 +1,446 @@
+// Package gitconv converts between git trees and smerkle trees using the git
+// command-line tool.
+package gitconv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/treebuild"
+)
+
+// git file modes.
+const (
+	gitModeRegular    = "100644"
+	gitModeExecutable = "100755"
+	gitModeSymlink    = "120000"
+	gitModeDirectory  = "040000"
+	gitModeSubmodule  = "160000"
+)
+
+var ErrUnsupportedMode = errors.New("gitconv: unsupported git mode")
+
+// git runs a git subcommand in repo and returns its stdout.
+func git(ctx context.Context, repo string, args ...string) ([]byte, error) {
+	return gitEnv(ctx, repo, nil, args...)
+}
+
+// gitEnv is git with env added to the inherited environment.
+func gitEnv(ctx context.Context, repo string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...) //nolint:gosec // fixed binary, arguments are refs and paths
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// lsEntry is one line of `git ls-tree -r --long`.
+type lsEntry struct {
+	mode string
+	sha  string
+	size int64
+	path string
+}
+
+// ImportResult describes a converted git tree.
+type ImportResult struct {
+	Root    object.Hash
+	Skipped []string // submodules, which have no content in the repository
+}
+
+// Import converts the tree at rev in repo into smerkle objects in s. File
+// modes map onto smerkle modes and symlinks are stored by target, exactly as
+// the walker would hash a checkout of rev.
+func Import(ctx context.Context, s *store.Store, repo, rev string) (*ImportResult, error) {
+	out, err := git(ctx, repo, "ls-tree", "-r", "-z", "--long", "--full-tree", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries []lsEntry
+		res     = &ImportResult{}
+	)
+	for rec := range bytes.SplitSeq(out, []byte{0}) {
+		if len(rec) == 0 {
+			continue
+		}
+		e, err := parseLsTree(string(rec))
+		if err != nil {
+			return nil, err
+		}
+		if e.mode == gitModeSubmodule {
+			res.Skipped = append(res.Skipped, e.path)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	root := treebuild.New()
+	err = readBlobs(ctx, repo, entries, func(i int, content []byte) error {
+		e := entries[i]
+		mode, err := smerkleMode(e.mode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.path, err)
+		}
+		h, err := s.PutBlob(&object.Blob{Content: content})
+		if err != nil {
+			return fmt.Errorf("put blob %s: %w", e.path, err)
+		}
+		root.Add(e.path, object.Entry{Mode: mode, Size: e.size, Hash: h})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Root, err = root.Write(s)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // treebuild errors already carry context
+	}
+	return res, nil
+}
+
+// parseLsTree parses "<mode> SP <type> SP <sha> SP+ <size> TAB <path>".
+func parseLsTree(rec string) (lsEntry, error) {
+	meta, path, ok := strings.Cut(rec, "\t")
+	fields := strings.Fields(meta)
+	if !ok || len(fields) != 4 {
+		return lsEntry{}, fmt.Errorf("unexpected ls-tree output %q", rec)
+	}
+	e := lsEntry{mode: fields[0], sha: fields[2], path: path}
+	if fields[3] != "-" {
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return lsEntry{}, fmt.Errorf("parse size of %s: %w", path, err)
+		}
+		e.size = size
+	}
+	return e, nil
+}
+
+// readBlobs streams the content of every entry from one
+// `git cat-file --batch`, calling fn for each in order.
+func readBlobs(ctx context.Context, repo string, entries []lsEntry, fn func(i int, content []byte) error) (err error) {
+	var req strings.Builder
+	for _, e := range entries {
+		req.WriteString(e.sha)
+		req.WriteByte('\n')
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repo, "cat-file", "--batch") //nolint:gosec // fixed binary, repo is a path
+	cmd.Stdin = strings.NewReader(req.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("git cat-file: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git cat-file: %w", err)
+	}
+	defer func() {
+		// drain so git can exit even if we stopped early
+		_, _ = io.Copy(io.Discard, stdout)
+		if werr := cmd.Wait(); werr != nil && err == nil {
+			err = fmt.Errorf("git cat-file: %w: %s", werr, strings.TrimSpace(stderr.String()))
+		}
+	}()
+
+	r := bufio.NewReader(stdout)
+	for i, e := range entries {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("read cat-file header for %s: %w", e.path, err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 || fields[1] != "blob" {
+			return fmt.Errorf("unexpected cat-file header %q for %s", strings.TrimSpace(header), e.path)
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("parse cat-file size for %s: %w", e.path, err)
+		}
+		content := make([]byte, size+1) // trailing newline
+		if _, err := io.ReadFull(r, content); err != nil {
+			return fmt.Errorf("read content of %s: %w", e.path, err)
+		}
+		if err := fn(i, content[:size]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func smerkleMode(gitMode string) (object.Mode, error) {
+	switch gitMode {
+	case gitModeRegular:
+		return object.ModeRegular, nil
+	case gitModeExecutable:
+		return object.ModeExecutable, nil
+	case gitModeSymlink:
+		return object.ModeSymlink, nil
+	default:
+		return 0, fmt.Errorf("%w %s", ErrUnsupportedMode, gitMode)
+	}
+}
+
+// ExportOptions controls what Export writes besides the tree.
+type ExportOptions struct {
+	// Commit wraps the tree in a commit with Message.
+	Commit  bool
+	Message string
+	// Branch, if set, implies Commit: the commit's parent is the branch's
+	// current tip, if any, and the branch is moved to the new commit.
+	Branch string
+	// Time, if set, is the commit's author and committer date, so the same
+	// tree, message, parent, and identity always give the same commit id.
+	Time time.Time
+}
+
+// ExportResult holds the git object ids Export wrote.
+type ExportResult struct {
+	Tree   string
+	Commit string // empty unless a commit was requested
+}
+
+// Export writes the smerkle tree root into repo as git objects. Blobs are
+// streamed through one `git fast-import`; trees are built with `git mktree`.
+func Export(ctx context.Context, s *store.Store, repo string, root object.Hash, opts ExportOptions) (*ExportResult, error) {
+	e := &exporter{store: s, repo: repo, marks: map[object.Hash]int{}, trees: map[object.Hash]string{}}
+
+	if err := e.collectBlobs(root); err != nil {
+		return nil, err
+	}
+	blobIDs, err := e.writeBlobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.blobIDs = blobIDs
+
+	tree, err := e.writeTree(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	res := &ExportResult{Tree: tree}
+
+	if !opts.Commit && opts.Branch == "" {
+		return res, nil
+	}
+
+	args := []string{"commit-tree", tree, "-m", opts.Message}
+	ref := ""
+	if opts.Branch != "" {
+		ref = "refs/heads/" + opts.Branch
+		if parent, err := git(ctx, repo, "rev-parse", "--verify", "--quiet", ref); err == nil {
+			args = append(args, "-p", strings.TrimSpace(string(parent)))
+		}
+	}
+	var env []string
+	if !opts.Time.IsZero() {
+		date := fmt.Sprintf("@%d +0000", opts.Time.Unix())
+		env = []string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}
+	}
+	out, err := gitEnv(ctx, repo, env, args...)
+	if err != nil {
+		return nil, err
+	}
+	res.Commit = strings.TrimSpace(string(out))
+
+	if ref != "" {
+		if _, err := git(ctx, repo, "update-ref", ref, res.Commit); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type exporter struct {
+	store   *store.Store
+	repo    string
+	marks   map[object.Hash]int    // blob -> fast-import mark, in discovery order
+	order   []object.Hash          // blobs by mark - 1
+	blobIDs map[int]string         // mark -> git blob id
+	trees   map[object.Hash]string // smerkle tree -> git tree id
+}
+
+// collectBlobs assigns a fast-import mark to every distinct blob under h.
+func (e *exporter) collectBlobs(h object.Hash) error {
+	tree, err := e.store.GetTree(h)
+	if err != nil {
+		return fmt.Errorf("get tree %s: %w", h, err)
+	}
+	for _, entry := range tree.Entries {
+		if entry.Mode == object.ModeDirectory {
+			if err := e.collectBlobs(entry.Hash); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Mode == object.ModeInaccessible {
+			// a placeholder has no blob to export
+			return fmt.Errorf("%s: unsupported mode %s", entry.Name, entry.Mode)
+		}
+		if _, ok := e.marks[entry.Hash]; !ok {
+			e.order = append(e.order, entry.Hash)
+			e.marks[entry.Hash] = len(e.order)
+		}
+	}
+	return nil
+}
+
+// writeBlobs streams all collected blobs into the repository and returns the
+// git id of each mark.
+func (e *exporter) writeBlobs(ctx context.Context) (ids map[int]string, err error) {
+	marksFile, err := os.CreateTemp("", "smerkle-marks-*")
+	if err != nil {
+		return nil, fmt.Errorf("create marks file: %w", err)
+	}
+	marksPath := marksFile.Name()
+	_ = marksFile.Close()
+	defer func() { _ = os.Remove(marksPath) }()
+
+	cmd := exec.CommandContext(ctx, "git", "-C", e.repo, "fast-import", "--quiet", "--export-marks="+marksPath) //nolint:gosec // fixed binary, repo is a path
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("git fast-import: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git fast-import: %w", err)
+	}
+
+	w := bufio.NewWriter(stdin)
+	writeErr := func() error {
+		for i, h := range e.order {
+			content, err := e.store.ReadFile(h)
+			if err != nil {
+				return fmt.Errorf("read file %s: %w", h, err)
+			}
+			if _, err := fmt.Fprintf(w, "blob\nmark :%d\ndata %d\n", i+1, len(content)); err != nil {
+				return fmt.Errorf("write fast-import stream: %w", err)
+			}
+			if _, err := w.Write(content); err != nil {
+				return fmt.Errorf("write fast-import stream: %w", err)
+			}
+			if err := w.WriteByte('\n'); err != nil {
+				return fmt.Errorf("write fast-import stream: %w", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("write fast-import stream: %w", err)
+		}
+		return nil
+	}()
+	closeErr := stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git fast-import: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	if closeErr != nil {
+		return nil, fmt.Errorf("git fast-import: %w", closeErr)
+	}
+
+	data, err := os.ReadFile(marksPath) //nolint:gosec // temp file we created
+	if err != nil {
+		return nil, fmt.Errorf("read marks file: %w", err)
+	}
+	ids = make(map[int]string, len(e.order))
+	for line := range strings.Lines(string(data)) {
+		mark, id, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok || !strings.HasPrefix(mark, ":") {
+			continue
+		}
+		n, err := strconv.Atoi(mark[1:])
+		if err != nil {
+			return nil, fmt.Errorf("parse mark %q: %w", mark, err)
+		}
+		ids[n] = id
+	}
+	return ids, nil
+}
+
+// writeTree writes h and its subtrees bottom-up, reusing ids for subtrees
+// that occur more than once.
+func (e *exporter) writeTree(ctx context.Context, h object.Hash) (string, error) {
+	if id, ok := e.trees[h]; ok {
+		return id, nil
+	}
+
+	tree, err := e.store.GetTree(h)
+	if err != nil {
+		return "", fmt.Errorf("get tree %s: %w", h, err)
+	}
+
+	var in strings.Builder
+	for _, entry := range tree.Entries {
+		var mode, kind, id string
+		switch entry.Mode {
+		case object.ModeDirectory:
+			mode, kind = gitModeDirectory, "tree"
+			if id, err = e.writeTree(ctx, entry.Hash); err != nil {
+				return "", err
+			}
+		case object.ModeRegular, object.ModeExecutable, object.ModeSymlink:
+			mode, kind = gitMode(entry.Mode), "blob"
+			id = e.blobIDs[e.marks[entry.Hash]]
+		default:
+			return "", fmt.Errorf("%s: unsupported mode %s", entry.Name, entry.Mode)
+		}
+		if id == "" {
+			return "", fmt.Errorf("%s: no git id for %s", entry.Name, entry.Hash)
+		}
+		fmt.Fprintf(&in, "%s %s %s\t%s\x00", mode, kind, id, entry.Name)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", e.repo, "mktree", "-z") //nolint:gosec // fixed binary, repo is a path
+	cmd.Stdin = strings.NewReader(in.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git mktree: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	id := strings.TrimSpace(string(out))
+	e.trees[h] = id
+	return id, nil
+}
+
+func gitMode(m object.Mode) string {
+	switch m {
+	case object.ModeExecutable:
+		return gitModeExecutable
+	case object.ModeSymlink:
+		return gitModeSymlink
+	case object.ModeDirectory:
+		return gitModeDirectory
+	case object.ModeRegular:
+		return gitModeRegular
+	default:
+		return gitModeRegular
+	}
+}
@@ -0,0 +1,192 @@
+package gitconv
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/ignore"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+// newRepo creates a repository with one commit holding regular, executable,
+// nested, and symlinked files.
+func newRepo(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	files := map[string]string{
+		"README.md":       "# hi\n",
+		"src/main.go":     "package main\n",
+		"src/pkg/util.go": "package pkg\n",
+	}
+	for path, content := range files {
+		full := filepath.Join(repo, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o750); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, "run.sh"), []byte("#!/bin/sh\n"), 0o700); err != nil { //nolint:gosec // executable test fixture
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.Symlink("src/main.go", filepath.Join(repo, "link")); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "config", "user.name", "test")
+	runGit(t, repo, "config", "user.email", "test@example.com")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "initial")
+	return repo
+}
+
+func runGit(t *testing.T, repo string, args ...string) string {
+	t.Helper()
+	out, err := git(context.Background(), repo, args...)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestImportMatchesWalk(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(t)
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	imported, err := Import(context.Background(), s, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if len(imported.Skipped) != 0 {
+		t.Errorf("Skipped = %v, want none", imported.Skipped)
+	}
+
+	ign, err := ignore.New(strings.NewReader(".git/\n"))
+	if err != nil {
+		t.Fatalf("ignore.New() error = %v", err)
+	}
+	walked, err := walker.Walk(context.Background(), repo, s, walker.WithIgnorer(ign))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	if imported.Root != walked.Hash {
+		t.Errorf("Import() root = %s, want walked checkout %s", imported.Root, walked.Hash)
+	}
+}
+
+func TestImportBadRev(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(t)
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	if _, err := Import(context.Background(), s, repo, "no-such-rev"); err == nil {
+		t.Error("Import() error = nil, want error for unknown rev")
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		opts       ExportOptions
+		wantCommit bool
+	}{
+		{name: "tree only"},
+		{name: "commit", opts: ExportOptions{Commit: true, Message: "snapshot"}, wantCommit: true},
+		{name: "branch", opts: ExportOptions{Branch: "snapshots", Message: "snapshot"}, wantCommit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := newRepo(t)
+			s, err := store.Open(t.TempDir())
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer s.Close() //nolint:errcheck // Close() in a test
+
+			imported, err := Import(context.Background(), s, repo, "HEAD")
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+
+			exported, err := Export(context.Background(), s, repo, imported.Root, tt.opts)
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			// identical content must produce git's own tree id
+			if want := runGit(t, repo, "rev-parse", "HEAD^{tree}"); exported.Tree != want {
+				t.Errorf("Tree = %s, want %s", exported.Tree, want)
+			}
+			if (exported.Commit != "") != tt.wantCommit {
+				t.Fatalf("Commit = %q, want commit %v", exported.Commit, tt.wantCommit)
+			}
+			if tt.opts.Branch != "" {
+				if got := runGit(t, repo, "rev-parse", "refs/heads/"+tt.opts.Branch); got != exported.Commit {
+					t.Errorf("branch tip = %s, want %s", got, exported.Commit)
+				}
+			}
+		})
+	}
+}
+
+func TestExportFixedTime(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(t)
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	imported, err := Import(context.Background(), s, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	opts := ExportOptions{Commit: true, Message: "snapshot", Time: time.Unix(0, 0)}
+	first, err := Export(context.Background(), s, repo, imported.Root, opts)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	second, err := Export(context.Background(), s, repo, imported.Root, opts)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if first.Commit != second.Commit {
+		t.Errorf("commits with a fixed time differ: %s, %s", first.Commit, second.Commit)
+	}
+	if got := runGit(t, repo, "log", "-1", "--format=%at %ct", first.Commit); got != "0 0" {
+		t.Errorf("author and committer dates = %q, want \"0 0\"", got)
+	}
+}
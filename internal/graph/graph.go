@@ -0,0 +1,183 @@
+// Package graph exports the Merkle DAG under a root tree for visualization.
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// Node is one distinct object. Identical subtrees and blobs appear once,
+// however many paths reference them.
+type Node struct {
+	Hash object.Hash
+	Mode object.Mode
+	Size int64
+	Refs int // incoming edges; more than one means the object is shared
+}
+
+func (n *Node) IsTree() bool {
+	return n.Mode == object.ModeDirectory
+}
+
+func (n *Node) Shared() bool {
+	return n.Refs > 1
+}
+
+// Edge links a tree to one of its entries.
+type Edge struct {
+	From, To object.Hash
+	Name     string
+}
+
+type Graph struct {
+	Root  object.Hash
+	Nodes []*Node // in breadth-first discovery order
+	Edges []Edge
+}
+
+// Build loads the DAG under root from s. depth limits how many tree levels
+// are expanded below the root; 0 means unlimited.
+func Build(s *store.Store, root object.Hash, depth int) (*Graph, error) {
+	g := &Graph{Root: root}
+	nodes := map[object.Hash]*Node{}
+
+	rootNode := &Node{Hash: root, Mode: object.ModeDirectory}
+	nodes[root] = rootNode
+	g.Nodes = append(g.Nodes, rootNode)
+
+	type item struct {
+		hash  object.Hash
+		level int
+	}
+	queue := []item{{hash: root}}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+
+		tree, err := s.GetTree(it.hash)
+		if err != nil {
+			return nil, fmt.Errorf("get tree %s: %w", it.hash, err)
+		}
+
+		for _, e := range tree.Entries {
+			g.Edges = append(g.Edges, Edge{From: it.hash, To: e.Hash, Name: e.Name})
+
+			n, seen := nodes[e.Hash]
+			if !seen {
+				n = &Node{Hash: e.Hash, Mode: e.Mode, Size: e.Size}
+				nodes[e.Hash] = n
+				g.Nodes = append(g.Nodes, n)
+			}
+			n.Refs++
+
+			if !seen && e.Mode == object.ModeDirectory && (depth <= 0 || it.level+1 < depth) {
+				queue = append(queue, item{hash: e.Hash, level: it.level + 1})
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// shortHash is long enough to be unique in any realistic diagram.
+func shortHash(h object.Hash) string {
+	return h.String()[:12]
+}
+
+func nodeID(n *Node) string {
+	if n.IsTree() {
+		return "t_" + shortHash(n.Hash)
+	}
+	return "b_" + shortHash(n.Hash)
+}
+
+// WriteDOT renders g as a Graphviz digraph. Shared objects are filled.
+func WriteDOT(w io.Writer, g *Graph) error {
+	ids := idsByHash(g)
+
+	var b strings.Builder
+	b.WriteString("digraph smerkle {\n")
+	b.WriteString("\tnode [fontname=\"monospace\"];\n")
+	for _, n := range g.Nodes {
+		attrs := "shape=box"
+		if n.IsTree() {
+			attrs = "shape=folder"
+		}
+		if n.Shared() {
+			attrs += " style=filled fillcolor=\"#ffcc80\""
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s %s];\n", ids[n.Hash], dotQuote(nodeLabel(n, g.Root, "\n")), attrs)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", ids[e.From], ids[e.To], dotQuote(e.Name))
+	}
+	b.WriteString("}\n")
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write dot: %w", err)
+	}
+	return nil
+}
+
+// WriteMermaid renders g as a Mermaid flowchart. Shared objects use the
+// "shared" class.
+func WriteMermaid(w io.Writer, g *Graph) error {
+	ids := idsByHash(g)
+
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+	for _, n := range g.Nodes {
+		label := mermaidQuote(nodeLabel(n, g.Root, "<br/>"))
+		if n.IsTree() {
+			fmt.Fprintf(&b, "\t%s[%s]\n", ids[n.Hash], label)
+		} else {
+			fmt.Fprintf(&b, "\t%s(%s)\n", ids[n.Hash], label)
+		}
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -->|%s| %s\n", ids[e.From], mermaidQuote(e.Name), ids[e.To])
+	}
+	b.WriteString("\tclassDef shared fill:#ffcc80\n")
+	for _, n := range g.Nodes {
+		if n.Shared() {
+			fmt.Fprintf(&b, "\tclass %s shared\n", ids[n.Hash])
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write mermaid: %w", err)
+	}
+	return nil
+}
+
+func idsByHash(g *Graph) map[object.Hash]string {
+	ids := make(map[object.Hash]string, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids[n.Hash] = nodeID(n)
+	}
+	return ids
+}
+
+func nodeLabel(n *Node, root object.Hash, sep string) string {
+	switch {
+	case n.Hash == root:
+		return "/" + sep + shortHash(n.Hash)
+	case n.IsTree():
+		return shortHash(n.Hash)
+	default:
+		return fmt.Sprintf("%s%s%d bytes", shortHash(n.Hash), sep, n.Size)
+	}
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// buildTree stores root{a.txt, b.txt (same content as a.txt), sub{c.txt}}.
+func buildTree(t *testing.T) (*store.Store, object.Hash) {
+	t.Helper()
+
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	put := func(content string) object.Hash {
+		h, err := s.PutBlob(&object.Blob{Content: []byte(content)})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		return h
+	}
+	shared, other := put("shared"), put("other")
+
+	sub, err := s.PutTree(&object.Tree{Entries: []object.Entry{
+		{Name: "c.txt", Mode: object.ModeRegular, Size: 5, Hash: other},
+	}})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	root, err := s.PutTree(&object.Tree{Entries: []object.Entry{
+		{Name: "a.txt", Mode: object.ModeRegular, Size: 6, Hash: shared},
+		{Name: "b.txt", Mode: object.ModeRegular, Size: 6, Hash: shared},
+		{Name: "sub", Mode: object.ModeDirectory, Hash: sub},
+	}})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	return s, root
+}
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		depth     int
+		wantNodes int
+		wantEdges int
+	}{
+		{name: "unlimited", depth: 0, wantNodes: 4, wantEdges: 4},
+		{name: "root only", depth: 1, wantNodes: 3, wantEdges: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, root := buildTree(t)
+			g, err := Build(s, root, tt.depth)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if len(g.Nodes) != tt.wantNodes {
+				t.Errorf("len(Nodes) = %d, want %d", len(g.Nodes), tt.wantNodes)
+			}
+			if len(g.Edges) != tt.wantEdges {
+				t.Errorf("len(Edges) = %d, want %d", len(g.Edges), tt.wantEdges)
+			}
+
+			var shared int
+			for _, n := range g.Nodes {
+				if n.Shared() {
+					shared++
+				}
+			}
+			if shared != 1 {
+				t.Errorf("shared nodes = %d, want 1", shared)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	s, root := buildTree(t)
+	g, err := Build(s, root, 0)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer, *Graph) error
+		want  []string
+	}{
+		{
+			name:  "dot",
+			write: func(b *bytes.Buffer, g *Graph) error { return WriteDOT(b, g) },
+			want:  []string{"digraph smerkle {", `[label="a.txt"]`, "fillcolor", "shape=folder"},
+		},
+		{
+			name:  "mermaid",
+			write: func(b *bytes.Buffer, g *Graph) error { return WriteMermaid(b, g) },
+			want:  []string{"graph TD", `-->|"sub"|`, "class b_", "classDef shared"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			if err := tt.write(&buf, g); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
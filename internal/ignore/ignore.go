@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
 )
 
 type Ignorer struct {
 	patterns []Pattern
+	warnings []Warning
 }
 
 type Result struct {
@@ -15,16 +20,18 @@ type Result struct {
 	Pattern    string // the pattern that matched (empty if no match)
 	Negated    bool   // true if the final match was from a negation pattern
 	LineNumber int    // line number of the matching pattern (0 if no match)
+	Source     string // file of the matching pattern (empty if no match or not from a file)
 }
 
 func New(r io.Reader) (*Ignorer, error) {
-	patterns, err := Parse(r)
+	patterns, warnings, err := ParseWithWarnings(r)
 	if err != nil {
 		return nil, fmt.Errorf("parse ignore patterns: %w", err)
 	}
 
 	return &Ignorer{
 		patterns: patterns,
+		warnings: warnings,
 	}, nil
 }
 
@@ -35,7 +42,95 @@ func NewFromFile(path string) (*Ignorer, error) {
 	}
 	defer func() { _ = f.Close() }()
 
-	return New(f)
+	ign, err := New(f)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ign.patterns {
+		ign.patterns[i].source = path
+	}
+	for i := range ign.warnings {
+		ign.warnings[i].Source = path
+	}
+	return ign, nil
+}
+
+// NewFromFiles loads each ignore file in order and layers their patterns, so
+// patterns from later files take precedence over earlier ones.
+func NewFromFiles(paths ...string) (*Ignorer, error) {
+	ignorers := make([]*Ignorer, 0, len(paths))
+	for _, path := range paths {
+		ign, err := NewFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ignorers = append(ignorers, ign)
+	}
+	return Merge(ignorers...), nil
+}
+
+// UserFile returns the path of the user-level ignore file,
+// smerkle/ignore under os.UserConfigDir: ~/.config/smerkle/ignore on Linux
+// unless XDG_CONFIG_HOME says otherwise.
+func UserFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("user config dir: %w", err)
+	}
+	return filepath.Join(dir, "smerkle", "ignore"), nil
+}
+
+// Merge layers ignorers in order of increasing precedence: a pattern from a
+// later Ignorer overrides any earlier match, exactly as if its patterns were
+// appended to the end of one ignore file. Nil ignorers are skipped.
+func Merge(ignorers ...*Ignorer) *Ignorer {
+	merged := &Ignorer{}
+	for _, ign := range ignorers {
+		if ign == nil {
+			continue
+		}
+		merged.patterns = append(merged.patterns, ign.patterns...)
+		merged.warnings = append(merged.warnings, ign.warnings...)
+	}
+	return merged
+}
+
+// Warnings returns the patterns that were skipped because they failed to
+// compile. A typo here silently changes what gets hashed, so callers should
+// surface these to users.
+func (i *Ignorer) Warnings() []Warning {
+	if i == nil {
+		return nil
+	}
+	out := make([]Warning, len(i.warnings))
+	copy(out, i.warnings)
+	return out
+}
+
+// Patterns returns the compiled patterns in evaluation order.
+func (i *Ignorer) Patterns() []Pattern {
+	if i == nil {
+		return nil
+	}
+	out := make([]Pattern, len(i.patterns))
+	copy(out, i.patterns)
+	return out
+}
+
+// Fingerprint returns a hash of the compiled pattern list. Two Ignorers with
+// the same fingerprint exclude exactly the same paths; comments, blank lines,
+// and trailing whitespace do not affect it. A nil Ignorer has the zero hash.
+func (i *Ignorer) Fingerprint() object.Hash {
+	if i == nil {
+		return object.ZeroHash
+	}
+
+	var b strings.Builder
+	for _, p := range i.patterns {
+		b.WriteString(p.original)
+		b.WriteByte('\n')
+	}
+	return object.HashBytes([]byte(b.String()))
 }
 
 // Match returns true if the path should be ignored.
@@ -59,6 +154,7 @@ func (i *Ignorer) MatchResult(path string, isDir bool) (result Result) {
 					Pattern:    p.original,
 					Negated:    true,
 					LineNumber: p.lineNumber,
+					Source:     p.source,
 				}
 			} else {
 				result = Result{
@@ -66,6 +162,7 @@ func (i *Ignorer) MatchResult(path string, isDir bool) (result Result) {
 					Pattern:    p.original,
 					Negated:    false,
 					LineNumber: p.lineNumber,
+					Source:     p.source,
 				}
 			}
 		}
@@ -414,3 +414,161 @@ func TestMatchResult(t *testing.T) {
 		})
 	}
 }
+
+func TestNewFromFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	if err := os.WriteFile(first, []byte("*.log\nbuild/\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(second, []byte("!keep.log\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ign, err := NewFromFiles(first, second)
+	if err != nil {
+		t.Fatalf("NewFromFiles() error = %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"debug.log", false, true},
+		{"keep.log", false, false}, // later file overrides earlier one
+		{"build", true, true},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := ign.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := NewFromFiles(first, filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewFromFiles() with missing file: expected error, got nil")
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".smerkleignore")
+	if err := os.WriteFile(path, []byte("# comment\n*.log\n!/build/\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ign, err := NewFromFile(path)
+	if err != nil {
+		t.Fatalf("NewFromFile() error = %v", err)
+	}
+
+	patterns := ign.Patterns()
+	if len(patterns) != 2 {
+		t.Fatalf("len(Patterns()) = %d, want 2", len(patterns))
+	}
+
+	first, second := patterns[0], patterns[1]
+	if first.Original() != "*.log" || first.LineNumber() != 2 || first.Source() != path {
+		t.Errorf("Patterns()[0] = %q line %d source %q", first.Original(), first.LineNumber(), first.Source())
+	}
+	if first.Negated() || first.Anchored() || first.DirOnly() {
+		t.Error("Patterns()[0] attributes should all be false")
+	}
+	if second.Original() != "!/build/" || second.LineNumber() != 3 {
+		t.Errorf("Patterns()[1] = %q line %d", second.Original(), second.LineNumber())
+	}
+	if !second.Negated() || !second.Anchored() || !second.DirOnly() {
+		t.Error("Patterns()[1] attributes should all be true")
+	}
+
+	if r := ign.MatchResult("debug.log", false); r.Source != path {
+		t.Errorf("MatchResult().Source = %q, want %q", r.Source, path)
+	}
+
+	var nilIgnorer *Ignorer
+	if got := nilIgnorer.Patterns(); got != nil {
+		t.Errorf("nil Patterns() = %v, want nil", got)
+	}
+}
+
+func TestIgnorerWarnings(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".smerkleignore")
+	if err := os.WriteFile(path, []byte("*.log\n[bad\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ign, err := NewFromFile(path)
+	if err != nil {
+		t.Fatalf("NewFromFile() error = %v", err)
+	}
+
+	warnings := ign.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("len(Warnings()) = %d, want 1", len(warnings))
+	}
+	if warnings[0].Source != path || warnings[0].Line != 2 {
+		t.Errorf("Warnings()[0] = %s:%d, want %s:2", warnings[0].Source, warnings[0].Line, path)
+	}
+	if !strings.Contains(warnings[0].Error(), path+":2") {
+		t.Errorf("Warnings()[0].Error() = %q, want location prefix", warnings[0].Error())
+	}
+
+	merged := Merge(mustNew(t, "[also bad\n"), ign)
+	if got := len(merged.Warnings()); got != 2 {
+		t.Errorf("len(Merge().Warnings()) = %d, want 2", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	base := mustNew(t, "*.log\n")
+	override := mustNew(t, "!keep.log\n")
+
+	merged := Merge(base, nil, override)
+	if !merged.Match("debug.log", false) {
+		t.Error("Match(debug.log) = false, want true from base")
+	}
+	if merged.Match("keep.log", false) {
+		t.Error("Match(keep.log) = true, want false from later override")
+	}
+
+	reversed := Merge(override, base)
+	if !reversed.Match("keep.log", false) {
+		t.Error("Match(keep.log) = false, want true when base takes precedence")
+	}
+
+	if got := len(Merge().Patterns()); got != 0 {
+		t.Errorf("len(Merge().Patterns()) = %d, want 0", got)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	base := mustNew(t, "*.log\nbuild/\n")
+
+	if got := mustNew(t, "# comment\n*.log   \n\nbuild/\n").Fingerprint(); got != base.Fingerprint() {
+		t.Error("Fingerprint() changed by comments and whitespace")
+	}
+	if got := mustNew(t, "build/\n*.log\n").Fingerprint(); got == base.Fingerprint() {
+		t.Error("Fingerprint() unchanged by pattern order")
+	}
+	if got := mustNew(t, "*.log\n").Fingerprint(); got == base.Fingerprint() {
+		t.Error("Fingerprint() unchanged by removed pattern")
+	}
+
+	var nilIgnorer *Ignorer
+	if got := nilIgnorer.Fingerprint(); !got.IsZero() {
+		t.Errorf("nil Fingerprint() = %v, want zero", got)
+	}
+}
@@ -7,7 +7,27 @@ import (
 	"strings"
 )
 
+// Warning describes a pattern that failed to compile and was skipped.
+type Warning struct {
+	Source  string // file the pattern was read from (empty if not from a file)
+	Line    int
+	Pattern string
+	Err     error
+}
+
+func (w Warning) Error() string {
+	if w.Source == "" {
+		return fmt.Sprintf("line %d: %q: %v", w.Line, w.Pattern, w.Err)
+	}
+	return fmt.Sprintf("%s:%d: %q: %v", w.Source, w.Line, w.Pattern, w.Err)
+}
+
+func (w Warning) Unwrap() error {
+	return w.Err
+}
+
 // Parse reads gitignore-style patterns from an io.Reader and compiles them.
+// Patterns that fail to compile are skipped; use ParseWithWarnings to see them.
 // It handles:
 // - Blank lines (ignored)
 // - Comments starting with # (ignored)
@@ -17,7 +37,16 @@ import (
 // - Anchored patterns (leading /)
 // - Directory-only patterns (trailing /)
 func Parse(r io.Reader) ([]Pattern, error) {
-	var patterns []Pattern
+	patterns, _, err := ParseWithWarnings(r)
+	return patterns, err
+}
+
+// ParseWithWarnings is like Parse but also reports every skipped pattern.
+func ParseWithWarnings(r io.Reader) ([]Pattern, []Warning, error) {
+	var (
+		patterns []Pattern
+		warnings []Warning
+	)
 
 	scanner := bufio.NewScanner(r)
 	lineNumber := 0
@@ -45,6 +74,7 @@ func Parse(r io.Reader) ([]Pattern, error) {
 
 		p, err := Compile(line, lineNumber)
 		if err != nil {
+			warnings = append(warnings, Warning{Line: lineNumber, Pattern: line, Err: err})
 			continue
 		}
 
@@ -52,10 +82,10 @@ func Parse(r io.Reader) ([]Pattern, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("read ignore patterns: %w", err)
+		return nil, nil, fmt.Errorf("read ignore patterns: %w", err)
 	}
 
-	return patterns, nil
+	return patterns, warnings, nil
 }
 
 // processEscapes handles escape sequences in gitignore patterns.
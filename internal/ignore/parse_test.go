@@ -273,3 +273,46 @@ func TestParseEscaping(t *testing.T) {
 		})
 	}
 }
+
+func TestParseWithWarnings(t *testing.T) {
+	t.Parallel()
+
+	input := "*.log\n[unclosed\n# comment\nbuild/\nfoo[\n"
+	patterns, warnings, err := ParseWithWarnings(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseWithWarnings() error = %v", err)
+	}
+
+	if len(patterns) != 2 {
+		t.Errorf("len(patterns) = %d, want 2", len(patterns))
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("len(warnings) = %d, want 2", len(warnings))
+	}
+
+	want := []struct {
+		line    int
+		pattern string
+	}{
+		{2, "[unclosed"},
+		{5, "foo["},
+	}
+	for i, w := range want {
+		if warnings[i].Line != w.line || warnings[i].Pattern != w.pattern {
+			t.Errorf("warnings[%d] = line %d %q, want line %d %q",
+				i, warnings[i].Line, warnings[i].Pattern, w.line, w.pattern)
+		}
+		if warnings[i].Err == nil {
+			t.Errorf("warnings[%d].Err = nil", i)
+		}
+	}
+
+	// Parse keeps its lenient behavior
+	lenient, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(lenient) != len(patterns) {
+		t.Errorf("len(Parse()) = %d, want %d", len(lenient), len(patterns))
+	}
+}
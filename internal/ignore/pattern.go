@@ -3,19 +3,40 @@ package ignore
 import (
 	"errors"
 	"fmt"
-	"path/filepath"
+	"path"
 	"strings"
 )
 
 type Pattern struct {
-	original   string // original pattern text as written
-	pattern    string // normalized pattern for matching
-	negated    bool   // ! prefix - negates the match
-	anchored   bool   // / at start or contains / - only matches at root
-	dirOnly    bool   // / at end - only matches directories
-	lineNumber int    // source line number for debugging
+	original   string   // original pattern text as written
+	pattern    string   // normalized pattern for matching
+	segments   []string // pattern split at slashes, unanchored ones led by **
+	negated    bool     // ! prefix - negates the match
+	anchored   bool     // / at start or contains / - only matches at root
+	dirOnly    bool     // / at end - only matches directories
+	lineNumber int      // source line number for debugging
+	source     string   // file the pattern was loaded from (empty if not from a file)
 }
 
+// Original returns the pattern text as written, after escape processing.
+func (p *Pattern) Original() string { return p.original }
+
+// Negated reports whether the pattern re-includes matching paths (! prefix).
+func (p *Pattern) Negated() bool { return p.negated }
+
+// Anchored reports whether the pattern only matches relative to the root.
+func (p *Pattern) Anchored() bool { return p.anchored }
+
+// DirOnly reports whether the pattern only matches directories (trailing /).
+func (p *Pattern) DirOnly() bool { return p.dirOnly }
+
+// LineNumber returns the line the pattern was read from.
+func (p *Pattern) LineNumber() int { return p.lineNumber }
+
+// Source returns the file the pattern was loaded from, or "" if it was not
+// loaded from a file.
+func (p *Pattern) Source() string { return p.source }
+
 func Compile(pattern string, lineNumber int) (*Pattern, error) {
 	if pattern == "" {
 		return nil, errors.New("empty pattern")
@@ -56,313 +77,164 @@ func Compile(pattern string, lineNumber int) (*Pattern, error) {
 		}
 	}
 
-	if err := validatePattern(p.pattern); err != nil {
+	segments, err := compileSegments(p.pattern, p.anchored || strings.Contains(p.pattern, "/"))
+	if err != nil {
 		return nil, err
 	}
+	p.segments = segments
 
 	return p, nil
 }
 
-func validatePattern(pattern string) error {
-	testPattern := strings.ReplaceAll(pattern, "**", "*")
-
-	_, err := filepath.Match(testPattern, "test")
-	if err != nil {
-		return fmt.Errorf("invalid pattern: %w", err)
-	}
-	return nil
-}
-
-func (p *Pattern) Match(path string, isDir bool) bool {
-	if path == "" {
-		return false
-	}
-
-	// directory-only patterns only match directories
-	if p.dirOnly && !isDir {
-		return false
-	}
-
-	return p.matchPath(path)
-}
-
-func (p *Pattern) matchPath(path string) bool {
-	pattern := p.pattern
-
-	if strings.Contains(pattern, "**") {
-		return p.matchDoublestar(path)
+// compileSegments splits pattern into the globs for each path element, as
+// gitignore reads it: "**" alone in an element matches any number of
+// directories, anywhere else it is just "*", and a pattern without a slash
+// matches at any depth as if it began with "**/". Elements are matched with
+// path.Match, so no wildcard or character class ever matches a slash.
+func compileSegments(pattern string, anchored bool) ([]string, error) {
+	if pattern == "" {
+		return nil, nil // "/" alone matches nothing
 	}
-
-	// for anchored patterns, match against the full path
-	if p.anchored {
-		return matchGlob(pattern, path)
+	var segments []string
+	if !anchored {
+		segments = append(segments, doublestar)
 	}
-
-	// for non-anchored patterns without slashes, match against basename
-	// at any level of the path hierarchy
-	if !strings.Contains(pattern, "/") {
-		// try matching the basename
-		if matchGlob(pattern, filepath.Base(path)) {
-			return true
-		}
-		// for deeper paths, try matching each component
-		for part := range strings.SplitSeq(path, "/") {
-			if matchGlob(pattern, part) {
-				return true
+	for _, seg := range splitPattern(pattern) {
+		if seg == doublestar {
+			if len(segments) > 0 && segments[len(segments)-1] == doublestar {
+				continue // a/**/**/b is a/**/b
 			}
+			segments = append(segments, seg)
+			continue
 		}
-		return false
-	}
-
-	// pattern contains / but is not anchored - this shouldn't happen
-	// as patterns with / are implicitly anchored, but handle it anyway
-	return matchGlob(pattern, path)
-}
-
-func (p *Pattern) matchDoublestar(path string) bool {
-	pattern := p.pattern
-
-	// handle patterns like **/foo/** (leading and trailing doublestar)
-	if strings.HasPrefix(pattern, "**/") && strings.HasSuffix(pattern, "/**") {
-		return p.matchBothDoublestars(path, pattern)
-	}
-
-	// handle leading **/ - matches any prefix
-	if strings.HasPrefix(pattern, "**/") {
-		return p.matchLeadingDoublestar(path, pattern)
-	}
-
-	// handle trailing /** - matches any suffix
-	if strings.HasSuffix(pattern, "/**") {
-		return p.matchTrailingDoublestar(path, pattern)
-	}
-
-	// handle ** in the middle
-	idx := strings.Index(pattern, "/**/")
-	if idx != -1 {
-		prefix := pattern[:idx]
-		suffix := pattern[idx+4:]
-		return matchWithMiddleDoublestar(path, prefix, suffix, p.anchored)
-	}
-
-	// handle pattern like "a/**/z" where ** is not surrounded by /
-	parts := strings.SplitN(pattern, "**", 2)
-	if len(parts) == 2 {
-		prefix := strings.TrimSuffix(parts[0], "/")
-		suffix := strings.TrimPrefix(parts[1], "/")
-		return matchWithMiddleDoublestar(path, prefix, suffix, p.anchored)
-	}
-
-	return false
-}
-
-func (p *Pattern) matchBothDoublestars(path, pattern string) bool {
-	middle := pattern[3 : len(pattern)-3]
-	parts := strings.Split(path, "/")
-
-	if strings.Contains(middle, "/") {
-		return p.matchMultiComponentMiddle(parts, middle)
-	}
-	return p.matchSingleComponentMiddle(parts, middle)
-}
-
-func (p *Pattern) matchMultiComponentMiddle(parts []string, middle string) bool {
-	middleParts := strings.Split(middle, "/")
-	maxStart := len(parts) - len(middleParts) - 1
-	for i := 0; i <= maxStart; i++ {
-		if matchSequence(parts[i:i+len(middleParts)], middleParts) {
-			return true
-		}
-	}
-	return false
-}
-
-func (p *Pattern) matchSingleComponentMiddle(parts []string, middle string) bool {
-	for i, part := range parts {
-		if matchGlob(middle, part) && i < len(parts)-1 {
-			return true
+		if seg == "" {
+			continue // a//b is a/b
 		}
-	}
-	return false
-}
-
-func matchSequence(pathParts, patternParts []string) bool {
-	for j, mp := range patternParts {
-		if !matchGlob(mp, pathParts[j]) {
-			return false
+		seg = convertCharClasses(strings.ReplaceAll(seg, doublestar, "*"))
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
 		}
+		segments = append(segments, seg)
 	}
-	return true
+	return segments, nil
 }
 
-func (p *Pattern) matchLeadingDoublestar(path, pattern string) bool {
-	rest := pattern[3:]
-	parts := strings.Split(path, "/")
+const doublestar = "**"
 
-	// if rest still contains **, recurse
-	if strings.Contains(rest, "**") {
-		subPattern := &Pattern{pattern: rest, anchored: false}
-		for i := range parts {
-			if subPattern.matchDoublestar(strings.Join(parts[i:], "/")) {
-				return true
-			}
-		}
+// Match reports whether the pattern matches path, slash-separated and
+// relative to the root, or one of the directories above it: everything
+// inside an ignored directory is ignored with it, as in git. dirOnly
+// patterns match path itself only if isDir.
+func (p *Pattern) Match(path string, isDir bool) bool {
+	if path == "" {
 		return false
 	}
 
-	// try matching from any position
-	if matchGlob(rest, path) {
-		return true
-	}
-	for i := range parts {
-		if matchGlob(rest, strings.Join(parts[i:], "/")) {
-			return true
-		}
-	}
-	return false
-}
-
-func (p *Pattern) matchTrailingDoublestar(path, pattern string) bool {
-	prefix := pattern[:len(pattern)-3]
 	parts := strings.Split(path, "/")
-
-	// if prefix contains **, handle recursively
-	if strings.Contains(prefix, "**") {
-		subPattern := &Pattern{pattern: prefix, anchored: p.anchored}
-		for i := range parts {
-			if subPattern.matchDoublestar(strings.Join(parts[:i+1], "/")) {
-				return true
-			}
+	for n := 1; n <= len(parts); n++ {
+		if n == len(parts) && p.dirOnly && !isDir {
+			break
 		}
-		return false
-	}
-
-	if p.anchored {
-		return strings.HasPrefix(path, prefix+"/") || path == prefix
-	}
-
-	// for non-anchored, check any position
-	for i := 0; i < len(parts)-1; i++ {
-		subpath := strings.Join(parts[:i+1], "/")
-		if matchGlob(prefix, subpath) {
-			return true
-		}
-		if !strings.Contains(prefix, "/") && matchGlob(prefix, parts[i]) {
+		if matchSegments(p.segments, parts[:n]) {
 			return true
 		}
 	}
 	return false
 }
 
-func matchWithMiddleDoublestar(path, prefix, suffix string, anchored bool) bool {
-	pathParts := strings.Split(path, "/")
-
-	// find all positions where prefix matches
-	var prefixMatches []int
-	for i := range pathParts {
-		var subpath string
-		if i == 0 {
-			subpath = pathParts[0]
-		} else {
-			subpath = strings.Join(pathParts[:i+1], "/")
-		}
-
-		if anchored {
-			// for anchored patterns, only match at start
-			if i == 0 && matchGlob(prefix, subpath) {
-				prefixMatches = append(prefixMatches, i)
-			} else if prefix == "" {
-				prefixMatches = append(prefixMatches, -1) // match before first element
+// matchSegments reports whether the globs in segments match parts element
+// by element. A "**" matches zero or more elements, except at the end,
+// where it needs at least one so "a/**" matches what is inside a, not a.
+func matchSegments(segments, parts []string) bool {
+	for len(segments) > 0 {
+		seg := segments[0]
+		if seg == doublestar {
+			if len(segments) == 1 {
+				return len(parts) > 0
 			}
-		} else {
-			if matchGlob(prefix, pathParts[i]) {
-				prefixMatches = append(prefixMatches, i)
-			}
-		}
-	}
-
-	// special case: empty prefix matches at start
-	if prefix == "" {
-		prefixMatches = append(prefixMatches, -1)
-	}
-
-	// for each prefix match, try matching suffix at any subsequent position
-	for _, prefixEnd := range prefixMatches {
-		for suffixStart := prefixEnd + 1; suffixStart < len(pathParts); suffixStart++ {
-			remaining := strings.Join(pathParts[suffixStart:], "/")
-			if matchGlob(suffix, remaining) {
-				return true
-			}
-			// also try matching just the component
-			if !strings.Contains(suffix, "/") && matchGlob(suffix, pathParts[suffixStart]) {
-				// only match if this is the last component or suffix matches rest
-				if suffixStart == len(pathParts)-1 {
+			for i := range len(parts) + 1 {
+				if matchSegments(segments[1:], parts[i:]) {
 					return true
 				}
 			}
+			return false
 		}
-		// also try matching suffix against the remaining path
-		if prefixEnd+1 < len(pathParts) {
-			remaining := strings.Join(pathParts[prefixEnd+1:], "/")
-			if matchGlob(suffix, remaining) {
-				return true
-			}
+		if len(parts) == 0 {
+			return false
 		}
+		if ok, _ := path.Match(seg, parts[0]); !ok {
+			return false
+		}
+		segments, parts = segments[1:], parts[1:]
 	}
-
-	return false
+	return len(parts) == 0
 }
 
-func matchGlob(pattern, name string) bool {
-	// handle empty cases
-	if pattern == "" && name == "" {
-		return true
-	}
-	if pattern == "" || name == "" {
-		return pattern == "" && name == ""
+// splitPattern splits pattern at the slashes outside character classes and
+// escapes; a class holding a slash then simply never matches.
+func splitPattern(pattern string) []string {
+	var (
+		segments  []string
+		start     int
+		inBracket bool
+	)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case c == '[' && !inBracket:
+			inBracket = true
+			// a ] first in a class is literal, so skip it
+			if i+1 < len(pattern) && (pattern[i+1] == '!' || pattern[i+1] == '^') {
+				i++
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == ']' && inBracket:
+			inBracket = false
+		case c == '/' && !inBracket:
+			segments = append(segments, pattern[start:i])
+			start = i + 1
+		}
 	}
+	return append(segments, pattern[start:])
+}
 
-	// convert ! in character classes to ^ for filepath.Match
-	pattern = convertCharClassNegation(pattern)
-
-	matched, err := filepath.Match(pattern, name)
-	if err != nil {
-		return false
+// convertCharClasses rewrites gitignore's character classes in path.Match
+// syntax: [!...] becomes [^...], and a ] first in a class, which gitignore
+// reads literally, is escaped.
+func convertCharClasses(pattern string) string {
+	if !strings.Contains(pattern, "[") {
+		return pattern
 	}
-	return matched
-}
 
-func convertCharClassNegation(pattern string) string {
 	var result strings.Builder
-	result.Grow(len(pattern))
-
-	var (
-		inBracket = false
-		afterOpen = false
-	)
+	result.Grow(len(pattern) + 2)
 
+	inBracket := false
 	for i := 0; i < len(pattern); i++ {
 		c := pattern[i]
-
-		if c == '[' && !inBracket {
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			result.WriteByte(c)
+			i++
+			c = pattern[i]
+		case c == '[' && !inBracket:
 			inBracket = true
-			afterOpen = true
 			result.WriteByte(c)
-			continue
-		}
-
-		if inBracket {
-			if afterOpen && c == '!' {
+			if i+1 < len(pattern) && (pattern[i+1] == '!' || pattern[i+1] == '^') {
 				result.WriteByte('^')
-				afterOpen = false
-				continue
+				i++
 			}
-			if c == ']' {
-				inBracket = false
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				result.WriteString("\\]")
+				i++
 			}
-			afterOpen = false
+			continue
+		case c == ']' && inBracket:
+			inBracket = false
 		}
-
 		result.WriteByte(c)
 	}
 
@@ -1,6 +1,9 @@
 package ignore
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -377,3 +380,37 @@ func TestCompileInvalid(t *testing.T) {
 		})
 	}
 }
+
+// TestGitignoreCompat runs the cases in testdata/gitignore.txt, each checked
+// against git check-ignore.
+func TestGitignoreCompat(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "gitignore.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			t.Fatalf("testdata/gitignore.txt:%d: want 3 tab-separated fields, got %q", i+1, line)
+		}
+		pattern, p, want := fields[0], fields[1], fields[2] == "ignored"
+
+		ign, err := New(strings.NewReader(pattern))
+		if err != nil {
+			t.Fatalf("line %d: New(%q) error = %v", i+1, pattern, err)
+		}
+		if w := ign.Warnings(); len(w) > 0 {
+			t.Errorf("line %d: %q: %v", i+1, pattern, w[0])
+			continue
+		}
+		isDir := strings.HasSuffix(p, "/")
+		if got := ign.Match(strings.TrimSuffix(p, "/"), isDir); got != want {
+			t.Errorf("line %d: %q.Match(%q, isDir=%v) = %v, want %v", i+1, pattern, p, isDir, got, want)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+// Package image loads container images from local archives into smerkle
+// trees, so images can be hashed and diffed at the file level.
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/chunk"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/treebuild"
+)
+
+var (
+	ErrUnknownFormat    = errors.New("image: not a docker-save archive or OCI image layout")
+	ErrUnsupportedLayer = errors.New("image: unsupported layer compression")
+	errMemberNotFound   = errors.New("image: archive member not found")
+)
+
+const (
+	whiteoutPrefix       = ".wh."
+	whiteoutOpaque       = ".wh..wh..opq"
+	mediaTypeIndexSuffix = "index.v1+json"
+	maxIndexDepth        = 2 // nested OCI indexes followed before giving up
+)
+
+// Options configures Load.
+type Options struct {
+	// ChunkThreshold stores files of at least this many bytes as chunks, as
+	// hash --chunk-threshold does; 0 never chunks.
+	ChunkThreshold int64
+}
+
+// Result describes a loaded image.
+type Result struct {
+	Root    object.Hash
+	Layers  int
+	Skipped []string // devices, fifos and dangling hardlinks, which trees can't hold
+}
+
+// Load reads the image at p, which is a `docker save` tarball or an OCI
+// image layout (directory or tarball), applies its layers in order including
+// whiteouts, and stores the merged filesystem. Only the first image in the
+// archive is loaded.
+func Load(s *store.Store, p string, opts Options) (*Result, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("stat image: %w", err)
+	}
+	var src source = dirSource{root: p}
+	if !info.IsDir() {
+		t, err := openTar(p)
+		if err != nil {
+			return nil, err
+		}
+		defer t.close() //nolint:errcheck // read-only
+		src = t
+	}
+
+	layers, err := layerNames(src)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Layers: len(layers)}
+	b := treebuild.New()
+	for _, name := range layers {
+		if err := applyLayer(s, src, name, opts, b, res); err != nil {
+			return nil, fmt.Errorf("layer %s: %w", name, err)
+		}
+	}
+
+	res.Root, err = b.Write(s)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // treebuild errors already carry context
+	}
+	return res, nil
+}
+
+// source reads members of an image by their slash-separated name.
+type source interface {
+	open(name string) (io.ReadCloser, error)
+}
+
+type dirSource struct {
+	root string
+}
+
+func (d dirSource) open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(d.root, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", errMemberNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	return f, nil
+}
+
+// tarSource reads members straight from the archive at offsets found in one
+// pass over its headers, so nothing is extracted to disk and opening a
+// member never rescans the layers before it.
+type tarSource struct {
+	f       *os.File
+	members map[string]tarMember
+}
+
+type tarMember struct {
+	offset, size int64
+}
+
+func openTar(p string) (*tarSource, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("open image: %w", err)
+	}
+	t := &tarSource{f: f, members: make(map[string]tarMember)}
+	// tar.Reader reads headers block by block and seeks over member data,
+	// so after Next the file offset is where the member's data starts
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return t, nil
+		}
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("read image archive: %w", err)
+		}
+		name := cleanName(hdr.Name)
+		if _, ok := t.members[name]; ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("read image archive: %w", err)
+		}
+		t.members[name] = tarMember{offset: offset, size: hdr.Size}
+	}
+}
+
+func (t *tarSource) open(name string) (io.ReadCloser, error) {
+	m, ok := t.members[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errMemberNotFound, name)
+	}
+	return io.NopCloser(io.NewSectionReader(t.f, m.offset, m.size)), nil
+}
+
+func (t *tarSource) close() error {
+	return t.f.Close() //nolint:wrapcheck // read-only
+}
+
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func readJSON(src source, name string, v any) error {
+	r, err := src.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint:errcheck // read-only
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// layerNames returns the member names of the image's layers, bottom first.
+func layerNames(src source) ([]string, error) {
+	// docker save, including the OCI-style archives newer dockers write
+	var manifest []struct {
+		Layers []string
+	}
+	err := readJSON(src, "manifest.json", &manifest)
+	if err == nil {
+		if len(manifest) == 0 {
+			return nil, errors.New("manifest.json lists no images")
+		}
+		names := make([]string, len(manifest[0].Layers))
+		for i, l := range manifest[0].Layers {
+			names[i] = cleanName(l)
+		}
+		return names, nil
+	}
+	if !errors.Is(err, errMemberNotFound) {
+		return nil, err
+	}
+
+	// OCI image layout
+	type descriptor struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	}
+	var index struct {
+		Manifests []descriptor `json:"manifests"`
+	}
+	if err := readJSON(src, "index.json", &index); err != nil {
+		if errors.Is(err, errMemberNotFound) {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+
+	for range maxIndexDepth + 1 {
+		if len(index.Manifests) == 0 {
+			return nil, errors.New("image index lists no manifests")
+		}
+		desc := index.Manifests[0]
+		if !strings.HasSuffix(desc.MediaType, mediaTypeIndexSuffix) {
+			var m struct {
+				Layers []descriptor `json:"layers"`
+			}
+			if err := readJSON(src, blobName(desc.Digest), &m); err != nil {
+				return nil, err
+			}
+			names := make([]string, len(m.Layers))
+			for i, l := range m.Layers {
+				names[i] = blobName(l.Digest)
+			}
+			return names, nil
+		}
+		// multi-platform index: follow its first entry
+		index.Manifests = nil
+		if err := readJSON(src, blobName(desc.Digest), &index); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("image indexes nested too deeply")
+}
+
+// blobName maps "sha256:abc" to its OCI layout path.
+func blobName(digest string) string {
+	alg, hex, _ := strings.Cut(digest, ":")
+	return "blobs/" + alg + "/" + hex
+}
+
+// decompress detects the layer's compression from its magic bytes, since
+// docker-save archives don't record media types.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read layer: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return zr, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, fmt.Errorf("%w: zstd", ErrUnsupportedLayer)
+	default:
+		return br, nil
+	}
+}
+
+// applyLayer merges one layer into b. Whiteouts only hide content from lower
+// layers, so they are applied before any of the layer's own entries.
+func applyLayer(s *store.Store, src source, name string, opts Options, b *treebuild.Builder, res *Result) error {
+	rc, err := src.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close() //nolint:errcheck // read-only
+
+	r, err := decompress(rc)
+	if err != nil {
+		return err
+	}
+
+	var (
+		removes, clears []string
+		adds            []func()
+	)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read layer: %w", err)
+		}
+
+		p := cleanName(hdr.Name)
+		dir, base := path.Dir(p), path.Base(p)
+		switch {
+		case base == whiteoutOpaque:
+			clears = append(clears, dir)
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			removes = append(removes, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			continue
+		case p == "":
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			adds = append(adds, func() { b.Mkdir(p) })
+		case tar.TypeReg:
+			h, err := putFile(s, tr, hdr.Size, opts.ChunkThreshold)
+			if err != nil {
+				return fmt.Errorf("put %s: %w", p, err)
+			}
+			mode := object.ModeRegular
+			if hdr.Mode&0o111 != 0 {
+				mode = object.ModeExecutable
+			}
+			e := object.Entry{Mode: mode, Size: hdr.Size, Hash: h}
+
+			adds = append(adds, func() { b.Add(p, e) })
+		case tar.TypeSymlink:
+			h, err := s.PutBlob(&object.Blob{Content: []byte(hdr.Linkname)})
+			if err != nil {
+				return fmt.Errorf("put blob %s: %w", p, err)
+			}
+			e := object.Entry{Mode: object.ModeSymlink, Size: int64(len(hdr.Linkname)), Hash: h}
+			adds = append(adds, func() { b.Add(p, e) })
+		case tar.TypeLink:
+			target := cleanName(hdr.Linkname)
+			adds = append(adds, func() {
+				e, ok := b.Lookup(target)
+				if !ok {
+					res.Skipped = append(res.Skipped, p)
+					return
+				}
+				b.Add(p, e)
+			})
+		default:
+			res.Skipped = append(res.Skipped, p)
+		}
+	}
+
+	for _, p := range removes {
+		b.Remove(p)
+	}
+	for _, p := range clears {
+		b.Clear(p)
+	}
+	for _, add := range adds {
+		add()
+	}
+	return nil
+}
+
+// putFile stores the size bytes of r as the walker stores a file that size:
+// streamed into one blob, or from chunkThreshold on split into chunks under
+// a manifest, so an image's root matches a walk of its extracted files.
+func putFile(s *store.Store, r io.Reader, size, chunkThreshold int64) (object.Hash, error) {
+	if chunkThreshold <= 0 || size < chunkThreshold {
+		h, err := s.PutBlobFrom(r, size)
+		if err != nil {
+			return object.ZeroHash, fmt.Errorf("put blob: %w", err)
+		}
+		return h, nil
+	}
+
+	sp := chunk.NewSplitter(io.LimitReader(r, size))
+	m := &object.Manifest{}
+	for {
+		c, err := sp.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return object.ZeroHash, fmt.Errorf("read: %w", err)
+		}
+		h, err := s.PutBlob(&object.Blob{Content: c})
+		if err != nil {
+			return object.ZeroHash, fmt.Errorf("put chunk: %w", err)
+		}
+		m.Chunks = append(m.Chunks, object.Chunk{Hash: h, Size: uint32(len(c))}) //nolint:gosec // chunks are at most chunk.MaxSize
+	}
+	h, err := s.PutManifest(m)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("put manifest: %w", err)
+	}
+	return h, nil
+}
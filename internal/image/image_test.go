@@ -0,0 +1,291 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/chunk"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+type member struct {
+	name     string
+	typeflag byte
+	content  string // file content or link target
+	mode     int64
+}
+
+func tarBytes(t *testing.T, members []member) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Typeflag: m.typeflag, Mode: m.mode}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+		}
+		switch m.typeflag {
+		case tar.TypeReg:
+			hdr.Size = int64(len(m.content))
+		case tar.TypeSymlink, tar.TypeLink:
+			hdr.Linkname = m.content
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader() error = %v", err)
+		}
+		if m.typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(m.content)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("gzip Write() error = %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// layers: base has a few files; top deletes, replaces, and hides a directory.
+func testLayers(t *testing.T) [][]byte {
+	t.Helper()
+	base := tarBytes(t, []member{
+		{name: "etc/", typeflag: tar.TypeDir},
+		{name: "etc/config", typeflag: tar.TypeReg, content: "v1"},
+		{name: "bin/tool", typeflag: tar.TypeReg, content: "#!", mode: 0o755},
+		{name: "bin/alias", typeflag: tar.TypeSymlink, content: "tool"},
+		{name: "tmp/junk", typeflag: tar.TypeReg, content: "junk"},
+		{name: "cache/a", typeflag: tar.TypeReg, content: "a"},
+		{name: "dev/null", typeflag: tar.TypeChar},
+	})
+	top := tarBytes(t, []member{
+		{name: "etc/config", typeflag: tar.TypeReg, content: "v2"},
+		{name: "etc/hardlink", typeflag: tar.TypeLink, content: "etc/config"},
+		{name: "cache/b", typeflag: tar.TypeReg, content: "b"},
+		{name: "cache/.wh..wh..opq", typeflag: tar.TypeReg},
+		{name: "tmp/.wh.junk", typeflag: tar.TypeReg},
+	})
+	return [][]byte{base, top}
+}
+
+func writeDockerSave(t *testing.T, layers [][]byte) string {
+	t.Helper()
+	var members []member
+	var names []string
+	for i, l := range layers {
+		name := string(rune('a'+i)) + "/layer.tar"
+		names = append(names, name)
+		members = append(members, member{name: name, typeflag: tar.TypeReg, content: string(l)})
+	}
+	manifest, err := json.Marshal([]map[string]any{{"Config": "config.json", "Layers": names}})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	members = append(members, member{name: "manifest.json", typeflag: tar.TypeReg, content: string(manifest)})
+
+	p := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(p, tarBytes(t, members), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return p
+}
+
+func writeOCILayout(t *testing.T, layers [][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	putBlob := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		p := filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:]))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(p, data, 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return digest
+	}
+	mustJSON := func(v any) []byte {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		return data
+	}
+
+	var descs []map[string]string
+	for _, l := range layers {
+		descs = append(descs, map[string]string{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"digest":    putBlob(gzipBytes(t, l)),
+		})
+	}
+	manifest := putBlob(mustJSON(map[string]any{"layers": descs}))
+	index := putBlob(mustJSON(map[string]any{"manifests": []map[string]string{
+		{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": manifest},
+	}}))
+	top := mustJSON(map[string]any{"manifests": []map[string]string{
+		{"mediaType": "application/vnd.oci.image.index.v1+json", "digest": index},
+	}})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), top, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return dir
+}
+
+// listFiles flattens a tree into "path mode content" lines.
+func listFiles(t *testing.T, s *store.Store, h object.Hash, prefix string) []string {
+	t.Helper()
+	tree, err := s.GetTree(h)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	var out []string
+	for _, e := range tree.Entries {
+		p := prefix + e.Name
+		if e.Mode == object.ModeDirectory {
+			out = append(out, p+"/")
+			out = append(out, listFiles(t, s, e.Hash, p+"/")...)
+			continue
+		}
+		blob, err := s.GetBlob(e.Hash)
+		if err != nil {
+			t.Fatalf("GetBlob() error = %v", err)
+		}
+		out = append(out, p+" "+e.Mode.String()+" "+string(blob.Content))
+	}
+	return out
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	want := []string{
+		"bin/",
+		"bin/alias symlink tool",
+		"bin/tool executable #!",
+		"cache/",
+		"cache/b regular b",
+		"etc/",
+		"etc/config regular v2",
+		"etc/hardlink regular v2",
+		"tmp/",
+	}
+
+	tests := []struct {
+		name  string
+		write func(*testing.T, [][]byte) string
+	}{
+		{name: "docker save", write: writeDockerSave},
+		{name: "oci layout", write: writeOCILayout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := store.Open(t.TempDir())
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer s.Close() //nolint:errcheck // Close() in a test
+
+			res, err := Load(s, tt.write(t, testLayers(t)), Options{})
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if res.Layers != 2 {
+				t.Errorf("Layers = %d, want 2", res.Layers)
+			}
+			if len(res.Skipped) != 1 || res.Skipped[0] != "dev/null" {
+				t.Errorf("Skipped = %v, want [dev/null]", res.Skipped)
+			}
+
+			got := listFiles(t, s, res.Root, "")
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("files =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLoadUnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	if _, err := Load(s, t.TempDir(), Options{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Load() error = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestLoadChunked(t *testing.T) {
+	t.Parallel()
+
+	big := make([]byte, 3*chunk.MinSize)
+	_, _ = rand.NewChaCha8([32]byte{}).Read(big)
+	layer := tarBytes(t, []member{
+		{name: "data/big", typeflag: tar.TypeReg, content: string(big)},
+		{name: "data/small", typeflag: tar.TypeReg, content: "small"},
+	})
+	p := writeDockerSave(t, [][]byte{layer})
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0o755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	for name, content := range map[string][]byte{"big": big, "small": []byte("small")} {
+		if err := os.WriteFile(filepath.Join(dir, "data", name), content, 0o644); err != nil { //nolint:gosec // test file
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	for _, threshold := range []int64{0, 1024} {
+		s, err := store.Open(t.TempDir())
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer s.Close() //nolint:errcheck // Close() in a test
+
+		loaded, err := Load(s, p, Options{ChunkThreshold: threshold})
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		walked, err := walker.Walk(context.Background(), dir, s, walker.WithChunking(threshold))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if loaded.Root != walked.Hash {
+			t.Errorf("threshold %d: Load() root = %s, want extracted walk %s", threshold, loaded.Root, walked.Hash)
+		}
+	}
+}
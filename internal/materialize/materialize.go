@@ -0,0 +1,268 @@
+// Package materialize writes stored trees back to disk, the inverse of the
+// walker: hashing a restored directory yields the tree it came from.
+package materialize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+var (
+	ErrDestNotEmpty = errors.New("materialize: destination is not empty")
+	ErrInvalidName  = errors.New("materialize: invalid entry name")
+)
+
+// trees without full metadata record no permissions beyond the executable
+// bit, so restored paths get the conventional ones, less the umask
+const (
+	dirPerm        = 0o755
+	filePerm       = 0o644
+	executablePerm = 0o755
+)
+
+// Result counts what a restore wrote.
+type Result struct {
+	Dirs     int
+	Files    int
+	Symlinks int
+	Skipped  []string // entries with no filesystem form, such as inaccessible placeholders
+	Removed  int      // paths Update removed or replaced
+}
+
+// Restore writes the tree root to dest, which must not exist or be an empty
+// directory. Existing paths are never replaced, so a tree with duplicate
+// names fails rather than writing through a symlink it created.
+func Restore(ctx context.Context, s *store.Store, root object.Hash, dest string) (*Result, error) {
+	if err := prepareDest(dest); err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	if err := restoreTree(ctx, s, root, dest, "", res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Update turns dest, a directory holding the tree oldRoot, into newRoot:
+// paths only in oldRoot are removed, those only in newRoot written, and
+// changed ones replaced, leaving unchanged paths and subtrees untouched.
+// What dest holds isn't checked against oldRoot beyond that.
+func Update(ctx context.Context, s *store.Store, oldRoot, newRoot object.Hash, dest string) (*Result, error) {
+	res := &Result{}
+	if err := updateTree(ctx, s, oldRoot, newRoot, dest, "", res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func updateTree(ctx context.Context, s *store.Store, oldHash, newHash object.Hash, dir, prefix string, res *Result) error {
+	if oldHash == newHash {
+		return nil
+	}
+	oldTree, err := s.GetTree(oldHash)
+	if err != nil {
+		return fmt.Errorf("get tree %s: %w", oldHash, err)
+	}
+	newTree, err := s.GetTree(newHash)
+	if err != nil {
+		return fmt.Errorf("get tree %s: %w", newHash, err)
+	}
+
+	// both trees are sorted by name, so one pass pairs their entries
+	olds, news := oldTree.Entries, newTree.Entries
+	for len(olds) > 0 || len(news) > 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context: %w", err)
+		}
+
+		var o, n *object.Entry
+		switch {
+		case len(news) == 0 || (len(olds) > 0 && olds[0].Name < news[0].Name):
+			o, olds = &olds[0], olds[1:]
+		case len(olds) == 0 || news[0].Name < olds[0].Name:
+			n, news = &news[0], news[1:]
+		default:
+			o, n, olds, news = &olds[0], &news[0], olds[1:], news[1:]
+		}
+
+		name := n
+		if name == nil {
+			name = o
+		}
+		if !validName(name.Name) {
+			return fmt.Errorf("%w: %q in %s", ErrInvalidName, name.Name, newHash)
+		}
+		rel := name.Name
+		if prefix != "" {
+			rel = prefix + "/" + name.Name
+		}
+		p := filepath.Join(dir, name.Name)
+
+		if o != nil && n != nil {
+			if o.Mode == n.Mode && o.Hash == n.Hash {
+				if !o.Meta.Equal(n.Meta) || !o.ModTime.Equal(n.ModTime) {
+					if err := applyMeta(p, n, o.Meta); err != nil {
+						return fmt.Errorf("update metadata of %s: %w", rel, err)
+					}
+				}
+				continue
+			}
+			if o.Mode == object.ModeDirectory && n.Mode == object.ModeDirectory {
+				if o.Meta != nil && o.Meta.Perm&0o700 != 0o700 {
+					// the restored directory may deny its owner the access
+					// updating it needs until its metadata is set again
+					if err := os.Chmod(p, permMode(o.Meta.Perm|0o700)); err != nil {
+						return fmt.Errorf("update %s: %w", rel, err)
+					}
+				}
+				if err := updateTree(ctx, s, o.Hash, n.Hash, p, rel, res); err != nil {
+					return err
+				}
+				if err := applyMeta(p, n, o.Meta); err != nil {
+					return fmt.Errorf("update metadata of %s: %w", rel, err)
+				}
+				continue
+			}
+		}
+		if o != nil {
+			if err := os.RemoveAll(p); err != nil {
+				return fmt.Errorf("remove %s: %w", rel, err)
+			}
+			res.Removed++
+		}
+		if n != nil {
+			if err := restoreEntry(ctx, s, n, p, rel, res); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func prepareDest(dest string) error {
+	f, err := os.Open(dest) //nolint:gosec // the user names the destination
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dest, dirPerm); err != nil {
+			return fmt.Errorf("create destination: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open destination: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only
+
+	if _, err := f.Readdirnames(1); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return fmt.Errorf("read destination: %w", err)
+		}
+		return fmt.Errorf("%w: %s", ErrDestNotEmpty, dest)
+	}
+	return nil
+}
+
+func restoreTree(ctx context.Context, s *store.Store, h object.Hash, dir, prefix string, res *Result) error {
+	tree, err := s.GetTree(h)
+	if err != nil {
+		return fmt.Errorf("get tree %s: %w", h, err)
+	}
+
+	for i := range tree.Entries {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context: %w", err)
+		}
+
+		e := &tree.Entries[i]
+		rel := e.Name
+		if prefix != "" {
+			rel = prefix + "/" + e.Name
+		}
+		if !validName(e.Name) {
+			return fmt.Errorf("%w: %q in %s", ErrInvalidName, e.Name, h)
+		}
+		if err := restoreEntry(ctx, s, e, filepath.Join(dir, e.Name), rel, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreEntry writes e to p, which must not exist. Its metadata is set
+// last, after a directory's contents, which would change its time and may
+// need permissions it denies.
+func restoreEntry(ctx context.Context, s *store.Store, e *object.Entry, p, rel string, res *Result) error {
+	switch e.Mode {
+	case object.ModeDirectory:
+		if err := os.Mkdir(p, dirPerm); err != nil {
+			return fmt.Errorf("create directory %s: %w", rel, err)
+		}
+		res.Dirs++
+		if err := restoreTree(ctx, s, e.Hash, p, rel, res); err != nil {
+			return err
+		}
+	case object.ModeRegular, object.ModeExecutable:
+		if err := writeFile(s, e, p); err != nil {
+			return fmt.Errorf("restore %s: %w", rel, err)
+		}
+		res.Files++
+	case object.ModeSymlink:
+		target, err := s.ReadFile(e.Hash)
+		if err != nil {
+			return fmt.Errorf("read symlink %s: %w", rel, err)
+		}
+		if err := os.Symlink(string(target), p); err != nil {
+			return fmt.Errorf("create symlink %s: %w", rel, err)
+		}
+		res.Symlinks++
+	default:
+		res.Skipped = append(res.Skipped, rel)
+		return nil
+	}
+	if err := applyMeta(p, e, nil); err != nil {
+		return fmt.Errorf("restore metadata of %s: %w", rel, err)
+	}
+	return nil
+}
+
+// validName rejects names that would escape or alias their directory; the
+// walker never produces them, but trees can come from other stores.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsRune(name, '/') && !strings.ContainsRune(name, filepath.Separator) &&
+		!strings.ContainsRune(name, 0)
+}
+
+func writeFile(s *store.Store, e *object.Entry, p string) (err error) {
+	content, err := s.ReadFile(e.Hash)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", e.Hash, err)
+	}
+
+	perm := os.FileMode(filePerm)
+	if e.Mode == object.ModeExecutable {
+		perm = executablePerm
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm) //nolint:gosec // path is confined to dest by validName
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close: %w", cerr)
+		}
+	}()
+
+	if _, err := f.Write(content); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package materialize
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+func openStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func writeTestFile(t *testing.T, p string, content []byte, perm os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(p, content, perm); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "README.md"), []byte("# demo\n"), 0o600)
+	writeTestFile(t, filepath.Join(src, "bin", "run"), []byte("#!/bin/sh\n"), 0o700)
+	big := make([]byte, 256<<10)
+	rng := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // deterministic test data
+	for i := range big {
+		big[i] = byte(rng.IntN(256))
+	}
+	writeTestFile(t, filepath.Join(src, "data", "big.bin"), big, 0o600)
+	if err := os.Symlink("README.md", filepath.Join(src, "latest")); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(src, "empty"), 0o750); err != nil {
+		t.Fatalf("Mkdir() error = %v", err)
+	}
+
+	walked, err := walker.Walk(context.Background(), src, s, walker.WithChunking(64<<10))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "restored")
+	res, err := Restore(context.Background(), s, walked.Hash, dest)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if res.Files != 3 || res.Dirs != 3 || res.Symlinks != 1 || len(res.Skipped) != 0 {
+		t.Errorf("Restore() = %+v, want 3 files, 3 dirs, 1 symlink", res)
+	}
+
+	rewalked, err := walker.Walk(context.Background(), dest, s, walker.WithChunking(64<<10))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if rewalked.Hash != walked.Hash {
+		t.Errorf("restored hash = %s, want %s", rewalked.Hash, walked.Hash)
+	}
+}
+
+func TestRestoreDest(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	root, err := s.PutTree(&object.Tree{})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+
+	t.Run("empty directory", func(t *testing.T) {
+		t.Parallel()
+		if _, err := Restore(context.Background(), s, root, t.TempDir()); err != nil {
+			t.Errorf("Restore() error = %v", err)
+		}
+	})
+
+	t.Run("not empty", func(t *testing.T) {
+		t.Parallel()
+		dest := t.TempDir()
+		writeTestFile(t, filepath.Join(dest, "keep"), []byte("x"), 0o600)
+		if _, err := Restore(context.Background(), s, root, dest); !errors.Is(err, ErrDestNotEmpty) {
+			t.Errorf("Restore() error = %v, want %v", err, ErrDestNotEmpty)
+		}
+	})
+}
+
+func TestRestoreRejectsEscapingNames(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	blob, err := s.PutBlob(&object.Blob{Content: []byte("x")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+
+	for _, name := range []string{"..", "a/b"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root, err := s.PutTree(&object.Tree{Entries: []object.Entry{
+				{Name: name, Mode: object.ModeRegular, Size: 1, Hash: blob},
+			}})
+			if err != nil {
+				t.Fatalf("PutTree() error = %v", err)
+			}
+			if _, err := Restore(context.Background(), s, root, t.TempDir()); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("Restore() error = %v, want %v", err, ErrInvalidName)
+			}
+		})
+	}
+}
+
+func TestRestoreSkipsInaccessible(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	root, err := s.PutTree(&object.Tree{Entries: []object.Entry{
+		{Name: "locked", Mode: object.ModeInaccessible},
+	}})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+
+	res, err := Restore(context.Background(), s, root, t.TempDir())
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if len(res.Skipped) != 1 || res.Skipped[0] != "locked" {
+		t.Errorf("Skipped = %v, want [locked]", res.Skipped)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "README.md"), []byte("# demo\n"), 0o600)
+	writeTestFile(t, filepath.Join(src, "src", "main.go"), []byte("package main\n"), 0o600)
+	writeTestFile(t, filepath.Join(src, "old", "gone.txt"), []byte("gone\n"), 0o600)
+	writeTestFile(t, filepath.Join(src, "kind"), []byte("a file\n"), 0o600)
+	before, err := walker.Walk(context.Background(), src, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	writeTestFile(t, filepath.Join(src, "src", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o700)
+	writeTestFile(t, filepath.Join(src, "docs", "guide.md"), []byte("guide\n"), 0o600)
+	if err := os.RemoveAll(filepath.Join(src, "old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(src, "kind")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "kind", "now-a-dir"), []byte("dir\n"), 0o600)
+	after, err := walker.Walk(context.Background(), src, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "work")
+	if _, err := Restore(context.Background(), s, before.Hash, dest); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	res, err := Update(context.Background(), s, before.Hash, after.Hash, dest)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	// main.go and kind replaced, old removed; main.go, guide.md, and now-a-dir written
+	if res.Removed != 3 || res.Files != 3 || res.Dirs != 2 {
+		t.Errorf("Update() = %+v, want 3 removed, 3 files, 2 dirs", res)
+	}
+
+	rewalked, err := walker.Walk(context.Background(), dest, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if rewalked.Hash != after.Hash {
+		t.Errorf("updated hash = %s, want %s", rewalked.Hash, after.Hash)
+	}
+}
+
+func TestRestoreMetadata(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	src := t.TempDir()
+	stamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(src, "secret"), []byte("secret\n"), 0o640)
+	writeTestFile(t, filepath.Join(src, "bin", "run"), []byte("#!/bin/sh\n"), 0o750)
+	writeTestFile(t, filepath.Join(src, "ro", "data"), []byte("data\n"), 0o444)
+	if runtime.GOOS == "linux" {
+		if err := os.Symlink("secret", filepath.Join(src, "link")); err != nil {
+			t.Fatalf("Symlink() error = %v", err)
+		}
+		// where the filesystem takes user attributes, they must come back
+		_ = setXattrs(filepath.Join(src, "secret"), []object.Xattr{{Name: "user.note", Value: []byte("kept")}}, nil)
+	}
+	for _, p := range []string{"secret", "bin/run", "bin", "ro/data", "ro"} {
+		if err := os.Chtimes(filepath.Join(src, p), stamp, stamp); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "ro"), 0o555); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	dest := filepath.Join(t.TempDir(), "restored")
+	// let the temp directories go whatever the test leaves read-only
+	t.Cleanup(func() {
+		_ = os.Chmod(filepath.Join(src, "ro"), 0o755)
+		_ = os.Chmod(filepath.Join(dest, "ro"), 0o755)
+	})
+
+	walk := func(root string) object.Hash {
+		t.Helper()
+		res, err := walker.Walk(context.Background(), root, s, walker.WithFullMetadata(), walker.WithModTimes())
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		return res.Hash
+	}
+
+	before := walk(src)
+	if _, err := Restore(context.Background(), s, before, dest); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := walk(dest); got != before {
+		t.Errorf("restored hash = %s, want %s", got, before)
+	}
+
+	// metadata-only changes, and a new file under the read-only directory
+	if err := os.Chmod(filepath.Join(src, "secret"), 0o600); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "bin", "run"), stamp, stamp.Add(time.Hour)); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if err := os.Chmod(filepath.Join(src, "ro"), 0o755); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	writeTestFile(t, filepath.Join(src, "ro", "more"), []byte("more\n"), 0o444)
+	if err := os.Chmod(filepath.Join(src, "ro"), 0o555); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	if runtime.GOOS == "linux" {
+		_ = setXattrs(filepath.Join(src, "secret"), nil, []string{"user.note"})
+	}
+	after := walk(src)
+	if after == before {
+		t.Fatal("metadata changes left the hash as it was")
+	}
+	if _, err := Update(context.Background(), s, before, after, dest); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := walk(dest); got != after {
+		t.Errorf("updated hash = %s, want %s", got, after)
+	}
+}
@@ -0,0 +1,84 @@
+package materialize
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// ErrMetadataUnsupported is returned for trees holding metadata this
+// platform can't set, such as extended attributes outside Linux.
+var ErrMetadataUnsupported = errors.New("materialize: metadata can't be restored on this platform")
+
+// applyMeta gives p the metadata and modification time e records, if any,
+// so full-metadata and mtime-inclusive trees hash back to the same root.
+// The owner goes first, since changing it clears setuid and setgid, and the
+// time last. prev is the metadata p already carries, if any; extended
+// attributes it lists that e doesn't are removed.
+func applyMeta(p string, e *object.Entry, prev *object.Metadata) error {
+	symlink := e.Mode == object.ModeSymlink
+	if m := e.Meta; m != nil {
+		// Windows files have no numeric owner, so walks there record none
+		if runtime.GOOS != "windows" {
+			if err := os.Lchown(p, int(m.UID), int(m.GID)); err != nil {
+				return fmt.Errorf("set owner: %w", err)
+			}
+		}
+		// a symlink's own permissions can't be set, and it carries no
+		// extended attributes of its own
+		if !symlink {
+			if err := os.Chmod(p, permMode(m.Perm)); err != nil {
+				return fmt.Errorf("set permissions: %w", err)
+			}
+			if err := setXattrs(p, m.Xattrs, staleXattrs(prev, m)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.ModTime.IsZero() {
+		return nil // the tree doesn't record times
+	}
+	if symlink {
+		return lutimes(p, e.ModTime)
+	}
+	if err := os.Chtimes(p, e.ModTime, e.ModTime); err != nil {
+		return fmt.Errorf("set modification time: %w", err)
+	}
+	return nil
+}
+
+// permMode maps POSIX permission, setuid, setgid, and sticky bits to an
+// os.FileMode, the inverse of how the walker records them.
+func permMode(perm uint32) os.FileMode {
+	mode := os.FileMode(perm & 0o777)
+	if perm&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perm&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perm&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// staleXattrs returns the names of the extended attributes prev has and m
+// doesn't.
+func staleXattrs(prev, m *object.Metadata) []string {
+	if prev == nil {
+		return nil
+	}
+	var stale []string
+	for _, x := range prev.Xattrs {
+		if !slices.ContainsFunc(m.Xattrs, func(y object.Xattr) bool { return y.Name == x.Name }) {
+			stale = append(stale, x.Name)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package materialize
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// flags for utimensat(2), which package syscall doesn't export
+const (
+	atFDCWD           = -0x64
+	atSymlinkNoFollow = 0x100
+)
+
+// setXattrs removes the extended attributes named by stale from p and sets
+// xattrs on it.
+func setXattrs(p string, xattrs []object.Xattr, stale []string) error {
+	for _, name := range stale {
+		if err := syscall.Removexattr(p, name); err != nil && !errors.Is(err, syscall.ENODATA) {
+			return fmt.Errorf("remove extended attribute %s: %w", name, err)
+		}
+	}
+	for _, x := range xattrs {
+		if err := syscall.Setxattr(p, x.Name, x.Value, 0); err != nil {
+			return fmt.Errorf("set extended attribute %s: %w", x.Name, err)
+		}
+	}
+	return nil
+}
+
+// lutimes sets the modification time of the symlink p itself, which
+// os.Chtimes would set on its target.
+func lutimes(p string, t time.Time) error {
+	path, err := syscall.BytePtrFromString(p)
+	if err != nil {
+		return fmt.Errorf("set modification time: %w", err)
+	}
+	ts := [2]syscall.Timespec{syscall.NsecToTimespec(t.UnixNano()), syscall.NsecToTimespec(t.UnixNano())}
+	dirfd := atFDCWD
+	_, _, errno := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(dirfd), uintptr(unsafe.Pointer(path)), //nolint:gosec // utimensat(2) takes AT_FDCWD and C pointers
+		uintptr(unsafe.Pointer(&ts[0])), atSymlinkNoFollow, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("set modification time: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package materialize
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// setXattrs fails unless there is nothing to set or remove, since extended
+// attributes are only supported on Linux.
+func setXattrs(_ string, xattrs []object.Xattr, stale []string) error {
+	if len(xattrs) > 0 || len(stale) > 0 {
+		return fmt.Errorf("%w: extended attributes", ErrMetadataUnsupported)
+	}
+	return nil
+}
+
+// lutimes fails: setting a symlink's own time needs utimensat, which is
+// only wired up on Linux.
+func lutimes(_ string, _ time.Time) error {
+	return fmt.Errorf("%w: symlink modification times", ErrMetadataUnsupported)
+}
@@ -1,12 +1,21 @@
 package object
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/garrettladley/smerkle/internal/blake3"
 )
 
+var ErrInvalidHash = errors.New("object: invalid hash")
+
 type Hash [32]byte
 
 var _ fmt.Stringer = Hash{}
@@ -25,10 +34,81 @@ func (h Hash) IsZero() bool {
 	return h == ZeroHash
 }
 
-func HashBytes(data []byte) Hash {
+// ParseHash parses a 64-character hex string into a Hash.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if len(s) != hex.EncodedLen(len(h)) {
+		return ZeroHash, fmt.Errorf("%w: %q", ErrInvalidHash, s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return ZeroHash, fmt.Errorf("%w: %q", ErrInvalidHash, s)
+	}
+	return h, nil
+}
+
+var ErrUnknownAlgorithm = errors.New("object: unknown hash algorithm")
+
+// Algorithm is the digest a store uses for all of its object hashes. Its
+// value is the algorithm byte in serialized object headers.
+type Algorithm uint8
+
+const (
+	SHA256 Algorithm = 0
+	BLAKE3 Algorithm = 1
+)
+
+// DefaultAlgorithm is used by stores created without choosing one.
+const DefaultAlgorithm = SHA256
+
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch s {
+	case "sha256":
+		return SHA256, nil
+	case "blake3":
+		return BLAKE3, nil
+	default:
+		return 0, fmt.Errorf("%w: %q (want sha256 or blake3)", ErrUnknownAlgorithm, s)
+	}
+}
+
+func (a Algorithm) String() string {
+	switch a {
+	case SHA256:
+		return "sha256"
+	case BLAKE3:
+		return "blake3"
+	default:
+		return "unknown"
+	}
+}
+
+func (a Algorithm) Valid() bool {
+	return a == SHA256 || a == BLAKE3
+}
+
+// Sum hashes data with a; invalid algorithms fall back to SHA256, so
+// callers must check Valid on untrusted input.
+func (a Algorithm) Sum(data []byte) Hash {
+	if a == BLAKE3 {
+		return blake3.Sum256(data)
+	}
 	return sha256.Sum256(data)
 }
 
+// New returns a streaming hasher whose Sum matches Sum over everything
+// written to it, with the same fallback.
+func (a Algorithm) New() hash.Hash {
+	if a == BLAKE3 {
+		return blake3.New()
+	}
+	return sha256.New()
+}
+
+// HashBytes hashes data with DefaultAlgorithm.
+func HashBytes(data []byte) Hash {
+	return DefaultAlgorithm.Sum(data)
+}
+
 type Mode uint8
 
 const (
@@ -36,6 +116,9 @@ const (
 	ModeExecutable Mode = 1
 	ModeDirectory  Mode = 2
 	ModeSymlink    Mode = 3
+	// ModeInaccessible marks a path the walker could not read. Its entry has
+	// a zero hash and no object behind it.
+	ModeInaccessible Mode = 4
 )
 
 func (m Mode) String() string {
@@ -48,6 +131,8 @@ func (m Mode) String() string {
 		return "directory"
 	case ModeSymlink:
 		return "symlink"
+	case ModeInaccessible:
+		return "inaccessible"
 	default:
 		return "unknown"
 	}
@@ -63,18 +148,83 @@ type Entry struct {
 	Size    int64
 	ModTime time.Time
 	Hash    Hash
+	Meta    *Metadata // nil unless the walk captured full metadata
+}
+
+// Metadata is the ownership, permissions, and extended attributes of an
+// entry, recorded by full-metadata walks. Trees holding it are encoded in a
+// newer version, so they never hash like content-only trees.
+type Metadata struct {
+	Perm   uint32 // permission bits including setuid, setgid, and sticky (07777)
+	UID    uint32
+	GID    uint32
+	Xattrs []Xattr // sorted by name
+}
+
+// Xattr is one extended attribute.
+type Xattr struct {
+	Name  string
+	Value []byte
+}
+
+// Equal reports whether m and o record the same metadata. A nil Metadata
+// only equals another nil.
+func (m *Metadata) Equal(o *Metadata) bool {
+	if m == nil || o == nil {
+		return m == o
+	}
+	return m.Perm == o.Perm && m.UID == o.UID && m.GID == o.GID &&
+		slices.EqualFunc(m.Xattrs, o.Xattrs, func(a, b Xattr) bool {
+			return a.Name == b.Name && bytes.Equal(a.Value, b.Value)
+		})
 }
 
 type Blob struct {
-	Content []byte
+	Content   []byte
+	Algorithm Algorithm
 }
 
 func (b *Blob) Hash() Hash {
-	return HashBytes(b.Content)
+	return b.Algorithm.Sum(b.Content)
 }
 
+var ErrUnsortedTree = errors.New("object: tree entries out of order")
+
+// Tree entries are sorted by name compared as raw bytes: never by locale
+// collation or Unicode normalization, so a directory hashes the same on
+// every platform. Names that only render alike, such as NFC and NFD "é",
+// are distinct entries.
 type Tree struct {
-	Entries []Entry
+	Entries   []Entry
+	Algorithm Algorithm // hashes the encoded tree
+
+	// ModTimes encodes every entry's ModTime, so the tree hash changes when
+	// only timestamps do. Otherwise ModTime isn't stored and decodes as zero.
+	ModTimes bool
+}
+
+// CompareNames orders entry names byte-wise.
+func CompareNames(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+// SortEntries puts t's entries in canonical order.
+func (t *Tree) SortEntries() {
+	slices.SortFunc(t.Entries, func(a, b Entry) int {
+		return CompareNames(a.Name, b.Name)
+	})
+}
+
+// CheckOrder returns ErrUnsortedTree for the first entry that is not
+// strictly after its predecessor, which also catches duplicate names.
+func (t *Tree) CheckOrder() error {
+	for i := 1; i < len(t.Entries); i++ {
+		prev, name := t.Entries[i-1].Name, t.Entries[i].Name
+		if CompareNames(prev, name) >= 0 {
+			return fmt.Errorf("%w: %q before %q", ErrUnsortedTree, prev, name)
+		}
+	}
+	return nil
 }
 
 type IndexEntry struct {
@@ -87,3 +237,141 @@ type IndexEntry struct {
 func (e *IndexEntry) Matches(path string, size int64, modTime time.Time) bool {
 	return e.Path == path && e.Size == size && e.ModTime.Equal(modTime)
 }
+
+// DedupStats counts how PutBlob calls were satisfied.
+type DedupStats struct {
+	Written      uint64 // blobs stored as new objects
+	Deduplicated uint64 // blobs already present in the store
+	BytesWritten uint64 // content bytes of written blobs
+	BytesSaved   uint64 // content bytes not written thanks to deduplication
+}
+
+func (d DedupStats) Add(o DedupStats) DedupStats {
+	return DedupStats{
+		Written:      d.Written + o.Written,
+		Deduplicated: d.Deduplicated + o.Deduplicated,
+		BytesWritten: d.BytesWritten + o.BytesWritten,
+		BytesSaved:   d.BytesSaved + o.BytesSaved,
+	}
+}
+
+// CacheStats counts the hash cache lookups of one session, such as a walk.
+type CacheStats struct {
+	Hits   uint64    // files whose cached hash was used
+	Stale  uint64    // cached, but the size or modification time changed
+	Misses uint64    // not cached
+	Time   time.Time // when the counts were recorded
+}
+
+// Lookups returns the number of lookups counted.
+func (c CacheStats) Lookups() uint64 {
+	return c.Hits + c.Stale + c.Misses
+}
+
+// HitRate returns the fraction of lookups that were hits.
+func (c CacheStats) HitRate() float64 {
+	if c.Lookups() == 0 {
+		return 0
+	}
+	return float64(c.Hits) / float64(c.Lookups())
+}
+
+// Reachable records what a garbage collection found reachable, so the next
+// one need only read objects added since.
+type Reachable struct {
+	Roots []Hash // the refs and pins it started from, sorted
+	Live  []Hash // every object reachable from Roots, sorted
+}
+
+// Provenance describes how a root hash was produced, so it can be audited and
+// reproduced later.
+type Provenance struct {
+	Root        Hash // root tree hash this record describes
+	Time        time.Time
+	Hostname    string
+	User        string
+	ToolVersion string
+	IgnoreHash  Hash              // fingerprint of the effective ignore rules; zero if none
+	Settings    map[string]string // walked path and other walk options that influence the hash
+}
+
+// DirActivity tracks how often a directory's tree hash has changed between
+// walks, so volatile subtrees can be visited first.
+type DirActivity struct {
+	Path    string // index cache key of the directory
+	Hash    Hash   // tree hash seen on the most recent walk
+	Changes uint32 // number of walks on which Hash differed from the previous one
+}
+
+type Activity struct {
+	Entries []DirActivity
+}
+
+// Chunk is one piece of a chunked file's content, stored as a blob.
+type Chunk struct {
+	Hash Hash
+	Size uint32
+}
+
+// Manifest lists the chunks of a file stored in pieces. A tree entry whose
+// hash names a Manifest instead of a Blob has the chunks' concatenation as
+// its content.
+type Manifest struct {
+	Chunks    []Chunk
+	Algorithm Algorithm // hashes the encoded manifest
+}
+
+// Size returns the total content size.
+func (m *Manifest) Size() int64 {
+	var n int64
+	for _, c := range m.Chunks {
+		n += int64(c.Size)
+	}
+	return n
+}
+
+// Matches reports whether content is the file m describes, hashing each
+// piece with m.Algorithm; the chunk blobs themselves are not needed.
+func (m *Manifest) Matches(content []byte) bool {
+	if m.Size() != int64(len(content)) {
+		return false
+	}
+	for _, c := range m.Chunks {
+		piece := content[:c.Size]
+		content = content[c.Size:]
+		if (&Blob{Content: piece, Algorithm: m.Algorithm}).Hash() != c.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot records a root tree at a point in time. Snapshots chain through
+// Parent into a linear history of a directory.
+type Snapshot struct {
+	Root    Hash // root tree hash
+	Parent  Hash // previous snapshot; zero for the first
+	Time    time.Time
+	Message string
+
+	Algorithm Algorithm // hashes the encoded snapshot
+}
+
+// StoreConfig holds settings fixed when a store is created, and defaults
+// kept with the store for whatever opens it.
+type StoreConfig struct {
+	Algorithm Algorithm
+	Settings  map[string]string // by key; the store doesn't interpret them
+}
+
+// PackEntry locates one object's encoded bytes inside a pack file.
+type PackEntry struct {
+	Hash   Hash
+	Offset uint64
+	Length uint64
+}
+
+// PackIndex lists the objects in a pack file, sorted by hash.
+type PackIndex struct {
+	Entries []PackEntry
+}
@@ -0,0 +1,215 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestParseHash(t *testing.T) {
+	t.Parallel()
+
+	valid := HashBytes([]byte("hello"))
+
+	tests := []struct {
+		name    string
+		input   string
+		want    Hash
+		wantErr bool
+	}{
+		{name: "valid hash", input: valid.String(), want: valid},
+		{name: "zero hash", input: ZeroHash.String(), want: ZeroHash},
+		{name: "too short", input: "abcd", wantErr: true},
+		{name: "non-hex", input: "zz" + valid.String()[2:], wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseHash(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidHash) {
+					t.Fatalf("ParseHash(%q) error = %v, want ErrInvalidHash", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseHash(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHash(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		want    Algorithm
+		wantSum string // of "abc"
+	}{
+		{name: "sha256", want: SHA256, wantSum: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{name: "blake3", want: BLAKE3, wantSum: "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			alg, err := ParseAlgorithm(tt.name)
+			if err != nil {
+				t.Fatalf("ParseAlgorithm(%q) error = %v", tt.name, err)
+			}
+			if alg != tt.want || alg.String() != tt.name {
+				t.Errorf("ParseAlgorithm(%q) = %v, want %v", tt.name, alg, tt.want)
+			}
+			if got := alg.Sum([]byte("abc")).String(); got != tt.wantSum {
+				t.Errorf("Sum(abc) = %s, want %s", got, tt.wantSum)
+			}
+		})
+	}
+
+	if _, err := ParseAlgorithm("md5"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("ParseAlgorithm(md5) error = %v, want ErrUnknownAlgorithm", err)
+	}
+	if HashBytes([]byte("abc")) != DefaultAlgorithm.Sum([]byte("abc")) {
+		t.Error("HashBytes does not use DefaultAlgorithm")
+	}
+}
+
+// trickyNames collate differently under common locales, normalize to one
+// another, or differ only in case.
+var trickyNames = []string{
+	"a", "A", "Z", "z", "_", "-", ".hidden", "a b", "a.txt", "a-b", "a_b",
+	"10", "9", "\u00e9", "e\u0301", "E", "\u00c5", "\u212b", "i", "I",
+	"\u0130", "\u0131", "\u00df", "ss", "\uff21", "\u200bx", "\ufffd",
+	"\U0001f600", "\u65e5\u672c", "\uff71", "\u0661",
+}
+
+func TestTreeOrderByteWise(t *testing.T) {
+	t.Parallel()
+
+	r := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // deterministic test data
+	for range 200 {
+		// random distinct names built from tricky fragments
+		seen := make(map[string]bool)
+		var entries []Entry
+		for range 1 + r.IntN(20) {
+			name := trickyNames[r.IntN(len(trickyNames))]
+			if r.IntN(2) == 0 {
+				name += trickyNames[r.IntN(len(trickyNames))]
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			entries = append(entries, Entry{Name: name, Hash: HashBytes([]byte(name))})
+		}
+
+		tree := &Tree{Entries: entries}
+		tree.SortEntries()
+		if err := tree.CheckOrder(); err != nil {
+			t.Fatalf("CheckOrder() after SortEntries() error = %v", err)
+		}
+		for i := 1; i < len(tree.Entries); i++ {
+			if a, b := tree.Entries[i-1].Name, tree.Entries[i].Name; bytes.Compare([]byte(a), []byte(b)) >= 0 {
+				t.Fatalf("SortEntries() put %q before %q", a, b)
+			}
+		}
+
+		// the encoding depends only on the set of entries
+		want, err := EncodeTree(tree)
+		if err != nil {
+			t.Fatalf("EncodeTree() error = %v", err)
+		}
+		shuffled := &Tree{Entries: append([]Entry(nil), entries...)}
+		r.Shuffle(len(shuffled.Entries), func(i, j int) {
+			shuffled.Entries[i], shuffled.Entries[j] = shuffled.Entries[j], shuffled.Entries[i]
+		})
+		shuffled.SortEntries()
+		got, err := EncodeTree(shuffled)
+		if err != nil {
+			t.Fatalf("EncodeTree() error = %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatal("EncodeTree() differs after shuffling and re-sorting")
+		}
+	}
+}
+
+func TestTreeCheckOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "uppercase before lowercase", names: []string{"Z", "a"}},
+		{name: "decomposed before precomposed", names: []string{"e\u0301", "\u00e9"}},
+		{name: "precomposed before angstrom sign", names: []string{"\u00c5", "\u212b"}},
+		{name: "digits by byte", names: []string{"10", "9"}},
+		{name: "locale order", names: []string{"a", "B"}, wantErr: true},
+		{name: "natural order", names: []string{"9", "10"}, wantErr: true},
+		{name: "duplicate", names: []string{"a", "a"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tree := &Tree{}
+			for _, name := range tt.names {
+				tree.Entries = append(tree.Entries, Entry{Name: name})
+			}
+			err := tree.CheckOrder()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnsortedTree) {
+				t.Errorf("CheckOrder() error = %v, want ErrUnsortedTree", err)
+			}
+			if _, encErr := EncodeTree(tree); (encErr != nil) != tt.wantErr {
+				t.Errorf("EncodeTree() error = %v, wantErr %v", encErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifestMatches(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello, chunked world")
+	pieces := [][]byte{content[:5], content[5:12], content[12:]}
+	m := &Manifest{Algorithm: BLAKE3}
+	for _, p := range pieces {
+		h := (&Blob{Content: p, Algorithm: BLAKE3}).Hash()
+		m.Chunks = append(m.Chunks, Chunk{Hash: h, Size: uint32(len(p))}) //nolint:gosec // tiny test chunks
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "same", content: string(content), want: true},
+		{name: "one byte changed", content: "hellO, chunked world"},
+		{name: "shorter", content: "hello"},
+		{name: "longer", content: string(content) + "!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := m.Matches([]byte(tt.content)); got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
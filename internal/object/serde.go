@@ -4,28 +4,50 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
+	"slices"
 	"time"
 )
 
 const (
-	MagicBlob  = "MRKB"
-	MagicTree  = "MRKT"
-	MagicIndex = "MRKI"
+	MagicBlob     = "MRKB"
+	MagicTree     = "MRKT"
+	MagicIndex    = "MRKI"
+	MagicDedup    = "MRKD"
+	MagicProv     = "MRKP"
+	MagicActivity = "MRKA"
+	MagicSnap     = "MRKS"
+	MagicManifest = "MRKM"
+	MagicConfig   = "MRKC"
+	MagicPack     = "MRKK"
+	MagicPackIdx  = "MRKX"
+	MagicJournal  = "MRKJ"
+	MagicBundle   = "MRKL"
+	MagicCache    = "MRKH"
+	MagicReach    = "MRKR"
 )
 
 const CurrentVersion uint16 = 1
 
+// IndexVersion is the version EncodeIndex writes; v2 prefix-compresses paths
+// against the preceding entry, and v3 records the mtime granularity.
+const IndexVersion uint16 = 3
+
 type Header struct {
 	Magic   [4]byte
 	Version uint16
 }
 
 func WriteHeader(w io.Writer, magic string) error {
+	return writeHeaderVersion(w, magic, CurrentVersion)
+}
+
+func writeHeaderVersion(w io.Writer, magic string, version uint16) error {
 	var h Header
 	copy(h.Magic[:], magic)
-	h.Version = CurrentVersion
+	h.Version = version
 	if err := binary.Write(w, binary.BigEndian, h); err != nil {
 		return fmt.Errorf("write header: %w", err)
 	}
@@ -33,6 +55,10 @@ func WriteHeader(w io.Writer, magic string) error {
 }
 
 func ReadHeader(r io.Reader, expectedMagic string) (uint16, error) {
+	return readHeaderMax(r, expectedMagic, CurrentVersion)
+}
+
+func readHeaderMax(r io.Reader, expectedMagic string, maxVersion uint16) (uint16, error) {
 	var h Header
 	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
 		return 0, fmt.Errorf("read header: %w", err)
@@ -42,41 +68,132 @@ func ReadHeader(r io.Reader, expectedMagic string) (uint16, error) {
 		return 0, fmt.Errorf("invalid magic: got %q, want %q", h.Magic[:], expectedMagic)
 	}
 
-	if h.Version > CurrentVersion {
-		return 0, fmt.Errorf("unsupported version: got %d, max supported %d", h.Version, CurrentVersion)
+	if h.Version > maxVersion {
+		return 0, fmt.Errorf("unsupported version: got %d, max supported %d", h.Version, maxVersion)
 	}
 
 	return h.Version, nil
 }
 
+// algorithmVersion marks object headers followed by an algorithm byte.
+// SHA256 objects keep the version 1 header, so their hashes never change.
+const algorithmVersion uint16 = 2
+
+func writeObjectHeader(w io.Writer, magic string, alg Algorithm) error {
+	if alg == SHA256 {
+		return WriteHeader(w, magic)
+	}
+	if !alg.Valid() {
+		return fmt.Errorf("%w: %d", ErrUnknownAlgorithm, alg)
+	}
+	if err := writeHeaderVersion(w, magic, algorithmVersion); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, alg); err != nil {
+		return fmt.Errorf("write algorithm: %w", err)
+	}
+	return nil
+}
+
+// entryFlagsVersion marks tree headers followed by an algorithm byte, of any
+// algorithm, whose entries each end in a flags byte and the fields it names.
+// Trees without such fields keep the older headers, so their hashes never
+// change.
+const entryFlagsVersion uint16 = 3
+
+// modTimeVersion marks trees laid out as in entryFlagsVersion whose entries
+// each end in their mtime: seconds then nanoseconds, after any flagged
+// fields.
+const modTimeVersion uint16 = 4
+
+// entry flags
+const (
+	entryHasMetadata byte = 1 << iota
+)
+
+// readObjectHeader returns the algorithm recorded in an object header; the
+// layout after the header is the same in both versions.
+func readObjectHeader(r io.Reader, magic string) (Algorithm, error) {
+	alg, _, err := readObjectHeaderMax(r, magic, algorithmVersion)
+	return alg, err
+}
+
+// readObjectHeaderMax is readObjectHeader for objects with versions up to
+// maxVersion, also returning the version read.
+func readObjectHeaderMax(r io.Reader, magic string, maxVersion uint16) (Algorithm, uint16, error) {
+	version, err := readHeaderMax(r, magic, maxVersion)
+	if err != nil {
+		return 0, 0, err
+	}
+	if version < algorithmVersion {
+		return SHA256, version, nil
+	}
+
+	var alg Algorithm
+	if err := binary.Read(r, binary.BigEndian, &alg); err != nil {
+		return 0, 0, fmt.Errorf("read algorithm: %w", err)
+	}
+	if !alg.Valid() || (alg == SHA256 && version == algorithmVersion) {
+		// SHA256 objects always use the version 1 header
+		return 0, 0, fmt.Errorf("%w: %d", ErrUnknownAlgorithm, alg)
+	}
+	return alg, version, nil
+}
+
 func EncodeBlob(b *Blob) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := WriteHeader(&buf, MagicBlob); err != nil {
+	if err := WriteBlobHeader(&buf, b.Algorithm, int64(len(b.Content))); err != nil {
 		return nil, err
 	}
-
-	if err := binary.Write(&buf, binary.BigEndian, uint64(len(b.Content))); err != nil {
-		return nil, fmt.Errorf("write content length: %w", err)
-	}
 	buf.Write(b.Content)
 
 	return buf.Bytes(), nil
 }
 
+// WriteBlobHeader writes the encoding of a blob of size bytes up to its
+// content, so content too large to hold can be streamed after it.
+func WriteBlobHeader(w io.Writer, alg Algorithm, size int64) error {
+	if err := writeObjectHeader(w, MagicBlob, alg); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint64(size)); err != nil { //nolint:gosec // sizes are never negative
+		return fmt.Errorf("write content length: %w", err)
+	}
+	return nil
+}
+
+// ReadBlobHeader reads the encoding of a blob up to its content, returning
+// the algorithm it records and the length of the content that follows.
+func ReadBlobHeader(r io.Reader) (Algorithm, int64, error) {
+	alg, err := readObjectHeader(r, MagicBlob)
+	if err != nil {
+		return 0, 0, err
+	}
+	var length uint64
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return 0, 0, fmt.Errorf("read content length: %w", err)
+	}
+	if length > math.MaxInt64 {
+		return 0, 0, fmt.Errorf("content length %d out of range", length)
+	}
+	return alg, int64(length), nil
+}
+
 func DecodeBlob(data []byte) (*Blob, error) {
 	r := bytes.NewReader(data)
 
-	version, err := ReadHeader(r, MagicBlob)
+	alg, err := readObjectHeader(r, MagicBlob)
 	if err != nil {
 		return nil, err
 	}
 
-	switch version {
-	case 1:
-		return decodeBlobV1(r)
-	default:
-		return nil, fmt.Errorf("unknown blob version: %d", version)
+	// versions differ only in the header
+	b, err := decodeBlobV1(r)
+	if err != nil {
+		return nil, err
 	}
+	b.Algorithm = alg
+	return b, nil
 }
 
 func decodeBlobV1(r io.Reader) (*Blob, error) {
@@ -93,9 +210,25 @@ func decodeBlobV1(r io.Reader) (*Blob, error) {
 	return &Blob{Content: content}, nil
 }
 
+// EncodeTree encodes t, whose entries must be in canonical order; see Tree.
 func EncodeTree(t *Tree) ([]byte, error) {
+	if err := t.CheckOrder(); err != nil {
+		return nil, err
+	}
+
+	var version uint16
+	switch {
+	case t.ModTimes:
+		version = modTimeVersion
+	case slices.ContainsFunc(t.Entries, func(e Entry) bool { return e.Meta != nil }):
+		version = entryFlagsVersion
+	}
 	var buf bytes.Buffer
-	if err := WriteHeader(&buf, MagicTree); err != nil {
+	if version > 0 {
+		if err := writeFlagsHeader(&buf, t.Algorithm, version); err != nil {
+			return nil, err
+		}
+	} else if err := writeObjectHeader(&buf, MagicTree, t.Algorithm); err != nil {
 		return nil, err
 	}
 
@@ -110,11 +243,104 @@ func EncodeTree(t *Tree) ([]byte, error) {
 		if err := encodeEntry(&buf, &e); err != nil {
 			return nil, err
 		}
+		if version >= entryFlagsVersion {
+			if err := encodeEntryFlags(&buf, &e); err != nil {
+				return nil, err
+			}
+		}
+		if version >= modTimeVersion {
+			if err := encodeModTime(&buf, e.ModTime); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return buf.Bytes(), nil
 }
 
+func writeFlagsHeader(w io.Writer, alg Algorithm, version uint16) error {
+	if !alg.Valid() {
+		return fmt.Errorf("%w: %d", ErrUnknownAlgorithm, alg)
+	}
+	if err := writeHeaderVersion(w, MagicTree, version); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, alg); err != nil {
+		return fmt.Errorf("write algorithm: %w", err)
+	}
+	return nil
+}
+
+func encodeModTime(w io.Writer, t time.Time) error {
+	if err := binary.Write(w, binary.BigEndian, t.Unix()); err != nil {
+		return fmt.Errorf("write mtime: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, int32(t.Nanosecond())); err != nil { //nolint:gosec // Nanosecond() returns 0-999999999, always fits in int32
+		return fmt.Errorf("write mtime: %w", err)
+	}
+	return nil
+}
+
+func decodeModTime(r io.Reader) (time.Time, error) {
+	var secs int64
+	var nsec int32
+	if err := binary.Read(r, binary.BigEndian, &secs); err != nil {
+		return time.Time{}, fmt.Errorf("read mtime: %w", err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &nsec); err != nil {
+		return time.Time{}, fmt.Errorf("read mtime: %w", err)
+	}
+	return time.Unix(secs, int64(nsec)), nil
+}
+
+// encodeEntryFlags writes the flags byte ending a version 3 entry, then the
+// metadata if present: permissions, uid, gid, and the attribute count, each
+// attribute a uint16-prefixed name and uint32-prefixed value.
+func encodeEntryFlags(w io.Writer, e *Entry) error {
+	var flags byte
+	if e.Meta != nil {
+		flags |= entryHasMetadata
+	}
+	if err := binary.Write(w, binary.BigEndian, flags); err != nil {
+		return fmt.Errorf("write entry flags: %w", err)
+	}
+	if e.Meta == nil {
+		return nil
+	}
+
+	m := e.Meta
+	if err := binary.Write(w, binary.BigEndian, [3]uint32{m.Perm, m.UID, m.GID}); err != nil {
+		return fmt.Errorf("write metadata: %w", err)
+	}
+	if len(m.Xattrs) > math.MaxUint16 {
+		return fmt.Errorf("too many extended attributes: %d", len(m.Xattrs))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(m.Xattrs))); err != nil { //nolint:gosec // bounds checked above
+		return fmt.Errorf("write xattr count: %w", err)
+	}
+	for i, x := range m.Xattrs {
+		if i > 0 && m.Xattrs[i-1].Name >= x.Name {
+			return fmt.Errorf("extended attributes out of order: %q before %q", m.Xattrs[i-1].Name, x.Name)
+		}
+		if len(x.Name) > math.MaxUint16 || len(x.Value) > math.MaxUint32 {
+			return fmt.Errorf("extended attribute %q too long", x.Name)
+		}
+		if err := binary.Write(w, binary.BigEndian, uint16(len(x.Name))); err != nil { //nolint:gosec // bounds checked above
+			return fmt.Errorf("write xattr name length: %w", err)
+		}
+		if _, err := io.WriteString(w, x.Name); err != nil {
+			return fmt.Errorf("write xattr name: %w", err)
+		}
+		if err := binary.Write(w, binary.BigEndian, uint32(len(x.Value))); err != nil { //nolint:gosec // bounds checked above
+			return fmt.Errorf("write xattr value length: %w", err)
+		}
+		if _, err := w.Write(x.Value); err != nil {
+			return fmt.Errorf("write xattr value: %w", err)
+		}
+	}
+	return nil
+}
+
 func encodeEntry(w io.Writer, e *Entry) error {
 	// mode (1 byte)
 	if err := binary.Write(w, binary.BigEndian, e.Mode); err != nil {
@@ -149,20 +375,21 @@ func encodeEntry(w io.Writer, e *Entry) error {
 func DecodeTree(data []byte) (*Tree, error) {
 	r := bytes.NewReader(data)
 
-	version, err := ReadHeader(r, MagicTree)
+	alg, version, err := readObjectHeaderMax(r, MagicTree, modTimeVersion)
 	if err != nil {
 		return nil, err
 	}
 
-	switch version {
-	case 1:
-		return decodeTreeV1(r)
-	default:
-		return nil, fmt.Errorf("unknown tree version: %d", version)
+	// versions 1 and 2 differ only in the header
+	t, err := decodeTreeV1(r, version)
+	if err != nil {
+		return nil, err
 	}
+	t.Algorithm = alg
+	return t, nil
 }
 
-func decodeTreeV1(r io.Reader) (*Tree, error) {
+func decodeTreeV1(r io.Reader, version uint16) (*Tree, error) {
 	var count uint32
 	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
 		return nil, fmt.Errorf("read entry count: %w", err)
@@ -173,9 +400,67 @@ func decodeTreeV1(r io.Reader) (*Tree, error) {
 		if err := decodeEntryV1(r, &entries[i]); err != nil {
 			return nil, fmt.Errorf("decode entry %d: %w", i, err)
 		}
+		if version < entryFlagsVersion {
+			continue
+		}
+		if err := decodeEntryFlags(r, &entries[i]); err != nil {
+			return nil, fmt.Errorf("decode entry %d: %w", i, err)
+		}
+		if version < modTimeVersion {
+			continue
+		}
+		modTime, err := decodeModTime(r)
+		if err != nil {
+			return nil, fmt.Errorf("decode entry %d: %w", i, err)
+		}
+		entries[i].ModTime = modTime
+	}
+
+	return &Tree{Entries: entries, ModTimes: version >= modTimeVersion}, nil
+}
+
+func decodeEntryFlags(r io.Reader, e *Entry) error {
+	var flags byte
+	if err := binary.Read(r, binary.BigEndian, &flags); err != nil {
+		return fmt.Errorf("read entry flags: %w", err)
+	}
+	if flags&^entryHasMetadata != 0 {
+		return fmt.Errorf("unknown entry flags: %#x", flags)
+	}
+	if flags&entryHasMetadata == 0 {
+		return nil
 	}
 
-	return &Tree{Entries: entries}, nil
+	var ids [3]uint32
+	if err := binary.Read(r, binary.BigEndian, &ids); err != nil {
+		return fmt.Errorf("read metadata: %w", err)
+	}
+	m := &Metadata{Perm: ids[0], UID: ids[1], GID: ids[2]}
+	var count uint16
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return fmt.Errorf("read xattr count: %w", err)
+	}
+	for range count {
+		var nameLen uint16
+		if err := binary.Read(r, binary.BigEndian, &nameLen); err != nil {
+			return fmt.Errorf("read xattr name length: %w", err)
+		}
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return fmt.Errorf("read xattr name: %w", err)
+		}
+		var valueLen uint32
+		if err := binary.Read(r, binary.BigEndian, &valueLen); err != nil {
+			return fmt.Errorf("read xattr value length: %w", err)
+		}
+		value := make([]byte, valueLen)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return fmt.Errorf("read xattr value: %w", err)
+		}
+		m.Xattrs = append(m.Xattrs, Xattr{Name: string(name), Value: value})
+	}
+	e.Meta = m
+	return nil
 }
 
 func decodeEntryV1(r io.Reader, e *Entry) error {
@@ -209,14 +494,23 @@ func decodeEntryV1(r io.Reader, e *Entry) error {
 }
 
 type Index struct {
-	Entries []IndexEntry
+	// Granularity is what entry mtimes were truncated to before being
+	// recorded; 0 means they are exact. Indexes before v3 are exact.
+	Granularity time.Duration
+	Entries     []IndexEntry
 }
 
+// EncodeIndex writes entries in order, storing each path as the length of
+// the prefix it shares with the previous path plus the remaining suffix.
+// Sorting entries by path first makes the encoding much smaller.
 func EncodeIndex(idx *Index) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := WriteHeader(&buf, MagicIndex); err != nil {
+	if err := writeHeaderVersion(&buf, MagicIndex, IndexVersion); err != nil {
 		return nil, err
 	}
+	if err := binary.Write(&buf, binary.BigEndian, int64(idx.Granularity)); err != nil {
+		return nil, fmt.Errorf("write granularity: %w", err)
+	}
 
 	if len(idx.Entries) > math.MaxUint32 {
 		return nil, fmt.Errorf("too many index entries: %d", len(idx.Entries))
@@ -225,25 +519,31 @@ func EncodeIndex(idx *Index) ([]byte, error) {
 		return nil, fmt.Errorf("write entry count: %w", err)
 	}
 
+	prev := ""
 	for _, e := range idx.Entries {
-		if err := encodeIndexEntry(&buf, &e); err != nil {
+		if err := encodeIndexEntry(&buf, &e, prev); err != nil {
 			return nil, err
 		}
+		prev = e.Path
 	}
 
 	return buf.Bytes(), nil
 }
 
-func encodeIndexEntry(w io.Writer, e *IndexEntry) error {
-	// path length + path
-	pathBytes := []byte(e.Path)
-	if len(pathBytes) > math.MaxUint16 {
-		return fmt.Errorf("index entry path too long: %d bytes", len(pathBytes))
+func encodeIndexEntry(w io.Writer, e *IndexEntry, prev string) error {
+	// shared prefix length + suffix length + suffix
+	if len(e.Path) > math.MaxUint16 {
+		return fmt.Errorf("index entry path too long: %d bytes", len(e.Path))
+	}
+	shared := commonPrefixLen(prev, e.Path)
+	suffix := e.Path[shared:]
+	if err := binary.Write(w, binary.BigEndian, uint16(shared)); err != nil { //nolint:gosec // bounded by the path length
+		return fmt.Errorf("write shared prefix length: %w", err)
 	}
-	if err := binary.Write(w, binary.BigEndian, uint16(len(pathBytes))); err != nil { //nolint:gosec // bounds checked above
+	if err := binary.Write(w, binary.BigEndian, uint16(len(suffix))); err != nil { //nolint:gosec // bounds checked above
 		return fmt.Errorf("write path length: %w", err)
 	}
-	if _, err := w.Write(pathBytes); err != nil {
+	if _, err := io.WriteString(w, suffix); err != nil {
 		return fmt.Errorf("write path: %w", err)
 	}
 
@@ -268,10 +568,20 @@ func encodeIndexEntry(w io.Writer, e *IndexEntry) error {
 	return nil
 }
 
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
 func DecodeIndex(data []byte) (*Index, error) {
 	r := bytes.NewReader(data)
 
-	version, err := ReadHeader(r, MagicIndex)
+	version, err := readHeaderMax(r, MagicIndex, IndexVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -279,6 +589,22 @@ func DecodeIndex(data []byte) (*Index, error) {
 	switch version {
 	case 1:
 		return decodeIndexV1(r)
+	case 2:
+		return decodeIndexV2(r)
+	case 3:
+		var g int64
+		if err := binary.Read(r, binary.BigEndian, &g); err != nil {
+			return nil, fmt.Errorf("read granularity: %w", err)
+		}
+		if g < 0 {
+			return nil, fmt.Errorf("negative granularity: %d", g)
+		}
+		idx, err := decodeIndexV2(r)
+		if err != nil {
+			return nil, err
+		}
+		idx.Granularity = time.Duration(g)
+		return idx, nil
 	default:
 		return nil, fmt.Errorf("unknown index version: %d", version)
 	}
@@ -312,6 +638,52 @@ func decodeIndexEntryV1(r io.Reader, e *IndexEntry) error {
 	}
 	e.Path = string(pathBytes)
 
+	return decodeIndexEntryFields(r, e)
+}
+
+func decodeIndexV2(r io.Reader) (*Index, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("read entry count: %w", err)
+	}
+
+	entries := make([]IndexEntry, count)
+	prev := ""
+	for i := range entries {
+		if err := decodeIndexEntryV2(r, &entries[i], prev); err != nil {
+			return nil, fmt.Errorf("decode entry %d: %w", i, err)
+		}
+		prev = entries[i].Path
+	}
+
+	return &Index{Entries: entries}, nil
+}
+
+func decodeIndexEntryV2(r io.Reader, e *IndexEntry, prev string) error {
+	// shared prefix length + suffix
+	var shared, suffixLen uint16
+	if err := binary.Read(r, binary.BigEndian, &shared); err != nil {
+		return fmt.Errorf("read shared prefix length: %w", err)
+	}
+	if int(shared) > len(prev) {
+		return fmt.Errorf("shared prefix length %d exceeds previous path length %d", shared, len(prev))
+	}
+	if err := binary.Read(r, binary.BigEndian, &suffixLen); err != nil {
+		return fmt.Errorf("read path length: %w", err)
+	}
+	pathBytes := make([]byte, int(shared)+int(suffixLen))
+	copy(pathBytes, prev[:shared])
+	if _, err := io.ReadFull(r, pathBytes[shared:]); err != nil {
+		return fmt.Errorf("read path: %w", err)
+	}
+	e.Path = string(pathBytes)
+
+	return decodeIndexEntryFields(r, e)
+}
+
+// decodeIndexEntryFields reads the fields following the path, which are the
+// same in every index version.
+func decodeIndexEntryFields(r io.Reader, e *IndexEntry) error {
 	// size
 	if err := binary.Read(r, binary.BigEndian, &e.Size); err != nil {
 		return fmt.Errorf("read size: %w", err)
@@ -326,7 +698,8 @@ func decodeIndexEntryV1(r io.Reader, e *IndexEntry) error {
 	if err := binary.Read(r, binary.BigEndian, &nsec); err != nil {
 		return fmt.Errorf("read modtime nanoseconds: %w", err)
 	}
-	e.ModTime = time.Unix(secs, int64(nsec))
+	// UTC so an index reads the same whatever the local zone
+	e.ModTime = time.Unix(secs, int64(nsec)).UTC()
 
 	// hash
 	if _, err := io.ReadFull(r, e.Hash[:]); err != nil {
@@ -335,3 +708,733 @@ func decodeIndexEntryV1(r io.Reader, e *IndexEntry) error {
 
 	return nil
 }
+
+// The index journal holds index updates made since the index was last
+// written in full. After a header, it is a sequence of records, one per
+// flush:
+//
+//	u32 payload length | u32 CRC-32C of payload | payload
+//
+// where the payload is a u32 entry count and entries encoded as in an index.
+// A crash mid-append leaves a short or mismatched last record, which
+// DecodeIndexJournal drops along with anything after it.
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// EncodeIndexJournalHeader returns the bytes that start a journal.
+func EncodeIndexJournalHeader() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, MagicJournal); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeIndexJournalRecord encodes entries as one journal record.
+func EncodeIndexJournalRecord(entries []IndexEntry) ([]byte, error) {
+	var payload bytes.Buffer
+	if len(entries) > math.MaxUint32 {
+		return nil, fmt.Errorf("too many journal entries: %d", len(entries))
+	}
+	if err := binary.Write(&payload, binary.BigEndian, uint32(len(entries))); err != nil { //nolint:gosec // bounds checked above
+		return nil, fmt.Errorf("write entry count: %w", err)
+	}
+	prev := ""
+	for _, e := range entries {
+		if err := encodeIndexEntry(&payload, &e, prev); err != nil {
+			return nil, err
+		}
+		prev = e.Path
+	}
+	if payload.Len() > math.MaxUint32 {
+		return nil, fmt.Errorf("journal record too large: %d bytes", payload.Len())
+	}
+
+	rec := make([]byte, journalRecordHeaderSize, journalRecordHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(rec[0:4], uint32(payload.Len())) //nolint:gosec // bounds checked above
+	binary.BigEndian.PutUint32(rec[4:8], crc32.Checksum(payload.Bytes(), castagnoli))
+	return append(rec, payload.Bytes()...), nil
+}
+
+const journalRecordHeaderSize = 8
+
+// DecodeIndexJournal returns the entries of every intact record in data, in
+// the order they were appended, and the length of the intact prefix; a
+// prefix shorter than data means the last append was torn. A missing or
+// truncated header counts as torn; a wrong one is an error.
+func DecodeIndexJournal(data []byte) (entries []IndexEntry, valid int, err error) {
+	r := bytes.NewReader(data)
+	if _, err := ReadHeader(r, MagicJournal); err != nil {
+		if len(data) < binary.Size(Header{}) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	valid = binary.Size(Header{})
+	for len(data)-valid >= journalRecordHeaderSize {
+		n := int(binary.BigEndian.Uint32(data[valid : valid+4]))
+		sum := binary.BigEndian.Uint32(data[valid+4 : valid+8])
+		if n > len(data)-valid-journalRecordHeaderSize {
+			break
+		}
+		payload := data[valid+journalRecordHeaderSize : valid+journalRecordHeaderSize+n]
+		if crc32.Checksum(payload, castagnoli) != sum {
+			break
+		}
+		rec, err := decodeIndexV2(bytes.NewReader(payload))
+		if err != nil {
+			// the checksum matched, so this is no torn write
+			return nil, valid, fmt.Errorf("decode journal record at offset %d: %w", valid, err)
+		}
+		entries = append(entries, rec.Entries...)
+		valid += journalRecordHeaderSize + n
+	}
+	return entries, valid, nil
+}
+
+func EncodeDedupStats(d *DedupStats) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, MagicDedup); err != nil {
+		return nil, err
+	}
+
+	for _, v := range []uint64{d.Written, d.Deduplicated, d.BytesWritten, d.BytesSaved} {
+		if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+			return nil, fmt.Errorf("write dedup counter: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeDedupStats(data []byte) (*DedupStats, error) {
+	r := bytes.NewReader(data)
+
+	version, err := ReadHeader(r, MagicDedup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1:
+		return decodeDedupStatsV1(r)
+	default:
+		return nil, fmt.Errorf("unknown dedup stats version: %d", version)
+	}
+}
+
+func decodeDedupStatsV1(r io.Reader) (*DedupStats, error) {
+	var d DedupStats
+	for _, v := range []*uint64{&d.Written, &d.Deduplicated, &d.BytesWritten, &d.BytesSaved} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return nil, fmt.Errorf("read dedup counter: %w", err)
+		}
+	}
+	return &d, nil
+}
+
+func EncodeCacheStats(c *CacheStats) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, MagicCache); err != nil {
+		return nil, err
+	}
+
+	for _, v := range []uint64{c.Hits, c.Stale, c.Misses} {
+		if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+			return nil, fmt.Errorf("write cache counter: %w", err)
+		}
+	}
+	if err := binary.Write(&buf, binary.BigEndian, c.Time.UnixNano()); err != nil {
+		return nil, fmt.Errorf("write cache stats time: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeCacheStats(data []byte) (*CacheStats, error) {
+	r := bytes.NewReader(data)
+
+	version, err := ReadHeader(r, MagicCache)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1:
+		return decodeCacheStatsV1(r)
+	default:
+		return nil, fmt.Errorf("unknown cache stats version: %d", version)
+	}
+}
+
+func decodeCacheStatsV1(r io.Reader) (*CacheStats, error) {
+	var c CacheStats
+	for _, v := range []*uint64{&c.Hits, &c.Stale, &c.Misses} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return nil, fmt.Errorf("read cache counter: %w", err)
+		}
+	}
+	var nanos int64
+	if err := binary.Read(r, binary.BigEndian, &nanos); err != nil {
+		return nil, fmt.Errorf("read cache stats time: %w", err)
+	}
+	c.Time = time.Unix(0, nanos).UTC()
+	return &c, nil
+}
+
+func EncodeReachable(rc *Reachable) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, MagicReach); err != nil {
+		return nil, err
+	}
+
+	for _, hashes := range [][]Hash{rc.Roots, rc.Live} {
+		if err := binary.Write(&buf, binary.BigEndian, uint64(len(hashes))); err != nil {
+			return nil, fmt.Errorf("write hash count: %w", err)
+		}
+		for i, h := range hashes {
+			if i > 0 && bytes.Compare(hashes[i-1][:], h[:]) >= 0 {
+				return nil, fmt.Errorf("hashes not sorted at %d", i)
+			}
+			buf.Write(h[:])
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeReachable(data []byte) (*Reachable, error) {
+	r := bytes.NewReader(data)
+
+	version, err := ReadHeader(r, MagicReach)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1:
+		return decodeReachableV1(r)
+	default:
+		return nil, fmt.Errorf("unknown reachable version: %d", version)
+	}
+}
+
+func decodeReachableV1(r *bytes.Reader) (*Reachable, error) {
+	var rc Reachable
+	for _, hashes := range []*[]Hash{&rc.Roots, &rc.Live} {
+		var count uint64
+		if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			return nil, fmt.Errorf("read hash count: %w", err)
+		}
+		// don't trust count for the allocation
+		if count > uint64(r.Len()/len(Hash{})) { //nolint:gosec // Len is never negative
+			return nil, fmt.Errorf("hash count %d exceeds data", count)
+		}
+		*hashes = make([]Hash, count)
+		for i := range *hashes {
+			if _, err := io.ReadFull(r, (*hashes)[i][:]); err != nil {
+				return nil, fmt.Errorf("read hash %d: %w", i, err)
+			}
+		}
+	}
+	return &rc, nil
+}
+
+func EncodeProvenance(p *Provenance) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, MagicProv); err != nil {
+		return nil, err
+	}
+
+	buf.Write(p.Root[:])
+
+	if err := binary.Write(&buf, binary.BigEndian, p.Time.Unix()); err != nil {
+		return nil, fmt.Errorf("write time seconds: %w", err)
+	}
+	if err := binary.Write(&buf, binary.BigEndian, int32(p.Time.Nanosecond())); err != nil { //nolint:gosec // Nanosecond() returns 0-999999999, always fits in int32
+		return nil, fmt.Errorf("write time nanoseconds: %w", err)
+	}
+
+	for _, s := range []string{p.Hostname, p.User, p.ToolVersion} {
+		if err := writeString(&buf, s); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.Write(p.IgnoreHash[:])
+
+	if err := writeSettings(&buf, p.Settings); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeProvenance(data []byte) (*Provenance, error) {
+	r := bytes.NewReader(data)
+
+	version, err := ReadHeader(r, MagicProv)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1:
+		return decodeProvenanceV1(r)
+	default:
+		return nil, fmt.Errorf("unknown provenance version: %d", version)
+	}
+}
+
+func decodeProvenanceV1(r io.Reader) (*Provenance, error) {
+	var p Provenance
+
+	if _, err := io.ReadFull(r, p.Root[:]); err != nil {
+		return nil, fmt.Errorf("read root hash: %w", err)
+	}
+
+	var secs int64
+	if err := binary.Read(r, binary.BigEndian, &secs); err != nil {
+		return nil, fmt.Errorf("read time seconds: %w", err)
+	}
+	var nsec int32
+	if err := binary.Read(r, binary.BigEndian, &nsec); err != nil {
+		return nil, fmt.Errorf("read time nanoseconds: %w", err)
+	}
+	p.Time = time.Unix(secs, int64(nsec))
+
+	for _, s := range []*string{&p.Hostname, &p.User, &p.ToolVersion} {
+		v, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		*s = v
+	}
+
+	if _, err := io.ReadFull(r, p.IgnoreHash[:]); err != nil {
+		return nil, fmt.Errorf("read ignore hash: %w", err)
+	}
+
+	settings, err := readSettings(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Settings = settings
+	return &p, nil
+}
+
+// writeSettings writes a uint16 count and then each key and value, sorted
+// by key so encoding is deterministic.
+func writeSettings(w io.Writer, settings map[string]string) error {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if len(keys) > math.MaxUint16 {
+		return fmt.Errorf("too many settings: %d", len(keys))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(keys))); err != nil { //nolint:gosec // bounds checked above
+		return fmt.Errorf("write settings count: %w", err)
+	}
+	for _, k := range keys {
+		if err := writeString(w, k); err != nil {
+			return err
+		}
+		if err := writeString(w, settings[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSettings reads what writeSettings wrote; no settings give a nil map.
+func readSettings(r io.Reader) (map[string]string, error) {
+	var count uint16
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("read settings count: %w", err)
+	}
+	var settings map[string]string
+	if count > 0 {
+		settings = make(map[string]string, count)
+	}
+	for range count {
+		k, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		settings[k] = v
+	}
+	return settings, nil
+}
+
+// writeString writes a uint16 length-prefixed string.
+func writeString(w io.Writer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return fmt.Errorf("string too long: %d bytes", len(s))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(s))); err != nil { //nolint:gosec // bounds checked above
+		return fmt.Errorf("write string length: %w", err)
+	}
+	if _, err := io.WriteString(w, s); err != nil {
+		return fmt.Errorf("write string: %w", err)
+	}
+	return nil
+}
+
+func readString(r io.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return "", fmt.Errorf("read string length: %w", err)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", fmt.Errorf("read string: %w", err)
+	}
+	return string(b), nil
+}
+
+func EncodeActivity(a *Activity) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, MagicActivity); err != nil {
+		return nil, err
+	}
+
+	if len(a.Entries) > math.MaxUint32 {
+		return nil, fmt.Errorf("too many activity entries: %d", len(a.Entries))
+	}
+	if err := binary.Write(&buf, binary.BigEndian, uint32(len(a.Entries))); err != nil { //nolint:gosec // bounds checked above
+		return nil, fmt.Errorf("write entry count: %w", err)
+	}
+
+	for _, e := range a.Entries {
+		if err := writeString(&buf, e.Path); err != nil {
+			return nil, err
+		}
+		buf.Write(e.Hash[:])
+		if err := binary.Write(&buf, binary.BigEndian, e.Changes); err != nil {
+			return nil, fmt.Errorf("write change count: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeActivity(data []byte) (*Activity, error) {
+	r := bytes.NewReader(data)
+
+	version, err := ReadHeader(r, MagicActivity)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1:
+		return decodeActivityV1(r)
+	default:
+		return nil, fmt.Errorf("unknown activity version: %d", version)
+	}
+}
+
+func decodeActivityV1(r io.Reader) (*Activity, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("read entry count: %w", err)
+	}
+
+	entries := make([]DirActivity, count)
+	for i := range entries {
+		e := &entries[i]
+		path, err := readString(r)
+		if err != nil {
+			return nil, fmt.Errorf("decode entry %d: %w", i, err)
+		}
+		e.Path = path
+		if _, err := io.ReadFull(r, e.Hash[:]); err != nil {
+			return nil, fmt.Errorf("decode entry %d: read hash: %w", i, err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &e.Changes); err != nil {
+			return nil, fmt.Errorf("decode entry %d: read change count: %w", i, err)
+		}
+	}
+
+	return &Activity{Entries: entries}, nil
+}
+
+func EncodeSnapshot(snap *Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeObjectHeader(&buf, MagicSnap, snap.Algorithm); err != nil {
+		return nil, err
+	}
+
+	buf.Write(snap.Root[:])
+	buf.Write(snap.Parent[:])
+
+	if err := binary.Write(&buf, binary.BigEndian, snap.Time.Unix()); err != nil {
+		return nil, fmt.Errorf("write time seconds: %w", err)
+	}
+	if err := binary.Write(&buf, binary.BigEndian, int32(snap.Time.Nanosecond())); err != nil { //nolint:gosec // Nanosecond() returns 0-999999999, always fits in int32
+		return nil, fmt.Errorf("write time nanoseconds: %w", err)
+	}
+
+	if err := writeString(&buf, snap.Message); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeSnapshot(data []byte) (*Snapshot, error) {
+	r := bytes.NewReader(data)
+
+	alg, err := readObjectHeader(r, MagicSnap)
+	if err != nil {
+		return nil, err
+	}
+
+	// versions differ only in the header
+	snap, err := decodeSnapshotV1(r)
+	if err != nil {
+		return nil, err
+	}
+	snap.Algorithm = alg
+	return snap, nil
+}
+
+func decodeSnapshotV1(r io.Reader) (*Snapshot, error) {
+	var snap Snapshot
+
+	if _, err := io.ReadFull(r, snap.Root[:]); err != nil {
+		return nil, fmt.Errorf("read root hash: %w", err)
+	}
+	if _, err := io.ReadFull(r, snap.Parent[:]); err != nil {
+		return nil, fmt.Errorf("read parent hash: %w", err)
+	}
+
+	var secs int64
+	if err := binary.Read(r, binary.BigEndian, &secs); err != nil {
+		return nil, fmt.Errorf("read time seconds: %w", err)
+	}
+	var nsec int32
+	if err := binary.Read(r, binary.BigEndian, &nsec); err != nil {
+		return nil, fmt.Errorf("read time nanoseconds: %w", err)
+	}
+	snap.Time = time.Unix(secs, int64(nsec))
+
+	msg, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	snap.Message = msg
+
+	return &snap, nil
+}
+
+func EncodeManifest(m *Manifest) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeObjectHeader(&buf, MagicManifest, m.Algorithm); err != nil {
+		return nil, err
+	}
+
+	if len(m.Chunks) > math.MaxUint32 {
+		return nil, fmt.Errorf("too many chunks: %d", len(m.Chunks))
+	}
+	if err := binary.Write(&buf, binary.BigEndian, uint32(len(m.Chunks))); err != nil { //nolint:gosec // bounds checked above
+		return nil, fmt.Errorf("write chunk count: %w", err)
+	}
+
+	for _, c := range m.Chunks {
+		buf.Write(c.Hash[:])
+		if err := binary.Write(&buf, binary.BigEndian, c.Size); err != nil {
+			return nil, fmt.Errorf("write chunk size: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeManifest(data []byte) (*Manifest, error) {
+	r := bytes.NewReader(data)
+
+	alg, err := readObjectHeader(r, MagicManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// versions differ only in the header
+	m, err := decodeManifestV1(r)
+	if err != nil {
+		return nil, err
+	}
+	m.Algorithm = alg
+	return m, nil
+}
+
+func decodeManifestV1(r *bytes.Reader) (*Manifest, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("read chunk count: %w", err)
+	}
+	// each chunk takes 36 bytes; reject counts the data can't hold
+	if int64(count)*36 > int64(r.Len()) {
+		return nil, fmt.Errorf("chunk count %d exceeds data", count)
+	}
+
+	chunks := make([]Chunk, count)
+	for i := range chunks {
+		c := &chunks[i]
+		if _, err := io.ReadFull(r, c.Hash[:]); err != nil {
+			return nil, fmt.Errorf("decode chunk %d: read hash: %w", i, err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &c.Size); err != nil {
+			return nil, fmt.Errorf("decode chunk %d: read size: %w", i, err)
+		}
+	}
+
+	return &Manifest{Chunks: chunks}, nil
+}
+
+// configSettingsVersion marks store configs followed by settings. Configs
+// without any keep version 1, so older releases still open those stores.
+const configSettingsVersion uint16 = 2
+
+func EncodeStoreConfig(c *StoreConfig) ([]byte, error) {
+	version := CurrentVersion
+	if len(c.Settings) > 0 {
+		version = configSettingsVersion
+	}
+
+	var buf bytes.Buffer
+	if err := writeHeaderVersion(&buf, MagicConfig, version); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Write(&buf, binary.BigEndian, c.Algorithm); err != nil {
+		return nil, fmt.Errorf("write algorithm: %w", err)
+	}
+	if version == configSettingsVersion {
+		if err := writeSettings(&buf, c.Settings); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeStoreConfig(data []byte) (*StoreConfig, error) {
+	r := bytes.NewReader(data)
+
+	version, err := readHeaderMax(r, MagicConfig, configSettingsVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1, configSettingsVersion:
+		return decodeStoreConfigV1(r, version)
+	default:
+		return nil, fmt.Errorf("unknown config version: %d", version)
+	}
+}
+
+// decodeStoreConfigV1 decodes version 1 configs and, with version 2, the
+// settings that follow.
+func decodeStoreConfigV1(r io.Reader, version uint16) (*StoreConfig, error) {
+	var c StoreConfig
+	if err := binary.Read(r, binary.BigEndian, &c.Algorithm); err != nil {
+		return nil, fmt.Errorf("read algorithm: %w", err)
+	}
+	if !c.Algorithm.Valid() {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownAlgorithm, c.Algorithm)
+	}
+	if version == configSettingsVersion {
+		settings, err := readSettings(r)
+		if err != nil {
+			return nil, err
+		}
+		c.Settings = settings
+	}
+	return &c, nil
+}
+
+// EncodePackIndex encodes idx, whose entries must be sorted by hash.
+func EncodePackIndex(idx *PackIndex) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, MagicPackIdx); err != nil {
+		return nil, err
+	}
+
+	if len(idx.Entries) > math.MaxUint32 {
+		return nil, fmt.Errorf("too many pack entries: %d", len(idx.Entries))
+	}
+	if err := binary.Write(&buf, binary.BigEndian, uint32(len(idx.Entries))); err != nil { //nolint:gosec // bounds checked above
+		return nil, fmt.Errorf("write entry count: %w", err)
+	}
+
+	for i, e := range idx.Entries {
+		if i > 0 && bytes.Compare(idx.Entries[i-1].Hash[:], e.Hash[:]) >= 0 {
+			return nil, fmt.Errorf("pack entries not sorted by hash at %d", i)
+		}
+		buf.Write(e.Hash[:])
+		if err := binary.Write(&buf, binary.BigEndian, e.Offset); err != nil {
+			return nil, fmt.Errorf("write offset: %w", err)
+		}
+		if err := binary.Write(&buf, binary.BigEndian, e.Length); err != nil {
+			return nil, fmt.Errorf("write length: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodePackIndex(data []byte) (*PackIndex, error) {
+	r := bytes.NewReader(data)
+
+	version, err := ReadHeader(r, MagicPackIdx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 1:
+		return decodePackIndexV1(r)
+	default:
+		return nil, fmt.Errorf("unknown pack index version: %d", version)
+	}
+}
+
+func decodePackIndexV1(r *bytes.Reader) (*PackIndex, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("read entry count: %w", err)
+	}
+	// each entry takes 48 bytes; don't trust count for the allocation
+	if int64(count)*48 > int64(r.Len()) {
+		return nil, fmt.Errorf("entry count %d exceeds data", count)
+	}
+
+	entries := make([]PackEntry, count)
+	for i := range entries {
+		e := &entries[i]
+		if _, err := io.ReadFull(r, e.Hash[:]); err != nil {
+			return nil, fmt.Errorf("decode entry %d: read hash: %w", i, err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &e.Offset); err != nil {
+			return nil, fmt.Errorf("decode entry %d: read offset: %w", i, err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &e.Length); err != nil {
+			return nil, fmt.Errorf("decode entry %d: read length: %w", i, err)
+		}
+		// readers binary search the entries
+		if i > 0 && bytes.Compare(entries[i-1].Hash[:], e.Hash[:]) >= 0 {
+			return nil, fmt.Errorf("pack entries not sorted by hash at %d", i)
+		}
+	}
+
+	return &PackIndex{Entries: entries}, nil
+}
@@ -3,7 +3,10 @@ package object
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"maps"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -153,8 +156,8 @@ func TestEncodeDecodeTree(t *testing.T) {
 		{
 			name: "unicode filenames",
 			tree: &Tree{Entries: []Entry{
-				{Name: "文件.txt", Mode: ModeRegular, Size: 42, Hash: hash1},
 				{Name: "données.json", Mode: ModeRegular, Size: 256, Hash: hash2},
+				{Name: "文件.txt", Mode: ModeRegular, Size: 42, Hash: hash1},
 			}},
 			wantErr: false,
 		},
@@ -172,6 +175,27 @@ func TestEncodeDecodeTree(t *testing.T) {
 			}},
 			wantErr: false,
 		},
+		{
+			name: "full metadata",
+			tree: &Tree{Entries: []Entry{
+				{Name: "etc", Mode: ModeDirectory, Hash: hash3, Meta: &Metadata{Perm: 0o755}},
+				{Name: "passwd", Mode: ModeRegular, Size: 7, Hash: hash1, Meta: &Metadata{
+					Perm: 0o4644, UID: 1000, GID: 100,
+					Xattrs: []Xattr{{Name: "security.selinux", Value: []byte("etc_t")}, {Name: "user.empty", Value: []byte{}}},
+				}},
+				{Name: "placeholder", Mode: ModeInaccessible},
+			}},
+			wantErr: false,
+		},
+		{
+			name: "unsorted xattrs",
+			tree: &Tree{Entries: []Entry{
+				{Name: "f", Mode: ModeRegular, Hash: hash1, Meta: &Metadata{
+					Xattrs: []Xattr{{Name: "user.b"}, {Name: "user.a"}},
+				}},
+			}},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -209,6 +233,9 @@ func TestEncodeDecodeTree(t *testing.T) {
 				if got.Hash != want.Hash {
 					t.Errorf("entry[%d].Hash = %v, want %v", i, got.Hash, want.Hash)
 				}
+				if !got.Meta.Equal(want.Meta) {
+					t.Errorf("entry[%d].Meta = %+v, want %+v", i, got.Meta, want.Meta)
+				}
 			}
 		})
 	}
@@ -237,6 +264,11 @@ func TestDecodeTreeErrors(t *testing.T) {
 			data:    []byte("MRKT\x00\x01\x00"),
 			wantErr: "read entry count",
 		},
+		{
+			name:    "unknown entry flags",
+			data:    append([]byte("MRKT\x00\x03\x00\x00\x00\x00\x01\x00"+strings.Repeat("\x00", 8)+"\x00\x01f"+strings.Repeat("\x00", 32)), 0x80),
+			wantErr: "unknown entry flags",
+		},
 	}
 
 	for _, tt := range tests {
@@ -373,6 +405,26 @@ func TestDecodeIndexErrors(t *testing.T) {
 			data:    []byte("MRKI\x00\x01\x00"),
 			wantErr: "read entry count",
 		},
+		{
+			name:    "unsupported version",
+			data:    []byte("MRKI\x00\x04\x00\x00\x00\x00"),
+			wantErr: "unsupported version",
+		},
+		{
+			name:    "truncated granularity",
+			data:    []byte("MRKI\x00\x03\x00\x00"),
+			wantErr: "read granularity",
+		},
+		{
+			name:    "negative granularity",
+			data:    []byte("MRKI\x00\x03\xff\xff\xff\xff\xff\xff\xff\xff\x00\x00\x00\x00"),
+			wantErr: "negative granularity",
+		},
+		{
+			name:    "shared prefix longer than previous path",
+			data:    []byte("MRKI\x00\x02\x00\x00\x00\x01\x00\x01\x00\x00"),
+			wantErr: "exceeds previous path length",
+		},
 	}
 
 	for _, tt := range tests {
@@ -390,6 +442,518 @@ func TestDecodeIndexErrors(t *testing.T) {
 	}
 }
 
+func TestIndexPrefixCompression(t *testing.T) {
+	t.Parallel()
+
+	hash := HashBytes([]byte("content"))
+	var entries []IndexEntry
+	for _, dir := range []string{"a/very/deep/monorepo/package/src", "a/very/deep/monorepo/package/test"} {
+		for _, name := range []string{"one.go", "two.go", "three.go"} {
+			entries = append(entries, IndexEntry{Path: dir + "/" + name, Size: 1, ModTime: time.Unix(1, 0), Hash: hash})
+		}
+	}
+
+	encoded, err := EncodeIndex(&Index{Entries: entries})
+	if err != nil {
+		t.Fatalf("EncodeIndex() error = %v", err)
+	}
+
+	pathBytes := 0
+	for _, e := range entries {
+		pathBytes += len(e.Path)
+	}
+	// each entry spends 4 bytes on lengths and 8+8+4+32 on its fields
+	if limit := 10 + len(entries)*(4+52) + pathBytes/2; len(encoded) > limit {
+		t.Errorf("encoded size = %d, want at most %d with shared prefixes elided", len(encoded), limit)
+	}
+
+	decoded, err := DecodeIndex(encoded)
+	if err != nil {
+		t.Fatalf("DecodeIndex() error = %v", err)
+	}
+	for i, want := range entries {
+		if got := decoded.Entries[i].Path; got != want.Path {
+			t.Errorf("entry[%d].Path = %q, want %q", i, got, want.Path)
+		}
+	}
+}
+
+func TestDecodeIndexV1(t *testing.T) {
+	t.Parallel()
+
+	hash := HashBytes([]byte("content"))
+	var buf bytes.Buffer
+	buf.WriteString(MagicIndex)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(1))
+	_ = binary.Write(&buf, binary.BigEndian, uint32(1))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len("src/main.go")))
+	buf.WriteString("src/main.go")
+	_ = binary.Write(&buf, binary.BigEndian, int64(42))
+	_ = binary.Write(&buf, binary.BigEndian, int64(1700000000))
+	_ = binary.Write(&buf, binary.BigEndian, int32(5))
+	buf.Write(hash[:])
+
+	decoded, err := DecodeIndex(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeIndex() error = %v", err)
+	}
+	want := IndexEntry{Path: "src/main.go", Size: 42, ModTime: time.Unix(1700000000, 5), Hash: hash}
+	if len(decoded.Entries) != 1 {
+		t.Fatalf("entry count = %d, want 1", len(decoded.Entries))
+	}
+	if got := decoded.Entries[0]; got.Path != want.Path || got.Size != want.Size || !got.ModTime.Equal(want.ModTime) || got.Hash != want.Hash {
+		t.Errorf("entry = %+v, want %+v", got, want)
+	}
+	if loc := decoded.Entries[0].ModTime.Location(); loc != time.UTC {
+		t.Errorf("ModTime location = %v, want UTC", loc)
+	}
+	if decoded.Granularity != 0 {
+		t.Errorf("Granularity = %v, want 0 for a v1 index", decoded.Granularity)
+	}
+}
+
+func TestEncodeDecodeDedupStats(t *testing.T) {
+	t.Parallel()
+
+	want := &DedupStats{Written: 3, Deduplicated: 7, BytesWritten: 1024, BytesSaved: 4096}
+
+	encoded, err := EncodeDedupStats(want)
+	if err != nil {
+		t.Fatalf("EncodeDedupStats() error = %v", err)
+	}
+
+	got, err := DecodeDedupStats(encoded)
+	if err != nil {
+		t.Fatalf("DecodeDedupStats() error = %v", err)
+	}
+	if *got != *want {
+		t.Errorf("DecodeDedupStats() = %+v, want %+v", *got, *want)
+	}
+
+	if _, err := DecodeDedupStats(encoded[:len(encoded)-1]); err == nil {
+		t.Error("DecodeDedupStats() truncated: expected error, got nil")
+	}
+	if _, err := DecodeDedupStats([]byte("MRKB\x00\x01")); err == nil {
+		t.Error("DecodeDedupStats() wrong magic: expected error, got nil")
+	}
+}
+
+func TestEncodeDecodeCacheStats(t *testing.T) {
+	t.Parallel()
+
+	want := &CacheStats{Hits: 90, Stale: 4, Misses: 6, Time: time.Date(2024, 5, 1, 12, 0, 0, 5, time.UTC)}
+
+	encoded, err := EncodeCacheStats(want)
+	if err != nil {
+		t.Fatalf("EncodeCacheStats() error = %v", err)
+	}
+
+	got, err := DecodeCacheStats(encoded)
+	if err != nil {
+		t.Fatalf("DecodeCacheStats() error = %v", err)
+	}
+	if *got != *want {
+		t.Errorf("DecodeCacheStats() = %+v, want %+v", *got, *want)
+	}
+	if got.HitRate() != 0.9 {
+		t.Errorf("HitRate() = %v, want 0.9", got.HitRate())
+	}
+
+	if _, err := DecodeCacheStats(encoded[:len(encoded)-1]); err == nil {
+		t.Error("DecodeCacheStats() truncated: expected error, got nil")
+	}
+}
+
+func TestEncodeDecodeReachable(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := HashBytes([]byte("a")), HashBytes([]byte("b")), HashBytes([]byte("c"))
+	sorted := []Hash{a, b, c}
+	slices.SortFunc(sorted, func(x, y Hash) int { return bytes.Compare(x[:], y[:]) })
+	want := &Reachable{Roots: sorted[:1], Live: sorted}
+
+	encoded, err := EncodeReachable(want)
+	if err != nil {
+		t.Fatalf("EncodeReachable() error = %v", err)
+	}
+
+	got, err := DecodeReachable(encoded)
+	if err != nil {
+		t.Fatalf("DecodeReachable() error = %v", err)
+	}
+	if !slices.Equal(got.Roots, want.Roots) || !slices.Equal(got.Live, want.Live) {
+		t.Errorf("DecodeReachable() = %+v, want %+v", got, want)
+	}
+
+	if _, err := DecodeReachable(encoded[:len(encoded)-1]); err == nil {
+		t.Error("DecodeReachable() truncated: expected error, got nil")
+	}
+	if _, err := EncodeReachable(&Reachable{Live: []Hash{sorted[1], sorted[0]}}); err == nil {
+		t.Error("EncodeReachable() unsorted: expected error, got nil")
+	}
+}
+
+func TestEncodeDecodeProvenance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		prov *Provenance
+	}{
+		{
+			name: "full record",
+			prov: &Provenance{
+				Root:        HashBytes([]byte("root")),
+				Time:        time.Unix(1700000000, 123456789),
+				Hostname:    "build-01",
+				User:        "ci",
+				ToolVersion: "v1.2.3",
+				IgnoreHash:  HashBytes([]byte("*.log")),
+				Settings:    map[string]string{"symlinks": "record", "concurrency": "8"},
+			},
+		},
+		{
+			name: "minimal record",
+			prov: &Provenance{Root: HashBytes([]byte("root")), Time: time.Unix(0, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			encoded, err := EncodeProvenance(tt.prov)
+			if err != nil {
+				t.Fatalf("EncodeProvenance() error = %v", err)
+			}
+			got, err := DecodeProvenance(encoded)
+			if err != nil {
+				t.Fatalf("DecodeProvenance() error = %v", err)
+			}
+
+			if got.Root != tt.prov.Root || !got.Time.Equal(tt.prov.Time) ||
+				got.Hostname != tt.prov.Hostname || got.User != tt.prov.User ||
+				got.ToolVersion != tt.prov.ToolVersion || got.IgnoreHash != tt.prov.IgnoreHash {
+				t.Errorf("DecodeProvenance() = %+v, want %+v", got, tt.prov)
+			}
+			if len(got.Settings) != len(tt.prov.Settings) {
+				t.Fatalf("len(Settings) = %d, want %d", len(got.Settings), len(tt.prov.Settings))
+			}
+			for k, v := range tt.prov.Settings {
+				if got.Settings[k] != v {
+					t.Errorf("Settings[%q] = %q, want %q", k, got.Settings[k], v)
+				}
+			}
+
+			// encoding is deterministic regardless of map iteration order
+			again, err := EncodeProvenance(tt.prov)
+			if err != nil {
+				t.Fatalf("EncodeProvenance() error = %v", err)
+			}
+			if !bytes.Equal(encoded, again) {
+				t.Error("EncodeProvenance() not deterministic")
+			}
+
+			if _, err := DecodeProvenance(encoded[:len(encoded)-1]); err == nil {
+				t.Error("DecodeProvenance() truncated: expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeActivity(t *testing.T) {
+	t.Parallel()
+
+	want := &Activity{Entries: []DirActivity{
+		{Path: "", Hash: HashBytes([]byte("root")), Changes: 12},
+		{Path: "src/pkg", Hash: HashBytes([]byte("pkg")), Changes: 0},
+	}}
+
+	encoded, err := EncodeActivity(want)
+	if err != nil {
+		t.Fatalf("EncodeActivity() error = %v", err)
+	}
+
+	got, err := DecodeActivity(encoded)
+	if err != nil {
+		t.Fatalf("DecodeActivity() error = %v", err)
+	}
+	if len(got.Entries) != len(want.Entries) {
+		t.Fatalf("len(Entries) = %d, want %d", len(got.Entries), len(want.Entries))
+	}
+	for i := range want.Entries {
+		if got.Entries[i] != want.Entries[i] {
+			t.Errorf("Entries[%d] = %+v, want %+v", i, got.Entries[i], want.Entries[i])
+		}
+	}
+
+	if _, err := DecodeActivity(encoded[:len(encoded)-1]); err == nil {
+		t.Error("DecodeActivity() truncated: expected error, got nil")
+	}
+}
+
+func TestEncodeDecodeSnapshot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		snap *Snapshot
+	}{
+		{
+			name: "with parent and message",
+			snap: &Snapshot{
+				Root:    HashBytes([]byte("root")),
+				Parent:  HashBytes([]byte("parent")),
+				Time:    time.Unix(1700000000, 123456789),
+				Message: "nightly",
+			},
+		},
+		{
+			name: "first snapshot",
+			snap: &Snapshot{Root: HashBytes([]byte("root")), Time: time.Unix(0, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			encoded, err := EncodeSnapshot(tt.snap)
+			if err != nil {
+				t.Fatalf("EncodeSnapshot() error = %v", err)
+			}
+			got, err := DecodeSnapshot(encoded)
+			if err != nil {
+				t.Fatalf("DecodeSnapshot() error = %v", err)
+			}
+
+			if got.Root != tt.snap.Root || got.Parent != tt.snap.Parent ||
+				!got.Time.Equal(tt.snap.Time) || got.Message != tt.snap.Message {
+				t.Errorf("DecodeSnapshot() = %+v, want %+v", got, tt.snap)
+			}
+
+			if _, err := DecodeSnapshot(encoded[:len(encoded)-1]); err == nil {
+				t.Error("DecodeSnapshot() truncated: expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeManifest(t *testing.T) {
+	t.Parallel()
+
+	want := &Manifest{Chunks: []Chunk{
+		{Hash: HashBytes([]byte("first")), Size: 1 << 20},
+		{Hash: HashBytes([]byte("second")), Size: 12345},
+	}}
+
+	encoded, err := EncodeManifest(want)
+	if err != nil {
+		t.Fatalf("EncodeManifest() error = %v", err)
+	}
+
+	got, err := DecodeManifest(encoded)
+	if err != nil {
+		t.Fatalf("DecodeManifest() error = %v", err)
+	}
+	if len(got.Chunks) != len(want.Chunks) {
+		t.Fatalf("len(Chunks) = %d, want %d", len(got.Chunks), len(want.Chunks))
+	}
+	for i := range want.Chunks {
+		if got.Chunks[i] != want.Chunks[i] {
+			t.Errorf("Chunks[%d] = %+v, want %+v", i, got.Chunks[i], want.Chunks[i])
+		}
+	}
+	if got.Size() != 1<<20+12345 {
+		t.Errorf("Size() = %d, want %d", got.Size(), 1<<20+12345)
+	}
+
+	if _, err := DecodeManifest(encoded[:len(encoded)-1]); err == nil {
+		t.Error("DecodeManifest() truncated: expected error, got nil")
+	}
+	if _, err := DecodeTree(encoded); err == nil {
+		t.Error("DecodeTree() of a manifest: expected error, got nil")
+	}
+}
+
+func TestObjectAlgorithmHeader(t *testing.T) {
+	t.Parallel()
+
+	hash := HashBytes([]byte("content"))
+	tests := []struct {
+		name   string
+		encode func(Algorithm) ([]byte, error)
+		decode func([]byte) (Algorithm, error)
+	}{
+		{
+			name:   "blob",
+			encode: func(a Algorithm) ([]byte, error) { return EncodeBlob(&Blob{Content: []byte("x"), Algorithm: a}) },
+			decode: func(d []byte) (Algorithm, error) {
+				b, err := DecodeBlob(d)
+				if err != nil {
+					return 0, err
+				}
+				return b.Algorithm, nil
+			},
+		},
+		{
+			name: "tree",
+			encode: func(a Algorithm) ([]byte, error) {
+				return EncodeTree(&Tree{Entries: []Entry{{Name: "a", Hash: hash}}, Algorithm: a})
+			},
+			decode: func(d []byte) (Algorithm, error) {
+				tr, err := DecodeTree(d)
+				if err != nil {
+					return 0, err
+				}
+				return tr.Algorithm, nil
+			},
+		},
+		{
+			name: "manifest",
+			encode: func(a Algorithm) ([]byte, error) {
+				return EncodeManifest(&Manifest{Chunks: []Chunk{{Hash: hash, Size: 1}}, Algorithm: a})
+			},
+			decode: func(d []byte) (Algorithm, error) {
+				m, err := DecodeManifest(d)
+				if err != nil {
+					return 0, err
+				}
+				return m.Algorithm, nil
+			},
+		},
+		{
+			name: "snapshot",
+			encode: func(a Algorithm) ([]byte, error) {
+				return EncodeSnapshot(&Snapshot{Root: hash, Time: time.Unix(1, 0), Algorithm: a})
+			},
+			decode: func(d []byte) (Algorithm, error) {
+				snap, err := DecodeSnapshot(d)
+				if err != nil {
+					return 0, err
+				}
+				return snap.Algorithm, nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sha, err := tt.encode(SHA256)
+			if err != nil {
+				t.Fatalf("encode sha256: %v", err)
+			}
+			if v := binary.BigEndian.Uint16(sha[4:6]); v != CurrentVersion {
+				t.Errorf("sha256 header version = %d, want %d", v, CurrentVersion)
+			}
+
+			b3, err := tt.encode(BLAKE3)
+			if err != nil {
+				t.Fatalf("encode blake3: %v", err)
+			}
+			if v := binary.BigEndian.Uint16(b3[4:6]); v != algorithmVersion || b3[6] != byte(BLAKE3) {
+				t.Errorf("blake3 header = version %d, algorithm %d", v, b3[6])
+			}
+			// the rest of the encoding is unchanged
+			if !bytes.Equal(sha[6:], b3[7:]) {
+				t.Error("blake3 body differs from sha256 body")
+			}
+
+			for alg, data := range map[Algorithm][]byte{SHA256: sha, BLAKE3: b3} {
+				got, err := tt.decode(data)
+				if err != nil {
+					t.Fatalf("decode %s: %v", alg, err)
+				}
+				if got != alg {
+					t.Errorf("decoded algorithm = %s, want %s", got, alg)
+				}
+			}
+
+			bad := bytes.Clone(b3)
+			bad[6] = 9
+			if _, err := tt.decode(bad); !errors.Is(err, ErrUnknownAlgorithm) {
+				t.Errorf("decode unknown algorithm: error = %v, want ErrUnknownAlgorithm", err)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeStoreConfig(t *testing.T) {
+	t.Parallel()
+
+	for _, alg := range []Algorithm{SHA256, BLAKE3} {
+		encoded, err := EncodeStoreConfig(&StoreConfig{Algorithm: alg})
+		if err != nil {
+			t.Fatalf("EncodeStoreConfig() error = %v", err)
+		}
+		got, err := DecodeStoreConfig(encoded)
+		if err != nil {
+			t.Fatalf("DecodeStoreConfig() error = %v", err)
+		}
+		if got.Algorithm != alg {
+			t.Errorf("Algorithm = %s, want %s", got.Algorithm, alg)
+		}
+	}
+
+	// settings need version 2; a config without keeps version 1
+	settings := map[string]string{"concurrency": "4", "ignore-filename": ".gitignore"}
+	encoded, err := EncodeStoreConfig(&StoreConfig{Algorithm: BLAKE3, Settings: settings})
+	if err != nil {
+		t.Fatalf("EncodeStoreConfig() error = %v", err)
+	}
+	if v := binary.BigEndian.Uint16(encoded[4:6]); v != configSettingsVersion {
+		t.Errorf("version with settings = %d, want %d", v, configSettingsVersion)
+	}
+	got, err := DecodeStoreConfig(encoded)
+	if err != nil {
+		t.Fatalf("DecodeStoreConfig() error = %v", err)
+	}
+	if got.Algorithm != BLAKE3 || !maps.Equal(got.Settings, settings) {
+		t.Errorf("DecodeStoreConfig() = %s %v, want %s %v", got.Algorithm, got.Settings, BLAKE3, settings)
+	}
+	if plain, _ := EncodeStoreConfig(&StoreConfig{Algorithm: SHA256}); binary.BigEndian.Uint16(plain[4:6]) != 1 {
+		t.Errorf("version without settings = %d, want 1", binary.BigEndian.Uint16(plain[4:6]))
+	}
+
+	if _, err := DecodeStoreConfig([]byte("MRKC\x00\x01\x07")); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("DecodeStoreConfig() unknown algorithm: error = %v, want ErrUnknownAlgorithm", err)
+	}
+}
+
+func TestEncodeDecodePackIndex(t *testing.T) {
+	t.Parallel()
+
+	idx := &PackIndex{Entries: []PackEntry{
+		{Hash: Hash{0x01}, Offset: 6, Length: 40},
+		{Hash: Hash{0x02}, Offset: 46, Length: 1},
+		{Hash: Hash{0xff}, Offset: 47, Length: 1 << 33},
+	}}
+	encoded, err := EncodePackIndex(idx)
+	if err != nil {
+		t.Fatalf("EncodePackIndex() error = %v", err)
+	}
+	got, err := DecodePackIndex(encoded)
+	if err != nil {
+		t.Fatalf("DecodePackIndex() error = %v", err)
+	}
+	if !slices.Equal(got.Entries, idx.Entries) {
+		t.Errorf("DecodePackIndex() = %+v, want %+v", got.Entries, idx.Entries)
+	}
+
+	unsorted := &PackIndex{Entries: []PackEntry{idx.Entries[1], idx.Entries[0]}}
+	if _, err := EncodePackIndex(unsorted); err == nil {
+		t.Error("EncodePackIndex() unsorted entries: error = nil")
+	}
+	if _, err := DecodePackIndex(encoded[:len(encoded)-1]); err == nil {
+		t.Error("DecodePackIndex() truncated: error = nil")
+	}
+	if _, err := DecodePackIndex([]byte("MRKX\x00\x01\xff\xff\xff\xff")); err == nil {
+		t.Error("DecodePackIndex() oversized count: error = nil")
+	}
+}
+
 func TestHeaderRoundTrip(t *testing.T) {
 	t.Parallel()
 
@@ -400,6 +964,8 @@ func TestHeaderRoundTrip(t *testing.T) {
 		{name: "blob magic", magic: MagicBlob},
 		{name: "tree magic", magic: MagicTree},
 		{name: "index magic", magic: MagicIndex},
+		{name: "dedup magic", magic: MagicDedup},
+		{name: "provenance magic", magic: MagicProv},
 	}
 
 	for _, tt := range tests {
@@ -480,12 +1046,120 @@ func TestTreeEncodedFormat(t *testing.T) {
 	}
 }
 
+func TestTreeMetadataFormat(t *testing.T) {
+	t.Parallel()
+
+	hash := HashBytes([]byte("content"))
+	plain := &Tree{Entries: []Entry{{Name: "a.txt", Mode: ModeRegular, Size: 42, Hash: hash}}}
+	withMeta := func(perm uint32) *Tree {
+		return &Tree{Entries: []Entry{{Name: "a.txt", Mode: ModeRegular, Size: 42, Hash: hash, Meta: &Metadata{Perm: perm}}}}
+	}
+
+	for _, alg := range []Algorithm{SHA256, BLAKE3} {
+		plain.Algorithm = alg
+		encodedPlain, err := EncodeTree(plain)
+		if err != nil {
+			t.Fatalf("EncodeTree() error = %v", err)
+		}
+		t1, t2 := withMeta(0o644), withMeta(0o600)
+		t1.Algorithm, t2.Algorithm = alg, alg
+		encoded1, err := EncodeTree(t1)
+		if err != nil {
+			t.Fatalf("EncodeTree() error = %v", err)
+		}
+		encoded2, err := EncodeTree(t2)
+		if err != nil {
+			t.Fatalf("EncodeTree() error = %v", err)
+		}
+
+		if version := binary.BigEndian.Uint16(encoded1[4:6]); version != entryFlagsVersion {
+			t.Errorf("%s version = %d, want %d", alg, version, entryFlagsVersion)
+		}
+		if Algorithm(encoded1[6]) != alg {
+			t.Errorf("%s algorithm byte = %d", alg, encoded1[6])
+		}
+		if bytes.Equal(encoded1, encodedPlain) || bytes.Equal(encoded1, encoded2) {
+			t.Errorf("%s: metadata doesn't change the encoding", alg)
+		}
+		decoded, err := DecodeTree(encoded1)
+		if err != nil {
+			t.Fatalf("DecodeTree() error = %v", err)
+		}
+		if decoded.Algorithm != alg || decoded.Entries[0].Meta.Perm != 0o644 {
+			t.Errorf("DecodeTree() = %+v", decoded)
+		}
+	}
+}
+
+func TestTreeModTimesFormat(t *testing.T) {
+	t.Parallel()
+
+	hash := HashBytes([]byte("content"))
+	at := func(ns int64, meta *Metadata) *Tree {
+		return &Tree{ModTimes: true, Entries: []Entry{
+			{Name: "a.txt", Mode: ModeRegular, Size: 42, Hash: hash, ModTime: time.Unix(1700000000, ns), Meta: meta},
+		}}
+	}
+
+	encoded, err := EncodeTree(at(5, nil))
+	if err != nil {
+		t.Fatalf("EncodeTree() error = %v", err)
+	}
+	if version := binary.BigEndian.Uint16(encoded[4:6]); version != modTimeVersion {
+		t.Errorf("version = %d, want %d", version, modTimeVersion)
+	}
+	later, err := EncodeTree(at(6, nil))
+	if err != nil {
+		t.Fatalf("EncodeTree() error = %v", err)
+	}
+	if bytes.Equal(encoded, later) {
+		t.Error("a nanosecond mtime change doesn't change the encoding")
+	}
+	// without ModTimes the same entry drops its mtime
+	plain := at(5, nil)
+	plain.ModTimes = false
+	plainEncoded, err := EncodeTree(plain)
+	if err != nil {
+		t.Fatalf("EncodeTree() error = %v", err)
+	}
+	if binary.BigEndian.Uint16(plainEncoded[4:6]) != CurrentVersion {
+		t.Errorf("content-only tree version = %d, want %d", binary.BigEndian.Uint16(plainEncoded[4:6]), CurrentVersion)
+	}
+
+	for _, tree := range []*Tree{at(5, nil), at(5, &Metadata{Perm: 0o644}), {ModTimes: true, Entries: []Entry{}}} {
+		encoded, err := EncodeTree(tree)
+		if err != nil {
+			t.Fatalf("EncodeTree() error = %v", err)
+		}
+		decoded, err := DecodeTree(encoded)
+		if err != nil {
+			t.Fatalf("DecodeTree() error = %v", err)
+		}
+		if !decoded.ModTimes {
+			t.Error("DecodeTree() ModTimes = false")
+		}
+		for i, e := range decoded.Entries {
+			if want := tree.Entries[i]; !e.ModTime.Equal(want.ModTime) || !e.Meta.Equal(want.Meta) {
+				t.Errorf("entry %d = %+v, want %+v", i, e, want)
+			}
+		}
+		// decoding loses nothing, so the tree re-encodes to the same bytes
+		again, err := EncodeTree(decoded)
+		if err != nil {
+			t.Fatalf("EncodeTree() error = %v", err)
+		}
+		if !bytes.Equal(again, encoded) {
+			t.Error("re-encoded tree differs")
+		}
+	}
+}
+
 func TestIndexEncodedFormat(t *testing.T) {
 	t.Parallel()
 
 	now := time.Now()
 	hash := HashBytes([]byte("content"))
-	index := &Index{Entries: []IndexEntry{
+	index := &Index{Granularity: 2 * time.Second, Entries: []IndexEntry{
 		{Path: "file.txt", Size: 100, ModTime: now, Hash: hash},
 	}}
 
@@ -499,11 +1173,16 @@ func TestIndexEncodedFormat(t *testing.T) {
 	}
 
 	version := binary.BigEndian.Uint16(encoded[4:6])
-	if version != CurrentVersion {
-		t.Errorf("version = %d, want %d", version, CurrentVersion)
+	if version != IndexVersion {
+		t.Errorf("version = %d, want %d", version, IndexVersion)
 	}
 
-	entryCount := binary.BigEndian.Uint32(encoded[6:10])
+	granularity := time.Duration(binary.BigEndian.Uint64(encoded[6:14])) //nolint:gosec // written from a time.Duration
+	if granularity != index.Granularity {
+		t.Errorf("granularity = %v, want %v", granularity, index.Granularity)
+	}
+
+	entryCount := binary.BigEndian.Uint32(encoded[14:18])
 	if entryCount != 1 {
 		t.Errorf("entry count = %d, want 1", entryCount)
 	}
@@ -596,7 +1275,7 @@ func TestLargeTree(t *testing.T) {
 	entries := make([]Entry, 1000)
 	for i := range entries {
 		entries[i] = Entry{
-			Name: "file_" + string(rune('a'+i%26)) + "_" + string(rune('0'+i%10)),
+			Name: "file_" + string(rune('a'+i/100)) + string(rune('0'+i/10%10)) + string(rune('0'+i%10)),
 			Mode: Mode(i % 4), //nolint:gosec // i%4 is always 0-3, fits in uint8
 			Size: int64(i * 100),
 			Hash: HashBytes([]byte{byte(i)}),
@@ -661,3 +1340,72 @@ func TestLargeIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeIndexJournal(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Unix(1700000000, 500).UTC()
+	first := []IndexEntry{
+		{Path: "a.txt", Size: 1, ModTime: modTime, Hash: HashBytes([]byte("a"))},
+		{Path: "src/b.go", Size: 2, ModTime: modTime, Hash: HashBytes([]byte("b"))},
+	}
+	second := []IndexEntry{
+		{Path: "a.txt", Size: 3, ModTime: modTime, Hash: HashBytes([]byte("a2"))},
+	}
+
+	header, err := EncodeIndexJournalHeader()
+	if err != nil {
+		t.Fatalf("EncodeIndexJournalHeader() error = %v", err)
+	}
+	rec1, err := EncodeIndexJournalRecord(first)
+	if err != nil {
+		t.Fatalf("EncodeIndexJournalRecord() error = %v", err)
+	}
+	rec2, err := EncodeIndexJournalRecord(second)
+	if err != nil {
+		t.Fatalf("EncodeIndexJournalRecord() error = %v", err)
+	}
+	journal := slices.Concat(header, rec1, rec2)
+	afterFirst := len(header) + len(rec1)
+
+	flipped := slices.Clone(journal)
+	flipped[len(flipped)-1] ^= 0xff
+
+	tests := []struct {
+		name      string
+		data      []byte
+		want      []IndexEntry
+		wantValid int
+	}{
+		{name: "empty", data: nil, wantValid: 0},
+		{name: "torn header", data: header[:3], wantValid: 0},
+		{name: "header only", data: header, wantValid: len(header)},
+		{name: "whole", data: journal, want: slices.Concat(first, second), wantValid: len(journal)},
+		{name: "torn record header", data: journal[:afterFirst+5], want: first, wantValid: afterFirst},
+		{name: "torn payload", data: journal[:len(journal)-1], want: first, wantValid: afterFirst},
+		{name: "checksum mismatch", data: flipped, want: first, wantValid: afterFirst},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, valid, err := DecodeIndexJournal(tt.data)
+			if err != nil {
+				t.Fatalf("DecodeIndexJournal() error = %v", err)
+			}
+			if valid != tt.wantValid {
+				t.Errorf("valid = %d, want %d", valid, tt.wantValid)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b IndexEntry) bool {
+				return a.Path == b.Path && a.Size == b.Size && a.ModTime.Equal(b.ModTime) && a.Hash == b.Hash
+			}) {
+				t.Errorf("entries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := DecodeIndexJournal([]byte("MRKI\x00\x01")); err == nil {
+		t.Error("DecodeIndexJournal() of an index header succeeded, want a magic mismatch")
+	}
+}
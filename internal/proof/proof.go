@@ -0,0 +1,188 @@
+// Package proof builds and checks Merkle inclusion proofs: the encoded trees
+// on the path from a root hash down to one entry, enough for anyone holding
+// only the root hash to confirm the entry is part of it, without the store.
+package proof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+var (
+	ErrInvalidPath  = errors.New("proof: invalid path")
+	ErrPathNotFound = errors.New("proof: path not in tree")
+	ErrInvalid      = errors.New("proof: invalid proof")
+	ErrContent      = errors.New("proof: content does not match the proven entry")
+)
+
+// Proof shows that the entry at Path is in the tree Root.
+type Proof struct {
+	Algorithm object.Algorithm
+	Root      object.Hash
+	Path      string   // slash-separated, relative to Root
+	Trees     [][]byte // encoded trees from Root down to Path's parent directory
+
+	// Manifest is the encoded manifest when Path is a chunked file, so its
+	// content can be checked without the chunks.
+	Manifest []byte
+}
+
+// Prove builds the proof that p is in the tree root.
+func Prove(s *store.Store, root object.Hash, p string) (*Proof, error) {
+	parts, err := splitPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &Proof{Algorithm: s.Algorithm(), Root: root, Path: strings.Join(parts, "/")}
+	h := root
+	var entry *object.Entry
+	for i, name := range parts {
+		data, err := s.GetObject(h)
+		if err != nil {
+			return nil, fmt.Errorf("get tree %s: %w", h, err)
+		}
+		tree, err := object.DecodeTree(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode tree %s: %w", h, err)
+		}
+		pr.Trees = append(pr.Trees, data)
+
+		entry = find(tree, name)
+		if entry == nil {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, strings.Join(parts[:i+1], "/"))
+		}
+		if i < len(parts)-1 && entry.Mode != object.ModeDirectory {
+			return nil, fmt.Errorf("%w: %s is not a directory", ErrPathNotFound, strings.Join(parts[:i+1], "/"))
+		}
+		h = entry.Hash
+	}
+
+	if entry.Mode.IsFile() {
+		data, err := s.GetObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("get file %s: %w", entry.Hash, err)
+		}
+		if bytes.HasPrefix(data, []byte(object.MagicManifest)) {
+			pr.Manifest = data
+		}
+	}
+	return pr, nil
+}
+
+// Verify checks that the trees chain from Root to Path and returns the
+// proven entry. It trusts nothing in the proof but Root, which callers
+// should compare with a root they got elsewhere.
+func (p *Proof) Verify() (*object.Entry, error) {
+	if !p.Algorithm.Valid() {
+		return nil, fmt.Errorf("%w: unknown algorithm %d", ErrInvalid, p.Algorithm)
+	}
+	parts, err := splitPath(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Trees) != len(parts) {
+		return nil, fmt.Errorf("%w: %d trees for a path of depth %d", ErrInvalid, len(p.Trees), len(parts))
+	}
+
+	want := p.Root
+	var entry *object.Entry
+	for i, data := range p.Trees {
+		if got := p.Algorithm.Sum(data); got != want {
+			return nil, fmt.Errorf("%w: tree %d hashes to %s, want %s", ErrInvalid, i, got, want)
+		}
+		tree, err := object.DecodeTree(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: tree %d: %w", ErrInvalid, i, err)
+		}
+		if tree.Algorithm != p.Algorithm {
+			return nil, fmt.Errorf("%w: tree %d uses %s, proof uses %s", ErrInvalid, i, tree.Algorithm, p.Algorithm)
+		}
+		// a tree with duplicate names could prove two entries for one path
+		if err := tree.CheckOrder(); err != nil {
+			return nil, fmt.Errorf("%w: tree %d: %w", ErrInvalid, i, err)
+		}
+
+		entry = find(tree, parts[i])
+		if entry == nil {
+			return nil, fmt.Errorf("%w: tree %d has no entry %q", ErrInvalid, i, parts[i])
+		}
+		if i < len(parts)-1 && entry.Mode != object.ModeDirectory {
+			return nil, fmt.Errorf("%w: %q in tree %d is not a directory", ErrInvalid, parts[i], i)
+		}
+		want = entry.Hash
+	}
+
+	if p.Manifest != nil {
+		if !entry.Mode.IsFile() || p.Algorithm.Sum(p.Manifest) != entry.Hash {
+			return nil, fmt.Errorf("%w: manifest does not belong to %s", ErrInvalid, p.Path)
+		}
+		if _, err := p.manifest(); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// VerifyContent verifies the proof and that content, a file's bytes or a
+// symlink's target, is what the proven entry holds.
+func (p *Proof) VerifyContent(content []byte) error {
+	entry, err := p.Verify()
+	if err != nil {
+		return err
+	}
+	if !entry.Mode.IsFile() && entry.Mode != object.ModeSymlink {
+		return fmt.Errorf("%w: %s is a %s", ErrContent, p.Path, entry.Mode)
+	}
+
+	if p.Manifest != nil {
+		m, err := p.manifest()
+		if err != nil {
+			return err
+		}
+		if !m.Matches(content) {
+			return fmt.Errorf("%w: %s", ErrContent, p.Path)
+		}
+		return nil
+	}
+	if (&object.Blob{Content: content, Algorithm: p.Algorithm}).Hash() != entry.Hash {
+		return fmt.Errorf("%w: %s", ErrContent, p.Path)
+	}
+	return nil
+}
+
+func (p *Proof) manifest() (*object.Manifest, error) {
+	m, err := object.DecodeManifest(p.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: manifest: %w", ErrInvalid, err)
+	}
+	if m.Algorithm != p.Algorithm {
+		return nil, fmt.Errorf("%w: manifest uses %s, proof uses %s", ErrInvalid, m.Algorithm, p.Algorithm)
+	}
+	return m, nil
+}
+
+// splitPath returns the names along p, rejecting paths that don't name an
+// entry below the root.
+func splitPath(p string) ([]string, error) {
+	c := path.Clean(p)
+	if p == "" || c == "." || c == ".." || strings.HasPrefix(c, "../") || path.IsAbs(c) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPath, p)
+	}
+	return strings.Split(c, "/"), nil
+}
+
+func find(t *object.Tree, name string) *object.Entry {
+	for i := range t.Entries {
+		if t.Entries[i].Name == name {
+			return &t.Entries[i]
+		}
+	}
+	return nil
+}
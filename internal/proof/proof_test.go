@@ -0,0 +1,193 @@
+package proof
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+var bigContent = strings.Repeat("0123456789abcdef", 64<<10)
+
+func setup(t *testing.T) (*store.Store, object.Hash) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for rel, content := range map[string]string{
+		"README.md":      "# demo\n",
+		"src/main.go":    "package main\n",
+		"src/a/b/c.txt":  "deep\n",
+		"data/big.bin":   bigContent,
+		"data/other.bin": "other\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := store.Open(t.TempDir(), store.WithAlgorithm(object.BLAKE3))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	res, err := walker.Walk(t.Context(), dir, s, walker.WithChunking(64<<10))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	return s, res.Hash
+}
+
+func TestProve(t *testing.T) {
+	t.Parallel()
+
+	s, root := setup(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		mode     object.Mode
+		manifest bool
+	}{
+		{name: "top level", path: "README.md", content: "# demo\n", mode: object.ModeRegular},
+		{name: "nested", path: "src/a/b/c.txt", content: "deep\n", mode: object.ModeRegular},
+		{name: "unclean path", path: "./src//main.go", content: "package main\n", mode: object.ModeRegular},
+		{name: "directory", path: "src/a", mode: object.ModeDirectory},
+		{name: "chunked", path: "data/big.bin", content: bigContent, mode: object.ModeRegular, manifest: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Prove(s, root, tt.path)
+			if err != nil {
+				t.Fatalf("Prove() error = %v", err)
+			}
+			if (p.Manifest != nil) != tt.manifest {
+				t.Errorf("manifest included = %v, want %v", p.Manifest != nil, tt.manifest)
+			}
+			entry, err := p.Verify()
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if entry.Mode != tt.mode {
+				t.Errorf("entry mode = %s, want %s", entry.Mode, tt.mode)
+			}
+			if tt.mode == object.ModeDirectory {
+				if err := p.VerifyContent(nil); !errors.Is(err, ErrContent) {
+					t.Errorf("VerifyContent() of a directory error = %v, want ErrContent", err)
+				}
+				return
+			}
+			if err := p.VerifyContent([]byte(tt.content)); err != nil {
+				t.Errorf("VerifyContent() error = %v", err)
+			}
+			if err := p.VerifyContent([]byte(tt.content + "x")); !errors.Is(err, ErrContent) {
+				t.Errorf("VerifyContent() of changed content error = %v, want ErrContent", err)
+			}
+		})
+	}
+}
+
+func TestProveErrors(t *testing.T) {
+	t.Parallel()
+
+	s, root := setup(t)
+
+	tests := []struct {
+		name string
+		path string
+		want error
+	}{
+		{name: "empty", path: "", want: ErrInvalidPath},
+		{name: "root", path: ".", want: ErrInvalidPath},
+		{name: "escapes", path: "../etc/passwd", want: ErrInvalidPath},
+		{name: "absolute", path: "/README.md", want: ErrInvalidPath},
+		{name: "missing", path: "src/nope.go", want: ErrPathNotFound},
+		{name: "through a file", path: "README.md/x", want: ErrPathNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := Prove(s, root, tt.path); !errors.Is(err, tt.want) {
+				t.Errorf("Prove(%q) error = %v, want %v", tt.path, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	t.Parallel()
+
+	s, root := setup(t)
+	other, err := s.PutBlob(&object.Blob{Content: []byte("forged")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		tamper func(t *testing.T, p *Proof)
+	}{
+		{name: "wrong root", path: "README.md", tamper: func(_ *testing.T, p *Proof) {
+			p.Root = other
+		}},
+		{name: "flipped byte", path: "src/main.go", tamper: func(_ *testing.T, p *Proof) {
+			p.Trees[1][len(p.Trees[1])-1] ^= 1
+		}},
+		{name: "missing tree", path: "src/main.go", tamper: func(_ *testing.T, p *Proof) {
+			p.Trees = p.Trees[:1]
+		}},
+		{name: "renamed path", path: "src/main.go", tamper: func(_ *testing.T, p *Proof) {
+			p.Path = "src/util.go"
+		}},
+		{name: "swapped entry hash", path: "README.md", tamper: func(t *testing.T, p *Proof) {
+			// a consistent but different tree no longer hashes to Root
+			tree, err := object.DecodeTree(p.Trees[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree.Entries[0].Hash = other
+			data, err := object.EncodeTree(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Trees[0] = data
+		}},
+		{name: "foreign manifest", path: "data/other.bin", tamper: func(t *testing.T, p *Proof) {
+			big, err := Prove(s, root, "data/big.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Manifest = big.Manifest
+		}},
+		{name: "algorithm", path: "README.md", tamper: func(_ *testing.T, p *Proof) {
+			p.Algorithm = object.SHA256
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Prove(s, root, tt.path)
+			if err != nil {
+				t.Fatalf("Prove() error = %v", err)
+			}
+			tt.tamper(t, p)
+			if _, err := p.Verify(); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Verify() error = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// A bundle carries the objects a store holding Old needs to hold New, for
+// moving trees between machines that can't reach each other:
+//
+//	header  MagicBundle, version, algorithm, old hash, new hash
+//	objects object frames, each after everything it references
+//	end     an empty frame, so a truncated bundle is caught
+//
+// Objects are framed as on the wire, large blobs streamed in pieces;
+// receivers hash each one themselves.
+
+var (
+	ErrBundleBase      = errors.New("remote: store lacks the bundle's base")
+	ErrBundleTruncated = errors.New("remote: bundle is truncated")
+)
+
+// BundleHeader says what a bundle holds.
+type BundleHeader struct {
+	Algorithm object.Algorithm
+	Old       object.Hash // the receiver must hold this already
+	New       object.Hash
+}
+
+// WriteBundle writes a bundle of the objects under newRoot that aren't
+// under oldRoot to w. Either may be a tree or a snapshot.
+func WriteBundle(ctx context.Context, w io.Writer, s *store.Store, oldRoot, newRoot object.Hash) (*Result, error) {
+	have := make(map[object.Hash]bool)
+	if err := reachableFrom(s, oldRoot, have); err != nil {
+		return nil, fmt.Errorf("read %s: %w", oldRoot, err)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := writeBundleHeader(bw, &BundleHeader{Algorithm: s.Algorithm(), Old: oldRoot, New: newRoot}); err != nil {
+		return nil, err
+	}
+	res, err := Push(ctx, s, &bundleWriter{w: bw, alg: s.Algorithm(), have: have}, newRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFrame(bw, nil); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, fmt.Errorf("write bundle: %w", err)
+	}
+	return res, nil
+}
+
+// reachableFrom adds h and everything it references to have, reading only
+// trees and snapshots: the hashes of files are noted without their content.
+// Chunks of a manifest aren't noted, so a bundle may repeat some.
+func reachableFrom(s *store.Store, h object.Hash, have map[object.Hash]bool) error {
+	for !h.IsZero() && !have[h] {
+		snap, err := s.GetSnapshot(h)
+		if err != nil {
+			break
+		}
+		have[h] = true
+		if err := reachableTree(s, snap.Root, have); err != nil {
+			return err
+		}
+		h = snap.Parent
+	}
+	if h.IsZero() || have[h] {
+		return nil
+	}
+	return reachableTree(s, h, have)
+}
+
+func reachableTree(s *store.Store, h object.Hash, have map[object.Hash]bool) error {
+	if have[h] {
+		return nil
+	}
+	tree, err := s.GetTree(h)
+	if err != nil {
+		return fmt.Errorf("get tree %s: %w", h, err)
+	}
+	have[h] = true
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case object.ModeDirectory:
+			if err := reachableTree(s, e.Hash, have); err != nil {
+				return err
+			}
+		case object.ModeInaccessible:
+		default:
+			have[e.Hash] = true
+		}
+	}
+	return nil
+}
+
+// bundleWriter is a Remote standing in for a receiver that holds exactly
+// the objects in have; what Push sends it lands in the bundle.
+type bundleWriter struct {
+	w    io.Writer
+	alg  object.Algorithm
+	have map[object.Hash]bool
+}
+
+var _ Remote = (*bundleWriter)(nil)
+
+func (b *bundleWriter) Algorithm(context.Context) (object.Algorithm, error) {
+	return b.alg, nil
+}
+
+func (b *bundleWriter) Missing(_ context.Context, hashes []object.Hash) ([]object.Hash, error) {
+	var missing []object.Hash
+	for _, h := range hashes {
+		if !b.have[h] {
+			missing = append(missing, h)
+		}
+	}
+	return missing, nil
+}
+
+func (b *bundleWriter) Fetch(context.Context, []object.Hash, func(Object) error) error {
+	return errors.New("remote: a bundle can't be fetched from")
+}
+
+func (b *bundleWriter) Store(ctx context.Context, objs []Object) error {
+	for _, o := range objs {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context: %w", err)
+		}
+		if err := writeObject(b.w, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyBundle reads a bundle from r into s, which must hold its Old
+// already. Objects are checked against their hashes and written as they
+// arrive, children first, so a bundle cut short leaves s consistent.
+func ApplyBundle(ctx context.Context, r io.Reader, s *store.Store) (*BundleHeader, *Result, error) {
+	br := bufio.NewReader(r)
+	hdr, err := readBundleHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hdr.Algorithm != s.Algorithm() {
+		return nil, nil, fmt.Errorf("%w: bundle uses %s, local store uses %s", store.ErrAlgorithmMismatch, hdr.Algorithm, s.Algorithm())
+	}
+	if !hdr.Old.IsZero() && !s.HasObject(hdr.Old) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrBundleBase, hdr.Old)
+	}
+
+	local := NewLocal(s)
+	res := &Result{}
+	for {
+		o, err := readObject(br)
+		if errors.Is(err, io.EOF) {
+			return nil, nil, ErrBundleTruncated
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(o.Data) == 0 {
+			break
+		}
+		size := o.size()
+		if o.Content != nil {
+			_, err = storeStreamed(s, o)
+		} else if o.Hash, err = hashObject(s.Algorithm(), o.Data); err == nil {
+			err = local.Store(ctx, []Object{o})
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil, fmt.Errorf("%w: %w", ErrBundleTruncated, err)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		res.Objects++
+		res.Bytes += size
+	}
+
+	if !s.HasObject(hdr.New) {
+		return nil, nil, fmt.Errorf("%w: it lacks %s", ErrBundleTruncated, hdr.New)
+	}
+	return hdr, res, nil
+}
+
+func writeBundleHeader(w io.Writer, hdr *BundleHeader) error {
+	if err := object.WriteHeader(w, object.MagicBundle); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, hdr.Algorithm); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	for _, h := range []object.Hash{hdr.Old, hdr.New} {
+		if _, err := w.Write(h[:]); err != nil {
+			return fmt.Errorf("write bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// readBundleHeader reads the header at the start of a bundle, leaving r at
+// its objects.
+func readBundleHeader(r io.Reader) (*BundleHeader, error) {
+	if _, err := object.ReadHeader(r, object.MagicBundle); err != nil {
+		return nil, fmt.Errorf("read bundle: %w", err)
+	}
+	var hdr BundleHeader
+	if err := binary.Read(r, binary.BigEndian, &hdr.Algorithm); err != nil {
+		return nil, fmt.Errorf("read bundle: %w", err)
+	}
+	if !hdr.Algorithm.Valid() {
+		return nil, fmt.Errorf("read bundle: %w: %d", object.ErrUnknownAlgorithm, hdr.Algorithm)
+	}
+	for _, h := range []*object.Hash{&hdr.Old, &hdr.New} {
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return nil, fmt.Errorf("read bundle: %w", err)
+		}
+	}
+	return &hdr, nil
+}
@@ -0,0 +1,94 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+func TestBundle(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"README.md":   "# demo\n",
+		"src/main.go": "package main\n",
+		"src/util.go": "package main\n\nfunc util() {}\n",
+	})
+	src := openStore(t, object.BLAKE3)
+	oldRoot := walk(t, src, dir)
+	dst := openStore(t, object.BLAKE3)
+	if _, err := Push(t.Context(), src, NewLocal(dst), oldRoot); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	writeTree(t, dir, map[string]string{"src/main.go": "package main\n\nfunc main() {}\n"})
+	newRoot := walk(t, src, dir)
+
+	var buf bytes.Buffer
+	res, err := WriteBundle(t.Context(), &buf, src, oldRoot, newRoot)
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+	// the changed file and the trees above it
+	if res.Objects != 3 {
+		t.Errorf("WriteBundle() wrote %d objects, want 3", res.Objects)
+	}
+
+	// without the base the bundle can't apply, and a cut one doesn't
+	if _, _, err := ApplyBundle(t.Context(), bytes.NewReader(buf.Bytes()), openStore(t, object.BLAKE3)); !errors.Is(err, ErrBundleBase) {
+		t.Errorf("ApplyBundle() without the base: error = %v, want ErrBundleBase", err)
+	}
+	if _, _, err := ApplyBundle(t.Context(), bytes.NewReader(buf.Bytes()[:buf.Len()-1]), dst); !errors.Is(err, ErrBundleTruncated) {
+		t.Errorf("ApplyBundle() of a truncated bundle: error = %v, want ErrBundleTruncated", err)
+	}
+	if _, _, err := ApplyBundle(t.Context(), bytes.NewReader(buf.Bytes()), openStore(t, object.SHA256)); err == nil {
+		t.Error("ApplyBundle() into a store of another algorithm: error = nil")
+	}
+
+	hdr, got, err := ApplyBundle(t.Context(), bytes.NewReader(buf.Bytes()), dst)
+	if err != nil {
+		t.Fatalf("ApplyBundle() error = %v", err)
+	}
+	if hdr.Old != oldRoot || hdr.New != newRoot || got.Objects != res.Objects {
+		t.Errorf("ApplyBundle() = %+v, %+v; want %s..%s with %d objects", hdr, got, oldRoot, newRoot, res.Objects)
+	}
+	if n, want := reachable(t, dst, newRoot), reachable(t, src, newRoot); n != want {
+		t.Errorf("store holds %d objects under the new root, want %d", n, want)
+	}
+}
+
+func TestBundleLarge(t *testing.T) {
+	t.Parallel()
+
+	src := openStore(t, object.BLAKE3)
+	root, blob := putLarge(t, src)
+
+	var buf bytes.Buffer
+	res, err := WriteBundle(t.Context(), &buf, src, object.ZeroHash, root)
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+	if res.Objects != 2 || res.Bytes <= MaxObjectSize {
+		t.Errorf("WriteBundle() = %+v, want 2 objects over %d bytes", res, MaxObjectSize)
+	}
+
+	cut := buf.Bytes()[:buf.Len()/2]
+	if _, _, err := ApplyBundle(t.Context(), bytes.NewReader(cut), openStore(t, object.BLAKE3)); !errors.Is(err, ErrBundleTruncated) {
+		t.Errorf("ApplyBundle() cut inside a blob: error = %v, want ErrBundleTruncated", err)
+	}
+
+	dst := openStore(t, object.BLAKE3)
+	_, got, err := ApplyBundle(t.Context(), bytes.NewReader(buf.Bytes()), dst)
+	if err != nil {
+		t.Fatalf("ApplyBundle() error = %v", err)
+	}
+	if got.Objects != res.Objects || got.Bytes != res.Bytes {
+		t.Errorf("ApplyBundle() = %+v, want %+v", got, res)
+	}
+	if !dst.HasObject(blob) {
+		t.Error("ApplyBundle() left the large blob behind")
+	}
+}
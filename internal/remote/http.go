@@ -0,0 +1,450 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// The wire protocol, under a base URL:
+//
+//	GET  /sync/v1/info     {"algorithm": "blake3"}
+//	POST /sync/v1/missing  {"hashes": [...]} -> {"missing": [...]}
+//	POST /sync/v1/fetch    {"hashes": [...]} -> object frames, in order
+//	POST /sync/v1/store    object frames -> 204
+//
+// An object frame is its encoded length as a uvarint followed by the encoded
+// object. Receivers hash each object themselves, so frames carry no hash.
+//
+// A blob whose encoding is over MaxObjectSize is streamed: its frame holds
+// the blob's header alone, and its content follows in frames of at most
+// maxPiece bytes until the length in the header is reached. Receivers hash
+// the content as it arrives.
+const syncPrefix = "/sync/v1/"
+
+// MaxObjectSize bounds one frame, an object's encoding or a streamed blob's
+// header, so a bad length can't exhaust memory.
+const MaxObjectSize = 64 << 20
+
+// maxPiece bounds one frame of a streamed blob's content.
+const maxPiece = 1 << 20
+
+// maxJSONSize bounds a request body of hashes.
+const maxJSONSize = 1 << 20
+
+var (
+	ErrProtocol    = errors.New("remote: protocol error")
+	ErrFrameTooBig = errors.New("remote: object too large for one frame")
+)
+
+type infoJSON struct {
+	Algorithm string `json:"algorithm"`
+}
+
+type hashesJSON struct {
+	Hashes []string `json:"hashes"`
+}
+
+type missingJSON struct {
+	Missing []string `json:"missing"`
+}
+
+// Handler serves the sync protocol for s. It is safe for concurrent
+// requests.
+type Handler struct {
+	s *store.Store
+}
+
+// NewHandler returns a Handler serving s.
+func NewHandler(s *store.Store) *Handler {
+	return &Handler{s: s}
+}
+
+// Register adds the protocol's routes to mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+syncPrefix+"info", h.info)
+	mux.HandleFunc("POST "+syncPrefix+"missing", h.missing)
+	mux.HandleFunc("POST "+syncPrefix+"fetch", h.fetch)
+	mux.HandleFunc("POST "+syncPrefix+"store", h.store)
+}
+
+func (h *Handler) info(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, infoJSON{Algorithm: h.s.Algorithm().String()})
+}
+
+func (h *Handler) missing(w http.ResponseWriter, r *http.Request) {
+	hashes, err := readHashes(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	missing, err := NewLocal(h.s).Missing(r.Context(), hashes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, missingJSON{Missing: hashStrings(missing)})
+}
+
+func (h *Handler) fetch(w http.ResponseWriter, r *http.Request) {
+	hashes, err := readHashes(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// check first: once frames are streaming the status can't change
+	for _, hash := range hashes {
+		if !h.s.HasObject(hash) {
+			http.Error(w, fmt.Sprintf("object %s not found", hash), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	bw := bufio.NewWriter(w)
+	err = NewLocal(h.s).Fetch(r.Context(), hashes, func(o Object) error {
+		return writeObject(bw, o)
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		// the client sees a truncated body
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// store writes each object as its frame arrives, so a request holds at
+// most one object in memory, or one piece of a streamed blob.
+func (h *Handler) store(w http.ResponseWriter, r *http.Request) {
+	br := bufio.NewReader(r.Body)
+	local := NewLocal(h.s)
+	for {
+		o, err := readObject(br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if o.Content != nil {
+			if _, err := storeStreamed(h.s, o); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			continue
+		}
+		o.Hash, err = hashObject(h.s.Algorithm(), o.Data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := local.Store(r.Context(), []Object{o}); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrMissingChild) || errors.Is(err, ErrUnknownObject) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readHashes(r *http.Request) ([]object.Hash, error) {
+	var in hashesJSON
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxJSONSize)).Decode(&in); err != nil {
+		return nil, fmt.Errorf("decode request: %w", err)
+	}
+	return parseHashes(in.Hashes)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Client is a Remote reached over HTTP.
+type Client struct {
+	base string
+	hc   *http.Client
+}
+
+var _ Remote = (*Client)(nil)
+
+// NewClient returns a Client for the server at base, e.g.
+// "http://host:8080". A nil hc uses http.DefaultClient.
+func NewClient(base string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{base: strings.TrimSuffix(base, "/"), hc: hc}
+}
+
+func (c *Client) Algorithm(ctx context.Context) (object.Algorithm, error) {
+	var out infoJSON
+	if err := c.call(ctx, http.MethodGet, "info", nil, func(body io.Reader) error {
+		return decodeJSON(body, &out)
+	}); err != nil {
+		return 0, err
+	}
+	alg, err := object.ParseAlgorithm(out.Algorithm)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrProtocol, err)
+	}
+	return alg, nil
+}
+
+func (c *Client) Missing(ctx context.Context, hashes []object.Hash) ([]object.Hash, error) {
+	var out missingJSON
+	if err := c.callJSON(ctx, "missing", hashes, func(body io.Reader) error {
+		return decodeJSON(body, &out)
+	}); err != nil {
+		return nil, err
+	}
+	return parseHashes(out.Missing)
+}
+
+func (c *Client) Fetch(ctx context.Context, hashes []object.Hash, fn func(Object) error) error {
+	return c.callJSON(ctx, "fetch", hashes, func(body io.Reader) error {
+		br := bufio.NewReader(body)
+		for _, h := range hashes {
+			o, err := readObject(br)
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return fmt.Errorf("read object %s: %w", h, err)
+			}
+			o.Hash = h
+			if err := fn(o); err != nil {
+				return err
+			}
+			if o.Content != nil {
+				// skip what fn left, to reach the next object
+				if _, err := io.Copy(io.Discard, o.Content); err != nil {
+					return fmt.Errorf("read object %s: %w", h, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Store streams objs as the request body, so a streamed blob is read only
+// as it's sent.
+func (c *Client) Store(ctx context.Context, objs []Object) error {
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		bw := bufio.NewWriter(pw)
+		var err error
+		for _, o := range objs {
+			if err = writeObject(bw, o); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = bw.Flush()
+		}
+		_ = pw.CloseWithError(err)
+		written <- err
+	}()
+
+	err := c.call(ctx, http.MethodPost, "store", pr, nil)
+	// stop the writer, and wait so nothing reads objs once Store returns
+	_ = pr.Close()
+	if werr := <-written; werr != nil && !errors.Is(werr, io.ErrClosedPipe) {
+		return werr
+	}
+	return err
+}
+
+func (c *Client) callJSON(ctx context.Context, endpoint string, hashes []object.Hash, read func(io.Reader) error) error {
+	body, err := json.Marshal(hashesJSON{Hashes: hashStrings(hashes)})
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	return c.call(ctx, http.MethodPost, endpoint, bytes.NewReader(body), read)
+}
+
+// call makes one request and passes a successful response body to read, if
+// set.
+func (c *Client) call(ctx context.Context, method, endpoint string, body io.Reader, read func(io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+syncPrefix+endpoint, body)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("%w: %s %s: %s: %s", ErrProtocol, method, endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if read == nil {
+		return nil
+	}
+	return read(resp.Body)
+}
+
+func decodeJSON(r io.Reader, v any) error {
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("%w: decode response: %w", ErrProtocol, err)
+	}
+	return nil
+}
+
+// writeObject writes o's frame, then the content of a streamed blob in
+// pieces.
+func writeObject(w io.Writer, o Object) error {
+	if err := writeFrame(w, o.Data); err != nil {
+		return err
+	}
+	if o.Content == nil {
+		return nil
+	}
+	n, ok := streamedLength(o.Data)
+	if !ok {
+		return fmt.Errorf("%w: object %s streams content without a blob header", ErrProtocol, o.Hash)
+	}
+	buf := make([]byte, min(n, maxPiece))
+	for n > 0 {
+		k, err := io.ReadFull(o.Content, buf[:min(n, maxPiece)])
+		if err != nil {
+			return fmt.Errorf("read object %s: %w", o.Hash, err)
+		}
+		if err := writeFrame(w, buf[:k]); err != nil {
+			return err
+		}
+		n -= int64(k)
+	}
+	return nil
+}
+
+// readObject returns the next object without its hash, or io.EOF at a
+// clean end of stream. A streamed blob's content is left in r for Content
+// to read.
+func readObject(r *bufio.Reader) (Object, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return Object{}, err
+	}
+	o := Object{Data: data}
+	if n, ok := streamedLength(data); ok {
+		o.Content = &pieceReader{r: r, left: n}
+	}
+	return o, nil
+}
+
+// pieceReader reads a streamed blob's content from the frames after its
+// header.
+type pieceReader struct {
+	r     *bufio.Reader
+	left  int64 // content not yet read
+	piece int64 // of the current frame not yet read
+}
+
+func (p *pieceReader) Read(b []byte) (int, error) {
+	if p.left == 0 {
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if p.piece == 0 {
+		n, err := binary.ReadUvarint(p.r)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: piece length: %w", ErrProtocol, err)
+		}
+		if n == 0 || n > maxPiece || n > uint64(p.left) {
+			return 0, fmt.Errorf("%w: piece of %d bytes with %d left", ErrProtocol, n, p.left)
+		}
+		p.piece = int64(n) //nolint:gosec // n is at most maxPiece
+	}
+	n, err := p.r.Read(b[:min(int64(len(b)), p.piece)])
+	p.piece -= int64(n)
+	p.left -= int64(n)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return n, fmt.Errorf("%w: piece: %w", ErrProtocol, err)
+	}
+	return n, nil
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	if len(data) > MaxObjectSize {
+		return fmt.Errorf("%w: %d bytes, over %d", ErrFrameTooBig, len(data), MaxObjectSize)
+	}
+
+	var n [binary.MaxVarintLen64]byte
+	if _, err := w.Write(n[:binary.PutUvarint(n[:], uint64(len(data)))]); err != nil {
+		return fmt.Errorf("write frame: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("write frame: %w", err)
+	}
+	return nil
+}
+
+// readFrame returns the next frame, or io.EOF at a clean end of stream.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: frame length: %w", ErrProtocol, err)
+	}
+	if n > MaxObjectSize {
+		return nil, fmt.Errorf("%w: frame of %d bytes", ErrProtocol, n)
+	}
+	// grow with what arrives rather than trusting the length up front
+	data, err := io.ReadAll(io.LimitReader(r, int64(n))) //nolint:gosec // n is at most MaxObjectSize
+	if err != nil {
+		return nil, fmt.Errorf("%w: frame: %w", ErrProtocol, err)
+	}
+	if uint64(len(data)) != n {
+		return nil, fmt.Errorf("%w: frame: %w", ErrProtocol, io.ErrUnexpectedEOF)
+	}
+	return data, nil
+}
+
+func hashStrings(hashes []object.Hash) []string {
+	out := make([]string, len(hashes))
+	for i, h := range hashes {
+		out[i] = h.String()
+	}
+	return out
+}
+
+func parseHashes(in []string) ([]object.Hash, error) {
+	out := make([]object.Hash, len(in))
+	for i, s := range in {
+		h, err := object.ParseHash(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrProtocol, err)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
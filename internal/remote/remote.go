@@ -0,0 +1,491 @@
+// Package remote copies the objects under a hash between stores, either
+// directly or over HTTP. The two sides first agree on which objects the
+// receiver lacks, so only those are transferred.
+//
+// Transfers rely on one invariant, kept by the walker and by this package:
+// a store holding an object holds everything it references. The receiver
+// writes children before their parents, so an interrupted transfer leaves
+// only complete subgraphs and the next one resumes where it stopped.
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// batch sizes keep requests small enough to stream and retry.
+const (
+	missingBatch = 1024    // hashes per Missing call
+	fetchBatch   = 256     // objects per Fetch call
+	storeBatch   = 256     // objects per Store call
+	storeBytes   = 8 << 20 // bytes per Store call, unless one object is larger
+)
+
+var (
+	ErrCorrupt       = errors.New("remote: object does not match its hash")
+	ErrUnknownObject = errors.New("remote: unknown object type")
+	ErrMissingChild  = errors.New("remote: object references one not in the store")
+)
+
+// Object is an encoded object and its hash.
+//
+// A blob too large for one frame is streamed instead: Data holds only its
+// header, up to the content, and Content yields the content. It must be
+// read to the end before the next object.
+type Object struct {
+	Hash    object.Hash
+	Data    []byte
+	Content io.Reader
+}
+
+// size returns the length of o's encoding.
+func (o *Object) size() int64 {
+	if o.Content == nil {
+		return int64(len(o.Data))
+	}
+	n, _ := streamedLength(o.Data)
+	return int64(len(o.Data)) + n
+}
+
+// Remote is the other side of a transfer.
+type Remote interface {
+	// Algorithm returns the hash algorithm of the remote store.
+	Algorithm(ctx context.Context) (object.Algorithm, error)
+	// Missing returns the hashes the remote store lacks, in order.
+	Missing(ctx context.Context, hashes []object.Hash) ([]object.Hash, error)
+	// Fetch calls fn with each object in order. Every hash must exist.
+	Fetch(ctx context.Context, hashes []object.Hash, fn func(Object) error) error
+	// Store writes objs in order, checking each against its hash. Each
+	// object's children must be in the store or come before it.
+	Store(ctx context.Context, objs []Object) error
+}
+
+// Result describes a transfer.
+type Result struct {
+	Objects int   // objects sent or received
+	Bytes   int64 // their encoded size
+}
+
+// Push copies the objects under root from s to r that r lacks.
+func Push(ctx context.Context, s *store.Store, r Remote, root object.Hash) (*Result, error) {
+	if err := checkAlgorithm(ctx, s, r); err != nil {
+		return nil, err
+	}
+
+	// find what r lacks top-down, skipping subtrees it already has
+	kids := make(map[object.Hash][]object.Hash)
+	seen := map[object.Hash]bool{root: true}
+	for frontier := []object.Hash{root}; len(frontier) > 0; {
+		var next []object.Hash
+		for batch := range chunks(frontier, missingBatch) {
+			missing, err := r.Missing(ctx, batch)
+			if err != nil {
+				return nil, fmt.Errorf("negotiate: %w", err)
+			}
+			for _, h := range missing {
+				o, done, err := openObject(s, h)
+				if err != nil {
+					return nil, err
+				}
+				done()
+				if kids[h], err = children(o.Data); err != nil {
+					return nil, fmt.Errorf("object %s: %w", h, err)
+				}
+				for _, k := range kids[h] {
+					if !seen[k] {
+						seen[k] = true
+						next = append(next, k)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	order := postorder(root, kids)
+
+	// send bottom-up so r never holds a parent without its children
+	res := &Result{}
+	var objs []Object
+	var size int64
+	flush := func() error {
+		if len(objs) == 0 {
+			return nil
+		}
+		if err := r.Store(ctx, objs); err != nil {
+			return fmt.Errorf("send objects: %w", err)
+		}
+		res.Objects += len(objs)
+		res.Bytes += size
+		objs, size = objs[:0], 0
+		return nil
+	}
+	for _, h := range order {
+		o, done, err := openObject(s, h)
+		if err != nil {
+			return nil, err
+		}
+		n := o.size()
+		if len(objs) > 0 && (o.Content != nil || len(objs) == storeBatch || size+n > storeBytes) {
+			err = flush()
+		}
+		if err == nil {
+			objs = append(objs, o)
+			size += n
+			if o.Content != nil {
+				// its content is read as it's sent, so it goes alone
+				err = flush()
+			}
+		}
+		done()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Pull copies the objects under root from r to s that s lacks.
+func Pull(ctx context.Context, s *store.Store, r Remote, root object.Hash) (*Result, error) {
+	if err := checkAlgorithm(ctx, s, r); err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	if s.HasObject(root) {
+		return res, nil
+	}
+
+	// blobs reference nothing and are written as they arrive; the rest wait
+	// until everything below them is in place
+	parents := make(map[object.Hash]Object)
+	kids := make(map[object.Hash][]object.Hash)
+	seen := map[object.Hash]bool{root: true}
+	for frontier := []object.Hash{root}; len(frontier) > 0; {
+		var next []object.Hash
+		for batch := range chunks(frontier, fetchBatch) {
+			err := r.Fetch(ctx, batch, func(o Object) error {
+				// a streamed blob is checked as it's written
+				if o.Content == nil {
+					if err := check(s.Algorithm(), o); err != nil {
+						return err
+					}
+				}
+				res.Objects++
+				res.Bytes += o.size()
+
+				ks, err := children(o.Data)
+				if err != nil {
+					return fmt.Errorf("object %s: %w", o.Hash, err)
+				}
+				if ks == nil {
+					return putObject(s, o)
+				}
+				parents[o.Hash], kids[o.Hash] = o, ks
+				for _, k := range ks {
+					if !seen[k] && !s.HasObject(k) {
+						seen[k] = true
+						next = append(next, k)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("fetch objects: %w", err)
+			}
+		}
+		frontier = next
+	}
+
+	for _, h := range postorder(root, kids) {
+		if err := putObject(s, parents[h]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func checkAlgorithm(ctx context.Context, s *store.Store, r Remote) error {
+	alg, err := r.Algorithm(ctx)
+	if err != nil {
+		return fmt.Errorf("remote algorithm: %w", err)
+	}
+	if alg != s.Algorithm() {
+		return fmt.Errorf("%w: remote uses %s, local store uses %s", store.ErrAlgorithmMismatch, alg, s.Algorithm())
+	}
+	return nil
+}
+
+func putObject(s *store.Store, o Object) error {
+	if o.Content != nil {
+		// content that doesn't match is stored under its own hash, which
+		// leaves the store consistent, but the transfer still fails
+		h, err := storeStreamed(s, o)
+		if err != nil {
+			return fmt.Errorf("put object %s: %w", o.Hash, err)
+		}
+		if h != o.Hash {
+			return fmt.Errorf("%w: %s", ErrCorrupt, o.Hash)
+		}
+		return nil
+	}
+	if err := s.PutObject(o.Hash, o.Data); err != nil {
+		return fmt.Errorf("put object %s: %w", o.Hash, err)
+	}
+	return nil
+}
+
+// storeStreamed writes the streamed blob o, hashing its content as it's
+// read, and returns the hash it's stored under.
+func storeStreamed(s *store.Store, o Object) (object.Hash, error) {
+	n, ok := streamedLength(o.Data)
+	if !ok {
+		return object.ZeroHash, fmt.Errorf("%w: streamed object has no blob header", ErrCorrupt)
+	}
+	h, err := s.PutBlobFrom(o.Content, n)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("store streamed blob: %w", err)
+	}
+	return h, nil
+}
+
+// openObject reads the object h from s, streaming it if it's a blob too
+// large for one frame. done releases what it holds once o has been used.
+func openObject(s *store.Store, h object.Hash) (o Object, done func(), err error) {
+	rc, n, err := s.OpenObject(h)
+	if err != nil {
+		return Object{}, nil, fmt.Errorf("get object %s: %w", h, err)
+	}
+	if n <= MaxObjectSize {
+		data, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return Object{}, nil, fmt.Errorf("get object %s: %w", h, err)
+		}
+		return Object{Hash: h, Data: data}, func() {}, nil
+	}
+
+	br := bufio.NewReader(rc)
+	alg, size, err := object.ReadBlobHeader(br)
+	if err != nil {
+		_ = rc.Close()
+		// only blobs can be streamed
+		return Object{}, nil, fmt.Errorf("%w: object %s is %d bytes and not a blob", ErrFrameTooBig, h, n)
+	}
+	var hdr bytes.Buffer
+	if err := object.WriteBlobHeader(&hdr, alg, size); err != nil {
+		_ = rc.Close()
+		return Object{}, nil, fmt.Errorf("object %s: %w", h, err)
+	}
+	o = Object{Hash: h, Data: hdr.Bytes(), Content: io.LimitReader(br, size)}
+	return o, func() { _ = rc.Close() }, nil
+}
+
+// streamedLength returns the length of the content following data if data
+// is a blob's header alone, as sent ahead of a streamed blob. A whole blob,
+// even an empty one, isn't streamed.
+func streamedLength(data []byte) (int64, bool) {
+	if !bytes.HasPrefix(data, []byte(object.MagicBlob)) {
+		return 0, false
+	}
+	r := bytes.NewReader(data)
+	_, n, err := object.ReadBlobHeader(r)
+	if err != nil || r.Len() > 0 || n == 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// hashObject returns the hash an encoded object is stored under: a blob's
+// is of its content, any other object's of its encoding.
+func hashObject(alg object.Algorithm, data []byte) (object.Hash, error) {
+	if !bytes.HasPrefix(data, []byte(object.MagicBlob)) {
+		return alg.Sum(data), nil
+	}
+	b, err := object.DecodeBlob(data)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return alg.Sum(b.Content), nil
+}
+
+// check verifies that o.Data is the object named by o.Hash.
+func check(alg object.Algorithm, o Object) error {
+	h, err := hashObject(alg, o.Data)
+	if err != nil {
+		return fmt.Errorf("object %s: %w", o.Hash, err)
+	}
+	if h != o.Hash {
+		return fmt.Errorf("%w: %s", ErrCorrupt, o.Hash)
+	}
+	return nil
+}
+
+// children returns the hashes an encoded object references, or nil for a
+// blob.
+func children(data []byte) ([]object.Hash, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte(object.MagicBlob)):
+		return nil, nil
+	case bytes.HasPrefix(data, []byte(object.MagicTree)):
+		t, err := object.DecodeTree(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode tree: %w", err)
+		}
+		kids := make([]object.Hash, 0, len(t.Entries))
+		for _, e := range t.Entries {
+			// placeholders for unreadable paths have no object
+			if e.Mode != object.ModeInaccessible {
+				kids = append(kids, e.Hash)
+			}
+		}
+		return kids, nil
+	case bytes.HasPrefix(data, []byte(object.MagicManifest)):
+		m, err := object.DecodeManifest(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode manifest: %w", err)
+		}
+		kids := make([]object.Hash, len(m.Chunks))
+		for i, c := range m.Chunks {
+			kids[i] = c.Hash
+		}
+		return kids, nil
+	case bytes.HasPrefix(data, []byte(object.MagicSnap)):
+		snap, err := object.DecodeSnapshot(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode snapshot: %w", err)
+		}
+		if snap.Parent.IsZero() {
+			return []object.Hash{snap.Root}, nil
+		}
+		return []object.Hash{snap.Root, snap.Parent}, nil
+	default:
+		return nil, ErrUnknownObject
+	}
+}
+
+// postorder returns the hashes in kids reachable from root through kids,
+// each after everything it references. Hashes not in kids are left out.
+func postorder(root object.Hash, kids map[object.Hash][]object.Hash) []object.Hash {
+	var order []object.Hash
+	done := make(map[object.Hash]bool, len(kids))
+	var visit func(h object.Hash)
+	visit = func(h object.Hash) {
+		ks, ok := kids[h]
+		if !ok || done[h] {
+			return
+		}
+		done[h] = true
+		for _, k := range ks {
+			visit(k)
+		}
+		order = append(order, h)
+	}
+	visit(root)
+	return order
+}
+
+// chunks yields s in pieces of at most n.
+func chunks[T any](s []T, n int) func(yield func([]T) bool) {
+	return func(yield func([]T) bool) {
+		for len(s) > 0 {
+			k := min(n, len(s))
+			if !yield(s[:k]) {
+				return
+			}
+			s = s[k:]
+		}
+	}
+}
+
+// Local is a Remote backed by a store on this machine.
+type Local struct {
+	s *store.Store
+}
+
+var _ Remote = (*Local)(nil)
+
+// NewLocal returns a Remote reading and writing s.
+func NewLocal(s *store.Store) *Local {
+	return &Local{s: s}
+}
+
+func (l *Local) Algorithm(context.Context) (object.Algorithm, error) {
+	return l.s.Algorithm(), nil
+}
+
+func (l *Local) Missing(ctx context.Context, hashes []object.Hash) ([]object.Hash, error) {
+	var missing []object.Hash
+	for _, h := range hashes {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("context: %w", err)
+		}
+		if !l.s.HasObject(h) {
+			missing = append(missing, h)
+		}
+	}
+	return missing, nil
+}
+
+func (l *Local) Fetch(ctx context.Context, hashes []object.Hash, fn func(Object) error) error {
+	for _, h := range hashes {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context: %w", err)
+		}
+		o, done, err := openObject(l.s, h)
+		if err != nil {
+			return err
+		}
+		err = fn(o)
+		done()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Local) Store(ctx context.Context, objs []Object) error {
+	for _, o := range objs {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context: %w", err)
+		}
+		if o.Content != nil {
+			// a blob references nothing, and is checked as it's written
+			if err := putObject(l.s, o); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := check(l.s.Algorithm(), o); err != nil {
+
+			return err
+		}
+		if l.s.HasObject(o.Hash) {
+			continue
+		}
+		// keep the invariant: a stored object's children are stored too
+		kids, err := children(o.Data)
+		if err != nil {
+			return fmt.Errorf("object %s: %w", o.Hash, err)
+		}
+		for _, k := range kids {
+			if !l.s.HasObject(k) {
+				return fmt.Errorf("%w: %s references %s", ErrMissingChild, o.Hash, k)
+			}
+		}
+		if err := putObject(l.s, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
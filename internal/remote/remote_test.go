@@ -0,0 +1,351 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+func openStore(t *testing.T, alg object.Algorithm) *store.Store {
+	t.Helper()
+	s, err := store.Open(t.TempDir(), store.WithAlgorithm(alg), store.WithLazyIndex())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func walk(t *testing.T, s *store.Store, dir string) object.Hash {
+	t.Helper()
+	res, err := walker.Walk(t.Context(), dir, s, walker.WithChunking(64<<10))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	return res.Hash
+}
+
+// reachable counts the objects under root, failing if any is missing.
+func reachable(t *testing.T, s *store.Store, root object.Hash) int {
+	t.Helper()
+	seen := make(map[object.Hash]bool)
+	var visit func(h object.Hash)
+	visit = func(h object.Hash) {
+		if seen[h] {
+			return
+		}
+		seen[h] = true
+		data, err := s.GetObject(h)
+		if err != nil {
+			t.Fatalf("GetObject(%s) error = %v", h, err)
+		}
+		kids, err := children(data)
+		if err != nil {
+			t.Fatalf("children(%s) error = %v", h, err)
+		}
+		for _, k := range kids {
+			visit(k)
+		}
+	}
+	visit(root)
+	return len(seen)
+}
+
+func httpRemote(t *testing.T, s *store.Store) Remote {
+	t.Helper()
+	mux := http.NewServeMux()
+	NewHandler(s).Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL, srv.Client())
+}
+
+func TestPushPull(t *testing.T) {
+	t.Parallel()
+
+	transports := []struct {
+		name   string
+		remote func(t *testing.T, s *store.Store) Remote
+	}{
+		{name: "local", remote: func(_ *testing.T, s *store.Store) Remote { return NewLocal(s) }},
+		{name: "http", remote: httpRemote},
+	}
+	for _, tt := range transports {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{
+				"README.md":    "# demo\n",
+				"src/main.go":  "package main\n",
+				"src/copy.go":  "package main\n",
+				"deep/a/b/c":   "# demo\n", // shared with README.md, deeper down
+				"data/big.bin": strings.Repeat("0123456789abcdef", 64<<10),
+			})
+			src := openStore(t, object.BLAKE3)
+			root := walk(t, src, dir)
+			total := reachable(t, src, root)
+
+			mid := openStore(t, object.BLAKE3)
+			res, err := Push(t.Context(), src, tt.remote(t, mid), root)
+			if err != nil {
+				t.Fatalf("Push() error = %v", err)
+			}
+			if res.Objects != total {
+				t.Errorf("Push() sent %d objects, want %d", res.Objects, total)
+			}
+			if got := reachable(t, mid, root); got != total {
+				t.Errorf("remote holds %d objects under root, want %d", got, total)
+			}
+
+			res, err = Push(t.Context(), src, tt.remote(t, mid), root)
+			if err != nil {
+				t.Fatalf("second Push() error = %v", err)
+			}
+			if res.Objects != 0 {
+				t.Errorf("second Push() sent %d objects, want 0", res.Objects)
+			}
+
+			// one changed file costs the file and the trees above it
+			writeTree(t, dir, map[string]string{"src/main.go": "package main\n\nfunc main() {}\n"})
+			changed := walk(t, src, dir)
+			res, err = Push(t.Context(), src, tt.remote(t, mid), changed)
+			if err != nil {
+				t.Fatalf("Push() of a change error = %v", err)
+			}
+			if res.Objects != 3 {
+				t.Errorf("Push() of a change sent %d objects, want 3", res.Objects)
+			}
+
+			dst := openStore(t, object.BLAKE3)
+			if _, err := Pull(t.Context(), dst, tt.remote(t, mid), root); err != nil {
+				t.Fatalf("Pull() error = %v", err)
+			}
+			res, err = Pull(t.Context(), dst, tt.remote(t, mid), changed)
+			if err != nil {
+				t.Fatalf("Pull() of a change error = %v", err)
+			}
+			if res.Objects != 3 {
+				t.Errorf("Pull() of a change fetched %d objects, want 3", res.Objects)
+			}
+			reachable(t, dst, changed)
+		})
+	}
+}
+
+// putLarge stores a blob too large for one frame, and a tree holding it.
+func putLarge(t *testing.T, s *store.Store) (tree, blob object.Hash) {
+	t.Helper()
+	const size = MaxObjectSize + 1
+	content := io.LimitReader(rand.NewChaCha8([32]byte{}), size)
+	blob, err := s.PutBlobFrom(content, size)
+	if err != nil {
+		t.Fatalf("PutBlobFrom() error = %v", err)
+	}
+	tree, err = s.PutTree(&object.Tree{Entries: []object.Entry{{Name: "big.bin", Mode: object.ModeRegular, Size: size, Hash: blob}}})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	return tree, blob
+}
+
+func TestPushPullLarge(t *testing.T) {
+	t.Parallel()
+
+	transports := []struct {
+		name   string
+		remote func(t *testing.T, s *store.Store) Remote
+	}{
+		{name: "local", remote: func(_ *testing.T, s *store.Store) Remote { return NewLocal(s) }},
+		{name: "http", remote: httpRemote},
+	}
+	for _, tt := range transports {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := openStore(t, object.BLAKE3)
+			root, blob := putLarge(t, src)
+
+			mid := openStore(t, object.BLAKE3)
+			res, err := Push(t.Context(), src, tt.remote(t, mid), root)
+			if err != nil {
+				t.Fatalf("Push() error = %v", err)
+			}
+			if res.Objects != 2 || res.Bytes <= MaxObjectSize {
+				t.Errorf("Push() = %+v, want 2 objects over %d bytes", res, MaxObjectSize)
+			}
+			reachable(t, mid, root)
+
+			dst := openStore(t, object.BLAKE3)
+			res, err = Pull(t.Context(), dst, tt.remote(t, mid), root)
+			if err != nil {
+				t.Fatalf("Pull() error = %v", err)
+			}
+			if res.Objects != 2 || res.Bytes <= MaxObjectSize {
+				t.Errorf("Pull() = %+v, want 2 objects over %d bytes", res, MaxObjectSize)
+			}
+			// stored blobs are hashed as they're written, so this checks the content
+			if !dst.HasObject(blob) || !dst.HasObject(root) {
+				t.Error("Pull() left the large blob or its tree behind")
+			}
+		})
+	}
+}
+
+func TestAlgorithmMismatch(t *testing.T) {
+	t.Parallel()
+
+	src := openStore(t, object.BLAKE3)
+	h, err := src.PutBlob(&object.Blob{Content: []byte("x")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	other := openStore(t, object.SHA256)
+	if _, err := Push(t.Context(), src, httpRemote(t, other), h); !errors.Is(err, store.ErrAlgorithmMismatch) {
+		t.Errorf("Push() error = %v, want ErrAlgorithmMismatch", err)
+	}
+	if _, err := Pull(t.Context(), src, NewLocal(other), h); !errors.Is(err, store.ErrAlgorithmMismatch) {
+		t.Errorf("Pull() error = %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+// lying serves other content than what was asked for.
+type lying struct {
+	*Local
+}
+
+func (l lying) Fetch(_ context.Context, hashes []object.Hash, fn func(Object) error) error {
+	for _, h := range hashes {
+		if err := fn(Object{Hash: h, Data: []byte(object.MagicBlob + "forged")}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPullCorrupt(t *testing.T) {
+	t.Parallel()
+
+	src := openStore(t, object.BLAKE3)
+	h, err := src.PutBlob(&object.Blob{Content: []byte("x")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	dst := openStore(t, object.BLAKE3)
+	if _, err := Pull(t.Context(), dst, lying{NewLocal(src)}, h); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Pull() error = %v, want ErrCorrupt", err)
+	}
+	if dst.HasObject(h) {
+		t.Error("Pull() stored a corrupt object")
+	}
+}
+
+func TestFetchMissing(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t, object.BLAKE3)
+	r := httpRemote(t, s)
+	missing := object.BLAKE3.Sum([]byte("nowhere"))
+	err := r.Fetch(t.Context(), []object.Hash{missing}, func(Object) error { return nil })
+	if !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Fetch() of a missing object error = %v, want a 404", err)
+	}
+}
+
+func TestStoreMissingChild(t *testing.T) {
+	t.Parallel()
+
+	src := openStore(t, object.BLAKE3)
+	blob, err := src.PutBlob(&object.Blob{Content: []byte("x")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	tree, err := src.PutTree(&object.Tree{Entries: []object.Entry{{Name: "x", Mode: object.ModeRegular, Size: 1, Hash: blob}}})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	data, err := src.GetObject(tree)
+	if err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+
+	dst := openStore(t, object.BLAKE3)
+	err = NewLocal(dst).Store(t.Context(), []Object{{Hash: tree, Data: data}})
+	if !errors.Is(err, ErrMissingChild) || !strings.Contains(err.Error(), blob.String()) {
+		t.Errorf("Store() of a tree without its blob error = %v, want ErrMissingChild naming %s", err, blob)
+	}
+	err = httpRemote(t, dst).Store(t.Context(), []Object{{Hash: tree, Data: data}})
+	if !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Store() over http of a tree without its blob error = %v, want a 400", err)
+	}
+	if dst.HasObject(tree) {
+		t.Error("Store() kept a tree without its blob")
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	buf.Write(binary.AppendUvarint(nil, MaxObjectSize+1))
+	if _, err := readFrame(bufio.NewReader(&buf)); !errors.Is(err, ErrProtocol) {
+		t.Errorf("readFrame() of an oversized frame error = %v, want ErrProtocol", err)
+	}
+
+	// a length the body doesn't deliver fails without allocating it
+	buf.Reset()
+	buf.Write(binary.AppendUvarint(nil, MaxObjectSize))
+	buf.WriteString("short")
+	if _, err := readFrame(bufio.NewReader(&buf)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("readFrame() of a truncated frame error = %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	if err := writeFrame(io.Discard, make([]byte, MaxObjectSize+1)); !errors.Is(err, ErrFrameTooBig) {
+		t.Errorf("writeFrame() of an oversized object error = %v, want ErrFrameTooBig", err)
+	}
+
+	// a streamed blob's pieces are bounded too
+	buf.Reset()
+	var hdr bytes.Buffer
+	if err := object.WriteBlobHeader(&hdr, object.BLAKE3, 4*maxPiece); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(&buf, hdr.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(binary.AppendUvarint(nil, maxPiece+1))
+	o, err := readObject(bufio.NewReader(&buf))
+	if err != nil || o.Content == nil {
+		t.Fatalf("readObject() of a blob header = %+v, %v; want a streamed blob", o, err)
+	}
+	if _, err := io.Copy(io.Discard, o.Content); !errors.Is(err, ErrProtocol) {
+		t.Errorf("reading an oversized piece error = %v, want ErrProtocol", err)
+	}
+}
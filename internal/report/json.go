@@ -0,0 +1,257 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/garrettladley/smerkle/internal/diff"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/result"
+)
+
+// The JSON shapes below are what the json, ndjson, and jsonl formats print.
+// Commands that nest them in larger documents use them directly so every
+// command spells an entry or a change the same way.
+
+type EntryJSON struct {
+	Name string        `json:"name"`
+	Mode string        `json:"mode"`
+	Size int64         `json:"size"`
+	Hash string        `json:"hash"`
+	Meta *MetadataJSON `json:"meta,omitempty"`
+}
+
+// MetadataJSON spells the permission bits in octal, as chmod takes them.
+// Attribute values are base64, as encoding/json writes []byte.
+type MetadataJSON struct {
+	Perm   string            `json:"perm"`
+	UID    uint32            `json:"uid"`
+	GID    uint32            `json:"gid"`
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// NewEntryJSON converts e; a nil e gives nil, so absent sides are omitted.
+func NewEntryJSON(e *object.Entry) *EntryJSON {
+	if e == nil {
+		return nil
+	}
+	out := &EntryJSON{
+		Name: e.Name,
+		Mode: e.Mode.String(),
+		Size: e.Size,
+		Hash: e.Hash.String(),
+	}
+	if m := e.Meta; m != nil {
+		out.Meta = &MetadataJSON{Perm: fmt.Sprintf("%04o", m.Perm), UID: m.UID, GID: m.GID}
+		for _, x := range m.Xattrs {
+			if out.Meta.Xattrs == nil {
+				out.Meta.Xattrs = make(map[string][]byte, len(m.Xattrs))
+			}
+			out.Meta.Xattrs[x.Name] = x.Value
+		}
+	}
+	return out
+}
+
+type ChangeJSON struct {
+	Type    string     `json:"type"`
+	Path    string     `json:"path"`
+	Source  string     `json:"source,omitempty"`
+	OldSize int64      `json:"old_size"`
+	NewSize int64      `json:"new_size"`
+	Delta   int64      `json:"delta"`
+	Old     *EntryJSON `json:"old,omitempty"`
+	New     *EntryJSON `json:"new,omitempty"`
+}
+
+func NewChangeJSON(c *diff.Change) ChangeJSON {
+	return ChangeJSON{
+		Type:    c.Type.String(),
+		Path:    c.Path,
+		Source:  c.Source,
+		OldSize: c.OldSize(),
+		NewSize: c.NewSize(),
+		Delta:   c.SizeDelta(),
+		Old:     NewEntryJSON(c.OldEntry),
+		New:     NewEntryJSON(c.NewEntry),
+	}
+}
+
+type DiffJSON struct {
+	Changes   []ChangeJSON `json:"changes"`
+	Truncated bool         `json:"truncated"`
+}
+
+func NewDiffJSON(r *diff.Result) DiffJSON {
+	out := DiffJSON{
+		Changes:   make([]ChangeJSON, 0, len(r.Changes)),
+		Truncated: r.Truncated,
+	}
+	for i := range r.Changes {
+		out.Changes = append(out.Changes, NewChangeJSON(&r.Changes[i]))
+	}
+	return out
+}
+
+type StatLineJSON struct {
+	Changes  int   `json:"changes"`
+	OldBytes int64 `json:"old_bytes"`
+	NewBytes int64 `json:"new_bytes"`
+	Delta    int64 `json:"delta"`
+}
+
+func NewStatLineJSON(l diff.StatLine) StatLineJSON {
+	return StatLineJSON{
+		Changes:  l.Changes,
+		OldBytes: l.OldBytes,
+		NewBytes: l.NewBytes,
+		Delta:    l.Delta(),
+	}
+}
+
+type TypeStatJSON struct {
+	Type string `json:"type"`
+	StatLineJSON
+}
+
+type DirStatJSON struct {
+	Dir string `json:"dir"`
+	StatLineJSON
+}
+
+type StatJSON struct {
+	StatLineJSON
+	ByType    []TypeStatJSON `json:"by_type"`
+	ByDir     []DirStatJSON  `json:"by_dir"`
+	Truncated bool           `json:"truncated"`
+}
+
+func NewStatJSON(r *diff.Result) StatJSON {
+	st := r.Stat()
+	out := StatJSON{
+		StatLineJSON: NewStatLineJSON(st.Total),
+		ByType:       make([]TypeStatJSON, 0, len(st.ByType)),
+		ByDir:        make([]DirStatJSON, 0, len(st.ByDir)),
+		Truncated:    r.Truncated,
+	}
+	for _, l := range st.ByType {
+		out.ByType = append(out.ByType, TypeStatJSON{Type: l.Type.String(), StatLineJSON: NewStatLineJSON(l.StatLine)})
+	}
+	for _, l := range st.ByDir {
+		out.ByDir = append(out.ByDir, DirStatJSON{Dir: l.Dir, StatLineJSON: NewStatLineJSON(l.StatLine)})
+	}
+	return out
+}
+
+type DedupJSON struct {
+	Written      uint64 `json:"written"`
+	Deduplicated uint64 `json:"deduplicated"`
+	BytesWritten uint64 `json:"bytes_written"`
+	BytesSaved   uint64 `json:"bytes_saved"`
+}
+
+func NewDedupJSON(d object.DedupStats) DedupJSON {
+	return DedupJSON{
+		Written:      d.Written,
+		Deduplicated: d.Deduplicated,
+		BytesWritten: d.BytesWritten,
+		BytesSaved:   d.BytesSaved,
+	}
+}
+
+type MetricsJSON struct {
+	FilesHashed  int64   `json:"files_hashed"`
+	FilesCached  int64   `json:"files_cached"`
+	BytesRead    int64   `json:"bytes_read"`
+	CacheHitRate float64 `json:"cache_hit_rate"`
+	DurationMS   int64   `json:"duration_ms"`
+}
+
+func NewMetricsJSON(m result.Metrics) MetricsJSON {
+	return MetricsJSON{
+		FilesHashed:  m.FilesHashed,
+		FilesCached:  m.FilesCached,
+		BytesRead:    m.BytesRead,
+		CacheHitRate: m.CacheHitRate(),
+		DurationMS:   m.Duration.Milliseconds(),
+	}
+}
+
+type ErrorJSON struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type WarningJSON struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type ResultJSON struct {
+	Hash           string        `json:"hash"`
+	Errors         []ErrorJSON   `json:"errors"`
+	IgnoreWarnings []string      `json:"ignore_warnings,omitempty"`
+	Unvisited      []string      `json:"unvisited,omitempty"`
+	Unstable       []string      `json:"unstable,omitempty"`
+	Warnings       []WarningJSON `json:"warnings"`
+	Dedup          *DedupJSON    `json:"dedup,omitempty"`
+	Metrics        *MetricsJSON  `json:"metrics,omitempty"`
+	HardLinks      []LinkJSON    `json:"hard_links,omitempty"`
+	Pruned         int           `json:"pruned,omitempty"`
+}
+
+type LinkJSON struct {
+	Paths []string `json:"paths"`
+	Size  int64    `json:"size"`
+}
+
+// NewResultJSON converts a walk result; dedup and the walk's metrics are
+// only included when dedup is non-nil.
+func NewResultJSON(res *result.Result, dedup *object.DedupStats) ResultJSON {
+	out := ResultJSON{
+		Hash:      res.Hash.String(),
+		Errors:    make([]ErrorJSON, 0, len(res.Errors)),
+		Unvisited: res.Unvisited,
+		Unstable:  res.Unstable,
+		Warnings:  make([]WarningJSON, 0, len(res.Warnings)),
+		Pruned:    res.Pruned,
+	}
+	for _, e := range res.Errors {
+		out.Errors = append(out.Errors, ErrorJSON{Path: e.Path, Error: e.Err.Error()})
+	}
+	for _, w := range res.Warnings {
+		out.Warnings = append(out.Warnings, WarningJSON{Kind: string(w.Kind), Path: w.Path, Message: w.Message})
+	}
+	for _, g := range res.HardLinks {
+		out.HardLinks = append(out.HardLinks, LinkJSON{Paths: g.Paths, Size: g.Size})
+	}
+	for _, w := range res.IgnoreWarnings {
+		out.IgnoreWarnings = append(out.IgnoreWarnings, w.Error())
+	}
+	if dedup != nil {
+		d := NewDedupJSON(*dedup)
+		m := NewMetricsJSON(res.Metrics)
+		out.Dedup, out.Metrics = &d, &m
+	}
+	return out
+}
+
+// WriteJSON writes v indented, as the json format does.
+func WriteJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+	return nil
+}
+
+// writeLine writes v as one line of compact JSON, as the ndjson format does.
+func writeLine(w io.Writer, v any) error {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+// Package report prints walk results and diffs in the formats the smerkle
+// CLI offers, so tools built on the library can match its output exactly.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/diff"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/result"
+)
+
+// Formats New accepts.
+const (
+	// Text is for people: the root hash or one "M\tpath" line per change on
+	// the output, with warnings on the error stream.
+	Text = "text"
+	// JSON is one indented document per result or diff.
+	JSON = "json"
+	// NDJSON is compact JSON, one line per result or per change; a truncated
+	// diff ends with a {"truncated":true} line.
+	NDJSON = "ndjson"
+	// JSONL is JSON Lines records that each name their kind, printed as a
+	// walk or diff goes when the caller streams them. See JSONLWriter.
+	JSONL = "jsonl"
+	// Porcelain is for scripts: stable space-separated records on the output
+	// alone, never reworded between releases. See PorcelainWriter.
+	Porcelain = "porcelain"
+)
+
+var ErrUnknownFormat = errors.New("report: unknown format")
+
+// Formats lists the formats New accepts.
+func Formats() []string {
+	return []string{Text, JSON, NDJSON, JSONL, Porcelain}
+}
+
+// Writer prints walk results and diffs in one format.
+type Writer interface {
+	// WriteResult prints a walk result. dedup, if non-nil, adds the
+	// session's object write statistics and the walk's metrics.
+	WriteResult(res *result.Result, dedup *object.DedupStats) error
+	// WriteDiff prints the changes in res.
+	WriteDiff(res *diff.Result) error
+}
+
+// New returns a Writer for format that prints to out; only the text format
+// writes to errOut, which may then be nil.
+func New(format string, out, errOut io.Writer) (Writer, error) {
+	switch format {
+	case Text:
+		return &TextWriter{Out: out, Err: errOut}, nil
+	case JSON:
+		return &JSONWriter{Out: out}, nil
+	case NDJSON:
+		return &NDJSONWriter{Out: out}, nil
+	case JSONL:
+		return &JSONLWriter{Out: out}, nil
+	case Porcelain:
+		return &PorcelainWriter{Out: out}, nil
+	default:
+		return nil, fmt.Errorf("%w %q (want %s)", ErrUnknownFormat, format, strings.Join(Formats(), ", "))
+	}
+}
+
+// TextWriter prints the root hash or changes to Out and everything that
+// qualifies a result to Err.
+type TextWriter struct {
+	Out io.Writer
+	Err io.Writer
+
+	// NullTerm ends each field of a change with NUL instead of separating
+	// them with a tab and ending the line, as git diff -z does, so paths
+	// holding newlines or tabs parse unambiguously.
+	NullTerm bool
+}
+
+func (t *TextWriter) WriteResult(res *result.Result, dedup *object.DedupStats) error {
+	WriteWarnings(t.Err, res)
+	if dedup != nil {
+		if err := WriteDedupText(t.Err, *dedup); err != nil {
+			return err
+		}
+		if err := WriteHardLinksText(t.Err, res); err != nil {
+			return err
+		}
+		if err := WriteMetricsText(t.Err, res.Metrics); err != nil {
+			return err
+		}
+	}
+	if res.Pruned > 0 {
+		_, _ = fmt.Fprintf(t.Err, "pruned %d stale cache entries\n", res.Pruned)
+	}
+	if _, err := fmt.Fprintln(t.Out, res.Hash); err != nil {
+		return fmt.Errorf("write hash: %w", err)
+	}
+	return nil
+}
+
+func (t *TextWriter) WriteDiff(res *diff.Result) error {
+	for _, c := range res.Changes {
+		var err error
+		switch {
+		case t.NullTerm && c.Type == diff.ChangeCopied:
+			_, err = fmt.Fprintf(t.Out, "%s\x00%s\x00%s\x00", ChangeLetter(c.Type), c.Source, c.Path)
+		case t.NullTerm:
+			_, err = fmt.Fprintf(t.Out, "%s\x00%s\x00", ChangeLetter(c.Type), c.Path)
+		case c.Type == diff.ChangeCopied:
+			_, err = fmt.Fprintf(t.Out, "%s\t%s -> %s\n", ChangeLetter(c.Type), c.Source, c.Path)
+		default:
+			_, err = fmt.Fprintf(t.Out, "%s\t%s\n", ChangeLetter(c.Type), c.Path)
+		}
+		if err != nil {
+			return fmt.Errorf("write change: %w", err)
+		}
+	}
+	return nil
+}
+
+// WriteWarnings prints a walk's non-fatal errors and warnings as the text
+// format does: the hash is still usable but may not cover what the user
+// intended.
+func WriteWarnings(w io.Writer, res *result.Result) {
+	for _, iw := range res.IgnoreWarnings {
+		_, _ = fmt.Fprintf(w, "warning: invalid ignore pattern: %s\n", iw.Error())
+	}
+	for _, e := range res.Errors {
+		_, _ = fmt.Fprintf(w, "warning: %s\n", e.Error())
+	}
+	for _, sw := range res.Warnings {
+		switch sw.Kind {
+		case result.WarningSpecialFile, result.WarningSymlinkCycle, result.WarningTooLarge, result.WarningTooDeep:
+			_, _ = fmt.Fprintf(w, "warning: %s: %s\n", sw.Path, sw.Message)
+		default:
+			// the other kinds repeat fields printed on their own
+		}
+	}
+	for _, p := range res.Unstable {
+		_, _ = fmt.Fprintf(w, "warning: %s: modified while being hashed; its hash may match neither version\n", p)
+	}
+	if res.Partial() {
+		_, _ = fmt.Fprintf(w, "warning: budget exhausted; root covers a partial tree, %d paths not visited:\n", len(res.Unvisited))
+		for _, p := range res.Unvisited {
+			_, _ = fmt.Fprintf(w, "  %s\n", p)
+		}
+	}
+}
+
+// WriteDedupText prints object write statistics as the text format does.
+func WriteDedupText(w io.Writer, d object.DedupStats) error {
+	_, err := fmt.Fprintf(w, "blobs written: %d (%d bytes)\nblobs deduplicated: %d (%d bytes saved)\n",
+		d.Written, d.BytesWritten, d.Deduplicated, d.BytesSaved)
+	if err != nil {
+		return fmt.Errorf("write dedup stats: %w", err)
+	}
+	return nil
+}
+
+// WriteHardLinksText prints the files a walk reached through several hard
+// links as the text format does, one line of paths per file.
+func WriteHardLinksText(w io.Writer, res *result.Result) error {
+	if len(res.HardLinks) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "hard links: %d files (%d bytes read once)\n", len(res.HardLinks), res.LinkedBytes())
+	for _, g := range res.HardLinks {
+		fmt.Fprintf(&b, "%6d\t%s\n", g.Size, strings.Join(g.Paths, ", "))
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write hard links: %w", err)
+	}
+	return nil
+}
+
+// WriteMetricsText prints a walk's metrics as the text format does.
+func WriteMetricsText(w io.Writer, m result.Metrics) error {
+	_, err := fmt.Fprintf(w, "files hashed: %d (%d bytes read)\nfiles from cache: %d (%.1f%% hit rate)\nwalk time: %s\n",
+		m.FilesHashed, m.BytesRead, m.FilesCached, 100*m.CacheHitRate(), m.Duration.Round(time.Millisecond))
+	if err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	return nil
+}
+
+// WriteStatText prints a diff summary as the text format does: totals, then
+// one line per change type and per top-level directory with the number of
+// files and the byte delta.
+func WriteStatText(w io.Writer, st *diff.Stat) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "files changed: %d\nbytes: %d -> %d (%+d)\n",
+		st.Total.Changes, st.Total.OldBytes, st.Total.NewBytes, st.Total.Delta())
+	if len(st.ByType) > 0 {
+		b.WriteString("by type:\n")
+	}
+	for _, l := range st.ByType {
+		fmt.Fprintf(&b, "%6d\t%+d\t%s\n", l.Changes, l.Delta(), l.Type)
+	}
+	if len(st.ByDir) > 0 {
+		b.WriteString("by directory:\n")
+	}
+	for _, l := range st.ByDir {
+		fmt.Fprintf(&b, "%6d\t%+d\t%s\n", l.Changes, l.Delta(), l.Dir)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write diff stat: %w", err)
+	}
+	return nil
+}
+
+// ChangeLetter returns the git-style status letter for a change type.
+func ChangeLetter(t diff.ChangeType) string {
+	switch t {
+	case diff.ChangeAdded:
+		return "A"
+	case diff.ChangeDeleted:
+		return "D"
+	case diff.ChangeModified:
+		return "M"
+	case diff.ChangeTypeChange:
+		return "T"
+	case diff.ChangeCopied:
+		return "C"
+	default:
+		return "?"
+	}
+}
+
+// JSONWriter prints each result or diff as an indented JSON document.
+type JSONWriter struct {
+	Out io.Writer
+}
+
+func (j *JSONWriter) WriteResult(res *result.Result, dedup *object.DedupStats) error {
+	return WriteJSON(j.Out, NewResultJSON(res, dedup))
+}
+
+func (j *JSONWriter) WriteDiff(res *diff.Result) error {
+	return WriteJSON(j.Out, NewDiffJSON(res))
+}
+
+// NDJSONWriter prints a result as one line of JSON and a diff as one line
+// per change, so consumers can process a long diff as it streams.
+type NDJSONWriter struct {
+	Out io.Writer
+}
+
+func (n *NDJSONWriter) WriteResult(res *result.Result, dedup *object.DedupStats) error {
+	return writeLine(n.Out, NewResultJSON(res, dedup))
+}
+
+func (n *NDJSONWriter) WriteDiff(res *diff.Result) error {
+	for i := range res.Changes {
+		if err := writeLine(n.Out, NewChangeJSON(&res.Changes[i])); err != nil {
+			return err
+		}
+	}
+	if res.Truncated {
+		return writeLine(n.Out, struct {
+			Truncated bool `json:"truncated"`
+		}{Truncated: true})
+	}
+	return nil
+}
+
+// JSONLWriter prints one compact JSON record per line, its kind in "record":
+//
+//	{"record":"entry","path":<path>,<entry fields>}
+//	{"record":"result",<result fields>}
+//	{"record":"change",<change fields>}
+//	{"record":"truncated"}
+//
+// The fields are those of the json format. WriteEntry and WriteChange print
+// records while a walk or diff runs, from walker.WithEntryFunc or
+// diff.Options.OnChange, so nothing has to wait for the whole result;
+// WriteResult and WriteDiff then print what remains. Its methods may be
+// called from several goroutines; the first write error sticks.
+type JSONLWriter struct {
+	Out io.Writer
+
+	mu  sync.Mutex
+	err error
+}
+
+type entryRecord struct {
+	Record string `json:"record"`
+	Path   string `json:"path"`
+	EntryJSON
+}
+
+type resultRecord struct {
+	Record string `json:"record"`
+	ResultJSON
+}
+
+type changeRecord struct {
+	Record string `json:"record"`
+	ChangeJSON
+}
+
+// WriteEntry prints the walk entry at the slash-separated path.
+func (l *JSONLWriter) WriteEntry(path string, e *object.Entry) error {
+	return l.write(entryRecord{Record: "entry", Path: path, EntryJSON: *NewEntryJSON(e)})
+}
+
+// WriteChange prints one change of a diff.
+func (l *JSONLWriter) WriteChange(c *diff.Change) error {
+	return l.write(changeRecord{Record: "change", ChangeJSON: NewChangeJSON(c)})
+}
+
+func (l *JSONLWriter) WriteResult(res *result.Result, dedup *object.DedupStats) error {
+	return l.write(resultRecord{Record: "result", ResultJSON: NewResultJSON(res, dedup)})
+}
+
+// WriteDiff prints the changes in res, none if they went to WriteChange
+// already, and a truncated record if the diff was cut short.
+func (l *JSONLWriter) WriteDiff(res *diff.Result) error {
+	for i := range res.Changes {
+		if err := l.WriteChange(&res.Changes[i]); err != nil {
+			return err
+		}
+	}
+	if res.Truncated {
+		return l.write(struct {
+			Record string `json:"record"`
+		}{Record: "truncated"})
+	}
+	return nil
+}
+
+func (l *JSONLWriter) write(v any) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = writeLine(l.Out, v)
+	}
+	return l.err
+}
+
+// PorcelainWriter prints records a script can split on spaces, every one on
+// Out:
+//
+//	hash <hash>
+//	error <path> <message>
+//	warning <kind> <path> <message>
+//	dedup <written> <bytes written> <deduplicated> <bytes saved>
+//	metrics <files hashed> <files from cache> <bytes read> <milliseconds>
+//	hardlink <size> <path> <path>...
+//	pruned <cache entries>
+//
+// for a result, where warnings include unstable and unvisited paths, and
+//
+//	<letter> <hash before or -> <hash after or -> <path>
+//	C <hash> <hash> <path> <source>
+//	truncated
+//
+// for a diff. Paths and messages holding spaces or control characters are
+// Go-quoted, so each record splits unambiguously.
+type PorcelainWriter struct {
+	Out io.Writer
+}
+
+func (p *PorcelainWriter) WriteResult(res *result.Result, dedup *object.DedupStats) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "hash %s\n", res.Hash)
+	for _, e := range res.Errors {
+		fmt.Fprintf(&b, "error %s %s\n", quoteField(e.Path), quoteField(e.Err.Error()))
+	}
+	for _, w := range res.Warnings {
+		fmt.Fprintf(&b, "warning %s %s %s\n", w.Kind, quoteField(w.Path), quoteField(w.Message))
+	}
+	if dedup != nil {
+		fmt.Fprintf(&b, "dedup %d %d %d %d\n", dedup.Written, dedup.BytesWritten, dedup.Deduplicated, dedup.BytesSaved)
+		m := res.Metrics
+		fmt.Fprintf(&b, "metrics %d %d %d %d\n", m.FilesHashed, m.FilesCached, m.BytesRead, m.Duration.Milliseconds())
+	}
+	for _, g := range res.HardLinks {
+		fmt.Fprintf(&b, "hardlink %d", g.Size)
+		for _, p := range g.Paths {
+			fmt.Fprintf(&b, " %s", quoteField(p))
+		}
+		b.WriteByte('\n')
+	}
+	if res.Pruned > 0 {
+		fmt.Fprintf(&b, "pruned %d\n", res.Pruned)
+	}
+	if _, err := io.WriteString(p.Out, b.String()); err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	return nil
+}
+
+func (p *PorcelainWriter) WriteDiff(res *diff.Result) error {
+	var b strings.Builder
+	for _, c := range res.Changes {
+		fmt.Fprintf(&b, "%s %s %s %s", ChangeLetter(c.Type), entryHash(c.OldEntry), entryHash(c.NewEntry), quoteField(c.Path))
+		if c.Type == diff.ChangeCopied {
+			fmt.Fprintf(&b, " %s", quoteField(c.Source))
+		}
+		b.WriteByte('\n')
+	}
+	if res.Truncated {
+		b.WriteString("truncated\n")
+	}
+	if _, err := io.WriteString(p.Out, b.String()); err != nil {
+		return fmt.Errorf("write changes: %w", err)
+	}
+	return nil
+}
+
+func entryHash(e *object.Entry) string {
+	if e == nil {
+		return "-"
+	}
+	return e.Hash.String()
+}
+
+// quoteField returns s, or s Go-quoted if it is empty, "-", or holds a
+// space, quote, or non-printing character.
+func quoteField(s string) string {
+	if s == "" || s == "-" || strings.ContainsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '"' || !strconv.IsPrint(r)
+	}) {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/diff"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/result"
+	"github.com/garrettladley/smerkle/internal/xerrors"
+)
+
+func testResult() *result.Result {
+	return &result.Result{
+		Hash:     object.HashBytes([]byte("root")),
+		Errors:   []xerrors.HashError{{Path: "locked dir", Err: errors.New("permission denied")}},
+		Unstable: []string{"log.txt"},
+		Warnings: []result.Warning{
+			{Kind: result.WarningUnstable, Path: "log.txt", Message: "modified while being read"},
+		},
+		HardLinks: []result.LinkGroup{{Paths: []string{"a.bin", "b/a.bin"}, Size: 4}},
+		Pruned:    3,
+	}
+}
+
+func testDiff() *diff.Result {
+	a := &object.Entry{Name: "a.go", Mode: object.ModeRegular, Size: 1, Hash: object.HashBytes([]byte("a"))}
+	b := &object.Entry{Name: "b\tc.go", Mode: object.ModeRegular, Size: 1, Hash: object.HashBytes([]byte("a"))}
+	return &diff.Result{
+		Changes: []diff.Change{
+			{Type: diff.ChangeDeleted, Path: "a.go", OldEntry: a},
+			{Type: diff.ChangeCopied, Path: "b\tc.go", Source: "src/a.go", NewEntry: b},
+		},
+		Truncated: true,
+	}
+}
+
+func TestWriters(t *testing.T) {
+	t.Parallel()
+
+	root := object.HashBytes([]byte("root")).String()
+	a := object.HashBytes([]byte("a")).String()
+	tests := []struct {
+		format     string
+		wantResult string
+		wantDiff   string
+		wantErrOut string
+	}{
+		{
+			format:     Text,
+			wantResult: root + "\n",
+			wantDiff:   "D\ta.go\nC\tsrc/a.go -> b\tc.go\n",
+			wantErrOut: "warning: locked dir: permission denied\n" +
+				"warning: log.txt: modified while being hashed; its hash may match neither version\n" +
+				"pruned 3 stale cache entries\n",
+		},
+		{
+			format: Porcelain,
+			wantResult: "hash " + root + "\n" +
+				"error \"locked dir\" \"permission denied\"\n" +
+				"warning unstable log.txt \"modified while being read\"\n" +
+				"hardlink 4 a.bin b/a.bin\n" +
+				"pruned 3\n",
+			wantDiff: "D " + a + " - a.go\n" +
+				"C - " + a + " \"b\\tc.go\" src/a.go\n" +
+				"truncated\n",
+		},
+		{
+			format: NDJSON,
+			wantResult: `{"hash":"` + root + `","errors":[{"path":"locked dir","error":"permission denied"}],` +
+				`"unstable":["log.txt"],"warnings":[{"kind":"unstable","path":"log.txt","message":"modified while being read"}],` +
+				`"hard_links":[{"paths":["a.bin","b/a.bin"],"size":4}],"pruned":3}` + "\n",
+			wantDiff: `{"type":"deleted","path":"a.go","old_size":1,"new_size":0,"delta":-1,"old":{"name":"a.go","mode":"regular","size":1,"hash":"` + a + `"}}` + "\n" +
+				`{"type":"copied","path":"b\tc.go","source":"src/a.go","old_size":0,"new_size":1,"delta":1,"new":{"name":"b\tc.go","mode":"regular","size":1,"hash":"` + a + `"}}` + "\n" +
+				`{"truncated":true}` + "\n",
+		},
+		{
+			format: JSONL,
+			wantResult: `{"record":"result","hash":"` + root + `","errors":[{"path":"locked dir","error":"permission denied"}],` +
+				`"unstable":["log.txt"],"warnings":[{"kind":"unstable","path":"log.txt","message":"modified while being read"}],` +
+				`"hard_links":[{"paths":["a.bin","b/a.bin"],"size":4}],"pruned":3}` + "\n",
+			wantDiff: `{"record":"change","type":"deleted","path":"a.go","old_size":1,"new_size":0,"delta":-1,"old":{"name":"a.go","mode":"regular","size":1,"hash":"` + a + `"}}` + "\n" +
+				`{"record":"change","type":"copied","path":"b\tc.go","source":"src/a.go","old_size":0,"new_size":1,"delta":1,"new":{"name":"b\tc.go","mode":"regular","size":1,"hash":"` + a + `"}}` + "\n" +
+				`{"record":"truncated"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			t.Parallel()
+
+			var out, errOut bytes.Buffer
+			w, err := New(tt.format, &out, &errOut)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := w.WriteResult(testResult(), nil); err != nil {
+				t.Fatalf("WriteResult() error = %v", err)
+			}
+			if got := out.String(); got != tt.wantResult {
+				t.Errorf("WriteResult() =\n%s\nwant\n%s", got, tt.wantResult)
+			}
+			out.Reset()
+			if err := w.WriteDiff(testDiff()); err != nil {
+				t.Fatalf("WriteDiff() error = %v", err)
+			}
+			if got := out.String(); got != tt.wantDiff {
+				t.Errorf("WriteDiff() =\n%s\nwant\n%s", got, tt.wantDiff)
+			}
+			if got := errOut.String(); got != tt.wantErrOut {
+				t.Errorf("error output =\n%s\nwant\n%s", got, tt.wantErrOut)
+			}
+		})
+	}
+}
+
+func TestTextWriterNullTerm(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	w := &TextWriter{Out: &out, NullTerm: true}
+	if err := w.WriteDiff(testDiff()); err != nil {
+		t.Fatalf("WriteDiff() error = %v", err)
+	}
+	if got, want := out.String(), "D\x00a.go\x00C\x00src/a.go\x00b\tc.go\x00"; got != want {
+		t.Errorf("WriteDiff() = %q, want %q", got, want)
+	}
+}
+
+func TestJSONLWriteEntry(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	w := &JSONLWriter{Out: &out}
+	e := &object.Entry{Name: "a.go", Mode: object.ModeRegular, Size: 1, Hash: object.HashBytes([]byte("a"))}
+	if err := w.WriteEntry("src/a.go", e); err != nil {
+		t.Fatalf("WriteEntry() error = %v", err)
+	}
+	want := `{"record":"entry","path":"src/a.go","name":"a.go","mode":"regular","size":1,"hash":"` + e.Hash.String() + `"}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("WriteEntry() = %s, want %s", got, want)
+	}
+}
+
+func TestNewUnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("yaml", nil, nil)
+	if !errors.Is(err, ErrUnknownFormat) || !strings.Contains(err.Error(), "porcelain") {
+		t.Errorf("New(yaml) error = %v, want ErrUnknownFormat listing the formats", err)
+	}
+}
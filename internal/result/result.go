@@ -1,19 +1,115 @@
 package result
 
 import (
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/ignore"
 	"github.com/garrettladley/smerkle/internal/object"
 	"github.com/garrettladley/smerkle/internal/xerrors"
 )
 
 type Result struct {
-	Hash   object.Hash
-	Errors []xerrors.HashError
+	Hash       object.Hash
+	IgnoreHash object.Hash // fingerprint of the ignore rules applied; zero if none
+	Errors     []xerrors.HashError
+
+	// IgnoreWarnings lists ignore patterns that failed to compile and were
+	// skipped. They don't make the result fail but do change what was hashed.
+	IgnoreWarnings []ignore.Warning
+
+	// Unvisited lists paths left out of Hash because the walk budget ran
+	// out; non-empty means Hash covers only part of the tree.
+	Unvisited []string
+
+	// Unstable lists files whose size or modification time changed while
+	// they were read; their hashes may match neither the old nor new content.
+	Unstable []string
+
+	// Warnings lists every non-fatal condition that leaves Hash usable but
+	// not an exact picture of the tree on disk, sorted by path, including
+	// those also reported in the fields above. Empty together with Errors
+	// means a clean hash.
+	Warnings []Warning
+
+	// HardLinks lists the files reached through more than one path, each
+	// read and hashed once and shared by all of them.
+	HardLinks []LinkGroup
+
+	// Pruned counts the stale cache entries the walk removed, if asked to.
+	Pruned int
+
+	// Metrics counts the work the walk did.
+	Metrics Metrics
+}
+
+// Metrics counts the work a walk did, to tell how much of it the cache
+// saved.
+type Metrics struct {
+	FilesHashed int64 // files and symlinks read and hashed
+	FilesCached int64 // files whose hash came from the cache instead
+	BytesRead   int64 // file content read, rereads of files modified mid-read included
+	Duration    time.Duration
+}
+
+// CacheHitRate returns the share of files served from the cache.
+func (m Metrics) CacheHitRate() float64 {
+	files := m.FilesHashed + m.FilesCached
+	if files == 0 {
+		return 0
+	}
+	return float64(m.FilesCached) / float64(files)
+}
+
+// LinkGroup is one file hard linked at several paths.
+type LinkGroup struct {
+	Paths []string // sorted
+	Size  int64
+}
+
+// LinkedBytes returns the bytes the walk didn't reread thanks to hard link
+// detection: each group's size for every path after the first.
+func (r *Result) LinkedBytes() int64 {
+	var n int64
+	for _, g := range r.HardLinks {
+		n += g.Size * int64(len(g.Paths)-1)
+	}
+	return n
+}
+
+// WarningKind classifies a Warning.
+type WarningKind string
+
+const (
+	WarningSpecialFile   WarningKind = "special_file"   // device, named pipe, or socket left out of the tree
+	WarningUnstable      WarningKind = "unstable"       // file modified while being read
+	WarningUnvisited     WarningKind = "unvisited"      // path skipped when the walk budget ran out
+	WarningIgnorePattern WarningKind = "ignore_pattern" // invalid ignore pattern skipped; Path is its file
+	WarningSymlinkCycle  WarningKind = "symlink_cycle"  // followed symlink to a directory containing it left out
+	WarningTooLarge      WarningKind = "too_large"      // file over the max file size left out
+	WarningTooDeep       WarningKind = "too_deep"       // directory at the max depth left out
+)
+
+// Warning is a non-fatal condition met during a walk.
+type Warning struct {
+	Kind    WarningKind
+	Path    string
+	Message string
 }
 
 func (r *Result) Ok() bool {
 	return len(r.Errors) == 0
 }
 
+// Partial reports whether Hash was computed over an incomplete walk.
+func (r *Result) Partial() bool {
+	return len(r.Unvisited) > 0
+}
+
+// Clean reports whether the walk finished without errors or warnings.
+func (r *Result) Clean() bool {
+	return r.Ok() && len(r.Warnings) == 0
+}
+
 func (r *Result) Err() error {
 	if r.Ok() {
 		return nil
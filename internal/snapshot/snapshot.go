@@ -0,0 +1,164 @@
+// Package snapshot creates short-lived, read-only filesystem snapshots so a
+// live directory can be hashed at a single point in time.
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownProvider = errors.New("snapshot: unknown provider")
+	ErrUnsupported     = errors.New("snapshot: directory is not on a snapshot-capable filesystem")
+)
+
+// Snapshot is a point-in-time, read-only view of a directory.
+type Snapshot struct {
+	// Path is where the snapshotted directory's contents can be read.
+	Path string
+
+	destroy func(ctx context.Context) error
+}
+
+// Destroy removes the snapshot. It must be called once the walk is done.
+func (s *Snapshot) Destroy(ctx context.Context) error {
+	return s.destroy(ctx)
+}
+
+// Provider snapshots directories on one kind of filesystem.
+type Provider interface {
+	Name() string
+	// Create snapshots root, which must be the root of a snapshot-capable
+	// volume (a btrfs subvolume, a ZFS dataset mountpoint, ...).
+	Create(ctx context.Context, root string) (*Snapshot, error)
+}
+
+// Auto selects the first provider that can snapshot root.
+const Auto = "auto"
+
+var providers = []Provider{btrfs{}, zfs{}}
+
+// Names lists the accepted provider names, including Auto.
+func Names() []string {
+	names := []string{Auto}
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Create snapshots root with the named provider, or with the first provider
+// that succeeds when name is Auto.
+func Create(ctx context.Context, name, root string) (*Snapshot, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
+
+	if name != Auto {
+		for _, p := range providers {
+			if p.Name() != name {
+				continue
+			}
+			snap, err := p.Create(ctx, abs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return snap, nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+
+	var errs []error
+	for _, p := range providers {
+		snap, err := p.Create(ctx, abs)
+		if err == nil {
+			return snap, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+	return nil, fmt.Errorf("%w: %w", ErrUnsupported, errors.Join(errs...))
+}
+
+// snapshotName is unique enough for concurrent smerkle runs on one host.
+func snapshotName() string {
+	return fmt.Sprintf("smerkle-%d-%d", os.Getpid(), time.Now().UnixNano())
+}
+
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput() //nolint:gosec // fixed tool names, arguments are paths
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+// btrfs snapshots a subvolume into a sibling directory.
+type btrfs struct{}
+
+func (btrfs) Name() string { return "btrfs" }
+
+func (btrfs) Create(ctx context.Context, root string) (*Snapshot, error) {
+	if _, err := run(ctx, "btrfs", "subvolume", "show", root); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(filepath.Dir(root), "."+snapshotName())
+	if _, err := run(ctx, "btrfs", "subvolume", "snapshot", "-r", root, path); err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Path: path,
+		destroy: func(ctx context.Context) error {
+			_, err := run(ctx, "btrfs", "subvolume", "delete", path)
+			return err
+		},
+	}, nil
+}
+
+// zfs snapshots the dataset mounted at root and reads it through the
+// dataset's .zfs/snapshot directory.
+type zfs struct{}
+
+func (zfs) Name() string { return "zfs" }
+
+func (zfs) Create(ctx context.Context, root string) (*Snapshot, error) {
+	out, err := run(ctx, "zfs", "list", "-H", "-o", "name,mountpoint")
+	if err != nil {
+		return nil, err
+	}
+
+	dataset := ""
+	for line := range strings.Lines(out) {
+		name, mountpoint, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if ok && mountpoint == root {
+			dataset = name
+			break
+		}
+	}
+	if dataset == "" {
+		return nil, fmt.Errorf("%s is not a zfs dataset mountpoint", root)
+	}
+
+	name := snapshotName()
+	full := dataset + "@" + name
+	if _, err := run(ctx, "zfs", "snapshot", full); err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Path: filepath.Join(root, ".zfs", "snapshot", name),
+		destroy: func(ctx context.Context) error {
+			_, err := run(ctx, "zfs", "destroy", full)
+			return err
+		},
+	}, nil
+}
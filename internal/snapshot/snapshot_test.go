@@ -0,0 +1,48 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	t.Parallel()
+
+	names := Names()
+	for _, want := range []string{Auto, "btrfs", "zfs"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("Names() = %v, missing %q", names, want)
+		}
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		provider string
+		wantErr  error
+	}{
+		{name: "unknown provider", provider: "lvm", wantErr: ErrUnknownProvider},
+		// a plain temp dir is never a subvolume or dataset mountpoint
+		{name: "auto on ordinary directory", provider: Auto, wantErr: ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			snap, err := Create(context.Background(), tt.provider, t.TempDir())
+			if err == nil {
+				_ = snap.Destroy(context.Background())
+				t.Fatal("Create() error = nil, want error")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
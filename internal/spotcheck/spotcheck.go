@@ -0,0 +1,205 @@
+// Package spotcheck verifies a random sample of a stored tree's files against
+// their copies on disk: a cheap, repeatable integrity probe for trees too
+// large to rehash in full.
+package spotcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// ProblemKind classifies a sampled file that failed verification.
+type ProblemKind string
+
+const (
+	ProblemMissing    ProblemKind = "missing"     // no longer on disk
+	ProblemModeChange ProblemKind = "mode_change" // type or executable bit differs
+	ProblemModified   ProblemKind = "modified"    // content no longer matches the stored hash
+	ProblemUnreadable ProblemKind = "unreadable"  // could not be read; Detail says why
+)
+
+// Problem is a sampled file that failed verification.
+type Problem struct {
+	Path   string // slash-separated, relative to the root
+	Kind   ProblemKind
+	Detail string
+}
+
+// Result reports a spot check.
+type Result struct {
+	Files    int      // files, symlinks included, in the stored tree
+	Sampled  []string // paths checked, sorted
+	Problems []Problem
+}
+
+// Options chooses the sample. Exactly one of Fraction and Count is used:
+// Count if it is positive, otherwise Fraction of the files, rounded up.
+type Options struct {
+	Fraction float64
+	Count    int
+	Seed     uint64 // the same seed over the same tree picks the same files
+}
+
+type file struct {
+	path  string
+	entry object.Entry
+}
+
+// Check samples files from the tree root and verifies each against dir, the
+// directory the tree was hashed from. Differences are reported as Problems;
+// the error is only for failures reading the store.
+func Check(ctx context.Context, s *store.Store, root object.Hash, dir string, opts Options) (*Result, error) {
+	var files []file
+	if err := collect(ctx, s, root, "", &files); err != nil {
+		return nil, err
+	}
+
+	res := &Result{Files: len(files)}
+	n := sampleSize(len(files), opts)
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed)) //nolint:gosec // sampling, not security
+	for i := range n {
+		// partial Fisher-Yates: the first n elements become the sample
+		j := i + rng.IntN(len(files)-i)
+		files[i], files[j] = files[j], files[i]
+	}
+	sample := files[:n]
+	slices.SortFunc(sample, func(a, b file) int { return object.CompareNames(a.path, b.path) })
+
+	for _, f := range sample {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("context: %w", err)
+		}
+		res.Sampled = append(res.Sampled, f.path)
+		p, err := verify(s, &f.entry, filepath.Join(dir, filepath.FromSlash(f.path)))
+		if err != nil {
+			return nil, fmt.Errorf("verify %s: %w", f.path, err)
+		}
+		if p != nil {
+			p.Path = f.path
+			res.Problems = append(res.Problems, *p)
+		}
+	}
+	return res, nil
+}
+
+func sampleSize(total int, opts Options) int {
+	n := opts.Count
+	if n <= 0 {
+		n = int(math.Ceil(float64(total) * opts.Fraction))
+	}
+	return max(min(n, total), 0)
+}
+
+// collect appends every file and symlink under tree h to files.
+func collect(ctx context.Context, s *store.Store, h object.Hash, prefix string, files *[]file) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context: %w", err)
+	}
+	tree, err := s.GetTree(h)
+	if err != nil {
+		return fmt.Errorf("get tree %s: %w", h, err)
+	}
+	for _, e := range tree.Entries {
+		rel := e.Name
+		if prefix != "" {
+			rel = prefix + "/" + e.Name
+		}
+		switch {
+		case e.Mode == object.ModeDirectory:
+			if err := collect(ctx, s, e.Hash, rel, files); err != nil {
+				return err
+			}
+		case e.Mode.IsFile() || e.Mode == object.ModeSymlink:
+			*files = append(*files, file{path: rel, entry: e})
+		}
+	}
+	return nil
+}
+
+// verify rereads the file at p and reports how it differs from e, if at all.
+func verify(s *store.Store, e *object.Entry, p string) (*Problem, error) {
+	info, err := os.Lstat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Problem{Kind: ProblemMissing}, nil
+	}
+	if err != nil {
+		return &Problem{Kind: ProblemUnreadable, Detail: err.Error()}, nil
+	}
+	if mode := diskMode(info); mode != e.Mode {
+		return &Problem{Kind: ProblemModeChange, Detail: fmt.Sprintf("%s, stored %s", mode, e.Mode)}, nil
+	}
+
+	var content []byte
+	if e.Mode == object.ModeSymlink {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return &Problem{Kind: ProblemUnreadable, Detail: err.Error()}, nil
+		}
+		content = []byte(target)
+	} else {
+		if info.Size() != e.Size {
+			return &Problem{Kind: ProblemModified, Detail: fmt.Sprintf("size %d, stored %d", info.Size(), e.Size)}, nil
+		}
+		content, err = os.ReadFile(p) //nolint:gosec // paths come from the stored tree under the user's directory
+		if err != nil {
+			return &Problem{Kind: ProblemUnreadable, Detail: err.Error()}, nil
+		}
+	}
+
+	ok, err := matches(s, e.Hash, content)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &Problem{Kind: ProblemModified, Detail: "content does not match the stored hash"}, nil
+	}
+	return nil, nil
+}
+
+// matches reports whether content hashes to h, either as one blob or, for a
+// chunked file, chunk by chunk against h's manifest. Only the manifest is
+// read from the store, never the content.
+func matches(s *store.Store, h object.Hash, content []byte) (bool, error) {
+	blob := &object.Blob{Content: content, Algorithm: s.Algorithm()}
+	if blob.Hash() == h {
+		return true, nil
+	}
+
+	data, err := s.GetObject(h)
+	if err != nil {
+		return false, fmt.Errorf("get object %s: %w", h, err)
+	}
+	if !bytes.HasPrefix(data, []byte(object.MagicManifest)) {
+		return false, nil
+	}
+	m, err := object.DecodeManifest(data)
+	if err != nil {
+		return false, fmt.Errorf("decode manifest %s: %w", h, err)
+	}
+	return m.Matches(content), nil
+}
+
+// diskMode maps info to the entry mode the walker would record.
+func diskMode(info fs.FileInfo) object.Mode {
+	switch m := info.Mode(); {
+	case m&fs.ModeSymlink != 0:
+		return object.ModeSymlink
+	case m.IsDir():
+		return object.ModeDirectory
+	case m&0o111 != 0:
+		return object.ModeExecutable
+	default:
+		return object.ModeRegular
+	}
+}
@@ -0,0 +1,153 @@
+package spotcheck
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.txt", "a", 0o600)
+	writeTestFile(t, dir, "big.bin", strings.Repeat("0123456789abcdef", 64<<10), 0o600)
+	writeTestFile(t, dir, "sub/run.sh", "#!/bin/sh\n", 0o700)
+	writeTestFile(t, dir, "sub/gone.txt", "gone", 0o600)
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	walked, err := walker.Walk(t.Context(), dir, s, walker.WithChunking(64<<10))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	all := Options{Fraction: 1}
+	res, err := Check(t.Context(), s, walked.Hash, dir, all)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if res.Files != 5 || len(res.Sampled) != 5 || len(res.Problems) != 0 {
+		t.Fatalf("Check() of an unchanged tree = %+v", res)
+	}
+
+	// same length, so only the hash can catch it
+	writeTestFile(t, dir, "a.txt", "b", 0o600)
+	big := []byte(strings.Repeat("0123456789abcdef", 64<<10))
+	big[len(big)-1] = 'x'
+	writeTestFile(t, dir, "big.bin", string(big), 0o600)
+	if err := os.Chmod(filepath.Join(dir, "sub/run.sh"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "sub/gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = Check(t.Context(), s, walked.Hash, dir, all)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	want := map[string]ProblemKind{
+		"a.txt":        ProblemModified,
+		"big.bin":      ProblemModified,
+		"sub/gone.txt": ProblemMissing,
+		"sub/run.sh":   ProblemModeChange,
+	}
+	got := make(map[string]ProblemKind)
+	for _, p := range res.Problems {
+		got[p.Path] = p.Kind
+	}
+	if len(got) != len(want) {
+		t.Fatalf("problems = %+v, want %v", res.Problems, want)
+	}
+	for path, kind := range want {
+		if got[path] != kind {
+			t.Errorf("problem for %s = %q, want %q", path, got[path], kind)
+		}
+	}
+}
+
+func TestCheckSample(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		writeTestFile(t, dir, name, name, 0o600)
+	}
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	walked, err := walker.Walk(t.Context(), dir, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want int
+	}{
+		{name: "fraction rounds up", opts: Options{Fraction: 0.01}, want: 1},
+		{name: "half", opts: Options{Fraction: 0.5}, want: 4},
+		{name: "count", opts: Options{Count: 3}, want: 3},
+		{name: "count beyond files", opts: Options{Count: 100}, want: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := Check(t.Context(), s, walked.Hash, dir, tt.opts)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if len(res.Sampled) != tt.want {
+				t.Errorf("sampled %d files, want %d", len(res.Sampled), tt.want)
+			}
+			if !slices.IsSorted(res.Sampled) {
+				t.Errorf("Sampled = %v, want sorted", res.Sampled)
+			}
+		})
+	}
+
+	// the seed alone picks the sample
+	first, err := Check(t.Context(), s, walked.Hash, dir, Options{Count: 3, Seed: 7})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	second, err := Check(t.Context(), s, walked.Hash, dir, Options{Count: 3, Seed: 7})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !slices.Equal(first.Sampled, second.Sampled) {
+		t.Errorf("samples with one seed = %v and %v, want equal", first.Sampled, second.Sampled)
+	}
+}
+
+func writeTestFile(t *testing.T, dir, rel, content string, perm os.FileMode) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(p, perm); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// SharedChunk is a chunk referenced by more than one manifest position.
+type SharedChunk struct {
+	Hash object.Hash
+	Size uint32
+	Refs int
+}
+
+// ChunkStats summarizes the chunks referenced by every manifest in the store.
+type ChunkStats struct {
+	Manifests    int
+	Chunks       int    // distinct chunks
+	References   int    // chunk references across all manifests
+	StoredBytes  uint64 // bytes held by distinct chunks
+	LogicalBytes uint64 // bytes of all chunked files
+	Top          []SharedChunk
+}
+
+// AvgChunkSize returns the mean size of a distinct chunk.
+func (c ChunkStats) AvgChunkSize() uint64 {
+	if c.Chunks == 0 {
+		return 0
+	}
+	return c.StoredBytes / uint64(c.Chunks)
+}
+
+// DedupFactor returns how many logical bytes each stored chunk byte serves.
+func (c ChunkStats) DedupFactor() float64 {
+	if c.StoredBytes == 0 {
+		return 0
+	}
+	return float64(c.LogicalBytes) / float64(c.StoredBytes)
+}
+
+// ChunkStats scans the store for manifests and reports chunk-level dedup,
+// including up to top of the most shared chunks.
+func (s *Store) ChunkStats(top int) (ChunkStats, error) {
+	var stats ChunkStats
+	type chunkRefs struct {
+		size uint32
+		refs int
+	}
+	chunks := make(map[object.Hash]*chunkRefs)
+	addManifest := func(data []byte, name string) error {
+		m, err := object.DecodeManifest(data)
+		if err != nil {
+			return fmt.Errorf("decode manifest %s: %w", name, err)
+		}
+
+		stats.Manifests++
+		for _, c := range m.Chunks {
+			stats.References++
+			stats.LogicalBytes += uint64(c.Size)
+			if cr, ok := chunks[c.Hash]; ok {
+				cr.refs++
+				continue
+			}
+			chunks[c.Hash] = &chunkRefs{size: c.Size, refs: 1}
+			stats.StoredBytes += uint64(c.Size)
+		}
+		return nil
+	}
+
+	loose, err := s.looseObjects()
+	if err != nil {
+		return ChunkStats{}, fmt.Errorf("scan objects: %w", err)
+	}
+	for _, h := range loose {
+		path := s.objectPath(h)
+		ok, err := s.isManifest(path)
+		if err != nil {
+			return ChunkStats{}, fmt.Errorf("scan objects: %w", err)
+		}
+		if !ok {
+			continue
+		}
+		data, err := s.fs.ReadFile(path)
+		if err != nil {
+			return ChunkStats{}, fmt.Errorf("scan objects: read manifest: %w", err)
+		}
+		if err := addManifest(data, path); err != nil {
+			return ChunkStats{}, fmt.Errorf("scan objects: %w", err)
+		}
+	}
+	err = s.scanPacked(uint64(len(object.MagicManifest)), func(e object.PackEntry, prefix []byte, read func() ([]byte, error)) error {
+		if string(prefix) != object.MagicManifest {
+			return nil
+		}
+		data, err := read()
+		if err != nil {
+			return err
+		}
+		return addManifest(data, e.Hash.String())
+	})
+	if err != nil {
+		return ChunkStats{}, fmt.Errorf("scan packs: %w", err)
+	}
+
+	stats.Chunks = len(chunks)
+	for h, cr := range chunks {
+		if cr.refs > 1 {
+			stats.Top = append(stats.Top, SharedChunk{Hash: h, Size: cr.size, Refs: cr.refs})
+		}
+	}
+	slices.SortFunc(stats.Top, func(a, b SharedChunk) int {
+		if c := cmp.Compare(b.Refs, a.Refs); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.Hash[:], b.Hash[:])
+	})
+	if len(stats.Top) > top {
+		stats.Top = stats.Top[:top]
+	}
+	return stats, nil
+}
+
+// isManifest reports whether the object file at path starts with the
+// manifest magic, without reading the rest of it.
+func (s *Store) isManifest(path string) (bool, error) {
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("open object: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only
+
+	magic := make([]byte, len(object.MagicManifest))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, fmt.Errorf("read object: %w", err)
+	}
+	return string(magic) == object.MagicManifest, nil
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+const (
+	eventsFile = "events"
+	// maxEventsSize is where the log rotates to eventsFile+".1", replacing
+	// the previous rotation, so it stays small without a cleanup job.
+	maxEventsSize = 1 << 20
+)
+
+// EventKind names a store mutation recorded in the event log.
+type EventKind string
+
+const (
+	EventRoot      EventKind = "root"     // a walk produced Hash and recorded its provenance
+	EventSnapshot  EventKind = "snapshot" // snapshot Hash was written
+	EventRef       EventKind = "ref"      // ref Name now points at Hash
+	EventRefDelete EventKind = "ref-delete"
+)
+
+// Event is one line of the event log.
+type Event struct {
+	Time time.Time
+	Kind EventKind
+	Hash object.Hash // zero for EventRefDelete
+	Name string      // the ref, for ref events
+}
+
+// appendEvent adds e to the event log. Each event is one short line written
+// with O_APPEND, so concurrent processes don't interleave within a line.
+func (s *Store) appendEvent(kind EventKind, h object.Hash, name string) error {
+	path := filepath.Join(s.root, eventsFile)
+	if info, err := s.fs.Stat(path); err == nil && info.Size() >= maxEventsSize {
+		if err := s.fs.Rename(path, path+".1"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("rotate event log: %w", err)
+		}
+	}
+
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\n", s.clock.Now().UTC().Format(time.RFC3339Nano), kind, h, name)
+	f, err := s.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open event log: %w", err)
+	}
+	_, writeErr := io.WriteString(f, line)
+	closeErr := f.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		return fmt.Errorf("append event: %w", err)
+	}
+	return nil
+}
+
+// ReadEvents returns the events logged at or after byte offset off, and the
+// offset to pass next time. Tailing processes poll it with the returned
+// offset; when the log has rotated below off, reading restarts from the
+// beginning of the new log, so a reader more than a rotation behind can miss
+// events. A line still being written is left for the next call.
+func (s *Store) ReadEvents(off int64) ([]Event, int64, error) {
+	f, err := s.fs.Open(filepath.Join(s.root, eventsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, off, fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, off, fmt.Errorf("stat event log: %w", err)
+	}
+	if off > info.Size() {
+		off = 0
+	}
+	data := make([]byte, info.Size()-off)
+	if _, err := f.ReadAt(data, off); err != nil && !errors.Is(err, io.EOF) {
+		return nil, off, fmt.Errorf("read event log: %w", err)
+	}
+
+	var events []Event
+	rest := data
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(rest[:i])
+		rest = rest[i+1:]
+		off += int64(i) + 1
+		if e, ok := parseEvent(line); ok {
+			events = append(events, e)
+		}
+	}
+	return events, off, nil
+}
+
+// parseEvent decodes one log line, rejecting lines from a torn write.
+func parseEvent(line string) (Event, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 4 {
+		return Event{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return Event{}, false
+	}
+	h, err := object.ParseHash(fields[2])
+	if err != nil {
+		return Event{}, false
+	}
+	return Event{Time: t, Kind: EventKind(fields[1]), Hash: h, Name: fields[3]}, true
+}
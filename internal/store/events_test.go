@@ -0,0 +1,150 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/vfs"
+)
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	clock := vfs.NewFakeClock(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	s, err := Open(t.TempDir(), WithClock(clock))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	events, off, err := s.ReadEvents(0)
+	if err != nil || len(events) != 0 || off != 0 {
+		t.Fatalf("ReadEvents() on a new store = %v, %d, %v", events, off, err)
+	}
+
+	root := object.HashBytes([]byte("root"))
+	if err := s.PutProvenance(&object.Provenance{Root: root, Time: clock.Now()}); err != nil {
+		t.Fatalf("PutProvenance() error = %v", err)
+	}
+	snap, err := s.PutSnapshot(&object.Snapshot{Root: root, Time: clock.Now()})
+	if err != nil {
+		t.Fatalf("PutSnapshot() error = %v", err)
+	}
+
+	events, off, err = s.ReadEvents(0)
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	want := []Event{
+		{Time: clock.Now(), Kind: EventRoot, Hash: root},
+		{Time: clock.Now(), Kind: EventSnapshot, Hash: snap},
+	}
+	assertEvents(t, events, want)
+
+	clock.Advance(time.Second)
+	if err := s.SetRef("HEAD", snap); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+	if err := s.DeleteRef("HEAD"); err != nil {
+		t.Fatalf("DeleteRef() error = %v", err)
+	}
+
+	// a reader resuming from off sees only the new events
+	events, _, err = s.ReadEvents(off)
+	if err != nil {
+		t.Fatalf("ReadEvents(%d) error = %v", off, err)
+	}
+	want = []Event{
+		{Time: clock.Now(), Kind: EventRef, Hash: snap, Name: "HEAD"},
+		{Time: clock.Now(), Kind: EventRefDelete, Name: "HEAD"},
+	}
+	assertEvents(t, events, want)
+}
+
+func TestReadEventsPartialLine(t *testing.T) {
+	t.Parallel()
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	h := object.HashBytes([]byte("a"))
+	if err := s.SetRef("a", h); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+	path := filepath.Join(s.Root(), eventsFile)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600) //nolint:gosec // test store
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if _, err := f.WriteString("2026-10-16T12:00:00Z\tref\t"); err != nil {
+		t.Fatalf("WriteString() error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	events, off, err := s.ReadEvents(0)
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("ReadEvents() = %v, want the one complete event", events)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if off >= info.Size() {
+		t.Errorf("offset = %d, want it before the partial line (size %d)", off, info.Size())
+	}
+}
+
+func TestEventsRotate(t *testing.T) {
+	t.Parallel()
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	path := filepath.Join(s.Root(), eventsFile)
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", maxEventsSize)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := s.SetRef("a", object.HashBytes([]byte("a"))); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("rotated log missing: %v", err)
+	}
+	// a reader past the end of the new log starts over
+	events, _, err := s.ReadEvents(maxEventsSize)
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Name != "a" {
+		t.Errorf("ReadEvents() after rotation = %v, want the ref event", events)
+	}
+}
+
+func assertEvents(t *testing.T, got, want []Event) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Kind != want[i].Kind ||
+			got[i].Hash != want[i].Hash || got[i].Name != want[i].Name {
+			t.Errorf("events[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// reachableFile records what the last GC found reachable.
+const reachableFile = "reachable"
+
+// GCOptions tunes GC.
+type GCOptions struct {
+	// Grace spares unreachable objects written more recently than this,
+	// such as those of a walk whose root isn't tagged yet in a process
+	// that doesn't lock the store. Packed objects go by their pack's age.
+	Grace  time.Duration
+	DryRun bool // count what would be removed without removing anything
+
+	// Retention, unless zero, first thins the history under every ref that
+	// names a snapshot, so what only the cut snapshots reach goes too. With
+	// DryRun the cut snapshots are counted but what they reach isn't.
+	Retention Retention
+}
+
+// GCResult describes what GC found.
+type GCResult struct {
+	Roots       int    // refs and pins
+	Reachable   int    // objects reachable from them
+	Removed     int    // unreachable objects removed, or that would be with DryRun
+	Bytes       uint64 // their size on disk
+	Recent      int    // unreachable objects spared by the grace period
+	Packs       int    // packs rewritten without their unreachable objects
+	Incremental bool   // only objects added since the last GC were read
+	Snapshots   int    // snapshots cut from histories by Retention
+}
+
+// GC removes the objects that no ref or pin reaches, along with the index
+// entries and provenance pointing at them. What it finds reachable is
+// recorded, and the next GC stops at those objects instead of reading
+// them again, as long as its refs and pins still reach the last one's:
+// moving a ref forward costs only the trees added since.
+func (s *Store) GC(opts GCOptions) (GCResult, error) {
+	if err := s.Commit(); err != nil {
+		return GCResult{}, err
+	}
+	if err := s.ensureIndex(); err != nil {
+		return GCResult{}, err
+	}
+
+	snapshots := 0
+	if !opts.Retention.IsZero() {
+		n, err := s.applyRetention(opts.Retention, opts.DryRun)
+		if err != nil {
+			return GCResult{}, err
+		}
+		snapshots = n
+	}
+	roots, err := s.gcRoots()
+	if err != nil {
+		return GCResult{}, err
+	}
+	live, incremental, err := s.reachable(roots)
+	if err != nil {
+		return GCResult{}, err
+	}
+	res := GCResult{Roots: len(roots), Reachable: len(live), Incremental: incremental, Snapshots: snapshots}
+	cutoff := s.clock.Now().Add(-opts.Grace)
+	removed := make(map[object.Hash]bool)
+
+	loose, err := s.looseObjects()
+	if err != nil {
+		return GCResult{}, err
+	}
+	for _, h := range loose {
+		if live[h] {
+			continue
+		}
+		info, err := s.fs.Stat(s.objectPath(h))
+		if err != nil {
+			return GCResult{}, fmt.Errorf("stat object: %w", err)
+		}
+		if info.ModTime().After(cutoff) {
+			res.Recent++
+			continue
+		}
+		if !opts.DryRun {
+			if err := s.fs.Remove(s.objectPath(h)); err != nil && !os.IsNotExist(err) {
+				return GCResult{}, fmt.Errorf("remove object: %w", err)
+			}
+		}
+		removed[h] = true
+		res.Bytes += uint64(info.Size()) //nolint:gosec // file sizes are never negative
+	}
+	if err := s.gcPacks(live, cutoff, opts.DryRun, &res, removed); err != nil {
+		return GCResult{}, err
+	}
+	res.Removed = len(removed)
+	if opts.DryRun {
+		return res, nil
+	}
+
+	s.pruneIndex("", func(_ string, r indexRecord) bool {
+		return !removed[r.hash]
+	})
+	for h := range removed {
+		err := s.fs.Remove(filepath.Join(s.root, provDir, h.String()))
+		if err != nil && !os.IsNotExist(err) {
+			return GCResult{}, fmt.Errorf("remove provenance: %w", err)
+		}
+	}
+	if err := s.writeReachable(roots, live); err != nil {
+		return GCResult{}, err
+	}
+	return res, nil
+}
+
+// gcRoots returns the hashes of every ref and pin, sorted and distinct.
+func (s *Store) gcRoots() ([]object.Hash, error) {
+	refs, err := s.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := s.Pins()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range refs {
+		roots = append(roots, r.Hash)
+	}
+	slices.SortFunc(roots, func(a, b object.Hash) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return slices.Compact(roots), nil
+}
+
+// reachable returns every object reachable from roots and whether the last
+// GC's record spared reading most of them. Marking stops at objects the
+// record holds; if that reaches every root the record started from, all
+// it holds is reachable too, and otherwise marking starts over without it.
+func (s *Store) reachable(roots []object.Hash) (map[object.Hash]bool, bool, error) {
+	last := s.readReachable()
+	if last != nil {
+		known := make(map[object.Hash]bool, len(last.Live))
+		for _, h := range last.Live {
+			known[h] = true
+		}
+		live, err := s.mark(roots, known)
+		if err != nil {
+			return nil, false, err
+		}
+		if !slices.ContainsFunc(last.Roots, func(h object.Hash) bool { return !live[h] }) {
+			maps.Copy(live, known)
+			return live, true, nil
+		}
+	}
+	live, err := s.mark(roots, nil)
+	return live, false, err
+}
+
+// mark returns the objects reachable from roots, not reading those in
+// known: they are taken to reach only objects in known.
+func (s *Store) mark(roots []object.Hash, known map[object.Hash]bool) (map[object.Hash]bool, error) {
+	live := make(map[object.Hash]bool)
+	stack := slices.Clone(roots)
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if h.IsZero() || live[h] {
+			continue
+		}
+		live[h] = true
+		if known[h] {
+			continue
+		}
+
+		magic, err := s.objectMagic(h)
+		if err != nil {
+			return nil, fmt.Errorf("mark %s: %w", h, err)
+		}
+		switch magic {
+		case object.MagicTree:
+			tree, err := s.GetTree(h)
+			if err != nil {
+				return nil, fmt.Errorf("mark %s: %w", h, err)
+			}
+			for _, e := range tree.Entries {
+				if e.Mode != object.ModeInaccessible {
+					stack = append(stack, e.Hash)
+				}
+			}
+		case object.MagicSnap:
+			snap, err := s.GetSnapshot(h)
+			if err != nil {
+				return nil, fmt.Errorf("mark %s: %w", h, err)
+			}
+			stack = append(stack, snap.Root, snap.Parent)
+		case object.MagicManifest:
+			m, err := s.GetManifest(h)
+			if err != nil {
+				return nil, fmt.Errorf("mark %s: %w", h, err)
+			}
+			for _, c := range m.Chunks {
+				stack = append(stack, c.Hash)
+			}
+		}
+	}
+	return live, nil
+}
+
+// objectMagic returns the magic h's object starts with, loose or packed.
+func (s *Store) objectMagic(h object.Hash) (string, error) {
+	magic, _, err := s.readMagic(s.objectPath(h))
+	if err == nil {
+		return string(magic), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	p, e, ok := s.findPacked(h)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrObjectMissing, h)
+	}
+	f, err := s.fs.Open(p.path)
+	if err != nil {
+		return "", fmt.Errorf("open pack: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only
+
+	prefix, err := p.readAt(f, e, uint64(len(object.MagicBlob)))
+	if err != nil {
+		return "", err
+	}
+	return string(prefix), nil
+}
+
+// gcPacks rewrites each pack holding unreachable objects without them, or
+// removes it if it holds nothing else.
+func (s *Store) gcPacks(live map[object.Hash]bool, cutoff time.Time, dryRun bool, res *GCResult, removed map[object.Hash]bool) error {
+	s.packsMu.RLock()
+	packs := slices.Clone(s.packs)
+	s.packsMu.RUnlock()
+
+	for _, p := range packs {
+		var keep []object.Hash
+		var dead []object.PackEntry
+		for _, e := range p.entries {
+			if live[e.Hash] {
+				keep = append(keep, e.Hash)
+			} else {
+				dead = append(dead, e)
+			}
+		}
+		if len(dead) == 0 {
+			continue
+		}
+		info, err := s.fs.Stat(p.path)
+		if err != nil {
+			return fmt.Errorf("stat pack: %w", err)
+		}
+		if info.ModTime().After(cutoff) {
+			res.Recent += len(dead)
+			continue
+		}
+
+		for _, e := range dead {
+			removed[e.Hash] = true
+			res.Bytes += e.Length
+		}
+		res.Packs++
+		if dryRun {
+			continue
+		}
+		if err := s.rewritePack(p, keep); err != nil {
+			return err
+		}
+	}
+	if dryRun || res.Packs == 0 {
+		return nil
+	}
+	return s.loadPacks()
+}
+
+// rewritePack replaces p with a pack of just keep, sorted, or with none if
+// keep is empty.
+func (s *Store) rewritePack(p *pack, keep []object.Hash) error {
+	if len(keep) > 0 {
+		f, err := s.fs.Open(p.path)
+		if err != nil {
+			return fmt.Errorf("open pack: %w", err)
+		}
+		dir := filepath.Dir(p.path)
+		entries, tmp, err := s.writePack(dir, keep, func(h object.Hash) ([]byte, error) {
+			e, _ := p.find(h)
+			return p.readAt(f, e, e.Length)
+		})
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+		if _, err := s.installPack(dir, tmp, entries); err != nil {
+			return err
+		}
+	}
+
+	// the index goes first, so a pack left without one is ignored
+	idx := strings.TrimSuffix(p.path, packExt) + packIndexExt
+	if err := s.fs.Remove(idx); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove pack index: %w", err)
+	}
+	if err := s.fs.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove pack: %w", err)
+	}
+	return nil
+}
+
+// readReachable returns the last GC's record, or nil if there is none or
+// it can't be read: the record only saves work.
+func (s *Store) readReachable() *object.Reachable {
+	data, err := s.fs.ReadFile(filepath.Join(s.root, reachableFile))
+	if err != nil {
+		return nil
+	}
+	rc, err := object.DecodeReachable(data)
+	if err != nil {
+		return nil
+	}
+	return rc
+}
+
+func (s *Store) writeReachable(roots []object.Hash, live map[object.Hash]bool) error {
+	rc := &object.Reachable{Roots: roots, Live: slices.Collect(maps.Keys(live))}
+	slices.SortFunc(rc.Live, func(a, b object.Hash) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	data, err := object.EncodeReachable(rc)
+	if err != nil {
+		return fmt.Errorf("encode reachable: %w", err)
+	}
+	return s.writeFileAtomic(filepath.Join(s.root, reachableFile), data)
+}
@@ -0,0 +1,344 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/vfs"
+)
+
+func TestGC(t *testing.T) {
+	t.Parallel()
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	blob := func(content string) object.Hash {
+		t.Helper()
+		h, err := s.PutBlob(&object.Blob{Content: []byte(content)})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		return h
+	}
+	tree := func(entries ...object.Entry) object.Hash {
+		t.Helper()
+		h, err := s.PutTree(&object.Tree{Entries: entries})
+		if err != nil {
+			t.Fatalf("PutTree() error = %v", err)
+		}
+		return h
+	}
+	snapshot := func(root, parent object.Hash) object.Hash {
+		t.Helper()
+		h, err := s.PutSnapshot(&object.Snapshot{Root: root, Parent: parent, Time: time.Unix(1700000000, 0)})
+		if err != nil {
+			t.Fatalf("PutSnapshot() error = %v", err)
+		}
+		return h
+	}
+	gc := func(opts GCOptions) GCResult {
+		t.Helper()
+		res, err := s.GC(opts)
+		if err != nil {
+			t.Fatalf("GC() error = %v", err)
+		}
+		return res
+	}
+
+	// a tagged tree with a chunked file and a subdirectory
+	chunks := []object.Chunk{{Hash: blob("c1"), Size: 2}, {Hash: blob("c2"), Size: 2}}
+	manifest, err := s.PutManifest(&object.Manifest{Chunks: chunks})
+	if err != nil {
+		t.Fatalf("PutManifest() error = %v", err)
+	}
+	sub := tree(object.Entry{Name: "a", Mode: object.ModeRegular, Size: 1, Hash: blob("a")})
+	tagged := tree(
+		object.Entry{Name: "big", Mode: object.ModeRegular, Size: 4, Hash: manifest},
+		object.Entry{Name: "sub", Mode: object.ModeDirectory, Hash: sub},
+	)
+	if err := s.SetRef("keep", tagged); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+
+	// history whose older root only its snapshot keeps
+	oldRoot := tree(object.Entry{Name: "b", Mode: object.ModeRegular, Size: 1, Hash: blob("b1")})
+	head := snapshot(tree(object.Entry{Name: "b", Mode: object.ModeRegular, Size: 1, Hash: blob("b2")}), snapshot(oldRoot, object.ZeroHash))
+	if err := s.SetRef("HEAD", head); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+
+	// a pinned tree no ref names
+	pinned := tree(object.Entry{Name: "p", Mode: object.ModeRegular, Size: 1, Hash: blob("p")})
+	if err := s.Pin(pinned); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+
+	// garbage, some of it packed alongside live objects
+	packedGarbage := tree(object.Entry{Name: "g", Mode: object.ModeRegular, Size: 2, Hash: blob("g1")})
+	if _, err := s.Repack(); err != nil {
+		t.Fatalf("Repack() error = %v", err)
+	}
+	looseGarbage := blob("g2")
+	s.UpdateCache("g2.txt", 2, time.Unix(1700000000, 0), looseGarbage)
+	garbage := []object.Hash{packedGarbage, blob("g1"), looseGarbage}
+
+	// nothing goes within the grace period, or on a dry run
+	if res := gc(GCOptions{Grace: time.Hour}); res.Removed != 0 || res.Recent != len(garbage) {
+		t.Errorf("GC() within grace = %+v, want %d recent and none removed", res, len(garbage))
+	}
+	if res := gc(GCOptions{DryRun: true}); res.Removed != len(garbage) || res.Packs != 1 {
+		t.Errorf("GC() dry run = %+v, want %d removed from 1 pack", res, len(garbage))
+	}
+	for _, h := range garbage {
+		if !s.HasObject(h) {
+			t.Fatalf("HasObject(%s) = false after a GC that shouldn't remove anything", h)
+		}
+	}
+
+	res := gc(GCOptions{})
+	if res.Removed != len(garbage) || res.Roots != 3 || res.Packs != 1 {
+		t.Errorf("GC() = %+v, want %d removed from 1 pack and 3 roots", res, len(garbage))
+	}
+	for _, h := range garbage {
+		if s.HasObject(h) {
+			t.Errorf("HasObject(%s) = true after GC, want removed", h)
+		}
+	}
+	for _, h := range []object.Hash{tagged, sub, manifest, chunks[1].Hash, head, oldRoot, blob("b1"), pinned} {
+		if !s.HasObject(h) {
+			t.Errorf("HasObject(%s) = false after GC, want kept", h)
+		}
+	}
+	if _, ok := s.LookupCache("g2.txt", 2, time.Unix(1700000000, 0)); ok {
+		t.Error("LookupCache() hit the hash of a removed object")
+	}
+
+	// moving HEAD forward reads only the new snapshot and its tree
+	next := snapshot(tree(), head)
+	if err := s.SetRef("HEAD", next); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+	if res := gc(GCOptions{}); !res.Incremental || res.Removed != 0 {
+		t.Errorf("GC() after moving HEAD = %+v, want incremental and nothing removed", res)
+	}
+
+	// dropping a ref and the pin needs a full pass
+	if err := s.DeleteRef("keep"); err != nil {
+		t.Fatalf("DeleteRef() error = %v", err)
+	}
+	if err := s.Unpin(pinned); err != nil {
+		t.Fatalf("Unpin() error = %v", err)
+	}
+	if res := gc(GCOptions{}); res.Incremental || res.Removed != 8 {
+		t.Errorf("GC() after dropping roots = %+v, want a full pass removing 8 objects", res)
+	}
+	if s.HasObject(tagged) || s.HasObject(pinned) || !s.HasObject(oldRoot) {
+		t.Error("GC() after dropping roots kept the wrong objects")
+	}
+}
+
+func TestPins(t *testing.T) {
+	t.Parallel()
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	h, err := s.PutBlob(&object.Blob{Content: []byte("pinned")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+
+	if err := s.Pin(object.HashBytes([]byte("absent"))); !errors.Is(err, ErrObjectMissing) {
+		t.Errorf("Pin(absent) error = %v, want ErrObjectMissing", err)
+	}
+	for range 2 {
+		if err := s.Pin(h); err != nil {
+			t.Fatalf("Pin() error = %v", err)
+		}
+	}
+	pins, err := s.Pins()
+	if err != nil || !slices.Equal(pins, []object.Hash{h}) {
+		t.Errorf("Pins() = %v, %v, want [%s]", pins, err, h)
+	}
+
+	if err := s.Unpin(h); err != nil {
+		t.Fatalf("Unpin() error = %v", err)
+	}
+	if err := s.Unpin(h); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("Unpin() twice error = %v, want ErrNotPinned", err)
+	}
+	if pins, err := s.Pins(); err != nil || len(pins) != 0 {
+		t.Errorf("Pins() after Unpin = %v, %v, want none", pins, err)
+	}
+}
+
+func TestRetentionKeep(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	// newest first: two today, one a day for three days, then one a week
+	ages := []time.Duration{0, time.Hour, 24 * time.Hour, 48 * time.Hour, 72 * time.Hour, 8 * 24 * time.Hour, 15 * 24 * time.Hour, 22 * 24 * time.Hour}
+	chain := make([]*object.Snapshot, len(ages))
+	for i, age := range ages {
+		chain[i] = &object.Snapshot{Time: now.Add(-age)}
+	}
+
+	tests := []struct {
+		name string
+		r    Retention
+		want []bool
+	}{
+		{name: "newest only", r: Retention{Last: 1}, want: []bool{true, false, false, false, false, false, false, false}},
+		{name: "last", r: Retention{Last: 3}, want: []bool{true, true, true, false, false, false, false, false}},
+		{name: "daily", r: Retention{Daily: 2}, want: []bool{true, false, true, false, false, false, false, false}},
+		// 2026-10-16 is a Friday: the first three days share its week
+		{name: "weekly", r: Retention{Weekly: 2}, want: []bool{true, false, false, false, false, true, false, false}},
+		{name: "combined", r: Retention{Last: 2, Daily: 3, Weekly: 4}, want: []bool{true, true, true, true, false, true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.r.keep(chain, now); !slices.Equal(got, tt.want) {
+				t.Errorf("keep() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCRetention(t *testing.T) {
+	t.Parallel()
+
+	// far enough ahead that every object is past the grace period
+	now := time.Date(2100, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, err := Open(t.TempDir(), WithClock(vfs.NewFakeClock(now)))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	var roots []object.Hash
+	head := object.ZeroHash
+	for i, age := range []time.Duration{10 * 24 * time.Hour, 48 * time.Hour, 24 * time.Hour, time.Hour, 0} {
+		content := []byte{byte('a' + i)}
+		blob, err := s.PutBlob(&object.Blob{Content: content})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		root, err := s.PutTree(&object.Tree{Entries: []object.Entry{{Name: "f", Mode: object.ModeRegular, Size: 1, Hash: blob}}})
+		if err != nil {
+			t.Fatalf("PutTree() error = %v", err)
+		}
+		roots = append(roots, root)
+		if head, err = s.PutSnapshot(&object.Snapshot{Root: root, Parent: head, Time: now.Add(-age)}); err != nil {
+			t.Fatalf("PutSnapshot() error = %v", err)
+		}
+	}
+	if err := s.SetRef("HEAD", head); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+	policy := Retention{Daily: 3}
+
+	res, err := s.GC(GCOptions{Retention: policy, DryRun: true})
+	if err != nil || res.Snapshots != 2 {
+		t.Fatalf("GC() dry run = %+v, %v, want 2 snapshots cut", res, err)
+	}
+	if got, _ := s.GetRef("HEAD"); got != head {
+		t.Errorf("GC() dry run moved HEAD to %s", got)
+	}
+
+	// the 10-day-old snapshot and the earlier one of today go
+	res, err = s.GC(GCOptions{Retention: policy})
+	if err != nil || res.Snapshots != 2 {
+		t.Fatalf("GC() = %+v, %v, want 2 snapshots cut", res, err)
+	}
+	newHead, err := s.GetRef("HEAD")
+	if err != nil {
+		t.Fatalf("GetRef() error = %v", err)
+	}
+	chain, err := s.history(newHead)
+	if err != nil {
+		t.Fatalf("history() error = %v", err)
+	}
+	var got []object.Hash
+	for _, snap := range chain {
+		got = append(got, snap.Root)
+	}
+	if want := []object.Hash{roots[4], roots[2], roots[1]}; !slices.Equal(got, want) {
+		t.Errorf("history roots after GC = %v, want %v", got, want)
+	}
+	if s.HasObject(roots[0]) || s.HasObject(roots[3]) {
+		t.Error("GC() kept the roots of cut snapshots")
+	}
+
+	if res, err := s.GC(GCOptions{Retention: policy}); err != nil || res.Snapshots != 0 || res.Removed != 0 {
+		t.Errorf("second GC() = %+v, %v, want nothing cut or removed", res, err)
+	}
+}
+
+func TestRetentionKeepsPinned(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2100, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, err := Open(t.TempDir(), WithClock(vfs.NewFakeClock(now)))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	// oldest first
+	var snaps []object.Hash
+	head := object.ZeroHash
+	for i := range 5 {
+		root, err := s.PutTree(&object.Tree{Entries: []object.Entry{{Name: string(rune('a' + i)), Mode: object.ModeRegular, Hash: object.ZeroHash}}})
+		if err != nil {
+			t.Fatalf("PutTree() error = %v", err)
+		}
+		if head, err = s.PutSnapshot(&object.Snapshot{Root: root, Parent: head, Time: now.Add(time.Duration(i-5) * time.Hour)}); err != nil {
+			t.Fatalf("PutSnapshot() error = %v", err)
+		}
+		snaps = append(snaps, head)
+	}
+	if err := s.SetRef("HEAD", head); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+	if err := s.Pin(snaps[1]); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+
+	// the pinned snapshot and the one below it stay as they were
+	n, err := s.ThinHistory("HEAD", Retention{Last: 1})
+	if err != nil || n != 2 {
+		t.Fatalf("ThinHistory() = %d, %v, want 2 snapshots cut", n, err)
+	}
+	newHead, err := s.GetRef("HEAD")
+	if err != nil {
+		t.Fatalf("GetRef() error = %v", err)
+	}
+	var got []object.Hash
+	for h := newHead; !h.IsZero(); {
+		snap, err := s.GetSnapshot(h)
+		if err != nil {
+			t.Fatalf("GetSnapshot() error = %v", err)
+		}
+		got = append(got, h)
+		h = snap.Parent
+	}
+	if len(got) != 3 || got[0] != newHead || got[1] != snaps[1] || got[2] != snaps[0] {
+		t.Errorf("history after ThinHistory() = %v, want the newest then %v", got, []object.Hash{snaps[1], snaps[0]})
+	}
+
+	if n, err := s.ThinHistory("HEAD", Retention{Last: 1}); err != nil || n != 0 {
+		t.Errorf("second ThinHistory() = %d, %v, want nothing cut", n, err)
+	}
+}
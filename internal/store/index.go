@@ -0,0 +1,142 @@
+package store
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// indexRecord is an index entry without its path, which pathIndex stores
+// split into an interned directory and base name.
+type indexRecord struct {
+	size int64
+	secs int64
+	nsec int32
+	hash object.Hash
+}
+
+func newIndexRecord(size int64, modTime time.Time, hash object.Hash) indexRecord {
+	return indexRecord{
+		size: size,
+		secs: modTime.Unix(),
+		nsec: int32(modTime.Nanosecond()), //nolint:gosec // Nanosecond() returns 0-999999999, always fits in int32
+		hash: hash,
+	}
+}
+
+// truncModTime rounds t down to a multiple of g since the Unix epoch, so
+// times read at different precisions compare equal. g should divide a
+// second or be a whole number of seconds; g <= 1ns leaves t exact.
+func truncModTime(t time.Time, g time.Duration) time.Time {
+	switch {
+	case g <= 1:
+		return t
+	case g < time.Second:
+		nsec := int64(t.Nanosecond())
+		return time.Unix(t.Unix(), nsec-nsec%int64(g)).UTC()
+	default:
+		secs, step := t.Unix(), int64(g/time.Second)
+		return time.Unix(secs-((secs%step)+step)%step, 0).UTC()
+	}
+}
+
+func (r indexRecord) matches(size int64, modTime time.Time) bool {
+	return r.size == size && r.secs == modTime.Unix() && int(r.nsec) == modTime.Nanosecond()
+}
+
+// pathIndex maps cache keys to index records. Deep trees repeat long
+// directory prefixes across millions of keys, so each directory is stored
+// once and base names are interned; a key costs about one record plus a
+// shared name.
+type pathIndex struct {
+	dirs  map[string]map[string]indexRecord // dir with trailing slash -> base name -> record
+	names map[string]string                 // interned base names
+	n     int
+}
+
+func newPathIndex() *pathIndex {
+	return &pathIndex{
+		dirs:  make(map[string]map[string]indexRecord),
+		names: make(map[string]string),
+	}
+}
+
+// splitKey splits key after its last slash, so dir+name == key.
+func splitKey(key string) (dir, name string) {
+	i := strings.LastIndexByte(key, '/') + 1
+	return key[:i], key[i:]
+}
+
+func (p *pathIndex) get(key string) (indexRecord, bool) {
+	dir, name := splitKey(key)
+	r, ok := p.dirs[dir][name]
+	return r, ok
+}
+
+func (p *pathIndex) set(key string, r indexRecord) {
+	dir, name := splitKey(key)
+	names, ok := p.dirs[dir]
+	if !ok {
+		// clone so the map doesn't pin the caller's full key
+		names = make(map[string]indexRecord)
+		p.dirs[strings.Clone(dir)] = names
+	}
+	if _, ok := names[name]; !ok {
+		names[p.intern(name)] = r
+		p.n++
+		return
+	}
+	names[name] = r
+}
+
+// prune removes every key with prefix that keep rejects and returns how
+// many it removed.
+func (p *pathIndex) prune(prefix string, keep func(key string, r indexRecord) bool) int {
+	removed := 0
+	for dir, names := range p.dirs {
+		if !strings.HasPrefix(dir, prefix) && !strings.HasPrefix(prefix, dir) {
+			continue
+		}
+		for name, r := range names {
+			if key := dir + name; strings.HasPrefix(key, prefix) && !keep(key, r) {
+				delete(names, name)
+				removed++
+			}
+		}
+		if len(names) == 0 {
+			delete(p.dirs, dir)
+		}
+	}
+	p.n -= removed
+	return removed
+}
+
+func (p *pathIndex) intern(name string) string {
+	if s, ok := p.names[name]; ok {
+		return s
+	}
+	s := strings.Clone(name)
+	p.names[s] = s
+	return s
+}
+
+func (p *pathIndex) len() int {
+	return p.n
+}
+
+// entries returns every record sorted by key, the order that lets the
+// index encoding share the most prefix bytes.
+func (p *pathIndex) entries() []object.IndexEntry {
+	entries := make([]object.IndexEntry, 0, p.n)
+	for dir, names := range p.dirs {
+		for name, r := range names {
+			entries = append(entries, r.entry(dir+name))
+		}
+	}
+	slices.SortFunc(entries, func(a, b object.IndexEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return entries
+}
@@ -0,0 +1,388 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/vfs"
+)
+
+func TestPathIndex(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{
+		"file.txt",
+		"src/main.go",
+		"src/pkg/main.go",
+		"/abs/root\x00src/main.go",
+		"/\x00top",
+		"dir/",
+	}
+
+	p := newPathIndex()
+	modTime := time.Unix(1700000000, 123)
+	for i, key := range keys {
+		p.set(key, newIndexRecord(int64(i), modTime, object.HashBytes([]byte(key))))
+	}
+	// overwriting must not count twice
+	p.set("src/main.go", newIndexRecord(99, modTime, object.HashBytes([]byte("src/main.go"))))
+
+	if got := p.len(); got != len(keys) {
+		t.Errorf("len() = %d, want %d", got, len(keys))
+	}
+	if r, ok := p.get("src/main.go"); !ok || r.size != 99 || !r.matches(99, modTime) {
+		t.Errorf("get(src/main.go) = %+v, %v; want overwritten record", r, ok)
+	}
+	if _, ok := p.get("main.go"); ok {
+		t.Error("get(main.go) found a record for a key that was never set")
+	}
+
+	entries := p.entries()
+	if len(entries) != len(keys) {
+		t.Fatalf("entries() returned %d entries, want %d", len(entries), len(keys))
+	}
+	for i, e := range entries {
+		if i > 0 && entries[i-1].Path >= e.Path {
+			t.Errorf("entries() not sorted: %q before %q", entries[i-1].Path, e.Path)
+		}
+		if e.Hash != object.HashBytes([]byte(e.Path)) || !e.ModTime.Equal(modTime) {
+			t.Errorf("entry %q does not round-trip: %+v", e.Path, e)
+		}
+	}
+}
+
+func TestIndexPersistence(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	modTime := time.Unix(1700000000, 0)
+	hash := object.HashBytes([]byte("content"))
+	for _, key := range []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "f.txt"} {
+		s.UpdateCache(key, 7, modTime, hash)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	for _, key := range []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "f.txt"} {
+		if got, ok := s.LookupCache(key, 7, modTime); !ok || got != hash {
+			t.Errorf("LookupCache(%q) = %s, %v; want %s, true", key, got, ok, hash)
+		}
+	}
+	if _, ok := s.LookupCache("a/b/c.txt", 7, modTime.Add(time.Nanosecond)); ok {
+		t.Error("LookupCache() hit with a different modification time")
+	}
+}
+
+func TestLazyIndex(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Unix(1700000000, 0)
+	hash := object.HashBytes([]byte("content"))
+
+	t.Run("loads on first lookup", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		s, err := Open(dir)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		s.UpdateCache("a.txt", 7, modTime, hash)
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		s, err = Open(dir, WithLazyIndex())
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer s.Close() //nolint:errcheck // Close() in a test
+		if got := s.index.len(); got != 0 {
+			t.Errorf("index entries before first lookup = %d, want 0", got)
+		}
+		if got, ok := s.LookupCache("a.txt", 7, modTime); !ok || got != hash {
+			t.Errorf("LookupCache() = %s, %v; want %s, true", got, ok, hash)
+		}
+	})
+
+	t.Run("corrupt index", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		corrupt := []byte("CORRUPTED DATA")
+		if err := os.WriteFile(filepath.Join(dir, indexFile), corrupt, 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+
+		s, err := Open(dir, WithLazyIndex())
+		if err != nil {
+			t.Fatalf("Open() error = %v, want lazy open to succeed", err)
+		}
+		h, err := s.PutBlob(&object.Blob{Content: []byte("content")})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		if _, err := s.GetBlob(h); err != nil {
+			t.Errorf("GetBlob() error = %v", err)
+		}
+
+		if _, ok := s.LookupCache("a.txt", 7, modTime); ok {
+			t.Error("LookupCache() hit with a corrupt index")
+		}
+		s.UpdateCache("a.txt", 7, modTime, hash)
+		if err := s.Close(); err == nil {
+			t.Error("Close() error = nil, want the index load error")
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, indexFile))
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if !bytes.Equal(data, corrupt) {
+			t.Error("Close() replaced an index it could not read")
+		}
+	})
+}
+
+func TestModTimeGranularity(t *testing.T) {
+	t.Parallel()
+
+	recorded := time.Unix(1700000000, 250_000_000)
+	hash := object.HashBytes([]byte("content"))
+	lookups := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{name: "exact", modTime: recorded},
+		{name: "other zone", modTime: recorded.In(time.FixedZone("UTC+1", 3600))},
+		{name: "whole seconds", modTime: recorded.Truncate(time.Second)},
+		{name: "next second", modTime: recorded.Add(time.Second)},
+		{name: "two seconds on", modTime: recorded.Add(2 * time.Second)},
+	}
+
+	tests := []struct {
+		granularity time.Duration
+		wantHits    []string
+	}{
+		{granularity: 0, wantHits: []string{"exact", "other zone"}},
+		{granularity: 100 * time.Millisecond, wantHits: []string{"exact", "other zone"}},
+		{granularity: time.Second, wantHits: []string{"exact", "other zone", "whole seconds"}},
+		{granularity: 2 * time.Second, wantHits: []string{"exact", "other zone", "whole seconds", "next second"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.granularity.String(), func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			clock := vfs.NewFakeClock(recorded.Add(time.Hour))
+			s, err := Open(dir, WithModTimeGranularity(tt.granularity), WithClock(clock))
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			s.UpdateCache("a.txt", 7, recorded, hash)
+			if err := s.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			// the granularity persists, so a plain Open compares the same way
+			s, err = Open(dir)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer s.Close() //nolint:errcheck // Close() in a test
+
+			for _, l := range lookups {
+				_, got := s.LookupCache("a.txt", 7, l.modTime)
+				if want := slices.Contains(tt.wantHits, l.name); got != want {
+					t.Errorf("LookupCache(%s) hit = %v, want %v", l.name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestModTimeGranularityRacilyClean(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Unix(1700000000, 0)
+	hash := object.HashBytes([]byte("content"))
+	clock := vfs.NewFakeClock(modTime.Add(time.Second))
+	s, err := Open(t.TempDir(), WithModTimeGranularity(2*time.Second), WithClock(clock))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	// still within the mtime's 2s tick, so another write could go unseen
+	s.UpdateCache("a.txt", 7, modTime, hash)
+	if _, ok := s.LookupCache("a.txt", 7, modTime); ok {
+		t.Error("LookupCache() hit for a file recorded within its mtime tick")
+	}
+
+	clock.Advance(time.Second)
+	s.UpdateCache("a.txt", 7, modTime, hash)
+	if got, ok := s.LookupCache("a.txt", 7, modTime); !ok || got != hash {
+		t.Errorf("LookupCache() = %s, %v after the tick; want %s, true", got, ok, hash)
+	}
+}
+
+func TestIndexJournal(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	modTime := time.Unix(1700000000, 0)
+	key := func(i int) string { return "dir/" + strconv.Itoa(i%26) + "/" + strconv.Itoa(i) }
+	open := func() *Store {
+		t.Helper()
+		s, err := Open(dir)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		return s
+	}
+	readIndex := func() []byte {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, indexFile))
+		if err != nil {
+			t.Fatalf("ReadFile(index) error = %v", err)
+		}
+		return data
+	}
+	journalExists := func() bool {
+		_, err := os.Stat(filepath.Join(dir, journalFile))
+		return err == nil
+	}
+
+	s := open()
+	for i := range minJournalIndex {
+		s.UpdateCache(key(i), int64(i), modTime, object.HashBytes([]byte(key(i))))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if journalExists() {
+		t.Fatal("first flush journaled instead of writing the index")
+	}
+	snapshot := readIndex()
+
+	// a small update is appended, leaving the index alone
+	updated := object.HashBytes([]byte("updated"))
+	s = open()
+	s.UpdateCache(key(1), 1, modTime, updated)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !journalExists() {
+		t.Fatal("small update did not append to the journal")
+	}
+	if !bytes.Equal(readIndex(), snapshot) {
+		t.Error("small update rewrote the index")
+	}
+
+	// a torn append is dropped on load and compacted away on the next flush
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("OpenFile(journal) error = %v", err)
+	}
+	if _, err := f.Write([]byte{0, 0, 1}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	_ = f.Close()
+
+	s = open()
+	if got, ok := s.LookupCache(key(1), 1, modTime); !ok || got != updated {
+		t.Errorf("LookupCache() after replay = %s, %v; want %s, true", got, ok, updated)
+	}
+	if got := s.index.len(); got != minJournalIndex {
+		t.Errorf("index entries = %d, want %d", got, minJournalIndex)
+	}
+	s.UpdateCache(key(2), 2, modTime, updated)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if journalExists() {
+		t.Error("flush after a torn journal did not compact")
+	}
+
+	// updating over half the index compacts too
+	s = open()
+	for i := range minJournalIndex/2 + 1 {
+		s.UpdateCache(key(i), int64(i), modTime.Add(time.Second), updated)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if journalExists() {
+		t.Error("large update journaled instead of compacting")
+	}
+
+	s = open()
+	defer s.Close() //nolint:errcheck // Close() in a test
+	if got, ok := s.LookupCache(key(0), 0, modTime.Add(time.Second)); !ok || got != updated {
+		t.Errorf("LookupCache() after compaction = %s, %v; want %s, true", got, ok, updated)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	modTime := time.Unix(1700000000, 0)
+	hash := object.HashBytes([]byte("content"))
+	keys := []string{"/a\x00keep.txt", "/a\x00gone.txt", "/a\x00sub/gone.txt", "/ab\x00other.txt", "plain.txt"}
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, key := range keys {
+		s.UpdateCache(key, 7, modTime, hash)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	removed, err := s.PruneCache("/a\x00", map[string]struct{}{"/a\x00keep.txt": {}})
+	if err != nil {
+		t.Fatalf("PruneCache() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("PruneCache() removed %d, want 2", removed)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+	for _, key := range keys {
+		_, ok := s.LookupCache(key, 7, modTime)
+		if want := !strings.Contains(key, "gone"); ok != want {
+			t.Errorf("LookupCache(%q) after reopening = %v, want %v", key, ok, want)
+		}
+	}
+	if got := s.index.len(); got != len(keys)-2 {
+		t.Errorf("index entries = %d, want %d", got, len(keys)-2)
+	}
+}
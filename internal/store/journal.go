@@ -0,0 +1,157 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// The index is kept as a full snapshot in indexFile plus journalFile, an
+// append-only log of the updates since. Flush appends one record of what
+// changed rather than rewriting millions of entries, and compacts the two
+// into a new snapshot once the journal grows past half the index.
+
+const journalFile = "index.journal"
+
+// minJournalIndex is the smallest index that is journaled; smaller ones are
+// rewritten whole on every flush, which costs about as much as appending.
+const minJournalIndex = 4096
+
+// loadIndex reads the snapshot, then replays the journal over it. A torn
+// final record, left by a crash mid-flush, is dropped and the next flush
+// compacts it away.
+func (s *Store) loadIndex() error {
+	idx := &object.Index{}
+	data, err := s.fs.ReadFile(filepath.Join(s.root, indexFile))
+	switch {
+	case err == nil:
+		if idx, err = object.DecodeIndex(data); err != nil {
+			return fmt.Errorf("decode index: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("read index: %w", err)
+	}
+
+	data, err = s.fs.ReadFile(filepath.Join(s.root, journalFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read index journal: %w", err)
+	}
+	journal, valid, err := object.DecodeIndexJournal(data)
+	if err != nil {
+		return fmt.Errorf("decode index journal: %w", err)
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	// records can be coarsened but not refined
+	s.granularity = max(s.granularity, idx.Granularity)
+	s.indexGranularity = idx.Granularity
+	for _, e := range idx.Entries {
+		s.index.set(e.Path, newIndexRecord(e.Size, truncModTime(e.ModTime, s.granularity), e.Hash))
+	}
+	for _, e := range journal {
+		s.index.set(e.Path, newIndexRecord(e.Size, truncModTime(e.ModTime, s.granularity), e.Hash))
+	}
+	s.journalEntries = len(journal)
+	s.journalTorn = valid < len(data)
+
+	return nil
+}
+
+// flushIndex writes the updates since the last flush, appending them to the
+// journal or compacting. Callers must hold indexMu.
+func (s *Store) flushIndex() error {
+	if len(s.unflushed) == 0 && !s.pruned {
+		return nil
+	}
+	if s.index.len() < minJournalIndex || s.journalTorn || s.pruned || s.granularity != s.indexGranularity ||
+		s.journalEntries+len(s.unflushed) > s.index.len()/2 {
+		return s.compactIndex()
+	}
+	return s.appendJournal()
+}
+
+// appendJournal writes the unflushed entries as one journal record. Callers
+// must hold indexMu.
+func (s *Store) appendJournal() error {
+	entries := make([]object.IndexEntry, 0, len(s.unflushed))
+	for key := range s.unflushed {
+		r, _ := s.index.get(key)
+		entries = append(entries, r.entry(key))
+	}
+	slices.SortFunc(entries, func(a, b object.IndexEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	rec, err := object.EncodeIndexJournalRecord(entries)
+	if err != nil {
+		return fmt.Errorf("encode index journal: %w", err)
+	}
+
+	path := filepath.Join(s.root, journalFile)
+	f, err := s.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open index journal: %w", err)
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size() == 0 {
+		var header []byte
+		if header, err = object.EncodeIndexJournalHeader(); err == nil {
+			rec = append(header, rec...)
+		}
+	}
+	if err == nil {
+		// one write, so a crash tears at most this record
+		_, err = f.Write(rec)
+	}
+	if err := errors.Join(err, f.Close()); err != nil {
+		return fmt.Errorf("append index journal: %w", err)
+	}
+
+	s.journalEntries += len(entries)
+	clear(s.unflushed)
+	return nil
+}
+
+// compactIndex writes the whole index as a new snapshot and empties the
+// journal. Callers must hold indexMu.
+func (s *Store) compactIndex() error {
+	data, err := object.EncodeIndex(&object.Index{Granularity: s.granularity, Entries: s.index.entries()})
+	if err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+
+	// The journal goes first: a crash before the snapshot lands then only
+	// loses cache entries, which costs a rehash, where replaying an old
+	// journal over a newer snapshot would bring back superseded records.
+	if err := s.fs.Remove(filepath.Join(s.root, journalFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove index journal: %w", err)
+	}
+	if err := s.writeFileAtomic(filepath.Join(s.root, indexFile), data); err != nil {
+		return fmt.Errorf("write index file: %w", err)
+	}
+
+	s.indexGranularity = s.granularity
+	s.journalEntries = 0
+	s.journalTorn = false
+	s.pruned = false
+	clear(s.unflushed)
+	return nil
+}
+
+// entry converts r back to an index entry for key.
+func (r indexRecord) entry(key string) object.IndexEntry {
+	return object.IndexEntry{
+		Path:    key,
+		Size:    r.size,
+		ModTime: time.Unix(r.secs, int64(r.nsec)).UTC(),
+		Hash:    r.hash,
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockFile is held open, with an advisory lock on it, for as long as a
+// locking store is open.
+const lockFile = "lock"
+
+// storeLockRetry is how often a waiting Open tries the lock again.
+const storeLockRetry = 50 * time.Millisecond
+
+var ErrStoreLocked = errors.New("store: locked by another process")
+
+// LockMode is how a store is locked against other processes while open.
+type LockMode int
+
+const (
+	// LockNone takes no lock, as before locking existed.
+	LockNone LockMode = iota
+	// LockShared lets other shared holders in but keeps exclusive ones out.
+	// Holders promise not to write the index; objects and refs are written
+	// atomically and may still be.
+	LockShared
+	// LockExclusive keeps every other locking process out, for stores that
+	// update the index.
+	LockExclusive
+)
+
+func (m LockMode) String() string {
+	switch m {
+	case LockNone:
+		return "none"
+	case LockShared:
+		return "shared"
+	case LockExclusive:
+		return "exclusive"
+	default:
+		return fmt.Sprintf("LockMode(%d)", int(m))
+	}
+}
+
+// WithLock locks the store's lock file in mode from Open until Close, so
+// two processes can't clobber each other's index. The lock is advisory:
+// only processes that also lock are kept out. Stores take no lock by
+// default.
+func WithLock(mode LockMode) Option {
+	return func(s *Store) {
+		s.lockMode = mode
+	}
+}
+
+// WithLockWait makes Open wait up to d for a conflicting lock to be
+// released instead of failing at once with ErrStoreLocked.
+func WithLockWait(d time.Duration) Option {
+	return func(s *Store) {
+		s.lockWait = max(d, 0)
+	}
+}
+
+// lock takes the lock WithLock asked for.
+func (s *Store) lock() error {
+	if s.lockMode == LockNone {
+		return nil
+	}
+	p := filepath.Join(s.root, lockFile)
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0o600) //nolint:gosec // path is within the store root
+	if err != nil {
+		return fmt.Errorf("open lock file: %w", err)
+	}
+
+	exclusive := s.lockMode == LockExclusive
+	deadline := s.clock.Now().Add(s.lockWait)
+	for {
+		ok, err := tryLockFile(f, exclusive)
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("lock %s: %w", p, err)
+		}
+		if ok {
+			s.lockHeld = f
+			return nil
+		}
+		if !s.clock.Now().Before(deadline) {
+			_ = f.Close()
+			return fmt.Errorf("%w: %s (%s lock)", ErrStoreLocked, s.root, s.lockMode)
+		}
+		time.Sleep(storeLockRetry)
+	}
+}
+
+// unlock releases the lock, if one is held. Closing the file drops it.
+func (s *Store) unlock() {
+	if s.lockHeld == nil {
+		return
+	}
+	_ = s.lockHeld.Close()
+	s.lockHeld = nil
+}
@@ -0,0 +1,102 @@
+//go:build unix || windows
+
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		held, want LockMode
+		wantLocked bool
+	}{
+		{name: "shared with shared", held: LockShared, want: LockShared},
+		{name: "exclusive with shared", held: LockShared, want: LockExclusive, wantLocked: true},
+		{name: "shared with exclusive", held: LockExclusive, want: LockShared, wantLocked: true},
+		{name: "exclusive with exclusive", held: LockExclusive, want: LockExclusive, wantLocked: true},
+		{name: "none with exclusive", held: LockExclusive, want: LockNone},
+		{name: "exclusive with none", held: LockNone, want: LockExclusive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			first, err := Open(root, WithLock(tt.held))
+			if err != nil {
+				t.Fatalf("Open(%s) error = %v", tt.held, err)
+			}
+			defer first.Close() //nolint:errcheck // Close() in a test
+
+			second, err := Open(root, WithLock(tt.want))
+			if tt.wantLocked {
+				if !errors.Is(err, ErrStoreLocked) {
+					t.Fatalf("Open(%s) error = %v, want ErrStoreLocked", tt.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open(%s) error = %v", tt.want, err)
+			}
+			if err := second.Close(); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLockReleasedOnClose(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	first, err := Open(root, WithLock(LockExclusive))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	second, err := Open(root, WithLock(LockExclusive))
+	if err != nil {
+		t.Fatalf("Open() after Close() error = %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	first, err := Open(root, WithLock(LockExclusive))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(released)
+		_ = first.Close()
+	}()
+
+	second, err := Open(root, WithLock(LockShared), WithLockWait(5*time.Second))
+	if err != nil {
+		t.Fatalf("Open() with wait error = %v", err)
+	}
+	defer second.Close() //nolint:errcheck // Close() in a test
+	select {
+	case <-released:
+	default:
+		t.Error("Open() returned before the lock was released")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package store
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// LockFileEx isn't in package syscall, and the store avoids x/sys for one call.
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// tryLockFile locks the first byte of f without blocking; ok is false if
+// another process holds a conflicting lock.
+func tryLockFile(f *os.File, exclusive bool) (ok bool, err error) {
+	flags := uintptr(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(&ol))) //nolint:gosec // the documented calling convention
+	if r != 0 {
+		return true, nil
+	}
+	if errors.Is(err, errorLockViolation) {
+		return false, nil
+	}
+	return false, err //nolint:wrapcheck // the caller adds the path
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// Object types as ObjectStats names them.
+const (
+	TypeBlob     = "blob"
+	TypeTree     = "tree"
+	TypeManifest = "manifest"
+	TypeSnapshot = "snapshot"
+	TypeUnknown  = "unknown"
+)
+
+// objectTypes maps the magic an object starts with to its type.
+var objectTypes = map[string]string{
+	object.MagicBlob:     TypeBlob,
+	object.MagicTree:     TypeTree,
+	object.MagicManifest: TypeManifest,
+	object.MagicSnap:     TypeSnapshot,
+}
+
+// TypeStats counts the objects of one type.
+type TypeStats struct {
+	Count int
+	Bytes uint64 // on disk, loose or packed
+}
+
+// ObjectSize is one object and the bytes it takes up.
+type ObjectSize struct {
+	Hash object.Hash
+	Type string
+	Size uint64
+}
+
+// ObjectStats breaks the store's objects down by type.
+type ObjectStats struct {
+	Types   map[string]TypeStats // by type
+	Largest []ObjectSize         // largest first
+}
+
+// ObjectStats scans every object for its type and size, reading only the
+// start of each, and reports up to top of the largest.
+func (s *Store) ObjectStats(top int) (ObjectStats, error) {
+	stats := ObjectStats{Types: make(map[string]TypeStats)}
+	add := func(h object.Hash, magic []byte, size uint64) {
+		typ, ok := objectTypes[string(magic)]
+		if !ok {
+			typ = TypeUnknown
+		}
+		t := stats.Types[typ]
+		t.Count++
+		t.Bytes += size
+		stats.Types[typ] = t
+
+		// keep the top largest, sorted largest first
+		o := ObjectSize{Hash: h, Type: typ, Size: size}
+		i, _ := slices.BinarySearchFunc(stats.Largest, o, compareObjectSize)
+		if i < top {
+			stats.Largest = slices.Insert(stats.Largest, i, o)
+			if len(stats.Largest) > top {
+				stats.Largest = stats.Largest[:top]
+			}
+		}
+	}
+
+	loose, err := s.looseObjects()
+	if err != nil {
+		return ObjectStats{}, fmt.Errorf("scan objects: %w", err)
+	}
+	for _, h := range loose {
+		magic, size, err := s.readMagic(s.objectPath(h))
+		if err != nil {
+			return ObjectStats{}, fmt.Errorf("scan objects: %w", err)
+		}
+		add(h, magic, size)
+	}
+	err = s.scanPacked(uint64(len(object.MagicBlob)), func(e object.PackEntry, prefix []byte, _ func() ([]byte, error)) error {
+		add(e.Hash, prefix, e.Length)
+		return nil
+	})
+	if err != nil {
+		return ObjectStats{}, fmt.Errorf("scan packs: %w", err)
+	}
+	return stats, nil
+}
+
+// compareObjectSize orders larger objects first, then by hash.
+func compareObjectSize(a, b ObjectSize) int {
+	if c := cmp.Compare(b.Size, a.Size); c != 0 {
+		return c
+	}
+	return bytes.Compare(a.Hash[:], b.Hash[:])
+}
+
+// readMagic returns the magic the object file at path starts with and the
+// file's size, without reading the rest of it.
+func (s *Store) readMagic(path string) (magic []byte, size uint64, err error) {
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open object: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("stat object: %w", err)
+	}
+	magic = make([]byte, len(object.MagicBlob))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, fmt.Errorf("read object: %w", err)
+		}
+		magic = nil // too short to be any object
+	}
+	return magic, uint64(info.Size()), nil //nolint:gosec // file sizes are never negative
+}
@@ -0,0 +1,349 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/vfs"
+)
+
+const (
+	packDir       = "packs"
+	packExt       = ".pack"
+	packIndexExt  = ".idx"
+	packHeaderLen = 6 // magic + version
+)
+
+// pack is an append-only file of concatenated encoded objects, located by
+// its index. The index is written last, so a pack without one is ignored.
+type pack struct {
+	path    string             // the .pack file
+	entries []object.PackEntry // sorted by hash
+}
+
+func (p *pack) find(h object.Hash) (object.PackEntry, bool) {
+	i, ok := slices.BinarySearchFunc(p.entries, h, func(e object.PackEntry, h object.Hash) int {
+		return bytes.Compare(e.Hash[:], h[:])
+	})
+	if !ok {
+		return object.PackEntry{}, false
+	}
+	return p.entries[i], true
+}
+
+// readAt reads n bytes of an object starting at its offset.
+func (p *pack) readAt(f io.ReaderAt, e object.PackEntry, n uint64) ([]byte, error) {
+	data := make([]byte, min(n, e.Length))
+	if _, err := f.ReadAt(data, int64(e.Offset)); err != nil { //nolint:gosec // offsets come from our own index
+		return nil, fmt.Errorf("read %s from pack: %w", e.Hash, err)
+	}
+	return data, nil
+}
+
+func (p *pack) read(fsys vfs.FS, e object.PackEntry) ([]byte, error) {
+	f, err := fsys.Open(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("open pack: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only
+
+	return p.readAt(f, e, e.Length)
+}
+
+// loadPacks replaces the known packs with those indexed in the packs
+// directory.
+func (s *Store) loadPacks() error {
+	dir := filepath.Join(s.root, packDir)
+	dirEntries, err := s.fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read pack directory: %w", err)
+	}
+
+	var packs []*pack
+	for _, de := range dirEntries {
+		name := de.Name()
+		if !strings.HasSuffix(name, packIndexExt) {
+			continue
+		}
+		data, err := s.fs.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("read pack index: %w", err)
+		}
+		idx, err := object.DecodePackIndex(data)
+		if err != nil {
+			return fmt.Errorf("decode pack index %s: %w", name, err)
+		}
+		packs = append(packs, &pack{
+			path:    filepath.Join(dir, strings.TrimSuffix(name, packIndexExt)+packExt),
+			entries: idx.Entries,
+		})
+	}
+
+	s.packsMu.Lock()
+	s.packs = packs
+	s.packsMu.Unlock()
+	return nil
+}
+
+// findPacked returns the pack holding h.
+func (s *Store) findPacked(h object.Hash) (*pack, object.PackEntry, bool) {
+	s.packsMu.RLock()
+	defer s.packsMu.RUnlock()
+
+	for _, p := range s.packs {
+		if e, ok := p.find(h); ok {
+			return p, e, true
+		}
+	}
+	return nil, object.PackEntry{}, false
+}
+
+// readPacked reads h from a pack, rescanning the pack directory once in case
+// another process repacked since Open.
+func (s *Store) readPacked(h object.Hash) ([]byte, bool, error) {
+	p, e, ok := s.findPacked(h)
+	if !ok {
+		if err := s.loadPacks(); err != nil {
+			return nil, false, err
+		}
+		if p, e, ok = s.findPacked(h); !ok {
+			return nil, false, nil
+		}
+	}
+	data, err := p.read(s.fs, e)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// packedBytes returns the bytes packed objects take up in their packs.
+func (s *Store) packedBytes() uint64 {
+	s.packsMu.RLock()
+	defer s.packsMu.RUnlock()
+
+	var n uint64
+	for _, p := range s.packs {
+		for _, e := range p.entries {
+			n += e.Length
+		}
+	}
+	return n
+}
+
+func (s *Store) packedCount() int {
+	s.packsMu.RLock()
+	defer s.packsMu.RUnlock()
+
+	n := 0
+	for _, p := range s.packs {
+		n += len(p.entries)
+	}
+	return n
+}
+
+// RepackResult describes the pack written by Repack.
+type RepackResult struct {
+	Pack    string // pack name; empty if there were no loose objects
+	Objects int
+	Bytes   uint64
+}
+
+// Repack moves every loose object into a new pack, so stores with millions
+// of small blobs hold a few large files instead. Loose objects are removed
+// only once the pack and its index are durable. Objects written by other
+// processes during a repack stay loose.
+func (s *Store) Repack() (RepackResult, error) {
+	if err := s.Commit(); err != nil {
+		return RepackResult{}, err
+	}
+
+	loose, err := s.looseObjects()
+	if err != nil {
+		return RepackResult{}, err
+	}
+	if len(loose) == 0 {
+		return RepackResult{}, nil
+	}
+
+	dir := filepath.Join(s.root, packDir)
+	if err := s.fs.MkdirAll(dir, 0o750); err != nil {
+		return RepackResult{}, fmt.Errorf("create pack directory: %w", err)
+	}
+
+	entries, tmp, err := s.writePack(dir, loose, func(h object.Hash) ([]byte, error) {
+		data, err := s.fs.ReadFile(s.objectPath(h))
+		if err != nil {
+			return nil, fmt.Errorf("read loose object: %w", err)
+		}
+		return data, nil
+	})
+	if err != nil {
+		return RepackResult{}, err
+	}
+	name, err := s.installPack(dir, tmp, entries)
+	if err != nil {
+		return RepackResult{}, err
+	}
+
+	s.packsMu.Lock()
+	s.packs = append(s.packs, &pack{path: filepath.Join(dir, name+packExt), entries: entries})
+	s.packsMu.Unlock()
+
+	res := RepackResult{Pack: name, Objects: len(entries)}
+	for _, e := range entries {
+		res.Bytes += e.Length
+		if err := s.fs.Remove(s.objectPath(e.Hash)); err != nil && !os.IsNotExist(err) {
+			return res, fmt.Errorf("remove packed object: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// looseObjects returns the hashes of all loose objects, sorted.
+func (s *Store) looseObjects() ([]object.Hash, error) {
+	root := filepath.Join(s.root, objectsDir)
+	shards, err := s.fs.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("read objects directory: %w", err)
+	}
+
+	var hashes []object.Hash
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		entries, err := s.fs.ReadDir(filepath.Join(root, shard.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read shard directory: %w", err)
+		}
+		for _, e := range entries {
+			h, err := object.ParseHash(shard.Name() + e.Name())
+			if err != nil {
+				continue // temp files
+			}
+			hashes = append(hashes, h)
+		}
+	}
+	slices.SortFunc(hashes, func(a, b object.Hash) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return hashes, nil
+}
+
+// installPack names the pack written to tmp after its index and writes the
+// index beside it, after which other processes can read from it.
+func (s *Store) installPack(dir, tmp string, entries []object.PackEntry) (string, error) {
+	idxData, err := object.EncodePackIndex(&object.PackIndex{Entries: entries})
+	if err != nil {
+		_ = s.fs.Remove(tmp)
+		return "", fmt.Errorf("encode pack index: %w", err)
+	}
+	name := "pack-" + object.HashBytes(idxData).String()
+	if err := s.fs.Rename(tmp, filepath.Join(dir, name+packExt)); err != nil {
+		_ = s.fs.Remove(tmp)
+		return "", fmt.Errorf("rename pack: %w", err)
+	}
+	if err := s.writeFileSync(filepath.Join(dir, name+packIndexExt), idxData); err != nil {
+		return "", err
+	}
+	if err := s.syncDir(dir); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// writePack writes hashes' objects, as read returns them, to a synced temp
+// file in dir.
+func (s *Store) writePack(dir string, hashes []object.Hash, read func(object.Hash) ([]byte, error)) ([]object.PackEntry, string, error) {
+	f, err := s.fs.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return nil, "", fmt.Errorf("create pack: %w", err)
+	}
+	tmp := f.Name()
+	fail := func(err error) ([]object.PackEntry, string, error) {
+		_ = f.Close()
+		_ = s.fs.Remove(tmp)
+		return nil, "", err
+	}
+
+	if err := object.WriteHeader(f, object.MagicPack); err != nil {
+		return fail(err) //nolint:wrapcheck // header errors already carry context
+	}
+
+	entries := make([]object.PackEntry, 0, len(hashes))
+	offset := uint64(packHeaderLen)
+	for _, h := range hashes {
+		data, err := read(h)
+		if err != nil {
+			return fail(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			return fail(fmt.Errorf("write pack: %w", err))
+		}
+		entries = append(entries, object.PackEntry{Hash: h, Offset: offset, Length: uint64(len(data))})
+		offset += uint64(len(data))
+	}
+
+	if err := f.Sync(); err != nil {
+		return fail(fmt.Errorf("sync pack: %w", err))
+	}
+	if err := f.Close(); err != nil {
+		_ = s.fs.Remove(tmp)
+		return nil, "", fmt.Errorf("close pack: %w", err)
+	}
+	return entries, tmp, nil
+}
+
+// writeFileSync writes data to path and fsyncs it.
+func (s *Store) writeFileSync(path string, data []byte) error {
+	f, err := s.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Base(path), err)
+	}
+	_, writeErr := f.Write(data)
+	syncErr := f.Sync()
+	closeErr := f.Close()
+	if err := errors.Join(writeErr, syncErr, closeErr); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// scanPacked calls fn with the leading n bytes of every packed object.
+func (s *Store) scanPacked(n uint64, fn func(e object.PackEntry, prefix []byte, read func() ([]byte, error)) error) error {
+	s.packsMu.RLock()
+	packs := slices.Clone(s.packs)
+	s.packsMu.RUnlock()
+
+	for _, p := range packs {
+		f, err := s.fs.Open(p.path)
+		if err != nil {
+			return fmt.Errorf("open pack: %w", err)
+		}
+		for _, e := range p.entries {
+			prefix, err := p.readAt(f, e, n)
+			if err == nil {
+				err = fn(e, prefix, func() ([]byte, error) { return p.readAt(f, e, e.Length) })
+			}
+			if err != nil {
+				_ = f.Close()
+				return err
+			}
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("close pack: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+func TestRepack(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	// opened before the repack, so it must rescan to find the pack
+	other, err := Open(dir, WithLazyIndex())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer other.Close() //nolint:errcheck // Close() in a test
+
+	const n = 100
+	hashes := make([]object.Hash, n)
+	for i := range n {
+		h, err := s.PutBlob(&object.Blob{Content: []byte{byte(i)}})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		hashes[i] = h
+	}
+	chunk := object.Chunk{Hash: hashes[0], Size: 1}
+	if _, err := s.PutManifest(&object.Manifest{Chunks: []object.Chunk{chunk, chunk}}); err != nil {
+		t.Fatalf("PutManifest() error = %v", err)
+	}
+
+	res, err := s.Repack()
+	if err != nil {
+		t.Fatalf("Repack() error = %v", err)
+	}
+	if res.Objects != n+1 || res.Pack == "" {
+		t.Errorf("Repack() = %+v, want %d objects in a named pack", res, n+1)
+	}
+	for _, ext := range []string{packExt, packIndexExt} {
+		if _, err := os.Stat(filepath.Join(dir, packDir, res.Pack+ext)); err != nil {
+			t.Errorf("Stat(%s) error = %v", res.Pack+ext, err)
+		}
+	}
+
+	for i, h := range hashes {
+		if _, err := os.Stat(s.objectPath(h)); !os.IsNotExist(err) {
+			t.Errorf("loose object %s still present: %v", h, err)
+		}
+		if !s.HasObject(h) {
+			t.Errorf("HasObject(%s) = false after repack", h)
+		}
+		for _, st := range []*Store{s, other} {
+			b, err := st.GetBlob(h)
+			if err != nil {
+				t.Fatalf("GetBlob() error = %v", err)
+			}
+			if len(b.Content) != 1 || b.Content[0] != byte(i) {
+				t.Errorf("GetBlob(%s) = %v, want [%d]", h, b.Content, i)
+			}
+		}
+	}
+	if got := s.Stats().ObjectCount; got != n+1 {
+		t.Errorf("Stats().ObjectCount = %d, want %d", got, n+1)
+	}
+	if cs, err := s.ChunkStats(0); err != nil || cs.Manifests != 1 || cs.References != 2 {
+		t.Errorf("ChunkStats() = %+v, %v; want the packed manifest", cs, err)
+	}
+
+	if _, err := s.GetBlob(object.HashBytes([]byte("missing"))); !os.IsNotExist(err) {
+		t.Errorf("GetBlob(missing) error = %v, want not exist", err)
+	}
+
+	if res, err := s.Repack(); err != nil || res.Objects != 0 {
+		t.Errorf("Repack() with no loose objects = %+v, %v; want nothing packed", res, err)
+	}
+
+	// a reopened store loads both packs
+	if _, err := s.PutBlob(&object.Blob{Content: []byte("late")}); err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	if res, err := s.Repack(); err != nil || res.Objects != 1 {
+		t.Errorf("second Repack() = %+v, %v; want 1 object", res, err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close() //nolint:errcheck // Close() in a test
+	if got := reopened.Stats().ObjectCount; got != n+2 {
+		t.Errorf("reopened Stats().ObjectCount = %d, want %d", got, n+2)
+	}
+}
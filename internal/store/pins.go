@@ -0,0 +1,73 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+const pinsDir = "pins"
+
+var (
+	ErrNotPinned     = errors.New("store: not pinned")
+	ErrObjectMissing = errors.New("store: object not in store")
+)
+
+func (s *Store) pinPath(h object.Hash) string {
+	return filepath.Join(s.root, pinsDir, h.String())
+}
+
+// Pin keeps h and everything it references from being collected by GC,
+// whether or not a ref names it. Pinning twice is the same as once.
+func (s *Store) Pin(h object.Hash) error {
+	if !s.HasObject(h) {
+		return fmt.Errorf("%w: %s", ErrObjectMissing, h)
+	}
+	dir := filepath.Join(s.root, pinsDir)
+	if err := s.fs.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create pins directory: %w", err)
+	}
+	return s.writeFileAtomic(s.pinPath(h), nil)
+}
+
+// Unpin lets GC collect h again once nothing else keeps it.
+func (s *Store) Unpin(h object.Hash) error {
+	err := s.fs.Remove(s.pinPath(h))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotPinned, h)
+	}
+	if err != nil {
+		return fmt.Errorf("unpin %s: %w", h, err)
+	}
+	return nil
+}
+
+// Pins returns every pinned hash, sorted.
+func (s *Store) Pins() ([]object.Hash, error) {
+	dirEntries, err := s.fs.ReadDir(filepath.Join(s.root, pinsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read pins directory: %w", err)
+	}
+
+	pins := make([]object.Hash, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		h, err := object.ParseHash(de.Name())
+		if err != nil {
+			continue // temp files from an interrupted write
+		}
+		pins = append(pins, h)
+	}
+	slices.SortFunc(pins, func(a, b object.Hash) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return pins, nil
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+const (
+	refsDir = "refs"
+
+	// refLockSuffix names the lock file beside a ref while it is updated;
+	// ref names can't end in it.
+	refLockSuffix  = ".lock"
+	refLockTimeout = 5 * time.Second
+	refLockRetry   = 10 * time.Millisecond
+)
+
+var (
+	ErrInvalidRefName = errors.New("store: invalid ref name")
+	ErrRefNotFound    = errors.New("store: ref not found")
+	ErrRefLocked      = errors.New("store: ref is locked")
+	ErrRefConflict    = errors.New("store: ref does not hold the expected hash")
+)
+
+// Ref is a name for a root hash, such as a tagged snapshot.
+type Ref struct {
+	Name string
+	Hash object.Hash
+}
+
+// ValidateRefName reports whether name can be used as a ref. Names are
+// slash-separated components of letters, digits, '.', '_' and '-'; no
+// component may start with '.' or end in ".lock", and a name that parses as a hash is
+// rejected so the two can't be confused.
+func ValidateRefName(name string) error {
+	if _, err := object.ParseHash(name); err == nil {
+		return fmt.Errorf("%w %q: looks like a hash", ErrInvalidRefName, name)
+	}
+	for part := range strings.SplitSeq(name, "/") {
+		if part == "" || part[0] == '.' || strings.HasSuffix(part, refLockSuffix) {
+			return fmt.Errorf("%w %q", ErrInvalidRefName, name)
+		}
+		for _, r := range part {
+			if !isRefRune(r) {
+				return fmt.Errorf("%w %q: character %q", ErrInvalidRefName, name, r)
+			}
+		}
+	}
+	return nil
+}
+
+func isRefRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '.' || r == '_' || r == '-'
+}
+
+func (s *Store) refPath(name string) string {
+	return filepath.Join(s.root, refsDir, filepath.FromSlash(name))
+}
+
+// SetRef points name at h, replacing any earlier target atomically.
+func (s *Store) SetRef(name string, h object.Hash) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	unlock, err := s.lockRef(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.writeRef(name, h)
+}
+
+// CompareAndSwapRef points name at h only if it currently points at old, or
+// doesn't exist when old is the zero hash, so concurrent writers can't
+// silently overwrite each other. It fails with ErrRefConflict otherwise.
+func (s *Store) CompareAndSwapRef(name string, old, h object.Hash) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	unlock, err := s.lockRef(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cur, err := s.GetRef(name)
+	switch {
+	case errors.Is(err, ErrRefNotFound):
+		if !old.IsZero() {
+			return fmt.Errorf("%w: %s does not exist, expected %s", ErrRefConflict, name, old)
+		}
+	case err != nil:
+		return err
+	case cur != old:
+		return fmt.Errorf("%w: %s is %s, expected %s", ErrRefConflict, name, cur, old)
+	}
+	return s.writeRef(name, h)
+}
+
+// writeRef writes name under its lock and logs the update.
+func (s *Store) writeRef(name string, h object.Hash) error {
+	if err := s.writeFileAtomic(s.refPath(name), []byte(h.String()+"\n")); err != nil {
+		return err
+	}
+	return s.appendEvent(EventRef, h, name)
+}
+
+// lockRef creates name's lock file, waiting up to refLockTimeout for another
+// writer to release it, and returns the function that removes it. A lock
+// left behind by a crashed process has to be removed by hand.
+func (s *Store) lockRef(name string) (func(), error) {
+	p := s.refPath(name) + refLockSuffix
+	if err := s.fs.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return nil, fmt.Errorf("create refs directory: %w", err)
+	}
+
+	deadline := s.clock.Now().Add(refLockTimeout)
+	for {
+		f, err := s.fs.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = s.fs.Remove(p) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("lock ref %s: %w", name, err)
+		}
+		if s.clock.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s (remove %s if no other smerkle is running)", ErrRefLocked, name, p)
+		}
+		time.Sleep(refLockRetry)
+	}
+}
+
+// GetRef returns the hash name points at.
+func (s *Store) GetRef(name string) (object.Hash, error) {
+	if err := ValidateRefName(name); err != nil {
+		return object.ZeroHash, err
+	}
+	data, err := s.fs.ReadFile(s.refPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return object.ZeroHash, fmt.Errorf("%w: %s", ErrRefNotFound, name)
+	}
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("read ref %s: %w", name, err)
+	}
+	h, err := object.ParseHash(strings.TrimSpace(string(data)))
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("ref %s: %w", name, err)
+	}
+	return h, nil
+}
+
+// DeleteRef removes name.
+func (s *Store) DeleteRef(name string) error {
+	if err := ValidateRefName(name); err != nil {
+		return err
+	}
+	unlock, err := s.lockRef(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = s.fs.Remove(s.refPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrRefNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("delete ref %s: %w", name, err)
+	}
+	return s.appendEvent(EventRefDelete, object.ZeroHash, name)
+}
+
+// ListRefs returns every ref, sorted by name.
+func (s *Store) ListRefs() ([]Ref, error) {
+	root := filepath.Join(s.root, refsDir)
+	var refs []Ref
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return fmt.Errorf("ref path: %w", err)
+		}
+		name := filepath.ToSlash(rel)
+		if ValidateRefName(name) != nil {
+			return nil // lock and temp files from an in-flight or interrupted write
+		}
+		h, err := s.GetRef(name)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, Ref{Name: name, Hash: h})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list refs: %w", err)
+	}
+
+	slices.SortFunc(refs, func(a, b Ref) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return refs, nil
+}
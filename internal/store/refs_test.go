@@ -0,0 +1,245 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/vfs"
+)
+
+func TestValidateRefName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "baseline"},
+		{name: "release/v1.2.0"},
+		{name: "nightly_2026-10-16"},
+		{name: "", wantErr: true},
+		{name: "a//b", wantErr: true},
+		{name: "/abs", wantErr: true},
+		{name: "trailing/", wantErr: true},
+		{name: "../escape", wantErr: true},
+		{name: ".hidden", wantErr: true},
+		{name: "has space", wantErr: true},
+		{name: "baseline.lock", wantErr: true},
+		{name: "release.lock/v1", wantErr: true},
+		{name: object.HashBytes([]byte("x")).String(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateRefName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateRefName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRefName) {
+				t.Errorf("ValidateRefName(%q) error = %v, want ErrInvalidRefName", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestRefs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	refs, err := store.ListRefs()
+	if err != nil {
+		t.Fatalf("ListRefs() error = %v", err)
+	}
+	if len(refs) != 0 {
+		t.Errorf("ListRefs() on a new store = %v, want none", refs)
+	}
+
+	a, b := object.HashBytes([]byte("a")), object.HashBytes([]byte("b"))
+	for name, h := range map[string]object.Hash{"baseline": a, "release/v1": a} {
+		if err := store.SetRef(name, h); err != nil {
+			t.Fatalf("SetRef(%s) error = %v", name, err)
+		}
+	}
+	if err := store.SetRef("baseline", b); err != nil {
+		t.Fatalf("SetRef(baseline) error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close() //nolint:errcheck // Close() in a test
+
+	if got, err := reopened.GetRef("baseline"); err != nil || got != b {
+		t.Errorf("GetRef(baseline) = %s, %v, want %s", got, err, b)
+	}
+
+	refs, err = reopened.ListRefs()
+	if err != nil {
+		t.Fatalf("ListRefs() error = %v", err)
+	}
+	want := []Ref{{Name: "baseline", Hash: b}, {Name: "release/v1", Hash: a}}
+	if len(refs) != len(want) {
+		t.Fatalf("ListRefs() = %v, want %v", refs, want)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("ListRefs()[%d] = %v, want %v", i, refs[i], want[i])
+		}
+	}
+
+	if err := reopened.DeleteRef("baseline"); err != nil {
+		t.Fatalf("DeleteRef() error = %v", err)
+	}
+	if _, err := reopened.GetRef("baseline"); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("GetRef() after delete error = %v, want ErrRefNotFound", err)
+	}
+	if err := reopened.DeleteRef("baseline"); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("DeleteRef() twice error = %v, want ErrRefNotFound", err)
+	}
+}
+
+func TestCompareAndSwapRef(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	a, b := object.HashBytes([]byte("a")), object.HashBytes([]byte("b"))
+
+	if err := store.CompareAndSwapRef("baseline", a, b); !errors.Is(err, ErrRefConflict) {
+		t.Errorf("CompareAndSwapRef() of a missing ref error = %v, want ErrRefConflict", err)
+	}
+	if err := store.CompareAndSwapRef("baseline", object.ZeroHash, a); err != nil {
+		t.Fatalf("CompareAndSwapRef(zero) error = %v", err)
+	}
+	if err := store.CompareAndSwapRef("baseline", object.ZeroHash, b); !errors.Is(err, ErrRefConflict) {
+		t.Errorf("CompareAndSwapRef(zero) of an existing ref error = %v, want ErrRefConflict", err)
+	}
+	if err := store.CompareAndSwapRef("baseline", b, b); !errors.Is(err, ErrRefConflict) {
+		t.Errorf("CompareAndSwapRef() with a stale hash error = %v, want ErrRefConflict", err)
+	}
+	if err := store.CompareAndSwapRef("baseline", a, b); err != nil {
+		t.Fatalf("CompareAndSwapRef() error = %v", err)
+	}
+	if got, err := store.GetRef("baseline"); err != nil || got != b {
+		t.Errorf("GetRef() = %s, %v, want %s", got, err, b)
+	}
+}
+
+func TestCompareAndSwapRefConcurrent(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	base := object.HashBytes([]byte("base"))
+	if err := store.SetRef("baseline", base); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+
+	const writers = 8
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Go(func() {
+			err := store.CompareAndSwapRef("baseline", base, object.HashBytes([]byte{byte(i)}))
+			switch {
+			case err == nil:
+				wins.Add(1)
+			case !errors.Is(err, ErrRefConflict):
+				t.Errorf("CompareAndSwapRef() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Errorf("%d writers succeeded, want 1", wins.Load())
+	}
+}
+
+func TestRefLock(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	unlock, err := store.lockRef("baseline")
+	if err != nil {
+		t.Fatalf("lockRef() error = %v", err)
+	}
+	if refs, err := store.ListRefs(); err != nil || len(refs) != 0 {
+		t.Errorf("ListRefs() while locked = %v, %v, want none", refs, err)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(released)
+		unlock()
+	}()
+
+	h := object.HashBytes([]byte("a"))
+	if err := store.SetRef("baseline", h); err != nil {
+		t.Fatalf("SetRef() error = %v", err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("SetRef() returned while the ref was locked")
+	}
+	if _, err := os.Stat(store.refPath("baseline") + refLockSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestRefLockTimeout(t *testing.T) {
+	t.Parallel()
+
+	clock := vfs.NewFakeClock(time.Unix(0, 0))
+	fsys := &vfs.FaultFS{FS: vfs.OS{}, Inject: func(op vfs.Op, name string) error {
+		if op == vfs.OpOpen && strings.HasSuffix(name, refLockSuffix) {
+			clock.Advance(refLockTimeout) // each attempt takes "long"
+		}
+		return nil
+	}}
+	store, err := Open(t.TempDir(), WithFS(fsys), WithClock(clock))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	// a lock left behind by a crashed writer
+	if _, err := store.lockRef("baseline"); err != nil {
+		t.Fatalf("lockRef() error = %v", err)
+	}
+	if err := store.SetRef("baseline", object.HashBytes([]byte("a"))); !errors.Is(err, ErrRefLocked) {
+		t.Errorf("SetRef() error = %v, want ErrRefLocked", err)
+	}
+}
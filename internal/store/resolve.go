@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+var (
+	ErrInvalidPath  = errors.New("store: invalid path")
+	ErrPathNotFound = errors.New("store: path not in tree")
+)
+
+// ResolvePath returns the entry at the slash-separated path p below the tree
+// root, reading only the trees along the way. An empty p, or ".", names root
+// itself, returned as a directory entry with no name.
+func (s *Store) ResolvePath(root object.Hash, p string) (object.Entry, error) {
+	c := path.Clean(p)
+	if p == "" || c == "." {
+		return object.Entry{Mode: object.ModeDirectory, Hash: root}, nil
+	}
+	if c == ".." || strings.HasPrefix(c, "../") || path.IsAbs(c) {
+		return object.Entry{}, fmt.Errorf("%w: %q", ErrInvalidPath, p)
+	}
+
+	entry := object.Entry{Mode: object.ModeDirectory, Hash: root}
+	walked := ""
+	for name := range strings.SplitSeq(c, "/") {
+		if entry.Mode != object.ModeDirectory {
+			return object.Entry{}, fmt.Errorf("%w: %s is not a directory", ErrPathNotFound, walked)
+		}
+		tree, err := s.GetTree(entry.Hash)
+		if err != nil {
+			return object.Entry{}, fmt.Errorf("get tree %s: %w", entry.Hash, err)
+		}
+		walked = path.Join(walked, name)
+		i, ok := slices.BinarySearchFunc(tree.Entries, name, func(e object.Entry, name string) int {
+			return object.CompareNames(e.Name, name)
+		})
+		if !ok {
+			return object.Entry{}, fmt.Errorf("%w: %s", ErrPathNotFound, walked)
+		}
+		entry = tree.Entries[i]
+	}
+	return entry, nil
+}
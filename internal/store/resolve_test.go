@@ -0,0 +1,71 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+func TestResolvePath(t *testing.T) {
+	t.Parallel()
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	put := func(tree *object.Tree) object.Hash {
+		t.Helper()
+		h, err := s.PutTree(tree)
+		if err != nil {
+			t.Fatalf("PutTree() error = %v", err)
+		}
+		return h
+	}
+	file := object.Entry{Name: "main.go", Mode: object.ModeRegular, Size: 4, Hash: object.HashBytes([]byte("main"))}
+	util := put(&object.Tree{Entries: []object.Entry{{Name: "util.go", Mode: object.ModeRegular, Size: 4, Hash: object.HashBytes([]byte("util"))}}})
+	src := put(&object.Tree{Entries: []object.Entry{file, {Name: "util", Mode: object.ModeDirectory, Hash: util}}})
+	root := put(&object.Tree{Entries: []object.Entry{
+		{Name: "a.txt", Mode: object.ModeRegular, Size: 1, Hash: object.HashBytes([]byte("a"))},
+		{Name: "src", Mode: object.ModeDirectory, Hash: src},
+	}})
+
+	tests := []struct {
+		path     string
+		wantHash object.Hash
+		wantMode object.Mode
+		wantErr  error
+	}{
+		{path: "", wantHash: root, wantMode: object.ModeDirectory},
+		{path: ".", wantHash: root, wantMode: object.ModeDirectory},
+		{path: "src", wantHash: src, wantMode: object.ModeDirectory},
+		{path: "src/util/", wantHash: util, wantMode: object.ModeDirectory},
+		{path: "src/main.go", wantHash: file.Hash, wantMode: object.ModeRegular},
+		{path: "./src/../src/main.go", wantHash: file.Hash, wantMode: object.ModeRegular},
+		{path: "src/missing", wantErr: ErrPathNotFound},
+		{path: "src/main.go/x", wantErr: ErrPathNotFound},
+		{path: "../src", wantErr: ErrInvalidPath},
+		{path: "/src", wantErr: ErrInvalidPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			e, err := s.ResolvePath(root, tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolvePath(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolvePath(%q) error = %v", tt.path, err)
+			}
+			if e.Hash != tt.wantHash || e.Mode != tt.wantMode {
+				t.Errorf("ResolvePath(%q) = %s %s, want %s %s", tt.path, e.Mode, e.Hash, tt.wantMode, tt.wantHash)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// Retention says which snapshots of a history GC keeps, so automated
+// snapshotting doesn't grow the store without bound. A snapshot is kept if
+// any rule keeps it, and the newest always is, as are pinned snapshots and
+// everything older than them; the rest are cut from the chain, which is
+// rewritten around them. The zero Retention keeps every snapshot.
+type Retention struct {
+	Last   int // the most recent snapshots
+	Daily  int // the newest snapshot of each day, for this many days back
+	Weekly int // the newest snapshot of each ISO week, for this many weeks back
+}
+
+// IsZero reports whether r keeps every snapshot.
+func (r Retention) IsZero() bool {
+	return r.Last <= 0 && r.Daily <= 0 && r.Weekly <= 0
+}
+
+// keep reports which snapshots of a history, newest first, r keeps at now.
+// Days and weeks are counted in UTC.
+func (r Retention) keep(chain []*object.Snapshot, now time.Time) []bool {
+	keep := make([]bool, len(chain))
+	days := make(map[string]bool)
+	weeks := make(map[[2]int]bool)
+	dayCutoff := now.AddDate(0, 0, -r.Daily)
+	weekCutoff := now.AddDate(0, 0, -7*r.Weekly)
+	for i, snap := range chain {
+		t := snap.Time.UTC()
+		if i == 0 || i < r.Last {
+			keep[i] = true
+		}
+		if r.Daily > 0 && t.After(dayCutoff) {
+			if day := t.Format(time.DateOnly); !days[day] {
+				days[day] = true
+				keep[i] = true
+			}
+		}
+		if r.Weekly > 0 && t.After(weekCutoff) {
+			year, week := t.ISOWeek()
+			if !weeks[[2]int{year, week}] {
+				weeks[[2]int{year, week}] = true
+				keep[i] = true
+			}
+		}
+	}
+	return keep
+}
+
+// applyRetention thins the history under every ref that names a snapshot,
+// moving the ref to the rewritten chain, and returns how many snapshots
+// were cut. With dryRun it only counts them.
+func (s *Store) applyRetention(r Retention, dryRun bool) (int, error) {
+	refs, err := s.ListRefs()
+	if err != nil {
+		return 0, err
+	}
+
+	dropped := 0
+	for _, ref := range refs {
+		magic, err := s.objectMagic(ref.Hash)
+		if err != nil {
+			return 0, fmt.Errorf("ref %s: %w", ref.Name, err)
+		}
+		if magic != object.MagicSnap {
+			continue
+		}
+		n, err := s.thinHistory(ref.Name, ref.Hash, r, dryRun)
+		if err != nil {
+			return 0, err
+		}
+		dropped += n
+	}
+	return dropped, nil
+}
+
+// ThinHistory applies r to the history under the ref name alone, as GC
+// would, and returns how many snapshots were cut. Cut snapshots stay in the
+// store until GC finds them unreachable.
+func (s *Store) ThinHistory(name string, r Retention) (int, error) {
+	head, err := s.GetRef(name)
+	if err != nil {
+		return 0, err
+	}
+	return s.thinHistory(name, head, r, false)
+}
+
+// thinHistory cuts the snapshots r drops from the history at head, moving
+// the ref name from head to the rewritten chain, and returns how many it
+// cut. With dryRun it only counts them.
+func (s *Store) thinHistory(name string, head object.Hash, r Retention, dryRun bool) (int, error) {
+	chain, err := s.history(head)
+	if err != nil {
+		return 0, fmt.Errorf("ref %s: %w", name, err)
+	}
+	keep := r.keep(chain, s.clock.Now())
+	if err := s.keepPinned(head, chain, keep); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, k := range keep {
+		if !k {
+			n++
+		}
+	}
+	if n == 0 || dryRun {
+		return n, nil
+	}
+
+	// rebuild oldest first; a kept prefix with nothing cut below it
+	// encodes as before and keeps its hashes
+	parent := object.ZeroHash
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !keep[i] {
+			continue
+		}
+		snap := *chain[i]
+		snap.Parent = parent
+		if parent, err = s.PutSnapshot(&snap); err != nil {
+			return 0, fmt.Errorf("rewrite history of %s: %w", name, err)
+		}
+	}
+	if err := s.CompareAndSwapRef(name, head, parent); err != nil {
+		return 0, fmt.Errorf("rewrite history of %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// keepPinned marks the newest pinned snapshot of the chain from head, and
+// all older ones, as kept. A pin keeps a snapshot's history, so GC would
+// free nothing by cutting them, and leaving them as they are keeps the
+// pinned hash in the rewritten chain.
+func (s *Store) keepPinned(head object.Hash, chain []*object.Snapshot, keep []bool) error {
+	pins, err := s.Pins()
+	if err != nil {
+		return err
+	}
+	h := head
+	for i, snap := range chain {
+		if slices.Contains(pins, h) {
+			for j := i; j < len(keep); j++ {
+				keep[j] = true
+			}
+			return nil
+		}
+		h = snap.Parent
+	}
+	return nil
+}
+
+// history returns the snapshots from head back to the first, newest first.
+func (s *Store) history(head object.Hash) ([]*object.Snapshot, error) {
+	var chain []*object.Snapshot
+	for h := head; !h.IsZero(); {
+		snap, err := s.GetSnapshot(h)
+		if err != nil {
+			return nil, fmt.Errorf("read snapshot %s: %w", h, err)
+		}
+		chain = append(chain, snap)
+		h = snap.Parent
+	}
+	return chain, nil
+}
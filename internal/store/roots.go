@@ -0,0 +1,115 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// rootLogFile lists every root PutProvenance records, one line each, in the
+// order they were recorded. Provenance keeps only the latest record of a
+// root, so a tree hashed again, as after a revert, would otherwise lose its
+// earlier place in time.
+const rootLogFile = "roots"
+
+// RootRecord is one recording of a root in the root log.
+type RootRecord struct {
+	Time time.Time
+	Root object.Hash
+	Path string // the walked path, as its provenance records it
+}
+
+// logRoot appends p's root to the root log. Like the event log, each line
+// is written with O_APPEND, so concurrent processes don't interleave within
+// a line.
+func (s *Store) logRoot(p *object.Provenance) error {
+	line := fmt.Sprintf("%s\t%s\t%s\n", p.Time.UTC().Format(time.RFC3339Nano), p.Root, strconv.Quote(p.Settings["path"]))
+	f, err := s.fs.OpenFile(filepath.Join(s.root, rootLogFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open root log: %w", err)
+	}
+	// end a line torn by a crash, so it doesn't swallow this one
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		var last [1]byte
+		if _, err := f.ReadAt(last[:], info.Size()-1); err == nil && last[0] != '\n' {
+			line = "\n" + line
+		}
+	}
+	_, writeErr := io.WriteString(f, line)
+	closeErr := f.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		return fmt.Errorf("append root log: %w", err)
+	}
+	return nil
+}
+
+// RootHistory returns each recording of a root that still has provenance,
+// oldest first. A root recorded again appears again, so the history follows
+// a tree that returns to an earlier state. Roots recorded only before the
+// log existed come first, once each, at the time of their provenance.
+func (s *Store) RootHistory() ([]RootRecord, error) {
+	provs, err := s.ListProvenance()
+	if err != nil {
+		return nil, err
+	}
+	// GC drops the provenance of the roots it removes
+	have := make(map[object.Hash]bool, len(provs))
+	for _, p := range provs {
+		have[p.Root] = true
+	}
+
+	data, err := s.fs.ReadFile(filepath.Join(s.root, rootLogFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read root log: %w", err)
+	}
+	var logged []RootRecord
+	seen := make(map[object.Hash]bool)
+	for line := range bytes.Lines(data) {
+		r, ok := parseRootRecord(string(line))
+		if !ok {
+			continue // torn by a crash mid-append
+		}
+		seen[r.Root] = true
+		if have[r.Root] {
+			logged = append(logged, r)
+		}
+	}
+
+	var records []RootRecord
+	for _, p := range provs {
+		if !seen[p.Root] {
+			records = append(records, RootRecord{Time: p.Time, Root: p.Root, Path: p.Settings["path"]})
+		}
+	}
+	return append(records, logged...), nil
+}
+
+// parseRootRecord decodes one root log line, rejecting a torn one.
+func parseRootRecord(line string) (RootRecord, bool) {
+	line, ok := strings.CutSuffix(line, "\n")
+	fields := strings.Split(line, "\t")
+	if !ok || len(fields) != 3 {
+		return RootRecord{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return RootRecord{}, false
+	}
+	h, err := object.ParseHash(fields[1])
+	if err != nil {
+		return RootRecord{}, false
+	}
+	path, err := strconv.Unquote(fields[2])
+	if err != nil {
+		return RootRecord{}, false
+	}
+	return RootRecord{Time: t, Root: h, Path: path}, true
+}
@@ -1,124 +1,704 @@
 package store
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/vfs"
 )
 
 const (
-	objectsDir = "objects"
-	indexFile  = "index"
+	objectsDir   = "objects"
+	indexFile    = "index"
+	dedupFile    = "dedup"
+	activityFile = "activity"
+	cacheFile    = "cachestats"
+	configFile   = "config"
+	ignoreFile   = "ignore"
+	provDir      = "provenance"
+	numShards    = 256
 )
 
+var ErrAlgorithmMismatch = errors.New("store: hash algorithm mismatch")
+
 type Store struct {
-	root string
+	root  string
+	fs    vfs.FS
+	clock vfs.Clock
+
+	algorithm    object.Algorithm // fixed when the store is created
+	algorithmSet bool             // requested via WithAlgorithm
 
-	index   map[string]object.IndexEntry // path -> entry
+	settings   map[string]string // from the config file
+	settingsMu sync.Mutex        // guards settings
+
+	index   *pathIndex
 	indexMu sync.RWMutex
 
-	dirty bool // does the index need to be written?
+	lazyIndex bool
+	indexOnce sync.Once
+	indexErr  error // from loading the index; set once by indexOnce, guarded by indexMu
+
+	unflushed      map[string]struct{} // keys updated since the last Flush, guarded by indexMu
+	journalEntries int                 // entries in the index journal, guarded by indexMu
+	journalTorn    bool                // the journal ends in a torn record, guarded by indexMu
+	pruned         bool                // entries were removed since the last Flush, guarded by indexMu
+
+	granularity      time.Duration // index mtimes are truncated to this, guarded by indexMu
+	indexGranularity time.Duration // what the index file was written with, guarded by indexMu
+
+	activity      map[string]object.DirActivity // dir cache key -> change history, guarded by indexMu
+	activityDirty bool
+
+	precreateShards bool
+	shards          [numShards]atomic.Bool // shard directory known to exist
+
+	dedupBase    object.DedupStats // persisted totals from earlier sessions
+	dedupFlushed object.DedupStats // session counters as of the last Flush, guarded by indexMu
+	dedup        struct {
+		written, deduplicated, bytesWritten, bytesSaved atomic.Uint64
+	}
+
+	cacheFlushed object.CacheStats // session lookups as of the last Flush, guarded by indexMu
+	cache        struct {
+		hits, stale, misses atomic.Uint64
+	}
+
+	packs   []*pack // loaded at Open and after Repack
+	packsMu sync.RWMutex
+
+	batchSize int                    // commit pending objects once this many accumulate
+	pending   map[object.Hash]string // hash -> temp file awaiting rename
+	pendingMu sync.Mutex
+
+	scratch   map[object.Hash][]byte // objects written under WithScratch, held only in memory
+	scratchMu sync.RWMutex
+
+	lockMode LockMode
+	lockWait time.Duration
+	lockHeld *os.File // the locked lock file, closed by Close
+
+	warnings []string // problems Open worked around
+}
+
+type Option func(*Store)
+
+// WithPrecreateShards creates all 256 shard directories on Open, so writes to
+// a cold store skip the per-object MkdirAll.
+func WithPrecreateShards() Option {
+	return func(s *Store) {
+		s.precreateShards = true
+	}
+}
+
+// WithBatchCommit defers the rename of freshly written objects until n have
+// accumulated (or Flush is called), then fsyncs them, renames them together,
+// and fsyncs each touched shard directory once. Pending objects remain
+// readable. This trades a short window where objects live only under temp
+// names for much higher write throughput on filesystems with expensive
+// metadata operations.
+func WithBatchCommit(n int) Option {
+	return func(s *Store) {
+		s.batchSize = n
+	}
 }
 
-func Open(root string) (*Store, error) {
+// WithAlgorithm selects the hash algorithm for a new store. Opening an
+// existing store that uses a different algorithm fails with
+// ErrAlgorithmMismatch.
+func WithAlgorithm(alg object.Algorithm) Option {
+	return func(s *Store) {
+		s.algorithm = alg
+		s.algorithmSet = true
+	}
+}
+
+// WithLazyIndex defers reading the index until the cache is first used, so
+// commands that only read objects skip loading it. A corrupt index then
+// surfaces as cache misses and an error from Flush instead of from Open.
+func WithLazyIndex() Option {
+	return func(s *Store) {
+		s.lazyIndex = true
+	}
+}
+
+// WithScratch keeps objects written through the store in memory, where
+// reads find them beside the stored ones, and makes Flush a no-op, so a
+// preview can build trees without leaving anything in the store.
+func WithScratch() Option {
+	return func(s *Store) {
+		s.scratch = make(map[object.Hash][]byte)
+	}
+}
+
+// WithFS runs the store on fsys instead of the host filesystem, so tests can
+// inject write failures.
+func WithFS(fsys vfs.FS) Option {
+	return func(s *Store) {
+		s.fs = fsys
+	}
+}
+
+// WithModTimeGranularity truncates modification times to multiples of d
+// before the index records or compares them, for filesystems whose
+// timestamps are coarse or reported at varying precision (FAT keeps 2s, some
+// NFS servers whole seconds). Files modified within the current d aren't
+// cached, since a second write there may not move the mtime. An index keeps
+// the coarsest granularity it was ever written with. d should divide a
+// second or be a whole number of seconds; d <= 0 compares exactly.
+func WithModTimeGranularity(d time.Duration) Option {
+	return func(s *Store) {
+		s.granularity = max(d, 0)
+	}
+}
+
+// WithClock reads the time from c instead of the system clock.
+func WithClock(c vfs.Clock) Option {
+	return func(s *Store) {
+		s.clock = c
+	}
+}
+
+func Open(root string, opts ...Option) (*Store, error) {
 	s := &Store{
-		root:  root,
-		index: make(map[string]object.IndexEntry),
+		root:      root,
+		fs:        vfs.OS{},
+		clock:     vfs.SystemClock{},
+		index:     newPathIndex(),
+		unflushed: make(map[string]struct{}),
+		activity:  make(map[string]object.DirActivity),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.batchSize > 0 {
+		s.pending = make(map[object.Hash]string)
 	}
 
-	if err := os.MkdirAll(filepath.Join(root, objectsDir), 0o750); err != nil {
+	if err := s.fs.MkdirAll(filepath.Join(root, objectsDir), 0o750); err != nil {
 		return nil, fmt.Errorf("create objects directory: %w", err)
 	}
 
-	if err := s.loadIndex(); err != nil && !os.IsNotExist(err) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		s.unlock()
 		return nil, err
 	}
-
 	return s, nil
 }
 
-func (s *Store) loadIndex() error {
-	data, err := os.ReadFile(filepath.Join(s.root, indexFile))
+// load reads what Open needs from disk.
+func (s *Store) load() error {
+	if err := s.loadPacks(); err != nil {
+		return err
+	}
+
+	if err := s.loadConfig(); err != nil {
+		return err
+	}
+
+	if s.precreateShards {
+		if err := s.createShards(); err != nil {
+			return err
+		}
+	}
+
+	if !s.lazyIndex {
+		if err := s.ensureIndex(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.loadDedupStats(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := s.loadActivity(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Warnings returns the problems Open worked around rather than failing on,
+// such as bookkeeping files that couldn't be decoded and were started over.
+func (s *Store) Warnings() []string {
+	return s.warnings
+}
+
+// Root returns the directory the store was opened at.
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Algorithm returns the hash algorithm of every object in the store.
+func (s *Store) Algorithm() object.Algorithm {
+	return s.algorithm
+}
+
+// IgnorePath returns the path of the ignore file kept in the store at root,
+// whose rules apply to every tree hashed into it.
+func IgnorePath(root string) string {
+	return filepath.Join(root, ignoreFile)
+}
+
+// ReadAlgorithm returns the algorithm recorded in the store at root without
+// opening it; ok is false if the store has no config yet.
+func ReadAlgorithm(root string) (alg object.Algorithm, ok bool, err error) {
+	cfg, ok, err := ReadConfig(root)
+	if err != nil || !ok {
+		return object.DefaultAlgorithm, ok, err
+	}
+	return cfg.Algorithm, true, nil
+}
+
+// ReadConfig returns the config of the store at root without opening or
+// locking it, which the atomic writes of SetSetting make safe; ok is false
+// if the store has no config yet.
+func ReadConfig(root string) (cfg *object.StoreConfig, ok bool, err error) {
+	data, err := os.ReadFile(filepath.Join(root, configFile))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read config: %w", err)
+	}
+	cfg, err = object.DecodeStoreConfig(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode config: %w", err)
+	}
+	return cfg, true, nil
+}
+
+// Settings returns a copy of the settings in the store's config.
+func (s *Store) Settings() map[string]string {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	return maps.Clone(s.settings)
+}
+
+// SetSetting records value under key in the store's config, or removes key
+// if value is empty. The store only keeps settings; what they mean is up to
+// whoever reads them.
+func (s *Store) SetSetting(key, value string) error {
+	if key == "" {
+		return errors.New("store: empty setting key")
+	}
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	settings := maps.Clone(s.settings)
+	if value == "" {
+		delete(settings, key)
+	} else {
+		if settings == nil {
+			settings = make(map[string]string)
+		}
+		settings[key] = value
+	}
+	if err := s.writeConfig(settings); err != nil {
+		return err
+	}
+	s.settings = settings
+	return nil
+}
+
+func (s *Store) writeConfig(settings map[string]string) error {
+	data, err := object.EncodeStoreConfig(&object.StoreConfig{Algorithm: s.algorithm, Settings: settings})
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	return s.writeFileAtomic(filepath.Join(s.root, configFile), data)
+}
+
+// loadConfig reads the store's algorithm, recording it on first open. Stores
+// that predate the config file hold SHA256 objects.
+func (s *Store) loadConfig() error {
+	path := filepath.Join(s.root, configFile)
+	data, err := s.fs.ReadFile(path)
+	if err == nil {
+		cfg, err := object.DecodeStoreConfig(data)
+		if err != nil {
+			return fmt.Errorf("decode config: %w", err)
+		}
+		if s.algorithmSet && s.algorithm != cfg.Algorithm {
+			return fmt.Errorf("%w: store uses %s, not %s", ErrAlgorithmMismatch, cfg.Algorithm, s.algorithm)
+		}
+		s.algorithm = cfg.Algorithm
+		s.settings = cfg.Settings
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	if !s.algorithmSet {
+		s.algorithm = object.DefaultAlgorithm
+	}
+	if s.algorithm != object.DefaultAlgorithm {
+		hasObjects, err := s.hasObjects()
+		if err != nil {
+			return err
+		}
+		if hasObjects {
+			return fmt.Errorf("%w: store already holds %s objects, not %s",
+				ErrAlgorithmMismatch, object.DefaultAlgorithm, s.algorithm)
+		}
+	}
+
+	return s.writeConfig(nil)
+}
+
+// hasObjects reports whether any object has been written to the store.
+func (s *Store) hasObjects() (bool, error) {
+	if s.packedCount() > 0 {
+		return true, nil
+	}
+	shards, err := s.fs.ReadDir(filepath.Join(s.root, objectsDir))
+	if err != nil {
+		return false, fmt.Errorf("read objects directory: %w", err)
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		entries, err := s.fs.ReadDir(filepath.Join(s.root, objectsDir, shard.Name()))
+		if err != nil {
+			return false, fmt.Errorf("read shard directory: %w", err)
+		}
+		if len(entries) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ensureIndex loads the index on first call and returns the load error, if
+// any, on every call.
+func (s *Store) ensureIndex() error {
+	s.indexOnce.Do(func() {
+		if err := s.loadIndex(); err != nil {
+			// under indexMu so Flush can read it without loading
+			s.indexMu.Lock()
+			s.indexErr = err
+			s.indexMu.Unlock()
+		}
+	})
+	return s.indexErr
+}
+
+func (s *Store) loadDedupStats() error {
+	data, err := s.fs.ReadFile(filepath.Join(s.root, dedupFile))
 	if err != nil {
 		return err //nolint:wrapcheck // caller checks os.IsNotExist
 	}
 
-	idx, err := object.DecodeIndex(data)
+	// the counters are only reported, so a damaged file starts them over
+	d, err := object.DecodeDedupStats(data)
 	if err != nil {
-		return fmt.Errorf("decode index: %w", err)
+		s.warnings = append(s.warnings, fmt.Sprintf("dedup stats reset: decode %s: %v", dedupFile, err))
+		return nil
+	}
+	s.dedupBase = *d
+	return nil
+}
+
+func (s *Store) loadActivity() error {
+	data, err := s.fs.ReadFile(filepath.Join(s.root, activityFile))
+	if err != nil {
+		return err //nolint:wrapcheck // caller checks os.IsNotExist
+	}
+
+	// the history only orders walks, so a damaged file starts it over
+	a, err := object.DecodeActivity(data)
+	if err != nil {
+		s.warnings = append(s.warnings, fmt.Sprintf("directory activity reset: decode %s: %v", activityFile, err))
+		return nil
 	}
 
 	s.indexMu.Lock()
 	defer s.indexMu.Unlock()
 
-	for _, e := range idx.Entries {
-		s.index[e.Path] = e
+	for _, e := range a.Entries {
+		s.activity[e.Path] = e
 	}
-
 	return nil
 }
 
 func (s *Store) Flush() error {
+	if s.scratch != nil {
+		return nil
+	}
+	// objects must be in place before the index can reference them
+	if err := s.Commit(); err != nil {
+		return err
+	}
+
 	s.indexMu.Lock()
 	defer s.indexMu.Unlock()
 
-	if !s.dirty {
+	if err := s.flushDedupStats(); err != nil {
+		return err
+	}
+
+	if err := s.flushActivity(); err != nil {
+		return err
+	}
+
+	if err := s.flushCacheStats(); err != nil {
+		return err
+	}
+
+	if s.indexErr != nil {
+		// never replace an index we failed to read
+		return s.indexErr
+	}
+	return s.flushIndex()
+}
+
+// flushDedupStats persists cumulative dedup counters if this session changed
+// them. Callers must hold indexMu.
+func (s *Store) flushDedupStats() error {
+	session := s.SessionDedupStats()
+	if session == s.dedupFlushed {
 		return nil
 	}
 
-	entries := make([]object.IndexEntry, 0, len(s.index))
-	for _, e := range s.index {
-		entries = append(entries, e)
+	total := s.dedupBase.Add(session)
+	data, err := object.EncodeDedupStats(&total)
+	if err != nil {
+		return fmt.Errorf("encode dedup stats: %w", err)
 	}
+	if err := s.writeFileAtomic(filepath.Join(s.root, dedupFile), data); err != nil {
+		return fmt.Errorf("write dedup stats file: %w", err)
+	}
+
+	s.dedupFlushed = session
+	return nil
+}
 
-	data, err := object.EncodeIndex(&object.Index{Entries: entries})
+// flushActivity persists directory change history if it changed. Callers
+// must hold indexMu.
+func (s *Store) flushActivity() error {
+	if !s.activityDirty {
+		return nil
+	}
+
+	entries := make([]object.DirActivity, 0, len(s.activity))
+	for _, e := range s.activity {
+		entries = append(entries, e)
+	}
+	data, err := object.EncodeActivity(&object.Activity{Entries: entries})
 	if err != nil {
-		return fmt.Errorf("encode index: %w", err)
+		return fmt.Errorf("encode activity: %w", err)
+	}
+	if err := s.writeFileAtomic(filepath.Join(s.root, activityFile), data); err != nil {
+		return fmt.Errorf("write activity file: %w", err)
 	}
 
-	if err := os.WriteFile(filepath.Join(s.root, indexFile), data, 0o600); err != nil {
-		return fmt.Errorf("write index file: %w", err)
+	s.activityDirty = false
+	return nil
+}
+
+// flushCacheStats records this session's cache lookups as the last walk's,
+// if it made any since the last Flush. Callers must hold indexMu.
+func (s *Store) flushCacheStats() error {
+	session := s.SessionCacheStats()
+	if session.Lookups() == s.cacheFlushed.Lookups() {
+		return nil
 	}
 
-	s.dirty = false
+	session.Time = s.clock.Now()
+	data, err := object.EncodeCacheStats(&session)
+	if err != nil {
+		return fmt.Errorf("encode cache stats: %w", err)
+	}
+	if err := s.writeFileAtomic(filepath.Join(s.root, cacheFile), data); err != nil {
+		return fmt.Errorf("write cache stats file: %w", err)
+	}
+
+	s.cacheFlushed = session
 	return nil
 }
 
+// SessionCacheStats returns the hash cache lookups made since Open, without
+// a time.
+func (s *Store) SessionCacheStats() object.CacheStats {
+	return object.CacheStats{
+		Hits:   s.cache.hits.Load(),
+		Stale:  s.cache.stale.Load(),
+		Misses: s.cache.misses.Load(),
+	}
+}
+
+// lastCacheStats returns the lookups of the latest session that made any:
+// this one, or else the one recorded on disk.
+func (s *Store) lastCacheStats() (object.CacheStats, bool) {
+	if session := s.SessionCacheStats(); session.Lookups() > 0 {
+		session.Time = s.clock.Now()
+		return session, true
+	}
+	data, err := s.fs.ReadFile(filepath.Join(s.root, cacheFile))
+	if err != nil {
+		return object.CacheStats{}, false
+	}
+	c, err := object.DecodeCacheStats(data)
+	if err != nil {
+		return object.CacheStats{}, false
+	}
+	return *c, true
+}
+
+// SessionDedupStats returns dedup counters accumulated since Open.
+func (s *Store) SessionDedupStats() object.DedupStats {
+	return object.DedupStats{
+		Written:      s.dedup.written.Load(),
+		Deduplicated: s.dedup.deduplicated.Load(),
+		BytesWritten: s.dedup.bytesWritten.Load(),
+		BytesSaved:   s.dedup.bytesSaved.Load(),
+	}
+}
+
+// Close flushes the store and releases its lock.
 func (s *Store) Close() error {
+	defer s.unlock()
 	return s.Flush()
 }
 
 func (s *Store) LookupCache(path string, size int64, modTime time.Time) (object.Hash, bool) {
+	if s.ensureIndex() != nil {
+		return object.ZeroHash, false
+	}
+
 	s.indexMu.RLock()
 	defer s.indexMu.RUnlock()
 
-	e, ok := s.index[path]
+	r, ok := s.index.get(path)
 	if !ok {
+		s.cache.misses.Add(1)
 		return object.ZeroHash, false
 	}
 
-	if e.Matches(path, size, modTime) {
-		return e.Hash, true
+	if r.matches(size, truncModTime(modTime, s.granularity)) {
+		s.cache.hits.Add(1)
+		return r.hash, true
 	}
 
+	s.cache.stale.Add(1)
 	return object.ZeroHash, false
 }
 
 func (s *Store) UpdateCache(path string, size int64, modTime time.Time, hash object.Hash) {
+	if s.ensureIndex() != nil {
+		return // Flush reports the error
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	modTime = truncModTime(modTime, s.granularity)
+	if s.granularity > 1 && !modTime.Before(truncModTime(s.clock.Now(), s.granularity)) {
+		// racily clean: a write later in this tick would leave the mtime alone
+		return
+	}
+	s.index.set(path, newIndexRecord(size, modTime, hash))
+	s.unflushed[path] = struct{}{}
+}
+
+// PruneCache removes the index entries whose keys start with prefix but
+// aren't in valid, such as those of files deleted or renamed since they were
+// hashed, and returns how many it removed. The next Flush rewrites the index.
+func (s *Store) PruneCache(prefix string, valid map[string]struct{}) (int, error) {
+	if err := s.ensureIndex(); err != nil {
+		return 0, err
+	}
+
+	return s.pruneIndex(prefix, func(key string, _ indexRecord) bool {
+		_, ok := valid[key]
+		return ok
+	}), nil
+}
+
+// pruneIndex removes the index entries under prefix that keep rejects; the
+// index must be loaded.
+func (s *Store) pruneIndex(prefix string, keep func(key string, r indexRecord) bool) int {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	removed := s.index.prune(prefix, keep)
+	if removed > 0 {
+		for key := range s.unflushed {
+			if _, ok := s.index.get(key); !ok {
+				delete(s.unflushed, key)
+			}
+		}
+		// the journal can only add entries
+		s.pruned = true
+	}
+	return removed
+}
+
+// RecordDir notes that the directory at key hashed to h, counting a change
+// if it hashed differently last time.
+func (s *Store) RecordDir(key string, h object.Hash) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	e, ok := s.activity[key]
+	if ok && e.Hash == h {
+		return
+	}
+	if ok {
+		e.Changes++
+	}
+	e.Path = key
+	e.Hash = h
+	s.activity[key] = e
+	s.activityDirty = true
+}
+
+// PruneActivity removes the change histories of directories whose keys
+// start with prefix but aren't in valid, such as those deleted or renamed
+// since they were walked, and returns how many it removed. The next Flush
+// rewrites the activity file.
+func (s *Store) PruneActivity(prefix string, valid map[string]struct{}) int {
 	s.indexMu.Lock()
 	defer s.indexMu.Unlock()
 
-	s.index[path] = object.IndexEntry{
-		Path:    path,
-		Size:    size,
-		ModTime: modTime,
-		Hash:    hash,
+	removed := 0
+	for key := range s.activity {
+		if _, ok := valid[key]; !ok && strings.HasPrefix(key, prefix) {
+			delete(s.activity, key)
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.activityDirty = true
 	}
-	s.dirty = true
+	return removed
+}
+
+// DirChanges returns how many walks have seen the directory at key change.
+func (s *Store) DirChanges(key string) uint32 {
+	s.indexMu.RLock()
+	defer s.indexMu.RUnlock()
+
+	return s.activity[key].Changes
 }
 
 func (s *Store) objectPath(h object.Hash) string {
@@ -127,21 +707,159 @@ func (s *Store) objectPath(h object.Hash) string {
 	return filepath.Join(s.root, objectsDir, hex[:2], hex[2:])
 }
 
+func (s *Store) createShards() error {
+	for i := range numShards {
+		dir := filepath.Join(s.root, objectsDir, hex.EncodeToString([]byte{byte(i)}))
+		if err := s.fs.Mkdir(dir, 0o750); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("create shard directory: %w", err)
+		}
+		s.shards[i].Store(true)
+	}
+	return nil
+}
+
+// ensureShard creates the shard directory for h unless it is already known
+// to exist.
+func (s *Store) ensureShard(h object.Hash, dir string) error {
+	if s.shards[h[0]].Load() {
+		return nil
+	}
+	if err := s.fs.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create object directory: %w", err)
+	}
+	s.shards[h[0]].Store(true)
+	return nil
+}
+
 func (s *Store) HasObject(h object.Hash) bool {
-	_, err := os.Stat(s.objectPath(h))
-	return err == nil
+	if _, ok := s.scratchObject(h); ok {
+		return true
+	}
+	if _, ok := s.pendingPath(h); ok {
+		return true
+	}
+	if _, err := s.fs.Stat(s.objectPath(h)); err == nil {
+		return true
+	}
+	_, _, ok := s.findPacked(h)
+	return ok
+}
+
+// scratchObject returns the encoding of h if it was written under
+// WithScratch.
+func (s *Store) scratchObject(h object.Hash) ([]byte, bool) {
+	if s.scratch == nil {
+		return nil, false
+	}
+	s.scratchMu.RLock()
+	defer s.scratchMu.RUnlock()
+	data, ok := s.scratch[h]
+	return data, ok
+}
+
+// pendingPath returns the temp file holding h if it awaits a batch commit.
+func (s *Store) pendingPath(h object.Hash) (string, bool) {
+	if s.pending == nil {
+		return "", false
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	tmp, ok := s.pending[h]
+	return tmp, ok
+}
+
+// Commit fsyncs all objects pending from WithBatchCommit, renames them into
+// place, and fsyncs the shard directories they landed in, so a crash leaves
+// no renamed object without its content. It is a no-op otherwise.
+func (s *Store) Commit() error {
+	if s.pending == nil {
+		return nil
+	}
+
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	for _, tmp := range s.pending {
+		if err := s.syncFile(tmp); err != nil {
+			return err
+		}
+	}
+
+	dirs := make(map[string]struct{})
+	for h, tmp := range s.pending {
+		path := s.objectPath(h)
+		if err := s.fs.Rename(tmp, path); err != nil {
+			return fmt.Errorf("rename temp file: %w", err)
+		}
+		delete(s.pending, h)
+		dirs[filepath.Dir(path)] = struct{}{}
+	}
+
+	for dir := range dirs {
+		if err := s.syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) syncFile(path string) error {
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return fmt.Errorf("open temp file: %w", err)
+	}
+	syncErr := f.Sync()
+	closeErr := f.Close()
+	if syncErr != nil {
+		return fmt.Errorf("sync temp file: %w", syncErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close temp file: %w", closeErr)
+	}
+	return nil
+}
+
+func (s *Store) syncDir(dir string) error {
+	d, err := s.fs.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open shard directory: %w", err)
+	}
+	syncErr := d.Sync()
+	closeErr := d.Close()
+	if syncErr != nil {
+		return fmt.Errorf("sync shard directory: %w", syncErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close shard directory: %w", closeErr)
+	}
+	return nil
 }
 
 func (s *Store) PutObject(h object.Hash, data []byte) error {
+	if s.scratch != nil {
+		s.scratchMu.Lock()
+		s.scratch[h] = data
+		s.scratchMu.Unlock()
+		return nil
+	}
+
 	path := s.objectPath(h)
 
 	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o750); err != nil {
-		return fmt.Errorf("create object directory: %w", err)
+	if err := s.ensureShard(h, dir); err != nil {
+		return err
 	}
 
 	// write atomically via unique temp file to avoid races
-	f, err := os.CreateTemp(dir, ".tmp-*")
+	f, err := s.fs.CreateTemp(dir, ".tmp-*")
+	if os.IsNotExist(err) {
+		// shard removed behind our back; forget it and recreate
+		s.shards[h[0]].Store(false)
+		if err := s.ensureShard(h, dir); err != nil {
+			return err
+		}
+		f, err = s.fs.CreateTemp(dir, ".tmp-*")
+	}
 	if err != nil {
 		return fmt.Errorf("create temp file: %w", err)
 	}
@@ -151,28 +869,121 @@ func (s *Store) PutObject(h object.Hash, data []byte) error {
 	closeErr := f.Close()
 
 	if writeErr != nil {
-		_ = os.Remove(tmp)
+		_ = s.fs.Remove(tmp)
 		return fmt.Errorf("write object data: %w", writeErr)
 	}
 	if closeErr != nil {
-		_ = os.Remove(tmp)
+		_ = s.fs.Remove(tmp)
 		return fmt.Errorf("close temp file: %w", closeErr)
 	}
 
-	if err := os.Rename(tmp, path); err != nil {
+	return s.placeObject(h, tmp)
+}
+
+// placeObject moves the finished temp file tmp into place as h, or queues
+// it for the next batch commit.
+func (s *Store) placeObject(h object.Hash, tmp string) error {
+	if s.pending != nil {
+		return s.addPending(h, tmp)
+	}
+	if err := s.fs.Rename(tmp, s.objectPath(h)); err != nil {
 		return fmt.Errorf("rename temp file: %w", err)
 	}
 	return nil
 }
 
+// addPending queues tmp for the next batch commit, committing immediately once
+// the batch is full.
+func (s *Store) addPending(h object.Hash, tmp string) error {
+	s.pendingMu.Lock()
+	if _, ok := s.pending[h]; ok {
+		// a concurrent writer already queued identical content
+		s.pendingMu.Unlock()
+		_ = s.fs.Remove(tmp)
+		return nil
+	}
+	s.pending[h] = tmp
+	full := len(s.pending) >= s.batchSize
+	s.pendingMu.Unlock()
+
+	if full {
+		return s.Commit()
+	}
+	return nil
+}
+
 func (s *Store) GetObject(h object.Hash) ([]byte, error) {
-	return os.ReadFile(s.objectPath(h)) //nolint:wrapcheck // callers use os.IsNotExist
+	if data, ok := s.scratchObject(h); ok {
+		return data, nil
+	}
+	if tmp, ok := s.pendingPath(h); ok {
+		data, err := s.fs.ReadFile(tmp)
+		if err == nil {
+			return data, nil
+		}
+		// committed between lookup and read; fall through to the final path
+	}
+	data, err := s.fs.ReadFile(s.objectPath(h))
+	if !os.IsNotExist(err) {
+		return data, err //nolint:wrapcheck // callers use os.IsNotExist
+	}
+	packed, ok, perr := s.readPacked(h)
+	if perr != nil {
+		return nil, perr
+	}
+	if !ok {
+		return nil, err //nolint:wrapcheck // callers use os.IsNotExist
+	}
+	return packed, nil
+}
+
+// OpenObject returns a reader of the encoding of h and its length, so an
+// object too large to hold, such as the blob of a huge unchunked file, can
+// be copied out. The caller closes the reader.
+func (s *Store) OpenObject(h object.Hash) (io.ReadCloser, int64, error) {
+	if data, ok := s.scratchObject(h); ok {
+		return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+	}
+	var f vfs.File
+	var err error
+	if tmp, ok := s.pendingPath(h); ok {
+		// on failure it was committed between lookup and open
+		f, err = s.fs.Open(tmp)
+	}
+	if f == nil || err != nil {
+		f, err = s.fs.Open(s.objectPath(h))
+	}
+	if err == nil {
+		info, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, 0, fmt.Errorf("stat object %s: %w", h, err)
+		}
+		return f, info.Size(), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, 0, err //nolint:wrapcheck // callers use os.IsNotExist
+	}
+	packed, ok, perr := s.readPacked(h)
+	if perr != nil {
+		return nil, 0, perr
+	}
+	if !ok {
+		return nil, 0, err //nolint:wrapcheck // callers use os.IsNotExist
+	}
+	return io.NopCloser(bytes.NewReader(packed)), int64(len(packed)), nil
 }
 
+// PutBlob stores b under the store's algorithm, whatever b.Algorithm says;
+// the same holds for the other Put methods.
 func (s *Store) PutBlob(b *object.Blob) (object.Hash, error) {
+	b = &object.Blob{Content: b.Content, Algorithm: s.algorithm}
 	h := b.Hash()
+	size := uint64(len(b.Content))
 
 	if s.HasObject(h) {
+		s.dedup.deduplicated.Add(1)
+		s.dedup.bytesSaved.Add(size)
 		return h, nil
 	}
 
@@ -185,6 +996,88 @@ func (s *Store) PutBlob(b *object.Blob) (object.Hash, error) {
 		return object.ZeroHash, err
 	}
 
+	s.dedup.written.Add(1)
+	s.dedup.bytesWritten.Add(size)
+	return h, nil
+}
+
+// PutBlobFrom stores the size bytes read from r as a blob, streaming them to
+// disk instead of holding them, and returns the hash PutBlob would give the
+// same content. It fails with io.ErrUnexpectedEOF if r ends early; anything
+// past size is left unread.
+func (s *Store) PutBlobFrom(r io.Reader, size int64) (object.Hash, error) {
+	if s.scratch != nil {
+		var buf bytes.Buffer
+		h, err := s.writeBlobFrom(&buf, r, size)
+		if err != nil {
+			return object.ZeroHash, err
+		}
+		if !s.HasObject(h) {
+			if err := s.PutObject(h, buf.Bytes()); err != nil {
+				return object.ZeroHash, err
+			}
+		}
+		return h, nil
+	}
+
+	// the hash isn't known until the end, so write outside any shard
+
+	f, err := s.fs.CreateTemp(filepath.Join(s.root, objectsDir), ".tmp-*")
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("create temp file: %w", err)
+	}
+	tmp := f.Name()
+
+	h, writeErr := s.writeBlobFrom(f, r, size)
+	closeErr := f.Close()
+	if writeErr == nil && closeErr != nil {
+		writeErr = fmt.Errorf("close temp file: %w", closeErr)
+	}
+	if writeErr != nil {
+		_ = s.fs.Remove(tmp)
+		return object.ZeroHash, writeErr
+	}
+
+	if s.HasObject(h) {
+		_ = s.fs.Remove(tmp)
+		s.dedup.deduplicated.Add(1)
+		s.dedup.bytesSaved.Add(uint64(size)) //nolint:gosec // sizes are never negative
+		return h, nil
+	}
+	if err := s.ensureShard(h, filepath.Dir(s.objectPath(h))); err != nil {
+		_ = s.fs.Remove(tmp)
+		return object.ZeroHash, err
+	}
+	if err := s.placeObject(h, tmp); err != nil {
+		_ = s.fs.Remove(tmp)
+		return object.ZeroHash, err
+	}
+
+	s.dedup.written.Add(1)
+	s.dedup.bytesWritten.Add(uint64(size)) //nolint:gosec // sizes are never negative
+	return h, nil
+}
+
+// writeBlobFrom writes the encoded blob of the size bytes read from r to w,
+// hashing the content on the way.
+func (s *Store) writeBlobFrom(w io.Writer, r io.Reader, size int64) (object.Hash, error) {
+	bw := bufio.NewWriter(w)
+	if err := object.WriteBlobHeader(bw, s.algorithm, size); err != nil {
+		return object.ZeroHash, fmt.Errorf("encode blob: %w", err)
+	}
+	hasher := s.algorithm.New()
+	if n, err := io.CopyN(io.MultiWriter(bw, hasher), r, size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return object.ZeroHash, fmt.Errorf("copy content: %w after %d of %d bytes", io.ErrUnexpectedEOF, n, size)
+		}
+		return object.ZeroHash, fmt.Errorf("copy content: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return object.ZeroHash, fmt.Errorf("write object data: %w", err)
+	}
+
+	var h object.Hash
+	copy(h[:], hasher.Sum(nil))
 	return h, nil
 }
 
@@ -202,12 +1095,12 @@ func (s *Store) GetBlob(h object.Hash) (*object.Blob, error) {
 }
 
 func (s *Store) PutTree(t *object.Tree) (object.Hash, error) {
-	data, err := object.EncodeTree(t)
+	data, err := object.EncodeTree(&object.Tree{Entries: t.Entries, Algorithm: s.algorithm, ModTimes: t.ModTimes})
 	if err != nil {
 		return object.ZeroHash, fmt.Errorf("encode tree: %w", err)
 	}
 
-	h := object.HashBytes(data)
+	h := s.algorithm.Sum(data)
 
 	if s.HasObject(h) {
 		return h, nil
@@ -233,27 +1126,291 @@ func (s *Store) GetTree(h object.Hash) (*object.Tree, error) {
 	return tree, nil
 }
 
+func (s *Store) PutManifest(m *object.Manifest) (object.Hash, error) {
+	data, err := object.EncodeManifest(&object.Manifest{Chunks: m.Chunks, Algorithm: s.algorithm})
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("encode manifest: %w", err)
+	}
+
+	h := s.algorithm.Sum(data)
+
+	if s.HasObject(h) {
+		return h, nil
+	}
+
+	if err := s.PutObject(h, data); err != nil {
+		return object.ZeroHash, err
+	}
+
+	return h, nil
+}
+
+func (s *Store) GetManifest(h object.Hash) (*object.Manifest, error) {
+	data, err := s.GetObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := object.DecodeManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+// ReadFile returns the content of the file entry hash h, which names either
+// a blob or the manifest of a chunked file.
+func (s *Store) ReadFile(h object.Hash) ([]byte, error) {
+	data, err := s.GetObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(object.MagicManifest)) {
+		blob, err := object.DecodeBlob(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode blob: %w", err)
+		}
+		return blob.Content, nil
+	}
+
+	m, err := object.DecodeManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	content := make([]byte, 0, m.Size())
+	for i, c := range m.Chunks {
+		blob, err := s.GetBlob(c.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		content = append(content, blob.Content...)
+	}
+	return content, nil
+}
+
+func (s *Store) PutSnapshot(snap *object.Snapshot) (object.Hash, error) {
+	withAlg := *snap
+	withAlg.Algorithm = s.algorithm
+	data, err := object.EncodeSnapshot(&withAlg)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	h := s.algorithm.Sum(data)
+
+	if s.HasObject(h) {
+		return h, nil
+	}
+
+	if err := s.PutObject(h, data); err != nil {
+		return object.ZeroHash, err
+	}
+	if err := s.appendEvent(EventSnapshot, h, ""); err != nil {
+		return object.ZeroHash, err
+	}
+
+	return h, nil
+}
+
+func (s *Store) GetSnapshot(h object.Hash) (*object.Snapshot, error) {
+	data, err := s.GetObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := object.DecodeSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// PutProvenance records how p.Root was produced, replacing any earlier record
+// for the same root, and adds the root to the root log.
+func (s *Store) PutProvenance(p *object.Provenance) error {
+	data, err := object.EncodeProvenance(p)
+	if err != nil {
+		return fmt.Errorf("encode provenance: %w", err)
+	}
+
+	dir := filepath.Join(s.root, provDir)
+	if err := s.fs.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create provenance directory: %w", err)
+	}
+	if err := s.writeFileAtomic(filepath.Join(dir, p.Root.String()), data); err != nil {
+		return err
+	}
+	if err := s.logRoot(p); err != nil {
+		return err
+	}
+	return s.appendEvent(EventRoot, p.Root, "")
+}
+
+// GetProvenance returns the provenance recorded for root.
+func (s *Store) GetProvenance(root object.Hash) (*object.Provenance, error) {
+	data, err := s.fs.ReadFile(filepath.Join(s.root, provDir, root.String()))
+	if err != nil {
+		return nil, err //nolint:wrapcheck // callers use os.IsNotExist
+	}
+
+	p, err := object.DecodeProvenance(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode provenance: %w", err)
+	}
+	return p, nil
+}
+
+// ListProvenance returns every recorded provenance, oldest first.
+func (s *Store) ListProvenance() ([]*object.Provenance, error) {
+	dirEntries, err := s.fs.ReadDir(filepath.Join(s.root, provDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read provenance directory: %w", err)
+	}
+
+	records := make([]*object.Provenance, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		root, err := object.ParseHash(de.Name())
+		if err != nil {
+			continue // temp files from an interrupted write
+		}
+		p, err := s.GetProvenance(root)
+		if err != nil {
+			return nil, fmt.Errorf("provenance %s: %w", root, err)
+		}
+		records = append(records, p)
+	}
+
+	slices.SortStableFunc(records, func(a, b *object.Provenance) int {
+		return a.Time.Compare(b.Time)
+	})
+	return records, nil
+}
+
+// writeFileAtomic replaces path with data via a temp file in the same directory.
+func (s *Store) writeFileAtomic(path string, data []byte) error {
+	f, err := s.fs.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmp := f.Name()
+
+	_, writeErr := f.Write(data)
+	closeErr := f.Close()
+
+	if writeErr != nil {
+		_ = s.fs.Remove(tmp)
+		return fmt.Errorf("write temp file: %w", writeErr)
+	}
+	if closeErr != nil {
+		_ = s.fs.Remove(tmp)
+		return fmt.Errorf("close temp file: %w", closeErr)
+	}
+
+	if err := s.fs.Rename(tmp, path); err != nil {
+		_ = s.fs.Remove(tmp)
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+	return nil
+}
+
 type Stats struct {
-	ObjectCount int
-	IndexSize   int
+	ObjectCount   int    // loose objects are estimated unless SampledShards == 256
+	ObjectBytes   uint64 // on-disk size of all objects, estimated like ObjectCount
+	SampledShards int    // shard directories counted to get ObjectCount
+	Shards        []int  // loose objects in each sampled shard, in shard order
+	IndexSize     int
+	Dedup         object.DedupStats // cumulative across all sessions
+
+	// Cache holds the hash cache lookups of the last session that made
+	// any, usually the last walk; HasCache is false if none was recorded.
+	Cache    object.CacheStats
+	HasCache bool
+}
+
+// Estimated reports whether ObjectCount was extrapolated from a sample.
+func (st Stats) Estimated() bool {
+	return st.SampledShards < numShards
+}
+
+// ShardSpread returns the fewest, most, and mean loose objects in a sampled
+// shard; an even spread means hashes are doing their job.
+func (st Stats) ShardSpread() (least, most int, mean float64) {
+	if len(st.Shards) == 0 {
+		return 0, 0, 0
+	}
+	least, most = st.Shards[0], st.Shards[0]
+	total := 0
+	for _, n := range st.Shards {
+		least, most = min(least, n), max(most, n)
+		total += n
+	}
+	return least, most, float64(total) / float64(len(st.Shards))
 }
 
 func (s *Store) Stats() Stats {
+	return s.stats(numShards)
+}
+
+// FastStats is Stats with the object count extrapolated from n evenly spaced
+// shards. Hashes spread objects uniformly across shards, so a few shards give
+// a close estimate without listing every directory of a huge store.
+func (s *Store) FastStats(n int) Stats {
+	return s.stats(min(max(n, 1), numShards))
+}
+
+func (s *Store) stats(sampleShards int) Stats {
+	_ = s.ensureIndex() // Flush reports the error
+
 	s.indexMu.RLock()
-	indexSize := len(s.index)
+	indexSize := s.index.len()
 	s.indexMu.RUnlock()
 
 	objectCount := 0
-	objectsRoot := filepath.Join(s.root, objectsDir)
-	_ = filepath.Walk(objectsRoot, func(path string, info os.FileInfo, err error) error {
-		if err == nil && !info.IsDir() {
-			objectCount++
-		}
-		return nil
-	})
+	var objectBytes uint64
+	shards := make([]int, sampleShards)
+	for i := range sampleShards {
+		n, size := s.countShard(i * numShards / sampleShards)
+		shards[i] = n
+		objectCount += n
+		objectBytes += size
+	}
+	packedCount, packedBytes := s.packedCount(), s.packedBytes()
+	objectCount = objectCount*numShards/sampleShards + packedCount
+	objectBytes = objectBytes*numShards/uint64(sampleShards) + packedBytes //nolint:gosec // sampleShards is positive
 
+	cache, hasCache := s.lastCacheStats()
 	return Stats{
-		ObjectCount: objectCount,
-		IndexSize:   indexSize,
+		ObjectCount:   objectCount,
+		ObjectBytes:   objectBytes,
+		SampledShards: sampleShards,
+		Shards:        shards,
+		IndexSize:     indexSize,
+		Dedup:         s.dedupBase.Add(s.SessionDedupStats()),
+		Cache:         cache,
+		HasCache:      hasCache,
+	}
+}
+
+// countShard returns the number and total size of the objects in shard i,
+// skipping temp files.
+func (s *Store) countShard(i int) (n int, size uint64) {
+	dir := filepath.Join(s.root, objectsDir, hex.EncodeToString([]byte{byte(i)}))
+	entries, err := s.fs.ReadDir(dir)
+	if err != nil {
+		return 0, 0 // shard not created yet
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".tmp-") {
+			continue
+		}
+		n++
+		if info, err := e.Info(); err == nil {
+			size += uint64(info.Size()) //nolint:gosec // file sizes are never negative
+		}
 	}
+	return n, size
 }
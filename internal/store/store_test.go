@@ -2,13 +2,20 @@ package store
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/vfs"
 )
 
 func TestOpen(t *testing.T) {
@@ -118,6 +125,480 @@ func TestOpen(t *testing.T) {
 	}
 }
 
+func TestPrecreateShards(t *testing.T) {
+	t.Parallel()
+
+	t.Run("creates all shard directories", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		store, err := Open(dir, WithPrecreateShards())
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer store.Close() //nolint:errcheck // Close() in a test
+
+		entries, err := os.ReadDir(filepath.Join(dir, objectsDir))
+		if err != nil {
+			t.Fatalf("ReadDir() error = %v", err)
+		}
+		if len(entries) != numShards {
+			t.Errorf("shard count = %d, want %d", len(entries), numShards)
+		}
+		if stats := store.Stats(); stats.ObjectCount != 0 {
+			t.Errorf("ObjectCount = %d, want 0", stats.ObjectCount)
+		}
+	})
+
+	t.Run("reopening a precreated store succeeds", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		for range 2 {
+			store, err := Open(dir, WithPrecreateShards())
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+		}
+	})
+
+	t.Run("recovers when a known shard is removed", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		store, err := Open(dir, WithPrecreateShards())
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer store.Close() //nolint:errcheck // Close() in a test
+
+		hash := object.HashBytes([]byte("shard"))
+		if err := os.Remove(filepath.Dir(store.objectPath(hash))); err != nil {
+			t.Fatalf("Remove() error = %v", err)
+		}
+
+		if err := store.PutObject(hash, []byte("data")); err != nil {
+			t.Fatalf("PutObject() error = %v", err)
+		}
+		if !store.HasObject(hash) {
+			t.Error("HasObject() = false after PutObject")
+		}
+	})
+}
+
+func TestBatchCommit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("objects are readable before commit", func(t *testing.T) {
+		t.Parallel()
+
+		store, err := Open(t.TempDir(), WithBatchCommit(3))
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer store.Close() //nolint:errcheck // Close() in a test
+
+		hash, err := store.PutBlob(&object.Blob{Content: []byte("pending")})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+
+		if _, err := os.Stat(store.objectPath(hash)); !os.IsNotExist(err) {
+			t.Errorf("object at final path before commit: err = %v", err)
+		}
+		if !store.HasObject(hash) {
+			t.Error("HasObject() = false for pending object")
+		}
+		blob, err := store.GetBlob(hash)
+		if err != nil {
+			t.Fatalf("GetBlob() error = %v", err)
+		}
+		if string(blob.Content) != "pending" {
+			t.Errorf("content = %q, want %q", blob.Content, "pending")
+		}
+	})
+
+	t.Run("full batch commits", func(t *testing.T) {
+		t.Parallel()
+
+		store, err := Open(t.TempDir(), WithBatchCommit(3))
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer store.Close() //nolint:errcheck // Close() in a test
+
+		var hashes []object.Hash
+		for _, content := range []string{"a", "b", "c"} {
+			h, err := store.PutBlob(&object.Blob{Content: []byte(content)})
+			if err != nil {
+				t.Fatalf("PutBlob() error = %v", err)
+			}
+			hashes = append(hashes, h)
+		}
+
+		for _, h := range hashes {
+			if _, err := os.Stat(store.objectPath(h)); err != nil {
+				t.Errorf("object %s not committed: %v", h, err)
+			}
+		}
+	})
+
+	t.Run("flush commits partial batch", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		store, err := Open(dir, WithBatchCommit(100))
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		hash, err := store.PutBlob(&object.Blob{Content: []byte("partial")})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		reopened, err := Open(dir)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer reopened.Close() //nolint:errcheck // Close() in a test
+
+		if _, err := reopened.GetBlob(hash); err != nil {
+			t.Errorf("GetBlob() after reopen error = %v", err)
+		}
+	})
+
+	t.Run("concurrent duplicate writes", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		store, err := Open(dir, WithBatchCommit(1000))
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Go(func() {
+				if _, err := store.PutBlob(&object.Blob{Content: []byte("dup")}); err != nil {
+					t.Errorf("PutBlob() error = %v", err)
+				}
+			})
+		}
+		wg.Wait()
+
+		if err := store.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if got := store.Stats().ObjectCount; got != 1 {
+			t.Errorf("ObjectCount = %d, want 1", got)
+		}
+	})
+
+	t.Run("temp files synced before renames", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu     sync.Mutex
+			synced = make(map[string]bool)
+			failed atomic.Bool
+		)
+		objects := string(filepath.Separator) + objectsDir + string(filepath.Separator)
+		fsys := &vfs.FaultFS{FS: vfs.OS{}, Inject: func(op vfs.Op, name string) error {
+			if !strings.Contains(name, objects) {
+				return nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case op == vfs.OpSync && failed.Load():
+				return errors.New("injected sync failure")
+			case op == vfs.OpSync:
+				synced[name] = true
+			case op == vfs.OpRename && !synced[name]:
+				t.Errorf("%s renamed before it was synced", name)
+			}
+			return nil
+		}}
+		store, err := Open(t.TempDir(), WithBatchCommit(100), WithFS(fsys))
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		defer store.Close() //nolint:errcheck // Close() in a test
+
+		for _, content := range []string{"a", "b", "c"} {
+			if _, err := store.PutBlob(&object.Blob{Content: []byte(content)}); err != nil {
+				t.Fatalf("PutBlob() error = %v", err)
+			}
+		}
+		if err := store.Commit(); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+
+		// a failed sync renames nothing
+		h, err := store.PutBlob(&object.Blob{Content: []byte("d")})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		failed.Store(true)
+		if err := store.Commit(); err == nil {
+			t.Error("Commit() with a failing sync: error = nil")
+		}
+		if _, err := os.Stat(store.objectPath(h)); !os.IsNotExist(err) {
+			t.Errorf("object at its final path after a failed sync: err = %v", err)
+		}
+		failed.Store(false)
+	})
+}
+
+func TestDedupStats(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for _, content := range []string{"one", "two", "one", "one"} {
+		if _, err := store.PutBlob(&object.Blob{Content: []byte(content)}); err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+	}
+
+	want := object.DedupStats{Written: 2, Deduplicated: 2, BytesWritten: 6, BytesSaved: 6}
+	if got := store.SessionDedupStats(); got != want {
+		t.Errorf("SessionDedupStats() = %+v, want %+v", got, want)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close() //nolint:errcheck // Close() in a test
+
+	if got := reopened.SessionDedupStats(); got != (object.DedupStats{}) {
+		t.Errorf("SessionDedupStats() after reopen = %+v, want zero", got)
+	}
+	if _, err := reopened.PutBlob(&object.Blob{Content: []byte("two")}); err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+
+	want.Deduplicated++
+	want.BytesSaved += 3
+	if got := reopened.Stats().Dedup; got != want {
+		t.Errorf("Stats().Dedup = %+v, want %+v", got, want)
+	}
+}
+
+func TestDirActivity(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	a, b := object.HashBytes([]byte("a")), object.HashBytes([]byte("b"))
+	for _, h := range []object.Hash{a, a, b, a, a} {
+		store.RecordDir("src", h)
+	}
+	store.RecordDir("docs", a)
+
+	if got := store.DirChanges("src"); got != 2 {
+		t.Errorf("DirChanges(src) = %d, want 2", got)
+	}
+	if got := store.DirChanges("docs"); got != 0 {
+		t.Errorf("DirChanges(docs) = %d, want 0", got)
+	}
+	if got := store.DirChanges("missing"); got != 0 {
+		t.Errorf("DirChanges(missing) = %d, want 0", got)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close() //nolint:errcheck // Close() in a test
+
+	reopened.RecordDir("src", b)
+	if got := reopened.DirChanges("src"); got != 3 {
+		t.Errorf("DirChanges(src) after reopen = %d, want 3", got)
+	}
+
+	if n := reopened.PruneActivity("", map[string]struct{}{"src": {}}); n != 1 {
+		t.Errorf("PruneActivity() = %d, want 1", n)
+	}
+	if got := reopened.DirChanges("src"); got != 3 {
+		t.Errorf("DirChanges(src) after prune = %d, want 3", got)
+	}
+}
+
+func TestDamagedBookkeeping(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := store.PutBlob(&object.Blob{Content: []byte("one")}); err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	store.RecordDir("src", object.HashBytes([]byte("a")))
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for _, name := range []string{dedupFile, activityFile} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("garbage"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() with damaged bookkeeping error = %v", err)
+	}
+	if got := reopened.Warnings(); len(got) != 2 {
+		t.Errorf("Warnings() = %q, want one per damaged file", got)
+	}
+	if got := reopened.Stats().Dedup; got != (object.DedupStats{}) {
+		t.Errorf("Stats().Dedup = %+v, want zero after a reset", got)
+	}
+
+	// both are written whole again
+	if _, err := reopened.PutBlob(&object.Blob{Content: []byte("two")}); err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	reopened.RecordDir("src", object.HashBytes([]byte("b")))
+	if err := reopened.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	again, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer again.Close() //nolint:errcheck // Close() in a test
+	if got := again.Warnings(); len(got) != 0 {
+		t.Errorf("Warnings() after rewrite = %q, want none", got)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	root := object.HashBytes([]byte("root"))
+
+	if _, err := store.GetProvenance(root); !os.IsNotExist(err) {
+		t.Fatalf("GetProvenance() missing error = %v, want not exist", err)
+	}
+
+	for _, host := range []string{"first", "second"} {
+		if err := store.PutProvenance(&object.Provenance{Root: root, Time: time.Unix(1, 0), Hostname: host}); err != nil {
+			t.Fatalf("PutProvenance() error = %v", err)
+		}
+	}
+
+	got, err := store.GetProvenance(root)
+	if err != nil {
+		t.Fatalf("GetProvenance() error = %v", err)
+	}
+	if got.Hostname != "second" {
+		t.Errorf("Hostname = %q, want latest record %q", got.Hostname, "second")
+	}
+
+	earlier := object.HashBytes([]byte("earlier"))
+	if err := store.PutProvenance(&object.Provenance{Root: earlier, Time: time.Unix(0, 0)}); err != nil {
+		t.Fatalf("PutProvenance() error = %v", err)
+	}
+	all, err := store.ListProvenance()
+	if err != nil {
+		t.Fatalf("ListProvenance() error = %v", err)
+	}
+	if len(all) != 2 || all[0].Root != earlier || all[1].Root != root {
+		t.Errorf("ListProvenance() = %v, want [earlier, root] oldest first", all)
+	}
+}
+
+func TestRootHistory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	a, b := object.HashBytes([]byte("a")), object.HashBytes([]byte("b"))
+	put := func(root object.Hash, sec int64) {
+		t.Helper()
+		p := &object.Provenance{Root: root, Time: time.Unix(sec, 0), Settings: map[string]string{"path": "/src\tdir"}}
+		if err := store.PutProvenance(p); err != nil {
+			t.Fatalf("PutProvenance() error = %v", err)
+		}
+	}
+	put(a, 1)
+	// recorded before the log existed
+	if err := os.Remove(filepath.Join(dir, rootLogFile)); err != nil {
+		t.Fatal(err)
+	}
+	put(b, 2)
+	put(a, 3) // a revert
+	f, err := os.OpenFile(filepath.Join(dir, rootLogFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("torn\t"); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	got, err := store.RootHistory()
+	if err != nil {
+		t.Fatalf("RootHistory() error = %v", err)
+	}
+	var roots []object.Hash
+	for _, r := range got {
+		roots = append(roots, r.Root)
+		if r.Path != "/src\tdir" {
+			t.Errorf("record of %s has path %q, want /src\\tdir", r.Root, r.Path)
+		}
+	}
+	// a's record from before the log is replaced by its logged ones
+	if want := []object.Hash{b, a}; !slices.Equal(roots, want) {
+		t.Errorf("RootHistory() roots = %v, want %v", roots, want)
+	}
+
+	put(b, 4)
+	got, err = store.RootHistory()
+	if err != nil {
+		t.Fatalf("RootHistory() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Root != b || got[1].Root != a || got[2].Root != b {
+		t.Errorf("RootHistory() after recording b again = %v, want b, a, b", got)
+	}
+}
+
 func TestObjectPath(t *testing.T) {
 	t.Parallel()
 
@@ -488,6 +969,119 @@ func TestBlobStorage(t *testing.T) {
 	})
 }
 
+func TestScratch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	stored, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	kept, err := stored.PutBlob(&object.Blob{Content: []byte("kept")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	if err := stored.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	scratch, err := Open(dir, WithScratch())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	blob, err := scratch.PutBlob(&object.Blob{Content: []byte("preview")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	streamed, err := scratch.PutBlobFrom(strings.NewReader("streamed"), int64(len("streamed")))
+	if err != nil {
+		t.Fatalf("PutBlobFrom() error = %v", err)
+	}
+	tree, err := scratch.PutTree(&object.Tree{Entries: []object.Entry{
+		{Name: "a", Mode: object.ModeRegular, Size: 7, Hash: blob},
+		{Name: "b", Mode: object.ModeRegular, Size: 4, Hash: kept},
+	}})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	for _, h := range []object.Hash{kept, blob, streamed, tree} {
+		if !scratch.HasObject(h) {
+			t.Errorf("HasObject(%s) = false in the scratch store", h)
+		}
+	}
+	if got, err := scratch.GetBlob(streamed); err != nil || string(got.Content) != "streamed" {
+		t.Errorf("GetBlob() = %v, error = %v, want streamed", got, err)
+	}
+	rc, n, err := scratch.OpenObject(blob)
+	if err != nil {
+		t.Fatalf("OpenObject() error = %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil || int64(len(data)) != n {
+		t.Errorf("OpenObject() read %d bytes, error = %v, want %d", len(data), err, n)
+	}
+	if err := scratch.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close() //nolint:errcheck // Close() in a test
+	for _, h := range []object.Hash{blob, streamed, tree} {
+		if reopened.HasObject(h) {
+			t.Errorf("HasObject(%s) = true after the scratch store closed, want nothing stored", h)
+		}
+	}
+	if reopened.dedupBase.Written != 1 {
+		t.Errorf("dedup stats = %+v, want only the stored blob counted", reopened.dedupBase)
+	}
+}
+
+func TestPutBlobFrom(t *testing.T) {
+	t.Parallel()
+
+	for _, alg := range []object.Algorithm{object.SHA256, object.BLAKE3} {
+		t.Run(alg.String(), func(t *testing.T) {
+			t.Parallel()
+
+			s, err := Open(t.TempDir(), WithAlgorithm(alg))
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer s.Close() //nolint:errcheck // Close() in a test
+
+			content := bytes.Repeat([]byte("0123456789"), 1<<14)
+			h, err := s.PutBlobFrom(bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				t.Fatalf("PutBlobFrom() error = %v", err)
+			}
+			if want := (&object.Blob{Content: content, Algorithm: alg}).Hash(); h != want {
+				t.Errorf("PutBlobFrom() hash = %s, want %s", h, want)
+			}
+			got, err := s.ReadFile(h)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Error("ReadFile() of a streamed blob differs from its content")
+			}
+			if again, err := s.PutBlob(&object.Blob{Content: content}); err != nil || again != h {
+				t.Errorf("PutBlob() of the same content = %s, %v; want %s", again, err, h)
+			}
+
+			if _, err := s.PutBlobFrom(bytes.NewReader(content[:10]), 11); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("PutBlobFrom() of a short reader error = %v, want ErrUnexpectedEOF", err)
+			}
+			if n := s.Stats().ObjectCount; n != 1 {
+				t.Errorf("store holds %d objects, want 1", n)
+			}
+		})
+	}
+}
+
 func TestTreeStorage(t *testing.T) {
 	t.Parallel()
 
@@ -520,8 +1114,8 @@ func TestTreeStorage(t *testing.T) {
 		{
 			name: "unicode filenames",
 			entries: []object.Entry{
-				{Name: "文件.txt", Mode: object.ModeRegular, Size: 42, Hash: hash1},
 				{Name: "données.json", Mode: object.ModeRegular, Size: 256, Hash: hash2},
+				{Name: "文件.txt", Mode: object.ModeRegular, Size: 42, Hash: hash1},
 			},
 		},
 		{
@@ -539,11 +1133,11 @@ func TestTreeStorage(t *testing.T) {
 		{
 			name: "large tree with many entries",
 			entries: []object.Entry{
+				{Name: "dir1", Mode: object.ModeDirectory, Size: 0, Hash: hash1},
+				{Name: "dir2", Mode: object.ModeDirectory, Size: 0, Hash: hash2},
 				{Name: "file1.txt", Mode: object.ModeRegular, Size: 100, Hash: hash1},
 				{Name: "file2.txt", Mode: object.ModeRegular, Size: 200, Hash: hash2},
 				{Name: "file3.txt", Mode: object.ModeExecutable, Size: 300, Hash: hash3},
-				{Name: "dir1", Mode: object.ModeDirectory, Size: 0, Hash: hash1},
-				{Name: "dir2", Mode: object.ModeDirectory, Size: 0, Hash: hash2},
 				{Name: "link1", Mode: object.ModeSymlink, Size: 50, Hash: hash3},
 			},
 		},
@@ -616,6 +1210,324 @@ func TestTreeStorage(t *testing.T) {
 	}
 }
 
+func TestSnapshotStorage(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	treeHash, err := store.PutTree(&object.Tree{})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+
+	first := &object.Snapshot{Root: treeHash, Time: time.Unix(1700000000, 0)}
+	firstHash, err := store.PutSnapshot(first)
+	if err != nil {
+		t.Fatalf("PutSnapshot() error = %v", err)
+	}
+	second := &object.Snapshot{Root: treeHash, Parent: firstHash, Time: time.Unix(1700000060, 0), Message: "again"}
+	secondHash, err := store.PutSnapshot(second)
+	if err != nil {
+		t.Fatalf("PutSnapshot() error = %v", err)
+	}
+	if secondHash == firstHash {
+		t.Fatal("snapshots with different parents share a hash")
+	}
+
+	got, err := store.GetSnapshot(secondHash)
+	if err != nil {
+		t.Fatalf("GetSnapshot() error = %v", err)
+	}
+	if got.Root != treeHash || got.Parent != firstHash || got.Message != "again" {
+		t.Errorf("GetSnapshot() = %+v, want %+v", got, second)
+	}
+
+	if _, err := store.GetSnapshot(treeHash); err == nil {
+		t.Error("GetSnapshot() of a tree: expected error, got nil")
+	}
+}
+
+func TestFastStats(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	const n = 4096
+	for i := range n {
+		if _, err := store.PutBlob(&object.Blob{Content: []byte{byte(i), byte(i >> 8)}}); err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+	}
+
+	exact := store.Stats()
+	if exact.ObjectCount != n || exact.Estimated() {
+		t.Errorf("Stats() = %d objects, estimated %v; want %d exact", exact.ObjectCount, exact.Estimated(), n)
+	}
+	if full := store.FastStats(1000); full.ObjectCount != n || full.Estimated() {
+		t.Errorf("FastStats(1000) = %d objects, estimated %v; want %d exact", full.ObjectCount, full.Estimated(), n)
+	}
+
+	fast := store.FastStats(32)
+	if !fast.Estimated() || fast.SampledShards != 32 {
+		t.Errorf("FastStats(32) sampled %d shards, estimated %v", fast.SampledShards, fast.Estimated())
+	}
+	if fast.ObjectCount < n*3/4 || fast.ObjectCount > n*5/4 {
+		t.Errorf("FastStats(32).ObjectCount = %d, want within 25%% of %d", fast.ObjectCount, n)
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir, WithAlgorithm(object.BLAKE3))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if s.Algorithm() != object.BLAKE3 {
+		t.Errorf("Algorithm() = %s, want blake3", s.Algorithm())
+	}
+
+	blob := &object.Blob{Content: []byte("content")}
+	h, err := s.PutBlob(blob)
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	if want := object.BLAKE3.Sum(blob.Content); h != want {
+		t.Errorf("PutBlob() = %s, want blake3 hash %s", h, want)
+	}
+	treeHash, err := s.PutTree(&object.Tree{Entries: []object.Entry{{Name: "f", Hash: h, Size: 7}}})
+	if err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	tree, err := s.GetTree(treeHash)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	if tree.Algorithm != object.BLAKE3 {
+		t.Errorf("stored tree algorithm = %s, want blake3", tree.Algorithm)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// the config fixes the algorithm for later opens
+	if alg, ok, err := ReadAlgorithm(dir); err != nil || !ok || alg != object.BLAKE3 {
+		t.Errorf("ReadAlgorithm() = %s, %v, %v; want blake3, true, nil", alg, ok, err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if reopened.Algorithm() != object.BLAKE3 {
+		t.Errorf("reopened Algorithm() = %s, want blake3", reopened.Algorithm())
+	}
+	_ = reopened.Close()
+	if _, err := Open(dir, WithAlgorithm(object.SHA256)); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("Open() with sha256: error = %v, want ErrAlgorithmMismatch", err)
+	}
+
+	// a store holding objects but no config predates the config file
+	legacy := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(legacy, objectsDir, "ab"), 0o750); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(legacy, objectsDir, "ab", "cd"), nil, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := Open(legacy, WithAlgorithm(object.BLAKE3)); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("Open() legacy store with blake3: error = %v, want ErrAlgorithmMismatch", err)
+	}
+	ls, err := Open(legacy)
+	if err != nil {
+		t.Fatalf("Open() legacy store error = %v", err)
+	}
+	defer ls.Close() //nolint:errcheck // Close() in a test
+	if ls.Algorithm() != object.SHA256 {
+		t.Errorf("legacy Algorithm() = %s, want sha256", ls.Algorithm())
+	}
+}
+
+func TestSettings(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir, WithAlgorithm(object.BLAKE3))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if got := s.Settings(); len(got) != 0 {
+		t.Errorf("new store Settings() = %v, want none", got)
+	}
+	for _, kv := range [][2]string{{"concurrency", "4"}, {"ignore-filename", ".gitignore"}, {"concurrency", ""}} {
+		if err := s.SetSetting(kv[0], kv[1]); err != nil {
+			t.Fatalf("SetSetting(%q, %q) error = %v", kv[0], kv[1], err)
+		}
+	}
+	if err := s.SetSetting("", "x"); err == nil {
+		t.Error("SetSetting() with an empty key: error = nil")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// settings survive a reopen and sit beside the algorithm
+	want := map[string]string{"ignore-filename": ".gitignore"}
+	cfg, ok, err := ReadConfig(dir)
+	if err != nil || !ok || cfg.Algorithm != object.BLAKE3 || !maps.Equal(cfg.Settings, want) {
+		t.Errorf("ReadConfig() = %+v, %v, %v; want blake3 and %v", cfg, ok, err, want)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close() //nolint:errcheck // Close() in a test
+	if got := reopened.Settings(); !maps.Equal(got, want) {
+		t.Errorf("reopened Settings() = %v, want %v", got, want)
+	}
+
+	if _, ok, err := ReadConfig(t.TempDir()); ok || err != nil {
+		t.Errorf("ReadConfig() of an empty directory = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestChunkStats(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	put := func(content string) object.Chunk {
+		t.Helper()
+		h, err := store.PutBlob(&object.Blob{Content: []byte(content)})
+		if err != nil {
+			t.Fatalf("PutBlob() error = %v", err)
+		}
+		return object.Chunk{Hash: h, Size: uint32(len(content))} //nolint:gosec // short test content
+	}
+	shared, a, b := put("shared"), put("aa"), put("bbbb")
+
+	for _, m := range []*object.Manifest{
+		{Chunks: []object.Chunk{shared, a}},
+		{Chunks: []object.Chunk{shared, b, shared}},
+	} {
+		if _, err := store.PutManifest(m); err != nil {
+			t.Fatalf("PutManifest() error = %v", err)
+		}
+	}
+
+	got, err := store.ChunkStats(10)
+	if err != nil {
+		t.Fatalf("ChunkStats() error = %v", err)
+	}
+	if got.Manifests != 2 || got.Chunks != 3 || got.References != 5 {
+		t.Errorf("ChunkStats() = %+v, want 2 manifests, 3 chunks, 5 references", got)
+	}
+	if got.StoredBytes != 12 || got.LogicalBytes != 24 {
+		t.Errorf("bytes stored/logical = %d/%d, want 12/24", got.StoredBytes, got.LogicalBytes)
+	}
+	if got.AvgChunkSize() != 4 {
+		t.Errorf("AvgChunkSize() = %d, want 4", got.AvgChunkSize())
+	}
+	if len(got.Top) != 1 || got.Top[0].Hash != shared.Hash || got.Top[0].Refs != 3 {
+		t.Errorf("Top = %+v, want only the shared chunk with 3 refs", got.Top)
+	}
+
+	if got, _ := store.ChunkStats(0); len(got.Top) != 0 {
+		t.Errorf("ChunkStats(0).Top = %+v, want empty", got.Top)
+	}
+}
+
+func TestObjectStats(t *testing.T) {
+	t.Parallel()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close() //nolint:errcheck // Close() in a test
+
+	big, err := store.PutBlob(&object.Blob{Content: bytes.Repeat([]byte("x"), 4096)})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	small, err := store.PutBlob(&object.Blob{Content: []byte("small")})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	if _, err := store.PutTree(&object.Tree{Entries: []object.Entry{{Name: "big", Mode: object.ModeRegular, Hash: big}}}); err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+	// packed objects count the same as loose ones
+	if _, err := store.Repack(); err != nil {
+		t.Fatalf("Repack() error = %v", err)
+	}
+	if _, err := store.PutTree(&object.Tree{Entries: []object.Entry{{Name: "small", Mode: object.ModeRegular, Hash: small}}}); err != nil {
+		t.Fatalf("PutTree() error = %v", err)
+	}
+
+	got, err := store.ObjectStats(2)
+	if err != nil {
+		t.Fatalf("ObjectStats() error = %v", err)
+	}
+	if got.Types[TypeBlob].Count != 2 || got.Types[TypeTree].Count != 2 || len(got.Types) != 2 {
+		t.Errorf("ObjectStats().Types = %+v, want 2 blobs and 2 trees", got.Types)
+	}
+	stats := store.Stats()
+	if sum := got.Types[TypeBlob].Bytes + got.Types[TypeTree].Bytes; sum != stats.ObjectBytes || sum < 4096 {
+		t.Errorf("bytes by type sum to %d, Stats().ObjectBytes = %d", sum, stats.ObjectBytes)
+	}
+	if len(got.Largest) != 2 || got.Largest[0].Hash != big || got.Largest[0].Size < got.Largest[1].Size {
+		t.Errorf("ObjectStats().Largest = %+v, want the big blob first of 2", got.Largest)
+	}
+	if least, most, _ := stats.ShardSpread(); len(stats.Shards) != 256 || least != 0 || most != 1 {
+		t.Errorf("ShardSpread() = %d, %d over %d shards; want 0, 1 over 256", least, most, len(stats.Shards))
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if store.Stats().HasCache {
+		t.Error("Stats().HasCache before any lookup = true")
+	}
+	modTime := time.Unix(1700000000, 0)
+	store.UpdateCache("a.txt", 1, modTime, object.ZeroHash)
+	store.LookupCache("a.txt", 1, modTime)
+	store.LookupCache("a.txt", 2, modTime)
+	store.LookupCache("b.txt", 1, modTime)
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// a later session without lookups reports the last one that had them
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close() //nolint:errcheck // Close() in a test
+	got := reopened.Stats()
+	if !got.HasCache || got.Cache.Hits != 1 || got.Cache.Stale != 1 || got.Cache.Misses != 1 || got.Cache.Time.IsZero() {
+		t.Errorf("Stats().Cache = %+v, %v; want 1 hit, 1 stale, 1 miss with a time", got.Cache, got.HasCache)
+	}
+}
+
 func TestConcurrency(t *testing.T) {
 	t.Parallel()
 
@@ -652,20 +1564,20 @@ func TestConcurrency(t *testing.T) {
 
 		// verify the index contains the expected number of unique paths
 		s.indexMu.RLock()
-		indexSize := len(s.index)
+		indexSize := s.index.len()
 		s.indexMu.RUnlock()
 
 		if indexSize == 0 {
 			t.Error("index is empty after concurrent updates")
 		}
 
-		// verify dirty flag was set
+		// verify the updates await a flush
 		s.indexMu.RLock()
-		dirty := s.dirty
+		unflushed := len(s.unflushed)
 		s.indexMu.RUnlock()
 
-		if !dirty {
-			t.Error("dirty flag not set after concurrent updates")
+		if unflushed == 0 {
+			t.Error("no unflushed updates after concurrent updates")
 		}
 	})
 
@@ -769,7 +1681,7 @@ func TestConcurrency(t *testing.T) {
 
 		// verify store is in consistent state
 		s.indexMu.RLock()
-		indexSize := len(s.index)
+		indexSize := s.index.len()
 		s.indexMu.RUnlock()
 
 		if indexSize == 0 {
@@ -1168,3 +2080,46 @@ func TestConcurrency(t *testing.T) {
 		}
 	})
 }
+
+func TestPutObjectTornWrite(t *testing.T) {
+	t.Parallel()
+
+	errDiskFull := errors.New("disk full")
+	var fail atomic.Bool
+	fsys := &vfs.FaultFS{FS: vfs.OS{}, Inject: func(op vfs.Op, _ string) error {
+		if op == vfs.OpWrite && fail.Load() {
+			return errDiskFull
+		}
+		return nil
+	}}
+	s, err := Open(t.TempDir(), WithFS(fsys))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	blob := &object.Blob{Content: []byte("some content that will be torn")}
+	fail.Store(true)
+	if _, err := s.PutBlob(blob); !errors.Is(err, errDiskFull) {
+		t.Fatalf("PutBlob() error = %v, want %v", err, errDiskFull)
+	}
+	h := blob.Hash()
+	if s.HasObject(h) {
+		t.Error("HasObject() = true after a torn write")
+	}
+	entries, err := os.ReadDir(filepath.Dir(s.objectPath(h)))
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("shard holds %d files after a torn write, want 0", len(entries))
+	}
+
+	fail.Store(false)
+	if _, err := s.PutBlob(blob); err != nil {
+		t.Fatalf("PutBlob() retry error = %v", err)
+	}
+	if got, err := s.GetBlob(h); err != nil || string(got.Content) != string(blob.Content) {
+		t.Errorf("GetBlob() = %v, %v", got, err)
+	}
+}
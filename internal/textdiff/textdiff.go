@@ -0,0 +1,265 @@
+// Package textdiff renders line-level unified diffs.
+package textdiff
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines around each change.
+const DefaultContext = 3
+
+// binarySniffLen is how much of a file IsBinary inspects, as git does.
+const binarySniffLen = 8000
+
+// IsBinary reports whether data looks binary: a NUL byte near the start.
+func IsBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0
+}
+
+type op byte
+
+const (
+	opEqual  op = ' '
+	opDelete op = '-'
+	opInsert op = '+'
+)
+
+type edit struct {
+	op   op
+	line string // including its newline, if it has one
+}
+
+// Hunk is one region of change and the unchanged lines around it.
+type Hunk struct {
+	// OldStart and NewStart are the 1-based first lines of the hunk on each
+	// side; an empty range names the line before it, as the header does.
+	OldStart, OldLines int
+	NewStart, NewLines int
+
+	// OldChange and NewChange are the 1-based lines of the first change on
+	// each side, for jumping straight to it: the first deleted or inserted
+	// line, or, on a side with none, the line the change sits at.
+	OldChange, NewChange int
+
+	// Lines are the hunk's lines without their newlines, each prefixed with
+	// ' ', '-', or '+'. A line missing its final newline is followed by a
+	// "\\ No newline at end of file" marker.
+	Lines []string
+}
+
+// Header returns the hunk's "@@ -old +new @@" line, without a newline.
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+// Hunks returns the changes turning old into new, with context unchanged
+// lines around each, or nil if they are equal.
+func Hunks(old, new []byte, context int) []Hunk {
+	oldLines, newLines := splitLines(old), splitLines(new)
+	edits := diffLines(oldLines, newLines)
+
+	// oldLine[i] and newLine[i] count the lines before edits[i]
+	oldLine := make([]int, len(edits)+1)
+	newLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if e.op != opInsert {
+			oldLine[i+1]++
+		}
+		if e.op != opDelete {
+			newLine[i+1]++
+		}
+	}
+
+	var hunks []Hunk
+	for i := 0; i < len(edits); {
+		for i < len(edits) && edits[i].op == opEqual {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// extend the hunk while changes are close enough to share context
+		last := i
+		for j := i; j < len(edits) && j-last-1 <= 2*context; j++ {
+			if edits[j].op != opEqual {
+				last = j
+			}
+		}
+		start, end := max(i-context, 0), min(last+context+1, len(edits))
+
+		h := Hunk{
+			OldStart: rangeStart(oldLine[start], oldLine[end]-oldLine[start]),
+			OldLines: oldLine[end] - oldLine[start],
+			NewStart: rangeStart(newLine[start], newLine[end]-newLine[start]),
+			NewLines: newLine[end] - newLine[start],
+			// a side with no lines at all still gets line 1
+			OldChange: max(min(oldLine[i]+1, len(oldLines)), 1),
+			NewChange: max(min(newLine[i]+1, len(newLines)), 1),
+		}
+		for _, e := range edits[start:end] {
+			line, hasNewline := strings.CutSuffix(e.line, "\n")
+			h.Lines = append(h.Lines, string(e.op)+line)
+			if !hasNewline {
+				h.Lines = append(h.Lines, "\\ No newline at end of file")
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// Unified returns the hunks of a unified diff turning old into new, with
+// context unchanged lines around each change, or "" if they are equal. The
+// caller writes the ---/+++ header.
+func Unified(old, new []byte, context int) string {
+	var b strings.Builder
+	for _, h := range Hunks(old, new, context) {
+		b.WriteString(h.Header())
+		b.WriteByte('\n')
+		for _, line := range h.Lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// rangeStart is the first line of a range of count lines following before,
+// or before itself for an empty range.
+func rangeStart(before, count int) int {
+	if count == 0 {
+		return before
+	}
+	return before + 1
+}
+
+// hunkRange formats a hunk's line range the way GNU diff does: a count of
+// 1 is implied.
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits data after each newline; a final line without one is
+// kept as is.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxEditCost bounds the Myers search, whose trace grows with the square
+// of the edit distance; beyond it the differing middle is replaced whole.
+const maxEditCost = 2000
+
+// diffLines returns an edit script from a to b: the shortest, found with
+// Myers' algorithm, unless the files differ by more than maxEditCost lines.
+func diffLines(a, b []string) []edit {
+	var prefix, suffix []edit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, edit{op: opEqual, line: a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, edit{op: opEqual, line: a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	edits := prefix
+	if middle, ok := myers(a, b); ok {
+		edits = append(edits, middle...)
+	} else {
+		for _, line := range a {
+			edits = append(edits, edit{op: opDelete, line: line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{op: opInsert, line: line})
+		}
+	}
+	for i := len(suffix) - 1; i >= 0; i-- {
+		edits = append(edits, suffix[i])
+	}
+	return edits
+}
+
+// myers finds a shortest edit script, or reports false if it would cost
+// more than maxEditCost.
+func myers(a, b []string) ([]edit, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEditCost)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v[k] for k in [-d-1, d+1] before round d, enough to
+	// walk the path back
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down: insert
+			} else {
+				x = v[offset+k-1] + 1 // right: delete
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func backtrack(a, b []string, trace [][]int) []edit {
+	x, y := len(a), len(b)
+	var edits []edit
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v(k-1) < v(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{op: opEqual, line: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{op: opInsert, line: b[y-1]})
+			} else {
+				edits = append(edits, edit{op: opDelete, line: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	slices.Reverse(edits)
+	return edits
+}
@@ -0,0 +1,200 @@
+package textdiff
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{name: "equal", old: "a\nb\n", new: "a\nb\n", want: ""},
+		{
+			name: "change in the middle",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant changes get separate hunks",
+			old:  "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			new:  "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			want: "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			old:  "a\n1\n2\n3\n4\n5\n6\nb\n",
+			new:  "A\n1\n2\n3\n4\n5\n6\nB\n",
+			want: "@@ -1,8 +1,8 @@\n-a\n+A\n 1\n 2\n 3\n 4\n 5\n 6\n-b\n+B\n",
+		},
+		{
+			name: "added file",
+			old:  "",
+			new:  "x\ny\n",
+			want: "@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name: "deleted file",
+			old:  "x\n",
+			new:  "",
+			want: "@@ -1 +0,0 @@\n-x\n",
+		},
+		{
+			name: "missing final newline",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Unified([]byte(tt.old), []byte(tt.new), DefaultContext); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunksChangeLines(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want [][2]int // OldChange, NewChange per hunk
+	}{
+		{name: "change in the middle", old: "1\n2\n3\n4\n5\n6\n7\n", new: "1\n2\n3\n4\nfive\n6\n7\n", want: [][2]int{{5, 5}}},
+		{name: "distant changes", old: "a\n1\n2\n3\n4\n5\n6\n7\nb\n", new: "A\n1\n2\n3\n4\n5\n6\n7\nB\n", want: [][2]int{{1, 1}, {9, 9}}},
+		{name: "insertion", old: "a\nc\n", new: "a\nb\nc\n", want: [][2]int{{2, 2}}},
+		{name: "deletion at the end", old: "a\nb\nc\n", new: "a\nb\n", want: [][2]int{{3, 2}}},
+		{name: "added file", old: "", new: "x\n", want: [][2]int{{1, 1}}},
+		{name: "deleted file", old: "x\ny\n", new: "", want: [][2]int{{1, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			hunks := Hunks([]byte(tt.old), []byte(tt.new), DefaultContext)
+			if len(hunks) != len(tt.want) {
+				t.Fatalf("Hunks() returned %d hunks, want %d", len(hunks), len(tt.want))
+			}
+			for i, h := range hunks {
+				if got := [2]int{h.OldChange, h.NewChange}; got != tt.want[i] {
+					t.Errorf("hunk %d change lines = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	t.Parallel()
+
+	r := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // deterministic test data
+	randomLines := func() []string {
+		lines := make([]string, r.IntN(12))
+		for i := range lines {
+			lines[i] = string(rune('a'+r.IntN(3))) + "\n"
+		}
+		return lines
+	}
+
+	for range 500 {
+		a, b := randomLines(), randomLines()
+		edits := diffLines(a, b)
+
+		var gotA, gotB []string
+		changes := 0
+		for _, e := range edits {
+			if e.op != opInsert {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != opDelete {
+				gotB = append(gotB, e.line)
+			}
+			if e.op != opEqual {
+				changes++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) = %v does not rebuild both sides", a, b, edits)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); changes != want {
+			t.Fatalf("diffLines(%q, %q) made %d changes, want %d", a, b, changes, want)
+		}
+	}
+}
+
+func lcs(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestDiffLinesOverCost(t *testing.T) {
+	t.Parallel()
+
+	a := make([]string, maxEditCost)
+	b := make([]string, maxEditCost)
+	for i := range a {
+		a[i], b[i] = "a\n", "b\n"
+	}
+	edits := diffLines(append([]string{"same\n"}, a...), append([]string{"same\n"}, b...))
+	if len(edits) != 1+2*maxEditCost || edits[0].op != opEqual || edits[1].op != opDelete || edits[len(edits)-1].op != opInsert {
+		t.Errorf("diffLines() over maxEditCost did not replace the middle whole")
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	t.Parallel()
+
+	late := make([]byte, binarySniffLen+1)
+	for i := range late {
+		late[i] = 'a'
+	}
+	late[binarySniffLen] = 0
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "empty", data: nil, want: false},
+		{name: "text", data: []byte("héllo\n"), want: false},
+		{name: "nul", data: []byte("a\x00b"), want: true},
+		{name: "nul past the sniffed prefix", data: late, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsBinary(tt.data); got != tt.want {
+				t.Errorf("IsBinary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// Package treebuild assembles smerkle trees from path-addressed entries, for
+// sources that aren't directories on disk (git trees, archives, images).
+package treebuild
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+type node struct {
+	entry    object.Entry     // Name, Mode, Size and Hash for non-directories
+	children map[string]*node // non-nil for directories
+}
+
+func newDir() *node {
+	return &node{entry: object.Entry{Mode: object.ModeDirectory}, children: map[string]*node{}}
+}
+
+// Builder holds an in-memory directory tree. Paths are slash-separated and
+// relative to the root; a leading "/" or "./" is ignored.
+type Builder struct {
+	root *node
+}
+
+func New() *Builder {
+	return &Builder{root: newDir()}
+}
+
+// Load returns a Builder holding the stored tree at root, so changes can be
+// applied on top of it. Entries keep every field they were stored with.
+func Load(s *store.Store, root object.Hash) (*Builder, error) {
+	n, err := load(s, root)
+	if err != nil {
+		return nil, err
+	}
+	return &Builder{root: n}, nil
+}
+
+func load(s *store.Store, h object.Hash) (*node, error) {
+	tree, err := s.GetTree(h)
+	if err != nil {
+		return nil, fmt.Errorf("get tree %s: %w", h, err)
+	}
+	n := newDir()
+	for _, e := range tree.Entries {
+		if e.Mode != object.ModeDirectory {
+			n.children[e.Name] = &node{entry: e}
+			continue
+		}
+		child, err := load(s, e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		child.entry = e
+		n.children[e.Name] = child
+	}
+	return n, nil
+}
+
+// split cleans p into its components; the root has none.
+func split(p string) []string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// dir returns the directory at parts, creating it (and replacing any
+// non-directory in the way) as needed.
+func (b *Builder) dir(parts []string) *node {
+	n := b.root
+	for _, name := range parts {
+		child, ok := n.children[name]
+		if !ok || child.children == nil {
+			child = newDir()
+			n.children[name] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// Add places a non-directory entry at p, replacing whatever was there.
+// e.Name is set from p.
+func (b *Builder) Add(p string, e object.Entry) {
+	parts := split(p)
+	if len(parts) == 0 {
+		return
+	}
+	parent := b.dir(parts[:len(parts)-1])
+	e.Name = parts[len(parts)-1]
+	parent.children[e.Name] = &node{entry: e}
+}
+
+// Mkdir ensures a directory exists at p, replacing a non-directory there.
+func (b *Builder) Mkdir(p string) {
+	b.dir(split(p))
+}
+
+// Remove deletes p and everything below it. Missing paths are ignored.
+func (b *Builder) Remove(p string) {
+	parts := split(p)
+	if len(parts) == 0 {
+		b.root = newDir()
+		return
+	}
+	parent := b.lookup(parts[:len(parts)-1])
+	if parent != nil && parent.children != nil {
+		delete(parent.children, parts[len(parts)-1])
+	}
+}
+
+// Clear empties the directory at p, keeping the directory itself.
+func (b *Builder) Clear(p string) {
+	if n := b.lookup(split(p)); n != nil && n.children != nil {
+		n.children = map[string]*node{}
+	}
+}
+
+// Lookup returns the non-directory entry at p.
+func (b *Builder) Lookup(p string) (object.Entry, bool) {
+	n := b.lookup(split(p))
+	if n == nil || n.children != nil {
+		return object.Entry{}, false
+	}
+	return n.entry, true
+}
+
+func (b *Builder) lookup(parts []string) *node {
+	n := b.root
+	for _, name := range parts {
+		if n.children == nil {
+			return nil
+		}
+		child, ok := n.children[name]
+		if !ok {
+			return nil
+		}
+		n = child
+	}
+	return n
+}
+
+// Write stores every directory bottom-up and returns the root tree hash.
+// Entries are ordered exactly as the walker orders them, so a tree built
+// here hashes the same as the equivalent directory on disk.
+func (b *Builder) Write(s *store.Store) (object.Hash, error) {
+	return write(s, b.root)
+}
+
+func write(s *store.Store, n *node) (object.Hash, error) {
+	entries := make([]object.Entry, 0, len(n.children))
+	for name, child := range n.children {
+		e := child.entry
+		e.Name = name
+		if child.children != nil {
+			h, err := write(s, child)
+			if err != nil {
+				return object.ZeroHash, err
+			}
+			e.Mode, e.Hash = object.ModeDirectory, h
+		}
+		entries = append(entries, e)
+	}
+
+	tree := &object.Tree{Entries: entries}
+	tree.SortEntries()
+
+	h, err := s.PutTree(tree)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("put tree: %w", err)
+	}
+	return h, nil
+}
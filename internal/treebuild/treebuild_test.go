@@ -0,0 +1,179 @@
+package treebuild
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+func openStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func add(t *testing.T, s *store.Store, b *Builder, p, content string) {
+	t.Helper()
+	h, err := s.PutBlob(&object.Blob{Content: []byte(content)})
+	if err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	b.Add(p, object.Entry{Mode: object.ModeRegular, Size: int64(len(content)), Hash: h})
+}
+
+func TestWriteMatchesWalk(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for p, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c"} {
+		full := filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(full), 0o750); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0o750); err != nil {
+		t.Fatalf("Mkdir() error = %v", err)
+	}
+
+	s := openStore(t)
+	walked, err := walker.Walk(context.Background(), root, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	b := New()
+	add(t, s, b, "./sub/deep/c.txt", "c")
+	add(t, s, b, "/a.txt", "a")
+	add(t, s, b, "sub/b.txt", "b")
+	b.Mkdir("empty/")
+	got, err := b.Write(s)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if got != walked.Hash {
+		t.Errorf("Write() = %s, want walked hash %s", got, walked.Hash)
+	}
+}
+
+func TestMutations(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	b := New()
+	add(t, s, b, "keep/x", "x")
+	add(t, s, b, "gone/y", "y")
+	add(t, s, b, "opaque/z", "z")
+	add(t, s, b, "replaced", "file")
+
+	b.Remove("gone")
+	b.Clear("opaque")
+	add(t, s, b, "replaced/inner", "now a dir")
+
+	if _, ok := b.Lookup("keep/x"); !ok {
+		t.Error("Lookup(keep/x) = missing, want present")
+	}
+	for _, p := range []string{"gone/y", "opaque/z", "replaced"} {
+		if _, ok := b.Lookup(p); ok {
+			t.Errorf("Lookup(%s) = present, want missing", p)
+		}
+	}
+	if e, ok := b.Lookup("replaced/inner"); !ok || e.Name != "inner" {
+		t.Errorf("Lookup(replaced/inner) = %+v, %v", e, ok)
+	}
+
+	h, err := b.Write(s)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	tree, err := s.GetTree(h)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	var names []string
+	for _, e := range tree.Entries {
+		names = append(names, e.Name)
+	}
+	if want := []string{"keep", "opaque", "replaced"}; len(names) != len(want) ||
+		names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("root entries = %v, want %v", names, want)
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for p, content := range files {
+		full := filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(full), 0o750); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	s := openStore(t)
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c"})
+
+	// full metadata rides along on every entry, directories included
+	for _, opts := range [][]walker.Option{nil, {walker.WithFullMetadata()}} {
+		walked, err := walker.Walk(context.Background(), root, s, opts...)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		b, err := Load(s, walked.Hash)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if got, err := b.Write(s); err != nil || got != walked.Hash {
+			t.Errorf("Write() of the loaded tree = %s, error = %v, want %s", got, err, walked.Hash)
+		}
+	}
+
+	walked, err := walker.Walk(context.Background(), root, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	b, err := Load(s, walked.Hash)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	add(t, s, b, "sub/deep/d.txt", "d")
+	add(t, s, b, "a.txt", "a2")
+	b.Remove("sub/b.txt")
+	got, err := b.Write(s)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	changed := t.TempDir()
+	writeFiles(t, changed, map[string]string{"a.txt": "a2", "sub/deep/c.txt": "c", "sub/deep/d.txt": "d"})
+	want, err := walker.Walk(context.Background(), changed, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if got != want.Hash {
+		t.Errorf("Write() of the changed tree = %s, want walked hash %s", got, want.Hash)
+	}
+
+	if _, err := Load(s, object.HashBytes([]byte("missing"))); err == nil {
+		t.Error("Load() of a missing tree: error = nil")
+	}
+}
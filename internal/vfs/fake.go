@@ -0,0 +1,206 @@
+package vfs
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// Op names an FS or File operation for FaultFS.
+type Op string
+
+const (
+	OpOpen       Op = "open" // Open and OpenFile
+	OpCreateTemp Op = "create_temp"
+	OpReadFile   Op = "read_file"
+	OpWriteFile  Op = "write_file"
+	OpReadDir    Op = "read_dir"
+	OpStat       Op = "stat"
+	OpLstat      Op = "lstat"
+	OpReadlink   Op = "readlink"
+	OpMkdir      Op = "mkdir" // Mkdir and MkdirAll
+	OpRemove     Op = "remove"
+	OpRename     Op = "rename"
+	OpWrite      Op = "write" // File.Write
+	OpClose      Op = "close" // File.Close
+	OpSync       Op = "sync"  // File.Sync
+)
+
+// FaultFS wraps FS, calling Inject before every operation with its name and
+// path (the directory, for OpCreateTemp; the source, for OpRename). A non-nil
+// result fails the operation with that error. Inject may also change the
+// underlying files, to stage a race at an exact point.
+//
+// A failed OpWrite still writes the first half of its data, leaving a torn
+// file the way a full disk or crash would.
+type FaultFS struct {
+	FS     FS
+	Inject func(op Op, name string) error
+}
+
+var _ FS = (*FaultFS)(nil)
+
+func (f *FaultFS) inject(op Op, name string) error {
+	if f.Inject == nil {
+		return nil
+	}
+	return f.Inject(op, name)
+}
+
+func (f *FaultFS) wrap(file File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *FaultFS) Open(name string) (File, error) {
+	if err := f.inject(OpOpen, name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.FS.Open(name))
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if err := f.inject(OpOpen, name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.FS.OpenFile(name, flag, perm))
+}
+
+func (f *FaultFS) CreateTemp(dir, pattern string) (File, error) {
+	if err := f.inject(OpCreateTemp, dir); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.FS.CreateTemp(dir, pattern))
+}
+
+func (f *FaultFS) ReadFile(name string) ([]byte, error) {
+	if err := f.inject(OpReadFile, name); err != nil {
+		return nil, err
+	}
+	return f.FS.ReadFile(name)
+}
+
+func (f *FaultFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := f.inject(OpWriteFile, name); err != nil {
+		return err
+	}
+	return f.FS.WriteFile(name, data, perm)
+}
+
+func (f *FaultFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.inject(OpReadDir, name); err != nil {
+		return nil, err
+	}
+	return f.FS.ReadDir(name)
+}
+
+func (f *FaultFS) Stat(name string) (fs.FileInfo, error) {
+	if err := f.inject(OpStat, name); err != nil {
+		return nil, err
+	}
+	return f.FS.Stat(name)
+}
+
+func (f *FaultFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := f.inject(OpLstat, name); err != nil {
+		return nil, err
+	}
+	return f.FS.Lstat(name)
+}
+
+func (f *FaultFS) Readlink(name string) (string, error) {
+	if err := f.inject(OpReadlink, name); err != nil {
+		return "", err
+	}
+	return f.FS.Readlink(name)
+}
+
+func (f *FaultFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := f.inject(OpMkdir, name); err != nil {
+		return err
+	}
+	return f.FS.Mkdir(name, perm)
+}
+
+func (f *FaultFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := f.inject(OpMkdir, name); err != nil {
+		return err
+	}
+	return f.FS.MkdirAll(name, perm)
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.inject(OpRemove, name); err != nil {
+		return err
+	}
+	return f.FS.Remove(name)
+}
+
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	if err := f.inject(OpRename, oldpath); err != nil {
+		return err
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+type faultFile struct {
+	File
+	fs *FaultFS
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.fs.inject(OpWrite, f.Name()); err != nil {
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Close() error {
+	if err := f.fs.inject(OpClose, f.Name()); err != nil {
+		_ = f.File.Close()
+		return err
+	}
+	return f.File.Close()
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.inject(OpSync, f.Name()); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+// FakeClock is a Clock that only moves when told to.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+var _ Clock = (*FakeClock)(nil)
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to t, which may be in the past.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,88 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFaultFSTornWrite(t *testing.T) {
+	t.Parallel()
+
+	errInjected := errors.New("injected")
+	fsys := &FaultFS{FS: OS{}, Inject: func(op Op, _ string) error {
+		if op == OpWrite {
+			return errInjected
+		}
+		return nil
+	}}
+
+	path := filepath.Join(t.TempDir(), "f")
+	f, err := fsys.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	n, err := f.Write([]byte("abcdef"))
+	if !errors.Is(err, errInjected) || n != 3 {
+		t.Errorf("Write() = %d, %v; want 3, %v", n, err, errInjected)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got, err := os.ReadFile(path) //nolint:gosec // test temp file
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(got) != "abc" {
+		t.Errorf("content = %q, want %q", got, "abc")
+	}
+}
+
+func TestFaultFSPassesThrough(t *testing.T) {
+	t.Parallel()
+
+	var ops []Op
+	fsys := &FaultFS{FS: OS{}, Inject: func(op Op, _ string) error {
+		ops = append(ops, op)
+		return nil
+	}}
+
+	dir := t.TempDir()
+	if err := fsys.WriteFile(filepath.Join(dir, "a"), []byte("x"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := fsys.Rename(filepath.Join(dir, "a"), filepath.Join(dir, "b")); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if _, err := fsys.Stat(filepath.Join(dir, "a")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat() error = %v, want not exist", err)
+	}
+
+	want := []Op{OpWriteFile, OpRename, OpStat}
+	if len(ops) != len(want) {
+		t.Fatalf("ops = %v, want %v", ops, want)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Errorf("ops[%d] = %s, want %s", i, ops[i], want[i])
+		}
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	c.Advance(time.Minute)
+	if got := c.Now(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("Now() = %v, want %v", got, start.Add(time.Minute))
+	}
+	c.Set(start.Add(-time.Hour)) // skew backwards
+	if got := c.Now(); !got.Equal(start.Add(-time.Hour)) {
+		t.Errorf("Now() = %v, want %v", got, start.Add(-time.Hour))
+	}
+}
@@ -0,0 +1,117 @@
+// Package vfs is the filesystem and clock the store and walker run on. OS
+// and SystemClock are the real ones; tests swap in a FaultFS or FakeClock to
+// simulate failed writes, files changing mid-read, and clock skew
+// deterministically.
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// File is an open file, as returned by FS.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+	Sync() error
+}
+
+// FS is the subset of package os the store and walker use. Errors should
+// wrap the fs.Err* values the os functions would return.
+type FS interface {
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	CreateTemp(dir, pattern string) (File, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Readlink(name string) (string, error)
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	Rename(oldpath, newpath string) error
+}
+
+// Clock tells the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// OS is the host filesystem. Its methods return exactly what package os
+// does, so errors go unwrapped.
+type OS struct{}
+
+var _ FS = OS{}
+
+func (OS) Open(name string) (File, error) {
+	return file(os.Open(name)) //nolint:gosec // callers vet paths
+}
+
+func (OS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return file(os.OpenFile(name, flag, perm)) //nolint:gosec // callers vet paths
+}
+
+func (OS) CreateTemp(dir, pattern string) (File, error) {
+	return file(os.CreateTemp(dir, pattern))
+}
+
+// file keeps a nil *os.File from becoming a non-nil File.
+func file(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err //nolint:wrapcheck // see OS
+	}
+	return f, nil
+}
+
+func (OS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name) //nolint:gosec,wrapcheck // callers vet paths; see OS
+}
+
+func (OS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm) //nolint:wrapcheck // see OS
+}
+
+func (OS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name) //nolint:wrapcheck // see OS
+}
+
+func (OS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name) //nolint:wrapcheck // see OS
+}
+
+func (OS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name) //nolint:wrapcheck // see OS
+}
+
+func (OS) Readlink(name string) (string, error) {
+	return os.Readlink(name) //nolint:wrapcheck // see OS
+}
+
+func (OS) Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(name, perm) //nolint:wrapcheck // see OS
+}
+
+func (OS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm) //nolint:wrapcheck // see OS
+}
+
+func (OS) Remove(name string) error {
+	return os.Remove(name) //nolint:wrapcheck // see OS
+}
+
+func (OS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath) //nolint:wrapcheck // see OS
+}
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,37 @@
+package walker
+
+import (
+	"os"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// Cache remembers file hashes between walks so unchanged files are not
+// reread. key is the namespaced path relative to the walk root; absPath is
+// where the file lives on disk. Implementations are best-effort: a failed
+// lookup only costs a reread, so errors are swallowed.
+type Cache interface {
+	Lookup(key, absPath string, info os.FileInfo) (object.Hash, bool)
+	Update(key, absPath string, info os.FileInfo, h object.Hash)
+}
+
+// WithCache replaces the default store index cache.
+func WithCache(c Cache) Option {
+	return func(w *walker) {
+		w.cache = c
+	}
+}
+
+// indexCache keeps hashes in the store's index, the default.
+type indexCache struct {
+	store *store.Store
+}
+
+func (c indexCache) Lookup(key, _ string, info os.FileInfo) (object.Hash, bool) {
+	return c.store.LookupCache(key, info.Size(), info.ModTime())
+}
+
+func (c indexCache) Update(key, _ string, info os.FileInfo, h object.Hash) {
+	c.store.UpdateCache(key, info.Size(), info.ModTime(), h)
+}
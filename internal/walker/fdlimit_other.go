@@ -0,0 +1,7 @@
+//go:build !unix
+
+package walker
+
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,91 @@
+package walker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+var (
+	ErrNotFile      = errors.New("walker: not a regular file or symlink")
+	ErrFileUnstable = errors.New("walker: file modified while being read")
+)
+
+// HashFile stores the file at path as Walk would inside a directory: a blob,
+// or chunks and a manifest with WithChunking, streamed past the memory
+// limit. It returns the entry a tree would hold for it, so Hash is the blob
+// hash. A symlink is stored as its target path unless WithSymlinkPolicy
+// follows it. Options that only shape trees have no effect, and no cache is
+// consulted.
+//
+// A file still changing after WithRereadUnstable's rereads fails with
+// ErrFileUnstable, since its hash may match no version of it.
+func HashFile(ctx context.Context, path string, s *store.Store, opts ...Option) (object.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return object.Entry{}, fmt.Errorf("context: %w", err)
+	}
+	w := newWalker(path, s, opts)
+
+	info, err := w.lstat(path)
+	if err != nil {
+		return object.Entry{}, fmt.Errorf("stat: %w", err)
+	}
+	if info.IsDir() || specialKind(info.Mode()) != "" {
+		return object.Entry{}, fmt.Errorf("%w: %s", ErrNotFile, path)
+	}
+
+	mode := modeFromFileInfo(info)
+	var hash object.Hash
+	var stable bool
+	if w.streams(mode, info.Size()) {
+		hash, info, stable, err = w.streamStable(path, info)
+	} else {
+		hash, info, stable, err = w.readAndPut(path, mode, info)
+	}
+	if err != nil {
+		return object.Entry{}, err
+	}
+	if !stable {
+		return object.Entry{}, fmt.Errorf("%w: %s", ErrFileUnstable, path)
+	}
+	return object.Entry{
+		Name:    filepath.Base(path),
+		Mode:    mode,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+	}, nil
+}
+
+// HashReader stores everything read from r as HashFile stores a regular
+// file, spooling it to a temporary file first since the encoding needs the
+// size up front. The entry has no name.
+func HashReader(ctx context.Context, r io.Reader, s *store.Store, opts ...Option) (entry object.Entry, err error) {
+	f, err := os.CreateTemp("", "smerkle-blob-*")
+	if err != nil {
+		return object.Entry{}, fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return object.Entry{}, fmt.Errorf("spool input: %w", err)
+	}
+
+	entry, err = HashFile(ctx, f.Name(), s, opts...)
+	if err != nil {
+		return object.Entry{}, err
+	}
+	entry.Name = ""
+	return entry, nil
+}
@@ -0,0 +1,95 @@
+package walker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+func TestHashFile(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "small.txt"), "hello\n")
+	writeFile(t, filepath.Join(root, "big.bin"), strings.Repeat("smerkle ", 4096))
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		opts    []Option
+		wantErr error
+	}{
+		{name: "blob", file: "small.txt"},
+		{name: "chunked", file: "big.bin", opts: []Option{WithChunking(1024)}},
+		{name: "streamed", file: "big.bin", opts: []Option{WithStreamThreshold(1)}},
+		{name: "directory", file: "dir", wantErr: ErrNotFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := setupStore(t)
+			got, err := HashFile(context.Background(), filepath.Join(root, tt.file), s, tt.opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("HashFile() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HashFile() error = %v", err)
+			}
+
+			res, err := Walk(context.Background(), root, s, tt.opts...)
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			want := treeEntry(t, res.Hash, s, tt.file)
+			if got.Hash != want.Hash || got.Mode != want.Mode || got.Size != want.Size {
+				t.Errorf("HashFile() = %v %o %d, want entry %v %o %d",
+					got.Hash, got.Mode, got.Size, want.Hash, want.Mode, want.Size)
+			}
+			if !s.HasObject(got.Hash) {
+				t.Errorf("store is missing %v", got.Hash)
+			}
+
+			f, err := os.Open(filepath.Join(root, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			fromReader, err := HashReader(context.Background(), f, s, tt.opts...)
+			if err != nil {
+				t.Fatalf("HashReader() error = %v", err)
+			}
+			if fromReader.Hash != got.Hash || fromReader.Name != "" {
+				t.Errorf("HashReader() = %q %v, want unnamed %v", fromReader.Name, fromReader.Hash, got.Hash)
+			}
+		})
+	}
+}
+
+// treeEntry returns the entry called name in the tree at h.
+func treeEntry(t *testing.T, h object.Hash, s *store.Store, name string) object.Entry {
+	t.Helper()
+	tree, err := s.GetTree(h)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	for _, e := range tree.Entries {
+		if e.Name == name {
+			return e
+		}
+	}
+	t.Fatalf("tree has no entry %q", name)
+	return object.Entry{}
+}
@@ -0,0 +1,99 @@
+package walker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/result"
+)
+
+// inode identifies a file independent of the paths linking to it.
+type inode struct {
+	dev, ino uint64
+}
+
+// linkGroup is one file reached through several hard links. The first path
+// to reach it hashes it; the rest wait for that entry and share it.
+type linkGroup struct {
+	done  chan struct{} // closed once first has been hashed
+	first string
+	entry object.Entry
+	err   error
+
+	mu    sync.Mutex
+	paths []string // paths that share entry
+}
+
+func (g *linkGroup) add(relPath string) {
+	g.mu.Lock()
+	g.paths = append(g.paths, relPath)
+	g.mu.Unlock()
+}
+
+// hashLinked hashes a file with hashFile, reading a regular file with
+// several hard links once however many of its paths the walk reaches.
+func (w *walker) hashLinked(ctx context.Context, absPath, relPath string, info os.FileInfo) (object.Entry, error) {
+	key, ok := linkKey(info)
+	if !ok || !info.Mode().IsRegular() {
+		return w.hashFile(ctx, absPath, relPath, info)
+	}
+	v, loaded := w.links.LoadOrStore(key, &linkGroup{done: make(chan struct{}), first: relPath})
+	g := v.(*linkGroup)
+	if !loaded {
+		g.entry, g.err = w.hashFile(ctx, absPath, relPath, info)
+		close(g.done)
+		if g.err == nil {
+			g.add(relPath)
+		}
+		return g.entry, g.err
+	}
+
+	// waiting holds no semaphore slot, so the first path can always finish
+	select {
+	case <-ctx.Done():
+		return object.Entry{}, fmt.Errorf("context: %w", ctx.Err())
+	case <-g.done:
+	}
+	// the file changed between the two stats or while it was read, so the
+	// shared entry may not describe what this path sees
+	if g.err != nil || g.entry.Size != info.Size() || !g.entry.ModTime.Equal(info.ModTime()) || w.isUnstable(g.first) {
+		return w.hashFile(ctx, absPath, relPath, info)
+	}
+
+	e := g.entry
+	e.Name = filepath.Base(relPath)
+	w.updateCache(relPath, absPath, info, e.Hash)
+	w.progress.done(relPath, info.Size())
+	g.add(relPath)
+	return e, nil
+}
+
+func (w *walker) isUnstable(relPath string) bool {
+	w.pathsMu.Lock()
+	defer w.pathsMu.Unlock()
+	return slices.Contains(w.unstable, relPath)
+}
+
+// linkGroups returns the files the walk reached through more than one path,
+// sorted by their first path.
+func (w *walker) linkGroups() []result.LinkGroup {
+	var groups []result.LinkGroup
+	w.links.Range(func(_, v any) bool {
+		g := v.(*linkGroup)
+		if len(g.paths) < 2 {
+			return true
+		}
+		paths := slices.Clone(g.paths)
+		slices.Sort(paths)
+		groups = append(groups, result.LinkGroup{Paths: paths, Size: g.entry.Size})
+		return true
+	})
+	slices.SortFunc(groups, func(a, b result.LinkGroup) int { return cmp.Compare(a.Paths[0], b.Paths[0]) })
+	return groups
+}
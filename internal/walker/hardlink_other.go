@@ -0,0 +1,9 @@
+//go:build !unix
+
+package walker
+
+import "os"
+
+func linkKey(os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
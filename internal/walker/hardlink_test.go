@@ -0,0 +1,92 @@
+//go:build unix
+
+package walker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/result"
+	"github.com/garrettladley/smerkle/internal/vfs"
+)
+
+func TestWalkHardLinks(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "store", "pkg.js"), "module.exports = 1")
+	writeFile(t, filepath.Join(root, "solo.txt"), "one link")
+	for _, p := range []string{filepath.Join("a", "pkg.js"), filepath.Join("b", "c", "pkg.js")} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, p)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(filepath.Join(root, "store", "pkg.js"), filepath.Join(root, p)); err != nil {
+			t.Skipf("hard links unsupported: %v", err)
+		}
+	}
+
+	var reads atomic.Int32
+	fsys := &vfs.FaultFS{FS: vfs.OS{}, Inject: func(op vfs.Op, name string) error {
+		if (op == vfs.OpReadFile || op == vfs.OpOpen) && strings.HasSuffix(name, "pkg.js") {
+			reads.Add(1)
+		}
+		return nil
+	}}
+	s := setupStore(t)
+	res, err := Walk(context.Background(), root, s, WithFS(fsys))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if len(res.Errors) > 0 {
+		t.Fatalf("Walk() errors = %v", res.Errors)
+	}
+	if got := reads.Load(); got != 1 {
+		t.Errorf("pkg.js read %d times, want once", got)
+	}
+
+	want := []result.LinkGroup{{
+		Paths: []string{filepath.Join("a", "pkg.js"), filepath.Join("b", "c", "pkg.js"), filepath.Join("store", "pkg.js")},
+		Size:  int64(len("module.exports = 1")),
+	}}
+	if !reflect.DeepEqual(res.HardLinks, want) {
+		t.Errorf("HardLinks = %v, want %v", res.HardLinks, want)
+	}
+	if got, want := res.LinkedBytes(), 2*int64(len("module.exports = 1")); got != want {
+		t.Errorf("LinkedBytes() = %d, want %d", got, want)
+	}
+
+	// every link hashes as an independent copy would
+	plain := t.TempDir()
+	writeFile(t, filepath.Join(plain, "store", "pkg.js"), "module.exports = 1")
+	writeFile(t, filepath.Join(plain, "a", "pkg.js"), "module.exports = 1")
+	writeFile(t, filepath.Join(plain, "b", "c", "pkg.js"), "module.exports = 1")
+	writeFile(t, filepath.Join(plain, "solo.txt"), "one link")
+	copies, err := Walk(context.Background(), plain, setupStore(t))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if res.Hash != copies.Hash {
+		t.Errorf("Hash = %s, want %s as for copies", res.Hash, copies.Hash)
+	}
+	if len(copies.HardLinks) != 0 {
+		t.Errorf("copies HardLinks = %v, want none", copies.HardLinks)
+	}
+
+	// the shared hash is cached at every path, so a rewalk reads nothing
+	reads.Store(0)
+	again, err := Walk(context.Background(), root, s, WithFS(fsys))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if got := reads.Load(); got != 0 {
+		t.Errorf("rewalk read pkg.js %d times, want none", got)
+	}
+	if again.Hash != res.Hash {
+		t.Errorf("rewalk Hash = %s, want %s", again.Hash, res.Hash)
+	}
+}
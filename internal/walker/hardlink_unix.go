@@ -0,0 +1,17 @@
+//go:build unix
+
+package walker
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkKey returns the inode behind info when more than one path links to it.
+func linkKey(info os.FileInfo) (inode, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true //nolint:unconvert,gosec // int32 on darwin, never negative
+}
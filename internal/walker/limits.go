@@ -0,0 +1,69 @@
+package walker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/result"
+)
+
+// WithMaxFileSize leaves files larger than n bytes out of the tree, each
+// with a WarningTooLarge, so a stray multi-gigabyte file doesn't dominate
+// the walk. n <= 0 means no limit.
+func WithMaxFileSize(n int64) Option {
+	return func(w *walker) {
+		w.maxFileSize = n
+	}
+}
+
+// WithMaxDepth walks at most n levels below the root: directories n path
+// elements deep are left out with everything under them, each with a
+// WarningTooDeep, so n = 1 hashes only the files at the root. n <= 0 means
+// no limit.
+func WithMaxDepth(n int) Option {
+	return func(w *walker) {
+		w.maxDepth = n
+	}
+}
+
+// WithMaxFiles hashes at most n files, links included, and then behaves as
+// if the walk budget ran out: the rest land in Result.Unvisited and the root
+// covers a partial tree. Which files make the cut depends on scheduling.
+// n <= 0 means no limit.
+func WithMaxFiles(n int) Option {
+	return func(w *walker) {
+		w.maxFiles = int64(n)
+	}
+}
+
+// overLimit reports whether the entry at relPath falls outside the size or
+// depth limits, recording a warning if so.
+func (w *walker) overLimit(relPath string, info os.FileInfo) bool {
+	var kind result.WarningKind
+	var msg string
+	switch {
+	case info.IsDir() && w.maxDepth > 0 && depth(relPath) >= w.maxDepth:
+		kind, msg = result.WarningTooDeep, fmt.Sprintf("directory at max depth %d skipped", w.maxDepth)
+	case !info.IsDir() && w.maxFileSize > 0 && info.Size() > w.maxFileSize:
+		kind, msg = result.WarningTooLarge, fmt.Sprintf("%d bytes, over max file size %d, skipped", info.Size(), w.maxFileSize)
+	default:
+		return false
+	}
+	w.pathsMu.Lock()
+	w.special = append(w.special, result.Warning{Kind: kind, Path: relPath, Message: msg})
+	w.pathsMu.Unlock()
+	return true
+}
+
+// fileLimitReached counts a file against WithMaxFiles and reports whether
+// it is one too many.
+func (w *walker) fileLimitReached() bool {
+	return w.maxFiles > 0 && w.files.Add(1) > w.maxFiles
+}
+
+// depth returns the number of elements in relPath.
+func depth(relPath string) int {
+	return strings.Count(relPath, string(filepath.Separator)) + 1
+}
@@ -0,0 +1,111 @@
+package walker
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/result"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+func TestWalkLimits(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "small.txt"), "ok")
+	writeFile(t, filepath.Join(root, "dump.bin"), strings.Repeat("x", 100))
+	writeFile(t, filepath.Join(root, "a", "a.txt"), "a")
+	writeFile(t, filepath.Join(root, "a", "b", "b.txt"), "b")
+
+	tests := []struct {
+		name         string
+		opt          Option
+		wantWarnings []result.Warning
+		wantPaths    []string // every entry in the tree
+		wantPartial  int      // files left unvisited
+	}{
+		{
+			name: "max file size",
+			opt:  WithMaxFileSize(10),
+			wantWarnings: []result.Warning{
+				{Kind: result.WarningTooLarge, Path: "dump.bin", Message: "100 bytes, over max file size 10, skipped"},
+			},
+			wantPaths: []string{"a", "a/a.txt", "a/b", "a/b/b.txt", "small.txt"},
+		},
+		{
+			name: "max depth",
+			opt:  WithMaxDepth(2),
+			wantWarnings: []result.Warning{
+				{Kind: result.WarningTooDeep, Path: filepath.Join("a", "b"), Message: "directory at max depth 2 skipped"},
+			},
+			wantPaths: []string{"a", "a/a.txt", "dump.bin", "small.txt"},
+		},
+		{
+			name:         "max depth one keeps root files",
+			opt:          WithMaxDepth(1),
+			wantWarnings: []result.Warning{{Kind: result.WarningTooDeep, Path: "a", Message: "directory at max depth 1 skipped"}},
+			wantPaths:    []string{"dump.bin", "small.txt"},
+		},
+		{
+			name:        "max files",
+			opt:         WithMaxFiles(3),
+			wantPartial: 1,
+		},
+		{
+			name:      "no limits",
+			opt:       WithMaxFiles(0),
+			wantPaths: []string{"a", "a/a.txt", "a/b", "a/b/b.txt", "dump.bin", "small.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := setupStore(t)
+			res, err := Walk(context.Background(), root, s, tt.opt)
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			if len(res.Unvisited) != tt.wantPartial {
+				t.Errorf("Unvisited = %v, want %d paths", res.Unvisited, tt.wantPartial)
+			}
+			if tt.wantPartial > 0 {
+				return // which files made the cut depends on scheduling
+			}
+			if len(res.Warnings) != len(tt.wantWarnings) {
+				t.Fatalf("Warnings = %v, want %v", res.Warnings, tt.wantWarnings)
+			}
+			for i, w := range tt.wantWarnings {
+				if res.Warnings[i] != w {
+					t.Errorf("Warnings[%d] = %v, want %v", i, res.Warnings[i], w)
+				}
+			}
+			if got := treePaths(t, s, res.Hash, ""); strings.Join(got, " ") != strings.Join(tt.wantPaths, " ") {
+				t.Errorf("tree paths = %v, want %v", got, tt.wantPaths)
+			}
+		})
+	}
+}
+
+// treePaths lists every path in the tree at h, slash-separated and in
+// tree order.
+func treePaths(t *testing.T, s *store.Store, h object.Hash, prefix string) []string {
+	t.Helper()
+	tree, err := s.GetTree(h)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	var paths []string
+	for _, e := range tree.Entries {
+		p := path.Join(prefix, e.Name)
+		paths = append(paths, p)
+		if e.Mode == object.ModeDirectory {
+			paths = append(paths, treePaths(t, s, e.Hash, p)...)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,193 @@
+package walker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/garrettladley/smerkle/internal/chunk"
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// streamCost is what a streamed file holds at once: a chunk being split and
+// its encoded copy. Unchunked streams need far less.
+const streamCost = 2 * chunk.MaxSize
+
+// DefaultStreamThreshold is the size from which files are streamed into the
+// store rather than read whole, with or without a memory limit.
+const DefaultStreamThreshold = 64 << 20
+
+// WithStreamThreshold streams files of at least n bytes into the store
+// instead of reading them whole, in place of DefaultStreamThreshold.
+// Streaming never changes a hash. If n <= 0, files are only streamed to stay
+// within WithMemoryLimit.
+func WithStreamThreshold(n int64) Option {
+	return func(w *walker) {
+		w.streamThreshold = n
+	}
+}
+
+// WithMemoryLimit caps the file content a walk holds in memory at once to
+// about n bytes. Reads wait for room, so effective concurrency drops while
+// large files are in flight, and files too large for one read slot's share
+// of n are streamed into the store instead of read whole. Streaming never
+// changes a hash. If n <= 0, memory is unbounded.
+func WithMemoryLimit(n int64) Option {
+	return func(w *walker) {
+		w.memLimit = n
+	}
+}
+
+// memory is a byte budget for file content held at once. Holders only read
+// and store one file, so waiting needs no cancellation.
+type memory struct {
+	limit int64
+	share int64 // largest cost read whole; above it, files stream
+
+	mu   sync.Mutex
+	cond *sync.Cond // signaled whenever memory is released
+	used int64
+}
+
+func newMemory(limit int64, slots int) *memory {
+	m := &memory{limit: limit, share: limit / int64(max(slots, 1))}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// acquire blocks until n bytes, at most the whole limit, fit in the budget
+// and returns the function that gives them back. A nil memory is unbounded.
+func (m *memory) acquire(n int64) func() {
+	if m == nil {
+		return func() {}
+	}
+	n = min(n, m.limit)
+	m.mu.Lock()
+	for m.used+n > m.limit {
+		m.cond.Wait()
+	}
+	m.used += n
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		m.used -= n
+		m.mu.Unlock()
+		m.cond.Broadcast()
+	}
+}
+
+// streams reports whether a file of size bytes should be streamed rather
+// than read whole.
+func (m *memory) streams(size int64) bool {
+	return m != nil && bufferedCost(size) > m.share
+}
+
+// streams reports whether the file described by info is streamed rather
+// than read whole.
+func (w *walker) streams(mode object.Mode, size int64) bool {
+	if mode == object.ModeSymlink {
+		return false
+	}
+	return (w.streamThreshold > 0 && size >= w.streamThreshold) || w.mem.streams(size)
+}
+
+// bufferedCost is the memory a file read whole holds: its content and the
+// encoded copy the store writes.
+func bufferedCost(size int64) int64 {
+	return 2 * size
+}
+
+// streamStable is readStable and putContent for a file streamed into the
+// store, with the same checks: it returns the hash, the metadata it
+// corresponds to, and whether the two were consistent.
+func (w *walker) streamStable(absPath string, info os.FileInfo) (object.Hash, os.FileInfo, bool, error) {
+	defer w.mem.acquire(streamCost)()
+
+	for attempt := 0; ; attempt++ {
+		hash, complete, err := w.streamContent(absPath, info.Size())
+		if err != nil {
+			return object.ZeroHash, nil, false, err
+		}
+		w.bytesRead.Add(info.Size())
+
+		after, err := w.lstat(absPath)
+		if complete && err == nil && after.Size() == info.Size() && after.ModTime().Equal(info.ModTime()) {
+			return hash, info, true, nil
+		}
+		if err != nil || attempt >= w.rereads {
+			if !complete {
+				// the file shrank mid-read, so the blob was never written
+				// and what is left should be small enough to read whole
+				hash, err = w.putShrunk(absPath)
+			}
+			return hash, info, false, err
+		}
+		info = after
+	}
+}
+
+// streamContent stores the file at absPath without reading it whole, as
+// chunks and a manifest when it reaches the chunking threshold. complete is
+// false if the file didn't hold exactly size bytes; an incomplete unchunked
+// file has no hash.
+func (w *walker) streamContent(absPath string, size int64) (hash object.Hash, complete bool, err error) {
+	// the store's temp files come out of the headroom left beside the budget
+	defer w.acquireFD()()
+
+	f, err := w.fs.Open(absPath)
+	if err != nil {
+		return object.ZeroHash, false, fmt.Errorf("read file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if w.chunkThreshold <= 0 || size < w.chunkThreshold {
+		h, err := w.store.PutBlobFrom(f, size)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return object.ZeroHash, false, nil
+		}
+		if err != nil {
+			return object.ZeroHash, false, fmt.Errorf("put blob: %w", err)
+		}
+		return h, true, nil
+	}
+
+	sp := chunk.NewSplitter(f)
+	m := &object.Manifest{}
+	var n int64
+	for {
+		c, err := sp.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return object.ZeroHash, false, fmt.Errorf("read file: %w", err)
+		}
+		h, err := w.store.PutBlob(&object.Blob{Content: c})
+		if err != nil {
+			return object.ZeroHash, false, fmt.Errorf("put chunk: %w", err)
+		}
+		m.Chunks = append(m.Chunks, object.Chunk{Hash: h, Size: uint32(len(c))}) //nolint:gosec // chunks are at most chunk.MaxSize
+		n += int64(len(c))
+	}
+	h, err := w.store.PutManifest(m)
+	if err != nil {
+		return object.ZeroHash, false, fmt.Errorf("put manifest: %w", err)
+	}
+	return h, n == size, nil
+}
+
+// putShrunk reads and stores what remains of a file that shrank while being
+// streamed.
+func (w *walker) putShrunk(absPath string) (object.Hash, error) {
+	release := w.acquireFD()
+	content, err := w.readContent(absPath, object.ModeRegular)
+	release()
+	if err != nil {
+		return object.ZeroHash, err
+	}
+	w.bytesRead.Add(int64(len(content)))
+	return w.putContent(content, object.ModeRegular)
+}
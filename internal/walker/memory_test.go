@@ -0,0 +1,187 @@
+package walker
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/chunk"
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/vfs"
+)
+
+func TestStreamingKeepsHashes(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	big := make([]byte, 3*chunk.MaxSize+12345)
+	r := rand.New(rand.NewPCG(1, 1)) //nolint:gosec // deterministic test data
+	for i := range big {
+		big[i] = byte(r.Uint32())
+	}
+	writeFile(t, filepath.Join(root, "big.bin"), string(big))
+	writeFile(t, filepath.Join(root, "sub", "medium.bin"), string(big[:chunk.MinSize+1]))
+	writeFile(t, filepath.Join(root, "sub", "small.txt"), "small\n")
+	writeFile(t, filepath.Join(root, "empty"), "")
+
+	tests := []struct {
+		name string
+		alg  object.Algorithm
+		opts []Option
+	}{
+		{name: "sha256", alg: object.SHA256},
+		{name: "blake3", alg: object.BLAKE3},
+		{name: "chunked", alg: object.BLAKE3, opts: []Option{WithChunking(chunk.MinSize)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			open := func() *store.Store {
+				s, err := store.Open(t.TempDir(), store.WithAlgorithm(tt.alg))
+				if err != nil {
+					t.Fatalf("Open() error = %v", err)
+				}
+				t.Cleanup(func() { _ = s.Close() })
+				return s
+			}
+
+			want, err := Walk(t.Context(), root, open(), tt.opts...)
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+
+			streaming := []struct {
+				name string
+				opts []Option
+			}{
+				// a limit this small streams everything but the smallest files
+				{name: "WithMemoryLimit", opts: []Option{WithMemoryLimit(64 << 10), WithConcurrency(4)}},
+				{name: "WithStreamThreshold", opts: []Option{WithStreamThreshold(1)}},
+			}
+			for _, st := range streaming {
+				s := open()
+				got, err := Walk(t.Context(), root, s, append(slices.Clone(tt.opts), st.opts...)...)
+				if err != nil {
+					t.Fatalf("Walk(%s) error = %v", st.name, err)
+				}
+				if got.Hash != want.Hash {
+					t.Errorf("Walk(%s) hash = %s, want %s", st.name, got.Hash, want.Hash)
+				}
+				if len(got.Unstable) != 0 || len(got.Errors) != 0 {
+					t.Errorf("Walk(%s) unstable = %v, errors = %v", st.name, got.Unstable, got.Errors)
+				}
+
+				tree, err := s.GetTree(got.Hash)
+				if err != nil {
+					t.Fatalf("GetTree() error = %v", err)
+				}
+				for _, e := range tree.Entries {
+					if e.Name != "big.bin" {
+						continue
+					}
+					content, err := s.ReadFile(e.Hash)
+					if err != nil {
+						t.Fatalf("ReadFile() error = %v", err)
+					}
+					if !bytes.Equal(content, big) {
+						t.Errorf("Walk(%s): streamed big.bin reads back differently", st.name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStreamStable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		after      string
+		rereads    int
+		wantStable bool
+	}{
+		{name: "grown, no rereads", after: "before, and longer", rereads: 0, wantStable: false},
+		{name: "grown, reread", after: "before, and longer", rereads: 1, wantStable: true},
+		{name: "shrunk, no rereads", after: "bef", rereads: 0, wantStable: false},
+		{name: "shrunk, reread", after: "bef", rereads: 1, wantStable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "f.txt")
+			writeFile(t, path, "before")
+			stale, err := os.Lstat(path)
+			if err != nil {
+				t.Fatalf("Lstat() error = %v", err)
+			}
+			// simulate a write landing between Lstat and the read
+			writeFile(t, path, tt.after)
+
+			s := setupStore(t)
+			w := &walker{fs: vfs.OS{}, store: s, rereads: tt.rereads, fds: make(chan struct{}, 1)}
+			hash, _, stable, err := w.streamStable(path, stale)
+			if err != nil {
+				t.Fatalf("streamStable() error = %v", err)
+			}
+			if stable != tt.wantStable {
+				t.Errorf("stable = %v, want %v", stable, tt.wantStable)
+			}
+			// once stable, the hash is of the file as it now is; before then
+			// a grown file hashes its first len("before") bytes
+			want := tt.after
+			if !stable && len(tt.after) > len("before") {
+				want = tt.after[:len("before")]
+			}
+			if content, err := s.ReadFile(hash); err != nil || string(content) != want {
+				t.Errorf("stored content = %q, %v; want %q", content, err, want)
+			}
+		})
+	}
+}
+
+func TestMemoryBackpressure(t *testing.T) {
+	t.Parallel()
+
+	m := newMemory(10, 2)
+	if m.share != 5 {
+		t.Errorf("share = %d, want 5", m.share)
+	}
+	if !m.streams(3) || m.streams(2) {
+		t.Errorf("streams(3), streams(2) = %v, %v; want true, false", m.streams(3), m.streams(2))
+	}
+
+	release := m.acquire(6)
+	acquired := make(chan func())
+	go func() { acquired <- m.acquire(6) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire() over the limit did not wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire() did not resume after release")
+	}
+
+	// more than the whole limit is capped rather than waiting forever
+	m.acquire(100)()
+
+	var unbounded *memory
+	unbounded.acquire(1 << 40)()
+	if unbounded.streams(1 << 40) {
+		t.Error("unbounded memory streams")
+	}
+}
@@ -0,0 +1,67 @@
+package walker
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// WithFullMetadata records every entry's permission bits, owner, group, and
+// extended attributes besides its content, for trees meant as an audit
+// baseline. The root directory has no entry, so its own metadata isn't
+// recorded. Such trees never hash like content-only ones, even with
+// identical metadata.
+func WithFullMetadata() Option {
+	return func(w *walker) {
+		w.fullMetadata = true
+	}
+}
+
+// WithModTimes stores every entry's modification time in its tree, so the
+// root hash changes when only timestamps do, as a build reproducibility
+// audit wants. Such trees never hash like content-only ones.
+func WithModTimes() Option {
+	return func(w *walker) {
+		w.modTimes = true
+	}
+}
+
+// metadata reads the full metadata of the entry at absPath, whose stat info
+// is info. Symlinks carry no extended attributes of their own here.
+func (w *walker) metadata(absPath string, info os.FileInfo) (*object.Metadata, error) {
+	m := &object.Metadata{}
+	m.Perm, m.UID, m.GID = ownership(info)
+	if info.Mode()&os.ModeSymlink != 0 {
+		return m, nil
+	}
+	xattrs, err := listxattrs(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("read extended attributes: %w", err)
+	}
+	// the hash cache's own attribute changes with every rehash
+	xattrs = slices.DeleteFunc(xattrs, func(x object.Xattr) bool { return x.Name == xattrName })
+	slices.SortFunc(xattrs, func(a, b object.Xattr) int { return cmp.Compare(a.Name, b.Name) })
+	if len(xattrs) > 0 {
+		m.Xattrs = xattrs
+	}
+	return m, nil
+}
+
+// permBits maps mode's permission, setuid, setgid, and sticky bits to their
+// POSIX values.
+func permBits(mode os.FileMode) uint32 {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return perm
+}
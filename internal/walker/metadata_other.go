@@ -0,0 +1,11 @@
+//go:build !unix
+
+package walker
+
+import "os"
+
+// ownership returns info's permission bits; files have no numeric owner or
+// group here.
+func ownership(info os.FileInfo) (perm, uid, gid uint32) {
+	return permBits(info.Mode()), 0, 0
+}
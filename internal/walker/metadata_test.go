@@ -0,0 +1,186 @@
+//go:build unix
+
+package walker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+func TestWalkFullMetadata(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "conf", "app.ini"), "[app]")
+	writeSymlink(t, filepath.Join(root, "current"), "conf")
+	if err := os.Chmod(filepath.Join(root, "conf"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	walkTree := func(t *testing.T, s *store.Store, opts ...Option) (object.Hash, map[string]object.Entry) {
+		t.Helper()
+		res, err := Walk(context.Background(), root, s, opts...)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if len(res.Errors) > 0 {
+			t.Fatalf("Walk() errors = %v", res.Errors)
+		}
+		entries := map[string]object.Entry{}
+		var collect func(prefix string, h object.Hash)
+		collect = func(prefix string, h object.Hash) {
+			tree, err := s.GetTree(h)
+			if err != nil {
+				t.Fatalf("GetTree() error = %v", err)
+			}
+			for _, e := range tree.Entries {
+				p := filepath.Join(prefix, e.Name)
+				entries[p] = e
+				if e.Mode == object.ModeDirectory {
+					collect(p, e.Hash)
+				}
+			}
+		}
+		collect("", res.Hash)
+		return res.Hash, entries
+	}
+
+	s := setupStore(t)
+	plainHash, plain := walkTree(t, s)
+	for p, e := range plain {
+		if e.Meta != nil {
+			t.Errorf("%s: Meta = %+v without WithFullMetadata", p, e.Meta)
+		}
+	}
+
+	fullHash, full := walkTree(t, s, WithFullMetadata())
+	if fullHash == plainHash {
+		t.Error("full metadata root hash matches the content-only one")
+	}
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid()) //nolint:gosec // ids are never negative on unix
+	for p, want := range map[string]uint32{
+		"conf":                           0o750,
+		filepath.Join("conf", "app.ini"): 0o600,
+	} {
+		m := full[p].Meta
+		if m == nil || m.Perm != want || m.UID != uid || m.GID != gid {
+			t.Errorf("%s: Meta = %+v, want perm %04o owned by %d:%d", p, m, want, uid, gid)
+		}
+	}
+	if m := full["current"].Meta; m == nil || len(m.Xattrs) != 0 {
+		t.Errorf("current: Meta = %+v, want the link's own metadata", m)
+	}
+	if full["conf"].Hash == plain["conf"].Hash {
+		t.Error("directory hash ignores its entries' metadata")
+	}
+
+	// content stays cached; only the entries record the new bits
+	if err := os.Chmod(filepath.Join(root, "conf", "app.ini"), 0o640|os.ModeSetuid); err != nil {
+		t.Fatal(err)
+	}
+	chmodHash, chmod := walkTree(t, s, WithFullMetadata())
+	if chmodHash == fullHash {
+		t.Error("root hash unchanged by a chmod")
+	}
+	if got := chmod[filepath.Join("conf", "app.ini")].Meta.Perm; got != 0o4640 {
+		t.Errorf("perm after chmod = %04o, want 4640", got)
+	}
+	if againHash, _ := walkTree(t, s); againHash != plainHash {
+		t.Error("content-only root hash changed by a chmod")
+	}
+}
+
+func TestWalkFullMetadataXattrs(t *testing.T) {
+	t.Parallel()
+
+	if !xattrSupported {
+		t.Skip("extended attributes not supported on this platform")
+	}
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	writeFile(t, path, "content")
+	if err := setxattr(path, "user.b", []byte("2")); err != nil {
+		t.Skipf("filesystem does not support user xattrs: %v", err)
+	}
+	if err := setxattr(path, "user.a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewXattrCache()
+	if err != nil {
+		t.Fatalf("NewXattrCache() error = %v", err)
+	}
+
+	s := setupStore(t)
+	// the cache's own attribute, written by the first walk, is left out
+	for range 2 {
+		res, err := Walk(context.Background(), root, s, WithFullMetadata(), WithCache(c))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		tree, err := s.GetTree(res.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+		want := &object.Metadata{
+			Perm: 0o600, UID: uint32(os.Getuid()), GID: uint32(os.Getgid()), //nolint:gosec // ids are never negative on unix
+			Xattrs: []object.Xattr{{Name: "user.a", Value: []byte("1")}, {Name: "user.b", Value: []byte("2")}},
+		}
+		if got := tree.Entries[0].Meta; !got.Equal(want) {
+			t.Errorf("Meta = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestWalkModTimes(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "out", "app.bin")
+	writeFile(t, path, "binary")
+	stamp := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	if err := os.Chtimes(path, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+
+	s := setupStore(t)
+	walk := func(opts ...Option) object.Hash {
+		t.Helper()
+		res, err := Walk(context.Background(), root, s, opts...)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		return res.Hash
+	}
+	plain, withTimes := walk(), walk(WithModTimes())
+	if plain == withTimes {
+		t.Error("mtime-inclusive root hash matches the content-only one")
+	}
+	tree, err := s.GetTree(withTimes)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	sub, err := s.GetTree(tree.Entries[0].Hash)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	if !sub.ModTimes || !sub.Entries[0].ModTime.Equal(stamp) {
+		t.Errorf("stored entry = %+v, want mtime %v", sub.Entries[0], stamp)
+	}
+
+	touched := stamp.Add(time.Second)
+	if err := os.Chtimes(path, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if walk() != plain {
+		t.Error("content-only root hash changed by a touch")
+	}
+	if walk(WithModTimes()) == withTimes {
+		t.Error("mtime-inclusive root hash unchanged by a touch")
+	}
+}
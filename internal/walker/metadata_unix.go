@@ -0,0 +1,17 @@
+//go:build unix
+
+package walker
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownership returns info's permission bits, owner, and group.
+func ownership(info os.FileInfo) (perm, uid, gid uint32) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return permBits(info.Mode()), 0, 0
+	}
+	return uint32(st.Mode) & 0o7777, st.Uid, st.Gid //nolint:unconvert // uint16 on darwin
+}
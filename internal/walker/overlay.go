@@ -0,0 +1,205 @@
+package walker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+var ErrInvalidOverlay = errors.New("walker: invalid overlay")
+
+type overlayFile struct {
+	content []byte
+	mode    object.Mode
+}
+
+// Overlay holds in-memory file changes applied on top of the walked
+// directory, so a build tool can compute the hash a tree would have without
+// writing to disk. Paths are slash-separated and relative to the walk root.
+// Overlay entries obey ignore rules like files on disk. An Overlay must not
+// be modified while a walk is using it.
+type Overlay struct {
+	files   map[string]overlayFile
+	removed map[string]bool
+	dirs    map[string]bool // ancestors of files; rebuilt lazily
+}
+
+func NewOverlay() *Overlay {
+	return &Overlay{files: map[string]overlayFile{}, removed: map[string]bool{}}
+}
+
+func cleanOverlayPath(p string) (string, error) {
+	c := path.Clean(p)
+	if p == "" || c == "." || c == ".." || strings.HasPrefix(c, "../") || path.IsAbs(c) {
+		return "", fmt.Errorf("%w: path %q is outside the root", ErrInvalidOverlay, p)
+	}
+	return c, nil
+}
+
+// Write places a file at p, replacing whatever is on disk there, including
+// a directory. mode is ModeRegular, ModeExecutable, or ModeSymlink, in which
+// case content is the link target.
+func (o *Overlay) Write(p string, content []byte, mode object.Mode) error {
+	c, err := cleanOverlayPath(p)
+	if err != nil {
+		return err
+	}
+	if !mode.IsFile() && mode != object.ModeSymlink {
+		return fmt.Errorf("%w: %s: mode %s is not a file mode", ErrInvalidOverlay, p, mode)
+	}
+	o.dropBelow(c)
+	delete(o.removed, c)
+	o.files[c] = overlayFile{content: content, mode: mode}
+	o.dirs = nil
+	return nil
+}
+
+// Remove hides p and everything below it, on disk or written earlier.
+// Files written below p afterwards are still included.
+func (o *Overlay) Remove(p string) error {
+	c, err := cleanOverlayPath(p)
+	if err != nil {
+		return err
+	}
+	o.dropBelow(c)
+	delete(o.files, c)
+	o.removed[c] = true
+	o.dirs = nil
+	return nil
+}
+
+// dropBelow forgets overlay entries strictly below c.
+func (o *Overlay) dropBelow(c string) {
+	prefix := c + "/"
+	for p := range o.files {
+		if strings.HasPrefix(p, prefix) {
+			delete(o.files, p)
+		}
+	}
+	for p := range o.removed {
+		if strings.HasPrefix(p, prefix) {
+			delete(o.removed, p)
+		}
+	}
+}
+
+// prepare builds the directory set before a walk.
+func (o *Overlay) prepare() {
+	if o.dirs != nil {
+		return
+	}
+	o.dirs = map[string]bool{}
+	for p := range o.files {
+		for d := path.Dir(p); d != "."; d = path.Dir(d) {
+			o.dirs[d] = true
+		}
+	}
+}
+
+// file returns the overlay file at p, if any.
+func (o *Overlay) file(p string) (overlayFile, bool) {
+	f, ok := o.files[p]
+	return f, ok
+}
+
+// isDir reports whether p must exist as a directory to hold overlay files.
+func (o *Overlay) isDir(p string) bool {
+	return o.dirs[p]
+}
+
+// hides reports whether the on-disk entry at p is hidden, either because p
+// is replaced by an overlay file or because p or an ancestor was removed.
+func (o *Overlay) hides(p string) bool {
+	if _, ok := o.files[p]; ok {
+		return true
+	}
+	for ; p != "."; p = path.Dir(p) {
+		if o.removed[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// children returns the names directly inside dir ("" for the root) that
+// the overlay provides, sorted.
+func (o *Overlay) children(dir string) []string {
+	seen := map[string]bool{}
+	add := func(p string) {
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		if parent == dir {
+			seen[path.Base(p)] = true
+		}
+	}
+	for p := range o.files {
+		add(p)
+	}
+	for p := range o.dirs {
+		add(p)
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// overlayOnlyDir reports whether a failure to read relDir from disk is
+// expected because the overlay creates it.
+func (w *walker) overlayOnlyDir(relDir string, err error) bool {
+	if w.overlay == nil || !w.overlay.isDir(filepath.ToSlash(relDir)) {
+		return false
+	}
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// processOverlayFile stores an overlay file and returns its entry.
+func (w *walker) processOverlayFile(relPath, name string, f *overlayFile) (*object.Entry, error) {
+	if w.ignorer != nil && w.ignorer.Match(relPath, false) {
+		return nil, nil
+	}
+	if w.only != nil && !w.only.Match(relPath, false) {
+		return nil, nil
+	}
+
+	hash, err := w.putContent(f.content, f.mode)
+	if err != nil {
+		w.ec.Add(relPath, err)
+		return nil, nil
+	}
+	return &object.Entry{Name: name, Mode: f.mode, Size: int64(len(f.content)), Hash: hash}, nil
+}
+
+// processVirtualDir walks a directory that only exists in the overlay, or
+// that replaces a file on disk.
+func (w *walker) processVirtualDir(ctx context.Context, absPath, relPath, name string) (*object.Entry, error) {
+	if w.ignorer != nil && w.ignorer.Match(relPath, true) {
+		return nil, nil
+	}
+
+	hash, err := w.walkDir(ctx, absPath, relPath)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		w.ec.Add(relPath, err)
+		return nil, nil
+	}
+	if hash.IsZero() {
+		return nil, nil // dropped by WithOnly
+	}
+	return &object.Entry{Name: name, Mode: object.ModeDirectory, Hash: hash}, nil
+}
@@ -0,0 +1,186 @@
+package walker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+func TestWalkOverlay(t *testing.T) {
+	t.Parallel()
+
+	// base lays out the tree on disk before the overlay applies
+	base := func(t *testing.T, root string) {
+		t.Helper()
+		writeFile(t, filepath.Join(root, "a.txt"), "a")
+		writeFile(t, filepath.Join(root, "src", "main.go"), "package main")
+		writeFile(t, filepath.Join(root, "build", "out.bin"), "bin")
+		writeFile(t, filepath.Join(root, "file-then-dir"), "f")
+		writeFile(t, filepath.Join(root, "dir-then-file", "x"), "x")
+	}
+
+	tests := []struct {
+		name    string
+		overlay func(*testing.T, *Overlay)
+		want    func(*testing.T, string) // the same changes made on disk
+	}{
+		{
+			name: "replace file",
+			overlay: func(t *testing.T, o *Overlay) {
+				t.Helper()
+				mustOverlay(t, o.Write("a.txt", []byte("A"), object.ModeRegular))
+			},
+			want: func(t *testing.T, root string) {
+				t.Helper()
+				writeFile(t, filepath.Join(root, "a.txt"), "A")
+			},
+		},
+		{
+			name: "add generated file in new directories",
+			overlay: func(t *testing.T, o *Overlay) {
+				t.Helper()
+				mustOverlay(t, o.Write("gen/proto/api.pb.go", []byte("generated"), object.ModeRegular))
+				mustOverlay(t, o.Write("src/run.sh", []byte("#!/bin/sh"), object.ModeExecutable))
+				mustOverlay(t, o.Write("latest", []byte("a.txt"), object.ModeSymlink))
+			},
+			want: func(t *testing.T, root string) {
+				t.Helper()
+				writeFile(t, filepath.Join(root, "gen", "proto", "api.pb.go"), "generated")
+				writeExecutable(t, filepath.Join(root, "src", "run.sh"), "#!/bin/sh")
+				writeSymlink(t, filepath.Join(root, "latest"), "a.txt")
+			},
+		},
+		{
+			name: "remove file and directory",
+			overlay: func(t *testing.T, o *Overlay) {
+				t.Helper()
+				mustOverlay(t, o.Remove("a.txt"))
+				mustOverlay(t, o.Remove("build"))
+			},
+			want: func(t *testing.T, root string) {
+				t.Helper()
+				removeAll(t, filepath.Join(root, "a.txt"))
+				removeAll(t, filepath.Join(root, "build"))
+			},
+		},
+		{
+			name: "swap files and directories",
+			overlay: func(t *testing.T, o *Overlay) {
+				t.Helper()
+				mustOverlay(t, o.Write("file-then-dir/y", []byte("y"), object.ModeRegular))
+				mustOverlay(t, o.Write("dir-then-file", []byte("d"), object.ModeRegular))
+			},
+			want: func(t *testing.T, root string) {
+				t.Helper()
+				removeAll(t, filepath.Join(root, "file-then-dir"))
+				writeFile(t, filepath.Join(root, "file-then-dir", "y"), "y")
+				removeAll(t, filepath.Join(root, "dir-then-file"))
+				writeFile(t, filepath.Join(root, "dir-then-file"), "d")
+			},
+		},
+		{
+			name: "rebuild a removed directory",
+			overlay: func(t *testing.T, o *Overlay) {
+				t.Helper()
+				mustOverlay(t, o.Remove("build"))
+				mustOverlay(t, o.Write("build/new.bin", []byte("new"), object.ModeRegular))
+			},
+			want: func(t *testing.T, root string) {
+				t.Helper()
+				removeAll(t, filepath.Join(root, "build"))
+				writeFile(t, filepath.Join(root, "build", "new.bin"), "new")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := setupStore(t)
+
+			root := t.TempDir()
+			base(t, root)
+			o := NewOverlay()
+			tt.overlay(t, o)
+			got, err := Walk(context.Background(), root, s, WithOverlay(o))
+			if err != nil {
+				t.Fatalf("Walk(WithOverlay) error = %v", err)
+			}
+			if len(got.Errors) > 0 {
+				t.Fatalf("Walk(WithOverlay) errors = %v", got.Errors)
+			}
+
+			onDisk := t.TempDir()
+			base(t, onDisk)
+			tt.want(t, onDisk)
+			want, err := Walk(context.Background(), onDisk, s)
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+
+			if got.Hash != want.Hash {
+				t.Errorf("Hash = %s, want %s as if the changes were on disk", got.Hash, want.Hash)
+			}
+		})
+	}
+}
+
+func TestWalkOverlayIgnored(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), "a")
+	writeIgnoreFile(t, root, "*.log")
+	s := setupStore(t)
+
+	plain, err := Walk(context.Background(), root, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	o := NewOverlay()
+	mustOverlay(t, o.Write("debug.log", []byte("noise"), object.ModeRegular))
+	overlaid, err := Walk(context.Background(), root, s, WithOverlay(o))
+	if err != nil {
+		t.Fatalf("Walk(WithOverlay) error = %v", err)
+	}
+	if overlaid.Hash != plain.Hash {
+		t.Errorf("Hash = %s, want %s with the ignored overlay file left out", overlaid.Hash, plain.Hash)
+	}
+}
+
+func TestOverlayInvalid(t *testing.T) {
+	t.Parallel()
+
+	o := NewOverlay()
+	for _, p := range []string{"", ".", "..", "../x", "/abs"} {
+		if err := o.Write(p, nil, object.ModeRegular); !errors.Is(err, ErrInvalidOverlay) {
+			t.Errorf("Write(%q) error = %v, want ErrInvalidOverlay", p, err)
+		}
+		if err := o.Remove(p); !errors.Is(err, ErrInvalidOverlay) {
+			t.Errorf("Remove(%q) error = %v, want ErrInvalidOverlay", p, err)
+		}
+	}
+	if err := o.Write("dir", nil, object.ModeDirectory); !errors.Is(err, ErrInvalidOverlay) {
+		t.Errorf("Write(directory mode) error = %v, want ErrInvalidOverlay", err)
+	}
+}
+
+func mustOverlay(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("overlay error = %v", err)
+	}
+}
+
+func removeAll(t *testing.T, path string) {
+	t.Helper()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("RemoveAll(%q) error = %v", path, err)
+	}
+}
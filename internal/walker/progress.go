@@ -0,0 +1,72 @@
+package walker
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// Progress is how far a walk has got.
+type Progress struct {
+	Files int64  // regular files and symlinks done, hashed or from the cache
+	Bytes int64  // their total size
+	Path  string // the file done most recently, relative to the root
+}
+
+// WithProgress calls fn after each file the walk finishes with the running
+// totals. Calls never overlap, but fn runs on the walk's workers and should
+// return quickly, e.g. by recording the latest value for a display to pick
+// up.
+func WithProgress(fn func(Progress)) Option {
+	return func(w *walker) {
+		w.progress = &progress{fn: fn}
+	}
+}
+
+// progress serializes calls to a WithProgress callback.
+type progress struct {
+	mu  sync.Mutex
+	cur Progress
+	fn  func(Progress)
+}
+
+// done counts a finished file. A nil progress does nothing.
+func (p *progress) done(relPath string, size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cur.Files++
+	p.cur.Bytes += size
+	p.cur.Path = relPath
+	p.fn(p.cur)
+}
+
+// WithEntryFunc calls fn with each entry the walk adds to a tree and its
+// slash-separated path from the root, as soon as the entry is final: files
+// as they are hashed and directories once everything below them is. Calls
+// never overlap, but arrive in no particular order and run on the walk's
+// workers, so a slow fn slows the walk.
+func WithEntryFunc(fn func(path string, e object.Entry)) Option {
+	return func(w *walker) {
+		w.entryFunc = &entryFunc{fn: fn}
+	}
+}
+
+// entryFunc serializes calls to a WithEntryFunc callback.
+type entryFunc struct {
+	mu sync.Mutex
+	fn func(string, object.Entry)
+}
+
+// emit passes on the entry at relPath. A nil entryFunc does nothing.
+func (f *entryFunc) emit(relPath string, e *object.Entry) {
+	if f == nil || e == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fn(filepath.ToSlash(relPath), *e)
+}
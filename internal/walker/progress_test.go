@@ -0,0 +1,94 @@
+package walker
+
+import (
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+func TestWithProgress(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"a.txt":         "alpha\n",
+		"sub/b.txt":     "bravo, longer\n",
+		"sub/deep/c.go": "package c\n",
+	}
+	var total int64
+	for rel, content := range files {
+		writeFile(t, filepath.Join(root, filepath.FromSlash(rel)), content)
+		total += int64(len(content))
+	}
+
+	s := setupStore(t)
+	// the second walk finds every file in the cache and must count them too
+	for _, pass := range []string{"hashed", "cached"} {
+		var got []Progress
+		if _, err := Walk(t.Context(), root, s, WithProgress(func(p Progress) { got = append(got, p) })); err != nil {
+			t.Fatalf("%s: Walk() error = %v", pass, err)
+		}
+
+		if len(got) != len(files) {
+			t.Fatalf("%s: %d progress calls, want %d", pass, len(got), len(files))
+		}
+		var paths []string
+		for i, p := range got {
+			if p.Files != int64(i+1) {
+				t.Errorf("%s: call %d Files = %d, want %d", pass, i, p.Files, i+1)
+			}
+			paths = append(paths, p.Path)
+		}
+		if last := got[len(got)-1]; last.Bytes != total {
+			t.Errorf("%s: Bytes = %d, want %d", pass, last.Bytes, total)
+		}
+		slices.Sort(paths)
+		if want := []string{"a.txt", "sub/b.txt", "sub/deep/c.go"}; !slices.Equal(paths, want) {
+			t.Errorf("%s: paths = %v, want %v", pass, paths, want)
+		}
+	}
+}
+
+func TestWithEntryFunc(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), "alpha\n")
+	writeFile(t, filepath.Join(root, "sub", "b.txt"), "bravo\n")
+	writeFile(t, filepath.Join(root, "sub", "deep", "c.go"), "package c\n")
+
+	s := setupStore(t)
+	var paths []string
+	got := make(map[string]object.Hash)
+	res, err := Walk(t.Context(), root, s, WithEntryFunc(func(p string, e object.Entry) {
+		paths = append(paths, p)
+		got[p] = e.Hash
+	}))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	want := treePaths(t, s, res.Hash, "")
+	if sorted := slices.Sorted(maps.Keys(got)); !slices.Equal(sorted, want) || len(paths) != len(want) {
+		t.Fatalf("entry paths = %v, want each of %v once", paths, want)
+	}
+	for _, p := range want {
+		dir, name := path.Split(p)
+		h := res.Hash
+		if dir != "" {
+			h = got[strings.TrimSuffix(dir, "/")]
+		}
+		if e := treeEntry(t, h, s, name); e.Hash != got[p] {
+			t.Errorf("%s: hash = %v, want %v", p, got[p], e.Hash)
+		}
+	}
+	// a directory is final only once everything below it is
+	if slices.Index(paths, "sub") < slices.Index(paths, "sub/deep/c.go") {
+		t.Errorf("sub came before sub/deep/c.go: %v", paths)
+	}
+}
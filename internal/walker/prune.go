@@ -0,0 +1,70 @@
+package walker
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/garrettladley/smerkle/internal/result"
+)
+
+// WithPruneCache removes the store index entries under the walk's cache
+// namespace that the walk didn't look up, such as those of deleted or
+// renamed files, once it finishes, and the change histories of directories
+// it didn't reach. Without a namespace that is every entry
+// of other un-namespaced walks too. A partial walk or one scoped by WithOnly
+// prunes nothing, since it skips files that still exist.
+func WithPruneCache() Option {
+	return func(w *walker) {
+		w.prune = &visited{keys: make(map[string]struct{}), dirs: make(map[string]struct{})}
+	}
+}
+
+// visited collects the index cache keys a walk looked up or updated, and
+// the keys of the directories it hashed.
+type visited struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+	dirs map[string]struct{}
+}
+
+// visit records key if c is the store index, the only cache pruned.
+func (w *walker) visit(c Cache, key string) {
+	if w.prune == nil {
+		return
+	}
+	if _, own := c.(indexCache); !own {
+		return
+	}
+	w.prune.mu.Lock()
+	w.prune.keys[key] = struct{}{}
+	w.prune.mu.Unlock()
+}
+
+// visitDir records the key of a directory the walk hashed.
+func (w *walker) visitDir(key string) {
+	if w.prune == nil {
+		return
+	}
+	w.prune.mu.Lock()
+	w.prune.dirs[key] = struct{}{}
+	w.prune.mu.Unlock()
+}
+
+// pruneCache prunes the index and directory activity after the walk that
+// produced res.
+func (w *walker) pruneCache(res *result.Result) error {
+	if w.prune == nil || res.Partial() || w.only != nil {
+		return nil
+	}
+	prefix := ""
+	if w.cacheNS != "" {
+		prefix = w.cacheKey("")
+	}
+	n, err := w.store.PruneCache(prefix, w.prune.keys)
+	if err != nil {
+		return fmt.Errorf("prune cache: %w", err)
+	}
+	w.store.PruneActivity(prefix, w.prune.dirs)
+	res.Pruned = n
+	return nil
+}
@@ -0,0 +1,107 @@
+package walker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithPruneCache(t *testing.T) {
+	t.Parallel()
+
+	rootA, rootB := t.TempDir(), t.TempDir()
+	for _, root := range []string{rootA, rootB} {
+		writeFile(t, filepath.Join(root, "keep.txt"), "keep\n")
+		writeFile(t, filepath.Join(root, "gone.txt"), "gone\n")
+		writeFile(t, filepath.Join(root, "sub", "old.txt"), "renamed\n")
+	}
+
+	s := setupStore(t)
+	for _, root := range []string{rootA, rootB} {
+		if _, err := Walk(t.Context(), root, s, WithCacheNamespace(root)); err != nil {
+			t.Fatalf("Walk(%s) error = %v", root, err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(rootA, "gone.txt")); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := os.Rename(filepath.Join(rootA, "sub", "old.txt"), filepath.Join(rootA, "sub", "new.txt")); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+
+	res, err := Walk(t.Context(), rootA, s, WithCacheNamespace(rootA), WithPruneCache())
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if res.Pruned != 2 {
+		t.Errorf("Pruned = %d, want 2 (the deleted and renamed files)", res.Pruned)
+	}
+
+	cached := func(root, rel string) bool {
+		t.Helper()
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		_, ok := s.LookupCache(root+"\x00"+rel, info.Size(), info.ModTime())
+		return ok
+	}
+	for _, rel := range []string{"keep.txt", "sub/new.txt"} {
+		if !cached(rootA, rel) {
+			t.Errorf("%s was pruned from its own walk", rel)
+		}
+	}
+	for _, rel := range []string{"keep.txt", "gone.txt", "sub/old.txt"} {
+		if !cached(rootB, rel) {
+			t.Errorf("%s of another namespace was pruned", rel)
+		}
+	}
+
+	// nothing left to prune
+	res, err = Walk(t.Context(), rootA, s, WithCacheNamespace(rootA), WithPruneCache())
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if res.Pruned != 0 {
+		t.Errorf("second Pruned = %d, want 0", res.Pruned)
+	}
+}
+
+func TestWithPruneCacheActivity(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "busy", "a.txt"), "one\n")
+	writeFile(t, filepath.Join(root, "gone", "a.txt"), "one\n")
+
+	s := setupStore(t)
+	walk := func(opts ...Option) {
+		t.Helper()
+		if _, err := Walk(t.Context(), root, s, opts...); err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+	}
+	walk()
+	writeFile(t, filepath.Join(root, "busy", "a.txt"), "two\n")
+	writeFile(t, filepath.Join(root, "gone", "a.txt"), "two\n")
+	walk()
+	if s.DirChanges("busy") != 1 || s.DirChanges("gone") != 1 {
+		t.Fatalf("DirChanges(busy, gone) = %d, %d, want 1, 1", s.DirChanges("busy"), s.DirChanges("gone"))
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "gone")); err != nil {
+		t.Fatalf("RemoveAll() error = %v", err)
+	}
+	walk(WithPruneCache())
+	if got := s.DirChanges("busy"); got != 1 {
+		t.Errorf("DirChanges(busy) after prune = %d, want 1", got)
+	}
+
+	// a directory back under the old name starts a new history
+	writeFile(t, filepath.Join(root, "gone", "a.txt"), "three\n")
+	walk()
+	if got := s.DirChanges("gone"); got != 0 {
+		t.Errorf("DirChanges(gone) after prune and re-create = %d, want 0", got)
+	}
+}
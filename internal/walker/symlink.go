@@ -0,0 +1,120 @@
+package walker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/garrettladley/smerkle/internal/result"
+)
+
+// SymlinkPolicy says what a walk does with symbolic links.
+type SymlinkPolicy uint8
+
+const (
+	// SymlinkRecord stores each link as a symlink entry holding its target
+	// path, never reading what it points to. The default.
+	SymlinkRecord SymlinkPolicy = iota
+	// SymlinkSkip leaves links out of the tree.
+	SymlinkSkip
+	// SymlinkFollow hashes what each link points to as if it were there: a
+	// file's content or a directory's tree. A link to a directory it sits
+	// in is left out with a WarningSymlinkCycle; a dangling link is an error
+	// on its path.
+	SymlinkFollow
+)
+
+var ErrUnknownSymlinkPolicy = errors.New("walker: unknown symlink policy")
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinkRecord:
+		return "record"
+	case SymlinkSkip:
+		return "skip"
+	case SymlinkFollow:
+		return "follow"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSymlinkPolicy returns the policy String names.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	for _, p := range []SymlinkPolicy{SymlinkRecord, SymlinkSkip, SymlinkFollow} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q (want record, skip, or follow)", ErrUnknownSymlinkPolicy, s)
+}
+
+// WithSymlinkPolicy sets what the walk does with symbolic links. Skipping
+// or following them changes the root hash.
+func WithSymlinkPolicy(p SymlinkPolicy) Option {
+	return func(w *walker) {
+		w.symlinks = p
+	}
+}
+
+// resolveSymlink applies the symlink policy to the entry at relPath, whose
+// Lstat info is info. It returns the info to hash the entry by, which is
+// the target's when following, or nil to leave the entry out.
+func (w *walker) resolveSymlink(absPath, relPath string, info os.FileInfo) (os.FileInfo, error) {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return info, nil
+	}
+	switch w.symlinks {
+	case SymlinkSkip:
+		return nil, nil
+	case SymlinkFollow:
+		target, err := w.fs.Stat(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("follow symlink: %w", err)
+		}
+		if target.IsDir() && w.isAncestor(relPath, target) {
+			w.pathsMu.Lock()
+			w.special = append(w.special, result.Warning{
+				Kind: result.WarningSymlinkCycle, Path: relPath, Message: "symlink to a directory containing it skipped",
+			})
+			w.pathsMu.Unlock()
+			return nil, nil
+		}
+		return target, nil
+	default:
+		return info, nil
+	}
+}
+
+// recordDir notes the directory walked at relPath, so links below it can
+// be checked for cycles. Only a following walk needs them.
+func (w *walker) recordDir(relPath string, info os.FileInfo) {
+	if w.symlinks == SymlinkFollow {
+		w.dirs.Store(relPath, info)
+	}
+}
+
+// isAncestor reports whether dir is one of the directories walked on the
+// way to relPath, which following a link to it would walk again forever.
+func (w *walker) isAncestor(relPath string, dir os.FileInfo) bool {
+	for p := relPath; p != ""; {
+		p = filepath.Dir(p)
+		if p == "." {
+			p = ""
+		}
+		if info, ok := w.dirs.Load(p); ok && os.SameFile(info.(os.FileInfo), dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// lstat stats absPath for the entry's own metadata: the link itself, unless
+// links are followed.
+func (w *walker) lstat(absPath string) (os.FileInfo, error) {
+	if w.symlinks == SymlinkFollow {
+		return w.fs.Stat(absPath) //nolint:wrapcheck // callers wrap
+	}
+	return w.fs.Lstat(absPath) //nolint:wrapcheck // callers wrap
+}
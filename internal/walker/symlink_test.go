@@ -0,0 +1,141 @@
+//go:build unix
+
+package walker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/result"
+)
+
+func TestWalkSymlinkPolicy(t *testing.T) {
+	t.Parallel()
+
+	// content outside the root, reached only through links
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "content", "index.html"), "<html>")
+	writeFile(t, filepath.Join(outside, "cfg.txt"), "config")
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "main.go"), "package main")
+	writeSymlink(t, filepath.Join(root, "site"), filepath.Join(outside, "content"))
+	writeSymlink(t, filepath.Join(root, "cfg.txt"), filepath.Join(outside, "cfg.txt"))
+	writeSymlink(t, filepath.Join(root, "sub", "up"), "..")
+
+	tests := []struct {
+		policy SymlinkPolicy
+		want   map[string]object.Mode // root entries
+		cycle  bool
+	}{
+		{
+			policy: SymlinkRecord,
+			want: map[string]object.Mode{
+				"cfg.txt": object.ModeSymlink, "main.go": object.ModeRegular,
+				"site": object.ModeSymlink, "sub": object.ModeDirectory,
+			},
+		},
+		{
+			policy: SymlinkSkip,
+			want:   map[string]object.Mode{"main.go": object.ModeRegular, "sub": object.ModeDirectory},
+		},
+		{
+			policy: SymlinkFollow,
+			want: map[string]object.Mode{
+				"cfg.txt": object.ModeRegular, "main.go": object.ModeRegular,
+				"site": object.ModeDirectory, "sub": object.ModeDirectory,
+			},
+			cycle: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			t.Parallel()
+
+			s := setupStore(t)
+			res, err := Walk(context.Background(), root, s, WithSymlinkPolicy(tt.policy))
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			if len(res.Errors) > 0 {
+				t.Fatalf("Walk() errors = %v", res.Errors)
+			}
+			tree, err := s.GetTree(res.Hash)
+			if err != nil {
+				t.Fatalf("GetTree() error = %v", err)
+			}
+			got := map[string]object.Mode{}
+			for _, e := range tree.Entries {
+				got[e.Name] = e.Mode
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+			for name, mode := range tt.want {
+				if got[name] != mode {
+					t.Errorf("%s mode = %v, want %v", name, got[name], mode)
+				}
+			}
+
+			cycle := len(res.Warnings) == 1 && res.Warnings[0].Kind == result.WarningSymlinkCycle &&
+				res.Warnings[0].Path == filepath.Join("sub", "up")
+			if cycle != tt.cycle {
+				t.Errorf("warnings = %v, want a symlink cycle at sub/up: %v", res.Warnings, tt.cycle)
+			}
+		})
+	}
+
+	t.Run("followed directory hashes like the real one", func(t *testing.T) {
+		t.Parallel()
+
+		s := setupStore(t)
+		res, err := Walk(context.Background(), root, s, WithSymlinkPolicy(SymlinkFollow))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		direct, err := Walk(context.Background(), filepath.Join(outside, "content"), s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		tree, err := s.GetTree(res.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+		for _, e := range tree.Entries {
+			if e.Name == "site" && e.Hash != direct.Hash {
+				t.Errorf("site hash = %s, want %s", e.Hash, direct.Hash)
+			}
+		}
+	})
+
+	t.Run("dangling link is an error when following", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeSymlink(t, filepath.Join(root, "gone"), "missing")
+		res, err := Walk(context.Background(), root, setupStore(t), WithSymlinkPolicy(SymlinkFollow))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if len(res.Errors) != 1 || !errors.Is(res.Errors[0].Err, os.ErrNotExist) {
+			t.Errorf("Errors = %v, want the dangling link", res.Errors)
+		}
+	})
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []SymlinkPolicy{SymlinkRecord, SymlinkSkip, SymlinkFollow} {
+		if got, err := ParseSymlinkPolicy(p.String()); err != nil || got != p {
+			t.Errorf("ParseSymlinkPolicy(%q) = %v, %v", p, got, err)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("resolve"); !errors.Is(err, ErrUnknownSymlinkPolicy) {
+		t.Errorf("ParseSymlinkPolicy(resolve) error = %v, want ErrUnknownSymlinkPolicy", err)
+	}
+}
@@ -1,28 +1,41 @@
 package walker
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/garrettladley/smerkle/internal/chunk"
 	"github.com/garrettladley/smerkle/internal/ignore"
 	"github.com/garrettladley/smerkle/internal/object"
 	"github.com/garrettladley/smerkle/internal/result"
 	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/vfs"
 	"github.com/garrettladley/smerkle/internal/xerrors"
 )
 
 var (
 	ErrRootNotDirectory = errors.New("walker: root is not a directory")
 	ErrRootNotExist     = errors.New("walker: root does not exist")
+	ErrInvalidIgnore    = errors.New("walker: invalid ignore pattern")
 )
 
-const smerkleignoreFile = ".smerkleignore"
+// errBudgetExhausted marks work abandoned because the walk budget ran out.
+var errBudgetExhausted = errors.New("walk budget exhausted")
+
+// DefaultIgnoreFileName is the per-tree ignore file loaded from the walk root.
+const DefaultIgnoreFileName = ".smerkleignore"
 
 // entryResult holds the result of processing a single directory entry.
 type entryResult struct {
@@ -32,11 +45,64 @@ type entryResult struct {
 
 type walker struct {
 	root       string
+	sourceRoot string // directory root is a copy of, if any
+	storeRel   string // store path relative to root, if the store lives inside it
 	store      *store.Store
+	fs         vfs.FS
+	clock      vfs.Clock
+	cache      Cache
 	ignorer    *ignore.Ignorer
+	global     *ignore.Ignorer // layered beneath ignorer
+	only       *ignore.Ignorer // if set, the files to keep
+	overlay    *Overlay
 	ec         *xerrors.ErrorCollector
 	sem        chan struct{}
+	workers    chan struct{} // goroutines processing entries, besides the caller's
 	maxWorkers int
+	fds        chan struct{} // open file descriptor budget, separate from sem
+	maxFDs     int
+	cacheNS    string // prefix for index cache keys
+
+	includeIgnoreFile bool
+	ignoreFileName    string
+	strictIgnore      bool
+	volatileFirst     bool
+	inaccessible      bool // record unreadable paths as placeholder entries
+
+	fullMetadata bool // record permissions, ownership, and xattrs in entries
+	modTimes     bool // hash entry mtimes into trees
+
+	symlinks SymlinkPolicy
+	dirs     sync.Map // relative path -> os.FileInfo of each directory walked, when following symlinks
+	links    sync.Map // inode -> *linkGroup of each file with several hard links
+
+	maxFileSize int64 // zero means unbounded
+	maxDepth    int   // zero means unbounded
+	maxFiles    int64 // zero means unbounded
+	files       atomic.Int64
+
+	started   time.Time
+	budget    time.Duration // zero means unbounded
+	deadline  time.Time     // set from budget when the walk starts
+	pathsMu   sync.Mutex    // guards unvisited, unstable, and special
+	unvisited []string
+	unstable  []string
+	special   []result.Warning // special files left out of the tree
+	rereads   int              // extra reads of files modified mid-read
+
+	chunkThreshold int64 // files at least this large are chunked; 0 disables
+
+	memLimit        int64   // zero means unbounded
+	mem             *memory // set from memLimit when the walk starts
+	streamThreshold int64   // files at least this large are streamed; 0 disables
+
+	progress  *progress  // nil unless WithProgress
+	entryFunc *entryFunc // nil unless WithEntryFunc
+	prune     *visited   // nil unless WithPruneCache
+
+	hashed    atomic.Int64 // files read and hashed
+	cached    atomic.Int64 // files served from the cache
+	bytesRead atomic.Int64
 }
 
 type Option func(*walker)
@@ -47,7 +113,197 @@ func WithIgnorer(ign *ignore.Ignorer) Option {
 	}
 }
 
-// if n <= 0, defaults to runtime.NumCPU().
+// WithGlobalIgnorer layers ign beneath the root's ignore rules, whether
+// loaded from the root's ignore file or given by WithIgnorer, so patterns
+// there override it. It carries rules every tree should share, such as a
+// user's or a store's.
+func WithGlobalIgnorer(ign *ignore.Ignorer) Option {
+	return func(w *walker) {
+		w.global = ign
+	}
+}
+
+// WithOnly scopes the walk to files matching only, which uses ignore-file
+// syntax. Directories left without matching files are omitted, so the root
+// hash changes only when a matching file does.
+func WithOnly(only *ignore.Ignorer) Option {
+	return func(w *walker) {
+		w.only = only
+	}
+}
+
+// WithChunking stores files of at least threshold bytes as content-defined
+// chunks referenced by a manifest, so an edit to a large file only stores
+// the chunks around it. Chunked files hash differently from whole ones, so
+// every walk compared against a root must use the same threshold.
+func WithChunking(threshold int64) Option {
+	return func(w *walker) {
+		w.chunkThreshold = threshold
+	}
+}
+
+// WithOverlay applies o on top of the walked directory.
+func WithOverlay(o *Overlay) Option {
+	return func(w *walker) {
+		w.overlay = o
+	}
+}
+
+// WithIgnoreFileName loads and excludes name instead of .smerkleignore, for
+// embedders that don't want smerkle-branded dotfiles in user trees.
+func WithIgnoreFileName(name string) Option {
+	return func(w *walker) {
+		w.ignoreFileName = name
+	}
+}
+
+// WithIncludeIgnoreFile hashes ignore files like any other file, so
+// changes to ignore rules are reflected in the root hash.
+func WithIncludeIgnoreFile() Option {
+	return func(w *walker) {
+		w.includeIgnoreFile = true
+	}
+}
+
+// WithStrictIgnore fails the walk with ErrInvalidIgnore when any ignore
+// pattern fails to compile, instead of skipping it.
+func WithStrictIgnore() Option {
+	return func(w *walker) {
+		w.strictIgnore = true
+	}
+}
+
+// WithBudget bounds the walk to d. Once it elapses the walker stops starting
+// new work, finishes what is in flight, and returns a best-effort root over
+// the completed entries with the skipped paths in Result.Unvisited.
+func WithBudget(d time.Duration) Option {
+	return func(w *walker) {
+		w.budget = d
+	}
+}
+
+// WithVolatileFirst starts subdirectories that changed most often on earlier
+// walks first, so changes in busy subtrees surface sooner on large, mostly
+// static trees. It never affects the resulting hash.
+func WithVolatileFirst() Option {
+	return func(w *walker) {
+		w.volatileFirst = true
+	}
+}
+
+// WithRereadUnstable rereads a file up to n more times when its size or
+// modification time changed while it was being read, before giving up and
+// reporting it in Result.Unstable.
+func WithRereadUnstable(n int) Option {
+	return func(w *walker) {
+		w.rereads = n
+	}
+}
+
+// WithSourceRoot declares that the walk root is a copy of dir, such as a
+// filesystem snapshot of it, so a store inside dir is still excluded.
+func WithSourceRoot(dir string) Option {
+	return func(w *walker) {
+		w.sourceRoot = dir
+	}
+}
+
+// WithCacheNamespace prefixes index cache keys with ns, so walks of different
+// roots sharing one store don't serve each other's cached hashes for files
+// at the same relative path.
+func WithCacheNamespace(ns string) Option {
+	return func(w *walker) {
+		w.cacheNS = ns
+	}
+}
+
+// WithInaccessibleEntries records files and directories that can't be read
+// for lack of permission as object.ModeInaccessible entries with a zero hash,
+// instead of leaving them out, so the root hash changes when permissions do.
+// The errors are still reported in Result.Errors.
+func WithInaccessibleEntries() Option {
+	return func(w *walker) {
+		w.inaccessible = true
+	}
+}
+
+// WithFS reads the tree through fsys instead of the host filesystem, so
+// tests can change files between the walker's stat and read.
+func WithFS(fsys vfs.FS) Option {
+	return func(w *walker) {
+		w.fs = fsys
+	}
+}
+
+// WithClock reads the time for WithBudget from c instead of the system
+// clock.
+func WithClock(c vfs.Clock) Option {
+	return func(w *walker) {
+		w.clock = c
+	}
+}
+
+// Pool bounds concurrent file reads and open file descriptors across every
+// walk it is passed to.
+type Pool struct {
+	sem chan struct{}
+	fds chan struct{}
+}
+
+// NewPool returns a pool of n read slots and fds file descriptors. If
+// n <= 0, defaults to runtime.NumCPU(); if fds <= 0, to DefaultMaxOpenFiles().
+func NewPool(n, fds int) *Pool {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	if fds <= 0 {
+		fds = DefaultMaxOpenFiles()
+	}
+	return &Pool{sem: make(chan struct{}, n), fds: make(chan struct{}, fds)}
+}
+
+// WithPool draws file reads from p instead of a per-walk limit, so
+// concurrent walks share one budget. It overrides WithConcurrency and
+// WithMaxOpenFiles.
+func WithPool(p *Pool) Option {
+	return func(w *walker) {
+		w.sem = p.sem
+		w.fds = p.fds
+	}
+}
+
+// WithMaxOpenFiles caps the file descriptors a walk holds at once: directory
+// reads run far ahead of the read slots, so this is what keeps a wide tree
+// under RLIMIT_NOFILE. If n <= 0, defaults to DefaultMaxOpenFiles().
+func WithMaxOpenFiles(n int) Option {
+	return func(w *walker) {
+		w.maxFDs = n
+	}
+}
+
+// DefaultMaxOpenFiles is half the process's soft RLIMIT_NOFILE, leaving the
+// rest for the store and the caller, capped at maxDefaultFDs.
+func DefaultMaxOpenFiles() int {
+	limit, ok := openFileLimit()
+	if !ok {
+		return maxDefaultFDs
+	}
+	return int(max(min(limit/2, maxDefaultFDs), 1)) //nolint:gosec // capped at maxDefaultFDs
+}
+
+// maxDefaultFDs caps the default budget when the rlimit is huge or unknown.
+const maxDefaultFDs = 1024
+
+// acquireFD blocks until the walk may open another file descriptor and
+// returns the function that gives it back. Holders only open, use, and close
+// one file, so waiting needs no cancellation.
+func (w *walker) acquireFD() func() {
+	w.fds <- struct{}{}
+	return func() { <-w.fds }
+}
+
+// WithConcurrency bounds concurrent file reads, and the goroutines a walk
+// starts to process entries, to n; if n <= 0, defaults to runtime.NumCPU().
 func WithConcurrency(n int) Option {
 	return func(w *walker) {
 		w.maxWorkers = n
@@ -55,17 +311,11 @@ func WithConcurrency(n int) Option {
 }
 
 // walk recursively traverses root, building a Merkle tree.
-// loads .smerkleignore from root if present.
+// loads the ignore file (.smerkleignore by default) from root if present.
 func Walk(ctx context.Context, root string, s *store.Store, opts ...Option) (*result.Result, error) {
-	w := &walker{
-		root:  root,
-		store: s,
-	}
-	for _, opt := range opts {
-		opt(w)
-	}
+	w := newWalker(root, s, opts)
 
-	info, err := os.Stat(w.root)
+	info, err := w.fs.Stat(w.root)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, ErrRootNotExist
@@ -75,11 +325,16 @@ func Walk(ctx context.Context, root string, s *store.Store, opts ...Option) (*re
 	if !info.IsDir() {
 		return nil, ErrRootNotDirectory
 	}
+	w.recordDir("", info)
+
+	if w.overlay != nil {
+		w.overlay.prepare()
+	}
 
 	if w.ignorer == nil {
 		var ign *ignore.Ignorer
-		ignorePath := filepath.Join(root, smerkleignoreFile)
-		if _, err := os.Stat(ignorePath); err == nil {
+		ignorePath := filepath.Join(root, w.ignoreFileName)
+		if _, err := w.fs.Stat(ignorePath); err == nil {
 			ign, err = ignore.NewFromFile(ignorePath)
 			if err != nil {
 				return nil, fmt.Errorf("load ignore file: %w", err)
@@ -87,28 +342,125 @@ func Walk(ctx context.Context, root string, s *store.Store, opts ...Option) (*re
 		}
 		w.ignorer = ign
 	}
+	if w.global != nil {
+		w.ignorer = ignore.Merge(w.global, w.ignorer)
+	}
 
-	workers := w.maxWorkers
-	if workers <= 0 {
-		workers = runtime.NumCPU()
+	if warnings := w.ignorer.Warnings(); w.strictIgnore && len(warnings) > 0 {
+		errs := make([]error, len(warnings))
+		for i, warning := range warnings {
+			errs[i] = warning
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIgnore, errors.Join(errs...))
 	}
-	w.sem = make(chan struct{}, workers)
 
-	w.ec = xerrors.NewErrorCollector()
+	source := w.root
+	if w.sourceRoot != "" {
+		source = w.sourceRoot
+	}
+	w.storeRel = storeRelPath(source, s.Root())
 
 	return w.walk(ctx)
 }
 
+// newWalker applies opts over the defaults and sets up the walk's limits,
+// without touching the disk.
+func newWalker(root string, s *store.Store, opts []Option) *walker {
+	w := &walker{
+		root:            root,
+		store:           s,
+		fs:              vfs.OS{},
+		clock:           vfs.SystemClock{},
+		ignoreFileName:  DefaultIgnoreFileName,
+		streamThreshold: DefaultStreamThreshold,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.started = w.clock.Now()
+	if w.budget > 0 {
+		w.deadline = w.started.Add(w.budget)
+	}
+	if w.cache == nil {
+		w.cache = indexCache{store: s}
+	}
+	if w.sem == nil {
+		pool := NewPool(w.maxWorkers, w.maxFDs)
+		w.sem, w.fds = pool.sem, pool.fds
+	}
+	w.workers = make(chan struct{}, cap(w.sem))
+	if w.memLimit > 0 {
+		w.mem = newMemory(w.memLimit, cap(w.sem))
+	}
+	w.ec = xerrors.NewErrorCollector()
+	return w
+}
+
 func (w *walker) walk(ctx context.Context) (*result.Result, error) {
 	hash, err := w.walkDir(ctx, w.root, "")
 	if err != nil {
 		return nil, err
 	}
 
-	return &result.Result{
-		Hash:   hash,
-		Errors: w.ec.Errors(),
-	}, nil
+	sort.Strings(w.unvisited)
+	sort.Strings(w.unstable)
+
+	res := &result.Result{
+		Hash:           hash,
+		IgnoreHash:     w.ignorer.Fingerprint(),
+		Errors:         w.ec.Errors(),
+		IgnoreWarnings: w.ignorer.Warnings(),
+		Unvisited:      w.unvisited,
+		Unstable:       w.unstable,
+		HardLinks:      w.linkGroups(),
+	}
+	res.Warnings = w.warnings(res)
+	if err := w.pruneCache(res); err != nil {
+		return nil, err
+	}
+	res.Metrics = result.Metrics{
+		FilesHashed: w.hashed.Load(),
+		FilesCached: w.cached.Load(),
+		BytesRead:   w.bytesRead.Load(),
+		Duration:    w.clock.Now().Sub(w.started),
+	}
+	return res, nil
+}
+
+// warnings gathers every caveat on res into one list, sorted by path.
+func (w *walker) warnings(res *result.Result) []result.Warning {
+	warnings := slices.Clone(w.special)
+	for _, iw := range res.IgnoreWarnings {
+		warnings = append(warnings, result.Warning{
+			Kind: result.WarningIgnorePattern, Path: iw.Source, Message: iw.Error(),
+		})
+	}
+	for _, p := range res.Unstable {
+		warnings = append(warnings, result.Warning{
+			Kind: result.WarningUnstable, Path: p, Message: "modified while being read",
+		})
+	}
+	for _, p := range res.Unvisited {
+		warnings = append(warnings, result.Warning{
+			Kind: result.WarningUnvisited, Path: p, Message: "walk budget exhausted",
+		})
+	}
+	slices.SortStableFunc(warnings, func(a, b result.Warning) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(string(a.Kind), string(b.Kind)))
+	})
+	return warnings
+}
+
+// expired reports whether the walk budget has run out.
+func (w *walker) expired() bool {
+	return !w.deadline.IsZero() && w.clock.Now().After(w.deadline)
+}
+
+// skip records relPath as left out of the tree because the budget ran out.
+func (w *walker) skip(relPath string) {
+	w.pathsMu.Lock()
+	w.unvisited = append(w.unvisited, relPath)
+	w.pathsMu.Unlock()
 }
 
 // walkDir walks a single directory recursively and returns its tree hash.
@@ -117,49 +469,121 @@ func (w *walker) walkDir(ctx context.Context, absDir, relDir string) (object.Has
 		return object.ZeroHash, fmt.Errorf("context: %w", err)
 	}
 
-	dirEntries, err := os.ReadDir(absDir)
-	if err != nil {
+	release := w.acquireFD()
+	dirEntries, err := w.fs.ReadDir(absDir)
+	release()
+	if err != nil && !w.overlayOnlyDir(relDir, err) {
 		return object.ZeroHash, fmt.Errorf("read dir: %w", err)
 	}
 
-	// build work items, filtering out .smerkleignore
+	// build work items, filtering out the ignore file and the store itself
 	type workItem struct {
 		name    string
 		relPath string
 		absPath string
+		isDir   bool
+		virtual bool         // directory that only exists in the overlay
+		file    *overlayFile // overlay file replacing the disk entry
 	}
 	workItems := make([]workItem, 0, len(dirEntries))
 	for _, de := range dirEntries {
 		name := de.Name()
-		if name == smerkleignoreFile {
+		if name == w.ignoreFileName && !w.includeIgnoreFile {
 			continue
 		}
 		relPath := name
 		if relDir != "" {
 			relPath = filepath.Join(relDir, name)
 		}
+		if w.storeRel != "" && relPath == w.storeRel {
+			continue
+		}
+		slashRel := filepath.ToSlash(relPath)
+		if w.overlay != nil && w.overlay.hides(slashRel) && !w.overlay.isDir(slashRel) {
+			continue
+		}
 		absPath := filepath.Join(absDir, name)
-		workItems = append(workItems, workItem{name: name, relPath: relPath, absPath: absPath})
+		workItems = append(workItems, workItem{name: name, relPath: relPath, absPath: absPath, isDir: de.IsDir()})
+	}
+
+	if w.overlay != nil {
+		for _, name := range w.overlay.children(filepath.ToSlash(relDir)) {
+			relPath := name
+			if relDir != "" {
+				relPath = filepath.Join(relDir, name)
+			}
+			wi := workItem{name: name, relPath: relPath, absPath: filepath.Join(absDir, name), isDir: true, virtual: true}
+			if f, ok := w.overlay.file(filepath.ToSlash(relPath)); ok {
+				wi.isDir, wi.virtual, wi.file = false, false, &f
+			}
+			i := slices.IndexFunc(workItems, func(item workItem) bool { return item.name == name })
+			switch {
+			case i < 0:
+				workItems = append(workItems, wi)
+			case wi.virtual && workItems[i].isDir:
+				// the disk directory holds the overlay files; walk it as usual
+			default:
+				workItems[i] = wi
+			}
+		}
 	}
 
-	// process entries concurrently
+	if w.volatileFirst {
+		changes := make(map[string]uint32)
+		for _, wi := range workItems {
+			if wi.isDir {
+				changes[wi.relPath] = w.store.DirChanges(w.cacheKey(wi.relPath))
+			}
+		}
+		slices.SortStableFunc(workItems, func(a, b workItem) int {
+			return cmp.Compare(changes[b.relPath], changes[a.relPath])
+		})
+	}
+
+	// process entries concurrently; results land by index, so the tree never
+	// depends on which finished first
 	results := make([]entryResult, len(workItems))
 	var wg sync.WaitGroup
 
-	for i, item := range workItems {
-		wg.Add(1)
-		go func(idx int, wi workItem) {
-			defer wg.Done()
-
+	for i, wi := range workItems {
+		process := func() {
 			// check context before processing
 			if err := ctx.Err(); err != nil {
-				results[idx] = entryResult{err: err}
+				results[i] = entryResult{err: err}
 				return
 			}
 
-			entry, err := w.processEntry(ctx, wi.absPath, wi.relPath, wi.name)
-			results[idx] = entryResult{entry: entry, err: err}
-		}(i, item)
+			var (
+				entry *object.Entry
+				err   error
+			)
+			switch {
+			case wi.file != nil:
+				entry, err = w.processOverlayFile(wi.relPath, wi.name, wi.file)
+			case wi.virtual:
+				entry, err = w.processVirtualDir(ctx, wi.absPath, wi.relPath, wi.name)
+			default:
+				entry, err = w.processEntry(ctx, wi.absPath, wi.relPath, wi.name)
+			}
+			results[i] = entryResult{entry: entry, err: err}
+			w.entryFunc.emit(wi.relPath, entry)
+		}
+
+		// hand the entry to a new goroutine only when a worker slot is free
+		// and process it here otherwise, so a wide directory never starts
+		// more goroutines than the concurrency limit, and a subdirectory never
+		// waits on slots its ancestors hold
+		select {
+		case w.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-w.workers }()
+				process()
+			}()
+		default:
+			process()
+		}
 	}
 
 	wg.Wait()
@@ -178,49 +602,119 @@ func (w *walker) walkDir(ctx context.Context, absDir, relDir string) (object.Has
 		}
 	}
 
-	// sort entries by name for determinism
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name < entries[j].Name
-	})
+	// a scoped walk drops directories without matching files
+	if w.only != nil && len(entries) == 0 && relDir != "" {
+		return object.ZeroHash, nil
+	}
 
-	tree := &object.Tree{Entries: entries}
+	tree := &object.Tree{Entries: entries, ModTimes: w.modTimes}
+	tree.SortEntries()
 	hash, err := w.store.PutTree(tree)
 	if err != nil {
 		return object.ZeroHash, fmt.Errorf("put tree: %w", err)
 	}
+
+	w.visitDir(w.cacheKey(relDir))
+	// a budget-truncated, scoped, or overlaid tree isn't a real change
+	if !w.expired() && w.only == nil && w.overlay == nil {
+		w.store.RecordDir(w.cacheKey(relDir), hash)
+	}
 	return hash, nil
 }
 
+// storeRelPath returns the store directory relative to root when the store
+// lives inside the walked tree, or "" otherwise. The store must never be
+// hashed as it changes while the walk writes objects into it.
+func storeRelPath(root, storeRoot string) string {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return ""
+	}
+	absStore, err := filepath.Abs(storeRoot)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(absRoot, absStore)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return rel
+}
+
 // processEntry processes a single directory entry and returns the corresponding tree entry.
 // returns nil entry if the entry should be skipped (ignored or error collected).
 func (w *walker) processEntry(ctx context.Context, absPath, relPath, name string) (*object.Entry, error) {
-	info, err := os.Lstat(absPath)
+	info, err := w.fs.Lstat(absPath)
+	if err != nil {
+		w.ec.Add(relPath, err)
+		return w.placeholder(name, nil, err), nil
+	}
+	info, err = w.resolveSymlink(absPath, relPath, info)
 	if err != nil {
 		w.ec.Add(relPath, err)
 		return nil, nil
 	}
+	if info == nil {
+		return nil, nil
+	}
 
 	isDir := info.IsDir()
 
 	if w.ignorer != nil && w.ignorer.Match(relPath, isDir) {
 		return nil, nil
 	}
+	if !isDir && w.only != nil && !w.only.Match(relPath, false) {
+		return nil, nil
+	}
+
+	if w.expired() {
+		w.skip(relPath)
+		return nil, nil
+	}
+	if w.overLimit(relPath, info) {
+		return nil, nil
+	}
+
+	// reading a device or named pipe could block or never end, and trees
+	// can't represent them anyway
+	if kind := specialKind(info.Mode()); kind != "" {
+		w.pathsMu.Lock()
+		w.special = append(w.special, result.Warning{
+			Kind: result.WarningSpecialFile, Path: relPath, Message: kind + " skipped",
+		})
+		w.pathsMu.Unlock()
+		return nil, nil
+	}
 
+	var entry *object.Entry
 	if isDir {
-		return w.processDirEntry(ctx, absPath, relPath, name, info)
+		entry, err = w.processDirEntry(ctx, absPath, relPath, name, info)
+	} else {
+		entry, err = w.processFileEntry(ctx, absPath, relPath, info)
 	}
-	return w.processFileEntry(ctx, absPath, relPath, info)
+	if err != nil || entry == nil || !w.fullMetadata || entry.Mode == object.ModeInaccessible {
+		return entry, err
+	}
+	// the entry stays, without metadata, so the error doesn't also hide it
+	if entry.Meta, err = w.metadata(absPath, info); err != nil {
+		w.ec.Add(relPath, err)
+	}
+	return entry, nil
 }
 
 // processDirEntry processes a directory entry.
 func (w *walker) processDirEntry(ctx context.Context, absPath, relPath, name string, info os.FileInfo) (*object.Entry, error) {
+	w.recordDir(relPath, info)
 	hash, err := w.walkDir(ctx, absPath, relPath)
 	if err != nil {
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return nil, err
 		}
 		w.ec.Add(relPath, err)
-		return nil, nil
+		return w.placeholder(name, info, err), nil
+	}
+	if hash.IsZero() {
+		return nil, nil // dropped by WithOnly
 	}
 	return &object.Entry{
 		Name:    name,
@@ -233,17 +727,39 @@ func (w *walker) processDirEntry(ctx context.Context, absPath, relPath, name str
 
 // processFileEntry processes a file or symlink entry.
 func (w *walker) processFileEntry(ctx context.Context, absPath, relPath string, info os.FileInfo) (*object.Entry, error) {
-	entry, err := w.hashFile(ctx, absPath, relPath, info)
+	if w.fileLimitReached() {
+		w.skip(relPath)
+		return nil, nil
+	}
+	entry, err := w.hashLinked(ctx, absPath, relPath, info)
 	if err != nil {
+		if errors.Is(err, errBudgetExhausted) {
+			w.skip(relPath)
+			return nil, nil
+		}
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return nil, err
 		}
 		w.ec.Add(relPath, err)
-		return nil, nil
+		return w.placeholder(info.Name(), info, err), nil
 	}
 	return &entry, nil
 }
 
+// placeholder returns the ModeInaccessible entry standing in for name when
+// err denied access and WithInaccessibleEntries is set, and nil otherwise.
+// info is nil when the path couldn't even be stat'd.
+func (w *walker) placeholder(name string, info os.FileInfo, err error) *object.Entry {
+	if !w.inaccessible || !errors.Is(err, fs.ErrPermission) {
+		return nil
+	}
+	e := &object.Entry{Name: name, Mode: object.ModeInaccessible}
+	if info != nil {
+		e.ModTime = info.ModTime()
+	}
+	return e
+}
+
 // hashFile hashes a single file and returns its entry.
 func (w *walker) hashFile(ctx context.Context, absPath, relPath string, info os.FileInfo) (object.Entry, error) {
 	// acquire semaphore to limit concurrent file I/O
@@ -257,13 +773,19 @@ func (w *walker) hashFile(ctx context.Context, absPath, relPath string, info os.
 	if err := ctx.Err(); err != nil {
 		return object.Entry{}, fmt.Errorf("context: %w", err)
 	}
+	// the budget may have run out while waiting for a slot
+	if w.expired() {
+		return object.Entry{}, errBudgetExhausted
+	}
 
 	mode := modeFromFileInfo(info)
 	name := filepath.Base(relPath)
 
 	// try cache for non-symlinks
 	if mode != object.ModeSymlink {
-		if hash, ok := w.store.LookupCache(relPath, info.Size(), info.ModTime()); ok {
+		if hash, ok := w.lookupCache(relPath, absPath, info); ok {
+			w.cached.Add(1)
+			w.progress.done(relPath, info.Size())
 			return object.Entry{
 				Name:    name,
 				Mode:    mode,
@@ -274,21 +796,29 @@ func (w *walker) hashFile(ctx context.Context, absPath, relPath string, info os.
 		}
 	}
 
-	content, err := readContent(absPath, mode)
+	var hash object.Hash
+	var stable bool
+	var err error
+	if w.streams(mode, info.Size()) {
+		hash, info, stable, err = w.streamStable(absPath, info)
+	} else {
+		hash, info, stable, err = w.readAndPut(absPath, mode, info)
+	}
 	if err != nil {
 		return object.Entry{}, err
 	}
-
-	blob := &object.Blob{Content: content}
-	hash, err := w.store.PutBlob(blob)
-	if err != nil {
-		return object.Entry{}, fmt.Errorf("put blob: %w", err)
+	w.hashed.Add(1)
+	if !stable {
+		w.pathsMu.Lock()
+		w.unstable = append(w.unstable, relPath)
+		w.pathsMu.Unlock()
 	}
 
-	// update cache for non-symlinks
-	if mode != object.ModeSymlink {
-		w.store.UpdateCache(relPath, info.Size(), info.ModTime(), hash)
+	// update cache for non-symlinks; an unstable hash matches no real state
+	if mode != object.ModeSymlink && stable {
+		w.updateCache(relPath, absPath, info, hash)
 	}
+	w.progress.done(relPath, info.Size())
 
 	return object.Entry{
 		Name:    name,
@@ -299,23 +829,158 @@ func (w *walker) hashFile(ctx context.Context, absPath, relPath string, info os.
 	}, nil
 }
 
+// readAndPut reads a file whole with readStable and stores it, within the
+// memory budget.
+func (w *walker) readAndPut(absPath string, mode object.Mode, info os.FileInfo) (object.Hash, os.FileInfo, bool, error) {
+	defer w.mem.acquire(bufferedCost(info.Size()))()
+
+	content, info, stable, err := w.readStable(absPath, mode, info)
+	if err != nil {
+		return object.ZeroHash, nil, false, err
+	}
+	hash, err := w.putContent(content, mode)
+	if err != nil {
+		return object.ZeroHash, nil, false, err
+	}
+	return hash, info, stable, nil
+}
+
+// putContent stores file content as one blob, or as chunks and a manifest
+// when it reaches the chunking threshold.
+func (w *walker) putContent(content []byte, mode object.Mode) (object.Hash, error) {
+	// the store writes each object through a temp file
+	defer w.acquireFD()()
+
+	if w.chunkThreshold <= 0 || int64(len(content)) < w.chunkThreshold || mode == object.ModeSymlink {
+		h, err := w.store.PutBlob(&object.Blob{Content: content})
+		if err != nil {
+			return object.ZeroHash, fmt.Errorf("put blob: %w", err)
+		}
+		return h, nil
+	}
+
+	pieces := chunk.Split(content)
+	m := &object.Manifest{Chunks: make([]object.Chunk, 0, len(pieces))}
+	for _, p := range pieces {
+		h, err := w.store.PutBlob(&object.Blob{Content: p})
+		if err != nil {
+			return object.ZeroHash, fmt.Errorf("put chunk: %w", err)
+		}
+		m.Chunks = append(m.Chunks, object.Chunk{Hash: h, Size: uint32(len(p))}) //nolint:gosec // chunks are at most chunk.MaxSize
+	}
+	h, err := w.store.PutManifest(m)
+	if err != nil {
+		return object.ZeroHash, fmt.Errorf("put manifest: %w", err)
+	}
+	return h, nil
+}
+
+// readStable reads absPath and checks that its size and modification time
+// still match info afterwards, since content read from a file being written
+// matches neither its old nor its new state. On a mismatch it rereads up to
+// w.rereads times using fresh metadata. It returns the content, the metadata
+// it corresponds to, and whether the two were consistent.
+func (w *walker) readStable(absPath string, mode object.Mode, info os.FileInfo) ([]byte, os.FileInfo, bool, error) {
+	for attempt := 0; ; attempt++ {
+		release := w.acquireFD()
+		content, err := w.readContent(absPath, mode)
+		release()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		w.bytesRead.Add(int64(len(content)))
+		if mode == object.ModeSymlink {
+			return content, info, true, nil
+		}
+
+		after, err := w.lstat(absPath)
+		if err == nil && int64(len(content)) == info.Size() &&
+			after.Size() == info.Size() && after.ModTime().Equal(info.ModTime()) {
+			return content, info, true, nil
+		}
+		if err != nil || attempt >= w.rereads {
+			return content, info, false, nil
+		}
+		info = after
+	}
+}
+
+// lookupCache consults the cache, rejecting hits whose blob is missing from
+// the store: caches other than the store's own index outlive and are shared
+// between stores.
+func (w *walker) lookupCache(relPath, absPath string, info os.FileInfo) (object.Hash, bool) {
+	c, key := w.fileCache(relPath, info)
+	w.visit(c, key)
+	hash, ok := c.Lookup(key, absPath, info)
+	if !ok {
+		return object.ZeroHash, false
+	}
+	if _, own := c.(indexCache); !own && !w.store.HasObject(hash) {
+		return object.ZeroHash, false
+	}
+	return hash, true
+}
+
+func (w *walker) updateCache(relPath, absPath string, info os.FileInfo, hash object.Hash) {
+	c, key := w.fileCache(relPath, info)
+	w.visit(c, key)
+	c.Update(key, absPath, info, hash)
+}
+
+// fileCache picks the cache and key for a file. Manifest hashes of chunked
+// files live under their own index key, so walks with and without chunking
+// never serve each other's hashes; other caches hold one hash per file and
+// only see whole-blob hashes.
+func (w *walker) fileCache(relPath string, info os.FileInfo) (Cache, string) {
+	if w.chunkThreshold > 0 && info.Size() >= w.chunkThreshold {
+		return indexCache{store: w.store}, w.cacheKey(relPath) + "\x00chunked"
+	}
+	return w.cache, w.cacheKey(relPath)
+}
+
+func (w *walker) cacheKey(relPath string) string {
+	if w.cacheNS == "" {
+		return relPath
+	}
+	return w.cacheNS + "\x00" + relPath
+}
+
 // readContent reads the content of a file or symlink target.
-func readContent(absPath string, mode object.Mode) ([]byte, error) {
+func (w *walker) readContent(absPath string, mode object.Mode) ([]byte, error) {
 	if mode == object.ModeSymlink {
-		target, err := os.Readlink(absPath)
+		target, err := w.fs.Readlink(absPath)
 		if err != nil {
 			return nil, fmt.Errorf("readlink: %w", err)
 		}
 		return []byte(target), nil
 	}
 
-	content, err := os.ReadFile(absPath) //nolint:gosec // absPath is constructed from trusted directory traversal
+	content, err := w.fs.ReadFile(absPath)
 	if err != nil {
 		return nil, fmt.Errorf("read file: %w", err)
 	}
 	return content, nil
 }
 
+// specialKind names the kind of special file m describes, or returns "" for
+// directories, regular files, and symlinks.
+func specialKind(m os.FileMode) string {
+	switch {
+	case m&os.ModeCharDevice != 0:
+		return "character device"
+	case m&os.ModeDevice != 0:
+		return "device"
+	case m&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case m&os.ModeSocket != 0:
+		return "socket"
+	case m&os.ModeIrregular != 0:
+		return "irregular file"
+	default:
+		return ""
+	}
+}
+
 // modeFromFileInfo determines the object.Mode from os.FileInfo.
 func modeFromFileInfo(info os.FileInfo) object.Mode {
 	mode := info.Mode()
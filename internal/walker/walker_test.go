@@ -1,19 +1,29 @@
 package walker
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/garrettladley/smerkle/internal/chunk"
 	"github.com/garrettladley/smerkle/internal/ignore"
 	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/result"
 	"github.com/garrettladley/smerkle/internal/store"
+	"github.com/garrettladley/smerkle/internal/vfs"
 )
 
 func TestWalk(t *testing.T) {
@@ -374,6 +384,103 @@ func TestWalkIgnorePatterns(t *testing.T) {
 		}
 	})
 
+	t.Run("smerkleignore included with option", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "keep.txt"), "keep")
+		writeIgnoreFile(t, root, "*.log")
+		s := setupStore(t)
+
+		excluded, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		included, err := Walk(context.Background(), root, s, WithIncludeIgnoreFile())
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if excluded.Hash == included.Hash {
+			t.Error("hash should differ when .smerkleignore is included")
+		}
+
+		tree, err := s.GetTree(included.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+		found := false
+		for _, e := range tree.Entries {
+			if e.Name == ".smerkleignore" {
+				found = true
+			}
+		}
+		if !found {
+			t.Error(".smerkleignore should appear in tree")
+		}
+
+		writeIgnoreFile(t, root, "*.log", "*.tmp")
+		changed, err := Walk(context.Background(), root, s, WithIncludeIgnoreFile())
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if changed.Hash == included.Hash {
+			t.Error("hash should change when ignore rules change")
+		}
+	})
+
+	t.Run("custom ignore file name", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "keep.txt"), "keep")
+		writeFile(t, filepath.Join(root, "ignore.log"), "ignore")
+		writeFile(t, filepath.Join(root, ".artifactsignore"), "*.log")
+		writeIgnoreFile(t, root, "keep.txt")
+		s := setupStore(t)
+
+		result, err := Walk(context.Background(), root, s, WithIgnoreFileName(".artifactsignore"))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+
+		tree, err := s.GetTree(result.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+
+		names := make([]string, 0, len(tree.Entries))
+		for _, e := range tree.Entries {
+			names = append(names, e.Name)
+		}
+		// .smerkleignore is an ordinary file now; .artifactsignore is excluded
+		want := []string{".smerkleignore", "keep.txt"}
+		if strings.Join(names, ",") != strings.Join(want, ",") {
+			t.Errorf("tree entries = %v, want %v", names, want)
+		}
+	})
+
+	t.Run("invalid patterns are reported", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "keep.txt"), "keep")
+		writeIgnoreFile(t, root, "*.log\n[bad")
+		s := setupStore(t)
+
+		result, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if len(result.IgnoreWarnings) != 1 || result.IgnoreWarnings[0].Line != 2 {
+			t.Errorf("IgnoreWarnings = %v, want one warning on line 2", result.IgnoreWarnings)
+		}
+
+		_, err = Walk(context.Background(), root, s, WithStrictIgnore())
+		if !errors.Is(err, ErrInvalidIgnore) {
+			t.Errorf("Walk(WithStrictIgnore) error = %v, want ErrInvalidIgnore", err)
+		}
+	})
+
 	t.Run("ignores directories", func(t *testing.T) {
 		t.Parallel()
 
@@ -427,6 +534,36 @@ func TestWalkIgnorePatterns(t *testing.T) {
 		}
 	})
 
+	t.Run("Walk(...WithGlobalIgnorer(...)) layers beneath the tree's rules", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "keep.txt"), "keep")
+		writeFile(t, filepath.Join(root, ".DS_Store"), "finder")
+		writeFile(t, filepath.Join(root, "build.log"), "log")
+		writeFile(t, filepath.Join(root, "debug.log"), "log")
+		writeIgnoreFile(t, root, "!build.log", "debug.log")
+		s := setupStore(t)
+
+		result, err := Walk(context.Background(), root, s, WithGlobalIgnorer(mustIgnorer(t, ".DS_Store", "*.log")))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+
+		tree, err := s.GetTree(result.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+
+		var names []string
+		for _, e := range tree.Entries {
+			names = append(names, e.Name)
+		}
+		if want := []string{"build.log", "keep.txt"}; !slices.Equal(names, want) {
+			t.Errorf("entries = %q, want %q", names, want)
+		}
+	})
+
 	t.Run("negation patterns work", func(t *testing.T) {
 		t.Parallel()
 
@@ -493,6 +630,36 @@ func TestWalkCache(t *testing.T) {
 		}
 	})
 
+	t.Run("counts hashed and cached files", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "a.txt"), "aaa")
+		writeFile(t, filepath.Join(root, "sub", "b.txt"), "bb")
+		s := setupStore(t)
+
+		result1, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if m := result1.Metrics; m.FilesHashed != 2 || m.FilesCached != 0 || m.BytesRead != 5 {
+			t.Errorf("first walk metrics = %+v, want 2 files hashed, 5 bytes read", m)
+		}
+
+		writeFile(t, filepath.Join(root, "c.txt"), "c")
+		result2, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		m := result2.Metrics
+		if m.FilesHashed != 1 || m.FilesCached != 2 || m.BytesRead != 1 {
+			t.Errorf("second walk metrics = %+v, want 1 file hashed, 2 cached, 1 byte read", m)
+		}
+		if got, want := m.CacheHitRate(), 2.0/3; got != want {
+			t.Errorf("CacheHitRate() = %v, want %v", got, want)
+		}
+	})
+
 	t.Run("detects modified files", func(t *testing.T) {
 		t.Parallel()
 
@@ -544,6 +711,39 @@ func TestWalkCache(t *testing.T) {
 		}
 	})
 
+	t.Run("namespaces isolate roots sharing a store", func(t *testing.T) {
+		t.Parallel()
+
+		rootA := t.TempDir()
+		rootB := t.TempDir()
+		pathA := filepath.Join(rootA, "same.txt")
+		pathB := filepath.Join(rootB, "same.txt")
+		writeFile(t, pathA, "aaaa")
+		writeFile(t, pathB, "bbbb")
+
+		// identical size and mtime would otherwise hit the same cache entry
+		mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		for _, p := range []string{pathA, pathB} {
+			if err := os.Chtimes(p, mtime, mtime); err != nil {
+				t.Fatalf("Chtimes() error = %v", err)
+			}
+		}
+		s := setupStore(t)
+
+		resultA, err := Walk(context.Background(), rootA, s, WithCacheNamespace(rootA))
+		if err != nil {
+			t.Fatalf("Walk(A) error = %v", err)
+		}
+		resultB, err := Walk(context.Background(), rootB, s, WithCacheNamespace(rootB))
+		if err != nil {
+			t.Fatalf("Walk(B) error = %v", err)
+		}
+
+		if resultA.Hash == resultB.Hash {
+			t.Error("hash should differ for roots with different content")
+		}
+	})
+
 	t.Run("detects deleted files", func(t *testing.T) {
 		t.Parallel()
 
@@ -621,6 +821,157 @@ func TestWalkErrors(t *testing.T) {
 			t.Error("readable file should be in tree")
 		}
 	})
+
+	t.Run("inaccessible entries stand in for unreadable paths", func(t *testing.T) {
+		t.Parallel()
+
+		if os.Getuid() == 0 {
+			t.Skip("test requires non-root user")
+		}
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "readable.txt"), "readable")
+		writeFile(t, filepath.Join(root, "locked", "secret.txt"), "secret")
+		unreadable := filepath.Join(root, "unreadable.txt")
+		writeFile(t, unreadable, "unreadable")
+		locked := filepath.Join(root, "locked")
+		for _, p := range []string{unreadable, locked} {
+			if err := os.Chmod(p, 0o000); err != nil {
+				t.Fatalf("Chmod() error = %v", err)
+			}
+		}
+		t.Cleanup(func() {
+			_ = os.Chmod(locked, 0o700)
+			_ = os.Chmod(unreadable, 0o600)
+		})
+		s := setupStore(t)
+
+		omitted, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		result, err := Walk(context.Background(), root, s, WithInaccessibleEntries())
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if result.Hash == omitted.Hash {
+			t.Error("hash should differ when inaccessible paths are recorded")
+		}
+		if len(result.Errors) != 2 {
+			t.Errorf("errors count = %d, want 2", len(result.Errors))
+		}
+
+		tree, err := s.GetTree(result.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+		modes := make(map[string]object.Mode)
+		for _, e := range tree.Entries {
+			modes[e.Name] = e.Mode
+			if e.Mode == object.ModeInaccessible && !e.Hash.IsZero() {
+				t.Errorf("%s hash = %s, want zero", e.Name, e.Hash)
+			}
+		}
+		for _, name := range []string{"locked", "unreadable.txt"} {
+			if modes[name] != object.ModeInaccessible {
+				t.Errorf("%s mode = %s, want %s", name, modes[name], object.ModeInaccessible)
+			}
+		}
+	})
+}
+
+func TestWalkWarnings(t *testing.T) {
+	t.Parallel()
+
+	t.Run("clean walk has none", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "a.txt"), "a")
+		res, err := Walk(context.Background(), root, setupStore(t))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if !res.Clean() || len(res.Warnings) != 0 {
+			t.Errorf("Warnings = %v, want none", res.Warnings)
+		}
+	})
+
+	t.Run("special files and ignore patterns", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "a.txt"), "a")
+		writeIgnoreFile(t, root, "[bad")
+		ln, err := net.Listen("unix", filepath.Join(root, "sock"))
+		if err != nil {
+			t.Skipf("unix sockets unavailable: %v", err)
+		}
+		t.Cleanup(func() { _ = ln.Close() })
+		s := setupStore(t)
+
+		res, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if res.Clean() {
+			t.Error("Clean() = true, want false")
+		}
+		var kinds []string
+		for _, w := range res.Warnings {
+			kinds = append(kinds, string(w.Kind)+":"+w.Path)
+		}
+		want := []string{
+			string(result.WarningIgnorePattern) + ":" + filepath.Join(root, DefaultIgnoreFileName),
+			string(result.WarningSpecialFile) + ":sock",
+		}
+		slices.Sort(want)
+		if strings.Join(kinds, ",") != strings.Join(want, ",") {
+			t.Errorf("Warnings = %v, want %v", kinds, want)
+		}
+
+		tree, err := s.GetTree(res.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+		for _, e := range tree.Entries {
+			if e.Name == "sock" {
+				t.Error("socket should not be in tree")
+			}
+		}
+	})
+}
+
+func TestPlaceholder(t *testing.T) {
+	t.Parallel()
+
+	denied := &fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}
+	tests := []struct {
+		name   string
+		record bool
+		err    error
+		want   bool
+	}{
+		{name: "permission denied", record: true, err: denied, want: true},
+		{name: "wrapped", record: true, err: fmt.Errorf("read dir: %w", denied), want: true},
+		{name: "not recording", record: false, err: denied, want: false},
+		{name: "other error", record: true, err: fs.ErrNotExist, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := &walker{inaccessible: tt.record}
+			got := w.placeholder("x", nil, tt.err)
+			if (got != nil) != tt.want {
+				t.Fatalf("placeholder() = %v, want entry: %v", got, tt.want)
+			}
+			if got != nil && (got.Mode != object.ModeInaccessible || !got.Hash.IsZero() || got.Name != "x") {
+				t.Errorf("placeholder() = %+v", got)
+			}
+		})
+	}
 }
 
 func TestWalkContext(t *testing.T) {
@@ -649,6 +1000,305 @@ func TestWalkContext(t *testing.T) {
 	})
 }
 
+func TestWalkBudget(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ample budget visits everything", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "a.txt"), "a")
+		writeFile(t, filepath.Join(root, "sub", "b.txt"), "b")
+		s := setupStore(t)
+
+		full, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		bounded, err := Walk(context.Background(), root, s, WithBudget(time.Hour))
+		if err != nil {
+			t.Fatalf("Walk(WithBudget) error = %v", err)
+		}
+		if bounded.Partial() {
+			t.Errorf("Unvisited = %v, want none", bounded.Unvisited)
+		}
+		if bounded.Hash != full.Hash {
+			t.Errorf("Hash = %s, want %s", bounded.Hash, full.Hash)
+		}
+	})
+
+	t.Run("exhausted budget reports unvisited paths", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "a.txt"), "a")
+		writeFile(t, filepath.Join(root, "sub", "b.txt"), "b")
+		s := setupStore(t)
+
+		res, err := Walk(context.Background(), root, s, WithBudget(time.Nanosecond))
+		if err != nil {
+			t.Fatalf("Walk(WithBudget) error = %v", err)
+		}
+		if !res.Partial() {
+			t.Fatal("Partial() = false, want true")
+		}
+		want := []string{"a.txt", "sub"}
+		if strings.Join(res.Unvisited, ",") != strings.Join(want, ",") {
+			t.Errorf("Unvisited = %v, want %v", res.Unvisited, want)
+		}
+
+		tree, err := s.GetTree(res.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+		if len(tree.Entries) != 0 {
+			t.Errorf("len(tree.Entries) = %d, want 0", len(tree.Entries))
+		}
+	})
+
+	t.Run("clock jump mid-walk skips the rest", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "sub", "b.txt"), "b")
+		clock := vfs.NewFakeClock(time.Unix(0, 0))
+		fsys := &vfs.FaultFS{FS: vfs.OS{}, Inject: func(op vfs.Op, name string) error {
+			if op == vfs.OpReadDir && filepath.Base(name) == "sub" {
+				clock.Advance(time.Hour)
+			}
+			return nil
+		}}
+
+		res, err := Walk(context.Background(), root, setupStore(t),
+			WithBudget(time.Minute), WithClock(clock), WithFS(fsys))
+		if err != nil {
+			t.Fatalf("Walk(WithBudget) error = %v", err)
+		}
+		if strings.Join(res.Unvisited, ",") != "sub/b.txt" {
+			t.Errorf("Unvisited = %v, want [sub/b.txt]", res.Unvisited)
+		}
+	})
+}
+
+func TestWalkVolatileFirst(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "static", "a.txt"), "a")
+	writeFile(t, filepath.Join(root, "busy", "b.txt"), "b0")
+	s := setupStore(t)
+
+	for i := range 3 {
+		writeFile(t, filepath.Join(root, "busy", "b.txt"), "b"+string(rune('0'+i)))
+		if _, err := Walk(context.Background(), root, s); err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+	}
+
+	if got := s.DirChanges("busy"); got != 2 {
+		t.Errorf("DirChanges(busy) = %d, want 2", got)
+	}
+	if got := s.DirChanges("static"); got != 0 {
+		t.Errorf("DirChanges(static) = %d, want 0", got)
+	}
+
+	plain, err := Walk(context.Background(), root, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	ordered, err := Walk(context.Background(), root, s, WithVolatileFirst())
+	if err != nil {
+		t.Fatalf("Walk(WithVolatileFirst) error = %v", err)
+	}
+	if ordered.Hash != plain.Hash {
+		t.Errorf("Hash = %s, want %s", ordered.Hash, plain.Hash)
+	}
+}
+
+func TestWalkOnly(t *testing.T) {
+	t.Parallel()
+
+	only, err := ignore.New(strings.NewReader("**/*.go\ngo.sum\n"))
+	if err != nil {
+		t.Fatalf("ignore.New() error = %v", err)
+	}
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "main.go"), "package main")
+	writeFile(t, filepath.Join(root, "go.sum"), "sums")
+	writeFile(t, filepath.Join(root, "README.md"), "readme")
+	writeFile(t, filepath.Join(root, "docs", "guide.md"), "guide")
+	writeFile(t, filepath.Join(root, "pkg", "x.go"), "package pkg")
+	mkdir(t, filepath.Join(root, "empty"))
+
+	want := t.TempDir()
+	writeFile(t, filepath.Join(want, "main.go"), "package main")
+	writeFile(t, filepath.Join(want, "go.sum"), "sums")
+	writeFile(t, filepath.Join(want, "pkg", "x.go"), "package pkg")
+
+	s := setupStore(t)
+	wantRes, err := Walk(context.Background(), want, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	scoped, err := Walk(context.Background(), root, s, WithOnly(only))
+	if err != nil {
+		t.Fatalf("Walk(WithOnly) error = %v", err)
+	}
+	if scoped.Hash != wantRes.Hash {
+		t.Errorf("Hash = %s, want %s (matching files only)", scoped.Hash, wantRes.Hash)
+	}
+
+	writeFile(t, filepath.Join(root, "docs", "guide.md"), "guide v2")
+	again, err := Walk(context.Background(), root, s, WithOnly(only))
+	if err != nil {
+		t.Fatalf("Walk(WithOnly) error = %v", err)
+	}
+	if again.Hash != scoped.Hash {
+		t.Errorf("Hash changed to %s after editing an unmatched file", again.Hash)
+	}
+}
+
+func TestWalkPool(t *testing.T) {
+	t.Parallel()
+
+	roots := make([]string, 4)
+	for i := range roots {
+		roots[i] = t.TempDir()
+		writeFile(t, filepath.Join(roots[i], "a.txt"), "a"+string(rune('0'+i)))
+		writeFile(t, filepath.Join(roots[i], "sub", "b.txt"), "b")
+	}
+	s := setupStore(t)
+
+	want := make([]object.Hash, len(roots))
+	for i, root := range roots {
+		res, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		want[i] = res.Hash
+	}
+
+	// a single shared read slot and descriptor must not deadlock concurrent walks
+	pool := NewPool(1, 1)
+	got := make([]object.Hash, len(roots))
+	errs := make([]error, len(roots))
+	var wg sync.WaitGroup
+	for i, root := range roots {
+		wg.Go(func() {
+			res, err := Walk(context.Background(), root, s, WithPool(pool), WithCacheNamespace(root))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			got[i] = res.Hash
+		})
+	}
+	wg.Wait()
+
+	for i := range roots {
+		if errs[i] != nil {
+			t.Fatalf("Walk(WithPool) error = %v", errs[i])
+		}
+		if got[i] != want[i] {
+			t.Errorf("root %d: Hash = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWalkChunking(t *testing.T) {
+	t.Parallel()
+
+	big := make([]byte, 3*chunk.AvgSize)
+	r := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // deterministic test data
+	for i := range big {
+		big[i] = byte(r.Uint32())
+	}
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "disk.img"), string(big))
+	writeFile(t, filepath.Join(root, "small.txt"), "small")
+	s := setupStore(t)
+
+	// a whole-file walk first, so its cached hashes must not leak into the chunked one
+	whole, err := Walk(context.Background(), root, s)
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	chunked, err := Walk(context.Background(), root, s, WithChunking(chunk.MinSize))
+	if err != nil {
+		t.Fatalf("Walk(WithChunking) error = %v", err)
+	}
+	if chunked.Hash == whole.Hash {
+		t.Fatal("chunked and whole-file walks share a root hash")
+	}
+	fresh, err := Walk(context.Background(), root, setupStore(t), WithChunking(chunk.MinSize))
+	if err != nil {
+		t.Fatalf("Walk(WithChunking) error = %v", err)
+	}
+	if fresh.Hash != chunked.Hash {
+		t.Errorf("Hash = %s, want %s from an empty store", chunked.Hash, fresh.Hash)
+	}
+
+	tree, err := s.GetTree(chunked.Hash)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	entries := map[string]object.Entry{}
+	for _, e := range tree.Entries {
+		entries[e.Name] = e
+	}
+
+	m, err := s.GetManifest(entries["disk.img"].Hash)
+	if err != nil {
+		t.Fatalf("GetManifest(disk.img) error = %v", err)
+	}
+	if len(m.Chunks) < 2 || m.Size() != int64(len(big)) {
+		t.Errorf("manifest has %d chunks totalling %d bytes, want several totalling %d", len(m.Chunks), m.Size(), len(big))
+	}
+	if entries["disk.img"].Size != int64(len(big)) {
+		t.Errorf("disk.img Size = %d, want %d", entries["disk.img"].Size, len(big))
+	}
+	content, err := s.ReadFile(entries["disk.img"].Hash)
+	if err != nil {
+		t.Fatalf("ReadFile(disk.img) error = %v", err)
+	}
+	if !bytes.Equal(content, big) {
+		t.Error("ReadFile(disk.img) doesn't match the file")
+	}
+	if _, err := s.GetBlob(entries["small.txt"].Hash); err != nil {
+		t.Errorf("small.txt below the threshold: GetBlob() error = %v", err)
+	}
+
+	// an edit near the end leaves the leading chunks shared
+	big[len(big)-10] ^= 0xff
+	writeFile(t, filepath.Join(root, "disk.img"), string(big))
+	edited, err := Walk(context.Background(), root, s, WithChunking(chunk.MinSize))
+	if err != nil {
+		t.Fatalf("Walk(WithChunking) error = %v", err)
+	}
+	editedTree, err := s.GetTree(edited.Hash)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	for _, e := range editedTree.Entries {
+		if e.Name != "disk.img" {
+			continue
+		}
+		m2, err := s.GetManifest(e.Hash)
+		if err != nil {
+			t.Fatalf("GetManifest() error = %v", err)
+		}
+		if m2.Chunks[0] != m.Chunks[0] {
+			t.Error("first chunk changed after an edit near the end")
+		}
+		if m2.Chunks[len(m2.Chunks)-1] == m.Chunks[len(m.Chunks)-1] {
+			t.Error("last chunk unchanged after an edit inside it")
+		}
+	}
+}
+
 func TestWalkDeterminism(t *testing.T) {
 	t.Parallel()
 
@@ -710,6 +1360,31 @@ func TestWalkDeterminism(t *testing.T) {
 func TestWalkEdgeCases(t *testing.T) {
 	t.Parallel()
 
+	t.Run("store inside root is skipped", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, "file.txt"), "content")
+		s, err := store.Open(filepath.Join(root, ".smerkle"))
+		if err != nil {
+			t.Fatalf("store.Open() error = %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+
+		result, err := Walk(context.Background(), root, s)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+
+		tree, err := s.GetTree(result.Hash)
+		if err != nil {
+			t.Fatalf("GetTree() error = %v", err)
+		}
+		if len(tree.Entries) != 1 || tree.Entries[0].Name != "file.txt" {
+			t.Errorf("tree entries = %v, want only file.txt", tree.Entries)
+		}
+	})
+
 	t.Run("empty directory in tree", func(t *testing.T) {
 		t.Parallel()
 
@@ -869,6 +1544,237 @@ func TestWalkConcurrency(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("single file descriptor", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		for i := range 10 {
+			dir := filepath.Join(root, string(rune('a'+i)), "nested")
+			for j := range 5 {
+				writeFile(t, filepath.Join(dir, string(rune('a'+j))+".txt"), dir)
+			}
+		}
+
+		want, err := Walk(context.Background(), root, setupStore(t))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		got, err := Walk(context.Background(), root, setupStore(t), WithMaxOpenFiles(1))
+		if err != nil {
+			t.Fatalf("Walk(WithMaxOpenFiles(1)) error = %v", err)
+		}
+		if len(got.Errors) != 0 || got.Hash != want.Hash {
+			t.Errorf("Walk(WithMaxOpenFiles(1)) = %s, errors %v; want %s", got.Hash, got.Errors, want.Hash)
+		}
+	})
+
+	t.Run("wide directory stays within the worker limit", func(t *testing.T) {
+		t.Parallel()
+
+		root := t.TempDir()
+		for i := range 200 {
+			writeFile(t, filepath.Join(root, "wide", fmt.Sprintf("f%03d.txt", i)), "x")
+		}
+		writeFile(t, filepath.Join(root, "deep", "a", "b", "c.txt"), "c")
+
+		// every Lstat lingers, so unbounded workers would pile up here
+		var inFlight, peak atomic.Int32
+		fsys := &vfs.FaultFS{FS: vfs.OS{}, Inject: func(op vfs.Op, _ string) error {
+			if op == vfs.OpLstat {
+				n := inFlight.Add(1)
+				for p := peak.Load(); n > p; p = peak.Load() {
+					if peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(100 * time.Microsecond)
+				inFlight.Add(-1)
+			}
+			return nil
+		}}
+
+		const workers = 2
+		want, err := Walk(context.Background(), root, setupStore(t))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		got, err := Walk(context.Background(), root, setupStore(t), WithFS(fsys), WithConcurrency(workers))
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+		if got.Hash != want.Hash {
+			t.Errorf("Walk(WithConcurrency(%d)) = %s, want %s", workers, got.Hash, want.Hash)
+		}
+		// the workers plus the goroutine that called Walk
+		if p := peak.Load(); p > workers+1 {
+			t.Errorf("peak concurrent entries = %d, want at most %d", p, workers+1)
+		}
+	})
+
+	if n := DefaultMaxOpenFiles(); n < 1 || n > maxDefaultFDs {
+		t.Errorf("DefaultMaxOpenFiles() = %d, want 1..%d", n, maxDefaultFDs)
+	}
+}
+
+func TestReadStable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		rereads    int
+		wantStable bool
+	}{
+		{name: "no rereads reports unstable", rereads: 0, wantStable: false},
+		{name: "reread recovers", rereads: 1, wantStable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "f.txt")
+			writeFile(t, path, "before")
+			stale, err := os.Lstat(path)
+			if err != nil {
+				t.Fatalf("Lstat() error = %v", err)
+			}
+			// simulate a write landing between Lstat and the read
+			writeFile(t, path, "after, and longer")
+
+			w := &walker{fs: vfs.OS{}, rereads: tt.rereads, fds: make(chan struct{}, 1)}
+			content, info, stable, err := w.readStable(path, object.ModeRegular, stale)
+			if err != nil {
+				t.Fatalf("readStable() error = %v", err)
+			}
+			if stable != tt.wantStable {
+				t.Errorf("stable = %v, want %v", stable, tt.wantStable)
+			}
+			if string(content) != "after, and longer" {
+				t.Errorf("content = %q", content)
+			}
+			if stable && info.Size() != int64(len(content)) {
+				t.Errorf("info.Size() = %d, want %d", info.Size(), len(content))
+			}
+		})
+	}
+}
+
+func TestWalkModifiedDuringRead(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		rereads      int
+		wantUnstable bool
+	}{
+		{name: "no rereads", rereads: 0, wantUnstable: true},
+		{name: "reread", rereads: 1, wantUnstable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			path := filepath.Join(root, "f.txt")
+			writeFile(t, path, "before")
+			var once sync.Once
+			fsys := &vfs.FaultFS{FS: vfs.OS{}, Inject: func(op vfs.Op, name string) error {
+				if op == vfs.OpReadFile && name == path {
+					// a write lands between the walker's Lstat and read
+					once.Do(func() { writeFile(t, path, "after, and longer") })
+				}
+				return nil
+			}}
+
+			res, err := Walk(context.Background(), root, setupStore(t),
+				WithFS(fsys), WithRereadUnstable(tt.rereads))
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			if got := len(res.Unstable) == 1; got != tt.wantUnstable {
+				t.Errorf("Unstable = %v, want unstable %v", res.Unstable, tt.wantUnstable)
+			}
+		})
+	}
+}
+
+func TestWalkXattrCache(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewXattrCache()
+	if errors.Is(err, ErrXattrUnsupported) {
+		t.Skip("extended attributes not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("NewXattrCache() error = %v", err)
+	}
+
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	writeFile(t, path, "content")
+	if err := setxattr(path, xattrName, []byte{0}); err != nil {
+		t.Skipf("filesystem does not support user xattrs: %v", err)
+	}
+
+	first, err := Walk(context.Background(), root, setupStore(t), WithCache(c))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatalf("Lstat() error = %v", err)
+	}
+	if _, ok := c.Lookup("", path, info); !ok {
+		t.Fatal("Lookup() after walk = miss, want hit")
+	}
+
+	// a fresh store must still end up holding the blob despite the cache hit
+	s := setupStore(t)
+	second, err := Walk(context.Background(), root, s, WithCache(c))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if second.Hash != first.Hash {
+		t.Errorf("Hash = %s, want %s", second.Hash, first.Hash)
+	}
+	tree, err := s.GetTree(second.Hash)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	if !s.HasObject(tree.Entries[0].Hash) {
+		t.Error("blob missing from second store")
+	}
+
+	// modification invalidates the attribute
+	writeFile(t, path, "changed content")
+	info, err = os.Lstat(path)
+	if err != nil {
+		t.Fatalf("Lstat() error = %v", err)
+	}
+	if _, ok := c.Lookup("", path, info); ok {
+		t.Error("Lookup() after modification = hit, want miss")
+	}
+}
+
+func TestXattrEncoding(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Unix(1700000000, 123456789)
+	h := object.HashBytes([]byte("x"))
+
+	size, gotTime, gotHash, ok := decodeXattr(encodeXattr(42, modTime, h))
+	if !ok || size != 42 || !gotTime.Equal(modTime) || gotHash != h {
+		t.Errorf("decodeXattr() = %d, %v, %s, %v", size, gotTime, gotHash, ok)
+	}
+
+	for _, data := range [][]byte{nil, {0}, {xattrVersion, 1, 2}, append(encodeXattr(1, modTime, h), 0)} {
+		if _, _, _, ok := decodeXattr(data); ok {
+			t.Errorf("decodeXattr(%x) ok = true, want false", data)
+		}
+	}
 }
 
 func setupStore(t *testing.T) *store.Store {
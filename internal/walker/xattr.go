@@ -0,0 +1,87 @@
+package walker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+// ErrXattrUnsupported is returned by NewXattrCache on platforms without
+// extended attribute support.
+var ErrXattrUnsupported = errors.New("walker: extended attributes not supported on this platform")
+
+// xattrName holds the cached hash on each file.
+const xattrName = "user.smerkle.hash"
+
+// xattrVersion is bumped whenever the value layout or hash algorithm changes,
+// so stale attributes are ignored rather than misread.
+const xattrVersion byte = 1
+
+// xattrCache stores each file's hash and validation metadata in an extended
+// attribute on the file itself. The cache survives store deletion and is
+// shared by every store that walks the same tree.
+type xattrCache struct{}
+
+// NewXattrCache returns a Cache backed by extended attributes. Files whose
+// attributes can't be written (read-only, unsupported filesystem) are simply
+// rehashed on every walk.
+func NewXattrCache() (Cache, error) {
+	if !xattrSupported {
+		return nil, ErrXattrUnsupported
+	}
+	return xattrCache{}, nil
+}
+
+func (xattrCache) Lookup(_, absPath string, info os.FileInfo) (object.Hash, bool) {
+	data, err := getxattr(absPath, xattrName)
+	if err != nil {
+		return object.ZeroHash, false
+	}
+	size, modTime, h, ok := decodeXattr(data)
+	if !ok || size != info.Size() || !modTime.Equal(info.ModTime()) {
+		return object.ZeroHash, false
+	}
+	return h, true
+}
+
+func (xattrCache) Update(_, absPath string, info os.FileInfo, h object.Hash) {
+	_ = setxattr(absPath, xattrName, encodeXattr(info.Size(), info.ModTime(), h))
+}
+
+// encodeXattr lays out version, size, mtime seconds and nanoseconds, then the
+// hash, all big-endian.
+func encodeXattr(size int64, modTime time.Time, h object.Hash) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(xattrVersion)
+	_ = binary.Write(&buf, binary.BigEndian, size)
+	_ = binary.Write(&buf, binary.BigEndian, modTime.Unix())
+	_ = binary.Write(&buf, binary.BigEndian, int32(modTime.Nanosecond())) //nolint:gosec // Nanosecond() returns 0-999999999, always fits in int32
+	buf.Write(h[:])
+	return buf.Bytes()
+}
+
+func decodeXattr(data []byte) (int64, time.Time, object.Hash, bool) {
+	var (
+		size int64
+		secs int64
+		nsec int32
+		h    object.Hash
+	)
+	r := bytes.NewReader(data)
+	if v, err := r.ReadByte(); err != nil || v != xattrVersion {
+		return 0, time.Time{}, h, false
+	}
+	for _, v := range []any{&size, &secs, &nsec, &h} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return 0, time.Time{}, h, false
+		}
+	}
+	if r.Len() != 0 {
+		return 0, time.Time{}, h, false
+	}
+	return size, time.Unix(secs, int64(nsec)), h, true
+}
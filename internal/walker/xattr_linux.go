@@ -0,0 +1,77 @@
+//go:build linux
+
+package walker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/garrettladley/smerkle/internal/object"
+)
+
+const xattrSupported = true
+
+// xattrMaxSize is the largest value Linux allows for a single attribute.
+const xattrMaxSize = 64 << 10
+
+func getxattr(path, name string) ([]byte, error) {
+	// sized for the current layout; grow once if a future version is larger
+	buf := make([]byte, 64)
+	for {
+		n, err := syscall.Getxattr(path, name, buf)
+		if errors.Is(err, syscall.ERANGE) && len(buf) < xattrMaxSize {
+			buf = make([]byte, len(buf)*4)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getxattr: %w", err)
+		}
+		return buf[:n], nil
+	}
+}
+
+func setxattr(path, name string, value []byte) error {
+	if err := syscall.Setxattr(path, name, value, 0); err != nil {
+		return fmt.Errorf("setxattr: %w", err)
+	}
+	return nil
+}
+
+// listxattrs reads every extended attribute of path, none where the
+// filesystem doesn't support them.
+func listxattrs(path string) ([]object.Xattr, error) {
+	buf := make([]byte, 256)
+	for {
+		n, err := syscall.Listxattr(path, buf)
+		if errors.Is(err, syscall.ERANGE) && len(buf) < xattrMaxSize {
+			buf = make([]byte, len(buf)*4)
+			continue
+		}
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listxattr: %w", err)
+		}
+		buf = buf[:n]
+		break
+	}
+
+	var xattrs []object.Xattr
+	for name := range bytes.SplitSeq(bytes.TrimSuffix(buf, []byte{0}), []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := getxattr(path, string(name))
+		if errors.Is(err, syscall.ENODATA) {
+			continue // removed since listed
+		}
+		if err != nil {
+			return nil, err
+		}
+		xattrs = append(xattrs, object.Xattr{Name: string(name), Value: value})
+	}
+	return xattrs, nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package walker
+
+import "github.com/garrettladley/smerkle/internal/object"
+
+const xattrSupported = false
+
+func getxattr(_, _ string) ([]byte, error) {
+	return nil, ErrXattrUnsupported
+}
+
+func setxattr(_, _ string, _ []byte) error {
+	return ErrXattrUnsupported
+}
+
+// listxattrs reports no extended attributes where they aren't supported.
+func listxattrs(_ string) ([]object.Xattr, error) {
+	return nil, nil
+}
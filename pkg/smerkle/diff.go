@@ -0,0 +1,27 @@
+package smerkle
+
+import (
+	"github.com/garrettladley/smerkle/internal/diff"
+)
+
+type (
+	DiffResult  = diff.Result  // changes sorted by path
+	DiffOptions = diff.Options // zero value compares only the top level
+	Change      = diff.Change
+	ChangeType  = diff.ChangeType
+	DiffStat    = diff.Stat     // totals from DiffResult.Stat
+	StatLine    = diff.StatLine // file count and bytes of a group of changes
+)
+
+const (
+	ChangeAdded      = diff.ChangeAdded
+	ChangeDeleted    = diff.ChangeDeleted
+	ChangeModified   = diff.ChangeModified
+	ChangeTypeChange = diff.ChangeTypeChange
+	ChangeCopied     = diff.ChangeCopied
+)
+
+// Diff compares the trees oldRoot and newRoot in s.
+func Diff(s *Store, oldRoot, newRoot Hash, opts DiffOptions) (*DiffResult, error) {
+	return diff.Diff(s, oldRoot, newRoot, opts) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
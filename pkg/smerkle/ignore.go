@@ -0,0 +1,67 @@
+package smerkle
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/garrettladley/smerkle/internal/ignore"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// Ignorer matches paths against gitignore-style patterns; the last matching
+// pattern wins and "!" patterns re-include.
+type Ignorer = ignore.Ignorer
+
+type (
+	IgnoreMatch   = ignore.Result  // which pattern decided a path
+	IgnoreWarning = ignore.Warning // a pattern skipped because it didn't compile
+)
+
+// CompileIgnore compiles patterns, one per element, as if they were the
+// lines of an ignore file. Unlike the lines of a file, an element that fails
+// to compile is an error rather than a warning, since callers building
+// patterns from flags or config want to hear about it.
+func CompileIgnore(patterns ...string) (*Ignorer, error) {
+	for _, p := range patterns {
+		if strings.ContainsAny(p, "\r\n") {
+			return nil, fmt.Errorf("%w: %q contains a newline", ErrInvalidIgnore, p)
+		}
+	}
+	ign, err := ParseIgnore(strings.NewReader(strings.Join(patterns, "\n")))
+	if err != nil {
+		return nil, err
+	}
+	if warnings := ign.Warnings(); len(warnings) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIgnore, warnings[0])
+	}
+	return ign, nil
+}
+
+// ParseIgnore compiles an ignore file read from r.
+func ParseIgnore(r io.Reader) (*Ignorer, error) {
+	return ignore.New(r) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// LoadIgnoreFiles compiles the ignore files at paths, later files taking
+// precedence over earlier ones.
+func LoadIgnoreFiles(paths ...string) (*Ignorer, error) {
+	return ignore.NewFromFiles(paths...) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// UserIgnoreFile returns the path of the user-level ignore file,
+// ~/.config/smerkle/ignore on Linux. It may not exist.
+func UserIgnoreFile() (string, error) {
+	return ignore.UserFile() //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// StoreIgnoreFile returns the path of the ignore file kept in the store at
+// dir. It may not exist.
+func StoreIgnoreFile(dir string) string {
+	return store.IgnorePath(dir)
+}
+
+// MergeIgnorers layers ignorers in order of increasing precedence.
+func MergeIgnorers(ignorers ...*Ignorer) *Ignorer {
+	return ignore.Merge(ignorers...)
+}
@@ -0,0 +1,45 @@
+package smerkle
+
+import (
+	"io"
+
+	"github.com/garrettladley/smerkle/internal/report"
+)
+
+// ReportWriter prints walk results and diffs in one of the CLI's output
+// formats, so a tool built on this package can print them identically.
+type ReportWriter = report.Writer
+
+// Formats NewReportWriter accepts:
+//
+//   - ReportText, for people: the root hash or one "M\tpath" line per
+//     change, with warnings on errOut
+//   - ReportJSON: one indented document per result or diff
+//   - ReportNDJSON: one compact line per result or change, and a final
+//     {"truncated":true} line if a diff was cut short
+//   - ReportJSONL: JSON Lines records naming their kind, which a
+//     JSONLWriter can also print while a walk or diff runs
+//   - ReportPorcelain, for scripts: space-separated records such as
+//     "hash <hash>" or "M <old hash> <new hash> <path>", kept stable across
+//     releases, with awkward paths Go-quoted
+const (
+	ReportText      = report.Text
+	ReportJSON      = report.JSON
+	ReportNDJSON    = report.NDJSON
+	ReportJSONL     = report.JSONL
+	ReportPorcelain = report.Porcelain
+)
+
+// JSONLWriter is the ReportJSONL writer. Its WriteEntry and WriteChange
+// suit WithEntryFunc and DiffOptions.OnChange, to print records as they
+// are found.
+type JSONLWriter = report.JSONLWriter
+
+var ErrUnknownFormat = report.ErrUnknownFormat
+
+// NewReportWriter returns a ReportWriter for format that prints to out;
+// only ReportText writes to errOut, which may otherwise be nil. An unknown
+// format fails with ErrUnknownFormat.
+func NewReportWriter(format string, out, errOut io.Writer) (ReportWriter, error) {
+	return report.New(format, out, errOut) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
@@ -0,0 +1,185 @@
+// Package smerkle is the stable Go API for embedding smerkle: open a content
+// store, put and get objects, hash directory trees into it, diff two roots,
+// and compile ignore rules.
+//
+// Its types are aliases of the ones the smerkle CLI is built from, so values
+// pass freely between this package and the command. Only the identifiers
+// declared here are covered by compatibility guarantees; methods on the
+// aliased types that this package doesn't mention may change.
+package smerkle
+
+import (
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/object"
+	"github.com/garrettladley/smerkle/internal/store"
+)
+
+// Hash identifies an object in a Store.
+type Hash = object.Hash
+
+// ZeroHash is the hash of nothing; it never names a stored object.
+var ZeroHash = object.ZeroHash
+
+// ParseHash parses the hex form printed by Hash.String.
+func ParseHash(s string) (Hash, error) {
+	return object.ParseHash(s) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// Algorithm is the hash function a Store is created with.
+type Algorithm = object.Algorithm
+
+const (
+	SHA256           = object.SHA256
+	BLAKE3           = object.BLAKE3
+	DefaultAlgorithm = object.DefaultAlgorithm
+)
+
+// ParseAlgorithm parses "sha256" or "blake3".
+func ParseAlgorithm(s string) (Algorithm, error) {
+	return object.ParseAlgorithm(s) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// Mode is the type of a tree entry.
+type Mode = object.Mode
+
+const (
+	ModeRegular      = object.ModeRegular
+	ModeExecutable   = object.ModeExecutable
+	ModeSymlink      = object.ModeSymlink
+	ModeDirectory    = object.ModeDirectory
+	ModeInaccessible = object.ModeInaccessible
+)
+
+type (
+	Entry = object.Entry // one name in a Tree
+	Tree  = object.Tree  // a directory, entries sorted by name
+	Blob  = object.Blob  // file or symlink content
+
+	Metadata = object.Metadata // permissions, ownership, and xattrs of an Entry
+	Xattr    = object.Xattr    // one extended attribute
+)
+
+// Store is a content-addressed object store on disk. It is safe for
+// concurrent use; Close flushes it.
+type Store = store.Store
+
+// StoreOption configures Open.
+type StoreOption = store.Option
+
+var (
+	ErrAlgorithmMismatch = store.ErrAlgorithmMismatch
+	ErrInvalidRefName    = store.ErrInvalidRefName
+	ErrRefNotFound       = store.ErrRefNotFound
+	ErrRefLocked         = store.ErrRefLocked
+	ErrRefConflict       = store.ErrRefConflict
+	ErrStoreLocked       = store.ErrStoreLocked
+	ErrInvalidPath       = store.ErrInvalidPath
+	ErrPathNotFound      = store.ErrPathNotFound
+	ErrNotPinned         = store.ErrNotPinned
+	ErrObjectMissing     = store.ErrObjectMissing
+)
+
+// Open opens the store at dir, creating it if needed.
+func Open(dir string, opts ...StoreOption) (*Store, error) {
+	return store.Open(dir, opts...) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// WithAlgorithm creates a new store with alg, and fails Open with
+// ErrAlgorithmMismatch if an existing store uses another algorithm.
+func WithAlgorithm(alg Algorithm) StoreOption {
+	return store.WithAlgorithm(alg)
+}
+
+// WithLazyIndex defers reading the path index until a walk first needs it,
+// for callers that only read objects.
+func WithLazyIndex() StoreOption {
+	return store.WithLazyIndex()
+}
+
+// WithScratch holds objects written through the store in memory and never
+// persists anything, for previews that must leave the store untouched.
+func WithScratch() StoreOption {
+	return store.WithScratch()
+}
+
+// WithModTimeGranularity compares modification times in the path index only
+// to multiples of d, for filesystems with coarse timestamps such as FAT or
+// some NFS servers.
+func WithModTimeGranularity(d time.Duration) StoreOption {
+	return store.WithModTimeGranularity(d)
+}
+
+// LockMode is how an open store is locked against other processes.
+type LockMode = store.LockMode
+
+const (
+	LockNone      = store.LockNone      // no lock, the default
+	LockShared    = store.LockShared    // readers and object writers
+	LockExclusive = store.LockExclusive // anything that updates the index
+)
+
+// WithLock holds an advisory lock on the store in mode until Close, so
+// processes updating the same index don't clobber each other.
+func WithLock(mode LockMode) StoreOption {
+	return store.WithLock(mode)
+}
+
+// WithLockWait makes Open wait up to d for a conflicting lock instead of
+// failing with ErrStoreLocked.
+func WithLockWait(d time.Duration) StoreOption {
+	return store.WithLockWait(d)
+}
+
+// ReadAlgorithm reports the algorithm of the store at dir without opening
+// it; ok is false when no store exists there yet.
+func ReadAlgorithm(dir string) (alg Algorithm, ok bool, err error) {
+	return store.ReadAlgorithm(dir) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// StoreConfig is a store's algorithm and the settings kept with it; see
+// Store.SetSetting.
+type StoreConfig = object.StoreConfig
+
+// ReadStoreConfig returns the config of the store at dir without opening
+// it; ok is false when no store exists there yet.
+func ReadStoreConfig(dir string) (cfg *StoreConfig, ok bool, err error) {
+	return store.ReadConfig(dir) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// ValidateRefName reports whether name can be used as a ref.
+func ValidateRefName(name string) error {
+	return store.ValidateRefName(name) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+type (
+	Ref         = store.Ref
+	Stats       = store.Stats
+	ChunkStats  = store.ChunkStats
+	ObjectStats = store.ObjectStats
+	TypeStats   = store.TypeStats
+	ObjectSize  = store.ObjectSize
+	CacheStats  = object.CacheStats
+	GCOptions   = store.GCOptions
+	GCResult    = store.GCResult
+	Retention   = store.Retention
+	Event       = store.Event
+	RootRecord  = store.RootRecord
+	EventKind   = store.EventKind
+)
+
+// Object types as ObjectStats names them.
+const (
+	TypeBlob     = store.TypeBlob
+	TypeTree     = store.TypeTree
+	TypeManifest = store.TypeManifest
+	TypeSnapshot = store.TypeSnapshot
+	TypeUnknown  = store.TypeUnknown
+)
+
+const (
+	EventRoot      = store.EventRoot
+	EventSnapshot  = store.EventSnapshot
+	EventRef       = store.EventRef
+	EventRefDelete = store.EventRefDelete
+)
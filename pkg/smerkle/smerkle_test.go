@@ -0,0 +1,93 @@
+package smerkle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkAndDiff(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "build", "out.o"), "obj")
+
+	s, err := Open(t.TempDir(), WithAlgorithm(BLAKE3))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck // Close() in a test
+
+	ign, err := CompileIgnore("build/")
+	if err != nil {
+		t.Fatalf("CompileIgnore() error = %v", err)
+	}
+	before, err := Walk(t.Context(), dir, s, WithIgnorer(ign))
+	if err != nil || !before.Clean() {
+		t.Fatalf("Walk() = %+v, %v", before, err)
+	}
+
+	tree, err := s.GetTree(before.Hash)
+	if err != nil {
+		t.Fatalf("GetTree() error = %v", err)
+	}
+	if len(tree.Entries) != 1 || tree.Entries[0].Name != "a.txt" {
+		t.Fatalf("tree entries = %+v, want only a.txt", tree.Entries)
+	}
+	content, err := s.ReadFile(tree.Entries[0].Hash)
+	if err != nil || string(content) != "a" {
+		t.Fatalf("ReadFile() = %q, %v; want %q", content, err, "a")
+	}
+
+	writeFile(t, filepath.Join(dir, "a.txt"), "changed")
+	after, err := Walk(t.Context(), dir, s, WithIgnorer(ign))
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	changes, err := Diff(s, before.Hash, after.Hash, DiffOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(changes.Changes) != 1 || changes.Changes[0].Type != ChangeModified || changes.Changes[0].Path != "a.txt" {
+		t.Errorf("Diff() = %+v, want a.txt modified", changes.Changes)
+	}
+}
+
+func TestCompileIgnore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		patterns []string
+		wantErr  bool
+	}{
+		{name: "valid", patterns: []string{"*.log", "!keep.log"}},
+		{name: "none", patterns: nil},
+		{name: "newline", patterns: []string{"a\nb"}, wantErr: true},
+		{name: "invalid pattern", patterns: []string{"[unclosed"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := CompileIgnore(tt.patterns...)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("CompileIgnore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidIgnore) {
+				t.Errorf("CompileIgnore() error = %v, want ErrInvalidIgnore", err)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
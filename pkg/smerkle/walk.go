@@ -0,0 +1,294 @@
+package smerkle
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/garrettladley/smerkle/internal/result"
+	"github.com/garrettladley/smerkle/internal/walker"
+)
+
+// DefaultIgnoreFileName is the per-tree ignore file Walk loads from the
+// root unless WithIgnoreFileName names another.
+const DefaultIgnoreFileName = walker.DefaultIgnoreFileName
+
+var (
+	ErrRootNotDirectory = walker.ErrRootNotDirectory
+	ErrRootNotExist     = walker.ErrRootNotExist
+	ErrInvalidIgnore    = walker.ErrInvalidIgnore
+	ErrInvalidOverlay   = walker.ErrInvalidOverlay
+	ErrXattrUnsupported = walker.ErrXattrUnsupported
+
+	ErrUnknownSymlinkPolicy = walker.ErrUnknownSymlinkPolicy
+
+	ErrNotFile      = walker.ErrNotFile
+	ErrFileUnstable = walker.ErrFileUnstable
+)
+
+// WalkResult is the root hash of a walk and everything that kept it from
+// being an exact picture of the tree on disk.
+type WalkResult = result.Result
+
+type (
+	Warning     = result.Warning
+	WarningKind = result.WarningKind
+
+	// LinkGroup is a file the walk reached through several hard links and
+	// read once; see WalkResult.HardLinks.
+	LinkGroup = result.LinkGroup
+
+	// WalkMetrics counts the files a walk hashed and took from the cache;
+	// see WalkResult.Metrics.
+	WalkMetrics = result.Metrics
+)
+
+const (
+	WarningSpecialFile   = result.WarningSpecialFile
+	WarningUnstable      = result.WarningUnstable
+	WarningUnvisited     = result.WarningUnvisited
+	WarningIgnorePattern = result.WarningIgnorePattern
+	WarningSymlinkCycle  = result.WarningSymlinkCycle
+	WarningTooLarge      = result.WarningTooLarge
+	WarningTooDeep       = result.WarningTooDeep
+)
+
+// SymlinkPolicy says what Walk does with symbolic links; see
+// WithSymlinkPolicy.
+type SymlinkPolicy = walker.SymlinkPolicy
+
+const (
+	SymlinkRecord = walker.SymlinkRecord // store the link's target path (default)
+	SymlinkSkip   = walker.SymlinkSkip   // leave links out
+	SymlinkFollow = walker.SymlinkFollow // hash what links point to
+)
+
+// HashFile stores the single file at path as Walk would inside a directory
+// and returns its entry; Hash is the blob hash. It fails with ErrNotFile for
+// a directory and ErrFileUnstable for a file changing while read.
+func HashFile(ctx context.Context, path string, s *Store, opts ...WalkOption) (Entry, error) {
+	return walker.HashFile(ctx, path, s, opts...) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// HashReader stores everything read from r as HashFile stores a regular
+// file and returns its unnamed entry.
+func HashReader(ctx context.Context, r io.Reader, s *Store, opts ...WalkOption) (Entry, error) {
+	return walker.HashReader(ctx, r, s, opts...) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// WalkOption configures Walk.
+type WalkOption = walker.Option
+
+// Progress is how far a walk has got; see WithProgress.
+type Progress = walker.Progress
+
+// Walk hashes the directory tree at root into s and returns its root hash.
+// Unreadable entries don't fail the walk; they are reported in the result.
+func Walk(ctx context.Context, root string, s *Store, opts ...WalkOption) (*WalkResult, error) {
+	return walker.Walk(ctx, root, s, opts...) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// WithIgnorer skips paths ign matches, on top of the tree's ignore files.
+func WithIgnorer(ign *Ignorer) WalkOption {
+	return walker.WithIgnorer(ign)
+}
+
+// WithGlobalIgnorer layers ign beneath the tree's own ignore rules, which
+// override it; for rules shared by every tree, like UserIgnoreFile's.
+func WithGlobalIgnorer(ign *Ignorer) WalkOption {
+	return walker.WithGlobalIgnorer(ign)
+}
+
+// WithOnly hashes only the paths only matches, and the directories leading
+// to them.
+func WithOnly(only *Ignorer) WalkOption {
+	return walker.WithOnly(only)
+}
+
+// WithIgnoreFileName loads name from each directory instead of
+// DefaultIgnoreFileName.
+func WithIgnoreFileName(name string) WalkOption {
+	return walker.WithIgnoreFileName(name)
+}
+
+// WithIncludeIgnoreFile hashes ignore files like any other file.
+func WithIncludeIgnoreFile() WalkOption {
+	return walker.WithIncludeIgnoreFile()
+}
+
+// WithStrictIgnore fails the walk with ErrInvalidIgnore on an invalid
+// pattern instead of skipping it.
+func WithStrictIgnore() WalkOption {
+	return walker.WithStrictIgnore()
+}
+
+// WithChunking splits files of at least threshold bytes into
+// content-defined chunks. Roots only compare equal when walked with the
+// same threshold.
+func WithChunking(threshold int64) WalkOption {
+	return walker.WithChunking(threshold)
+}
+
+// WithConcurrency bounds concurrent file reads; n <= 0 means one per CPU.
+func WithConcurrency(n int) WalkOption {
+	return walker.WithConcurrency(n)
+}
+
+// WithMaxOpenFiles caps the file descriptors a walk holds at once.
+func WithMaxOpenFiles(n int) WalkOption {
+	return walker.WithMaxOpenFiles(n)
+}
+
+// WithMemoryLimit caps the file content a walk holds in memory at once to
+// about n bytes, streaming files too large to read whole. It never changes
+// a hash.
+func WithMemoryLimit(n int64) WalkOption {
+	return walker.WithMemoryLimit(n)
+}
+
+// WithProgress calls fn with the running totals after each file. Calls
+// never overlap but run on the walk's workers, so fn should be quick.
+func WithProgress(fn func(Progress)) WalkOption {
+	return walker.WithProgress(fn)
+}
+
+// WithEntryFunc calls fn with each entry as the walk finalizes it, with its
+// slash-separated path from the root. Calls never overlap but come in no
+// particular order on the walk's workers.
+func WithEntryFunc(fn func(path string, e Entry)) WalkOption {
+	return walker.WithEntryFunc(fn)
+}
+
+// WithStreamThreshold streams files of at least n bytes into the store
+// instead of reading them whole; the default is 64 MiB. It never changes a
+// hash. If n <= 0, files are only streamed to stay within WithMemoryLimit.
+func WithStreamThreshold(n int64) WalkOption {
+	return walker.WithStreamThreshold(n)
+}
+
+// WithPruneCache removes cached hashes of files the walk no longer finds,
+// within its cache namespace, reporting the count in WalkResult.Pruned.
+// Partial walks and walks scoped with WithOnly prune nothing.
+func WithPruneCache() WalkOption {
+	return walker.WithPruneCache()
+}
+
+// WithBudget stops starting new work after d and returns a partial root;
+// see WalkResult.Partial.
+func WithBudget(d time.Duration) WalkOption {
+	return walker.WithBudget(d)
+}
+
+// WithMaxFileSize leaves files larger than n bytes out with a
+// WarningTooLarge.
+func WithMaxFileSize(n int64) WalkOption {
+	return walker.WithMaxFileSize(n)
+}
+
+// WithMaxDepth leaves out directories n levels below the root, and all they
+// hold, with a WarningTooDeep.
+func WithMaxDepth(n int) WalkOption {
+	return walker.WithMaxDepth(n)
+}
+
+// WithMaxFiles hashes at most n files and reports the rest in
+// WalkResult.Unvisited, as an exhausted budget does.
+func WithMaxFiles(n int) WalkOption {
+	return walker.WithMaxFiles(n)
+}
+
+// WithVolatileFirst walks the subdirectories that changed most often first.
+// It never affects the hash.
+func WithVolatileFirst() WalkOption {
+	return walker.WithVolatileFirst()
+}
+
+// WithRereadUnstable rereads a file changing under the walk up to n more
+// times before reporting it as unstable.
+func WithRereadUnstable(n int) WalkOption {
+	return walker.WithRereadUnstable(n)
+}
+
+// WithSourceRoot declares root a copy of dir, so a store inside dir is still
+// left out of the hash.
+func WithSourceRoot(dir string) WalkOption {
+	return walker.WithSourceRoot(dir)
+}
+
+// WithCacheNamespace keeps cached file hashes of walks of different roots
+// sharing one store apart.
+func WithCacheNamespace(ns string) WalkOption {
+	return walker.WithCacheNamespace(ns)
+}
+
+// WithSymlinkPolicy sets what the walk does with symbolic links. Skipping
+// or following them changes the root hash.
+func WithSymlinkPolicy(p SymlinkPolicy) WalkOption {
+	return walker.WithSymlinkPolicy(p)
+}
+
+// ParseSymlinkPolicy returns the policy named record, skip, or follow.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	return walker.ParseSymlinkPolicy(s) //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// WithInaccessibleEntries records unreadable paths as ModeInaccessible
+// entries instead of leaving them out.
+func WithInaccessibleEntries() WalkOption {
+	return walker.WithInaccessibleEntries()
+}
+
+// WithFullMetadata records every entry's permission bits, owner, group, and
+// extended attributes in Entry.Meta, for an audit baseline. It changes the
+// root hash.
+func WithFullMetadata() WalkOption {
+	return walker.WithFullMetadata()
+}
+
+// WithModTimes stores every entry's modification time in its tree, so the
+// root hash changes when only timestamps do. It changes the root hash.
+func WithModTimes() WalkOption {
+	return walker.WithModTimes()
+}
+
+// Cache remembers file hashes between walks; by default they are kept in
+// the store's index.
+type Cache = walker.Cache
+
+// WithCache replaces the store index cache with c.
+func WithCache(c Cache) WalkOption {
+	return walker.WithCache(c)
+}
+
+// NewXattrCache returns a Cache kept in extended attributes on the walked
+// files, or ErrXattrUnsupported on platforms without them.
+func NewXattrCache() (Cache, error) {
+	return walker.NewXattrCache() //nolint:wrapcheck // forwarded unwrapped: this package is a facade
+}
+
+// Pool shares file read and descriptor limits across concurrent walks.
+type Pool = walker.Pool
+
+// NewPool returns a pool of n read slots and fds descriptors; values <= 0
+// pick defaults.
+func NewPool(n, fds int) *Pool {
+	return walker.NewPool(n, fds)
+}
+
+// WithPool draws the walk's limits from p.
+func WithPool(p *Pool) WalkOption {
+	return walker.WithPool(p)
+}
+
+// Overlay is a set of in-memory file changes applied on top of the walked
+// directory.
+type Overlay = walker.Overlay
+
+func NewOverlay() *Overlay {
+	return walker.NewOverlay()
+}
+
+// WithOverlay walks the tree as if o had been applied to it.
+func WithOverlay(o *Overlay) WalkOption {
+	return walker.WithOverlay(o)
+}